@@ -0,0 +1,371 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Access Grants ---
+//
+// Access grants let a member, typically a guest, unlock the door for a
+// limited time (a hackathon weekend, a visiting speaker) without changing
+// their role or the access rules. A grant covers [starts_at, ends_at),
+// optionally only some rooms, and lets its member in whatever the rules and
+// DOOR_ACCESS_ROLES say. Grants are managed under /access-grants:
+// revoking one keeps it, marked revoked, and a background sweep marks the
+// grants that ran out as expired. Every change is audited.
+
+const (
+	grantActive    = "active" // Stored; shown as scheduled before starts_at
+	grantScheduled = "scheduled"
+	grantExpired   = "expired"
+	grantRevoked   = "revoked"
+
+	maxAccessGrantLength     = 30 * 24 * time.Hour
+	accessGrantSweepInterval = time.Minute
+)
+
+// AccessGrant gives a member door access for a limited time
+type AccessGrant struct {
+	ID        int64     `json:"id"`
+	MemberID  int64     `json:"member_id"`
+	Reason    string    `json:"reason"`
+	Rooms     []string  `json:"rooms"` // Empty for every room
+	StartsAt  time.Time `json:"starts_at"`
+	EndsAt    time.Time `json:"ends_at"`
+	Status    string    `json:"status"` // scheduled, active, expired or revoked
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// AccessGrantRequest is the body of POST /access-grants
+type AccessGrantRequest struct {
+	MemberID int64      `json:"member_id"`
+	Reason   string     `json:"reason"`
+	Rooms    []string   `json:"rooms,omitempty"`
+	StartsAt *time.Time `json:"starts_at,omitempty"` // Default now
+	EndsAt   *time.Time `json:"ends_at,omitempty"`   // Either ends_at...
+	Duration string     `json:"duration,omitempty"`  // ...or a Go duration from starts_at
+}
+
+// accessGrantColumns is the column list scanned by scanAccessGrant
+const accessGrantColumns = `id, member_id, reason, rooms, starts_at, ends_at, status, created_by, created_at`
+
+// scanAccessGrant reads an access grant row selected with accessGrantColumns
+func scanAccessGrant(row rowScanner, now time.Time) (AccessGrant, error) {
+	var g AccessGrant
+	var rooms, startsAt, endsAt, createdAt string
+	if err := row.Scan(&g.ID, &g.MemberID, &g.Reason, &rooms, &startsAt, &endsAt, &g.Status, &g.CreatedBy, &createdAt); err != nil {
+		return g, err
+	}
+	g.Rooms = []string{}
+	if rooms != "" {
+		g.Rooms = strings.Split(rooms, ",")
+	}
+	g.StartsAt, _ = time.Parse(time.RFC3339, startsAt)
+	g.EndsAt, _ = time.Parse(time.RFC3339, endsAt)
+	g.CreatedAt, _ = time.Parse(time.RFC3339, createdAt)
+	g.Status = g.statusAt(now)
+	return g, nil
+}
+
+// statusAt returns the grant's status at a time, which may be past the last sweep
+func (g AccessGrant) statusAt(now time.Time) string {
+	if g.Status != grantActive {
+		return g.Status
+	}
+	if !now.Before(g.EndsAt) {
+		return grantExpired
+	}
+	if now.Before(g.StartsAt) {
+		return grantScheduled
+	}
+	return grantActive
+}
+
+// allows reports whether a grant lets its member in to a room at t
+func (g AccessGrant) allows(room string, t time.Time) bool {
+	return g.statusAt(t) == grantActive && (len(g.Rooms) == 0 || containsString(g.Rooms, room))
+}
+
+// loadAccessGrant loads a grant by ID
+func loadAccessGrant(id int64, now time.Time) (AccessGrant, error) {
+	return scanAccessGrant(db.QueryRow(`SELECT `+accessGrantColumns+` FROM access_grants WHERE id = ?`, id), now)
+}
+
+// loadAccessGrants returns grants, newest first, of one member if memberID is non-zero
+func loadAccessGrants(memberID int64, now time.Time) ([]AccessGrant, error) {
+	query := `SELECT ` + accessGrantColumns + ` FROM access_grants`
+	var args []interface{}
+	if memberID != 0 {
+		query += ` WHERE member_id = ?`
+		args = append(args, memberID)
+	}
+	query += ` ORDER BY id DESC`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	grants := []AccessGrant{}
+	for rows.Next() {
+		g, err := scanAccessGrant(rows, now)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, g)
+	}
+	return grants, rows.Err()
+}
+
+// activeAccessGrant returns a grant letting a member in to a room at t, if any
+func activeAccessGrant(memberID int64, room string, t time.Time) (*AccessGrant, error) {
+	rows, err := db.Query(`SELECT `+accessGrantColumns+` FROM access_grants
+		WHERE member_id = ? AND status = ? AND starts_at <= ? AND ends_at > ? ORDER BY id`,
+		memberID, grantActive, t.UTC().Format(time.RFC3339), t.UTC().Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		g, err := scanAccessGrant(rows, t)
+		if err != nil {
+			return nil, err
+		}
+		if g.allows(room, t) {
+			return &g, nil
+		}
+	}
+	return nil, rows.Err()
+}
+
+// expireAccessGrants marks the grants that ran out as expired and audits them
+func expireAccessGrants(now time.Time) error {
+	rows, err := db.Query(`UPDATE access_grants SET status = ? WHERE status = ? AND ends_at <= ? RETURNING id, member_id`,
+		grantExpired, grantActive, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	var expired []string
+	for rows.Next() {
+		var id, memberID int64
+		if err := rows.Scan(&id, &memberID); err != nil {
+			rows.Close()
+			return err
+		}
+		expired = append(expired, fmt.Sprintf("grant=%d member=%d", id, memberID))
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, detail := range expired {
+		recordAudit("access_grant.expired", "system", detail)
+	}
+	return nil
+}
+
+// startAccessGrantSweeper marks expired grants every accessGrantSweepInterval
+func startAccessGrantSweeper() {
+	ticker := time.NewTicker(accessGrantSweepInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := expireAccessGrants(now); err != nil {
+			log.Printf("Error expiring access grants: %v", err)
+		}
+	}
+}
+
+// handleAccessGrants supports GET to list grants and POST to create one
+// Query parameters (GET):
+//   - member_id: only this member's grants
+//   - status: scheduled, active, expired or revoked
+func handleAccessGrants(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+
+	switch r.Method {
+	case http.MethodGet:
+		var memberID int64
+		if idStr := r.URL.Query().Get("member_id"); idStr != "" {
+			id, err := strconv.ParseInt(idStr, 10, 64)
+			if err != nil {
+				http.Error(w, "Invalid 'member_id' parameter", http.StatusBadRequest)
+				return
+			}
+			memberID = id
+		}
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", grantScheduled, grantActive, grantExpired, grantRevoked:
+		default:
+			http.Error(w, "Invalid 'status' parameter, expected scheduled, active, expired or revoked", http.StatusBadRequest)
+			return
+		}
+
+		grants, err := loadAccessGrants(memberID, now)
+		if err != nil {
+			log.Printf("Error querying access grants: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if status != "" {
+			filtered := []AccessGrant{}
+			for _, g := range grants {
+				if g.Status == status {
+					filtered = append(filtered, g)
+				}
+			}
+			grants = filtered
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grants)
+
+	case http.MethodPost:
+		var req AccessGrantRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		member, ok := memberCache.findByID(req.MemberID)
+		if !ok {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		req.Reason = strings.TrimSpace(req.Reason)
+		if req.Reason == "" {
+			http.Error(w, "reason is required", http.StatusBadRequest)
+			return
+		}
+
+		rooms := []string{}
+		for _, room := range req.Rooms {
+			if room = strings.TrimSpace(room); room != "" && !containsString(rooms, room) {
+				if strings.Contains(room, ",") {
+					http.Error(w, "Room names must not contain commas", http.StatusBadRequest)
+					return
+				}
+				rooms = append(rooms, room)
+			}
+		}
+
+		startsAt := now
+		if req.StartsAt != nil {
+			startsAt = *req.StartsAt
+		}
+		var endsAt time.Time
+		switch {
+		case req.EndsAt != nil && req.Duration != "":
+			http.Error(w, "Give either ends_at or duration, not both", http.StatusBadRequest)
+			return
+		case req.EndsAt != nil:
+			endsAt = *req.EndsAt
+		case req.Duration != "":
+			d, err := time.ParseDuration(req.Duration)
+			if err != nil {
+				http.Error(w, "Invalid 'duration', expected a Go duration such as 48h", http.StatusBadRequest)
+				return
+			}
+			endsAt = startsAt.Add(d)
+		default:
+			http.Error(w, "ends_at or duration is required", http.StatusBadRequest)
+			return
+		}
+		startsAt, endsAt = startsAt.Truncate(time.Second), endsAt.Truncate(time.Second)
+		if !endsAt.After(startsAt) || !endsAt.After(now) {
+			http.Error(w, "The grant must end after it starts, and in the future", http.StatusBadRequest)
+			return
+		}
+		if endsAt.Sub(startsAt) > maxAccessGrantLength {
+			http.Error(w, "Grants last at most 30 days; use an access rule for lasting access", http.StatusBadRequest)
+			return
+		}
+
+		createdBy := clientIP(r)
+		res, err := db.Exec(`INSERT INTO access_grants (member_id, reason, rooms, starts_at, ends_at, status, created_by, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			member.ID, req.Reason, strings.Join(rooms, ","), startsAt.UTC().Format(time.RFC3339), endsAt.UTC().Format(time.RFC3339),
+			grantActive, createdBy, now.UTC().Format(time.RFC3339))
+		if err != nil {
+			log.Printf("Error inserting access grant: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		id, _ := res.LastInsertId()
+		grant, err := loadAccessGrant(id, now)
+		if err != nil {
+			log.Printf("Error querying access grant: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("access_grant.created", createdBy, fmt.Sprintf("grant=%d member=%d rooms=%s from=%s to=%s reason=%q",
+			grant.ID, member.ID, strings.Join(rooms, ","), grant.StartsAt.Format(time.RFC3339), grant.EndsAt.Format(time.RFC3339), grant.Reason))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(grant)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleAccessGrant supports GET of a grant by ID and DELETE to revoke it
+func handleAccessGrant(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/access-grants/")
+	if !ok {
+		http.Error(w, "Invalid access grant ID", http.StatusBadRequest)
+		return
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	now := time.Now()
+	grant, err := loadAccessGrant(id, now)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Access grant not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying access grant: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grant)
+
+	case http.MethodDelete:
+		if grant.Status == grantExpired || grant.Status == grantRevoked {
+			http.Error(w, "Access grant already "+grant.Status, http.StatusConflict)
+			return
+		}
+		if _, err := db.Exec(`UPDATE access_grants SET status = ? WHERE id = ?`, grantRevoked, id); err != nil {
+			log.Printf("Error revoking access grant: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		grant.Status = grantRevoked
+		recordAudit("access_grant.revoked", clientIP(r), fmt.Sprintf("grant=%d member=%d", grant.ID, grant.MemberID))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(grant)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
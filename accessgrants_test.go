@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Access Grants Tests
+// ============================================================================
+
+// postAccessGrant posts to /access-grants and returns the response
+func postAccessGrant(body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/access-grants", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handleAccessGrants(rr, req)
+	return rr
+}
+
+// createAccessGrant creates an access grant through POST /access-grants
+func createAccessGrant(t *testing.T, body string) AccessGrant {
+	t.Helper()
+	rr := postAccessGrant(body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var g AccessGrant
+	if err := json.Unmarshal(rr.Body.Bytes(), &g); err != nil {
+		t.Fatalf("failed to parse access grant: %v", err)
+	}
+	return g
+}
+
+func TestHandleAccessGrants_Validation(t *testing.T) {
+	setupTest()
+
+	past := time.Now().Add(-time.Hour).Format(time.RFC3339)
+	for body, code := range map[string]int{
+		`{"member_id":99,"reason":"Hackathon","duration":"48h"}`:                        http.StatusNotFound,
+		`{"member_id":2,"duration":"48h"}`:                                              http.StatusBadRequest,
+		`{"member_id":2,"reason":"Hackathon"}`:                                          http.StatusBadRequest,
+		`{"member_id":2,"reason":"Hackathon","duration":"-1h"}`:                         http.StatusBadRequest,
+		`{"member_id":2,"reason":"Hackathon","duration":"800h"}`:                        http.StatusBadRequest,
+		`{"member_id":2,"reason":"Hackathon","ends_at":"` + past + `"}`:                 http.StatusBadRequest,
+		`{"member_id":2,"reason":"Hackathon","duration":"1h","ends_at":"` + past + `"}`: http.StatusBadRequest,
+	} {
+		if rr := postAccessGrant(body); rr.Code != code {
+			t.Errorf("%s: expected %d, got %v", body, code, rr.Code)
+		}
+	}
+}
+
+func TestHandleAccessGrants_Lifecycle(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	weekend := createAccessGrant(t, `{"member_id":2,"reason":"Hackathon","rooms":["lab"],"duration":"48h"}`)
+	if weekend.Status != grantActive || weekend.EndsAt.Sub(weekend.StartsAt) != 48*time.Hour {
+		t.Errorf("expected an active 48h grant, got %+v", weekend)
+	}
+	later := createAccessGrant(t, fmt.Sprintf(`{"member_id":2,"reason":"Speaker","starts_at":%q,"duration":"3h"}`, now.Add(24*time.Hour).Format(time.RFC3339)))
+	if later.Status != grantScheduled {
+		t.Errorf("expected the future grant scheduled, got %+v", later)
+	}
+
+	// Bob is let in to the lab by the first grant only, and only while it lasts
+	if g, _ := activeAccessGrant(2, "lab", now); g == nil || g.ID != weekend.ID {
+		t.Errorf("expected the weekend grant to apply, got %+v", g)
+	}
+	if g, _ := activeAccessGrant(2, "office", now); g != nil {
+		t.Errorf("expected no grant for the office, got %+v", g)
+	}
+	if g, _ := activeAccessGrant(2, "lab", now.Add(72*time.Hour)); g != nil {
+		t.Errorf("expected no grant after it ended, got %+v", g)
+	}
+
+	// Revoking keeps the grant
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/access-grants/%d", later.ID), nil)
+	rr := httptest.NewRecorder()
+	handleAccessGrant(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	rr = httptest.NewRecorder()
+	handleAccessGrant(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 revoking twice, got %v", rr.Code)
+	}
+
+	// The sweep marks the weekend grant expired once it ran out
+	if err := expireAccessGrants(now.Add(49 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	list := func(query string) []AccessGrant {
+		req, _ := http.NewRequest("GET", "/access-grants"+query, nil)
+		rr := httptest.NewRecorder()
+		handleAccessGrants(rr, req)
+		var grants []AccessGrant
+		json.Unmarshal(rr.Body.Bytes(), &grants)
+		return grants
+	}
+	if got := list("?member_id=2"); len(got) != 2 || got[0].Status != grantRevoked || got[1].Status != grantExpired {
+		t.Errorf("expected the grants revoked and expired, newest first, got %+v", got)
+	}
+	if got := list("?status=active"); len(got) != 0 {
+		t.Errorf("expected no active grants, got %+v", got)
+	}
+
+	for _, action := range []string{"access_grant.created", "access_grant.revoked", "access_grant.expired"} {
+		if entries, _ := loadAuditEntries(action, 10); len(entries) == 0 {
+			t.Errorf("expected %s audited", action)
+		}
+	}
+}
+
+func TestUnlockDoor_AccessGrant(t *testing.T) {
+	setupTest()
+
+	calls := 0
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer relay.Close()
+	t.Setenv("DOOR_RELAY_URL", relay.URL)
+	doorRelay, _ = loadDoorRelay()
+
+	// A guest outside DOOR_ACCESS_ROLES is let in while their grant lasts
+	bob, _ := memberCache.get("TEST_UID_2")
+	bob.Role = roleGuest
+	memberCache.put(bob)
+	grant := createAccessGrant(t, `{"member_id":2,"reason":"Hackathon","duration":"48h"}`)
+
+	scanCard("TEST_UID_2")
+	if calls != 1 {
+		t.Fatalf("expected the door unlocked, got %d calls", calls)
+	}
+	if entries, _ := loadAuditEntries("door.unlocked", 10); len(entries) != 1 || !strings.Contains(entries[0].Detail, fmt.Sprintf("grant=%d", grant.ID)) {
+		t.Errorf("expected the unlock audited with the grant, got %+v", entries)
+	}
+}
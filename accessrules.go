@@ -0,0 +1,392 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Access Rules ---
+//
+// With door control on (see doorlock.go), access rules decide who unlocks
+// the door, when and where. Each rule applies to one member or to everyone
+// with a role, and may be limited to some rooms and to hours written like
+// OFFICE_HOURS ("mon-fri 08:00-22:00, sat 10:00-18:00", in the report time
+// zone). A scan unlocks the door when any rule allows it. Until the first
+// rule is created, DOOR_ACCESS_ROLES decides alone. Either way, an access
+// grant (see accessgrants.go) lets its member in for its time.
+//
+// Rules are managed under /access-rules, and /access-rules/simulate answers
+// whether a member would be let in, and by which rule, without a scan.
+
+// AccessRule allows a member, or everyone with a role, to unlock the door
+type AccessRule struct {
+	ID        int64    `json:"id"`
+	Name      string   `json:"name"`
+	MemberID  *int64   `json:"member_id,omitempty"` // Either a member...
+	Role      string   `json:"role,omitempty"`      // ...or a role
+	Rooms     []string `json:"rooms"`               // Empty for every room
+	Hours     string   `json:"hours,omitempty"`     // Empty for any time
+	CreatedAt string   `json:"created_at"`
+}
+
+// accessRuleColumns is the column list scanned by scanAccessRule
+const accessRuleColumns = `id, name, member_id, role, rooms, hours, created_at`
+
+// scanAccessRule reads an access rule row selected with accessRuleColumns
+func scanAccessRule(row rowScanner) (AccessRule, error) {
+	var rule AccessRule
+	var memberID sql.NullInt64
+	var rooms string
+	if err := row.Scan(&rule.ID, &rule.Name, &memberID, &rule.Role, &rooms, &rule.Hours, &rule.CreatedAt); err != nil {
+		return rule, err
+	}
+	if memberID.Valid {
+		rule.MemberID = &memberID.Int64
+	}
+	rule.Rooms = []string{}
+	if rooms != "" {
+		rule.Rooms = strings.Split(rooms, ",")
+	}
+	return rule, nil
+}
+
+// loadAccessRules returns every access rule, oldest first
+func loadAccessRules() ([]AccessRule, error) {
+	rows, err := db.Query(`SELECT ` + accessRuleColumns + ` FROM access_rules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []AccessRule{}
+	for rows.Next() {
+		rule, err := scanAccessRule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// appliesTo reports whether a rule covers a member
+func (rule AccessRule) appliesTo(m Member) bool {
+	if rule.MemberID != nil {
+		return *rule.MemberID == m.ID
+	}
+	role, _ := normalizeRole(m.Role)
+	return rule.Role == role
+}
+
+// allows reports whether a rule lets a member in to a room at t
+func (rule AccessRule) allows(m Member, room string, t time.Time) bool {
+	if !rule.appliesTo(m) {
+		return false
+	}
+	if len(rule.Rooms) > 0 && !containsString(rule.Rooms, room) {
+		return false
+	}
+	hours, err := parseOfficeHours(rule.Hours)
+	if err != nil {
+		return false // Validated when saved
+	}
+	return !hours.afterHours(t, t.Add(time.Second), reportLocation(defaultOrg))
+}
+
+// containsString reports whether a list holds a value
+func containsString(list []string, value string) bool {
+	for _, v := range list {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// DoorAccess is the decision on whether a member may unlock the door
+type DoorAccess struct {
+	Allowed bool         `json:"allowed"`
+	Rule    *AccessRule  `json:"rule,omitempty"`  // The rule that let them in...
+	Grant   *AccessGrant `json:"grant,omitempty"` // ...or the grant (see accessgrants.go)
+	Reason  string       `json:"reason"`
+}
+
+// evaluateDoorAccess decides whether a member may unlock the door of a room
+// at t, by the access rules or, without any, by the relay's roles, and
+// failing those by an access grant
+func evaluateDoorAccess(relay *doorRelayConfig, m Member, room string, t time.Time) (DoorAccess, error) {
+	rules, err := loadAccessRules()
+	if err != nil {
+		return DoorAccess{}, err
+	}
+
+	role, _ := normalizeRole(m.Role)
+	var denied DoorAccess
+	if len(rules) == 0 {
+		if relay != nil && relay.roles[role] {
+			return DoorAccess{Allowed: true, Reason: "role " + role + " is in DOOR_ACCESS_ROLES"}, nil
+		}
+		denied = DoorAccess{Reason: "role " + role + " has no door access"}
+	} else {
+		for _, rule := range rules {
+			if rule.allows(m, room, t) {
+				return DoorAccess{Allowed: true, Rule: &rule, Reason: fmt.Sprintf("allowed by rule %d (%s)", rule.ID, rule.Name)}, nil
+			}
+		}
+		denied = DoorAccess{Reason: fmt.Sprintf("no access rule allows %s in %s at this time", role, room)}
+	}
+
+	grant, err := activeAccessGrant(m.ID, room, t)
+	if err != nil {
+		return DoorAccess{}, err
+	}
+	if grant != nil {
+		return DoorAccess{Allowed: true, Grant: grant, Reason: fmt.Sprintf("allowed by grant %d (%s)", grant.ID, grant.Reason)}, nil
+	}
+	return denied, nil
+}
+
+// decodeAccessRule reads and validates an access rule payload
+func decodeAccessRule(w http.ResponseWriter, r *http.Request) (AccessRule, bool) {
+	var req AccessRule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return AccessRule{}, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return AccessRule{}, false
+	}
+	if (req.MemberID == nil) == (req.Role == "") {
+		http.Error(w, "Exactly one of member_id or role is required", http.StatusBadRequest)
+		return AccessRule{}, false
+	}
+	if req.MemberID != nil {
+		if _, ok := memberCache.findByID(*req.MemberID); !ok {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return AccessRule{}, false
+		}
+	} else {
+		role, ok := normalizeRole(req.Role)
+		if !ok {
+			http.Error(w, "Invalid role, expected member, exec, officer or guest", http.StatusBadRequest)
+			return AccessRule{}, false
+		}
+		req.Role = role
+	}
+
+	rooms := []string{}
+	for _, room := range req.Rooms {
+		if room = strings.TrimSpace(room); room != "" && !containsString(rooms, room) {
+			if strings.Contains(room, ",") {
+				http.Error(w, "Room names must not contain commas", http.StatusBadRequest)
+				return AccessRule{}, false
+			}
+			rooms = append(rooms, room)
+		}
+	}
+	req.Rooms = rooms
+
+	req.Hours = strings.TrimSpace(req.Hours)
+	if _, err := parseOfficeHours(req.Hours); err != nil {
+		http.Error(w, "Invalid 'hours': "+err.Error(), http.StatusBadRequest)
+		return AccessRule{}, false
+	}
+	return req, true
+}
+
+// accessRuleSummary describes a rule in the audit log
+func accessRuleSummary(rule AccessRule) string {
+	who := "role=" + rule.Role
+	if rule.MemberID != nil {
+		who = fmt.Sprintf("member=%d", *rule.MemberID)
+	}
+	return fmt.Sprintf("%s (%s rooms=%s hours=%q)", rule.Name, who, strings.Join(rule.Rooms, ","), rule.Hours)
+}
+
+// handleAccessRules supports GET to list access rules and POST to create one
+func handleAccessRules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := loadAccessRules()
+		if err != nil {
+			log.Printf("Error querying access rules: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rules)
+
+	case http.MethodPost:
+		req, ok := decodeAccessRule(w, r)
+		if !ok {
+			return
+		}
+
+		req.CreatedAt = time.Now().Format(time.RFC3339)
+		res, err := db.Exec(`INSERT INTO access_rules (name, member_id, role, rooms, hours, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			req.Name, req.MemberID, req.Role, strings.Join(req.Rooms, ","), req.Hours, req.CreatedAt)
+		if err != nil {
+			log.Printf("Error inserting access rule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		req.ID, _ = res.LastInsertId()
+		recordAudit("access_rule.created", clientIP(r), accessRuleSummary(req))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleAccessRule supports GET, PUT and DELETE of an access rule by ID
+func handleAccessRule(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/access-rules/")
+	if !ok {
+		http.Error(w, "Invalid access rule ID", http.StatusBadRequest)
+		return
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err := scanAccessRule(db.QueryRow(`SELECT `+accessRuleColumns+` FROM access_rules WHERE id = ?`, id))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Access rule not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying access rule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+
+	case http.MethodPut:
+		req, ok := decodeAccessRule(w, r)
+		if !ok {
+			return
+		}
+
+		result, err := db.Exec(`UPDATE access_rules SET name = ?, member_id = ?, role = ?, rooms = ?, hours = ? WHERE id = ?`,
+			req.Name, req.MemberID, req.Role, strings.Join(req.Rooms, ","), req.Hours, id)
+		if err != nil {
+			log.Printf("Error updating access rule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Access rule not found", http.StatusNotFound)
+			return
+		}
+		rule, err := scanAccessRule(db.QueryRow(`SELECT `+accessRuleColumns+` FROM access_rules WHERE id = ?`, id))
+		if err != nil {
+			log.Printf("Error querying access rule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("access_rule.updated", clientIP(r), accessRuleSummary(rule))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(rule)
+
+	case http.MethodDelete:
+		result, err := db.Exec(`DELETE FROM access_rules WHERE id = ?`, id)
+		if err != nil {
+			log.Printf("Error deleting access rule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Access rule not found", http.StatusNotFound)
+			return
+		}
+		recordAudit("access_rule.deleted", clientIP(r), fmt.Sprintf("Access rule %d", id))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Access rule deleted successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// handleAccessRulesSimulate answers whether a member would unlock the door
+// Query parameters:
+//   - member_id or uid: the member (required)
+//   - room: the scanned room (default office)
+//   - time: RFC 3339 time of the scan (default now)
+func handleAccessRulesSimulate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	q := r.URL.Query()
+	var member Member
+	var found bool
+	if idStr := q.Get("member_id"); idStr != "" {
+		id, err := strconv.ParseInt(idStr, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid 'member_id' parameter", http.StatusBadRequest)
+			return
+		}
+		member, found = memberCache.findByID(id)
+	} else if uid := q.Get("uid"); uid != "" {
+		member, found = memberCache.get(uid)
+	} else {
+		http.Error(w, "member_id or uid is required", http.StatusBadRequest)
+		return
+	}
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	room := q.Get("room")
+	if room == "" {
+		room = defaultRoom
+	}
+	at := time.Now()
+	if timeStr := q.Get("time"); timeStr != "" {
+		t, err := time.Parse(time.RFC3339, timeStr)
+		if err != nil {
+			http.Error(w, "Invalid 'time' parameter, expected RFC 3339", http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+
+	access, err := evaluateDoorAccess(doorRelay, member, room, at)
+	if err != nil {
+		log.Printf("Error evaluating door access: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		DoorAccess
+		DoorControl bool   `json:"door_control"` // Whether scans unlock the door at all
+		MemberID    int64  `json:"member_id"`
+		Room        string `json:"room"`
+		Time        string `json:"time"`
+	}{access, doorRelay != nil, member.ID, room, at.Format(time.RFC3339)})
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Access Rules Tests
+// ============================================================================
+
+// createAccessRule creates an access rule through POST /access-rules
+func createAccessRule(t *testing.T, body string) AccessRule {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/access-rules", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handleAccessRules(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var rule AccessRule
+	if err := json.Unmarshal(rr.Body.Bytes(), &rule); err != nil {
+		t.Fatalf("failed to parse access rule: %v", err)
+	}
+	return rule
+}
+
+// simulateAccess calls /access-rules/simulate
+func simulateAccess(t *testing.T, query string) (int, DoorAccess) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/access-rules/simulate?"+query, nil)
+	rr := httptest.NewRecorder()
+	handleAccessRulesSimulate(rr, req)
+	var access DoorAccess
+	json.Unmarshal(rr.Body.Bytes(), &access)
+	return rr.Code, access
+}
+
+func TestHandleAccessRules_CRUD(t *testing.T) {
+	setupTest()
+
+	for _, body := range []string{
+		`{"name":"Nobody"}`,
+		`{"name":"Both","member_id":1,"role":"exec"}`,
+		`{"name":"Bad role","role":"janitor"}`,
+		`{"name":"Bad hours","role":"exec","hours":"weekdays"}`,
+	} {
+		req, _ := http.NewRequest("POST", "/access-rules", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handleAccessRules(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %v", body, rr.Code)
+		}
+	}
+
+	rule := createAccessRule(t, `{"name":"Execs","role":"Exec","rooms":["lab"," office ","lab"],"hours":"mon-fri 08:00-22:00"}`)
+	if rule.Role != roleExec || len(rule.Rooms) != 2 || rule.Rooms[1] != "office" {
+		t.Errorf("expected the role and rooms normalized, got %+v", rule)
+	}
+
+	req, _ := http.NewRequest("PUT", "/access-rules/"+fmt.Sprint(rule.ID), strings.NewReader(`{"name":"Alice","member_id":1}`))
+	rr := httptest.NewRecorder()
+	handleAccessRule(rr, req)
+	var updated AccessRule
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if rr.Code != http.StatusOK || updated.MemberID == nil || *updated.MemberID != 1 || updated.Role != "" || len(updated.Rooms) != 0 {
+		t.Errorf("expected the rule replaced, got %v %+v", rr.Code, updated)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/access-rules/"+fmt.Sprint(rule.ID), nil)
+	rr = httptest.NewRecorder()
+	handleAccessRule(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %v", rr.Code)
+	}
+	if rules, _ := loadAccessRules(); len(rules) != 0 {
+		t.Errorf("expected no rules left, got %+v", rules)
+	}
+	if entries, _ := loadAuditEntries("access_rule.", 10); len(entries) != 3 {
+		t.Errorf("expected 3 audit entries, got %+v", entries)
+	}
+}
+
+func TestHandleAccessRulesSimulate(t *testing.T) {
+	setupTest()
+	t.Setenv("DOOR_RELAY_URL", "http://relay.local/unlock")
+	doorRelay, _ = loadDoorRelay()
+
+	loc := reportLocation(defaultOrg)
+	wednesday := time.Date(2026, 1, 14, 10, 0, 0, 0, loc)
+	at := func(t time.Time) string { return "&time=" + url.QueryEscape(t.Format(time.RFC3339)) }
+
+	// Without rules, DOOR_ACCESS_ROLES decides
+	if code, access := simulateAccess(t, "member_id=1"+at(wednesday)); code != http.StatusOK || !access.Allowed || access.Rule != nil {
+		t.Errorf("expected Alice let in by her role, got %v %+v", code, access)
+	}
+
+	rule := createAccessRule(t, `{"name":"Weekday lab","member_id":1,"rooms":["lab"],"hours":"mon-fri 08:00-18:00"}`)
+	for _, tc := range []struct {
+		query   string
+		allowed bool
+	}{
+		{"member_id=1&room=lab" + at(wednesday), true},
+		{"uid=TEST_UID_1&room=lab" + at(wednesday), true},
+		{"member_id=1&room=office" + at(wednesday), false},               // Other room
+		{"member_id=1&room=lab" + at(wednesday.Add(9*time.Hour)), false}, // 19:00
+		{"member_id=1&room=lab" + at(wednesday.AddDate(0, 0, 3)), false}, // Saturday
+		{"member_id=2&room=lab" + at(wednesday), false},                  // Rules now decide alone
+	} {
+		code, access := simulateAccess(t, tc.query)
+		if code != http.StatusOK || access.Allowed != tc.allowed {
+			t.Errorf("%s: expected allowed=%v, got %v %+v", tc.query, tc.allowed, code, access)
+		}
+		if tc.allowed && (access.Rule == nil || access.Rule.ID != rule.ID) {
+			t.Errorf("%s: expected the rule named, got %+v", tc.query, access)
+		}
+	}
+
+	if code, _ := simulateAccess(t, "member_id=99"); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown member, got %v", code)
+	}
+	if code, _ := simulateAccess(t, "room=lab"); code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a member, got %v", code)
+	}
+}
+
+func TestUnlockDoor_AccessRules(t *testing.T) {
+	setupTest()
+
+	calls := 0
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer relay.Close()
+	t.Setenv("DOOR_RELAY_URL", relay.URL)
+	doorRelay, _ = loadDoorRelay()
+
+	// Guests are not in DOOR_ACCESS_ROLES, but a rule lets them in
+	bob, _ := memberCache.get("TEST_UID_2")
+	bob.Role = roleGuest
+	memberCache.put(bob)
+	rule := createAccessRule(t, `{"name":"Guests","role":"guest"}`)
+
+	scanCard("TEST_UID_2") // Bob, a guest
+	scanCard("TEST_UID_1") // Alice, a member without a rule
+	if calls != 1 {
+		t.Errorf("expected only Bob let in, got %d unlocks", calls)
+	}
+	unlocked, _ := loadAuditEntries("door.unlocked", 10)
+	denied, _ := loadAuditEntries("door.denied", 10)
+	if len(unlocked) != 1 || unlocked[0].Actor != "Bob" || !strings.Contains(unlocked[0].Detail, "rule="+fmt.Sprint(rule.ID)) {
+		t.Errorf("expected Bob's unlock audited with the rule, got %+v", unlocked)
+	}
+	if len(denied) != 1 || denied[0].Actor != "Alice" {
+		t.Errorf("expected Alice denied, got %+v", denied)
+	}
+}
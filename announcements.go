@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Speaker Announcements ---
+//
+// Each scan produces a short greeting for the office speaker to say, such as
+// "Welcome back, Alice!". It is returned as "announcement" in the /scan
+// response, for scanners with a speaker of their own, and queued for speaker
+// devices polling /announcements/next. The queue is kept in memory like
+// /scan-history, so with shared state a speaker must poll the instance the
+// scanner posts to. Members who opted out of notifications or have not
+// consented to being named (see consent.go) are greeted without their name,
+// and so is everyone outside the admin view.
+
+const (
+	// announcementsSize is how many announcements are kept for polling
+	announcementsSize = 50
+
+	// announcementMaxAge is how long an announcement is worth saying; older
+	// ones are skipped so a speaker coming back online does not replay them
+	announcementMaxAge = 2 * time.Minute
+
+	// announcementMaxWait caps how long /announcements/next waits for one
+	announcementMaxWait = 30 * time.Second
+)
+
+// Announcement is a greeting for a speaker device to say
+type Announcement struct {
+	ID   int64     `json:"id"`
+	Time time.Time `json:"time"`
+	Kind eventKind `json:"kind"` // sign_in or sign_out
+	Room string    `json:"room"`
+	Text string    `json:"text"`
+}
+
+// queuedAnnouncement is an announcement as stored, with the name kept apart
+// so it can be left out of views that may not see it
+type queuedAnnouncement struct {
+	Announcement
+	greeting string // Without the name, e.g. "Welcome back"
+	name     string // Empty when the member may not be named
+}
+
+// text returns the announcement's text for a view
+func (a queuedAnnouncement) text(view string) string {
+	if a.name == "" || view != scopeAdmin {
+		return a.greeting + "!"
+	}
+	return a.greeting + ", " + a.name + "!"
+}
+
+// forView returns the announcement as shown to a view
+func (a queuedAnnouncement) forView(view string) Announcement {
+	shown := a.Announcement
+	shown.Text = a.text(view)
+	return shown
+}
+
+// announcementStore is a ring buffer of the most recent announcements
+type announcementStore struct {
+	mu      sync.Mutex
+	lastID  int64
+	queue   []queuedAnnouncement
+	waiting chan struct{} // Closed when an announcement is added
+}
+
+// add queues an announcement and wakes pollers waiting for one
+func (s *announcementStore) add(a queuedAnnouncement) queuedAnnouncement {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastID++
+	a.ID = s.lastID
+	s.queue = append(s.queue, a)
+	if len(s.queue) > announcementsSize {
+		s.queue = s.queue[len(s.queue)-announcementsSize:]
+	}
+	if s.waiting != nil {
+		close(s.waiting)
+		s.waiting = nil
+	}
+	return a
+}
+
+// next returns the oldest announcement after the ID given that is for the
+// room (any room if empty) and not older than announcementMaxAge. If there
+// is none, it returns a channel closed when another is added.
+func (s *announcementStore) next(after int64, room string, now time.Time) (queuedAnnouncement, bool, <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, a := range s.queue {
+		if a.ID <= after || now.Sub(a.Time) > announcementMaxAge {
+			continue
+		}
+		if room != "" && a.Room != room {
+			continue
+		}
+		return a, true, nil
+	}
+	if s.waiting == nil {
+		s.waiting = make(chan struct{})
+	}
+	return queuedAnnouncement{}, false, s.waiting
+}
+
+// reset forgets all announcements
+func (s *announcementStore) reset() {
+	s.mu.Lock()
+	s.queue = nil
+	s.mu.Unlock()
+}
+
+// Announcements queued for /announcements/next
+var announcements = &announcementStore{}
+
+// isFirstVisit reports whether a member has no recorded visits
+func isFirstVisit(memberID int64) bool {
+	var visited bool
+	if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM visits WHERE member_id = ?)`, memberID).Scan(&visited); err != nil {
+		log.Printf("Error checking visits of member %d: %v", memberID, err)
+		return false
+	}
+	return !visited
+}
+
+// announceScan is a post-sign-in and post-sign-out hook queuing the greeting
+// for the scan and setting it on the scan context for the response
+func announceScan(sc *ScanContext) error {
+	a := queuedAnnouncement{
+		Announcement: Announcement{Time: sc.Time, Kind: eventSignOut, Room: sc.Room},
+		greeting:     "Goodbye",
+		name:         notificationName(sc.Member),
+	}
+	if a.Room == "" {
+		a.Room = defaultRoom
+	}
+	if sc.SigningIn {
+		a.Kind = eventSignIn
+		a.greeting = "Welcome back"
+		if isFirstVisit(sc.Member.ID) {
+			a.greeting = "Welcome"
+		}
+	}
+	// The office speaker belongs to the host organization
+	if memberOrg(sc.Member) != defaultOrg {
+		a.name = ""
+	}
+
+	// The scanner posting the scan has admin scope
+	sc.Announcement = announcements.add(a).text(scopeAdmin)
+	return nil
+}
+
+// handleAnnouncementsNext returns the next announcement for a speaker device
+// Query parameters:
+//   - after: ID of the last announcement said (default 0)
+//   - room: only announcements for this room
+//   - wait: seconds to wait for one if there is none yet (default 0, at most 30)
+//   - view: public or member (no names) or admin (names), limited by the key's scope
+//
+// Responds 204 No Content if there is no announcement to say.
+func handleAnnouncementsNext(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	view, ok := resolveView(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+	var after int64
+	if s := query.Get("after"); s != "" {
+		var err error
+		if after, err = strconv.ParseInt(s, 10, 64); err != nil || after < 0 {
+			http.Error(w, "Invalid 'after' parameter", http.StatusBadRequest)
+			return
+		}
+	}
+	var wait time.Duration
+	if s := query.Get("wait"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > announcementMaxWait {
+			http.Error(w, fmt.Sprintf("Invalid 'wait' parameter, expected 0 to %d seconds", int(announcementMaxWait.Seconds())), http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+	room := query.Get("room")
+
+	timeout := time.NewTimer(wait)
+	defer timeout.Stop()
+	for {
+		a, found, added := announcements.next(after, room, time.Now())
+		if found {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(a.forView(view))
+			return
+		}
+
+		select {
+		case <-added:
+		case <-timeout.C:
+			w.WriteHeader(http.StatusNoContent)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Scan Announcement Tests
+// ============================================================================
+
+// scanAnnouncement posts a scan and returns the announcement in the response
+func scanAnnouncement(t *testing.T, body string) string {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return resp["announcement"]
+}
+
+// nextAnnouncement calls /announcements/next with a scope
+func nextAnnouncement(url, scope string) (*httptest.ResponseRecorder, Announcement) {
+	rr := httptest.NewRecorder()
+	handleAnnouncementsNext(rr, scopedRequest("GET", url, scope))
+
+	var a Announcement
+	json.Unmarshal(rr.Body.Bytes(), &a)
+	return rr, a
+}
+
+func TestAnnounceScan_Greetings(t *testing.T) {
+	setupTest()
+
+	if got := scanAnnouncement(t, `{"uid":"TEST_UID_1"}`); got != "Welcome, Alice!" {
+		t.Errorf("expected a first visit greeting, got %q", got)
+	}
+	if got := scanAnnouncement(t, `{"uid":"TEST_UID_1"}`); got != "Goodbye, Alice!" {
+		t.Errorf("expected a goodbye, got %q", got)
+	}
+	if got := scanAnnouncement(t, `{"uid":"TEST_UID_1"}`); got != "Welcome back, Alice!" {
+		t.Errorf("expected a welcome back, got %q", got)
+	}
+}
+
+func TestAnnounceScan_OptedOut(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("PUT", "/members/2/notifications", bytes.NewBufferString(`{"opt_out":true}`))
+	handleMember(httptest.NewRecorder(), req)
+
+	if got := scanAnnouncement(t, `{"uid":"TEST_UID_2"}`); got != "Welcome!" {
+		t.Errorf("expected a greeting without Bob's name, got %q", got)
+	}
+}
+
+// ============================================================================
+// /announcements/next Endpoint Tests
+// ============================================================================
+
+func TestHandleAnnouncementsNext(t *testing.T) {
+	setupTest()
+
+	scanAnnouncement(t, `{"uid":"TEST_UID_1"}`)
+	scanAnnouncement(t, `{"uid":"TEST_UID_2","room":"lab"}`)
+
+	rr, first := nextAnnouncement("/announcements/next", scopeAdmin)
+	if rr.Code != http.StatusOK || first.Text != "Welcome, Alice!" || first.Kind != eventSignIn || first.Room != defaultRoom {
+		t.Fatalf("expected Alice's greeting, got %v %+v", rr.Code, first)
+	}
+
+	_, second := nextAnnouncement("/announcements/next?after="+strconv.FormatInt(first.ID, 10), scopeAdmin)
+	if second.Text != "Welcome, Bob!" || second.Room != "lab" {
+		t.Errorf("expected Bob's greeting in the lab, got %+v", second)
+	}
+
+	if rr, _ := nextAnnouncement("/announcements/next?after="+strconv.FormatInt(second.ID, 10), scopeAdmin); rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204 with nothing left, got %v", rr.Code)
+	}
+
+	// Room filter and views without names
+	_, office := nextAnnouncement("/announcements/next?room=office&after="+strconv.FormatInt(first.ID, 10), scopeAdmin)
+	if office.ID != 0 {
+		t.Errorf("expected no more office announcements, got %+v", office)
+	}
+	_, public := nextAnnouncement("/announcements/next", scopeMember)
+	if public.Text != "Welcome!" {
+		t.Errorf("expected no name outside the admin view, got %q", public.Text)
+	}
+}
+
+func TestHandleAnnouncementsNext_SkipsStale(t *testing.T) {
+	setupTest()
+
+	announcements.add(queuedAnnouncement{
+		Announcement: Announcement{Time: time.Now().Add(-announcementMaxAge - time.Second), Kind: eventSignIn, Room: defaultRoom},
+		greeting:     "Welcome back",
+		name:         "Alice",
+	})
+
+	if rr, _ := nextAnnouncement("/announcements/next", scopeAdmin); rr.Code != http.StatusNoContent {
+		t.Errorf("expected a stale announcement to be skipped, got %v", rr.Code)
+	}
+}
+
+func TestHandleAnnouncementsNext_Wait(t *testing.T) {
+	setupTest()
+
+	done := make(chan Announcement)
+	go func() {
+		_, a := nextAnnouncement("/announcements/next?wait=5", scopeAdmin)
+		done <- a
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	scanAnnouncement(t, `{"uid":"TEST_UID_1"}`)
+
+	select {
+	case a := <-done:
+		if a.Text != "Welcome, Alice!" {
+			t.Errorf("expected the waiting poll to get Alice's greeting, got %+v", a)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the waiting poll to return once an announcement was queued")
+	}
+}
+
+func TestHandleAnnouncementsNext_InvalidParams(t *testing.T) {
+	setupTest()
+
+	for _, url := range []string{
+		"/announcements/next?after=abc",
+		"/announcements/next?wait=31",
+		"/announcements/next?wait=-1",
+	} {
+		if rr, _ := nextAnnouncement(url, scopeAdmin); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", url, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Anonymized Export ---
+//
+// GET /admin/export/anonymized exports completed visits without identities,
+// for sharing occupancy datasets with researchers. Each member is replaced by
+// a pseudonym, the same in every export, so visits of one person can still
+// be linked without revealing who they are. Names, card UIDs and Discord IDs
+// never appear, sign-in and sign-out times are truncated to the minute and
+// only host members are included.
+//
+// Pseudonyms are an HMAC of the member ID with ANONYMIZATION_KEY, or with a
+// random key generated on first use and kept in the database. ?dataset=
+// names a separate dataset: its pseudonyms cannot be linked to those of any
+// other dataset, so two recipients cannot join their data.
+
+const anonymizationKeySecret = "anonymization_key"
+
+// AnonymizedVisit is a visit of an anonymized export
+type AnonymizedVisit struct {
+	Participant     string    `json:"participant"`
+	Role            string    `json:"role"`
+	SignInTime      time.Time `json:"signin_time"`
+	SignOutTime     time.Time `json:"signout_time"`
+	DurationSeconds int64     `json:"duration_seconds"`
+}
+
+// anonymizationKey returns the key pseudonyms are derived with, generating
+// and storing one if ANONYMIZATION_KEY is not set
+func anonymizationKey() ([]byte, error) {
+	if key := os.Getenv("ANONYMIZATION_KEY"); key != "" {
+		return []byte(key), nil
+	}
+
+	random := make([]byte, 32)
+	if _, err := rand.Read(random); err != nil {
+		return nil, err
+	}
+	// The first export stores its key, later ones read it back
+	if _, err := db.Exec(`INSERT OR IGNORE INTO server_secrets (name, value) VALUES (?, ?)`, anonymizationKeySecret, hex.EncodeToString(random)); err != nil {
+		return nil, err
+	}
+	var stored string
+	if err := db.QueryRow(`SELECT value FROM server_secrets WHERE name = ?`, anonymizationKeySecret).Scan(&stored); err != nil {
+		return nil, err
+	}
+	return hex.DecodeString(stored)
+}
+
+// pseudonym returns the stable pseudonymous ID of a member within a dataset
+func pseudonym(key []byte, dataset string, memberID int64) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\x00%d", dataset, memberID)
+	return "p_" + hex.EncodeToString(mac.Sum(nil))[:12]
+}
+
+// loadAnonymizedVisits returns the completed visits of host members in [from, to], oldest first
+func loadAnonymizedVisits(from, to time.Time, dataset, times string) ([]AnonymizedVisit, error) {
+	key, err := anonymizationKey()
+	if err != nil {
+		return nil, err
+	}
+	intervals, err := loadPresenceIntervals(from, to, time.Now(), times)
+	if err != nil {
+		return nil, err
+	}
+
+	visits := []AnonymizedVisit{}
+	for _, p := range intervals {
+		if p.Open || p.OrgID != defaultOrg {
+			continue
+		}
+		start, end := p.Start.UTC().Truncate(time.Minute), p.End.UTC().Truncate(time.Minute)
+		visits = append(visits, AnonymizedVisit{
+			Participant:     pseudonym(key, dataset, p.MemberID),
+			Role:            p.Role,
+			SignInTime:      start,
+			SignOutTime:     end,
+			DurationSeconds: int64(end.Sub(start).Seconds()),
+		})
+	}
+	sort.SliceStable(visits, func(i, j int) bool { return visits[i].SignInTime.Before(visits[j].SignInTime) })
+	return visits, nil
+}
+
+// handleAnonymizedExport exports visits with pseudonyms instead of identities
+// Query parameters:
+//   - from, to: RFC3339 formatted period, or term: a term ID or name
+//   - dataset: name of the dataset, each with its own pseudonyms (optional)
+//   - format: csv (default) or jsonl
+//   - times: corrected (default) or raw
+func handleAnonymizedExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	dataset := strings.TrimSpace(r.URL.Query().Get("dataset"))
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		http.Error(w, "Invalid 'format' parameter, expected csv or jsonl", http.StatusBadRequest)
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	visits, err := loadAnonymizedVisits(from, to, dataset, times)
+	if err != nil {
+		log.Printf("Error loading anonymized visits: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	recordAudit("database.exported_anonymized", clientIP(r), fmt.Sprintf("format=%s dataset=%q visits=%d", format, dataset, len(visits)))
+
+	filename := "occupancy-" + time.Now().Format("2006-01-02")
+	if format == "jsonl" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.jsonl"`, filename))
+		enc := json.NewEncoder(w)
+		for _, v := range visits {
+			if err := enc.Encode(v); err != nil {
+				log.Printf("Error writing anonymized export: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.csv"`, filename))
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+
+	if err := writer.Write([]string{"participant", "role", "signin_time", "signout_time", "duration_seconds"}); err != nil {
+		log.Printf("Error writing CSV header: %v", err)
+		return
+	}
+	for _, v := range visits {
+		if err := writer.Write([]string{
+			v.Participant,
+			v.Role,
+			v.SignInTime.Format(time.RFC3339),
+			v.SignOutTime.Format(time.RFC3339),
+			strconv.FormatInt(v.DurationSeconds, 10),
+		}); err != nil {
+			log.Printf("Error writing CSV record: %v", err)
+			return
+		}
+	}
+}
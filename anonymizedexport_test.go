@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Anonymized Export Tests
+// ============================================================================
+
+// getAnonymizedExport requests /admin/export/anonymized with a query
+func getAnonymizedExport(t *testing.T, query string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/admin/export/anonymized"+query, nil)
+	rr := httptest.NewRecorder()
+	handleAnonymizedExport(rr, req)
+	return rr
+}
+
+// anonymizedJSONL parses a JSONL anonymized export
+func anonymizedJSONL(t *testing.T, query string) []AnonymizedVisit {
+	t.Helper()
+	rr := getAnonymizedExport(t, query)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var visits []AnonymizedVisit
+	scanner := bufio.NewScanner(rr.Body)
+	for scanner.Scan() {
+		var v AnonymizedVisit
+		if err := json.Unmarshal(scanner.Bytes(), &v); err != nil {
+			t.Fatalf("invalid line %q: %v", scanner.Text(), err)
+		}
+		visits = append(visits, v)
+	}
+	return visits
+}
+
+func TestAnonymizedExport(t *testing.T) {
+	setupTest()
+	base := time.Date(2025, 10, 1, 9, 0, 30, 0, time.UTC)
+	saveVisitToDB(1, base, base.Add(time.Hour))
+	saveVisitToDB(2, base.Add(10*time.Minute), base.Add(2*time.Hour))
+	saveVisitToDB(1, base.Add(24*time.Hour), base.Add(25*time.Hour))
+	scanCard("TEST_UID_2") // Open sessions are left out
+
+	rr := getAnonymizedExport(t, "")
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "text/csv" {
+		t.Fatalf("expected a CSV export, got %v %s", rr.Code, rr.Header().Get("Content-Type"))
+	}
+	body := rr.Body.String()
+	for _, identity := range []string{"Alice", "Bob", "TEST_UID", "111111111"} {
+		if strings.Contains(body, identity) {
+			t.Errorf("expected no %q in the export, got:\n%s", identity, body)
+		}
+	}
+	records, err := csv.NewReader(strings.NewReader(body)).ReadAll()
+	if err != nil || len(records) != 4 {
+		t.Fatalf("expected a header and 3 visits, got %v (err %v)", records, err)
+	}
+	if strings.Join(records[0], ",") != "participant,role,signin_time,signout_time,duration_seconds" {
+		t.Errorf("unexpected header %v", records[0])
+	}
+	if records[1][2] != "2025-10-01T09:00:00Z" || records[1][4] != "3600" {
+		t.Errorf("expected times truncated to the minute, got %v", records[1])
+	}
+
+	// Alice's visits share a pseudonym, Bob's differs
+	if records[1][0] != records[3][0] || records[1][0] == records[2][0] || !strings.HasPrefix(records[1][0], "p_") {
+		t.Errorf("expected stable pseudonyms per member, got %v", records[1:])
+	}
+
+	// Pseudonyms are the same in later exports, and differ between datasets
+	visits := anonymizedJSONL(t, "?format=jsonl")
+	if len(visits) != 3 || visits[0].Participant != records[1][0] {
+		t.Errorf("expected the same pseudonyms again, got %+v", visits)
+	}
+	other := anonymizedJSONL(t, "?format=jsonl&dataset=space-study")
+	if len(other) != 3 || other[0].Participant == visits[0].Participant {
+		t.Errorf("expected other pseudonyms for another dataset, got %+v", other)
+	}
+
+	// The period limits the visits
+	if visits := anonymizedJSONL(t, "?format=jsonl&from=2025-10-02T00:00:00Z"); len(visits) != 1 {
+		t.Errorf("expected 1 visit from October 2, got %+v", visits)
+	}
+
+	entries, _ := loadAuditEntries("database.exported_anonymized", 0)
+	if len(entries) != 4 {
+		t.Errorf("expected 4 audit entries, got %d", len(entries))
+	}
+}
+
+func TestAnonymizedExport_Key(t *testing.T) {
+	setupTest()
+	t.Setenv("ANONYMIZATION_KEY", "")
+	generated, err := anonymizationKey()
+	if err != nil || len(generated) != 32 {
+		t.Fatalf("expected a generated key, got %x (err %v)", generated, err)
+	}
+	if again, _ := anonymizationKey(); string(again) != string(generated) {
+		t.Error("expected the generated key to be kept")
+	}
+
+	t.Setenv("ANONYMIZATION_KEY", "shared-secret")
+	if key, _ := anonymizationKey(); string(key) != "shared-secret" {
+		t.Errorf("expected ANONYMIZATION_KEY used, got %q", key)
+	}
+	if pseudonym([]byte("k"), "", 1) == pseudonym([]byte("k"), "", 2) || pseudonym([]byte("k"), "a", 1) == pseudonym([]byte("k"), "b", 1) {
+		t.Error("expected pseudonyms to differ per member and dataset")
+	}
+
+	if rr := getAnonymizedExport(t, "?format=xml"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown format, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- API Key Usage ---
+//
+// Every request authenticated with an API key is counted per key and
+// endpoint (method and route pattern, e.g. "GET /members/"), with the time of
+// the last one, so keys nobody uses any more can be found and removed. Keys
+// are identified by an ID derived from their SHA-256 hash, which is safe to
+// show. Counts are kept in memory and added to the api_key_usage table every
+// minute, so a crash loses at most the last minute; the usage endpoints save
+// them first.
+//   - GET /admin/api-keys lists the configured keys with their totals
+//   - GET /admin/api-keys/{id}/usage breaks a key's requests down by endpoint
+//
+// Usage of keys removed from the configuration is kept, and still shown by
+// /admin/api-keys/{id}/usage.
+
+// apiKeyUsageFlushInterval is how often counted requests are saved
+const apiKeyUsageFlushInterval = time.Minute
+
+// ConfiguredAPIKey is a key from the environment and its usage
+type ConfiguredAPIKey struct {
+	ID         string     `json:"id"`
+	Source     string     `json:"source"` // SCANNER_API_KEY, DISCORD_BOT_API_KEY or API_KEYS[n]
+	Scope      string     `json:"scope"`
+	Org        string     `json:"org"`
+	Requests   int64      `json:"requests"`
+	LastUsedAt *time.Time `json:"last_used_at"` // null if never used
+}
+
+// EndpointUsage is the usage of a key on one endpoint
+type EndpointUsage struct {
+	Endpoint   string    `json:"endpoint"`
+	Requests   int64     `json:"requests"`
+	LastUsedAt time.Time `json:"last_used_at"`
+}
+
+// APIKeyUsage is the response of /admin/api-keys/{id}/usage
+type APIKeyUsage struct {
+	ID         string          `json:"id"`
+	Configured bool            `json:"configured"` // Still in the environment
+	Requests   int64           `json:"requests"`
+	LastUsedAt *time.Time      `json:"last_used_at"`
+	Endpoints  []EndpointUsage `json:"endpoints"` // Most used first
+}
+
+// apiKeyID returns the public ID of a key
+func apiKeyID(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:6])
+}
+
+// configuredAPIKeys returns the keys of the environment in the order they are listed
+func configuredAPIKeys() []ConfiguredAPIKey {
+	var keys []ConfiguredAPIKey
+	seen := make(map[string]bool)
+	add := func(key, source string) {
+		if key == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		k := ConfiguredAPIKey{ID: apiKeyID(key), Source: source, Scope: scopeAdmin, Org: defaultOrg}
+		if scope, ok := apiKeyScopes[key]; ok {
+			k.Scope = scope
+		}
+		if org, ok := apiKeyOrgs[key]; ok {
+			k.Org = org
+		}
+		keys = append(keys, k)
+	}
+
+	add(os.Getenv("SCANNER_API_KEY"), "SCANNER_API_KEY")
+	add(os.Getenv("DISCORD_BOT_API_KEY"), "DISCORD_BOT_API_KEY")
+	for i, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		key, _, _ := parseAPIKeyEntry(entry)
+		add(key, fmt.Sprintf("API_KEYS[%d]", i+1))
+	}
+	return keys
+}
+
+// apiKeyUsageCount is the usage of a key on an endpoint not saved yet
+type apiKeyUsageCount struct {
+	requests int64
+	lastUsed time.Time
+}
+
+// apiKeyUsageCounter counts requests per key and endpoint until they are saved
+type apiKeyUsageCounter struct {
+	mu     sync.Mutex
+	counts map[[2]string]*apiKeyUsageCount // Key ID and endpoint
+}
+
+// apiKeyUsage holds the requests counted since the last save
+var apiKeyUsage = &apiKeyUsageCounter{counts: make(map[[2]string]*apiKeyUsageCount)}
+
+// record counts a request made with a key
+func (u *apiKeyUsageCounter) record(key string, r *http.Request, now time.Time) {
+	route := r.Pattern
+	if route == "" {
+		route = r.URL.Path
+	}
+	id := [2]string{apiKeyID(key), r.Method + " " + route}
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	c, ok := u.counts[id]
+	if !ok {
+		c = &apiKeyUsageCount{}
+		u.counts[id] = c
+	}
+	c.requests++
+	c.lastUsed = now
+}
+
+// flush adds the counted requests to the database. Counts that fail to save
+// are kept for the next flush.
+func (u *apiKeyUsageCounter) flush() error {
+	u.mu.Lock()
+	counts := u.counts
+	u.counts = make(map[[2]string]*apiKeyUsageCount)
+	u.mu.Unlock()
+	if len(counts) == 0 {
+		return nil
+	}
+
+	err := saveAPIKeyUsage(counts)
+	if err != nil {
+		u.mu.Lock()
+		for id, c := range counts {
+			if newer, ok := u.counts[id]; ok {
+				c.requests += newer.requests
+				c.lastUsed = newer.lastUsed
+			}
+			u.counts[id] = c
+		}
+		u.mu.Unlock()
+	}
+	return err
+}
+
+// saveAPIKeyUsage adds counts to api_key_usage in one transaction
+func saveAPIKeyUsage(counts map[[2]string]*apiKeyUsageCount) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for id, c := range counts {
+		_, err := tx.Exec(`INSERT INTO api_key_usage (key_id, endpoint, requests, last_used_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (key_id, endpoint) DO UPDATE SET requests = requests + excluded.requests,
+				last_used_at = MAX(last_used_at, excluded.last_used_at)`,
+			id[0], id[1], c.requests, c.lastUsed.UTC().Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// startAPIKeyUsageFlusher periodically saves the counted requests
+func startAPIKeyUsageFlusher() {
+	ticker := time.NewTicker(apiKeyUsageFlushInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		flushAPIKeyUsage()
+	}
+}
+
+// loadEndpointUsage returns the saved usage of a key, most used endpoint first
+func loadEndpointUsage(keyID string) ([]EndpointUsage, error) {
+	rows, err := db.Query(`SELECT endpoint, requests, last_used_at FROM api_key_usage
+		WHERE key_id = ? ORDER BY requests DESC, endpoint`, keyID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	endpoints := []EndpointUsage{}
+	for rows.Next() {
+		var e EndpointUsage
+		var lastUsed string
+		if err := rows.Scan(&e.Endpoint, &e.Requests, &lastUsed); err != nil {
+			return nil, err
+		}
+		if e.LastUsedAt, err = time.Parse(time.RFC3339, lastUsed); err != nil {
+			return nil, err
+		}
+		endpoints = append(endpoints, e)
+	}
+	return endpoints, rows.Err()
+}
+
+// totalUsage sums the usage of a key's endpoints
+func totalUsage(endpoints []EndpointUsage) (int64, *time.Time) {
+	var requests int64
+	var lastUsed *time.Time
+	for i, e := range endpoints {
+		requests += e.Requests
+		if lastUsed == nil || e.LastUsedAt.After(*lastUsed) {
+			lastUsed = &endpoints[i].LastUsedAt
+		}
+	}
+	return requests, lastUsed
+}
+
+// flushAPIKeyUsage saves the counted requests, logging failures
+func flushAPIKeyUsage() {
+	if err := apiKeyUsage.flush(); err != nil {
+		log.Printf("Error saving API key usage: %v", err)
+	}
+}
+
+// handleAPIKeys lists the configured API keys with their usage
+func handleAPIKeys(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	flushAPIKeyUsage()
+	keys := configuredAPIKeys()
+	for i := range keys {
+		endpoints, err := loadEndpointUsage(keys[i].ID)
+		if err != nil {
+			log.Printf("Error querying API key usage: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		keys[i].Requests, keys[i].LastUsedAt = totalUsage(endpoints)
+	}
+	if keys == nil {
+		keys = []ConfiguredAPIKey{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// handleAPIKeyUsage returns the usage of one key by endpoint at /admin/api-keys/{id}/usage
+func handleAPIKeyUsage(w http.ResponseWriter, r *http.Request) {
+	id, sub, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/admin/api-keys/"), "/")
+	if id == "" || sub != "usage" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	flushAPIKeyUsage()
+	endpoints, err := loadEndpointUsage(id)
+	if err != nil {
+		log.Printf("Error querying API key usage: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	usage := APIKeyUsage{ID: id, Endpoints: endpoints}
+	for _, k := range configuredAPIKeys() {
+		if k.ID == id {
+			usage.Configured = true
+		}
+	}
+	if !usage.Configured && len(endpoints) == 0 {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	}
+	usage.Requests, usage.LastUsedAt = totalUsage(endpoints)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(usage)
+}
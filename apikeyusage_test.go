@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// API Key Usage Tests
+// ============================================================================
+
+// keyRequest sends a request through the API key middleware with a key
+func keyRequest(pattern, method, path, key string) int {
+	mux := http.NewServeMux()
+	mux.HandleFunc(pattern, apiKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("X-API-Key", key)
+	req.RemoteAddr = "198.51.100.7:1234"
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr.Code
+}
+
+// apiKeyUsageOf fetches /admin/api-keys/{id}/usage
+func apiKeyUsageOf(t *testing.T, id string) (int, APIKeyUsage) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/admin/api-keys/"+id+"/usage", nil)
+	rr := httptest.NewRecorder()
+	handleAPIKeyUsage(rr, req)
+
+	var usage APIKeyUsage
+	if rr.Code == http.StatusOK {
+		if err := json.NewDecoder(rr.Body).Decode(&usage); err != nil {
+			t.Fatalf("failed to decode usage: %v", err)
+		}
+	}
+	return rr.Code, usage
+}
+
+func TestAPIKeyUsage_Recorded(t *testing.T) {
+	setupTest()
+	t.Setenv("API_KEYS", "admin-key,bot-key")
+	validAPIKeys = map[string]bool{"admin-key": true, "bot-key": true}
+
+	for i := 0; i < 3; i++ {
+		keyRequest("/members/", "GET", "/members/1", "admin-key")
+	}
+	keyRequest("/count", "GET", "/count", "admin-key")
+	keyRequest("/count", "GET", "/count", "nope")
+
+	code, usage := apiKeyUsageOf(t, apiKeyID("admin-key"))
+	if code != http.StatusOK {
+		t.Fatalf("expected 200, got %v", code)
+	}
+	if !usage.Configured || usage.Requests != 4 || len(usage.Endpoints) != 2 {
+		t.Fatalf("expected 4 requests on 2 endpoints, got %+v", usage)
+	}
+	if e := usage.Endpoints[0]; e.Endpoint != "GET /members/" || e.Requests != 3 {
+		t.Errorf("expected the route pattern most used first, got %+v", e)
+	}
+	if usage.LastUsedAt == nil || time.Since(*usage.LastUsedAt) > time.Minute {
+		t.Errorf("expected the last use recorded, got %v", usage.LastUsedAt)
+	}
+
+	// Counts are added to the saved ones
+	keyRequest("/count", "GET", "/count", "admin-key")
+	if _, usage := apiKeyUsageOf(t, apiKeyID("admin-key")); usage.Requests != 5 {
+		t.Errorf("expected 5 requests, got %d", usage.Requests)
+	}
+
+	// A configured key never used has no endpoints
+	if code, usage := apiKeyUsageOf(t, apiKeyID("bot-key")); code != http.StatusOK || usage.Requests != 0 || usage.LastUsedAt != nil {
+		t.Errorf("expected an unused key, got %v %+v", code, usage)
+	}
+}
+
+func TestAPIKeyUsage_RemovedKey(t *testing.T) {
+	setupTest()
+	validAPIKeys = map[string]bool{"old-key": true}
+	keyRequest("/count", "GET", "/count", "old-key")
+
+	// Usage outlives the key, unknown keys are not found
+	if code, usage := apiKeyUsageOf(t, apiKeyID("old-key")); code != http.StatusOK || usage.Configured || usage.Requests != 1 {
+		t.Errorf("expected the removed key's usage, got %v %+v", code, usage)
+	}
+	if code, _ := apiKeyUsageOf(t, apiKeyID("never-key")); code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown key, got %v", code)
+	}
+}
+
+func TestHandleAPIKeys(t *testing.T) {
+	setupTest()
+	t.Setenv("SCANNER_API_KEY", "scanner-key")
+	t.Setenv("API_KEYS", "admin-key,stats-key:public")
+	validAPIKeys = map[string]bool{"scanner-key": true, "admin-key": true, "stats-key": true}
+	apiKeyScopes = map[string]string{"stats-key": scopePublic}
+	keyRequest("/count", "GET", "/count", "stats-key")
+
+	req, _ := http.NewRequest("GET", "/admin/api-keys", nil)
+	rr := httptest.NewRecorder()
+	handleAPIKeys(rr, req)
+
+	var keys []ConfiguredAPIKey
+	json.NewDecoder(rr.Body).Decode(&keys)
+	if len(keys) != 3 {
+		t.Fatalf("expected 3 keys, got %+v", keys)
+	}
+	if keys[0].Source != "SCANNER_API_KEY" || keys[0].Scope != scopeAdmin || keys[0].Requests != 0 {
+		t.Errorf("expected the scanner key first, got %+v", keys[0])
+	}
+	if k := keys[2]; k.Source != "API_KEYS[2]" || k.Scope != scopePublic || k.Requests != 1 || k.ID != apiKeyID("stats-key") {
+		t.Errorf("expected the stats key with its request, got %+v", k)
+	}
+}
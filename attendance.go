@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// --- Historical Attendance ---
+//
+// Presence is reconstructed from session intervals: every completed visit in
+// the visits table plus the open sessions of people currently signed in.
+
+// presenceInterval is one stretch of time a member spent in the office
+type presenceInterval struct {
+	MemberID int64
+	Name     string
+	Role     string
+	OrgID    string
+	Start    time.Time
+	End      time.Time
+	Open     bool // Still signed in; End is the time the interval was loaded
+}
+
+// AttendeeAt is a person who was inside at the queried instant
+type AttendeeAt struct {
+	MemberID    int64      `json:"member_id"`
+	Name        string     `json:"name"`
+	SignInTime  time.Time  `json:"signin_time"`
+	SignOutTime *time.Time `json:"signout_time,omitempty"` // Omitted if still signed in
+}
+
+// AttendanceAtResponse is the /attendance/at response
+type AttendanceAtResponse struct {
+	Time      time.Time    `json:"time"`
+	Count     int          `json:"count"`
+	Attendees []AttendeeAt `json:"attendees"`
+}
+
+// presenceBoundSlack widens the SQL bounds of loadPresenceIntervals to cover
+// any UTC offset, since stored times compare as text in their own offset
+const presenceBoundSlack = 24 * time.Hour
+
+// loadPresenceIntervals returns every session overlapping [from, to], with its
+// corrected or recorded times (see sessionsWithTimes), including open sessions
+// which end at now. Zero from/to leave that side unbounded. Stored offsets may
+// differ, so SQL only narrows the sessions down with bounds widened by
+// presenceBoundSlack (using idx_visits_signout) and times are compared after
+// parsing. Amended sessions are matched on their recorded or amended times.
+func loadPresenceIntervals(from, to, now time.Time, times string) ([]presenceInterval, error) {
+	lower, upper := "", "9999"
+	if !from.IsZero() {
+		lower = from.Add(-presenceBoundSlack).UTC().Format(time.RFC3339)
+	}
+	if !to.IsZero() {
+		upper = to.Add(presenceBoundSlack).UTC().Format(time.RFC3339)
+	}
+	query := `
+		SELECT v.member_id, m.name, m.role, m.org_id, v.signin_time, v.signout_time
+		FROM ` + sessionsWithTimes(times) + ` v
+		JOIN members m ON m.id = v.member_id
+		WHERE v.id IN (SELECT id FROM visits WHERE signout_time >= ? AND signin_time <= ?)`
+	args := []interface{}{lower, upper}
+	if times != sessionTimesRaw {
+		query += ` OR v.id IN (SELECT visit_id FROM visit_amendments WHERE signout_time >= ? AND signin_time <= ?)`
+		args = append(args, lower, upper)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	overlaps := func(start, end time.Time) bool {
+		return (to.IsZero() || !start.After(to)) && (from.IsZero() || !end.Before(from))
+	}
+
+	var intervals []presenceInterval
+	for rows.Next() {
+		var p presenceInterval
+		var signinTime, signoutTime string
+		if err := rows.Scan(&p.MemberID, &p.Name, &p.Role, &p.OrgID, &signinTime, &signoutTime); err != nil {
+			return nil, err
+		}
+		if p.Start, err = time.Parse(time.RFC3339, signinTime); err != nil {
+			return nil, err
+		}
+		if p.End, err = time.Parse(time.RFC3339, signoutTime); err != nil {
+			return nil, err
+		}
+		if overlaps(p.Start, p.End) {
+			intervals = append(intervals, p)
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, a := range currentAttendees.list() {
+		member, ok := memberCache.get(a.UID)
+		if !ok || !overlaps(a.SignInTime, now) {
+			continue
+		}
+		role := member.Role
+		if role == "" {
+			role = roleMember
+		}
+		intervals = append(intervals, presenceInterval{
+			MemberID: member.ID,
+			Name:     member.Name,
+			Role:     role,
+			OrgID:    memberOrg(member),
+			Start:    a.SignInTime,
+			End:      now,
+			Open:     true,
+		})
+	}
+
+	return intervals, nil
+}
+
+// handleAttendanceAt returns who was inside at a given instant
+// Query parameters:
+//   - time: RFC3339 formatted instant (required, not in the future)
+//   - times: corrected (default) or raw
+func handleAttendanceAt(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	timeStr := r.URL.Query().Get("time")
+	if timeStr == "" {
+		http.Error(w, "'time' parameter is required", http.StatusBadRequest)
+		return
+	}
+	at, err := time.Parse(time.RFC3339, timeStr)
+	if err != nil {
+		http.Error(w, "Invalid 'time' format, expected RFC3339", http.StatusBadRequest)
+		return
+	}
+
+	now := time.Now()
+	if at.After(now) {
+		http.Error(w, "'time' must not be in the future", http.StatusBadRequest)
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	intervals, err := loadPresenceIntervals(at, at, now, times)
+	if err != nil {
+		log.Printf("Error loading attendance intervals: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	intervals = filterOrg(intervals, requestOrg(r))
+
+	resp := AttendanceAtResponse{Time: at, Attendees: []AttendeeAt{}}
+	for _, p := range intervals {
+		// A visit ending exactly at the instant no longer counts as inside
+		if p.End.Equal(at) && !p.Open {
+			continue
+		}
+		a := AttendeeAt{MemberID: p.MemberID, Name: p.Name, SignInTime: p.Start}
+		if !p.Open {
+			end := p.End
+			a.SignOutTime = &end
+		}
+		resp.Attendees = append(resp.Attendees, a)
+	}
+	resp.Count = len(resp.Attendees)
+
+	// Sort by sign-in time (oldest first)
+	sort.Slice(resp.Attendees, func(i, j int) bool {
+		return resp.Attendees[i].SignInTime.Before(resp.Attendees[j].SignInTime)
+	})
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /attendance/at Endpoint Tests
+// ============================================================================
+
+func attendanceAt(t *testing.T, at time.Time, query ...string) AttendanceAtResponse {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", "/attendance/at?time="+url.QueryEscape(at.Format(time.RFC3339))+strings.Join(query, ""), nil)
+	rr := httptest.NewRecorder()
+
+	handleAttendanceAt(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp AttendanceAtResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return resp
+}
+
+func TestHandleAttendanceAt_FromVisits(t *testing.T) {
+	setupTest()
+
+	base := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	saveVisitToDB(1, base, base.Add(2*time.Hour))
+	saveVisitToDB(2, base.Add(time.Hour), base.Add(3*time.Hour))
+
+	resp := attendanceAt(t, base.Add(90*time.Minute))
+	if resp.Count != 2 {
+		t.Fatalf("expected 2 attendees, got %d", resp.Count)
+	}
+	if resp.Attendees[0].Name != "Alice" || resp.Attendees[1].Name != "Bob" {
+		t.Errorf("expected Alice then Bob, got %+v", resp.Attendees)
+	}
+	if resp.Attendees[0].SignOutTime == nil {
+		t.Error("expected signout_time for a completed visit")
+	}
+
+	resp = attendanceAt(t, base.Add(150*time.Minute))
+	if resp.Count != 1 || resp.Attendees[0].Name != "Bob" {
+		t.Errorf("expected only Bob, got %+v", resp.Attendees)
+	}
+
+	// A visit ending exactly at the instant is no longer inside
+	resp = attendanceAt(t, base.Add(3*time.Hour))
+	if resp.Count != 0 {
+		t.Errorf("expected nobody, got %+v", resp.Attendees)
+	}
+}
+
+func TestHandleAttendanceAt_AmendedSessions(t *testing.T) {
+	setupTest()
+
+	// Forgot to sign out; the session was corrected to end after 2 hours
+	base := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	visitID, err := saveVisit(1, base, base.Add(9*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"signout_time": %q, "reason": "forgot to sign out"}`, base.Add(2*time.Hour).Format(time.RFC3339))
+	if rr := amendRequest("POST", visitID, body); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	if resp := attendanceAt(t, base.Add(4*time.Hour)); resp.Count != 0 {
+		t.Errorf("expected nobody after the corrected sign-out, got %+v", resp.Attendees)
+	}
+	if resp := attendanceAt(t, base.Add(4*time.Hour), "&times=raw"); resp.Count != 1 {
+		t.Errorf("expected Alice with the recorded times, got %+v", resp.Attendees)
+	}
+
+	_, total, err := memberPresence(1, base, base.Add(24*time.Hour), time.Now(), sessionTimesCorrected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2*time.Hour {
+		t.Errorf("expected 2 corrected hours, got %s", total)
+	}
+}
+
+func TestLoadPresenceIntervals_Bounds(t *testing.T) {
+	setupTest()
+
+	// One session well before the period, one recorded before it but amended
+	// into it, and one at its end recorded with an offset far ahead of UTC
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	if _, err := saveVisit(1, base.Add(-10*24*time.Hour), base.Add(-10*24*time.Hour+time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	visitID, err := saveVisit(2, base.Add(-5*24*time.Hour), base.Add(-5*24*time.Hour+time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := fmt.Sprintf(`{"signin_time": %q, "signout_time": %q, "reason": "wrong day"}`,
+		base.Add(time.Hour).Format(time.RFC3339), base.Add(2*time.Hour).Format(time.RFC3339))
+	if rr := amendRequest("POST", visitID, body); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	east := time.FixedZone("UTC+14", 14*60*60)
+	if _, err := saveVisit(1, base.Add(22*time.Hour).In(east), base.Add(23*time.Hour).In(east)); err != nil {
+		t.Fatal(err)
+	}
+
+	from, to := base, base.Add(24*time.Hour)
+	intervals, err := loadPresenceIntervals(from, to, time.Now(), sessionTimesCorrected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 2 {
+		t.Fatalf("expected the amended and the other-offset sessions, got %+v", intervals)
+	}
+
+	intervals, err = loadPresenceIntervals(from, to, time.Now(), sessionTimesRaw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 1 || intervals[0].MemberID != 1 {
+		t.Errorf("expected only the other-offset session as recorded, got %+v", intervals)
+	}
+}
+
+func TestHandleAttendanceAt_IncludesOpenSessions(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-time.Hour))
+
+	resp := attendanceAt(t, time.Now().Add(-30*time.Minute))
+	if resp.Count != 1 || resp.Attendees[0].Name != "Alice" {
+		t.Fatalf("expected Alice, got %+v", resp.Attendees)
+	}
+	if resp.Attendees[0].SignOutTime != nil {
+		t.Error("expected no signout_time for an open session")
+	}
+
+	resp = attendanceAt(t, time.Now().Add(-2*time.Hour))
+	if resp.Count != 0 {
+		t.Errorf("expected nobody before sign-in, got %+v", resp.Attendees)
+	}
+}
+
+func TestHandleAttendanceAt_InvalidTime(t *testing.T) {
+	setupTest()
+
+	future := url.QueryEscape(time.Now().Add(time.Hour).Format(time.RFC3339))
+	for _, query := range []string{"", "?time=yesterday", "?time=" + future} {
+		req, _ := http.NewRequest("GET", "/attendance/at"+query, nil)
+		rr := httptest.NewRecorder()
+
+		handleAttendanceAt(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400 Bad Request, got %v", query, rr.Code)
+		}
+	}
+}
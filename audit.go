@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Audit Log ---
+
+// AuditEntry is a single security- or admin-relevant event
+type AuditEntry struct {
+	ID     int64     `json:"id"`
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	Actor  string    `json:"actor"`
+	Detail string    `json:"detail"`
+}
+
+// recordAudit appends an entry to the audit log. Failures are logged but never
+// bubble up, so auditing cannot break the request being audited.
+func recordAudit(action, actor, detail string) {
+	_, err := db.Exec(`INSERT INTO audit_log (created_at, action, actor, detail) VALUES (?, ?, ?, ?)`,
+		time.Now().Format(time.RFC3339), action, actor, detail)
+	if err != nil {
+		log.Printf("Error writing audit entry %q: %v", action, err)
+	}
+}
+
+// loadAuditEntries returns audit entries newest first, optionally filtered by action prefix
+func loadAuditEntries(action string, limit int) ([]AuditEntry, error) {
+	query := `SELECT id, created_at, action, actor, detail FROM audit_log`
+	var args []interface{}
+	if action != "" {
+		query += ` WHERE action LIKE ?`
+		args = append(args, strings.ReplaceAll(action, "%", "")+"%")
+	}
+	query += ` ORDER BY id DESC`
+	if limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var createdAt string
+		if err := rows.Scan(&e.ID, &createdAt, &e.Action, &e.Actor, &e.Detail); err != nil {
+			return nil, err
+		}
+		e.Time, err = time.Parse(time.RFC3339, createdAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// handleAuditLog returns recent audit entries
+// Query parameters:
+//   - action: only return entries whose action starts with this value (e.g., network)
+//   - limit: maximum number of records to return (default 100)
+func handleAuditLog(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	limit := 100
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if n, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || n != 1 || limit < 0 {
+			http.Error(w, "Invalid 'limit' parameter, expected positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	entries, err := loadAuditEntries(r.URL.Query().Get("action"), limit)
+	if err != nil {
+		log.Printf("Error loading audit log: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
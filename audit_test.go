@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// Audit Log Tests
+// ============================================================================
+
+func TestRecordAudit_NewestFirst(t *testing.T) {
+	setupTest()
+
+	recordAudit("network.rejected", "10.0.0.1", "first")
+	recordAudit("member.deleted", "admin", "second")
+
+	entries, err := loadAuditEntries("", 0)
+	if err != nil {
+		t.Fatalf("failed to load audit log: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected 2 entries, got %d", len(entries))
+	}
+	if entries[0].Detail != "second" {
+		t.Errorf("expected newest entry first, got %+v", entries[0])
+	}
+}
+
+func TestHandleAuditLog_FilterByAction(t *testing.T) {
+	setupTest()
+
+	recordAudit("network.rejected", "10.0.0.1", "GET /scan")
+	recordAudit("member.deleted", "admin", "id=1")
+
+	req, _ := http.NewRequest("GET", "/admin/audit-log?action=network", nil)
+	rr := httptest.NewRecorder()
+
+	handleAuditLog(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	var entries []AuditEntry
+	if err := json.Unmarshal(rr.Body.Bytes(), &entries); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Action != "network.rejected" {
+		t.Errorf("expected only the network entry, got %+v", entries)
+	}
+}
+
+func TestHandleAuditLog_InvalidLimit(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/admin/audit-log?limit=abc", nil)
+	rr := httptest.NewRecorder()
+
+	handleAuditLog(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestHandleAuditLog_MethodNotAllowed(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/admin/audit-log", nil)
+	rr := httptest.NewRecorder()
+
+	handleAuditLog(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 Method Not Allowed, got %v", rr.Code)
+	}
+}
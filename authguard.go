@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Brute-Force Protection ---
+//
+// Failed API key attempts are tracked per client IP. Once a client reaches
+// authMaxFailures consecutive failures it is locked out, and every further
+// failure doubles the lockout (starting at authLockoutBase, capped at
+// authLockoutMax). The lockout only applies to failing attempts: a valid key
+// is accepted from a locked-out address, since a scanner may share it with
+// others behind NAT. A successful authentication clears the record until the
+// client is first locked out. Records expire once idle for authFailureWindow,
+// counted from the end of the lockout; they are pruned as failures come in,
+// at most once per window, so a spray from many addresses can't grow the map
+// without bound.
+
+const (
+	authMaxFailures   = 5
+	authLockoutBase   = 30 * time.Second
+	authLockoutMax    = time.Hour
+	authFailureWindow = 15 * time.Minute
+)
+
+// authFailure tracks failed authentication attempts from a single client
+type authFailure struct {
+	Count       int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// idleSince returns when the client last failed or its lockout ended,
+// whichever is later
+func (f *authFailure) idleSince() time.Time {
+	if f.LockedUntil.After(f.LastFailure) {
+		return f.LockedUntil
+	}
+	return f.LastFailure
+}
+
+var (
+	authFailuresMu sync.Mutex
+	authFailures   = make(map[string]*authFailure)
+	authPrunedAt   time.Time // Last pruneAuthFailures from recordAuthFailure
+)
+
+// pruneAuthFailures drops the records idle for longer than authFailureWindow.
+// The caller holds authFailuresMu.
+func pruneAuthFailures(now time.Time) {
+	for ip, f := range authFailures {
+		if now.Sub(f.idleSince()) > authFailureWindow {
+			delete(authFailures, ip)
+		}
+	}
+}
+
+// authLockedUntil returns when the client's lockout ends, or zero if not locked
+func authLockedUntil(ip string, now time.Time) time.Time {
+	authFailuresMu.Lock()
+	defer authFailuresMu.Unlock()
+
+	f, ok := authFailures[ip]
+	if !ok || !now.Before(f.LockedUntil) {
+		return time.Time{}
+	}
+	return f.LockedUntil
+}
+
+// recordAuthFailure registers a failed attempt and returns the resulting lockout, if any
+func recordAuthFailure(ip string, now time.Time) time.Time {
+	authFailuresMu.Lock()
+	if now.Sub(authPrunedAt) > authFailureWindow {
+		pruneAuthFailures(now)
+		authPrunedAt = now
+	}
+	f, ok := authFailures[ip]
+	if !ok || now.Sub(f.idleSince()) > authFailureWindow {
+		f = &authFailure{}
+		authFailures[ip] = f
+	}
+	f.Count++
+	f.LastFailure = now
+
+	var lockedUntil time.Time
+	if f.Count >= authMaxFailures {
+		backoff := authLockoutBase << (f.Count - authMaxFailures)
+		if backoff > authLockoutMax || backoff <= 0 {
+			backoff = authLockoutMax
+		}
+		f.LockedUntil = now.Add(backoff)
+		lockedUntil = f.LockedUntil
+	}
+	count := f.Count
+	authFailuresMu.Unlock()
+
+	incCounter("auth_failures_total")
+	if count == authMaxFailures {
+		// Alert only when the threshold is first crossed to avoid flooding
+		incCounter("auth_lockouts_total")
+		msg := fmt.Sprintf("Client %s locked out after %d failed API key attempts", ip, count)
+		log.Printf("Auth guard: %s", msg)
+		recordAudit("auth.lockout", ip, msg)
+		sendAlert(msg)
+	}
+	return lockedUntil
+}
+
+// clearAuthFailures forgets failures for a client after a successful
+// authentication, unless they locked it out: another client behind the same
+// address must not reset the escalation
+func clearAuthFailures(ip string) {
+	authFailuresMu.Lock()
+	if f, ok := authFailures[ip]; ok && f.Count < authMaxFailures {
+		delete(authFailures, ip)
+	}
+	authFailuresMu.Unlock()
+}
+
+// writeAuthFailure answers a failed authentication: 429 while the client is
+// locked out, otherwise 401 with message once the failure is counted, or 429
+// if it locks the client out
+func writeAuthFailure(w http.ResponseWriter, ip, message string) {
+	now := time.Now()
+	lockedUntil := authLockedUntil(ip, now)
+	if lockedUntil.IsZero() {
+		lockedUntil = recordAuthFailure(ip, now)
+	}
+	if !lockedUntil.IsZero() {
+		writeLockedOut(w, lockedUntil)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": message,
+	})
+}
+
+// resetAuthFailures clears all tracked failures
+func resetAuthFailures() {
+	authFailuresMu.Lock()
+	authFailures = make(map[string]*authFailure)
+	authPrunedAt = time.Time{}
+	authFailuresMu.Unlock()
+}
+
+// lockedClientCount returns the number of clients currently locked out
+func lockedClientCount() int {
+	now := time.Now()
+	authFailuresMu.Lock()
+	defer authFailuresMu.Unlock()
+
+	pruneAuthFailures(now)
+	count := 0
+	for _, f := range authFailures {
+		if now.Before(f.LockedUntil) {
+			count++
+		}
+	}
+	return count
+}
+
+// writeLockedOut responds with 429 and a Retry-After header
+func writeLockedOut(w http.ResponseWriter, lockedUntil time.Time) {
+	retryAfter := int(time.Until(lockedUntil).Seconds()) + 1
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error": "too many failed authentication attempts, try again later",
+	})
+}
+
+// sendAlert posts a message to ALERT_WEBHOOK_URL (Discord or Slack compatible)
+// if configured, outside the quiet hours of the alerts integration
+func sendAlert(message string) {
+	notify(integrationAlerts, message)
+}
+
+// postWebhook posts a Discord/Slack compatible message to url, if set, on the
+// background worker pool (retried if the webhook is unreachable)
+func postWebhook(url, message string) {
+	if url == "" {
+		return
+	}
+	submitWebhook(url, message, nil)
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Brute-Force Protection Tests
+// ============================================================================
+
+func TestRecordAuthFailure_LocksAfterThreshold(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	for i := 1; i < authMaxFailures; i++ {
+		if lockedUntil := recordAuthFailure("10.0.0.5", now); !lockedUntil.IsZero() {
+			t.Fatalf("did not expect lockout after %d failures", i)
+		}
+	}
+
+	lockedUntil := recordAuthFailure("10.0.0.5", now)
+	if !lockedUntil.Equal(now.Add(authLockoutBase)) {
+		t.Errorf("expected lockout of %v, got until %v", authLockoutBase, lockedUntil)
+	}
+
+	entries, _ := loadAuditEntries("auth.lockout", 0)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 lockout audit entry, got %d", len(entries))
+	}
+}
+
+func TestRecordAuthFailure_ExponentialBackoff(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	for i := 0; i < authMaxFailures; i++ {
+		recordAuthFailure("10.0.0.5", now)
+	}
+
+	lockedUntil := recordAuthFailure("10.0.0.5", now)
+	if !lockedUntil.Equal(now.Add(2 * authLockoutBase)) {
+		t.Errorf("expected doubled lockout, got until %v", lockedUntil)
+	}
+
+	for i := 0; i < 20; i++ {
+		lockedUntil = recordAuthFailure("10.0.0.5", now)
+	}
+	if !lockedUntil.Equal(now.Add(authLockoutMax)) {
+		t.Errorf("expected lockout capped at %v, got until %v", authLockoutMax, lockedUntil)
+	}
+}
+
+func TestRecordAuthFailure_WindowExpires(t *testing.T) {
+	setupTest()
+
+	start := time.Now()
+	for i := 1; i < authMaxFailures; i++ {
+		recordAuthFailure("10.0.0.5", start)
+	}
+
+	// A failure after the window starts a fresh count
+	later := start.Add(authFailureWindow + time.Minute)
+	if lockedUntil := recordAuthFailure("10.0.0.5", later); !lockedUntil.IsZero() {
+		t.Error("expected failure count to reset after the window")
+	}
+}
+
+func TestRecordAuthFailure_EscalatesAcrossLockouts(t *testing.T) {
+	setupTest()
+
+	// Each failure comes just after the previous lockout ends, long after
+	// the failure that caused it
+	now := time.Now()
+	var lockedUntil time.Time
+	for i := 0; i < authMaxFailures+8; i++ {
+		if !lockedUntil.IsZero() {
+			now = lockedUntil.Add(time.Second)
+		}
+		lockedUntil = recordAuthFailure("10.0.0.5", now)
+	}
+	if got := lockedUntil.Sub(now); got != authLockoutMax {
+		t.Errorf("expected the lockout to escalate to %v, got %v", authLockoutMax, got)
+	}
+}
+
+func TestRecordAuthFailure_PrunesIdleClients(t *testing.T) {
+	setupTest()
+
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		recordAuthFailure(fmt.Sprintf("198.51.100.%d", i), start)
+	}
+	for i := 0; i < authMaxFailures; i++ {
+		recordAuthFailure("10.0.0.5", start.Add(authFailureWindow))
+	}
+
+	// A failure once the window has passed drops the idle clients, not the locked one
+	recordAuthFailure("10.0.0.6", start.Add(authFailureWindow+time.Minute))
+	authFailuresMu.Lock()
+	n := len(authFailures)
+	_, locked := authFailures["10.0.0.5"]
+	authFailuresMu.Unlock()
+	if n != 2 || !locked {
+		t.Errorf("expected only the locked client and the new one kept, got %d records", n)
+	}
+}
+
+func TestAPIKeyMiddleware_LocksOutAfterFailures(t *testing.T) {
+	setupTest()
+
+	validAPIKeys = map[string]bool{"valid-key": true}
+
+	handler := apiKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	send := func(key string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", "/current", nil)
+		req.RemoteAddr = "198.51.100.7:1234"
+		req.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	for i := 1; i < authMaxFailures; i++ {
+		if rr := send("wrong"); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("attempt %d: expected 401, got %v", i, rr.Code)
+		}
+	}
+
+	rr := send("wrong")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected 429 once threshold is reached, got %v", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") == "" {
+		t.Error("expected Retry-After header")
+	}
+
+	// A valid key from the same address (a scanner behind the same NAT) still works...
+	if rr := send("valid-key"); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 for a valid key during lockout, got %v", rr.Code)
+	}
+	// ...without lifting the lockout
+	if rr := send("wrong"); rr.Code != http.StatusTooManyRequests {
+		t.Errorf("expected 429 for a wrong key during lockout, got %v", rr.Code)
+	}
+}
+
+func TestAPIKeyMiddleware_SuccessClearsFailures(t *testing.T) {
+	setupTest()
+
+	validAPIKeys = map[string]bool{"valid-key": true}
+
+	handler := apiKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	send := func(key string) int {
+		req, _ := http.NewRequest("GET", "/current", nil)
+		req.RemoteAddr = "198.51.100.7:1234"
+		req.Header.Set("X-API-Key", key)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	for i := 1; i < authMaxFailures; i++ {
+		send("wrong")
+	}
+	if code := send("valid-key"); code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", code)
+	}
+	if code := send("wrong"); code != http.StatusUnauthorized {
+		t.Errorf("expected failure count to be cleared, got %v", code)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Discord Avatars ---
+//
+// Members without an uploaded photo (see photos.go) fall back to their
+// Discord avatar, so nobody has to upload one for the dashboard to show a
+// face. With DISCORD_BOT_TOKEN set, the avatar of a member's Discord account
+// is looked up through the Discord API and returned as avatar_url in member
+// records, next to photo_url.
+//
+// Lookups are cached for a day. A member record is never held up by Discord:
+// an unknown or expired avatar is looked up in the background and the record
+// carries the previous URL, if any, until it is known. Failed lookups are
+// retried after an hour.
+
+const (
+	discordAvatarTTL        = 24 * time.Hour
+	discordAvatarRetryAfter = time.Hour
+	discordAvatarSize       = 256
+)
+
+var (
+	// discordAPIURL is the base URL of the Discord REST API
+	discordAPIURL = "https://discord.com/api/v10"
+
+	// discordCDNURL is the base URL avatars are served from
+	discordCDNURL = "https://cdn.discordapp.com"
+)
+
+// discordAvatar is a cached avatar lookup
+type discordAvatar struct {
+	url     string // "" if the lookup failed
+	expires time.Time
+}
+
+// discordAvatarStore caches the avatar URLs of Discord accounts
+type discordAvatarStore struct {
+	mu      sync.Mutex
+	byID    map[string]discordAvatar
+	pending map[string]bool // Lookups queued and not finished
+	client  *http.Client
+}
+
+// discordAvatars caches the avatars of members' Discord accounts
+var discordAvatars = newDiscordAvatarStore()
+
+// newDiscordAvatarStore returns an empty avatar cache
+func newDiscordAvatarStore() *discordAvatarStore {
+	return &discordAvatarStore{
+		byID:    make(map[string]discordAvatar),
+		pending: make(map[string]bool),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// reset empties the cache
+func (s *discordAvatarStore) reset() {
+	s.mu.Lock()
+	s.byID = make(map[string]discordAvatar)
+	s.pending = make(map[string]bool)
+	s.mu.Unlock()
+}
+
+// discordBotToken returns the token of the bot avatars are looked up with
+func discordBotToken() string {
+	return strings.TrimSpace(os.Getenv("DISCORD_BOT_TOKEN"))
+}
+
+// avatarURL returns the cached avatar of a Discord account, queuing a lookup
+// if it is unknown or expired
+func (s *discordAvatarStore) avatarURL(discordID string) string {
+	if discordBotToken() == "" {
+		return ""
+	}
+	// Discord IDs are snowflakes, anything else cannot have an avatar
+	if _, err := strconv.ParseUint(discordID, 10, 64); err != nil {
+		return ""
+	}
+
+	s.mu.Lock()
+	cached, ok := s.byID[discordID]
+	lookup := (!ok || !time.Now().Before(cached.expires)) && !s.pending[discordID]
+	if lookup {
+		s.pending[discordID] = true
+	}
+	s.mu.Unlock()
+
+	if lookup {
+		jobs.submit("discord-avatar", func() error {
+			s.refresh(discordID)
+			return nil
+		})
+	}
+	return cached.url
+}
+
+// refresh looks up the avatar of a Discord account and caches it
+func (s *discordAvatarStore) refresh(discordID string) {
+	url, err := s.fetch(discordID)
+	entry := discordAvatar{url: url, expires: time.Now().Add(discordAvatarTTL)}
+	if err != nil {
+		logIntegrations.warnf("Warning: looking up the Discord avatar of %s failed: %v", discordID, err)
+		entry.expires = time.Now().Add(discordAvatarRetryAfter)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, discordID)
+	if err != nil {
+		// Keep serving the previous avatar until Discord answers again
+		entry.url = s.byID[discordID].url
+	}
+	s.byID[discordID] = entry
+}
+
+// fetch asks the Discord API for the avatar of an account, "" if there is no such account
+func (s *discordAvatarStore) fetch(discordID string) (string, error) {
+	req, err := http.NewRequest(http.MethodGet, discordAPIURL+"/users/"+discordID, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Authorization", "Bot "+discordBotToken())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("Discord returned %s", resp.Status)
+	}
+
+	var user struct {
+		ID     string  `json:"id"`
+		Avatar *string `json:"avatar"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&user); err != nil {
+		return "", fmt.Errorf("invalid Discord user: %w", err)
+	}
+	return discordAvatarLink(discordID, user.Avatar), nil
+}
+
+// discordAvatarLink returns the CDN URL of an avatar, or of the default
+// avatar Discord shows for accounts without one
+func discordAvatarLink(discordID string, hash *string) string {
+	if hash == nil || *hash == "" {
+		id, _ := strconv.ParseUint(discordID, 10, 64)
+		return fmt.Sprintf("%s/embed/avatars/%d.png", discordCDNURL, (id>>22)%6)
+	}
+	ext := "png"
+	if strings.HasPrefix(*hash, "a_") {
+		// Animated avatar
+		ext = "gif"
+	}
+	return fmt.Sprintf("%s/avatars/%s/%s.%s?size=%d", discordCDNURL, discordID, *hash, ext, discordAvatarSize)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// ============================================================================
+// Discord Avatar Tests
+// ============================================================================
+
+// fakeDiscord serves the Discord users API, returning the given avatar hashes
+// (null for accounts without one) and 404 for other accounts
+func fakeDiscord(t *testing.T, avatars map[string]any) *atomic.Int32 {
+	t.Helper()
+	var lookups atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups.Add(1)
+		if r.Header.Get("Authorization") != "Bot bot-token" {
+			http.Error(w, "401: Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		id := r.URL.Path[len("/users/"):]
+		avatar, ok := avatars[id]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]any{"id": id, "avatar": avatar})
+	}))
+	t.Cleanup(server.Close)
+
+	saved := discordAPIURL
+	discordAPIURL = server.URL
+	t.Cleanup(func() { discordAPIURL = saved })
+	t.Setenv("DISCORD_BOT_TOKEN", "bot-token")
+	return &lookups
+}
+
+// listMemberAvatars returns the avatar URL of each member listed by GET /members
+func listMemberAvatars(t *testing.T) map[int64]string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/members", nil)
+	rr := httptest.NewRecorder()
+	handleMembers(rr, req)
+	var members []Member
+	if err := json.Unmarshal(rr.Body.Bytes(), &members); err != nil {
+		t.Fatalf("failed to parse members: %v; body=%s", err, rr.Body.String())
+	}
+	avatars := make(map[int64]string)
+	for _, m := range members {
+		avatars[m.ID] = m.AvatarURL
+	}
+	return avatars
+}
+
+func TestDiscordAvatars(t *testing.T) {
+	setupTest()
+	lookups := fakeDiscord(t, map[string]any{"111111111": "a_1234abcd", "222222222": nil})
+
+	// Looked up in the background, the first listing has no avatars yet
+	if avatars := listMemberAvatars(t); avatars[1] != "" || avatars[2] != "" {
+		t.Errorf("expected no avatars before the lookups, got %v", avatars)
+	}
+	jobs.wait()
+
+	avatars := listMemberAvatars(t)
+	if avatars[1] != "https://cdn.discordapp.com/avatars/111111111/a_1234abcd.gif?size=256" {
+		t.Errorf("expected Alice's animated avatar, got %q", avatars[1])
+	}
+	if avatars[2] != "https://cdn.discordapp.com/embed/avatars/4.png" {
+		t.Errorf("expected Bob's default avatar, got %q", avatars[2])
+	}
+	jobs.wait()
+	if n := lookups.Load(); n != 2 {
+		t.Errorf("expected each avatar looked up once, got %d lookups", n)
+	}
+
+	// An uploaded photo takes precedence
+	usePhotoDir(t)
+	uploadPhoto("1", photoFormField, testPNG(t, 8, 8))
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set(discordIDHeader, "111111111")
+	rr := httptest.NewRecorder()
+	handleMe(rr, req)
+	var me MeResponse
+	json.Unmarshal(rr.Body.Bytes(), &me)
+	if me.Member.PhotoURL == "" || me.Member.AvatarURL != "" {
+		t.Errorf("expected the photo instead of the avatar, got %+v", me.Member)
+	}
+}
+
+func TestDiscordAvatars_Failures(t *testing.T) {
+	setupTest()
+	fakeDiscord(t, map[string]any{"111111111": "1234abcd"})
+
+	// Unknown accounts have no avatar
+	discordAvatars.refresh("222222222")
+	if url := discordAvatars.avatarURL("222222222"); url != "" {
+		t.Errorf("expected no avatar for an unknown account, got %q", url)
+	}
+
+	// A failed lookup keeps the previous avatar
+	discordAvatars.refresh("111111111")
+	t.Setenv("DISCORD_BOT_TOKEN", "revoked")
+	discordAvatars.refresh("111111111")
+	t.Setenv("DISCORD_BOT_TOKEN", "bot-token")
+	if url := discordAvatars.avatarURL("111111111"); url != "https://cdn.discordapp.com/avatars/111111111/1234abcd.png?size=256" {
+		t.Errorf("expected the previous avatar kept, got %q", url)
+	}
+
+	// Without a bot token or a Discord ID nothing is looked up
+	if url := discordAvatars.avatarURL("not-a-snowflake"); url != "" {
+		t.Errorf("expected no avatar for an invalid ID, got %q", url)
+	}
+	t.Setenv("DISCORD_BOT_TOKEN", "")
+	if url := discordAvatars.avatarURL("111111111"); url != "" {
+		t.Errorf("expected no avatar without a bot token, got %q", url)
+	}
+}
+
+func TestDiscordAvatarLink(t *testing.T) {
+	hash := "1234abcd"
+	tests := []struct {
+		id   string
+		hash *string
+		want string
+	}{
+		{"80351110224678912", &hash, "https://cdn.discordapp.com/avatars/80351110224678912/1234abcd.png?size=256"},
+		{"80351110224678912", nil, "https://cdn.discordapp.com/embed/avatars/5.png"},
+	}
+	for _, tt := range tests {
+		if got := discordAvatarLink(tt.id, tt.hash); got != tt.want {
+			t.Errorf("discordAvatarLink(%s) = %q, want %q", tt.id, got, tt.want)
+		}
+	}
+}
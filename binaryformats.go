@@ -0,0 +1,297 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// --- MessagePack and CBOR Responses ---
+//
+// Parsing JSON is a measurable part of the scanner firmware's loop, so the
+// responses scanners read (/scan, /scan/result and /devices/{id}/config) can
+// also be had as MessagePack, with Accept: application/msgpack (or
+// application/x-msgpack), or CBOR, with Accept: application/cbor. Anything
+// else gets JSON. The binary forms hold exactly what the JSON would: the same
+// keys, sorted, with times as RFC 3339 strings and whole numbers as integers
+// in their shortest form. Errors stay plain text.
+//
+// Scan and heartbeat responses can also be had as protobuf (see
+// scannerproto.go); other responses asked for as protobuf are JSON.
+
+const (
+	formatJSON     = "json"
+	formatMsgPack  = "msgpack"
+	formatCBOR     = "cbor"
+	formatProtobuf = "protobuf"
+)
+
+// responseFormats maps the accepted media types to formats
+var responseFormats = map[string]string{
+	"application/json":      formatJSON,
+	"application/msgpack":   formatMsgPack,
+	"application/x-msgpack": formatMsgPack,
+	"application/cbor":      formatCBOR,
+	contentTypeProtobuf:     formatProtobuf,
+}
+
+// formatContentTypes is the Content-Type of each format
+var formatContentTypes = map[string]string{
+	formatJSON:     "application/json",
+	formatMsgPack:  "application/msgpack",
+	formatCBOR:     "application/cbor",
+	formatProtobuf: contentTypeProtobuf,
+}
+
+// negotiateFormat returns the first format in the Accept header the server
+// can write, JSON if none
+func negotiateFormat(r *http.Request) string {
+	for _, accepted := range strings.Split(r.Header.Get("Accept"), ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(accepted))
+		if err != nil || params["q"] == "0" {
+			continue
+		}
+		if format, ok := responseFormats[mediaType]; ok {
+			return format
+		}
+	}
+	return formatJSON
+}
+
+// writeNegotiated writes v with a status code in the format the request accepts
+func writeNegotiated(w http.ResponseWriter, r *http.Request, code int, v any) {
+	format := negotiateFormat(r)
+	if _, ok := v.(protoMessage); format == formatProtobuf && !ok {
+		format = formatJSON
+	}
+	body, err := encodeFormat(format, v)
+	if err != nil {
+		log.Printf("Error encoding %s response: %v", format, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", formatContentTypes[format])
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// encodeFormat encodes v as JSON (with a trailing newline like json.Encoder),
+// MessagePack, CBOR or, for a protoMessage, protobuf
+func encodeFormat(format string, v any) ([]byte, error) {
+	if m, ok := v.(protoMessage); ok && format == formatProtobuf {
+		return m.marshalProto(), nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil || format == formatJSON {
+		return append(data, '\n'), err
+	}
+
+	// Go through JSON so the fields are named and omitted the same way
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var value any
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if format == formatMsgPack {
+		err = writeMsgPack(&buf, value)
+	} else {
+		err = writeCBOR(&buf, value)
+	}
+	return buf.Bytes(), err
+}
+
+// sortedKeys returns the keys of a JSON object in order
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeMsgPack encodes a value decoded from JSON as MessagePack
+func writeMsgPack(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xc0)
+	case bool:
+		if v {
+			buf.WriteByte(0xc3)
+		} else {
+			buf.WriteByte(0xc2)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			writeMsgPackInt(buf, n)
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(0xcb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeMsgPackLength(buf, len(v), 0xa0, 32, 0xd9, 0xda, 0xdb)
+		buf.WriteString(v)
+	case []any:
+		writeMsgPackLength(buf, len(v), 0x90, 16, 0, 0xdc, 0xdd)
+		for _, item := range v {
+			if err := writeMsgPack(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		writeMsgPackLength(buf, len(v), 0x80, 16, 0, 0xde, 0xdf)
+		for _, k := range sortedKeys(v) {
+			writeMsgPack(buf, k)
+			if err := writeMsgPack(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as MessagePack", v)
+	}
+	return nil
+}
+
+// writeMsgPackInt writes an integer in its shortest MessagePack form
+func writeMsgPackInt(buf *bytes.Buffer, n int64) {
+	switch {
+	case n >= 0 && n < 128:
+		buf.WriteByte(byte(n))
+	case n >= -32 && n < 0:
+		buf.WriteByte(byte(n))
+	case n >= 0 && n <= math.MaxUint8:
+		buf.Write([]byte{0xcc, byte(n)})
+	case n >= 0 && n <= math.MaxUint16:
+		buf.WriteByte(0xcd)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n >= 0 && n <= math.MaxUint32:
+		buf.WriteByte(0xce)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	case n >= 0:
+		buf.WriteByte(0xcf)
+		binary.Write(buf, binary.BigEndian, uint64(n))
+	case n >= math.MinInt8:
+		buf.Write([]byte{0xd0, byte(n)})
+	case n >= math.MinInt16:
+		buf.WriteByte(0xd1)
+		binary.Write(buf, binary.BigEndian, int16(n))
+	case n >= math.MinInt32:
+		buf.WriteByte(0xd2)
+		binary.Write(buf, binary.BigEndian, int32(n))
+	default:
+		buf.WriteByte(0xd3)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
+
+// writeMsgPackLength writes the header of a string, array or map: the fix
+// form below fixMax, else the 8 (if any, non-zero), 16 or 32 bit form
+func writeMsgPackLength(buf *bytes.Buffer, n int, fix byte, fixMax int, len8, len16, len32 byte) {
+	switch {
+	case n < fixMax:
+		buf.WriteByte(fix | byte(n))
+	case len8 != 0 && n <= math.MaxUint8:
+		buf.Write([]byte{len8, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(len16)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	default:
+		buf.WriteByte(len32)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	}
+}
+
+// CBOR major types
+const (
+	cborUnsigned = 0
+	cborNegative = 1
+	cborText     = 3
+	cborArray    = 4
+	cborMap      = 5
+)
+
+// writeCBOR encodes a value decoded from JSON as CBOR (RFC 8949)
+func writeCBOR(buf *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		buf.WriteByte(0xf6)
+	case bool:
+		if v {
+			buf.WriteByte(0xf5)
+		} else {
+			buf.WriteByte(0xf4)
+		}
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			if n >= 0 {
+				writeCBORHead(buf, cborUnsigned, uint64(n))
+			} else {
+				writeCBORHead(buf, cborNegative, uint64(-1-n))
+			}
+			return nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return err
+		}
+		buf.WriteByte(0xfb)
+		binary.Write(buf, binary.BigEndian, math.Float64bits(f))
+	case string:
+		writeCBORHead(buf, cborText, uint64(len(v)))
+		buf.WriteString(v)
+	case []any:
+		writeCBORHead(buf, cborArray, uint64(len(v)))
+		for _, item := range v {
+			if err := writeCBOR(buf, item); err != nil {
+				return err
+			}
+		}
+	case map[string]any:
+		writeCBORHead(buf, cborMap, uint64(len(v)))
+		for _, k := range sortedKeys(v) {
+			writeCBOR(buf, k)
+			if err := writeCBOR(buf, v[k]); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("cannot encode %T as CBOR", v)
+	}
+	return nil
+}
+
+// writeCBORHead writes the initial byte of a data item and its argument in
+// the shortest form
+func writeCBORHead(buf *bytes.Buffer, major byte, n uint64) {
+	switch {
+	case n < 24:
+		buf.WriteByte(major<<5 | byte(n))
+	case n <= math.MaxUint8:
+		buf.Write([]byte{major<<5 | 24, byte(n)})
+	case n <= math.MaxUint16:
+		buf.WriteByte(major<<5 | 25)
+		binary.Write(buf, binary.BigEndian, uint16(n))
+	case n <= math.MaxUint32:
+		buf.WriteByte(major<<5 | 26)
+		binary.Write(buf, binary.BigEndian, uint32(n))
+	default:
+		buf.WriteByte(major<<5 | 27)
+		binary.Write(buf, binary.BigEndian, n)
+	}
+}
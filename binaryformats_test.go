@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// MessagePack and CBOR Tests
+// ============================================================================
+
+func TestNegotiateFormat(t *testing.T) {
+	cases := map[string]string{
+		"":                                   formatJSON,
+		"*/*":                                formatJSON,
+		"application/msgpack":                formatMsgPack,
+		"application/x-msgpack":              formatMsgPack,
+		"application/cbor, application/json": formatCBOR,
+		"text/html, application/cbor;q=0.9":  formatCBOR,
+		"application/msgpack;q=0, */*":       formatJSON,
+	}
+	for accept, want := range cases {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", accept)
+		if got := negotiateFormat(req); got != want {
+			t.Errorf("Accept %q: expected %s, got %s", accept, want, got)
+		}
+	}
+}
+
+func TestEncodeFormat_Scalars(t *testing.T) {
+	cases := []struct {
+		value         any
+		msgpack, cbor string
+	}{
+		{0, "00", "00"},
+		{23, "17", "17"},
+		{127, "7f", "187f"},
+		{128, "cc80", "1880"},
+		{500, "cd01f4", "1901f4"},
+		{70000, "ce00011170", "1a00011170"},
+		{-1, "ff", "20"},
+		{-33, "d0df", "3820"},
+		{-500, "d1fe0c", "3901f3"},
+		{1.5, "cb3ff8000000000000", "fb3ff8000000000000"},
+		{true, "c3", "f5"},
+		{false, "c2", "f4"},
+		{nil, "c0", "f6"},
+		{"", "a0", "60"},
+		{[]int{1, 2}, "920102", "820102"},
+	}
+	for _, c := range cases {
+		if got, _ := encodeFormat(formatMsgPack, c.value); hex.EncodeToString(got) != c.msgpack {
+			t.Errorf("MessagePack of %v: expected %s, got %x", c.value, c.msgpack, got)
+		}
+		if got, _ := encodeFormat(formatCBOR, c.value); hex.EncodeToString(got) != c.cbor {
+			t.Errorf("CBOR of %v: expected %s, got %x", c.value, c.cbor, got)
+		}
+	}
+}
+
+func TestEncodeFormat_LongString(t *testing.T) {
+	s := string(bytes.Repeat([]byte("a"), 300))
+	got, _ := encodeFormat(formatMsgPack, s)
+	if hex.EncodeToString(got[:3]) != "da012c" || len(got) != 303 {
+		t.Errorf("expected a str16 header, got %x", got[:3])
+	}
+	got, _ = encodeFormat(formatCBOR, s)
+	if hex.EncodeToString(got[:3]) != "79012c" || len(got) != 303 {
+		t.Errorf("expected a two-byte length, got %x", got[:3])
+	}
+}
+
+func TestHandleScan_MessagePack(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid": "TEST_UID_1"}`))
+	req.Header.Set("Accept", "application/msgpack")
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/msgpack" || rr.Header().Get("Vary") != "Accept" {
+		t.Fatalf("expected a MessagePack response, got %v %v", rr.Code, rr.Header())
+	}
+
+	// {"announcement": ..., "message": ..., "status": "in"}, keys sorted
+	body := rr.Body.Bytes()
+	if body[0] != 0x83 || !bytes.Contains(body, []byte("\xa6status\xa2in")) || !bytes.Contains(body, []byte("\xacannouncement")) {
+		t.Errorf("unexpected body %x", body)
+	}
+}
+
+func TestHandleDeviceConfig_CBOR(t *testing.T) {
+	setupTest()
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/devices/%d/config", device.ID), nil)
+	req.Header.Set("Accept", "application/cbor")
+	rr := httptest.NewRecorder()
+	handleDeviceConfig(rr, req, device.ID)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != "application/cbor" {
+		t.Fatalf("expected a CBOR response, got %v %v", rr.Code, rr.Header())
+	}
+	// debounce_ms: 3000 is a text key and a two-byte unsigned integer
+	if body := rr.Body.Bytes(); !bytes.Contains(body, []byte("\x6bdebounce_ms\x19\x0b\xb8")) {
+		t.Errorf("unexpected body %x", body)
+	}
+}
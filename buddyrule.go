@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"time"
+)
+
+// --- Buddy Rule ---
+//
+// Faculty safety rules require two people in the office at night. With
+// BUDDY_RULE_AFTER set (a Go duration such as 15m), a background monitor
+// watches live occupancy, and once a single person has been alone in the
+// office outside office hours (see officehours.go) for that long it logs a
+// warning, records buddy_rule.alone in the audit log and publishes
+// alone_after_hours, which is posted to the after_hours integration so
+// supervisors can check in. Each stretch alone is reported once; it ends when
+// someone else signs in or the person leaves. Without OFFICE_HOURS nothing is
+// after hours, so the rule never applies.
+
+// buddyRuleMonitorInterval is how often occupancy is checked against the buddy rule
+const buddyRuleMonitorInterval = time.Minute
+
+// buddyRuleAfter is how long someone may be alone after hours before it is
+// reported, 0 when the rule is off
+var buddyRuleAfter time.Duration
+
+// loadBuddyRuleAfter reads BUDDY_RULE_AFTER (a Go duration such as 15m)
+func loadBuddyRuleAfter() (time.Duration, error) {
+	value := os.Getenv("BUDDY_RULE_AFTER")
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// loneStretch is a stretch of time a single person is in the office
+type loneStretch struct {
+	UID      string
+	Since    time.Time
+	Reported bool
+}
+
+// buddyRuleState is what the monitor last saw of occupancy
+var buddyRuleState struct {
+	alone     loneStretch
+	crowdedAt time.Time // Last check that found two or more people inside
+}
+
+// checkBuddyRule reports the person alone in the office once they have been
+// alone outside office hours for buddyRuleAfter
+func checkBuddyRule(now time.Time) {
+	if buddyRuleAfter == 0 {
+		return
+	}
+
+	attendees := currentAttendees.list()
+	if len(attendees) != 1 {
+		buddyRuleState.alone = loneStretch{}
+		if len(attendees) > 1 {
+			buddyRuleState.crowdedAt = now
+		}
+		return
+	}
+
+	// Alone since they signed in, or since the others left (to within a check)
+	a := attendees[0]
+	if buddyRuleState.alone.UID != a.UID {
+		buddyRuleState.alone = loneStretch{UID: a.UID, Since: maxTime(a.SignInTime, buddyRuleState.crowdedAt)}
+	}
+	alone := &buddyRuleState.alone
+	if alone.Reported {
+		return
+	}
+	afterHours := officeHours.outside(alone.Since, now, reportLocation(defaultOrg))
+	if afterHours < buddyRuleAfter {
+		return
+	}
+	alone.Reported = true
+
+	member, _ := memberCache.get(a.UID)
+	name := member.Name
+	if member.ID != 0 {
+		if name = notificationName(member); name == "" {
+			name = "Someone"
+		}
+	}
+	msg := fmt.Sprintf("Buddy rule: %s has been alone in the office after hours for %s", name, afterHours.Round(time.Minute))
+	log.Printf("Warning: %s has been alone in the office after hours for %s", member.Name, afterHours.Round(time.Minute))
+	recordAudit("buddy_rule.alone", "system", fmt.Sprintf("member=%d alone_since=%s", member.ID, alone.Since.Format(time.RFC3339)))
+	events.publish(Event{Kind: eventAloneAfterHours, Time: now, Member: member, Message: msg})
+}
+
+// startBuddyRuleMonitor periodically checks occupancy against the buddy rule
+func startBuddyRuleMonitor() {
+	ticker := time.NewTicker(buddyRuleMonitorInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		checkBuddyRule(now)
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Buddy Rule Tests
+// ============================================================================
+
+// useBuddyRule turns the buddy rule on for a test, with nobody in the office after hours today
+func useBuddyRule(t *testing.T, after time.Duration) {
+	t.Helper()
+
+	useOfficeHours(t, closedAllToday())
+	buddyRuleAfter = after
+	buddyRuleState.alone, buddyRuleState.crowdedAt = loneStretch{}, time.Time{}
+	t.Cleanup(func() { buddyRuleAfter = 0 })
+}
+
+func TestCheckBuddyRule_ReportsOnce(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "AFTER_HOURS_WEBHOOK_URL")
+	useBuddyRule(t, 15*time.Minute)
+
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-10*time.Minute))
+	checkBuddyRule(now)
+	if messages := delivered(); len(messages) != 0 {
+		t.Fatalf("expected no warning after 10 minutes, got %q", messages)
+	}
+
+	checkBuddyRule(now.Add(6 * time.Minute))
+	checkBuddyRule(now.Add(7 * time.Minute))
+	messages := delivered()
+	if len(messages) != 1 || !strings.HasPrefix(messages[0], "Buddy rule: Alice has been alone") {
+		t.Errorf("expected one buddy rule warning, got %q", messages)
+	}
+	if entries, _ := loadAuditEntries("buddy_rule.alone", 10); len(entries) != 1 {
+		t.Errorf("expected 1 audit entry, got %d", len(entries))
+	}
+}
+
+func TestCheckBuddyRule_TwoPeople(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "AFTER_HOURS_WEBHOOK_URL")
+	useBuddyRule(t, 15*time.Minute)
+
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-time.Hour))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-time.Hour))
+	checkBuddyRule(now)
+
+	// Alone from when Bob left, not from when Alice signed in
+	currentAttendees.remove("TEST_UID_2")
+	checkBuddyRule(now.Add(10 * time.Minute))
+	if messages := delivered(); len(messages) != 0 {
+		t.Fatalf("expected no warning 10 minutes after Bob left, got %q", messages)
+	}
+	checkBuddyRule(now.Add(16 * time.Minute))
+	if messages := delivered(); len(messages) != 1 {
+		t.Errorf("expected a warning 16 minutes after Bob left, got %q", messages)
+	}
+}
+
+func TestCheckBuddyRule_DuringOfficeHours(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "AFTER_HOURS_WEBHOOK_URL")
+	useBuddyRule(t, 15*time.Minute)
+	useOfficeHours(t, "sun-sat 00:00-24:00")
+
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-time.Hour))
+	checkBuddyRule(now)
+	if messages := delivered(); len(messages) != 0 {
+		t.Errorf("expected no warning during office hours, got %q", messages)
+	}
+}
+
+func TestLoadBuddyRuleAfter(t *testing.T) {
+	if d, err := loadBuddyRuleAfter(); err != nil || d != 0 {
+		t.Errorf("expected the rule off by default, got %v (%v)", d, err)
+	}
+	t.Setenv("BUDDY_RULE_AFTER", "15m")
+	if d, err := loadBuddyRuleAfter(); err != nil || d != 15*time.Minute {
+		t.Errorf("expected 15m, got %v (%v)", d, err)
+	}
+	t.Setenv("BUDDY_RULE_AFTER", "-5m")
+	if _, err := loadBuddyRuleAfter(); err == nil {
+		t.Error("expected an error for a negative duration")
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- Card Number Formats ---
+//
+// Readers report cards in different representations. Each device has a
+// card_format and scans from it are converted to the canonical UID that
+// members are registered with:
+//   - raw: the value is used as-is (NFC UIDs from the ESP32 readers)
+//   - decimal: a decimal card number, canonicalized to upper-case hex
+//     (e.g. 77777777 becomes 04A2CB71)
+//   - wiegand26: 26-bit Wiegand, given as "facility:card" or as the 26-bit
+//     frame with parity bits; canonicalized to 2 hex digits of facility code
+//     followed by 4 of card number (e.g. 123:4567 becomes 7B11D7)
+//
+// Scanners identify their device through their mTLS certificate or the
+// X-Device-ID header. Scans without a device are treated as raw.
+
+const (
+	cardFormatRaw       = "raw"
+	cardFormatDecimal   = "decimal"
+	cardFormatWiegand26 = "wiegand26"
+)
+
+// validCardFormat reports whether format is a supported card format
+func validCardFormat(format string) bool {
+	switch format {
+	case cardFormatRaw, cardFormatDecimal, cardFormatWiegand26:
+		return true
+	}
+	return false
+}
+
+// canonicalUID converts a card number reported in the given format to its canonical UID
+func canonicalUID(format, value string) (string, error) {
+	value = strings.TrimSpace(value)
+	switch format {
+	case "", cardFormatRaw:
+		return value, nil
+
+	case cardFormatDecimal:
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid decimal card number %q", value)
+		}
+		hex := strings.ToUpper(strconv.FormatUint(n, 16))
+		if len(hex)%2 == 1 {
+			hex = "0" + hex
+		}
+		return hex, nil
+
+	case cardFormatWiegand26:
+		facility, card, err := parseWiegand26(value)
+		if err != nil {
+			return "", err
+		}
+		return fmt.Sprintf("%02X%04X", facility, card), nil
+	}
+	return "", fmt.Errorf("unsupported card format %q", format)
+}
+
+// parseWiegand26 reads a 26-bit Wiegand card as "facility:card" (or "facility,card")
+// or as a 26-character bit string, verifying its parity bits
+func parseWiegand26(value string) (uint64, uint64, error) {
+	if fac, card, found := strings.Cut(strings.ReplaceAll(value, ",", ":"), ":"); found {
+		facility, err1 := strconv.ParseUint(strings.TrimSpace(fac), 10, 8)
+		number, err2 := strconv.ParseUint(strings.TrimSpace(card), 10, 16)
+		if err1 != nil || err2 != nil {
+			return 0, 0, fmt.Errorf("invalid Wiegand card %q, expected facility 0-255 and card 0-65535", value)
+		}
+		return facility, number, nil
+	}
+
+	if len(value) != 26 || strings.Trim(value, "01") != "" {
+		return 0, 0, fmt.Errorf("invalid Wiegand card %q, expected facility:card or 26 bits", value)
+	}
+
+	// Bit 0 is even parity over bits 1-12, bit 25 odd parity over bits 13-24
+	ones := func(bits string) int { return strings.Count(bits, "1") }
+	if ones(value[:13])%2 != 0 || ones(value[13:])%2 != 1 {
+		return 0, 0, fmt.Errorf("invalid Wiegand card %q, parity check failed", value)
+	}
+
+	data, _ := strconv.ParseUint(value[1:25], 2, 64)
+	return data >> 16, data & 0xFFFF, nil
+}
+
+// canonicalizeScanUID is a pre-validate hook converting the scanned card number
+// to its canonical UID using the scanning device's card format (phone check-ins
+// already carry the member's UID)
+func canonicalizeScanUID(sc *ScanContext) error {
+	if sc.Device == nil || sc.NFCKeyID != "" {
+		return nil
+	}
+	uid, err := canonicalUID(sc.Device.CardFormat, sc.UID)
+	if err != nil {
+		return rejectScan(http.StatusBadRequest, "%v", err)
+	}
+	sc.UID = uid
+	return nil
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// Card Format Conversion Tests
+// ============================================================================
+
+func TestCanonicalUID(t *testing.T) {
+	cases := []struct {
+		format, value, want string
+	}{
+		{cardFormatRaw, " 04A2CB71 ", "04A2CB71"},
+		{"", "abc", "abc"},
+		{cardFormatDecimal, "77777777", "04A2CB71"},
+		{cardFormatDecimal, "255", "FF"},
+		{cardFormatWiegand26, "123:4567", "7B11D7"},
+		{cardFormatWiegand26, "123,4567", "7B11D7"},
+		{cardFormatWiegand26, "10111101100010001110101110", "7B11D7"},
+	}
+
+	for _, c := range cases {
+		got, err := canonicalUID(c.format, c.value)
+		if err != nil || got != c.want {
+			t.Errorf("canonicalUID(%q, %q) = %q, %v; want %q", c.format, c.value, got, err, c.want)
+		}
+	}
+}
+
+func TestCanonicalUID_Invalid(t *testing.T) {
+	cases := []struct {
+		format, value string
+	}{
+		{cardFormatDecimal, "04A2CB71"},
+		{cardFormatDecimal, "-1"},
+		{cardFormatWiegand26, "256:1"},
+		{cardFormatWiegand26, "1:65536"},
+		{cardFormatWiegand26, "12345"},
+		// Leading parity bit flipped
+		{cardFormatWiegand26, "00111101100010001110101110"},
+		{"hex", "04A2CB71"},
+	}
+
+	for _, c := range cases {
+		if got, err := canonicalUID(c.format, c.value); err == nil {
+			t.Errorf("canonicalUID(%q, %q) = %q, expected error", c.format, c.value, got)
+		}
+	}
+}
+
+// ============================================================================
+// Per-Device Card Format Tests
+// ============================================================================
+
+func TestHandleDevice_UpdateCardFormat(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "side-door")
+	if device.CardFormat != cardFormatRaw {
+		t.Fatalf("expected default raw format, got %q", device.CardFormat)
+	}
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/devices/%d", device.ID), bytes.NewBufferString(`{"card_format":"wiegand26"}`))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var updated Device
+	json.Unmarshal(rr.Body.Bytes(), &updated)
+	if updated.CardFormat != cardFormatWiegand26 || updated.Name != "side-door" {
+		t.Errorf("expected wiegand26 format with name unchanged, got %+v", updated)
+	}
+
+	req, _ = http.NewRequest("PUT", fmt.Sprintf("/devices/%d", device.ID), bytes.NewBufferString(`{"card_format":"hex"}`))
+	rr = httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown format, got %v", rr.Code)
+	}
+}
+
+func TestHandleDevices_CreateInvalidCardFormat(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/devices", bytes.NewBufferString(`{"name":"door","card_format":"hex"}`))
+	rr := httptest.NewRecorder()
+	handleDevices(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestHandleScan_WiegandDevice(t *testing.T) {
+	setupTest()
+
+	db.Exec(`INSERT INTO members (id, name, uid, discord_id) VALUES (3, 'Carol', '7B11D7', '333333333')`)
+	loadMembersIntoCache()
+
+	device := createTestDevice(t, "door-reader")
+	db.Exec(`UPDATE devices SET card_format = 'wiegand26' WHERE id = ?`, device.ID)
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid":"123:4567"}`))
+	req.Header.Set(deviceIDHeader, fmt.Sprint(device.ID))
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if _, ok, _ := currentAttendees.get("7B11D7"); !ok {
+		t.Error("expected Carol to be signed in")
+	}
+	if history := scanHistory.list(); len(history) != 1 || history[0].UID != "7B11D7" {
+		t.Errorf("expected the canonical UID in scan history, got %+v", history)
+	}
+
+	// A malformed card number is rejected
+	req, _ = http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid":"TEST_UID_1"}`))
+	req.Header.Set(deviceIDHeader, fmt.Sprint(device.ID))
+	rr = httptest.NewRecorder()
+	handleScan(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for malformed Wiegand card, got %v", rr.Code)
+	}
+}
+
+func TestHandleScan_UnknownDevice(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid":"TEST_UID_1"}`))
+	req.Header.Set(deviceIDHeader, "99")
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
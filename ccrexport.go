@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// --- Co-curricular Record Export ---
+//
+// Volunteer hours are submitted to the university's co-curricular record
+// (CCR) once a term, per member and activity. Sessions are tagged with an
+// activity by allocating their time to a project that has a ccr_code (see
+// projects.go); projects sharing a code count as one activity.
+// GET /reports/ccr.csv?term=<name> returns one row per member and activity
+// code with the hours allocated from sessions started in the term, using the
+// sessions' corrected times (see sessionamendments.go). Deleted members are
+// left out.
+//
+// The hours are verified: with the session ledger on (see sessionledger.go)
+// the export is refused unless the ledger verifies, and carries its head as
+// X-Session-Ledger-Head so the submission can be attested later.
+
+// ccrCodePattern is what a CCR activity code may hold
+var ccrCodePattern = regexp.MustCompile(`^[A-Z0-9-]{1,32}$`)
+
+// ccrHeader is the header row of the CCR export
+var ccrHeader = []string{"Member ID", "Name", "Activity Code", "Term", "Verified Hours", "Sessions"}
+
+// CCRRow is a member's hours on one activity over a term
+type CCRRow struct {
+	MemberID     int64
+	Name         string
+	ActivityCode string
+	Sessions     int
+	TotalSeconds int64
+}
+
+// validCCRCode reports whether a project's ccr_code is empty or well formed
+func validCCRCode(code string) bool {
+	return code == "" || ccrCodePattern.MatchString(code)
+}
+
+// loadCCRRows sums the time allocated to projects with a CCR code per member
+// and code, from the corrected sessions of an organization's members started
+// within the term, by name then code
+func loadCCRRows(org string, term Term) ([]CCRRow, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.name, p.ccr_code, COUNT(DISTINCT v.id), SUM(a.seconds)
+		FROM session_allocations a
+		JOIN projects p ON p.id = a.project_id
+		JOIN `+correctedVisits+` v ON v.id = a.visit_id
+		JOIN members m ON m.id = v.member_id
+		WHERE p.ccr_code != '' AND m.deleted_at IS NULL AND m.org_id = ?
+			AND julianday(v.signin_time) >= julianday(?) AND julianday(v.signin_time) <= julianday(?)
+		GROUP BY m.id, p.ccr_code
+		ORDER BY m.name, m.id, p.ccr_code`,
+		org, term.Start.Format(time.RFC3339), term.End.Format(time.RFC3339))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ccr []CCRRow
+	for rows.Next() {
+		var c CCRRow
+		if err := rows.Scan(&c.MemberID, &c.Name, &c.ActivityCode, &c.Sessions, &c.TotalSeconds); err != nil {
+			return nil, err
+		}
+		ccr = append(ccr, c)
+	}
+	return ccr, rows.Err()
+}
+
+// handleCCRExport returns the CCR submission of a term as CSV (GET)
+// Query parameters:
+//   - term: term name (defaults to the current term)
+func handleCCRExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	term, ok := reportTerm(w, r)
+	if !ok {
+		return
+	}
+
+	// Hours are only submitted from a ledger that verifies
+	var head string
+	if sessionLedgerKey != nil {
+		v, err := verifySessionLedger("", time.Now())
+		if err != nil {
+			log.Printf("Error verifying the session ledger: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !v.Valid {
+			http.Error(w, "Session ledger does not verify, see /admin/verify-ledger", http.StatusConflict)
+			return
+		}
+		head = v.Head
+	}
+
+	rows, err := loadCCRRows(requestOrg(r), term)
+	if err != nil {
+		log.Printf("Error loading CCR hours: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	recordAudit("ccr.exported", clientIP(r), fmt.Sprintf("term=%s rows=%d", term.Name, len(rows)))
+
+	w.Header().Set("Content-Type", "text/csv")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-ccr.csv"`, term.Name))
+	if head != "" {
+		w.Header().Set(ledgerHeadHeader, head)
+	}
+
+	writer := csv.NewWriter(w)
+	defer writer.Flush()
+	if err := writer.Write(ccrHeader); err != nil {
+		log.Printf("Error writing CSV header: %v", err)
+		return
+	}
+	for _, c := range rows {
+		if err := writer.Write([]string{
+			strconv.FormatInt(c.MemberID, 10),
+			c.Name,
+			c.ActivityCode,
+			term.Name,
+			strconv.FormatFloat(float64(c.TotalSeconds)/3600, 'f', 2, 64),
+			strconv.Itoa(c.Sessions),
+		}); err != nil {
+			log.Printf("Error writing CSV record: %v", err)
+			return
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Co-curricular Record Export Tests
+// ============================================================================
+
+// createCCRProject creates a project with a CCR activity code
+func createCCRProject(t *testing.T, name, code string) Project {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/projects", bytes.NewBufferString(`{"name":"`+name+`","ccr_code":"`+code+`"}`))
+	rr := httptest.NewRecorder()
+	handleProjects(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var p Project
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	return p
+}
+
+// exportCCR calls /reports/ccr.csv
+func exportCCR(query string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", "/reports/ccr.csv"+query, nil)
+	rr := httptest.NewRecorder()
+	handleCCRExport(rr, req)
+	return rr
+}
+
+func TestHandleCCRExport(t *testing.T) {
+	setupTest()
+	now := time.Now()
+	createTestTerm(t, "fall-2025", now.AddDate(0, -1, 0), now.AddDate(0, 1, 0))
+
+	rover := createCCRProject(t, "Rover", "ieee-vol")
+	if rover.CCRCode != "IEEE-VOL" {
+		t.Errorf("expected the code upper-cased, got %q", rover.CCRCode)
+	}
+	createCCRProject(t, "Outreach", "IEEE-OUT")
+	createProject(t, "Sponsor") // Not an activity
+
+	alice := insertSession(t, 1, 3*time.Hour)
+	allocateSession(alice, "", `{"project":"Rover","seconds":5400}`)
+	allocateSession(alice, "", `{"project":"Sponsor","seconds":3600}`)
+	bob := insertSession(t, 2, 2*time.Hour)
+	allocateSession(bob, "", `{"project":"Outreach"}`)
+	allocateSession(insertSession(t, 2, time.Hour), "", `{"project":"Outreach"}`)
+
+	rr := exportCCR("?term=fall-2025")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [][]string{
+		ccrHeader,
+		{"1", "Alice", "IEEE-VOL", "fall-2025", "1.50", "1"},
+		{"2", "Bob", "IEEE-OUT", "fall-2025", "3.00", "2"},
+	}
+	if len(records) != len(want) {
+		t.Fatalf("expected %d rows, got %v", len(want), records)
+	}
+	for i := range want {
+		for j := range want[i] {
+			if records[i][j] != want[i][j] {
+				t.Errorf("row %d: expected %v, got %v", i, want[i], records[i])
+				break
+			}
+		}
+	}
+
+	req, _ := http.NewRequest("POST", "/projects", bytes.NewBufferString(`{"name":"Bad","ccr_code":"IEEE VOL"}`))
+	rr = httptest.NewRecorder()
+	handleProjects(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed code, got %v", rr.Code)
+	}
+}
+
+func TestHandleCCRExport_LedgerMustVerify(t *testing.T) {
+	setupTest()
+	now := time.Now()
+	createTestTerm(t, "fall-2025", now.AddDate(0, -1, 0), now.AddDate(0, 1, 0))
+	createCCRProject(t, "Rover", "IEEE-VOL")
+	session := insertSession(t, 1, 2*time.Hour)
+	allocateSession(session, "", `{"project":"Rover"}`)
+	enableSessionLedger(t) // Records the existing session
+
+	rr := exportCCR("?term=fall-2025")
+	if rr.Code != http.StatusOK || rr.Header().Get(ledgerHeadHeader) == "" {
+		t.Fatalf("expected the export with the ledger head, got %v; headers=%v", rr.Code, rr.Header())
+	}
+
+	db.Exec(`DROP TRIGGER visits_append_only`)
+	db.Exec(`UPDATE visits SET signin_time = ? WHERE id = ?`, now.Add(-10*time.Hour).Format(time.RFC3339), session)
+	if rr := exportCCR("?term=fall-2025"); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 once the ledger no longer verifies, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"time"
+)
+
+// --- Device Clock Skew ---
+//
+// Scanners may send their own clock reading as "time" in heartbeats and scans.
+// The difference to the server clock is stored on the device as
+// clock_skew_seconds (positive when the device is ahead). When it grows
+// beyond CLOCK_SKEW_THRESHOLD (default 2 minutes) a warning is logged,
+// audited as device.clock_skew and sent to ALERT_WEBHOOK_URL, once until the
+// clock is back within the threshold.
+
+const defaultClockSkewThreshold = 2 * time.Minute
+
+// clockSkewThreshold is the skew above which a device's clock is reported
+var clockSkewThreshold = defaultClockSkewThreshold
+
+// loadClockSkewThreshold reads CLOCK_SKEW_THRESHOLD (a Go duration such as 30s)
+func loadClockSkewThreshold() (time.Duration, error) {
+	value := os.Getenv("CLOCK_SKEW_THRESHOLD")
+	if value == "" {
+		return defaultClockSkewThreshold, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// skewExceeds reports whether a skew in seconds is beyond clockSkewThreshold
+func skewExceeds(skewSeconds float64) bool {
+	return math.Abs(skewSeconds) > clockSkewThreshold.Seconds()
+}
+
+// recordClockSkew stores the difference between a device's clock and the
+// server's, and warns when it crosses the threshold
+func recordClockSkew(device Device, deviceTime, now time.Time) error {
+	skew := deviceTime.Sub(now).Round(time.Millisecond).Seconds()
+	if _, err := db.Exec(`UPDATE devices SET clock_skew_seconds = ? WHERE id = ?`, skew, device.ID); err != nil {
+		return err
+	}
+
+	wasSkewed := device.ClockSkewSeconds != nil && skewExceeds(*device.ClockSkewSeconds)
+	if skewExceeds(skew) && !wasSkewed {
+		msg := fmt.Sprintf("Scanner %q clock is off by %s (device %s, server %s)", device.Name,
+			time.Duration(skew*float64(time.Second)).Round(time.Second),
+			deviceTime.Local().Format(time.TimeOnly), now.Local().Format(time.TimeOnly))
+		log.Println(msg)
+		recordAudit("device.clock_skew", device.Name, msg)
+		sendAlert(msg)
+	}
+	return nil
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Device Clock Skew Tests
+// ============================================================================
+
+func TestHandleDeviceHeartbeat_RecordsClockSkew(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	deviceTime := time.Now().Add(20 * time.Minute).Format(time.RFC3339)
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/devices/%d/heartbeat", device.ID), bytes.NewBufferString(`{"time":"`+deviceTime+`"}`))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	updated, _ := loadDevice(device.ID)
+	if updated.ClockSkewSeconds == nil || *updated.ClockSkewSeconds < 1190 || *updated.ClockSkewSeconds > 1200 {
+		t.Fatalf("expected about 20 minutes of skew, got %v", updated.ClockSkewSeconds)
+	}
+
+	// Warned once while the clock stays off
+	sendHeartbeat(t, device.ID)
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/devices/%d/heartbeat", device.ID), bytes.NewBufferString(`{"time":"`+deviceTime+`"}`))
+	handleDevice(httptest.NewRecorder(), req)
+
+	entries, _ := loadAuditEntries("device.clock_skew", 10)
+	if len(entries) != 1 || entries[0].Actor != "front-door" {
+		t.Errorf("expected one device.clock_skew audit entry, got %+v", entries)
+	}
+}
+
+func TestHandleDeviceHeartbeat_InvalidBody(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/devices/%d/heartbeat", device.ID), bytes.NewBufferString(`{"time":"yesterday"}`))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestRecordClockSkew_WithinThreshold(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	now := time.Now()
+
+	if err := recordClockSkew(device, now.Add(-30*time.Second), now); err != nil {
+		t.Fatalf("recordClockSkew failed: %v", err)
+	}
+
+	updated, _ := loadDevice(device.ID)
+	if updated.ClockSkewSeconds == nil || *updated.ClockSkewSeconds != -30 {
+		t.Errorf("expected -30s skew, got %v", updated.ClockSkewSeconds)
+	}
+	if entries, _ := loadAuditEntries("device.clock_skew", 10); len(entries) != 0 {
+		t.Errorf("expected no warning within the threshold, got %+v", entries)
+	}
+
+	// Drifting beyond the threshold warns, coming back and drifting again warns again
+	recordClockSkew(updated, now.Add(-5*time.Minute), now)
+	updated, _ = loadDevice(device.ID)
+	recordClockSkew(updated, now, now)
+	updated, _ = loadDevice(device.ID)
+	recordClockSkew(updated, now.Add(5*time.Minute), now)
+
+	if entries, _ := loadAuditEntries("device.clock_skew", 10); len(entries) != 2 {
+		t.Errorf("expected two warnings, got %+v", entries)
+	}
+}
+
+func TestHandleScan_RecordsClockSkew(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	deviceTime := time.Now().Add(-10 * time.Minute).Format(time.RFC3339)
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid":"TEST_UID_1","time":"`+deviceTime+`"}`))
+	req.Header.Set(deviceIDHeader, fmt.Sprint(device.ID))
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	updated, _ := loadDevice(device.ID)
+	if updated.ClockSkewSeconds == nil || *updated.ClockSkewSeconds > -590 {
+		t.Errorf("expected about -10 minutes of skew, got %v", updated.ClockSkewSeconds)
+	}
+}
@@ -0,0 +1,279 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Closures ---
+//
+// Closures (holidays, reading week) are ranges of days the office is
+// officially closed, managed under /closures. Days are those of the host's
+// report time zone (see reportLocation). On a closure day:
+//   - office opened and closed notifications are not posted to webhooks
+//     (counted in notifications_suppressed_total); /status/stream still gets them
+//   - daily scheduled reports do not run
+//   - /status/today names the closure
+//
+// Term reports count closure days separately, so low attendance during them
+// is not mistaken for members missing their hours.
+
+// Closure is a range of days [StartDate, EndDate] the office is closed
+type Closure struct {
+	ID        int64  `json:"id"`
+	Name      string `json:"name"`
+	StartDate string `json:"start_date"` // YYYY-MM-DD
+	EndDate   string `json:"end_date"`   // YYYY-MM-DD, inclusive
+}
+
+// closureColumns is the column list scanned by scanClosure
+const closureColumns = `id, name, start_date, end_date`
+
+// scanClosure reads a closure row selected with closureColumns
+func scanClosure(row rowScanner) (Closure, error) {
+	var c Closure
+	err := row.Scan(&c.ID, &c.Name, &c.StartDate, &c.EndDate)
+	return c, err
+}
+
+// loadClosures returns the closures overlapping the days [from, to] ("" for
+// no bound), ordered by start
+func loadClosures(from, to string) ([]Closure, error) {
+	query := `SELECT ` + closureColumns + ` FROM closures`
+	var conditions []string
+	var args []interface{}
+	if from != "" {
+		conditions = append(conditions, "end_date >= ?")
+		args = append(args, from)
+	}
+	if to != "" {
+		conditions = append(conditions, "start_date <= ?")
+		args = append(args, to)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY start_date, id"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	closures := []Closure{}
+	for rows.Next() {
+		c, err := scanClosure(rows)
+		if err != nil {
+			return nil, err
+		}
+		closures = append(closures, c)
+	}
+	return closures, rows.Err()
+}
+
+// closureDate returns the day of t in the host's report time zone
+func closureDate(t time.Time) string {
+	return t.In(reportLocation(defaultOrg)).Format(time.DateOnly)
+}
+
+// closureOn returns the closure covering the day of t, if any
+func closureOn(t time.Time) (Closure, bool, error) {
+	date := closureDate(t)
+	c, err := scanClosure(db.QueryRow(`SELECT `+closureColumns+` FROM closures
+		WHERE start_date <= ? AND end_date >= ? ORDER BY start_date LIMIT 1`, date, date))
+	if err == sql.ErrNoRows {
+		return Closure{}, false, nil
+	} else if err != nil {
+		return Closure{}, false, err
+	}
+	return c, true, nil
+}
+
+// closedOn reports whether the office is closed on the day of t, logging
+// errors and treating them as open
+func closedOn(t time.Time) (Closure, bool) {
+	c, closed, err := closureOn(t)
+	if err != nil {
+		log.Printf("Error querying closures: %v", err)
+	}
+	return c, closed
+}
+
+// closureDays returns the number of closure days within [from, to)
+func closureDays(from, to time.Time) (int, error) {
+	if !to.After(from) {
+		return 0, nil
+	}
+	first, last := closureDate(from), closureDate(to.Add(-time.Nanosecond))
+	closures, err := loadClosures(first, last)
+	if err != nil {
+		return 0, err
+	}
+
+	days := make(map[string]bool)
+	for _, c := range closures {
+		start, _ := time.Parse(time.DateOnly, max(c.StartDate, first))
+		end, _ := time.Parse(time.DateOnly, min(c.EndDate, last))
+		for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+			days[d.Format(time.DateOnly)] = true
+		}
+	}
+	return len(days), nil
+}
+
+// decodeClosure reads and validates a closure payload
+func decodeClosure(w http.ResponseWriter, r *http.Request) (Closure, bool) {
+	var req Closure
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return Closure{}, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || req.StartDate == "" {
+		http.Error(w, "name and start_date are required", http.StatusBadRequest)
+		return Closure{}, false
+	}
+	if req.EndDate == "" {
+		req.EndDate = req.StartDate
+	}
+	start, err := time.Parse(time.DateOnly, req.StartDate)
+	if err != nil {
+		http.Error(w, "Invalid 'start_date', expected YYYY-MM-DD", http.StatusBadRequest)
+		return Closure{}, false
+	}
+	end, err := time.Parse(time.DateOnly, req.EndDate)
+	if err != nil {
+		http.Error(w, "Invalid 'end_date', expected YYYY-MM-DD", http.StatusBadRequest)
+		return Closure{}, false
+	}
+	if end.Before(start) {
+		http.Error(w, "end_date must not be before start_date", http.StatusBadRequest)
+		return Closure{}, false
+	}
+	return req, true
+}
+
+// handleClosures supports GET to list closures and POST to create one
+// Query parameters (GET):
+//   - from, to: YYYY-MM-DD, only closures overlapping these days
+func handleClosures(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		from, to := r.URL.Query().Get("from"), r.URL.Query().Get("to")
+		for name, value := range map[string]string{"from": from, "to": to} {
+			if _, err := time.Parse(time.DateOnly, value); value != "" && err != nil {
+				http.Error(w, fmt.Sprintf("Invalid '%s' parameter, expected YYYY-MM-DD", name), http.StatusBadRequest)
+				return
+			}
+		}
+
+		closures, err := loadClosures(from, to)
+		if err != nil {
+			log.Printf("Error querying closures: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(closures)
+
+	case http.MethodPost:
+		req, ok := decodeClosure(w, r)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`INSERT INTO closures (name, start_date, end_date) VALUES (?, ?, ?)`, req.Name, req.StartDate, req.EndDate)
+		if err != nil {
+			log.Printf("Error inserting closure: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		req.ID, _ = res.LastInsertId()
+		recordAudit("closure.created", clientIP(r), fmt.Sprintf("%s (%s to %s)", req.Name, req.StartDate, req.EndDate))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleClosure handles /closures/{id} (GET, PUT, DELETE)
+func handleClosure(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/closures/")
+	if !ok {
+		http.Error(w, "Invalid closure ID", http.StatusBadRequest)
+		return
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		c, err := scanClosure(db.QueryRow(`SELECT `+closureColumns+` FROM closures WHERE id = ?`, id))
+		if err == sql.ErrNoRows {
+			http.Error(w, "Closure not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying closure: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c)
+
+	case http.MethodPut:
+		req, ok := decodeClosure(w, r)
+		if !ok {
+			return
+		}
+
+		result, err := db.Exec(`UPDATE closures SET name = ?, start_date = ?, end_date = ? WHERE id = ?`, req.Name, req.StartDate, req.EndDate, id)
+		if err != nil {
+			log.Printf("Error updating closure: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Closure not found", http.StatusNotFound)
+			return
+		}
+		req.ID = id
+		recordAudit("closure.updated", clientIP(r), fmt.Sprintf("%s (%s to %s)", req.Name, req.StartDate, req.EndDate))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+
+	case http.MethodDelete:
+		result, err := db.Exec(`DELETE FROM closures WHERE id = ?`, id)
+		if err != nil {
+			log.Printf("Error deleting closure: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Closure not found", http.StatusNotFound)
+			return
+		}
+		recordAudit("closure.deleted", clientIP(r), fmt.Sprintf("Closure %d", id))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Closure deleted successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
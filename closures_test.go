@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Closures Tests
+// ============================================================================
+
+// createClosure creates a closure through POST /closures
+func createClosure(t *testing.T, body string) Closure {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/closures", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handleClosures(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var c Closure
+	if err := json.Unmarshal(rr.Body.Bytes(), &c); err != nil {
+		t.Fatalf("failed to parse closure: %v", err)
+	}
+	return c
+}
+
+// closedToday creates a closure covering today
+func closedToday(t *testing.T) Closure {
+	t.Helper()
+	today := closureDate(time.Now())
+	return createClosure(t, `{"name":"Family Day","start_date":"`+today+`"}`)
+}
+
+func TestHandleClosures_CRUD(t *testing.T) {
+	setupTest()
+
+	c := createClosure(t, `{"name":"Reading week","start_date":"2026-02-14","end_date":"2026-02-22"}`)
+	holiday := createClosure(t, `{"name":"Family Day","start_date":"2026-02-16"}`)
+	if c.ID == 0 || holiday.EndDate != "2026-02-16" {
+		t.Errorf("expected a single-day closure to end on its start date, got %+v", holiday)
+	}
+
+	list := func(query string) []Closure {
+		req, _ := http.NewRequest("GET", "/closures"+query, nil)
+		rr := httptest.NewRecorder()
+		handleClosures(rr, req)
+		var closures []Closure
+		json.Unmarshal(rr.Body.Bytes(), &closures)
+		return closures
+	}
+	if got := list(""); len(got) != 2 || got[0].Name != "Reading week" {
+		t.Errorf("expected both closures by start, got %+v", got)
+	}
+	if got := list("?from=2026-02-17"); len(got) != 1 || got[0].ID != c.ID {
+		t.Errorf("expected only the reading week after the 17th, got %+v", got)
+	}
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/closures/%d", c.ID), strings.NewReader(`{"name":"Winter break","start_date":"2026-02-15","end_date":"2026-02-21"}`))
+	rr := httptest.NewRecorder()
+	handleClosure(rr, req)
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), "Winter break") {
+		t.Errorf("expected the closure updated, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/closures/%d", holiday.ID), nil)
+	rr = httptest.NewRecorder()
+	handleClosure(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK on delete, got %v", rr.Code)
+	}
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/closures/%d", holiday.ID), nil)
+	rr = httptest.NewRecorder()
+	handleClosure(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %v", rr.Code)
+	}
+
+	if entries, _ := loadAuditEntries("closure.created", 10); len(entries) != 2 {
+		t.Errorf("expected 2 audit entries, got %d", len(entries))
+	}
+}
+
+func TestHandleClosures_Invalid(t *testing.T) {
+	setupTest()
+
+	invalid := []string{
+		`{"start_date":"2026-02-16"}`,
+		`{"name":"Holiday"}`,
+		`{"name":"Holiday","start_date":"16/02/2026"}`,
+		`{"name":"Holiday","start_date":"2026-02-16","end_date":"2026-02-15"}`,
+	}
+	for _, body := range invalid {
+		req, _ := http.NewRequest("POST", "/closures", strings.NewReader(body))
+		rr := httptest.NewRecorder()
+		handleClosures(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", body, rr.Code)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/closures?from=tomorrow", nil)
+	rr := httptest.NewRecorder()
+	handleClosures(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid from, got %v", rr.Code)
+	}
+}
+
+func TestClosureDays(t *testing.T) {
+	setupTest()
+	createClosure(t, `{"name":"Reading week","start_date":"2026-02-14","end_date":"2026-02-22"}`)
+	createClosure(t, `{"name":"Family Day","start_date":"2026-02-16"}`)
+
+	from := time.Date(2026, 2, 20, 0, 0, 0, 0, time.Local)
+	to := time.Date(2026, 3, 1, 0, 0, 0, 0, time.Local)
+	if n, err := closureDays(from, to); err != nil || n != 3 {
+		t.Errorf("expected 3 closure days from the 20th, got %d (%v)", n, err)
+	}
+	// Overlapping closures count each day once
+	if n, _ := closureDays(from.AddDate(0, 0, -10), to); n != 9 {
+		t.Errorf("expected 9 closure days, got %d", n)
+	}
+}
+
+func TestOfficeNotifications_SuppressedOnClosures(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "OFFICE_WEBHOOK_URL")
+	closedToday(t)
+	alice := cachedMember("TEST_UID_1")
+
+	performSignIn(context.Background(), alice, "")
+	performSignOut(context.Background(), alice)
+
+	if messages := delivered(); len(messages) != 0 {
+		t.Errorf("expected no office notifications on a closure day, got %q", messages)
+	}
+}
+
+func TestHandleStatusToday_Closure(t *testing.T) {
+	setupTest()
+	if status := statusToday(t); status.Closure != nil {
+		t.Errorf("expected no closure, got %+v", status.Closure)
+	}
+
+	closedToday(t)
+	if status := statusToday(t); status.Closure == nil || status.Closure.Name != "Family Day" {
+		t.Errorf("expected today's closure, got %+v", status.Closure)
+	}
+}
+
+func TestRunDueReports_SkipsDailyOnClosures(t *testing.T) {
+	setupTest()
+	closedToday(t)
+
+	s := createTestReportSchedule(t, `{"name":"daily","report":"summary.pdf","schedule":"daily","hour":8,"target":"webhook","destination":"http://127.0.0.1:1/hook"}`)
+	db.Exec(`UPDATE report_schedules SET next_run_at = ? WHERE id = ?`, time.Now().Truncate(time.Second).Format(time.RFC3339), s.ID)
+
+	if err := runDueReports(time.Now()); err != nil {
+		t.Fatalf("runDueReports failed: %v", err)
+	}
+	jobs.wait()
+
+	if runs, _ := loadReportRuns(s.ID, 10); len(runs) != 0 {
+		t.Errorf("expected no run on a closure day, got %+v", runs)
+	}
+	// The run is skipped, not postponed
+	if s, _ = loadReportSchedule(s.ID); !s.NextRunAt.After(time.Now()) {
+		t.Errorf("expected next_run_at in the future, got %v", s.NextRunAt)
+	}
+}
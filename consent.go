@@ -0,0 +1,292 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// --- Member Consent ---
+//
+// Members acknowledge the club's data-processing notice before their name is
+// published. Every acknowledgement and withdrawal is kept as a record of the
+// notice version, when and how it was obtained (form, in_person, discord or
+// email) and who recorded it; a member's consent is their latest record.
+//
+// With CONSENT_VERSION set to the version of the current notice, members are
+// only named on public-facing views if their latest record acknowledges that
+// version. That covers non-admin ?view= responses, the wall display,
+// /presence, /events/poll, /status/stream, announcements and webhook
+// notifications. Others are still counted, as if they had opted out of
+// notifications. Without CONSENT_VERSION consent is recorded but not required.
+
+// How a consent record was obtained
+const (
+	consentMethodForm     = "form"
+	consentMethodInPerson = "in_person"
+	consentMethodDiscord  = "discord"
+	consentMethodEmail    = "email"
+)
+
+// consentVersionPattern is what a notice version may hold, e.g. 2025-09
+var consentVersionPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,32}$`)
+
+// ConsentRecord is an acknowledgement or withdrawal of consent
+type ConsentRecord struct {
+	ID         int64     `json:"id"`
+	Version    string    `json:"version,omitempty"` // Empty for a withdrawal
+	Method     string    `json:"method"`
+	RecordedBy string    `json:"recorded_by"`
+	Withdrawn  bool      `json:"withdrawn"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ConsentState is a member's consent to being named
+type ConsentState struct {
+	MemberID       int64           `json:"member_id"`
+	Required       bool            `json:"required"`                  // CONSENT_VERSION is set
+	CurrentVersion string          `json:"current_version,omitempty"` // CONSENT_VERSION
+	Named          bool            `json:"named"`                     // Whether public-facing views may name the member
+	Latest         *ConsentRecord  `json:"latest"`                    // Null if consent was never recorded
+	History        []ConsentRecord `json:"history,omitempty"`         // Oldest first, on /members/{id}/consent
+}
+
+// RecordConsentRequest is the payload of POST /members/{id}/consent
+type RecordConsentRequest struct {
+	Version   string `json:"version"` // Defaults to CONSENT_VERSION
+	Method    string `json:"method"`
+	Withdrawn bool   `json:"withdrawn"`
+}
+
+// loadConsentVersion returns CONSENT_VERSION, empty if consent is not required
+func loadConsentVersion() (string, error) {
+	version := strings.TrimSpace(os.Getenv("CONSENT_VERSION"))
+	if version != "" && !consentVersionPattern.MatchString(version) {
+		return "", fmt.Errorf("invalid version %q, expected up to 32 letters, digits, '.', '_' or '-'", version)
+	}
+	return version, nil
+}
+
+// knownConsentMethod reports whether method is a way consent is obtained
+func knownConsentMethod(method string) bool {
+	switch method {
+	case consentMethodForm, consentMethodInPerson, consentMethodDiscord, consentMethodEmail:
+		return true
+	}
+	return false
+}
+
+// loadConsentRecords returns a member's consent records, oldest first
+func loadConsentRecords(memberID int64) ([]ConsentRecord, error) {
+	rows, err := db.Query(`SELECT id, version, method, recorded_by, withdrawn, created_at FROM member_consents
+		WHERE member_id = ? ORDER BY id`, memberID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var records []ConsentRecord
+	for rows.Next() {
+		var c ConsentRecord
+		var createdAt string
+		if err := rows.Scan(&c.ID, &c.Version, &c.Method, &c.RecordedBy, &c.Withdrawn, &createdAt); err != nil {
+			return nil, err
+		}
+		if c.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		records = append(records, c)
+	}
+	return records, rows.Err()
+}
+
+// loadConsent returns a member's consent state, with its history if asked
+func loadConsent(memberID int64, history bool) (ConsentState, error) {
+	version, err := loadConsentVersion()
+	if err != nil {
+		return ConsentState{}, err
+	}
+	records, err := loadConsentRecords(memberID)
+	if err != nil {
+		return ConsentState{}, err
+	}
+
+	state := ConsentState{MemberID: memberID, Required: version != "", CurrentVersion: version, Named: version == ""}
+	if len(records) > 0 {
+		latest := records[len(records)-1]
+		state.Latest = &latest
+		state.Named = state.Named || (!latest.Withdrawn && latest.Version == version)
+	}
+	if history {
+		state.History = records
+	}
+	return state, nil
+}
+
+// nameConsented reports whether public-facing views may name a member: consent
+// is not required, or their latest record acknowledges CONSENT_VERSION
+func nameConsented(memberID int64) bool {
+	version, err := loadConsentVersion()
+	if err != nil {
+		// Not naming someone is the safe side
+		log.Printf("Error loading consent version: %v", err)
+		return false
+	}
+	if version == "" {
+		return true
+	}
+
+	var latest string
+	var withdrawn bool
+	err = db.QueryRow(`SELECT version, withdrawn FROM member_consents WHERE member_id = ? ORDER BY id DESC LIMIT 1`,
+		memberID).Scan(&latest, &withdrawn)
+	if err == sql.ErrNoRows {
+		return false
+	} else if err != nil {
+		log.Printf("Error querying consent of member %d: %v", memberID, err)
+		return false
+	}
+	return !withdrawn && latest == version
+}
+
+// nameable reports whether a member may be named in notifications: they did
+// not opt out and have consented to being named
+func nameable(memberID int64) bool {
+	return !notificationsOptedOut(memberID) && nameConsented(memberID)
+}
+
+// publicName returns a member's name as it should appear in a view: on
+// non-admin views the initials of the name they go by (see privacy.go), or
+// empty if they are hidden or have not consented to being named
+func publicName(member Member, view string) string {
+	if view == scopeAdmin {
+		return member.Name
+	}
+	if !nameConsented(member.ID) {
+		return ""
+	}
+	return redactName(privacyOf(member.ID).displayName(member.Name), view)
+}
+
+// publicNames remembers publicName per member while building a response
+type publicNames map[int64]string
+
+// of returns a member's name as it should appear in a view
+func (p publicNames) of(member Member, view string) string {
+	name, ok := p[member.ID]
+	if !ok {
+		name = publicName(member, view)
+		p[member.ID] = name
+	}
+	return name
+}
+
+// recordConsent appends a consent record for a member
+func recordConsent(memberID int64, version, method string, withdrawn bool, by string, now time.Time) error {
+	_, err := db.Exec(`INSERT INTO member_consents (member_id, version, method, recorded_by, withdrawn, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		memberID, version, method, by, withdrawn, now.Format(time.RFC3339))
+	return err
+}
+
+// writeConsent saves the consent record of a POST and responds with the
+// member's consent state. method overrides the request's method if set.
+func writeConsent(w http.ResponseWriter, r *http.Request, member Member, method string) {
+	status := http.StatusOK
+	if r.Method == http.MethodPost {
+		var req RecordConsentRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if method != "" {
+			req.Method = method
+		}
+		req.Method = strings.TrimSpace(req.Method)
+		req.Version = strings.TrimSpace(req.Version)
+		if !knownConsentMethod(req.Method) {
+			http.Error(w, "Invalid 'method', expected form, in_person, discord or email", http.StatusBadRequest)
+			return
+		}
+
+		if req.Withdrawn {
+			req.Version = ""
+		} else {
+			if req.Version == "" {
+				version, err := loadConsentVersion()
+				if err != nil {
+					log.Printf("Error loading consent version: %v", err)
+					http.Error(w, "Internal server error", http.StatusInternalServerError)
+					return
+				}
+				req.Version = version
+			}
+			if req.Version == "" {
+				http.Error(w, "'version' is required when CONSENT_VERSION is not set", http.StatusBadRequest)
+				return
+			}
+			if !consentVersionPattern.MatchString(req.Version) {
+				http.Error(w, "Invalid 'version', expected up to 32 letters, digits, '.', '_' or '-'", http.StatusBadRequest)
+				return
+			}
+		}
+
+		if err := recordConsent(member.ID, req.Version, req.Method, req.Withdrawn, clientIP(r), time.Now()); err != nil {
+			log.Printf("Error recording consent: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		renderedResponses.invalidate()
+		if req.Withdrawn {
+			recordAudit("member.consent_withdrawn", clientIP(r), fmt.Sprintf("Member %s (%d) method=%s", member.Name, member.ID, req.Method))
+		} else {
+			recordAudit("member.consent_recorded", clientIP(r), fmt.Sprintf("Member %s (%d) version=%s method=%s", member.Name, member.ID, req.Version, req.Method))
+		}
+		status = http.StatusCreated
+	}
+
+	state, err := loadConsent(member.ID, true)
+	if err != nil {
+		log.Printf("Error loading consent: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(state)
+}
+
+// handleMemberConsent handles GET and POST /members/{id}/consent
+func handleMemberConsent(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	member, found := findMemberByID(id)
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	writeConsent(w, r, member, "")
+}
+
+// handleMeConsent handles GET and POST of the calling member's consent,
+// acknowledged through the Discord bot
+func handleMeConsent(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+	writeConsent(w, r, member, consentMethodDiscord)
+}
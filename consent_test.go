@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Member Consent Tests
+// ============================================================================
+
+// memberRequest calls /members/{id} or one of its sub-resources
+func memberRequest(method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	return rr
+}
+
+// currentNames returns the names /current shows in a view
+func currentNames(t *testing.T, view string) map[int64]string {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/current?view="+view, nil)
+	rr := httptest.NewRecorder()
+	handleCurrent(rr, req)
+	var list []ActiveAttendee
+	if err := json.Unmarshal(rr.Body.Bytes(), &list); err != nil {
+		t.Fatalf("failed to parse response: %v; body=%s", err, rr.Body.String())
+	}
+	names := make(map[int64]string)
+	for _, a := range list {
+		names[a.MemberID] = a.Name
+	}
+	return names
+}
+
+func TestMemberConsent(t *testing.T) {
+	setupTest()
+
+	if rr := memberRequest("POST", "/members/1/consent", `{"method":"form"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a version or CONSENT_VERSION, got %v", rr.Code)
+	}
+	if rr := memberRequest("POST", "/members/1/consent", `{"version":"2025-09","method":"carrier pigeon"}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown method, got %v", rr.Code)
+	}
+	if rr := memberRequest("POST", "/members/1/consent", `{"version":"2025-09","method":"form"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr := memberRequest("GET", "/members/1", "")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var details MemberDetails
+	json.Unmarshal(rr.Body.Bytes(), &details)
+	if details.Name != "Alice" || details.Consent.Latest == nil || details.Consent.Latest.Version != "2025-09" ||
+		details.Consent.Latest.Method != consentMethodForm || details.Consent.Required || !details.Consent.Named {
+		t.Errorf("expected Alice with their consent, got %+v", details)
+	}
+
+	if rr := memberRequest("POST", "/members/1/consent", `{"method":"email","withdrawn":true}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var state ConsentState
+	json.Unmarshal(memberRequest("GET", "/members/1/consent", "").Body.Bytes(), &state)
+	if len(state.History) != 2 || !state.Latest.Withdrawn || state.History[0].Version != "2025-09" {
+		t.Errorf("expected the acknowledgement kept before the withdrawal, got %+v", state)
+	}
+
+	if entries, _ := loadAuditEntries("member.consent_", 10); len(entries) != 2 {
+		t.Errorf("expected both records audited, got %+v", entries)
+	}
+	if rr := memberRequest("GET", "/members/99", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown member, got %v", rr.Code)
+	}
+}
+
+func TestMemberConsent_RequiredForPublicNames(t *testing.T) {
+	setupTest()
+	t.Setenv("CONSENT_VERSION", "2025-09")
+
+	now := time.Now()
+	recordConsent(1, "2025-09", consentMethodInPerson, false, "test", now)
+	recordConsent(2, "2024-01", consentMethodForm, false, "test", now) // An older notice
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-10*time.Minute))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-5*time.Minute))
+
+	if names := currentNames(t, scopeMember); names[1] != "A." || names[2] != "" {
+		t.Errorf("expected only Alice named, got %v", names)
+	}
+	if names := currentNames(t, scopeAdmin); names[2] != "Bob" {
+		t.Errorf("expected the admin view unchanged, got %v", names)
+	}
+	if nameable(2) {
+		t.Error("expected Bob left out of notifications")
+	}
+
+	// Bob acknowledges the current notice through the Discord bot
+	req, _ := http.NewRequest("POST", "/me/consent", bytes.NewBufferString(`{}`))
+	req.Header.Set(discordIDHeader, "222222222")
+	rr := httptest.NewRecorder()
+	handleMeConsent(rr, req)
+	var state ConsentState
+	json.Unmarshal(rr.Body.Bytes(), &state)
+	if rr.Code != http.StatusCreated || !state.Named || state.Latest.Method != consentMethodDiscord {
+		t.Fatalf("expected Bob's consent recorded, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if names := currentNames(t, scopeMember); names[2] != "B." {
+		t.Errorf("expected Bob named once they consented, got %v", names)
+	}
+}
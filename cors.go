@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// --- CORS ---
+//
+// ALLOWED_ORIGINS is a comma-separated list of origins (scheme://host[:port])
+// or "*" for any origin. The middleware matches the request's Origin header
+// against the list and echoes back only the matching origin, since browsers
+// reject an Access-Control-Allow-Origin header containing several origins.
+// CORS_ALLOW_CREDENTIALS=true additionally allows cookies/Authorization to be
+// sent cross-origin; with "*" this echoes the caller's origin instead, because
+// browsers refuse credentialed responses with a wildcard origin.
+
+// corsConfig is the parsed CORS configuration
+type corsConfig struct {
+	AllowAll         bool
+	Origins          map[string]bool
+	AllowCredentials bool
+}
+
+// corsSettings holds the active CORS configuration (loaded at startup)
+var corsSettings = corsConfig{AllowAll: true}
+
+// normalizeOrigin validates an origin and returns it in canonical form
+func normalizeOrigin(origin string) (string, error) {
+	u, err := url.Parse(strings.TrimSuffix(origin, "/"))
+	if err != nil {
+		return "", err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("scheme must be http or https")
+	}
+	if u.Host == "" || u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return "", fmt.Errorf("origin must be scheme://host[:port]")
+	}
+	return strings.ToLower(u.Scheme + "://" + u.Host), nil
+}
+
+// parseCORSConfig parses an ALLOWED_ORIGINS value and credentials toggle
+func parseCORSConfig(origins string, allowCredentials bool) (corsConfig, error) {
+	cfg := corsConfig{Origins: make(map[string]bool), AllowCredentials: allowCredentials}
+
+	for _, origin := range strings.Split(origins, ",") {
+		origin = strings.TrimSpace(origin)
+		if origin == "" {
+			continue
+		}
+		if origin == "*" {
+			cfg.AllowAll = true
+			continue
+		}
+		normalized, err := normalizeOrigin(origin)
+		if err != nil {
+			return corsConfig{}, fmt.Errorf("invalid origin %q: %w", origin, err)
+		}
+		cfg.Origins[normalized] = true
+	}
+
+	// Default to any origin when nothing is configured
+	if len(cfg.Origins) == 0 {
+		cfg.AllowAll = true
+	}
+	return cfg, nil
+}
+
+// loadCORSConfig loads CORS settings from ALLOWED_ORIGINS and CORS_ALLOW_CREDENTIALS
+func loadCORSConfig() (corsConfig, error) {
+	return parseCORSConfig(os.Getenv("ALLOWED_ORIGINS"), os.Getenv("CORS_ALLOW_CREDENTIALS") == "true")
+}
+
+// allowedOrigin returns the value for Access-Control-Allow-Origin, or "" if the origin is not allowed
+func (c corsConfig) allowedOrigin(origin string) string {
+	if c.AllowAll {
+		if c.AllowCredentials && origin != "" {
+			return origin
+		}
+		return "*"
+	}
+	if origin == "" {
+		return ""
+	}
+	normalized, err := normalizeOrigin(origin)
+	if err != nil || !c.Origins[normalized] {
+		return ""
+	}
+	return origin
+}
+
+// defaultCORSMethods are advertised for routes registered without an explicit method list
+var defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete}
+
+// isHeaderToken reports whether s is a valid HTTP header field name
+func isHeaderToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || strings.ContainsRune("!#$%&'*+-.^_`|~", c)) {
+			return false
+		}
+	}
+	return true
+}
+
+// requestedHeaders parses Access-Control-Request-Headers, returning false if any name is malformed
+func requestedHeaders(value string) ([]string, bool) {
+	var headers []string
+	for _, h := range strings.Split(value, ",") {
+		h = strings.TrimSpace(h)
+		if h == "" {
+			continue
+		}
+		if !isHeaderToken(h) {
+			return nil, false
+		}
+		headers = append(headers, h)
+	}
+	return headers, true
+}
+
+// corsMiddleware adds CORS headers to allow cross-origin requests and answers
+// preflight requests for a route supporting the given methods (all common
+// methods when none are given)
+func corsMiddleware(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	allowMethods := strings.Join(append(append([]string{}, methods...), http.MethodOptions), ", ")
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := corsSettings
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// The response depends on the Origin header unless every origin gets "*",
+		// and preflight answers also depend on the requested method and headers
+		if !cfg.AllowAll || cfg.AllowCredentials {
+			w.Header().Add("Vary", "Origin")
+		}
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		allowed := cfg.allowedOrigin(r.Header.Get("Origin"))
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Origin", allowed)
+			if cfg.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+
+		if !preflight {
+			next(w, r)
+			return
+		}
+
+		// Preflight: only advertise what this route supports so the browser
+		// blocks anything else before sending the real request
+		if allowed != "" {
+			w.Header().Set("Access-Control-Allow-Methods", allowMethods)
+			if headers, ok := requestedHeaders(r.Header.Get("Access-Control-Request-Headers")); ok && len(headers) > 0 {
+				w.Header().Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+			}
+			w.Header().Set("Access-Control-Max-Age", "3600")
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
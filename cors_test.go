@@ -0,0 +1,227 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// CORS Middleware Tests
+// ============================================================================
+
+// corsRequest runs a request with the given Origin through the CORS middleware
+func corsRequest(method, origin string) *httptest.ResponseRecorder {
+	handler := corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(method, "/current", nil)
+	if origin != "" {
+		req.Header.Set("Origin", origin)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestParseCORSConfig_MultipleOrigins(t *testing.T) {
+	cfg, err := parseCORSConfig(" http://localhost:3000 , https://IEEE.example.com/ ", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if cfg.AllowAll {
+		t.Error("expected explicit origins, not allow-all")
+	}
+	if !cfg.Origins["http://localhost:3000"] || !cfg.Origins["https://ieee.example.com"] {
+		t.Errorf("expected both origins normalized, got %v", cfg.Origins)
+	}
+}
+
+func TestParseCORSConfig_DefaultsToAllowAll(t *testing.T) {
+	cfg, err := parseCORSConfig("", false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !cfg.AllowAll {
+		t.Error("expected allow-all when no origins are configured")
+	}
+}
+
+func TestParseCORSConfig_InvalidOrigins(t *testing.T) {
+	for _, value := range []string{"localhost:3000", "ftp://example.com", "https://example.com/app", "https://"} {
+		if _, err := parseCORSConfig(value, false); err == nil {
+			t.Errorf("expected error for %q", value)
+		}
+	}
+}
+
+func TestCORSMiddleware_EchoesMatchingOrigin(t *testing.T) {
+	setupTest()
+	corsSettings, _ = parseCORSConfig("http://localhost:3000,https://dashboard.example.com", false)
+
+	rr := corsRequest("GET", "https://dashboard.example.com")
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://dashboard.example.com" {
+		t.Errorf("expected matching origin to be echoed, got %q", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("expected Vary: Origin, got %q", got)
+	}
+}
+
+func TestCORSMiddleware_RejectsUnknownOrigin(t *testing.T) {
+	setupTest()
+	corsSettings, _ = parseCORSConfig("http://localhost:3000", false)
+
+	rr := corsRequest("GET", "https://evil.example.com")
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("expected no Access-Control-Allow-Origin, got %q", got)
+	}
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected request to still be served, got %v", rr.Code)
+	}
+}
+
+func TestCORSMiddleware_WildcardWithoutCredentials(t *testing.T) {
+	setupTest()
+
+	rr := corsRequest("GET", "https://anything.example.com")
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("expected wildcard origin, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("expected no credentials header, got %q", got)
+	}
+}
+
+func TestCORSMiddleware_CredentialsEchoOrigin(t *testing.T) {
+	setupTest()
+	corsSettings, _ = parseCORSConfig("*", true)
+
+	rr := corsRequest("GET", "https://dashboard.example.com")
+
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://dashboard.example.com" {
+		t.Errorf("expected origin to be echoed with credentials, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Credentials"); got != "true" {
+		t.Errorf("expected Access-Control-Allow-Credentials: true, got %q", got)
+	}
+	if got := rr.Header().Get("Vary"); got != "Origin" {
+		t.Errorf("expected Vary: Origin, got %q", got)
+	}
+}
+
+// ============================================================================
+// CORS Preflight Tests
+// ============================================================================
+
+// preflightRequest sends a preflight for the given method and headers to a route supporting methods
+func preflightRequest(origin, method, headers string, methods ...string) *httptest.ResponseRecorder {
+	handler := corsMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot) // must never be reached by a preflight
+	}, methods...)
+
+	req, _ := http.NewRequest("OPTIONS", "/members/1", nil)
+	req.Header.Set("Origin", origin)
+	req.Header.Set("Access-Control-Request-Method", method)
+	if headers != "" {
+		req.Header.Set("Access-Control-Request-Headers", headers)
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCORSPreflight_DashboardPutMember(t *testing.T) {
+	setupTest()
+	corsSettings, _ = parseCORSConfig("https://dashboard.example.com", false)
+
+	rr := preflightRequest("https://dashboard.example.com", "PUT", "content-type, x-api-key", "PUT", "DELETE")
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %v", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Origin"); got != "https://dashboard.example.com" {
+		t.Errorf("expected origin echoed, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "PUT, DELETE, OPTIONS" {
+		t.Errorf("expected route methods only, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "content-type, x-api-key" {
+		t.Errorf("expected requested headers echoed, got %q", got)
+	}
+	if got := rr.Header().Get("Access-Control-Max-Age"); got != "3600" {
+		t.Errorf("expected Access-Control-Max-Age: 3600, got %q", got)
+	}
+}
+
+func TestCORSPreflight_DashboardDeleteMember(t *testing.T) {
+	setupTest()
+	corsSettings, _ = parseCORSConfig("https://dashboard.example.com", false)
+
+	rr := preflightRequest("https://dashboard.example.com", "DELETE", "X-API-Key", "PUT", "DELETE")
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %v", rr.Code)
+	}
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "X-API-Key" {
+		t.Errorf("expected requested header echoed, got %q", got)
+	}
+}
+
+func TestCORSPreflight_VaryHeaders(t *testing.T) {
+	setupTest()
+	corsSettings, _ = parseCORSConfig("https://dashboard.example.com", false)
+
+	rr := preflightRequest("https://dashboard.example.com", "PUT", "content-type", "PUT")
+
+	vary := rr.Header().Values("Vary")
+	want := []string{"Origin", "Access-Control-Request-Method", "Access-Control-Request-Headers"}
+	if len(vary) != len(want) {
+		t.Fatalf("expected Vary %v, got %v", want, vary)
+	}
+	for i := range want {
+		if vary[i] != want[i] {
+			t.Errorf("expected Vary %v, got %v", want, vary)
+		}
+	}
+}
+
+func TestCORSPreflight_MalformedRequestedHeaders(t *testing.T) {
+	setupTest()
+
+	rr := preflightRequest("https://dashboard.example.com", "PUT", "content-type, bad header", "PUT")
+
+	if got := rr.Header().Get("Access-Control-Allow-Headers"); got != "" {
+		t.Errorf("expected malformed headers not to be echoed, got %q", got)
+	}
+}
+
+func TestCORSPreflight_DisallowedOrigin(t *testing.T) {
+	setupTest()
+	corsSettings, _ = parseCORSConfig("https://dashboard.example.com", false)
+
+	rr := preflightRequest("https://evil.example.com", "DELETE", "x-api-key", "PUT", "DELETE")
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %v", rr.Code)
+	}
+	for _, h := range []string{"Access-Control-Allow-Origin", "Access-Control-Allow-Methods", "Access-Control-Allow-Headers"} {
+		if got := rr.Header().Get(h); got != "" {
+			t.Errorf("expected no %s for disallowed origin, got %q", h, got)
+		}
+	}
+}
+
+func TestCORSPreflight_DefaultMethods(t *testing.T) {
+	setupTest()
+
+	rr := preflightRequest("https://dashboard.example.com", "GET", "")
+
+	if got := rr.Header().Get("Access-Control-Allow-Methods"); got != "GET, POST, PUT, DELETE, OPTIONS" {
+		t.Errorf("expected default methods, got %q", got)
+	}
+}
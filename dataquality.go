@@ -0,0 +1,176 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// --- Data Quality Report ---
+//
+// /admin/data-quality flags records that should be reviewed before official
+// reports are produced: sessions that are suspiciously long, sessions closed
+// by the nightly cleanup rather than a real sign-out, sessions of one member
+// that overlap, and scan attempts from devices that are not registered.
+
+// defaultMaxSessionHours is the session length above which sessions are flagged
+const defaultMaxSessionHours = 12
+
+// SuspectVisit is a visit flagged by the data quality report
+type SuspectVisit struct {
+	VisitID       int64     `json:"visit_id"`
+	MemberID      int64     `json:"member_id"`
+	Name          string    `json:"name"`
+	SignInTime    time.Time `json:"signin_time"`
+	SignOutTime   time.Time `json:"signout_time"`
+	DurationHours float64   `json:"duration_hours"`
+	OverlapsVisit int64     `json:"overlaps_visit_id,omitempty"` // Set for overlapping sessions
+}
+
+// DataQualityReport is the /admin/data-quality response
+type DataQualityReport struct {
+	GeneratedAt         time.Time      `json:"generated_at"`
+	MaxSessionHours     float64        `json:"max_session_hours"`
+	LongSessions        []SuspectVisit `json:"long_sessions"`
+	CleanupSessions     []SuspectVisit `json:"cleanup_sessions"`
+	OverlappingSessions []SuspectVisit `json:"overlapping_sessions"`
+	UnknownDeviceScans  []AuditEntry   `json:"unknown_device_scans"`
+	IssueCount          int            `json:"issue_count"`
+}
+
+// loadSuspectCandidates returns all visits starting in [from, to], ordered by member and sign-in time
+func loadSuspectCandidates(from, to time.Time) ([]SuspectVisit, error) {
+	rows, err := db.Query(`
+		SELECT v.id, v.member_id, m.name, v.signin_time, v.signout_time
+		FROM visits v
+		JOIN members m ON m.id = v.member_id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []SuspectVisit
+	for rows.Next() {
+		var v SuspectVisit
+		var signinTime, signoutTime string
+		if err := rows.Scan(&v.VisitID, &v.MemberID, &v.Name, &signinTime, &signoutTime); err != nil {
+			return nil, err
+		}
+		if v.SignInTime, err = time.Parse(time.RFC3339, signinTime); err != nil {
+			return nil, err
+		}
+		if v.SignOutTime, err = time.Parse(time.RFC3339, signoutTime); err != nil {
+			return nil, err
+		}
+		if (!from.IsZero() && v.SignInTime.Before(from)) || (!to.IsZero() && v.SignInTime.After(to)) {
+			continue
+		}
+		v.DurationHours = v.SignOutTime.Sub(v.SignInTime).Hours()
+		visits = append(visits, v)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(visits, func(i, j int) bool {
+		if visits[i].MemberID != visits[j].MemberID {
+			return visits[i].MemberID < visits[j].MemberID
+		}
+		return visits[i].SignInTime.Before(visits[j].SignInTime)
+	})
+	return visits, nil
+}
+
+// endedByCleanup reports whether a sign-out falls in the first minute of the nightly cleanup hour
+func endedByCleanup(signout time.Time) bool {
+	local := signout.Local()
+	return local.Hour() == nightlyCleanupHour && local.Minute() == 0
+}
+
+// handleDataQuality reports suspicious attendance records
+// Query parameters:
+//   - max_hours: flag sessions longer than this many hours (default 12)
+//   - term, from, to: restrict to sessions starting in this period
+func handleDataQuality(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	maxHours := float64(defaultMaxSessionHours)
+	if maxHoursStr := r.URL.Query().Get("max_hours"); maxHoursStr != "" {
+		if n, err := fmt.Sscanf(maxHoursStr, "%g", &maxHours); err != nil || n != 1 || maxHours <= 0 {
+			http.Error(w, "Invalid 'max_hours' parameter, expected positive number", http.StatusBadRequest)
+			return
+		}
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	visits, err := loadSuspectCandidates(from, to)
+	if err != nil {
+		log.Printf("Error loading visits for data quality report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	report := DataQualityReport{
+		GeneratedAt:         time.Now(),
+		MaxSessionHours:     maxHours,
+		LongSessions:        []SuspectVisit{},
+		CleanupSessions:     []SuspectVisit{},
+		OverlappingSessions: []SuspectVisit{},
+		UnknownDeviceScans:  []AuditEntry{},
+	}
+
+	// Visits are sorted by member and sign-in; track the latest-ending earlier
+	// visit of the same member to find overlaps
+	var previous *SuspectVisit
+	for i := range visits {
+		v := visits[i]
+		if v.DurationHours > maxHours {
+			report.LongSessions = append(report.LongSessions, v)
+		}
+		if endedByCleanup(v.SignOutTime) {
+			report.CleanupSessions = append(report.CleanupSessions, v)
+		}
+
+		if previous != nil && previous.MemberID != v.MemberID {
+			previous = nil
+		}
+		if previous != nil && v.SignInTime.Before(previous.SignOutTime) {
+			overlap := v
+			overlap.OverlapsVisit = previous.VisitID
+			report.OverlappingSessions = append(report.OverlappingSessions, overlap)
+		}
+		if previous == nil || v.SignOutTime.After(previous.SignOutTime) {
+			previous = &visits[i]
+		}
+	}
+
+	// Scan attempts with certificates not registered to any device
+	entries, err := loadAuditEntries("device.certificate.rejected", 0)
+	if err != nil {
+		log.Printf("Error loading audit entries for data quality report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	for _, e := range entries {
+		if (!from.IsZero() && e.Time.Before(from)) || (!to.IsZero() && e.Time.After(to)) {
+			continue
+		}
+		report.UnknownDeviceScans = append(report.UnknownDeviceScans, e)
+	}
+
+	report.IssueCount = len(report.LongSessions) + len(report.CleanupSessions) +
+		len(report.OverlappingSessions) + len(report.UnknownDeviceScans)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /admin/data-quality Endpoint Tests
+// ============================================================================
+
+func dataQuality(t *testing.T, query string) DataQualityReport {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", "/admin/data-quality"+query, nil)
+	rr := httptest.NewRecorder()
+
+	handleDataQuality(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var report DataQualityReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return report
+}
+
+func TestHandleDataQuality_Clean(t *testing.T) {
+	setupTest()
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, day.Add(10*time.Hour), day.Add(12*time.Hour))
+	saveVisitToDB(1, day.Add(13*time.Hour), day.Add(14*time.Hour))
+	saveVisitToDB(2, day.Add(11*time.Hour), day.Add(13*time.Hour))
+
+	report := dataQuality(t, "")
+	if report.IssueCount != 0 {
+		t.Errorf("expected no issues, got %+v", report)
+	}
+	if report.MaxSessionHours != defaultMaxSessionHours {
+		t.Errorf("expected default max hours, got %v", report.MaxSessionHours)
+	}
+}
+
+func TestHandleDataQuality_FlagsSuspiciousSessions(t *testing.T) {
+	setupTest()
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	// Left open overnight and closed by the cleanup: long and at cleanup time
+	saveVisitToDB(1, day.Add(9*time.Hour), day.Add(24*time.Hour+nightlyCleanupHour*time.Hour))
+	// Overlaps the session above
+	saveVisitToDB(1, day.Add(15*time.Hour), day.Add(16*time.Hour))
+	// Bob is fine
+	saveVisitToDB(2, day.Add(15*time.Hour), day.Add(16*time.Hour))
+
+	report := dataQuality(t, "")
+	if len(report.LongSessions) != 1 || report.LongSessions[0].Name != "Alice" {
+		t.Errorf("expected Alice's long session, got %+v", report.LongSessions)
+	}
+	if len(report.CleanupSessions) != 1 {
+		t.Errorf("expected one cleanup session, got %+v", report.CleanupSessions)
+	}
+	if len(report.OverlappingSessions) != 1 || report.OverlappingSessions[0].OverlapsVisit != report.LongSessions[0].VisitID {
+		t.Errorf("expected the second session to overlap the long one, got %+v", report.OverlappingSessions)
+	}
+	if report.IssueCount != 3 {
+		t.Errorf("expected 3 issues, got %d", report.IssueCount)
+	}
+
+	// A higher threshold no longer flags the long session
+	report = dataQuality(t, "?max_hours=24")
+	if len(report.LongSessions) != 0 {
+		t.Errorf("expected no long sessions above 24h, got %+v", report.LongSessions)
+	}
+}
+
+func TestHandleDataQuality_UnknownDeviceScans(t *testing.T) {
+	setupTest()
+
+	recordAudit("device.certificate.rejected", "10.0.0.9", "fingerprint=abc")
+	recordAudit("network.rejected", "10.0.0.9", "POST /scan")
+
+	report := dataQuality(t, "")
+	if len(report.UnknownDeviceScans) != 1 || report.UnknownDeviceScans[0].Actor != "10.0.0.9" {
+		t.Errorf("expected one unknown device scan, got %+v", report.UnknownDeviceScans)
+	}
+}
+
+func TestHandleDataQuality_InvalidMaxHours(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/admin/data-quality?max_hours=-1", nil)
+	rr := httptest.NewRecorder()
+
+	handleDataQuality(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
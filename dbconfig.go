@@ -0,0 +1,126 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Database Connections ---
+//
+// database/sql keeps a pool of SQLite connections, and PRAGMAs such as
+// busy_timeout and foreign_keys only apply to the connection they run on.
+// They are therefore set in the DSN, so every connection of the pool gets
+// them; running them once after opening left the other connections failing
+// with "database is locked" as soon as a scan and the dashboard wrote at the
+// same time.
+//
+// SQLite allows a single writer. Writes are not queued: each connection
+// retries taking the write lock for up to DB_BUSY_TIMEOUT, then fails with
+// "database is locked". Transactions begin IMMEDIATE, taking the lock up
+// front, so they retry like single statements instead of failing at once when
+// a read transaction upgrades to a write. Read-only transactions (the export)
+// stay deferred.
+//
+// Pool settings:
+//   - DB_MAX_OPEN_CONNS: most open connections (default 8)
+//   - DB_MAX_IDLE_CONNS: most idle connections kept open (default 2)
+//   - DB_CONN_MAX_LIFETIME: close connections older than this (Go duration, default never)
+//   - DB_BUSY_TIMEOUT: how long a writer waits for the lock (Go duration, default 5s)
+//   - DB_SYNCHRONOUS: OFF, NORMAL, FULL (default) or EXTRA, see SQLite's PRAGMA synchronous
+
+// DBConfig holds the SQLite connection settings
+type DBConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration // 0 keeps connections forever
+	BusyTimeout     time.Duration
+	Synchronous     string
+}
+
+// dbConfig is used by initDB
+var dbConfig = defaultDBConfig()
+
+// defaultDBConfig returns the connection settings used without configuration
+func defaultDBConfig() DBConfig {
+	return DBConfig{
+		MaxOpenConns: 8,
+		MaxIdleConns: 2,
+		BusyTimeout:  5 * time.Second,
+		Synchronous:  "FULL",
+	}
+}
+
+// loadDBConfig reads the DB_* connection settings
+func loadDBConfig() (DBConfig, error) {
+	cfg := defaultDBConfig()
+
+	for _, setting := range []struct {
+		name  string
+		value *int
+	}{
+		{"DB_MAX_OPEN_CONNS", &cfg.MaxOpenConns},
+		{"DB_MAX_IDLE_CONNS", &cfg.MaxIdleConns},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < 1 {
+				return cfg, fmt.Errorf("%s must be a positive number, got %q", setting.name, value)
+			}
+			*setting.value = n
+		}
+	}
+	if cfg.MaxIdleConns > cfg.MaxOpenConns {
+		return cfg, fmt.Errorf("DB_MAX_IDLE_CONNS (%d) exceeds DB_MAX_OPEN_CONNS (%d)", cfg.MaxIdleConns, cfg.MaxOpenConns)
+	}
+
+	if value := os.Getenv("DB_CONN_MAX_LIFETIME"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return cfg, fmt.Errorf("DB_CONN_MAX_LIFETIME: invalid duration %q", value)
+		}
+		cfg.ConnMaxLifetime = d
+	}
+	if value := os.Getenv("DB_BUSY_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < time.Millisecond {
+			return cfg, fmt.Errorf("DB_BUSY_TIMEOUT: invalid duration %q", value)
+		}
+		cfg.BusyTimeout = d
+	}
+	if value := os.Getenv("DB_SYNCHRONOUS"); value != "" {
+		switch mode := strings.ToUpper(value); mode {
+		case "OFF", "NORMAL", "FULL", "EXTRA":
+			cfg.Synchronous = mode
+		default:
+			return cfg, fmt.Errorf("DB_SYNCHRONOUS must be OFF, NORMAL, FULL or EXTRA, got %q", value)
+		}
+	}
+	return cfg, nil
+}
+
+// dsn returns the data source name opening path with the configured PRAGMAs
+func (c DBConfig) dsn(path string) string {
+	q := url.Values{}
+	q.Add("_pragma", fmt.Sprintf("busy_timeout(%d)", c.BusyTimeout.Milliseconds()))
+	q.Add("_pragma", "foreign_keys(1)")
+	q.Add("_pragma", "synchronous("+c.Synchronous+")")
+	q.Set("_txlock", "immediate")
+	return "file:" + path + "?" + q.Encode()
+}
+
+// openDB opens the database at path with the connection settings
+func (c DBConfig) openDB(path string) (*sql.DB, error) {
+	conn, err := sql.Open("sqlite", c.dsn(path))
+	if err != nil {
+		return nil, err
+	}
+	conn.SetMaxOpenConns(c.MaxOpenConns)
+	conn.SetMaxIdleConns(c.MaxIdleConns)
+	conn.SetConnMaxLifetime(c.ConnMaxLifetime)
+	return conn, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Database Connection Tests
+// ============================================================================
+
+func TestLoadDBConfig(t *testing.T) {
+	for _, name := range []string{"DB_MAX_OPEN_CONNS", "DB_MAX_IDLE_CONNS", "DB_CONN_MAX_LIFETIME", "DB_BUSY_TIMEOUT", "DB_SYNCHRONOUS"} {
+		t.Setenv(name, "")
+	}
+	if cfg, err := loadDBConfig(); err != nil || cfg != defaultDBConfig() {
+		t.Errorf("expected the defaults, got %+v (err %v)", cfg, err)
+	}
+
+	t.Setenv("DB_MAX_OPEN_CONNS", "4")
+	t.Setenv("DB_BUSY_TIMEOUT", "10s")
+	t.Setenv("DB_SYNCHRONOUS", "normal")
+	cfg, err := loadDBConfig()
+	if err != nil || cfg.MaxOpenConns != 4 || cfg.BusyTimeout != 10*time.Second || cfg.Synchronous != "NORMAL" {
+		t.Errorf("unexpected config %+v (err %v)", cfg, err)
+	}
+
+	for name, value := range map[string]string{
+		"DB_MAX_IDLE_CONNS":    "5", // More than the 4 open connections
+		"DB_CONN_MAX_LIFETIME": "forever",
+		"DB_SYNCHRONOUS":       "sometimes",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := loadDBConfig(); err == nil {
+				t.Errorf("expected an error for %s=%s", name, value)
+			}
+		})
+	}
+}
+
+func TestOpenDB_PragmasOnEveryConnection(t *testing.T) {
+	cfg := defaultDBConfig()
+	cfg.BusyTimeout = 1500 * time.Millisecond
+	conn, err := cfg.openDB(filepath.Join(t.TempDir(), "attendance.db"))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer conn.Close()
+
+	// Hold two connections at once so the second is a fresh one
+	ctx := context.Background()
+	for i := 0; i < 2; i++ {
+		c, err := conn.Conn(ctx)
+		if err != nil {
+			t.Fatalf("failed to get a connection: %v", err)
+		}
+		defer c.Close()
+
+		var timeout, foreignKeys, synchronous int
+		c.QueryRowContext(ctx, `PRAGMA busy_timeout`).Scan(&timeout)
+		c.QueryRowContext(ctx, `PRAGMA foreign_keys`).Scan(&foreignKeys)
+		c.QueryRowContext(ctx, `PRAGMA synchronous`).Scan(&synchronous)
+		if timeout != 1500 || foreignKeys != 1 || synchronous != 2 {
+			t.Errorf("connection %d: busy_timeout=%d foreign_keys=%d synchronous=%d", i, timeout, foreignKeys, synchronous)
+		}
+	}
+}
+
+func TestOpenDB_ConcurrentWriters(t *testing.T) {
+	conn, err := defaultDBConfig().openDB(filepath.Join(t.TempDir(), "attendance.db"))
+	if err != nil {
+		t.Fatalf("failed to open: %v", err)
+	}
+	defer conn.Close()
+	conn.Exec(`PRAGMA journal_mode = WAL`)
+	conn.Exec(`CREATE TABLE scans (n INTEGER)`)
+
+	// Transactions reading before they write used to fail with "database is locked"
+	errs := make(chan error, 20)
+	for i := 0; i < 20; i++ {
+		go func(n int) {
+			tx, err := conn.Begin()
+			if err != nil {
+				errs <- err
+				return
+			}
+			var count int
+			tx.QueryRow(`SELECT COUNT(*) FROM scans`).Scan(&count)
+			if _, err := tx.Exec(`INSERT INTO scans (n) VALUES (?)`, n); err != nil {
+				tx.Rollback()
+				errs <- err
+				return
+			}
+			errs <- tx.Commit()
+		}(i)
+	}
+	for i := 0; i < 20; i++ {
+		if err := <-errs; err != nil {
+			t.Errorf("concurrent write failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Debug Logging ---
+//
+// At the debug log level, the requests to the selected routes are logged with
+// their headers and bodies and those of their responses, to diagnose
+// malformed payloads from new scanner firmware. Secrets and personal data are
+// redacted before logging:
+//   - headers carrying credentials (X-API-Key, Authorization, cookies)
+//   - query parameters and JSON fields with sensitive names (tokens, keys,
+//     names, Discord IDs, emails...); card UIDs keep their last 4 characters
+//   - bodies that are neither JSON nor plain text (CSV imports, firmware
+//     images) are summarized by type and size
+//
+// Invalid JSON is still logged, with the values of sensitive fields removed,
+// since it is what needs diagnosing. Bodies are cut at debugBodyLimit.
+//
+// Requests are logged this way while the http subsystem is at the debug level
+// (see logging.go), for the routes in LOG_DEBUG_ROUTES (path prefixes
+// separated by commas, all routes if empty).
+
+const (
+	// Most bytes of a request or response body logged
+	debugBodyLimit = 16 << 10
+
+	redactedValue = "[REDACTED]"
+)
+
+var (
+	// sensitiveFields are JSON fields and query parameters never logged
+	sensitiveFields = map[string]bool{
+		"name": true, "discord_id": true, "email": true, "phone": true,
+		"token": true, "kiosk_token": true, "api_key": true, "key": true, "secret": true, "password": true,
+		"webhook_url": true, "url": true, "code": true, "signature": true,
+		"message": true, "announcement": true, // Greetings name the member
+	}
+
+	// uidFields are JSON fields and query parameters holding card UIDs
+	uidFields = map[string]bool{"uid": true, "card_uid": true}
+
+	// sensitiveHeaders are request and response headers never logged
+	sensitiveHeaders = map[string]bool{
+		"X-Api-Key": true, "Authorization": true, "Cookie": true, "Set-Cookie": true,
+		"X-Kiosk-Token": true, "Proxy-Authorization": true,
+	}
+
+	// jsonField matches "field": value pairs, to redact invalid JSON: quoted
+	// values, including one cut by the end of the body, or bare values
+	jsonField = regexp.MustCompile(`"([A-Za-z_]+)"\s*:\s*(?:"((?:[^"\\]|\\.)*)(?:"|$)|([^\s,}\]]+))`)
+)
+
+// debugLogged reports whether a request is logged with its bodies
+func debugLogged(path string, now time.Time) bool {
+	l := currentLogLevel(now)
+	if l.level(logHTTP) != logLevelDebug {
+		return false
+	}
+	if len(l.Routes) == 0 {
+		return true
+	}
+	for _, route := range l.Routes {
+		if strings.HasPrefix(path, route) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactUID keeps the last characters of a card UID, enough to tell cards apart
+func redactUID(value interface{}) interface{} {
+	if s, ok := value.(string); ok {
+		return maskUID(s)
+	}
+	return redactedValue
+}
+
+// redactJSON replaces sensitive values of a decoded JSON document
+func redactJSON(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			switch lower := strings.ToLower(key); {
+			case uidFields[lower]:
+				v[key] = redactUID(field)
+			case sensitiveFields[lower]:
+				v[key] = redactedValue
+			default:
+				v[key] = redactJSON(field)
+			}
+		}
+	case []interface{}:
+		for i := range v {
+			v[i] = redactJSON(v[i])
+		}
+	}
+	return value
+}
+
+// redactBody returns a loggable form of a body
+func redactBody(body []byte, contentType string, truncated bool) string {
+	if len(body) == 0 {
+		return "(empty)"
+	}
+	suffix := ""
+	if truncated {
+		suffix = fmt.Sprintf(" (cut at %d bytes)", debugBodyLimit)
+	}
+
+	mediaType := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json") ||
+		(mediaType == "" || mediaType == "text/plain") && json.Valid(body):
+		var doc interface{}
+		if !truncated && json.Unmarshal(body, &doc) == nil {
+			out, _ := json.Marshal(redactJSON(doc))
+			return string(out)
+		}
+		// Malformed (or cut) JSON, as sent: only the sensitive values are removed
+		return fmt.Sprintf("%q", redactJSONText(body)) + suffix
+
+	case mediaType == "text/plain":
+		return fmt.Sprintf("%q", redactJSONText(body)) + suffix
+
+	default:
+		return fmt.Sprintf("[%d bytes of %s]", len(body), mediaType)
+	}
+}
+
+// redactJSONText removes the values of sensitive "field": value pairs from
+// text that may not be valid JSON
+func redactJSONText(body []byte) string {
+	return jsonField.ReplaceAllStringFunc(string(body), func(pair string) string {
+		m := jsonField.FindStringSubmatch(pair)
+		switch lower := strings.ToLower(m[1]); {
+		case uidFields[lower]:
+			return fmt.Sprintf("%q: %q", m[1], maskUID(m[2]+m[3]))
+		case sensitiveFields[lower]:
+			return fmt.Sprintf("%q: %q", m[1], redactedValue)
+		}
+		return pair
+	})
+}
+
+// redactQuery returns the query string with sensitive parameters redacted
+func redactQuery(query url.Values) string {
+	if len(query) == 0 {
+		return ""
+	}
+	out := url.Values{}
+	for key, values := range query {
+		for _, value := range values {
+			switch lower := strings.ToLower(key); {
+			case uidFields[lower]:
+				value = maskUID(value)
+			case sensitiveFields[lower]:
+				value = redactedValue
+			}
+			out.Add(key, value)
+		}
+	}
+	return "?" + out.Encode()
+}
+
+// redactHeaders formats headers with credentials redacted
+func redactHeaders(header http.Header) string {
+	parts := make([]string, 0, len(header))
+	for key, values := range header {
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[http.CanonicalHeaderKey(key)] {
+			value = redactedValue
+		}
+		parts = append(parts, key+"="+value)
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, " ")
+}
+
+// bodyRecorder keeps the beginning of a response body
+type bodyRecorder struct {
+	http.ResponseWriter
+	status    int
+	body      bytes.Buffer
+	truncated bool
+}
+
+func (b *bodyRecorder) WriteHeader(status int) {
+	if b.status == 0 {
+		b.status = status
+	}
+	b.ResponseWriter.WriteHeader(status)
+}
+
+func (b *bodyRecorder) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	if room := debugBodyLimit - b.body.Len(); room < len(p) {
+		b.body.Write(p[:max(room, 0)])
+		b.truncated = true
+	} else {
+		b.body.Write(p)
+	}
+	return b.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses working
+func (b *bodyRecorder) Flush() {
+	if flusher, ok := b.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (b *bodyRecorder) Unwrap() http.ResponseWriter {
+	return b.ResponseWriter
+}
+
+// debugLogMiddleware logs the requests of the debug routes with their
+// redacted headers and bodies and those of their responses
+func debugLogMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		if !debugLogged(r.URL.Path, start) {
+			next(w, r)
+			return
+		}
+
+		var reqBody []byte
+		reqTruncated := false
+		if r.Body != nil {
+			// Read one byte more than logged to tell whether the body was cut,
+			// then hand the handler the whole body
+			reqBody, _ = io.ReadAll(io.LimitReader(r.Body, debugBodyLimit+1))
+			r.Body = readCloser{io.MultiReader(bytes.NewReader(reqBody), r.Body), r.Body}
+			if len(reqBody) > debugBodyLimit {
+				reqBody, reqTruncated = reqBody[:debugBodyLimit], true
+			}
+		}
+
+		rec := &bodyRecorder{ResponseWriter: w}
+		next(rec, r)
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+
+		log.Printf("Debug: %s %s%s from %s -> %d in %s\n  request headers: %s\n  request body: %s\n  response headers: %s\n  response body: %s",
+			r.Method, r.URL.Path, redactQuery(r.URL.Query()), clientIP(r), rec.status, time.Since(start).Round(time.Microsecond),
+			redactHeaders(r.Header), redactBody(reqBody, r.Header.Get("Content-Type"), reqTruncated),
+			redactHeaders(rec.Header()), redactBody(rec.body.Bytes(), rec.Header().Get("Content-Type"), rec.truncated))
+	}
+}
+
+// readCloser reads from a reader and closes the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
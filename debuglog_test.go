@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// Debug Logging Tests
+// ============================================================================
+
+// captureLog returns the log output written during a test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	t.Cleanup(func() { log.SetOutput(os.Stderr) })
+	return &buf
+}
+
+// setLogLevel calls PUT /admin/log-level
+func setLogLevel(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	handleLogLevel(rr, httptest.NewRequest("PUT", "/admin/log-level", strings.NewReader(body)))
+	return rr
+}
+
+// debugScan sends a scan through the debug logging middleware
+func debugScan(body, contentType string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/scan?token=kiosk-secret", strings.NewReader(body))
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-API-Key", "scanner-secret")
+	rr := httptest.NewRecorder()
+	debugLogMiddleware(handleScan)(rr, req)
+	return rr
+}
+
+func TestDebugLog_RedactsScan(t *testing.T) {
+	setupTest()
+	if rr := setLogLevel(t, `{"level": "debug", "routes": ["/scan"]}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 setting the level, got %v %s", rr.Code, rr.Body.String())
+	}
+	logs := captureLog(t)
+
+	if rr := debugScan(`{"uid": "TEST_UID_1", "room": "lab"}`, "application/json"); rr.Code != http.StatusOK {
+		t.Fatalf("expected the scan to go through, got %v", rr.Code)
+	}
+
+	// The usual "Welcome, Alice!" line is not part of the debug log
+	out := logs.String()[strings.Index(logs.String(), "Debug:"):]
+	for _, secret := range []string{"TEST_UID_1", "scanner-secret", "kiosk-secret", "Alice"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q redacted, got %s", secret, out)
+		}
+	}
+	for _, want := range []string{"Debug: POST /scan", `"uid":"******ID_1"`, `"room":"lab"`, "-> 200", `"status":"in"`} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q in the log, got %s", want, out)
+		}
+	}
+}
+
+func TestDebugLog_RedactsKioskToken(t *testing.T) {
+	setupTest()
+	setLogLevel(t, `{"level": "debug", "routes": ["/scan"]}`)
+	logs := captureLog(t)
+
+	req := httptest.NewRequest("POST", "/scan?kiosk_token=kiosk-secret", strings.NewReader(`{"uid": "TEST_UID_1"}`))
+	req.Header.Set("Content-Type", "application/json")
+	debugLogMiddleware(handleScan)(httptest.NewRecorder(), req)
+
+	out := logs.String()
+	if strings.Contains(out, "kiosk-secret") || !strings.Contains(out, "kiosk_token="+url.QueryEscape(redactedValue)) {
+		t.Errorf("expected the kiosk token redacted, got %s", out)
+	}
+}
+
+func TestDebugLog_MalformedPayload(t *testing.T) {
+	setupTest()
+	setLogLevel(t, `{"level": "debug"}`)
+	logs := captureLog(t)
+
+	// What new firmware might send: a bare value and a cut string
+	debugScan(`{"uid": "TEST_UID_1", "discord_id": 111111111, "name": "Ali`, "application/json")
+
+	out := logs.String()
+	for _, secret := range []string{"TEST_UID_1", "111111111", "Ali\\"} {
+		if strings.Contains(out, secret) {
+			t.Errorf("expected %q redacted, got %s", secret, out)
+		}
+	}
+	if !strings.Contains(out, "-> 400") || !strings.Contains(out, `\"discord_id\": \"[REDACTED]\"`) {
+		t.Errorf("expected the malformed body logged with its values redacted, got %s", out)
+	}
+}
+
+func TestDebugLog_OtherRoutesAndLevels(t *testing.T) {
+	setupTest()
+	logs := captureLog(t)
+
+	debugScan(`{"uid": "TEST_UID_1"}`, "application/json")
+	if strings.Contains(logs.String(), "Debug:") {
+		t.Error("expected nothing logged at the info level")
+	}
+
+	setLogLevel(t, `{"level": "debug", "routes": ["/checkin"]}`)
+	debugScan(`{"uid": "TEST_UID_1"}`, "application/json")
+	if strings.Contains(logs.String(), "Debug:") {
+		t.Error("expected only the selected routes logged")
+	}
+
+	// CSV imports hold personal data and are only summarized
+	if got := redactBody([]byte("name,uid\nAlice,TEST_UID_1\n"), "text/csv", false); got != "[26 bytes of text/csv]" {
+		t.Errorf("expected the CSV summarized, got %s", got)
+	}
+}
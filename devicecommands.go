@@ -0,0 +1,520 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Device Commands ---
+//
+// Admins queue commands for a scanner instead of walking over to it:
+//   - POST /devices/{id}/commands queues one: reboot, show_message (payload
+//     {"text", "seconds"}), enroll (enrollment mode, payload {"seconds"}) or
+//     update_config (the device's current config is sent along)
+//   - GET /devices/{id}/commands lists them, newest first
+//
+// Scanners keep a WebSocket open on GET /devices/{id}/channel (see
+// websocket.go). Queued commands are pushed as soon as the device is
+// connected, as {"id", "command", "payload"} text messages, and the device
+// answers {"ack": id, "ok": true} or {"ack": id, "ok": false, "error": "..."}.
+// A reboot is sent at most once, so it is never repeated because an
+// acknowledgment was lost. Other commands left unacknowledged are sent again
+// when the device reconnects, since they may have been written to a
+// connection that had already dropped. Commands not sent before their ttl
+// (default 1h) expire. The server pings connected devices every
+// deviceChannelPing.
+
+const (
+	commandReboot       = "reboot"
+	commandShowMessage  = "show_message"
+	commandEnroll       = "enroll"
+	commandUpdateConfig = "update_config"
+
+	commandQueued  = "queued"
+	commandSent    = "sent"
+	commandAcked   = "acked"
+	commandFailed  = "failed" // The device reported an error
+	commandExpired = "expired"
+
+	defaultCommandTTL = time.Hour
+	maxCommandTTL     = 24 * time.Hour
+	deviceChannelPing = 30 * time.Second
+
+	maxShowMessageLength = 200
+)
+
+// DeviceCommand is a command queued for a device
+type DeviceCommand struct {
+	ID        int64           `json:"id"`
+	DeviceID  int64           `json:"device_id"`
+	Command   string          `json:"command"`
+	Payload   json.RawMessage `json:"payload,omitempty"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"` // Reported by the device
+	CreatedAt time.Time       `json:"created_at"`
+	ExpiresAt time.Time       `json:"expires_at"`
+	SentAt    *time.Time      `json:"sent_at,omitempty"`
+	AckedAt   *time.Time      `json:"acked_at,omitempty"`
+}
+
+// DeviceCommandRequest is the body of POST /devices/{id}/commands
+type DeviceCommandRequest struct {
+	Command string          `json:"command"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+	TTL     string          `json:"ttl,omitempty"` // Go duration, default 1h, at most 24h
+}
+
+// commandPayload is the payload of show_message and enroll
+type commandPayload struct {
+	Text    string `json:"text,omitempty"`
+	Seconds int    `json:"seconds,omitempty"`
+}
+
+// validateCommand checks a command and returns its payload with defaults filled in
+func validateCommand(command string, raw json.RawMessage) (json.RawMessage, error) {
+	var p commandPayload
+	if len(raw) > 0 && string(raw) != "null" {
+		if err := json.Unmarshal(raw, &p); err != nil {
+			return nil, fmt.Errorf("invalid payload: %v", err)
+		}
+	}
+
+	switch command {
+	case commandReboot, commandUpdateConfig:
+		return nil, nil
+	case commandShowMessage:
+		p.Text = strings.TrimSpace(p.Text)
+		if p.Text == "" || len(p.Text) > maxShowMessageLength {
+			return nil, fmt.Errorf("show_message needs a text of 1 to %d characters", maxShowMessageLength)
+		}
+		if p.Seconds == 0 {
+			p.Seconds = 10
+		}
+		if p.Seconds < 1 || p.Seconds > 3600 {
+			return nil, fmt.Errorf("seconds must be between 1 and 3600")
+		}
+	case commandEnroll:
+		p.Text = ""
+		if p.Seconds == 0 {
+			p.Seconds = 60
+		}
+		if p.Seconds < 1 || p.Seconds > 600 {
+			return nil, fmt.Errorf("seconds must be between 1 and 600")
+		}
+	default:
+		return nil, fmt.Errorf("unknown command %q, expected reboot, show_message, enroll or update_config", command)
+	}
+	payload, _ := json.Marshal(p)
+	return payload, nil
+}
+
+// queueDeviceCommand stores a command and wakes the device's channel
+func queueDeviceCommand(deviceID int64, command string, payload json.RawMessage, ttl time.Duration, now time.Time) (DeviceCommand, error) {
+	var stored sql.NullString
+	if payload != nil {
+		stored = sql.NullString{String: string(payload), Valid: true}
+	}
+	res, err := db.Exec(`INSERT INTO device_commands (device_id, command, payload, status, created_at, expires_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		deviceID, command, stored, commandQueued, now.Format(time.RFC3339Nano), now.Add(ttl).Format(time.RFC3339Nano))
+	if err != nil {
+		return DeviceCommand{}, err
+	}
+	id, _ := res.LastInsertId()
+	deviceChannels.wake(deviceID)
+	return loadDeviceCommand(id)
+}
+
+const deviceCommandColumns = `id, device_id, command, payload, status, error, created_at, expires_at, sent_at, acked_at`
+
+// scanDeviceCommand reads a device_commands row
+func scanDeviceCommand(row interface{ Scan(...any) error }) (DeviceCommand, error) {
+	var c DeviceCommand
+	var payload, sentAt, ackedAt sql.NullString
+	var createdAt, expiresAt string
+	if err := row.Scan(&c.ID, &c.DeviceID, &c.Command, &payload, &c.Status, &c.Error, &createdAt, &expiresAt, &sentAt, &ackedAt); err != nil {
+		return c, err
+	}
+	if payload.Valid {
+		c.Payload = json.RawMessage(payload.String)
+	}
+	c.CreatedAt, _ = time.Parse(time.RFC3339Nano, createdAt)
+	c.ExpiresAt, _ = time.Parse(time.RFC3339Nano, expiresAt)
+	c.SentAt, c.AckedAt = parseOptionalTime(sentAt), parseOptionalTime(ackedAt)
+	return c, nil
+}
+
+// parseOptionalTime parses a nullable RFC 3339 column
+func parseOptionalTime(s sql.NullString) *time.Time {
+	if !s.Valid {
+		return nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s.String)
+	if err != nil {
+		return nil
+	}
+	return &t
+}
+
+// loadDeviceCommand loads a command by ID
+func loadDeviceCommand(id int64) (DeviceCommand, error) {
+	return scanDeviceCommand(db.QueryRow(`SELECT `+deviceCommandColumns+` FROM device_commands WHERE id = ?`, id))
+}
+
+// expireDeviceCommands marks the queued commands past their ttl as expired
+func expireDeviceCommands(now time.Time) error {
+	_, err := db.Exec(`UPDATE device_commands SET status = ? WHERE status = ? AND expires_at < ?`,
+		commandExpired, commandQueued, now.Format(time.RFC3339Nano))
+	return err
+}
+
+// loadDeviceCommands lists the commands of a device, newest first
+func loadDeviceCommands(deviceID int64, status string, limit int) ([]DeviceCommand, error) {
+	query := `SELECT ` + deviceCommandColumns + ` FROM device_commands WHERE device_id = ?`
+	args := []any{deviceID}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	commands := []DeviceCommand{}
+	for rows.Next() {
+		c, err := scanDeviceCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+	return commands, rows.Err()
+}
+
+// claimQueuedCommands marks the device's unexpired queued commands as sent
+// and returns them, oldest first
+func claimQueuedCommands(deviceID int64, now time.Time) ([]DeviceCommand, error) {
+	if err := expireDeviceCommands(now); err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`UPDATE device_commands SET status = ?, sent_at = ? WHERE device_id = ? AND status = ?
+		RETURNING `+deviceCommandColumns, commandSent, now.Format(time.RFC3339Nano), deviceID, commandQueued)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var commands []DeviceCommand
+	for rows.Next() {
+		c, err := scanDeviceCommand(rows)
+		if err != nil {
+			return nil, err
+		}
+		commands = append(commands, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	// RETURNING gives no order
+	sort.Slice(commands, func(i, j int) bool { return commands[i].ID < commands[j].ID })
+	return commands, nil
+}
+
+// requeueUnackedCommands queues again the device's sent commands it never
+// acknowledged, except reboots, and returns how many
+func requeueUnackedCommands(deviceID int64) (int64, error) {
+	res, err := db.Exec(`UPDATE device_commands SET status = ?, sent_at = NULL WHERE device_id = ? AND status = ? AND command != ?`,
+		commandQueued, deviceID, commandSent, commandReboot)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// ackDeviceCommand records a device's answer to a sent command
+func ackDeviceCommand(deviceID, id int64, ok bool, errMsg string, now time.Time) error {
+	status := commandAcked
+	if !ok {
+		status = commandFailed
+	}
+	_, err := db.Exec(`UPDATE device_commands SET status = ?, error = ?, acked_at = ? WHERE id = ? AND device_id = ? AND status = ?`,
+		status, errMsg, now.Format(time.RFC3339Nano), id, deviceID, commandSent)
+	return err
+}
+
+// --- Connected devices ---
+
+// deviceChannelRegistry tracks the devices connected to /devices/{id}/channel
+type deviceChannelRegistry struct {
+	mu       sync.Mutex
+	channels map[int64]chan struct{} // Device ID -> wake-up signal of its connection
+}
+
+// deviceChannels holds the connected devices
+var deviceChannels = &deviceChannelRegistry{channels: make(map[int64]chan struct{})}
+
+// connect registers a device's connection, replacing an older one, and
+// returns its wake-up channel
+func (d *deviceChannelRegistry) connect(deviceID int64) chan struct{} {
+	wake := make(chan struct{}, 1)
+	d.mu.Lock()
+	if old, ok := d.channels[deviceID]; ok {
+		close(old)
+	}
+	d.channels[deviceID] = wake
+	setGauge("device_channels_connected", float64(len(d.channels)))
+	d.mu.Unlock()
+	return wake
+}
+
+// disconnect unregisters a connection unless it was already replaced
+func (d *deviceChannelRegistry) disconnect(deviceID int64, wake chan struct{}) {
+	d.mu.Lock()
+	if d.channels[deviceID] == wake {
+		delete(d.channels, deviceID)
+		close(wake)
+	}
+	setGauge("device_channels_connected", float64(len(d.channels)))
+	d.mu.Unlock()
+}
+
+// connected reports whether a device has its channel open
+func (d *deviceChannelRegistry) connected(deviceID int64) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	_, ok := d.channels[deviceID]
+	return ok
+}
+
+// current reports whether a connection is still the device's latest one
+func (d *deviceChannelRegistry) current(deviceID int64, wake chan struct{}) bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.channels[deviceID] == wake
+}
+
+// wake tells a connected device's channel to send its queued commands
+func (d *deviceChannelRegistry) wake(deviceID int64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if wake, ok := d.channels[deviceID]; ok {
+		select {
+		case wake <- struct{}{}:
+		default: // Already woken
+		}
+	}
+}
+
+// reset forgets all connections
+func (d *deviceChannelRegistry) reset() {
+	d.mu.Lock()
+	d.channels = make(map[int64]chan struct{})
+	d.mu.Unlock()
+}
+
+// commandMessage is a command as pushed to a device
+type commandMessage struct {
+	ID      int64           `json:"id"`
+	Command string          `json:"command"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// commandAck is a device's answer to a command
+type commandAck struct {
+	Ack   int64  `json:"ack"`
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+// pushQueuedCommands sends a device its queued commands
+func pushQueuedCommands(ws *wsConn, deviceID int64) error {
+	commands, err := claimQueuedCommands(deviceID, time.Now())
+	if err != nil {
+		log.Printf("Error loading commands of device %d: %v", deviceID, err)
+		return nil // Retried on the next wake-up
+	}
+	for _, c := range commands {
+		msg := commandMessage{ID: c.ID, Command: c.Command, Payload: c.Payload}
+		if c.Command == commandUpdateConfig {
+			config, err := loadDeviceConfig(deviceID)
+			if err != nil {
+				log.Printf("Error loading config of device %d: %v", deviceID, err)
+			}
+			msg.Payload, _ = json.Marshal(config)
+		}
+		data, _ := json.Marshal(msg)
+		if err := ws.writeText(data); err != nil {
+			return err
+		}
+		logHTTP.infof("Sent %s command %d to device %d", c.Command, c.ID, deviceID)
+	}
+	return nil
+}
+
+// handleDeviceChannel holds a device's WebSocket, pushing commands and
+// reading acknowledgments until it disconnects
+func handleDeviceChannel(w http.ResponseWriter, r *http.Request, deviceID int64) {
+	if _, err := loadDevice(deviceID); err == sql.ErrNoRows {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	ws, err := upgradeWebSocket(w, r)
+	if err != nil {
+		return
+	}
+	defer ws.conn.Close()
+
+	wake := deviceChannels.connect(deviceID)
+	defer deviceChannels.disconnect(deviceID, wake)
+	logHTTP.infof("Device %d connected its command channel", deviceID)
+
+	// Commands pushed to a connection that dropped before the server noticed
+	if n, err := requeueUnackedCommands(deviceID); err != nil {
+		log.Printf("Error requeuing commands of device %d: %v", deviceID, err)
+	} else if n > 0 {
+		logHTTP.infof("Requeued %d unacknowledged command(s) of device %d", n, deviceID)
+	}
+
+	// Acknowledgments
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for {
+			_, message, err := ws.readMessage()
+			if err != nil {
+				return
+			}
+			var ack commandAck
+			if err := json.Unmarshal(message, &ack); err != nil || ack.Ack == 0 {
+				logHTTP.warnf("Warning: device %d sent an invalid message on its command channel", deviceID)
+				continue
+			}
+			if err := ackDeviceCommand(deviceID, ack.Ack, ack.OK, ack.Error, time.Now()); err != nil {
+				log.Printf("Error recording acknowledgment of command %d: %v", ack.Ack, err)
+			}
+		}
+	}()
+
+	ping := time.NewTicker(deviceChannelPing)
+	defer ping.Stop()
+	if err := pushQueuedCommands(ws, deviceID); err != nil {
+		return
+	}
+	for {
+		select {
+		case <-done:
+			logHTTP.infof("Device %d closed its command channel", deviceID)
+			return
+		case _, open := <-wake:
+			// A pending wake-up is still received after a newer connection closed the channel
+			if !open || !deviceChannels.current(deviceID, wake) {
+				ws.close(wsCloseNormal, "replaced by a newer connection")
+				return
+			}
+			if err := pushQueuedCommands(ws, deviceID); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := ws.writeFrame(wsPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// handleDeviceCommands queues (POST) and lists (GET) the commands of a device
+// Query parameters for GET:
+//   - status: queued, sent, acked, failed or expired
+//   - limit: most commands to return (default 50)
+func handleDeviceCommands(w http.ResponseWriter, r *http.Request, deviceID int64) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	if _, err := loadDevice(deviceID); err == sql.ErrNoRows {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPost {
+		var req DeviceCommandRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		payload, err := validateCommand(req.Command, req.Payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		ttl := defaultCommandTTL
+		if req.TTL != "" {
+			if ttl, err = time.ParseDuration(req.TTL); err != nil || ttl <= 0 || ttl > maxCommandTTL {
+				http.Error(w, "Invalid 'ttl', expected a duration up to 24h", http.StatusBadRequest)
+				return
+			}
+		}
+
+		command, err := queueDeviceCommand(deviceID, req.Command, payload, ttl, time.Now())
+		if err != nil {
+			log.Printf("Error queueing command for device %d: %v", deviceID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("device.command.queued", clientIP(r), fmt.Sprintf("device=%d command=%s id=%d", deviceID, command.Command, command.ID))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(command)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", commandQueued, commandSent, commandAcked, commandFailed, commandExpired:
+	default:
+		http.Error(w, "Invalid 'status' parameter, expected queued, sent, acked, failed or expired", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if n, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || n != 1 || limit < 0 {
+			http.Error(w, "Invalid 'limit' parameter, expected positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := expireDeviceCommands(time.Now()); err != nil {
+		log.Printf("Error expiring device commands: %v", err)
+	}
+	commands, err := loadDeviceCommands(deviceID, status, limit)
+	if err != nil {
+		log.Printf("Error querying device commands: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(commands)
+}
@@ -0,0 +1,273 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Device Commands Tests
+// ============================================================================
+
+// queueCommand posts a command for a device and returns the response
+func queueCommand(t *testing.T, deviceID int64, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/devices/%d/commands", deviceID), strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	return rr
+}
+
+// testWSClient is the device side of a command channel
+type testWSClient struct {
+	conn net.Conn
+	br   *bufio.Reader
+}
+
+// dialChannel opens the command channel of a device on a test server
+func dialChannel(t *testing.T, server *httptest.Server, deviceID int64) *testWSClient {
+	t.Helper()
+	conn, err := net.Dial("tcp", strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	key := "dGhlIHNhbXBsZSBub25jZQ=="
+	fmt.Fprintf(conn, "GET /devices/%d/channel HTTP/1.1\r\nHost: scanner\r\nConnection: Upgrade\r\nUpgrade: websocket\r\nSec-WebSocket-Version: 13\r\nSec-WebSocket-Key: %s\r\n\r\n", deviceID, key)
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != "s3pPLMBiTxaQ9kYGzzhZRbK+xOo=" {
+		t.Fatalf("expected the upgrade accepted, got %v %v", resp.Status, resp.Header)
+	}
+	return &testWSClient{conn: conn, br: br}
+}
+
+// send writes a masked text frame, as clients must
+func (c *testWSClient) send(t *testing.T, payload string) {
+	t.Helper()
+	mask := []byte{1, 2, 3, 4}
+	frame := []byte{0x80 | wsText, 0x80 | byte(len(payload))}
+	frame = append(frame, mask...)
+	for i := range payload {
+		frame = append(frame, payload[i]^mask[i%4])
+	}
+	if _, err := c.conn.Write(frame); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// receive reads the next text message, skipping pings
+func (c *testWSClient) receive(t *testing.T) commandMessage {
+	t.Helper()
+	c.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		var head [2]byte
+		if _, err := io.ReadFull(c.br, head[:]); err != nil {
+			t.Fatalf("expected a message: %v", err)
+		}
+		length := int(head[1] & 0x7f)
+		if length == 126 {
+			var ext [2]byte
+			io.ReadFull(c.br, ext[:])
+			length = int(binary.BigEndian.Uint16(ext[:]))
+		}
+		payload := make([]byte, length)
+		if _, err := io.ReadFull(c.br, payload); err != nil {
+			t.Fatal(err)
+		}
+		if head[0]&0x0f != wsText {
+			continue
+		}
+		var msg commandMessage
+		if err := json.Unmarshal(payload, &msg); err != nil {
+			t.Fatalf("invalid command message %q: %v", payload, err)
+		}
+		return msg
+	}
+}
+
+// waitCommandStatus waits for a command to reach a status
+func waitCommandStatus(t *testing.T, id int64, status string) DeviceCommand {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		command, err := loadDeviceCommand(id)
+		if err == nil && command.Status == status {
+			return command
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected command %d %s, got %+v (%v)", id, status, command, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandleDeviceCommands_Validation(t *testing.T) {
+	setupTest()
+	device := createTestDevice(t, "front-door")
+
+	for _, body := range []string{
+		`{"command":"self_destruct"}`,
+		`{"command":"show_message"}`,
+		`{"command":"show_message","payload":{"text":"Hi","seconds":7200}}`,
+		`{"command":"enroll","payload":{"seconds":-1}}`,
+		`{"command":"reboot","ttl":"48h"}`,
+	} {
+		if rr := queueCommand(t, device.ID, body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %v", body, rr.Code)
+		}
+	}
+	if rr := queueCommand(t, 999, `{"command":"reboot"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown device, got %v", rr.Code)
+	}
+
+	rr := queueCommand(t, device.ID, `{"command":"show_message","payload":{"text":" Back at 3pm "}}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var command DeviceCommand
+	json.Unmarshal(rr.Body.Bytes(), &command)
+	if command.Status != commandQueued || string(command.Payload) != `{"text":"Back at 3pm","seconds":10}` {
+		t.Errorf("expected the message queued with its default duration, got %+v (%s)", command, command.Payload)
+	}
+	if time.Until(command.ExpiresAt) < 59*time.Minute {
+		t.Errorf("expected the command to expire in an hour, got %v", command.ExpiresAt)
+	}
+	if entries, _ := loadAuditEntries("device.command.queued", 10); len(entries) != 1 {
+		t.Errorf("expected the command audited, got %+v", entries)
+	}
+}
+
+func TestHandleDeviceCommands_ListExpired(t *testing.T) {
+	setupTest()
+	device := createTestDevice(t, "front-door")
+
+	queueCommand(t, device.ID, `{"command":"reboot"}`)
+	queueCommand(t, device.ID, `{"command":"enroll"}`)
+	db.Exec(`UPDATE device_commands SET expires_at = ? WHERE command = 'reboot'`, time.Now().Add(-time.Minute).Format(time.RFC3339Nano))
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/devices/%d/commands", device.ID), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	var commands []DeviceCommand
+	json.Unmarshal(rr.Body.Bytes(), &commands)
+	if len(commands) != 2 || commands[0].Command != commandEnroll || commands[1].Status != commandExpired {
+		t.Errorf("expected the enroll command then the expired reboot, got %+v", commands)
+	}
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/devices/%d/commands?status=queued", device.ID), nil)
+	rr = httptest.NewRecorder()
+	handleDevice(rr, req)
+	commands = nil
+	json.Unmarshal(rr.Body.Bytes(), &commands)
+	if len(commands) != 1 || commands[0].Command != commandEnroll {
+		t.Errorf("expected only the enroll command queued, got %+v", commands)
+	}
+}
+
+func TestHandleDeviceChannel(t *testing.T) {
+	setupTest()
+	device := createTestDevice(t, "front-door")
+	server := httptest.NewServer(http.HandlerFunc(handleDevice))
+	defer server.Close()
+
+	// Queued before the device connects, and one that expired meanwhile
+	var expired, reboot DeviceCommand
+	json.Unmarshal(queueCommand(t, device.ID, `{"command":"enroll"}`).Body.Bytes(), &expired)
+	db.Exec(`UPDATE device_commands SET expires_at = ? WHERE id = ?`, time.Now().Add(-time.Minute).Format(time.RFC3339Nano), expired.ID)
+	json.Unmarshal(queueCommand(t, device.ID, `{"command":"reboot"}`).Body.Bytes(), &reboot)
+
+	client := dialChannel(t, server, device.ID)
+	if msg := client.receive(t); msg.ID != reboot.ID || msg.Command != commandReboot {
+		t.Fatalf("expected the reboot pushed on connect, got %+v", msg)
+	}
+	client.send(t, fmt.Sprintf(`{"ack":%d,"ok":true}`, reboot.ID))
+	waitCommandStatus(t, reboot.ID, commandAcked)
+
+	// Queued while connected: pushed right away
+	var update DeviceCommand
+	json.Unmarshal(queueCommand(t, device.ID, `{"command":"update_config"}`).Body.Bytes(), &update)
+	msg := client.receive(t)
+	var config DeviceConfig
+	if msg.ID != update.ID || json.Unmarshal(msg.Payload, &config) != nil {
+		t.Fatalf("expected the config pushed, got %+v", msg)
+	}
+	client.send(t, fmt.Sprintf(`{"ack":%d,"ok":false,"error":"flash full"}`, update.ID))
+	if failed := waitCommandStatus(t, update.ID, commandFailed); failed.Error != "flash full" {
+		t.Errorf("expected the device's error kept, got %+v", failed)
+	}
+
+	if command, _ := loadDeviceCommand(expired.ID); command.Status != commandExpired || command.SentAt != nil {
+		t.Errorf("expected the expired command never sent, got %+v", command)
+	}
+}
+
+func TestHandleDeviceChannel_NotResentOnReconnect(t *testing.T) {
+	setupTest()
+	device := createTestDevice(t, "front-door")
+	server := httptest.NewServer(http.HandlerFunc(handleDevice))
+	defer server.Close()
+
+	var reboot DeviceCommand
+	json.Unmarshal(queueCommand(t, device.ID, `{"command":"reboot"}`).Body.Bytes(), &reboot)
+	first := dialChannel(t, server, device.ID)
+	first.receive(t)
+	first.conn.Close() // Rebooting, without acknowledging
+
+	var message DeviceCommand
+	json.Unmarshal(queueCommand(t, device.ID, `{"command":"show_message","payload":{"text":"Hello"}}`).Body.Bytes(), &message)
+	second := dialChannel(t, server, device.ID)
+	if msg := second.receive(t); msg.ID != message.ID {
+		t.Errorf("expected only the new command, got %+v", msg)
+	}
+	if command, _ := loadDeviceCommand(reboot.ID); command.Status != commandSent {
+		t.Errorf("expected the reboot left sent, got %+v", command)
+	}
+}
+
+func TestHandleDeviceChannel_RequiresUpgrade(t *testing.T) {
+	setupTest()
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/devices/%d/channel", device.ID), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusUpgradeRequired || rr.Header().Get("Upgrade") != "websocket" {
+		t.Errorf("expected 426 Upgrade Required, got %v %v", rr.Code, rr.Header())
+	}
+}
+
+func TestReadMessage_Fragmented(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	ws := &wsConn{conn: server, br: bufio.NewReader(server)}
+
+	go func() {
+		// "Hel" then "lo", with a ping in between; clients mask with any key
+		client.Write([]byte{wsText, 0x83, 0, 0, 0, 0, 'H', 'e', 'l'})
+		client.Write([]byte{0x80 | wsPing, 0x80, 0, 0, 0, 0})
+		pong := make([]byte, 2)
+		io.ReadFull(client, pong)
+		client.Write([]byte{0x80 | wsContinuation, 0x82, 0, 0, 0, 0, 'l', 'o'})
+	}()
+
+	opcode, message, err := ws.readMessage()
+	if err != nil || opcode != wsText || !bytes.Equal(message, []byte("Hello")) {
+		t.Errorf("expected Hello, got %v %q %v", opcode, message, err)
+	}
+}
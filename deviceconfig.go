@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+)
+
+// --- Device Configuration ---
+//
+// Scanners fetch their settings from GET /devices/{id}/config at boot and
+// periodically, so their behaviour can be changed without reflashing. Admins
+// change settings with PUT /devices/{id}/config; every change increments the
+// config version, which scanners compare against the version they applied.
+// Devices without stored settings get defaultDeviceConfig at version 0.
+
+// DeviceConfig holds the settings served to a scanner
+type DeviceConfig struct {
+	Version        int64             `json:"version"`
+	UpdatedAt      *time.Time        `json:"updated_at,omitempty"`
+	PollIntervalMs int               `json:"poll_interval_ms"` // How often the reader is polled for cards
+	DebounceMs     int               `json:"debounce_ms"`      // Repeat reads of the same card within this window are ignored
+	Messages       map[string]string `json:"messages"`         // Display messages, e.g. welcome, goodbye, unknown
+	Timezone       string            `json:"timezone"`         // IANA timezone for the scanner's display clock
+	Features       map[string]bool   `json:"features"`         // Feature toggles, e.g. buzzer, display
+}
+
+// defaultDeviceConfig returns the settings of a device that has not been configured
+func defaultDeviceConfig() DeviceConfig {
+	return DeviceConfig{
+		PollIntervalMs: 250,
+		DebounceMs:     3000,
+		Messages: map[string]string{
+			"welcome": "Welcome, %s",
+			"goodbye": "Goodbye, %s",
+			"unknown": "Unknown card",
+		},
+		Timezone: "America/Toronto",
+		Features: map[string]bool{
+			"buzzer":  true,
+			"display": true,
+		},
+	}
+}
+
+// validate checks that the settings can be applied by a scanner
+func (c DeviceConfig) validate() error {
+	if c.PollIntervalMs <= 0 {
+		return fmt.Errorf("poll_interval_ms must be positive")
+	}
+	if c.DebounceMs < 0 {
+		return fmt.Errorf("debounce_ms must not be negative")
+	}
+	if _, err := time.LoadLocation(c.Timezone); err != nil || c.Timezone == "" {
+		return fmt.Errorf("unknown timezone %q", c.Timezone)
+	}
+	return nil
+}
+
+// clone returns a copy of the settings that shares no maps with c
+func (c DeviceConfig) clone() DeviceConfig {
+	messages := make(map[string]string, len(c.Messages))
+	for k, v := range c.Messages {
+		messages[k] = v
+	}
+	features := make(map[string]bool, len(c.Features))
+	for k, v := range c.Features {
+		features[k] = v
+	}
+	c.Messages, c.Features = messages, features
+	return c
+}
+
+// loadDeviceConfig returns the stored settings of a device, or the defaults
+func loadDeviceConfig(deviceID int64) (DeviceConfig, error) {
+	var version int64
+	var settings, updatedAt string
+	err := db.QueryRow(`SELECT version, settings, updated_at FROM device_configs WHERE device_id = ?`, deviceID).
+		Scan(&version, &settings, &updatedAt)
+	if err == sql.ErrNoRows {
+		return defaultDeviceConfig(), nil
+	} else if err != nil {
+		return DeviceConfig{}, err
+	}
+
+	config := defaultDeviceConfig()
+	if err := json.Unmarshal([]byte(settings), &config); err != nil {
+		return DeviceConfig{}, err
+	}
+	t, err := time.Parse(time.RFC3339, updatedAt)
+	if err != nil {
+		return DeviceConfig{}, err
+	}
+	config.Version = version
+	config.UpdatedAt = &t
+	return config, nil
+}
+
+// saveDeviceConfig stores new settings for a device and increments its config version
+func saveDeviceConfig(deviceID int64, config DeviceConfig) (DeviceConfig, error) {
+	config.Version = 0
+	config.UpdatedAt = nil
+	settings, err := json.Marshal(config)
+	if err != nil {
+		return DeviceConfig{}, err
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	_, err = db.Exec(`
+		INSERT INTO device_configs (device_id, version, settings, updated_at) VALUES (?, 1, ?, ?)
+		ON CONFLICT(device_id) DO UPDATE SET version = version + 1, settings = excluded.settings, updated_at = excluded.updated_at`,
+		deviceID, string(settings), now)
+	if err != nil {
+		return DeviceConfig{}, err
+	}
+	return loadDeviceConfig(deviceID)
+}
+
+// handleDeviceConfig handles /devices/{id}/config
+// GET returns the device's settings; PUT updates them. Fields omitted from
+// the PUT body keep their current value.
+func handleDeviceConfig(w http.ResponseWriter, r *http.Request, deviceID int64) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	if _, err := loadDevice(deviceID); err == sql.ErrNoRows {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	config, err := loadDeviceConfig(deviceID)
+	if err != nil {
+		log.Printf("Error loading config for device %d: %v", deviceID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		current := config.clone()
+		if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if err := config.validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Only bump the version when a setting actually changed
+		config.Version, config.UpdatedAt = current.Version, current.UpdatedAt
+		if !reflect.DeepEqual(config, current) {
+			if config, err = saveDeviceConfig(deviceID, config); err != nil {
+				log.Printf("Error saving config for device %d: %v", deviceID, err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			recordAudit("device.config.updated", clientIP(r), fmt.Sprintf("device=%d version=%d", deviceID, config.Version))
+		}
+	}
+
+	writeNegotiated(w, r, http.StatusOK, config)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// /devices/{id}/config Endpoint Tests
+// ============================================================================
+
+// deviceConfigRequest sends a request to /devices/{id}/config and returns the recorder
+func deviceConfigRequest(t *testing.T, method string, deviceID int64, body string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, _ := http.NewRequest(method, fmt.Sprintf("/devices/%d/config", deviceID), bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	return rr
+}
+
+func TestHandleDeviceConfig_Defaults(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	rr := deviceConfigRequest(t, "GET", device.ID, "")
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var config DeviceConfig
+	if err := json.Unmarshal(rr.Body.Bytes(), &config); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if config.Version != 0 || config.PollIntervalMs != defaultDeviceConfig().PollIntervalMs || config.Timezone != "America/Toronto" {
+		t.Errorf("expected default config at version 0, got %+v", config)
+	}
+}
+
+func TestHandleDeviceConfig_UpdateBumpsVersion(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	rr := deviceConfigRequest(t, "PUT", device.ID, `{"debounce_ms":5000,"messages":{"welcome":"Hi %s"},"features":{"buzzer":false}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var config DeviceConfig
+	json.Unmarshal(rr.Body.Bytes(), &config)
+	if config.Version != 1 || config.DebounceMs != 5000 || config.UpdatedAt == nil {
+		t.Errorf("expected version 1 with new debounce, got %+v", config)
+	}
+	// Omitted settings keep their value
+	if config.PollIntervalMs != 250 || config.Messages["welcome"] != "Hi %s" || config.Messages["goodbye"] != "Goodbye, %s" {
+		t.Errorf("expected other settings to be kept, got %+v", config)
+	}
+	if config.Features["buzzer"] || !config.Features["display"] {
+		t.Errorf("expected only the buzzer to be disabled, got %+v", config.Features)
+	}
+
+	// Saving the same settings again does not change the version
+	rr = deviceConfigRequest(t, "PUT", device.ID, `{"debounce_ms":5000}`)
+	json.Unmarshal(rr.Body.Bytes(), &config)
+	if config.Version != 1 {
+		t.Errorf("expected version to stay at 1, got %d", config.Version)
+	}
+
+	rr = deviceConfigRequest(t, "PUT", device.ID, `{"timezone":"America/Vancouver"}`)
+	json.Unmarshal(rr.Body.Bytes(), &config)
+	if config.Version != 2 || config.Timezone != "America/Vancouver" || config.DebounceMs != 5000 {
+		t.Errorf("expected version 2 with new timezone, got %+v", config)
+	}
+
+	entries, _ := loadAuditEntries("device.config.updated", 10)
+	if len(entries) != 2 {
+		t.Errorf("expected two device.config.updated audit entries, got %+v", entries)
+	}
+}
+
+func TestHandleDeviceConfig_Invalid(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	for _, body := range []string{
+		`{"poll_interval_ms":0}`,
+		`{"debounce_ms":-1}`,
+		`{"timezone":"Mars/Olympus"}`,
+		`not json`,
+	} {
+		if rr := deviceConfigRequest(t, "PUT", device.ID, body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %v", body, rr.Code)
+		}
+	}
+
+	if rr := deviceConfigRequest(t, "GET", 99, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown device, got %v", rr.Code)
+	}
+}
+
+func TestHandleScannerDevice_OwnConfigOnly(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	other := createTestDevice(t, "side-door")
+	ctx := context.WithValue(context.Background(), deviceContextKey{}, device)
+
+	req, _ := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("/devices/%d/config", device.ID), nil)
+	rr := httptest.NewRecorder()
+	handleScannerDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK for own config, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("/devices/%d/config", other.ID), nil)
+	rr = httptest.NewRecorder()
+	handleScannerDevice(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another device's config, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("/devices/%d/certificate", device.ID), nil)
+	rr = httptest.NewRecorder()
+	handleScannerDevice(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for other sub-resources, got %v", rr.Code)
+	}
+}
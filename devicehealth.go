@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// --- Device Heartbeats and Offline Alerts ---
+//
+// Scanners send POST /devices/{id}/heartbeat periodically; scans from a known
+// device count as a heartbeat too. The time of the latest one is the device's
+// last_seen_at. A background monitor sends an alert to ALERT_WEBHOOK_URL when
+// a device that has been seen before stays silent for DEVICE_OFFLINE_AFTER
+// (default 10 minutes), and another one when it comes back.
+
+const (
+	defaultDeviceOfflineAfter = 10 * time.Minute
+	deviceMonitorInterval     = time.Minute
+)
+
+// deviceOfflineAfter is how long a device may miss heartbeats before it is reported offline
+var deviceOfflineAfter = defaultDeviceOfflineAfter
+
+// loadDeviceOfflineAfter reads DEVICE_OFFLINE_AFTER (a Go duration such as 15m)
+func loadDeviceOfflineAfter() (time.Duration, error) {
+	value := os.Getenv("DEVICE_OFFLINE_AFTER")
+	if value == "" {
+		return defaultDeviceOfflineAfter, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// markDeviceSeen records a sign of life from a device and alerts if it was reported offline
+func markDeviceSeen(device Device, now time.Time) error {
+	if _, err := db.Exec(`UPDATE devices SET last_seen_at = ?, offline_since = NULL WHERE id = ?`,
+		now.Format(time.RFC3339), device.ID); err != nil {
+		return err
+	}
+
+	if device.OfflineSince != nil {
+		msg := fmt.Sprintf("Scanner %q is back online after %s", device.Name, now.Sub(*device.OfflineSince).Round(time.Minute))
+		log.Println(msg)
+		recordAudit("device.online", device.Name, msg)
+		events.publish(Event{Kind: eventDeviceOnline, Time: now, Device: device, Message: msg})
+	}
+	return nil
+}
+
+// recordScanContact is a pre-validate hook counting a scan as a heartbeat of its
+// device and measuring its clock skew
+func recordScanContact(sc *ScanContext) error {
+	if sc.Device == nil {
+		return nil
+	}
+	if err := markDeviceSeen(*sc.Device, sc.Time); err != nil {
+		log.Printf("Warning: Failed to record scan from device %d: %v", sc.Device.ID, err)
+	}
+	if sc.ClockTime != nil {
+		if err := recordClockSkew(*sc.Device, *sc.ClockTime, sc.Time); err != nil {
+			log.Printf("Warning: Failed to record clock skew of device %d: %v", sc.Device.ID, err)
+		}
+	}
+	return nil
+}
+
+// checkDeviceHeartbeats reports devices that have not been seen for deviceOfflineAfter
+func checkDeviceHeartbeats(now time.Time) error {
+	devices, err := loadDevices()
+	if err != nil {
+		return err
+	}
+
+	for _, d := range devices {
+		// Devices that never checked in and devices already reported are skipped
+		if d.LastSeenAt == nil || d.OfflineSince != nil || now.Sub(*d.LastSeenAt) < deviceOfflineAfter {
+			continue
+		}
+
+		if _, err := db.Exec(`UPDATE devices SET offline_since = ? WHERE id = ?`, now.Format(time.RFC3339), d.ID); err != nil {
+			return err
+		}
+		msg := fmt.Sprintf("Scanner %q is offline: no heartbeat since %s", d.Name, d.LastSeenAt.Local().Format("Mon Jan 2 15:04"))
+		log.Println(msg)
+		recordAudit("device.offline", d.Name, msg)
+		events.publish(Event{Kind: eventDeviceOffline, Time: now, Device: d, Message: msg})
+	}
+	return nil
+}
+
+// startDeviceMonitor periodically checks for devices that stopped sending heartbeats
+func startDeviceMonitor() {
+	ticker := time.NewTicker(deviceMonitorInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := checkDeviceHeartbeats(now); err != nil {
+			log.Printf("Error checking device heartbeats: %v", err)
+		}
+	}
+}
+
+// HeartbeatRequest is the optional payload of a heartbeat
+type HeartbeatRequest struct {
+	Time *time.Time `json:"time,omitempty"` // The device's clock, used to measure clock skew
+}
+
+// handleDeviceHeartbeat records a heartbeat at POST /devices/{id}/heartbeat
+func handleDeviceHeartbeat(w http.ResponseWriter, r *http.Request, deviceID int64) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req HeartbeatRequest
+	if err := decodeDeviceBody(r, &req); err != nil && err != io.EOF {
+		http.Error(w, invalidBodyMessage(r), http.StatusBadRequest)
+		return
+	}
+
+	device, err := loadDevice(deviceID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	if err := markDeviceSeen(device, now); err != nil {
+		log.Printf("Error recording heartbeat of device %d: %v", deviceID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if req.Time != nil {
+		if err := recordClockSkew(device, *req.Time, now); err != nil {
+			log.Printf("Error recording clock skew of device %d: %v", deviceID, err)
+		}
+	}
+
+	writeNegotiated(w, r, http.StatusOK, HeartbeatResponse{Status: "ok", ServerTime: now.Truncate(time.Second)})
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Device Heartbeat and Offline Alert Tests
+// ============================================================================
+
+func sendHeartbeat(t *testing.T, deviceID int64) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/devices/%d/heartbeat", deviceID), http.NoBody)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	return rr
+}
+
+func TestHandleDeviceHeartbeat_UpdatesLastSeen(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	if device.LastSeenAt != nil {
+		t.Fatalf("expected new device to have no last_seen_at, got %v", device.LastSeenAt)
+	}
+
+	if rr := sendHeartbeat(t, device.ID); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	req, _ := http.NewRequest("GET", "/devices", nil)
+	rr := httptest.NewRecorder()
+	handleDevices(rr, req)
+
+	var devices []Device
+	json.Unmarshal(rr.Body.Bytes(), &devices)
+	if len(devices) != 1 || devices[0].LastSeenAt == nil || time.Since(*devices[0].LastSeenAt) > time.Minute {
+		t.Errorf("expected a recent last_seen_at in /devices, got %+v", devices)
+	}
+
+	if rr := sendHeartbeat(t, 99); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown device, got %v", rr.Code)
+	}
+}
+
+func TestHandleScan_CountsAsHeartbeat(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid":"TEST_UID_1"}`))
+	req.Header.Set(deviceIDHeader, fmt.Sprint(device.ID))
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	updated, _ := loadDevice(device.ID)
+	if updated.LastSeenAt == nil {
+		t.Error("expected the scan to update last_seen_at")
+	}
+}
+
+func TestCheckDeviceHeartbeats(t *testing.T) {
+	setupTest()
+
+	silent := createTestDevice(t, "front-door")
+	alive := createTestDevice(t, "side-door")
+	createTestDevice(t, "never-seen")
+
+	now := time.Now()
+	db.Exec(`UPDATE devices SET last_seen_at = ? WHERE id = ?`, now.Add(-time.Hour).Format(time.RFC3339), silent.ID)
+	db.Exec(`UPDATE devices SET last_seen_at = ? WHERE id = ?`, now.Add(-time.Minute).Format(time.RFC3339), alive.ID)
+
+	if err := checkDeviceHeartbeats(now); err != nil {
+		t.Fatalf("checkDeviceHeartbeats failed: %v", err)
+	}
+
+	devices, _ := loadDevices()
+	for _, d := range devices {
+		if offline := d.OfflineSince != nil; offline != (d.ID == silent.ID) {
+			t.Errorf("device %s: expected offline=%v, got %+v", d.Name, d.ID == silent.ID, d)
+		}
+	}
+
+	// A device is only reported once while it stays offline
+	checkDeviceHeartbeats(now.Add(time.Minute))
+	entries, _ := loadAuditEntries("device.offline", 10)
+	if len(entries) != 1 || entries[0].Actor != "front-door" {
+		t.Errorf("expected one device.offline audit entry, got %+v", entries)
+	}
+
+	// A heartbeat brings it back online
+	sendHeartbeat(t, silent.ID)
+	updated, _ := loadDevice(silent.ID)
+	if updated.OfflineSince != nil {
+		t.Errorf("expected device to be back online, got %+v", updated)
+	}
+	entries, _ = loadAuditEntries("device.online", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected one device.online audit entry, got %+v", entries)
+	}
+}
+
+func TestLoadDeviceOfflineAfter(t *testing.T) {
+	t.Setenv("DEVICE_OFFLINE_AFTER", "")
+	if d, err := loadDeviceOfflineAfter(); err != nil || d != defaultDeviceOfflineAfter {
+		t.Errorf("expected default, got %v, %v", d, err)
+	}
+
+	t.Setenv("DEVICE_OFFLINE_AFTER", "30m")
+	if d, err := loadDeviceOfflineAfter(); err != nil || d != 30*time.Minute {
+		t.Errorf("expected 30m, got %v, %v", d, err)
+	}
+
+	for _, value := range []string{"soon", "-5m", "0"} {
+		t.Setenv("DEVICE_OFFLINE_AFTER", value)
+		if _, err := loadDeviceOfflineAfter(); err == nil {
+			t.Errorf("%q: expected error", value)
+		}
+	}
+}
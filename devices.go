@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Devices ---
+
+// Device is a registered scanner (e.g., an ESP32 RFID reader)
+type Device struct {
+	ID               int64      `json:"id"`
+	Name             string     `json:"name"`
+	CreatedAt        time.Time  `json:"created_at"`
+	CertFingerprint  string     `json:"cert_fingerprint,omitempty"`
+	CertExpiresAt    *time.Time `json:"cert_expires_at,omitempty"`
+	CardFormat       string     `json:"card_format"` // raw, decimal or wiegand26 (see cardformat.go)
+	FirmwareChannel  string     `json:"firmware_channel"`
+	FirmwareVersion  string     `json:"firmware_version,omitempty"`   // Last version reported by the scanner
+	LastSeenAt       *time.Time `json:"last_seen_at,omitempty"`       // Latest heartbeat or scan
+	OfflineSince     *time.Time `json:"offline_since,omitempty"`      // Set while the device is reported offline
+	ClockSkewSeconds *float64   `json:"clock_skew_seconds,omitempty"` // Device clock minus server clock
+	OrgID            string     `json:"org_id"`
+}
+
+// CreateDeviceRequest is the payload to register a device
+type CreateDeviceRequest struct {
+	Name       string `json:"name"`
+	CardFormat string `json:"card_format,omitempty"` // Defaults to raw
+}
+
+// UpdateDeviceRequest is the payload to update a device; empty fields are left unchanged
+type UpdateDeviceRequest struct {
+	Name            string `json:"name"`
+	CardFormat      string `json:"card_format"`
+	FirmwareChannel string `json:"firmware_channel"`
+}
+
+// deviceColumns is the column list scanned by scanDevice
+const deviceColumns = `id, name, created_at, cert_fingerprint, cert_expires_at, card_format, firmware_channel, firmware_version, last_seen_at, offline_since, clock_skew_seconds, org_id`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanDevice reads a device row selected with deviceColumns
+func scanDevice(row rowScanner) (Device, error) {
+	var d Device
+	var createdAt string
+	var fingerprint, expiresAt, firmwareVersion, lastSeenAt, offlineSince sql.NullString
+	var clockSkew sql.NullFloat64
+	if err := row.Scan(&d.ID, &d.Name, &createdAt, &fingerprint, &expiresAt, &d.CardFormat, &d.FirmwareChannel,
+		&firmwareVersion, &lastSeenAt, &offlineSince, &clockSkew, &d.OrgID); err != nil {
+		return Device{}, err
+	}
+
+	var err error
+	if d.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return Device{}, err
+	}
+	d.CertFingerprint = fingerprint.String
+	d.FirmwareVersion = firmwareVersion.String
+	if clockSkew.Valid {
+		d.ClockSkewSeconds = &clockSkew.Float64
+	}
+
+	// Optional timestamps
+	for _, field := range []struct {
+		value sql.NullString
+		dest  **time.Time
+	}{
+		{expiresAt, &d.CertExpiresAt},
+		{lastSeenAt, &d.LastSeenAt},
+		{offlineSince, &d.OfflineSince},
+	} {
+		if !field.value.Valid {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, field.value.String)
+		if err != nil {
+			return Device{}, err
+		}
+		*field.dest = &t
+	}
+	return d, nil
+}
+
+// loadDevice fetches a single device by ID
+func loadDevice(id int64) (Device, error) {
+	return scanDevice(db.QueryRow(`SELECT `+deviceColumns+` FROM devices WHERE id = ?`, id))
+}
+
+// loadDevices returns the registered devices of every organization ordered by ID
+func loadDevices() ([]Device, error) {
+	rows, err := db.Query(`SELECT ` + deviceColumns + ` FROM devices ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	devices := []Device{}
+	for rows.Next() {
+		d, err := scanDevice(rows)
+		if err != nil {
+			return nil, err
+		}
+		devices = append(devices, d)
+	}
+	return devices, rows.Err()
+}
+
+// handleDevices supports GET to list devices and POST to register a new device
+func handleDevices(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		devices, err := loadDevices()
+		if err != nil {
+			log.Printf("Error querying devices: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		own := []Device{}
+		for _, d := range devices {
+			if d.OrgID == requestOrg(r) {
+				own = append(own, d)
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(own)
+
+	case http.MethodPost:
+		var req CreateDeviceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		if req.CardFormat == "" {
+			req.CardFormat = cardFormatRaw
+		}
+		if !validCardFormat(req.CardFormat) {
+			http.Error(w, "Invalid card_format, expected raw, decimal or wiegand26", http.StatusBadRequest)
+			return
+		}
+
+		now := time.Now()
+		res, err := db.Exec(`INSERT INTO devices (name, created_at, card_format, org_id) VALUES (?, ?, ?, ?)`,
+			req.Name, now.Format(time.RFC3339), req.CardFormat, requestOrg(r))
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Device name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error inserting device: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		id, _ := res.LastInsertId()
+		device, err := loadDevice(id)
+		if err != nil {
+			log.Printf("Error loading created device: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(device)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleDevice handles /devices/{id} (GET, PUT, DELETE) and dispatches device sub-resources
+func handleDevice(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/devices/")
+	if !ok {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+	if !checkDeviceOrg(w, r, id) {
+		return
+	}
+
+	switch sub {
+	case "":
+	case "certificate":
+		handleDeviceCertificate(w, r, id)
+		return
+	case "channel":
+		handleDeviceChannel(w, r, id)
+		return
+	case "commands":
+		handleDeviceCommands(w, r, id)
+		return
+	case "config":
+		handleDeviceConfig(w, r, id)
+		return
+	case "firmware":
+		handleDeviceFirmware(w, r, id)
+		return
+	case "heartbeat":
+		handleDeviceHeartbeat(w, r, id)
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		device, err := loadDevice(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying device: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(device)
+
+	case http.MethodPut:
+		var req UpdateDeviceRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.CardFormat != "" && !validCardFormat(req.CardFormat) {
+			http.Error(w, "Invalid card_format, expected raw, decimal or wiegand26", http.StatusBadRequest)
+			return
+		}
+		if req.FirmwareChannel != "" && !firmwareChannelPattern.MatchString(req.FirmwareChannel) {
+			http.Error(w, "Invalid firmware_channel", http.StatusBadRequest)
+			return
+		}
+
+		result, err := db.Exec(`
+			UPDATE devices SET
+				name = COALESCE(NULLIF(?, ''), name),
+				card_format = COALESCE(NULLIF(?, ''), card_format),
+				firmware_channel = COALESCE(NULLIF(?, ''), firmware_channel)
+			WHERE id = ?`,
+			req.Name, req.CardFormat, req.FirmwareChannel, id)
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Device name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error updating device: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
+		device, err := loadDevice(id)
+		if err != nil {
+			log.Printf("Error loading updated device: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(device)
+
+	case http.MethodDelete:
+		result, err := db.Exec(`DELETE FROM devices WHERE id = ?`, id)
+		if err != nil {
+			log.Printf("Error deleting device: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Device not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Device deleted successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
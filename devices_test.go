@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// /devices Endpoint Tests
+// ============================================================================
+
+// createTestDevice registers a device and returns it
+func createTestDevice(t *testing.T, name string) Device {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/devices", bytes.NewBufferString(`{"name":"`+name+`"}`))
+	rr := httptest.NewRecorder()
+	handleDevices(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var device Device
+	if err := json.Unmarshal(rr.Body.Bytes(), &device); err != nil {
+		t.Fatalf("failed to parse device: %v", err)
+	}
+	return device
+}
+
+func TestHandleDevices_CreateAndList(t *testing.T) {
+	setupTest()
+
+	created := createTestDevice(t, "front-door")
+	if created.ID == 0 || created.Name != "front-door" {
+		t.Fatalf("unexpected device: %+v", created)
+	}
+
+	req, _ := http.NewRequest("GET", "/devices", nil)
+	rr := httptest.NewRecorder()
+	handleDevices(rr, req)
+
+	var devices []Device
+	if err := json.Unmarshal(rr.Body.Bytes(), &devices); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(devices) != 1 || devices[0].Name != "front-door" {
+		t.Errorf("expected one device, got %+v", devices)
+	}
+}
+
+func TestHandleDevices_CreateDuplicate(t *testing.T) {
+	setupTest()
+
+	createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("POST", "/devices", bytes.NewBufferString(`{"name":"front-door"}`))
+	rr := httptest.NewRecorder()
+	handleDevices(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict, got %v", rr.Code)
+	}
+}
+
+func TestHandleDevices_CreateMissingName(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/devices", bytes.NewBufferString(`{"name":"  "}`))
+	rr := httptest.NewRecorder()
+	handleDevices(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestHandleDevice_GetAndDelete(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+	path := "/devices/" + fmt.Sprint(device.ID)
+
+	req, _ := http.NewRequest("GET", path, nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("DELETE", path, nil)
+	rr = httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK on delete, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %v", rr.Code)
+	}
+}
+
+func TestHandleDevice_InvalidID(t *testing.T) {
+	setupTest()
+
+	for _, path := range []string{"/devices/abc", "/devices/12abc", "/devices/0"} {
+		req, _ := http.NewRequest("GET", path, nil)
+		rr := httptest.NewRecorder()
+		handleDevice(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %v", path, rr.Code)
+		}
+	}
+}
+
+func TestHandleDevice_UnknownSubResource(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("GET", "/devices/"+fmt.Sprint(device.ID)+"/unknown", nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Low-Power Display ---
+//
+// /display/summary serves what an e-paper door sign shows: whether the office
+// is open, how many people are inside and who, and how long it has been open
+// today. Times are pre-formatted in the server's time zone so the device does
+// not need a clock or a time zone database. With ?format=png the summary is
+// drawn as a 1-bit PNG (296x128 by default, the size of common 2.9" panels)
+// for devices that only blit images. Responses carry an ETag and change at
+// most once a minute, so devices can poll with If-None-Match cheaply.
+
+const (
+	displayDefaultMaxNames = 6
+	displayDefaultWidth    = 296
+	displayDefaultHeight   = 128
+	displayCacheSeconds    = 60
+)
+
+// DisplaySummary is the JSON form of /display/summary
+type DisplaySummary struct {
+	Open       bool     `json:"open"`
+	Count      int      `json:"count"`
+	Names      []string `json:"names"`       // Oldest sign-in first, at most max_names; empty in the public view
+	More       int      `json:"more"`        // People inside not listed in names
+	OpenedAt   string   `json:"opened_at"`   // Local HH:MM of the first opening today, "" if closed all day
+	HoursToday string   `json:"hours_today"` // Time open today as H:MM
+	Updated    string   `json:"updated"`     // Local HH:MM the summary is for
+}
+
+// buildDisplaySummary gathers the display content for a view at now
+func buildDisplaySummary(now time.Time, view string, maxNames int) (DisplaySummary, error) {
+	today, err := todayStatus(now)
+	if err != nil {
+		return DisplaySummary{}, err
+	}
+
+	attendees := currentAttendees.list()
+	sort.Slice(attendees, func(i, j int) bool { return attendees[i].SignInTime.Before(attendees[j].SignInTime) })
+
+	summary := DisplaySummary{
+		Open:       len(attendees) > 0,
+		Count:      len(attendees),
+		Names:      []string{},
+		HoursToday: fmt.Sprintf("%d:%02d", today.OpenSeconds/3600, today.OpenSeconds%3600/60),
+		Updated:    now.Format("15:04"),
+	}
+	if today.OpenedAt != nil {
+		summary.OpenedAt = today.OpenedAt.Local().Format("15:04")
+	}
+
+	if view != scopePublic {
+		for _, a := range attendees {
+			if len(summary.Names) == maxNames {
+				break
+			}
+			member, _ := memberCache.get(a.UID)
+			if memberOrg(member) != defaultOrg {
+				continue // Counted, but other organizations' names stay off the wall display
+			}
+			if name := publicName(member, view); name != "" {
+				summary.Names = append(summary.Names, name)
+			}
+		}
+	}
+	summary.More = summary.Count - len(summary.Names)
+	return summary, nil
+}
+
+// wrapWords splits text into lines of at most width pixels at a scale,
+// breaking at spaces
+func wrapWords(text string, width, scale int) []string {
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if line != "" && textWidth(candidate, scale) > width {
+			lines = append(lines, line)
+			candidate = word
+		}
+		line = candidate
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// renderDisplaySummary draws a summary as a 1-bit PNG of the given size
+func renderDisplaySummary(s DisplaySummary, width, height int) ([]byte, error) {
+	img := image.NewPaletted(image.Rect(0, 0, width, height), color.Palette{color.White, color.Black})
+	const pad = 4
+
+	// Header: state and time
+	y := pad
+	state := "CLOSED"
+	if s.Open {
+		state = "OPEN"
+	}
+	drawText(img, pad, y, 2, state)
+	drawText(img, width-pad-textWidth(s.Updated, 2), y, 2, s.Updated)
+	y += glyphHeight*2 + 6
+
+	// Count, large
+	count := strconv.Itoa(s.Count)
+	drawText(img, pad, y, 4, count)
+	label := "INSIDE"
+	drawText(img, pad+textWidth(count, 4)+8, y+glyphHeight*2, 2, label)
+	y += glyphHeight*4 + 6
+
+	// Footer: hours open today
+	footer := "TODAY " + s.HoursToday
+	if s.OpenedAt != "" {
+		footer += "  SINCE " + s.OpenedAt
+	}
+	footerY := height - pad - glyphHeight
+	drawText(img, pad, footerY, 1, footer)
+
+	// Names in between, as many lines as fit
+	names := strings.Join(s.Names, ", ")
+	if s.More > 0 && len(s.Names) > 0 {
+		names += fmt.Sprintf(" +%d", s.More)
+	}
+	lineHeight := glyphHeight + 3
+	for _, line := range wrapWords(names, width-2*pad, 1) {
+		if y+glyphHeight > footerY-2 {
+			break
+		}
+		drawText(img, pad, y, 1, line)
+		y += lineHeight
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// displayIntParam parses an optional integer query parameter within bounds
+func displayIntParam(w http.ResponseWriter, r *http.Request, name string, def, min, max int) (int, bool) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, true
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < min || n > max {
+		http.Error(w, fmt.Sprintf("Invalid '%s' parameter, expected an integer between %d and %d", name, min, max), http.StatusBadRequest)
+		return 0, false
+	}
+	return n, true
+}
+
+// handleDisplaySummary serves the door sign summary
+// Query parameters:
+//   - format: json (default) or png
+//   - view: public (no names), member (initials) or admin (names), limited by the key's scope
+//   - max_names: names listed at most (default 6)
+//   - width, height: PNG size in pixels (default 296x128)
+func handleDisplaySummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	view, ok := resolveView(w, r)
+	if !ok {
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "png" {
+		http.Error(w, "Invalid 'format' parameter, expected json or png", http.StatusBadRequest)
+		return
+	}
+	maxNames, ok := displayIntParam(w, r, "max_names", displayDefaultMaxNames, 0, 50)
+	if !ok {
+		return
+	}
+	width, ok := displayIntParam(w, r, "width", displayDefaultWidth, 64, 1600)
+	if !ok {
+		return
+	}
+	height, ok := displayIntParam(w, r, "height", displayDefaultHeight, 32, 1200)
+	if !ok {
+		return
+	}
+
+	summary, err := buildDisplaySummary(time.Now(), view, maxNames)
+	if err != nil {
+		log.Printf("Error building display summary: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var body []byte
+	contentType := "application/json"
+	if format == "png" {
+		contentType = "image/png"
+		if body, err = renderDisplaySummary(summary, width, height); err != nil {
+			log.Printf("Error rendering display summary: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	} else {
+		body, _ = json.Marshal(summary)
+	}
+
+	sum := sha256.Sum256(body)
+	etag := fmt.Sprintf(`"%x"`, sum[:8])
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", displayCacheSeconds))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.Write(body)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /display/summary Endpoint Tests
+// ============================================================================
+
+// displaySummary calls /display/summary with a scope and returns the response
+func displaySummary(url, scope string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handleDisplaySummary(rr, scopedRequest("GET", url, scope))
+	return rr
+}
+
+func TestHandleDisplaySummary_JSON(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-time.Minute))
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-2*time.Minute))
+
+	rr := displaySummary("/display/summary", scopeAdmin)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var s DisplaySummary
+	if err := json.Unmarshal(rr.Body.Bytes(), &s); err != nil {
+		t.Fatalf("failed to parse summary: %v", err)
+	}
+	if !s.Open || s.Count != 2 || s.More != 0 {
+		t.Errorf("expected the office open with 2 inside, got %+v", s)
+	}
+	if len(s.Names) != 2 || s.Names[0] != "Alice" || s.Names[1] != "Bob" {
+		t.Errorf("expected Alice then Bob by sign-in time, got %v", s.Names)
+	}
+	if s.Updated != now.Format("15:04") && s.Updated != time.Now().Format("15:04") {
+		t.Errorf("expected the local time, got %q", s.Updated)
+	}
+}
+
+func TestHandleDisplaySummary_Views(t *testing.T) {
+	setupTest()
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-time.Minute))
+	currentAttendees.signIn("TEST_UID_2", "", time.Now())
+
+	var s DisplaySummary
+	json.Unmarshal(displaySummary("/display/summary", scopeMember).Body.Bytes(), &s)
+	if len(s.Names) != 2 || s.Names[0] != "A." {
+		t.Errorf("expected initials in the member view, got %v", s.Names)
+	}
+
+	json.Unmarshal(displaySummary("/display/summary", scopePublic).Body.Bytes(), &s)
+	if len(s.Names) != 0 || s.Count != 2 || s.More != 2 {
+		t.Errorf("expected a count without names in the public view, got %+v", s)
+	}
+
+	json.Unmarshal(displaySummary("/display/summary?max_names=1", scopeAdmin).Body.Bytes(), &s)
+	if len(s.Names) != 1 || s.More != 1 {
+		t.Errorf("expected one name and one more, got %+v", s)
+	}
+
+	if rr := displaySummary("/display/summary?view=admin", scopeMember); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a view above the key's scope, got %v", rr.Code)
+	}
+}
+
+func TestHandleDisplaySummary_PNG(t *testing.T) {
+	setupTest()
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+
+	rr := displaySummary("/display/summary?format=png&width=200&height=100", scopeAdmin)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if ct := rr.Header().Get("Content-Type"); ct != "image/png" {
+		t.Errorf("expected image/png, got %q", ct)
+	}
+
+	// IHDR: bit depth 1, palette colour type
+	body := rr.Body.Bytes()
+	if len(body) < 26 || body[24] != 1 || body[25] != 3 {
+		t.Fatalf("expected a 1-bit paletted PNG")
+	}
+	img, err := png.Decode(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("failed to decode PNG: %v", err)
+	}
+	if img.Bounds() != image.Rect(0, 0, 200, 100) {
+		t.Errorf("expected 200x100, got %v", img.Bounds())
+	}
+
+	// Something was drawn
+	black := 0
+	for y := 0; y < 100; y++ {
+		for x := 0; x < 200; x++ {
+			if r, _, _, _ := img.At(x, y).RGBA(); r == 0 {
+				black++
+			}
+		}
+	}
+	if black == 0 {
+		t.Error("expected text to be drawn")
+	}
+}
+
+func TestHandleDisplaySummary_NotModified(t *testing.T) {
+	setupTest()
+
+	rr := displaySummary("/display/summary", scopeAdmin)
+	etag := rr.Header().Get("ETag")
+	if etag == "" || rr.Header().Get("Cache-Control") == "" {
+		t.Fatalf("expected ETag and Cache-Control headers, got %v", rr.Header())
+	}
+
+	req := scopedRequest("GET", "/display/summary", scopeAdmin)
+	req.Header.Set("If-None-Match", etag)
+	rr = httptest.NewRecorder()
+	handleDisplaySummary(rr, req)
+
+	// The summary changes when the minute does, giving a new ETag
+	if rr.Header().Get("ETag") != etag {
+		t.Skip("the minute changed between requests")
+	}
+	if rr.Code != http.StatusNotModified || rr.Body.Len() != 0 {
+		t.Errorf("expected 304 Not Modified without a body, got %v %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleDisplaySummary_InvalidParams(t *testing.T) {
+	setupTest()
+
+	for _, url := range []string{
+		"/display/summary?format=bmp",
+		"/display/summary?max_names=-1",
+		"/display/summary?width=10",
+		"/display/summary?height=abc",
+	} {
+		if rr := displaySummary(url, scopeAdmin); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", url, rr.Code)
+		}
+	}
+}
+
+func TestWrapWords(t *testing.T) {
+	lines := wrapWords("Alice Lee, Bob Smith", textWidth("Alice Lee,", 1), 1)
+	if len(lines) != 2 || lines[0] != "Alice Lee," || lines[1] != "Bob Smith" {
+		t.Errorf("expected two lines, got %q", lines)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"image"
+	"unicode"
+)
+
+// --- Display Bitmap Font ---
+//
+// A 5x7 pixel font for the 1-bit display images, so they can be drawn without
+// a font library. It has upper-case letters, digits and common punctuation;
+// lower-case and accented letters are drawn as their plain upper-case form
+// and other characters as '?'.
+
+const (
+	glyphWidth   = 5
+	glyphHeight  = 7
+	glyphAdvance = glyphWidth + 1 // One blank column between characters
+)
+
+// displayGlyphs holds each character as 7 rows of 5 pixels, '1' being black
+var displayGlyphs = map[rune][glyphHeight]string{
+	'A':  {"01110", "10001", "10001", "11111", "10001", "10001", "10001"},
+	'B':  {"11110", "10001", "10001", "11110", "10001", "10001", "11110"},
+	'C':  {"01110", "10001", "10000", "10000", "10000", "10001", "01110"},
+	'D':  {"11110", "10001", "10001", "10001", "10001", "10001", "11110"},
+	'E':  {"11111", "10000", "10000", "11110", "10000", "10000", "11111"},
+	'F':  {"11111", "10000", "10000", "11110", "10000", "10000", "10000"},
+	'G':  {"01110", "10001", "10000", "10111", "10001", "10001", "01111"},
+	'H':  {"10001", "10001", "10001", "11111", "10001", "10001", "10001"},
+	'I':  {"01110", "00100", "00100", "00100", "00100", "00100", "01110"},
+	'J':  {"00111", "00010", "00010", "00010", "00010", "10010", "01100"},
+	'K':  {"10001", "10010", "10100", "11000", "10100", "10010", "10001"},
+	'L':  {"10000", "10000", "10000", "10000", "10000", "10000", "11111"},
+	'M':  {"10001", "11011", "10101", "10101", "10001", "10001", "10001"},
+	'N':  {"10001", "10001", "11001", "10101", "10011", "10001", "10001"},
+	'O':  {"01110", "10001", "10001", "10001", "10001", "10001", "01110"},
+	'P':  {"11110", "10001", "10001", "11110", "10000", "10000", "10000"},
+	'Q':  {"01110", "10001", "10001", "10001", "10101", "10010", "01101"},
+	'R':  {"11110", "10001", "10001", "11110", "10100", "10010", "10001"},
+	'S':  {"01111", "10000", "10000", "01110", "00001", "00001", "11110"},
+	'T':  {"11111", "00100", "00100", "00100", "00100", "00100", "00100"},
+	'U':  {"10001", "10001", "10001", "10001", "10001", "10001", "01110"},
+	'V':  {"10001", "10001", "10001", "10001", "10001", "01010", "00100"},
+	'W':  {"10001", "10001", "10001", "10101", "10101", "10101", "01010"},
+	'X':  {"10001", "10001", "01010", "00100", "01010", "10001", "10001"},
+	'Y':  {"10001", "10001", "10001", "01010", "00100", "00100", "00100"},
+	'Z':  {"11111", "00001", "00010", "00100", "01000", "10000", "11111"},
+	'0':  {"01110", "10001", "10011", "10101", "11001", "10001", "01110"},
+	'1':  {"00100", "01100", "00100", "00100", "00100", "00100", "01110"},
+	'2':  {"01110", "10001", "00001", "00010", "00100", "01000", "11111"},
+	'3':  {"11111", "00010", "00100", "00010", "00001", "10001", "01110"},
+	'4':  {"00010", "00110", "01010", "10010", "11111", "00010", "00010"},
+	'5':  {"11111", "10000", "11110", "00001", "00001", "10001", "01110"},
+	'6':  {"00110", "01000", "10000", "11110", "10001", "10001", "01110"},
+	'7':  {"11111", "00001", "00010", "00100", "01000", "01000", "01000"},
+	'8':  {"01110", "10001", "10001", "01110", "10001", "10001", "01110"},
+	'9':  {"01110", "10001", "10001", "01111", "00001", "00010", "01100"},
+	' ':  {"00000", "00000", "00000", "00000", "00000", "00000", "00000"},
+	'.':  {"00000", "00000", "00000", "00000", "00000", "01100", "01100"},
+	',':  {"00000", "00000", "00000", "00000", "01100", "00100", "01000"},
+	':':  {"00000", "01100", "01100", "00000", "01100", "01100", "00000"},
+	'-':  {"00000", "00000", "00000", "11111", "00000", "00000", "00000"},
+	'\'': {"01100", "00100", "01000", "00000", "00000", "00000", "00000"},
+	'+':  {"00000", "00100", "00100", "11111", "00100", "00100", "00000"},
+	'?':  {"01110", "10001", "00001", "00010", "00100", "00000", "00100"},
+	'!':  {"00100", "00100", "00100", "00100", "00100", "00000", "00100"},
+	'/':  {"00000", "00001", "00010", "00100", "01000", "10000", "00000"},
+	'(':  {"00010", "00100", "01000", "01000", "01000", "00100", "00010"},
+	')':  {"01000", "00100", "00010", "00010", "00010", "00100", "01000"},
+	'&':  {"01100", "10010", "10100", "01000", "10101", "10010", "01101"},
+}
+
+// glyphFolds maps accented capitals to the letter drawn for them
+var glyphFolds = map[rune]rune{
+	'À': 'A', 'Á': 'A', 'Â': 'A', 'Ã': 'A', 'Ä': 'A',
+	'Ç': 'C',
+	'È': 'E', 'É': 'E', 'Ê': 'E', 'Ë': 'E',
+	'Ì': 'I', 'Í': 'I', 'Î': 'I', 'Ï': 'I',
+	'Ñ': 'N',
+	'Ò': 'O', 'Ó': 'O', 'Ô': 'O', 'Õ': 'O', 'Ö': 'O',
+	'Ù': 'U', 'Ú': 'U', 'Û': 'U', 'Ü': 'U',
+	'Ý': 'Y', 'Ÿ': 'Y',
+}
+
+// glyphFor returns the glyph drawn for a character
+func glyphFor(r rune) [glyphHeight]string {
+	r = unicode.ToUpper(r)
+	if folded, ok := glyphFolds[r]; ok {
+		r = folded
+	}
+	if g, ok := displayGlyphs[r]; ok {
+		return g
+	}
+	return displayGlyphs['?']
+}
+
+// textWidth returns the width in pixels of s drawn at a scale
+func textWidth(s string, scale int) int {
+	n := len([]rune(s))
+	if n == 0 {
+		return 0
+	}
+	return (n*glyphAdvance - 1) * scale
+}
+
+// drawText draws s in black with its top-left corner at (x, y), each font
+// pixel being a scale x scale square; pixels outside the image are dropped
+func drawText(img *image.Paletted, x, y, scale int, s string) {
+	for _, r := range s {
+		glyph := glyphFor(r)
+		for row, bits := range glyph {
+			for col, bit := range bits {
+				if bit != '1' {
+					continue
+				}
+				for dy := 0; dy < scale; dy++ {
+					for dx := 0; dx < scale; dx++ {
+						img.SetColorIndex(x+col*scale+dx, y+row*scale+dy, 1)
+					}
+				}
+			}
+		}
+		x += glyphAdvance * scale
+	}
+}
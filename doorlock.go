@@ -0,0 +1,322 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Door Lock ---
+//
+// With DOOR_RELAY_URL set, a successful scan also unlocks the office door
+// for DOOR_UNLOCK_SECONDS (default 5) by calling the relay controller:
+//   - http(s)://host/path: POST {"action": "unlock", "seconds", "room",
+//     "device"} as JSON, with DOOR_RELAY_TOKEN as a bearer token if set; any
+//     2xx answer counts as unlocked
+//   - mqtt(s)://[user:password@]host[:port]/topic: the same JSON published
+//     to the topic with QoS 1, unlocked once the broker acknowledges it
+//
+// Only members whose role is in DOOR_ACCESS_ROLES (default member, exec and
+// officer, so not guests) unlock the door, or once access rules exist, those
+// a rule allows (see accessrules.go); others are still signed in and out. Every attempt is written to the audit log as door.unlocked,
+// door.denied or door.unlock_failed. The relay is called before the scan is
+// answered, so it is given doorRelayTimeout at most.
+
+const (
+	defaultDoorUnlockSeconds = 5
+	maxDoorUnlockSeconds     = 60
+	doorRelayTimeout         = 3 * time.Second
+	mqttClientID             = "ieee-office-backend"
+)
+
+// defaultDoorAccessRoles are the roles that unlock the door without DOOR_ACCESS_ROLES
+var defaultDoorAccessRoles = []string{roleMember, roleExec, roleOfficer}
+
+// doorRelayConfig is the configured relay controller
+type doorRelayConfig struct {
+	url     *url.URL
+	token   string // Bearer token for HTTP relays
+	seconds int
+	roles   map[string]bool
+}
+
+// doorRelay is the relay controller, nil when door control is off
+var doorRelay *doorRelayConfig
+
+// loadDoorRelay reads DOOR_RELAY_URL, DOOR_RELAY_TOKEN, DOOR_UNLOCK_SECONDS
+// and DOOR_ACCESS_ROLES
+func loadDoorRelay() (*doorRelayConfig, error) {
+	raw := os.Getenv("DOOR_RELAY_URL")
+	if raw == "" {
+		return nil, nil
+	}
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		// Not echoed, since it may hold the broker's password
+		return nil, errors.New("invalid DOOR_RELAY_URL")
+	}
+	switch u.Scheme {
+	case "http", "https":
+	case "mqtt", "mqtts":
+		if strings.Trim(u.Path, "/") == "" {
+			return nil, fmt.Errorf("missing topic in DOOR_RELAY_URL %q", u.Redacted())
+		}
+	default:
+		return nil, fmt.Errorf("unsupported scheme %q, expected http, https, mqtt or mqtts", u.Scheme)
+	}
+
+	relay := &doorRelayConfig{url: u, token: os.Getenv("DOOR_RELAY_TOKEN"), seconds: defaultDoorUnlockSeconds, roles: make(map[string]bool)}
+	if value := os.Getenv("DOOR_UNLOCK_SECONDS"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxDoorUnlockSeconds {
+			return nil, fmt.Errorf("invalid DOOR_UNLOCK_SECONDS %q, expected 1 to %d", value, maxDoorUnlockSeconds)
+		}
+		relay.seconds = n
+	}
+
+	roles := defaultDoorAccessRoles
+	if value := os.Getenv("DOOR_ACCESS_ROLES"); value != "" {
+		roles = strings.Split(value, ",")
+	}
+	for _, role := range roles {
+		normalized, ok := normalizeRole(role)
+		if !ok {
+			return nil, fmt.Errorf("unknown role %q in DOOR_ACCESS_ROLES", strings.TrimSpace(role))
+		}
+		relay.roles[normalized] = true
+	}
+	return relay, nil
+}
+
+// doorUnlockRequest is what the relay controller is sent
+type doorUnlockRequest struct {
+	Action  string `json:"action"`
+	Seconds int    `json:"seconds"`
+	Room    string `json:"room"`
+	Device  string `json:"device,omitempty"`
+}
+
+// unlockDoor is the post-sign-in and post-sign-out hook that opens the door
+// for members allowed to
+func unlockDoor(sc *ScanContext) error {
+	relay := doorRelay
+	if relay == nil {
+		return nil
+	}
+
+	room := sc.Room
+	if room == "" {
+		room = defaultRoom
+	}
+	device := ""
+	if sc.Device != nil {
+		device = sc.Device.Name
+	}
+	detail := fmt.Sprintf("member=%d room=%s device=%q", sc.Member.ID, room, device)
+
+	access, err := evaluateDoorAccess(relay, sc.Member, room, sc.Time)
+	if err != nil {
+		return fmt.Errorf("door access: %w", err)
+	}
+	if !access.Allowed {
+		role, _ := normalizeRole(sc.Member.Role)
+		recordAudit("door.denied", sc.Member.Name, fmt.Sprintf("%s role=%s reason=%q", detail, role, access.Reason))
+		incCounter("door_denied_total")
+		logHTTP.infof("Door not unlocked for %s: %s", sc.Member.Name, access.Reason)
+		return nil
+	}
+	if access.Rule != nil {
+		detail += fmt.Sprintf(" rule=%d", access.Rule.ID)
+	} else if access.Grant != nil {
+		detail += fmt.Sprintf(" grant=%d", access.Grant.ID)
+	}
+
+	body, _ := json.Marshal(doorUnlockRequest{Action: "unlock", Seconds: relay.seconds, Room: room, Device: device})
+	if err := relay.send(body); err != nil {
+		recordAudit("door.unlock_failed", sc.Member.Name, detail+" error="+err.Error())
+		incCounter("door_unlock_failures_total")
+		return fmt.Errorf("door relay: %w", err)
+	}
+	recordAudit("door.unlocked", sc.Member.Name, fmt.Sprintf("%s seconds=%d", detail, relay.seconds))
+	incCounter("door_unlocks_total")
+	return nil
+}
+
+// send delivers an unlock request to the relay controller
+func (d *doorRelayConfig) send(body []byte) error {
+	if d.url.Scheme == "mqtt" || d.url.Scheme == "mqtts" {
+		return d.publishMQTT(body)
+	}
+
+	req, err := http.NewRequest(http.MethodPost, d.url.String(), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if d.token != "" {
+		req.Header.Set("Authorization", "Bearer "+d.token)
+	}
+	client := &http.Client{Timeout: doorRelayTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("relay answered %s", resp.Status)
+	}
+	return nil
+}
+
+// --- MQTT ---
+//
+// Only what publishing one message needs of MQTT 3.1.1: CONNECT, PUBLISH
+// with QoS 1 and DISCONNECT, on a connection opened for each unlock.
+
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublishQoS = 0x32 // PUBLISH, QoS 1
+	mqttPuback     = 0x40
+	mqttDisconnect = 0xe0
+)
+
+// appendMQTTString appends a length-prefixed UTF-8 string
+func appendMQTTString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+// mqttPacket frames a packet: type and flags, remaining length, body
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		if n /= 128; n > 0 {
+			digit |= 0x80
+		}
+		packet = append(packet, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// readMQTTPacket reads a packet's type byte and body
+func readMQTTPacket(rd *bufio.Reader) (byte, []byte, error) {
+	header, err := rd.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, shift := 0, 0
+	for {
+		digit, err := rd.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length |= int(digit&0x7f) << shift
+		if digit&0x80 == 0 {
+			break
+		}
+		if shift += 7; shift > 21 {
+			return 0, nil, errors.New("mqtt: invalid remaining length")
+		}
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(rd, body)
+	return header, body, err
+}
+
+// mqttAddr returns the broker's host:port
+func (d *doorRelayConfig) mqttAddr() string {
+	if d.url.Port() != "" {
+		return d.url.Host
+	}
+	port := "1883"
+	if d.url.Scheme == "mqtts" {
+		port = "8883"
+	}
+	return net.JoinHostPort(d.url.Hostname(), port)
+}
+
+// publishMQTT publishes a message to the relay's topic and waits for the
+// broker's acknowledgment
+func (d *doorRelayConfig) publishMQTT(payload []byte) error {
+	addr := d.mqttAddr()
+	dialer := &net.Dialer{Timeout: doorRelayTimeout}
+	var conn net.Conn
+	var err error
+	if d.url.Scheme == "mqtts" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(doorRelayTimeout))
+	rd := bufio.NewReader(conn)
+
+	// CONNECT: protocol name and level, flags, keep alive, then the payload
+	connect := appendMQTTString(nil, "MQTT")
+	flags := byte(0x02) // Clean session
+	var credentials []byte
+	if d.url.User != nil {
+		flags |= 0x80
+		credentials = appendMQTTString(credentials, d.url.User.Username())
+		if password, ok := d.url.User.Password(); ok {
+			flags |= 0x40
+			credentials = appendMQTTString(credentials, password)
+		}
+	}
+	connect = append(connect, 4, flags, 0, 30)
+	connect = appendMQTTString(connect, mqttClientID)
+	connect = append(connect, credentials...)
+	if _, err := conn.Write(mqttPacket(mqttConnect, connect)); err != nil {
+		return err
+	}
+	header, body, err := readMQTTPacket(rd)
+	if err != nil {
+		return err
+	}
+	if header != mqttConnack || len(body) != 2 {
+		return fmt.Errorf("mqtt: expected CONNACK, got packet type %d", header>>4)
+	}
+	if body[1] != 0 {
+		return fmt.Errorf("mqtt: connection refused (code %d)", body[1])
+	}
+
+	// PUBLISH with packet identifier 1, acknowledged by PUBACK
+	publish := appendMQTTString(nil, strings.TrimPrefix(d.url.Path, "/"))
+	publish = append(publish, 0, 1)
+	publish = append(publish, payload...)
+	if _, err := conn.Write(mqttPacket(mqttPublishQoS, publish)); err != nil {
+		return err
+	}
+	header, body, err = readMQTTPacket(rd)
+	if err != nil {
+		return err
+	}
+	if header != mqttPuback || len(body) != 2 || binary.BigEndian.Uint16(body) != 1 {
+		return fmt.Errorf("mqtt: expected PUBACK, got packet type %d", header>>4)
+	}
+
+	conn.Write(mqttPacket(mqttDisconnect, nil))
+	return nil
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Door Lock Tests
+// ============================================================================
+
+func TestLoadDoorRelay(t *testing.T) {
+	t.Setenv("DOOR_RELAY_URL", "")
+	if relay, err := loadDoorRelay(); relay != nil || err != nil {
+		t.Errorf("expected door control off, got %+v %v", relay, err)
+	}
+
+	t.Setenv("DOOR_RELAY_URL", "mqtt://broker.local/office/door")
+	relay, err := loadDoorRelay()
+	if err != nil || relay.seconds != defaultDoorUnlockSeconds || !relay.roles[roleExec] || relay.roles[roleGuest] || relay.mqttAddr() != "broker.local:1883" {
+		t.Errorf("expected the defaults, got %+v %v", relay, err)
+	}
+
+	for env, value := range map[string]string{
+		"DOOR_RELAY_URL":      "ftp://relay.local/door",
+		"DOOR_UNLOCK_SECONDS": "90",
+		"DOOR_ACCESS_ROLES":   "exec,janitor",
+	} {
+		t.Run(env, func(t *testing.T) {
+			t.Setenv(env, value)
+			if _, err := loadDoorRelay(); err == nil {
+				t.Errorf("expected %s=%s rejected", env, value)
+			}
+		})
+	}
+	t.Setenv("DOOR_RELAY_URL", "mqtt://broker.local")
+	if _, err := loadDoorRelay(); err == nil {
+		t.Error("expected an MQTT URL without a topic rejected")
+	}
+}
+
+func TestUnlockDoor_HTTP(t *testing.T) {
+	setupTest()
+
+	var got doorUnlockRequest
+	var auth string
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&got)
+	}))
+	defer relay.Close()
+	t.Setenv("DOOR_RELAY_URL", relay.URL+"/unlock")
+	t.Setenv("DOOR_RELAY_TOKEN", "relay-secret")
+	t.Setenv("DOOR_UNLOCK_SECONDS", "8")
+	doorRelay, _ = loadDoorRelay()
+
+	if rr := scanCard("TEST_UID_1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if got != (doorUnlockRequest{Action: "unlock", Seconds: 8, Room: defaultRoom}) || auth != "Bearer relay-secret" {
+		t.Errorf("unexpected relay request %+v (%q)", got, auth)
+	}
+	if entries, _ := loadAuditEntries("door.unlocked", 10); len(entries) != 1 || entries[0].Actor != "Alice" {
+		t.Errorf("expected the unlock audited, got %+v", entries)
+	}
+}
+
+func TestUnlockDoor_DeniedRole(t *testing.T) {
+	setupTest()
+
+	calls := 0
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { calls++ }))
+	defer relay.Close()
+	t.Setenv("DOOR_RELAY_URL", relay.URL)
+	doorRelay, _ = loadDoorRelay()
+
+	bob, _ := memberCache.get("TEST_UID_2")
+	bob.Role = roleGuest
+	memberCache.put(bob)
+
+	// Still signed in, but the door stays locked
+	if rr := scanCard("TEST_UID_2"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if calls != 0 {
+		t.Errorf("expected the relay not called, got %d calls", calls)
+	}
+	if entries, _ := loadAuditEntries("door.denied", 10); len(entries) != 1 || !strings.Contains(entries[0].Detail, "role=guest") {
+		t.Errorf("expected the denial audited, got %+v", entries)
+	}
+}
+
+func TestUnlockDoor_RelayFailure(t *testing.T) {
+	setupTest()
+
+	relay := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "jammed", http.StatusServiceUnavailable)
+	}))
+	defer relay.Close()
+	t.Setenv("DOOR_RELAY_URL", relay.URL)
+	doorRelay, _ = loadDoorRelay()
+
+	if rr := scanCard("TEST_UID_1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected the scan to succeed anyway, got %v", rr.Code)
+	}
+	if entries, _ := loadAuditEntries("door.unlock_failed", 10); len(entries) != 1 || !strings.Contains(entries[0].Detail, "503") {
+		t.Errorf("expected the failure audited, got %+v", entries)
+	}
+}
+
+func TestUnlockDoor_MQTT(t *testing.T) {
+	setupTest()
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	// A broker that accepts one client and acknowledges its publish
+	type published struct {
+		user, topic string
+		payload     []byte
+	}
+	received := make(chan published, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		rd := bufio.NewReader(conn)
+
+		header, connect, err := readMQTTPacket(rd)
+		if err != nil || header != mqttConnect {
+			return
+		}
+		// Protocol name, level, flags, keep alive, client ID, then the username
+		rest := connect[10:]
+		rest = rest[2+binary.BigEndian.Uint16(rest):]
+		user := string(rest[2 : 2+binary.BigEndian.Uint16(rest)])
+		conn.Write(mqttPacket(mqttConnack, []byte{0, 0}))
+
+		header, publish, err := readMQTTPacket(rd)
+		if err != nil || header != mqttPublishQoS {
+			return
+		}
+		n := binary.BigEndian.Uint16(publish)
+		topic, id := string(publish[2:2+n]), publish[2+n:4+n]
+		conn.Write(mqttPacket(mqttPuback, id))
+		received <- published{user, topic, publish[4+n:]}
+	}()
+
+	t.Setenv("DOOR_RELAY_URL", "mqtt://relay:secret@"+ln.Addr().String()+"/office/door")
+	doorRelay, _ = loadDoorRelay()
+	scanCard("TEST_UID_1")
+
+	select {
+	case p := <-received:
+		var req doorUnlockRequest
+		json.Unmarshal(p.payload, &req)
+		if p.user != "relay" || p.topic != "office/door" || req.Action != "unlock" || req.Seconds != defaultDoorUnlockSeconds {
+			t.Errorf("unexpected publish %+v (%s)", p, p.payload)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the unlock published")
+	}
+	if entries, _ := loadAuditEntries("door.unlocked", 10); len(entries) != 1 {
+		t.Errorf("expected the unlock audited, got %+v", entries)
+	}
+}
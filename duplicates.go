@@ -0,0 +1,275 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// --- Duplicate Members ---
+//
+// /admin/duplicates lists members that are probably the same person: members
+// sharing a Discord ID and members with near-identical names. A duplicate is
+// resolved with POST /members/{id}/merge?into={target}, which moves its visits
+// and goals to the target and soft-deletes it. The duplicate's card UID keeps
+// working and now resolves to the target (see loadMembersIntoCache).
+
+// maxNameDistance is the edit distance under which two normalized names are
+// considered near-identical
+const maxNameDistance = 2
+
+// DuplicateGroup is a set of members that are likely the same person
+type DuplicateGroup struct {
+	Reason  string   `json:"reason"` // "discord_id" or "name"
+	Members []Member `json:"members"`
+}
+
+// MergeResponse is the response of a successful merge
+type MergeResponse struct {
+	Message     string `json:"message"`
+	Member      Member `json:"member"`
+	VisitsMoved int64  `json:"visits_moved"`
+}
+
+// normalizeName lower-cases a name and keeps only letters and digits separated by single spaces
+func normalizeName(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Fields(strings.ToLower(name)) {
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		for _, r := range word {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				b.WriteRune(r)
+			}
+		}
+	}
+	return b.String()
+}
+
+// editDistance returns the Levenshtein distance between two strings
+func editDistance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(rb)]
+}
+
+// similarNames reports whether two names are near-identical. Short names must
+// match exactly after normalization to avoid pairing e.g. "Al" and "Ed".
+func similarNames(a, b string) bool {
+	na, nb := normalizeName(a), normalizeName(b)
+	if na == "" || nb == "" {
+		return false
+	}
+	if na == nb {
+		return true
+	}
+	if len([]rune(na)) < 6 || len([]rune(nb)) < 6 {
+		return false
+	}
+	return editDistance(na, nb) <= maxNameDistance
+}
+
+// findDuplicates groups active members by shared Discord ID and pairs members with similar names
+func findDuplicates(members []Member) []DuplicateGroup {
+	sort.Slice(members, func(i, j int) bool { return members[i].ID < members[j].ID })
+
+	groups := []DuplicateGroup{}
+	byDiscord := make(map[string][]Member)
+	var discordIDs []string
+	for _, m := range members {
+		if m.DiscordID == "" {
+			continue
+		}
+		if _, seen := byDiscord[m.DiscordID]; !seen {
+			discordIDs = append(discordIDs, m.DiscordID)
+		}
+		byDiscord[m.DiscordID] = append(byDiscord[m.DiscordID], m)
+	}
+	for _, id := range discordIDs {
+		if len(byDiscord[id]) > 1 {
+			groups = append(groups, DuplicateGroup{Reason: "discord_id", Members: byDiscord[id]})
+		}
+	}
+
+	for i := range members {
+		for j := i + 1; j < len(members); j++ {
+			if similarNames(members[i].Name, members[j].Name) {
+				groups = append(groups, DuplicateGroup{Reason: "name", Members: []Member{members[i], members[j]}})
+			}
+		}
+	}
+	return groups
+}
+
+// handleDuplicates lists likely duplicate members
+func handleDuplicates(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	rows, err := db.Query(`SELECT id, name, uid, discord_id, role, status, org_id FROM members WHERE deleted_at IS NULL`)
+	if err != nil {
+		log.Printf("Error querying members: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+
+	var members []Member
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.ID, &m.Name, &m.UID, decrypted{&m.DiscordID}, &m.Role, &m.Status, &m.OrgID); err != nil {
+			log.Printf("Error scanning member row: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		members = append(members, m)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(findDuplicates(members))
+}
+
+// handleMemberMerge merges member id into the member given by ?into=
+func handleMemberMerge(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var intoID int64
+	if n, err := fmt.Sscanf(r.URL.Query().Get("into"), "%d", &intoID); err != nil || n != 1 || intoID < 1 {
+		http.Error(w, "Invalid 'into' parameter, expected positive integer", http.StatusBadRequest)
+		return
+	}
+	if intoID == id {
+		http.Error(w, "Cannot merge a member into itself", http.StatusBadRequest)
+		return
+	}
+
+	duplicate, found := findMemberByID(id)
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	target, found := findMemberByID(intoID)
+	if !found || !inRequestOrg(r, target) {
+		http.Error(w, "Target member not found", http.StatusNotFound)
+		return
+	}
+
+	_, isSignedIn, err := currentAttendees.get(duplicate.UID)
+	if err != nil {
+		writeSignInOutError(w, fmt.Errorf("%w: %v", errAttendeeStore, err))
+		return
+	}
+	if isSignedIn {
+		http.Error(w, "Cannot merge a member who is currently signed in", http.StatusConflict)
+		return
+	}
+
+	visitsMoved, err := mergeMembers(duplicate.ID, target.ID)
+	if err != nil {
+		log.Printf("Error merging member %d into %d: %v", duplicate.ID, target.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	memberCache.merge(duplicate.ID, target)
+
+	msg := fmt.Sprintf("Merged %s (%d) into %s (%d), %d visits moved", duplicate.Name, duplicate.ID, target.Name, target.ID, visitsMoved)
+	log.Println(msg)
+	recordAudit("member.merged", clientIP(r), msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(MergeResponse{Message: msg, Member: target, VisitsMoved: visitsMoved})
+}
+
+// mergeMembers moves a duplicate's visits and goals to the target and soft-deletes it
+func mergeMembers(duplicateID, targetID int64) (int64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var moved []int64
+	if sessionLedgerKey != nil {
+		rows, err := tx.Query(`SELECT id FROM visits WHERE member_id = ?`, duplicateID)
+		if err != nil {
+			return 0, err
+		}
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return 0, err
+			}
+			moved = append(moved, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return 0, err
+		}
+	}
+	res, err := tx.Exec(`UPDATE visits SET member_id = ? WHERE member_id = ?`, targetID, duplicateID)
+	if err != nil {
+		return 0, err
+	}
+	visitsMoved, _ := res.RowsAffected()
+	for _, id := range moved {
+		if err := appendLedgerEntries(tx, "visit.updated", "id = ?", id); err != nil {
+			return 0, err
+		}
+	}
+
+	// Goals and completions the target already has for the same term win
+	statements := []string{
+		`UPDATE OR IGNORE goals SET member_id = ? WHERE member_id = ?`,
+		`UPDATE OR IGNORE goal_completions SET member_id = ? WHERE member_id = ?`,
+		// Members previously merged into the duplicate now point at the target
+		`UPDATE members SET merged_into = ? WHERE merged_into = ?`,
+	}
+	for _, stmt := range statements {
+		if _, err := tx.Exec(stmt, targetID, duplicateID); err != nil {
+			return 0, err
+		}
+	}
+	for _, stmt := range []string{
+		`DELETE FROM goals WHERE member_id = ?`,
+		`DELETE FROM goal_completions WHERE member_id = ?`,
+	} {
+		if _, err := tx.Exec(stmt, duplicateID); err != nil {
+			return 0, err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE members SET deleted_at = ?, merged_into = ? WHERE id = ?`,
+		time.Now().Format(time.RFC3339), targetID, duplicateID); err != nil {
+		return 0, err
+	}
+
+	return visitsMoved, tx.Commit()
+}
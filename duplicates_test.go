@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Duplicate Detection Tests
+// ============================================================================
+
+func TestSimilarNames(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want bool
+	}{
+		{"Alice Lee", "alice  lee", true},
+		{"Alice Lee", "Alice Lee.", true},
+		{"Jonathan Smith", "Johnathan Smith", true},
+		{"Jonathan Smith", "Jonathan Smyth", true},
+		{"Jonathan Smith", "Jane Smith", false},
+		{"Al", "Ed", false},
+		{"Bob", "Rob", false},
+		{"", "", false},
+	}
+
+	for _, c := range cases {
+		if got := similarNames(c.a, c.b); got != c.want {
+			t.Errorf("similarNames(%q, %q) = %v, want %v", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+func TestFindDuplicates(t *testing.T) {
+	members := []Member{
+		{ID: 1, Name: "Alice Lee", UID: "A1", DiscordID: "111"},
+		{ID: 2, Name: "Bob", UID: "B1", DiscordID: "222"},
+		{ID: 3, Name: "alice lee", UID: "A2", DiscordID: "333"},
+		{ID: 4, Name: "Robert", UID: "B2", DiscordID: "222"},
+	}
+
+	groups := findDuplicates(members)
+	if len(groups) != 2 {
+		t.Fatalf("expected 2 groups, got %+v", groups)
+	}
+	if groups[0].Reason != "discord_id" || groups[0].Members[0].ID != 2 || groups[0].Members[1].ID != 4 {
+		t.Errorf("expected Bob and Robert sharing a Discord ID, got %+v", groups[0])
+	}
+	if groups[1].Reason != "name" || groups[1].Members[0].ID != 1 || groups[1].Members[1].ID != 3 {
+		t.Errorf("expected the two Alices, got %+v", groups[1])
+	}
+}
+
+func TestHandleDuplicates(t *testing.T) {
+	setupTest()
+
+	db.Exec(`INSERT INTO members (id, name, uid, discord_id) VALUES (3, 'alice', 'TEST_UID_3', '333333333')`)
+
+	req, _ := http.NewRequest("GET", "/admin/duplicates", nil)
+	rr := httptest.NewRecorder()
+	handleDuplicates(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	var groups []DuplicateGroup
+	if err := json.Unmarshal(rr.Body.Bytes(), &groups); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(groups) != 1 || groups[0].Reason != "name" {
+		t.Errorf("expected one name duplicate, got %+v", groups)
+	}
+}
+
+// ============================================================================
+// /members/{id}/merge Endpoint Tests
+// ============================================================================
+
+// setupDuplicate adds a duplicate of Alice (ID 3) with one visit and reloads the cache
+func setupDuplicate(t *testing.T) {
+	t.Helper()
+
+	if _, err := db.Exec(`INSERT INTO members (id, name, uid, discord_id) VALUES (3, 'Alice L', 'TEST_UID_3', '111111111')`); err != nil {
+		t.Fatalf("failed to insert duplicate: %v", err)
+	}
+	signin := time.Now().Add(-48 * time.Hour)
+	if err := saveVisitToDB(3, signin, signin.Add(time.Hour)); err != nil {
+		t.Fatalf("failed to insert visit: %v", err)
+	}
+	if err := loadMembersIntoCache(); err != nil {
+		t.Fatalf("failed to load cache: %v", err)
+	}
+}
+
+func TestHandleMemberMerge(t *testing.T) {
+	setupTest()
+	setupDuplicate(t)
+
+	req, _ := http.NewRequest("POST", "/members/3/merge?into=1", nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp MergeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.VisitsMoved != 1 || resp.Member.ID != 1 {
+		t.Errorf("expected 1 visit moved to Alice, got %+v", resp)
+	}
+
+	// Visits now belong to the target
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM visits WHERE member_id = 1`).Scan(&count)
+	if count != 1 {
+		t.Errorf("expected 1 visit for member 1, got %d", count)
+	}
+
+	// The duplicate is soft-deleted and hidden from the member list
+	var deletedAt *string
+	db.QueryRow(`SELECT deleted_at FROM members WHERE id = 3`).Scan(&deletedAt)
+	if deletedAt == nil {
+		t.Error("expected duplicate to be soft-deleted")
+	}
+
+	req, _ = http.NewRequest("GET", "/members", nil)
+	rr = httptest.NewRecorder()
+	handleMembers(rr, req)
+
+	var members []Member
+	json.Unmarshal(rr.Body.Bytes(), &members)
+	if len(members) != 2 {
+		t.Errorf("expected 2 active members, got %+v", members)
+	}
+
+	entries, _ := loadAuditEntries("member.merged", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected one member.merged audit entry, got %+v", entries)
+	}
+}
+
+func TestHandleMemberMerge_OldCardSignsInTarget(t *testing.T) {
+	setupTest()
+	setupDuplicate(t)
+
+	req, _ := http.NewRequest("POST", "/members/3/merge?into=1", nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	// Scanning the duplicate's card signs the target in, then out
+	for _, want := range []string{"in", "out"} {
+		req, _ = http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid":"TEST_UID_3"}`))
+		rr = httptest.NewRecorder()
+		handleScan(rr, req)
+
+		var resp map[string]string
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if resp["status"] != want {
+			t.Fatalf("expected status %q, got %+v", want, resp)
+		}
+		if want == "in" {
+			if _, ok, _ := currentAttendees.get("TEST_UID_1"); !ok {
+				t.Error("expected Alice to be signed in under her own UID")
+			}
+		}
+	}
+}
+
+func TestHandleMemberMerge_Errors(t *testing.T) {
+	setupTest()
+	setupDuplicate(t)
+	currentAttendees.signIn("TEST_UID_2", "", time.Now())
+
+	tests := []struct {
+		path string
+		code int
+	}{
+		{"/members/3/merge", http.StatusBadRequest},
+		{"/members/3/merge?into=3", http.StatusBadRequest},
+		{"/members/99/merge?into=1", http.StatusNotFound},
+		{"/members/3/merge?into=99", http.StatusNotFound},
+		{"/members/2/merge?into=1", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", tt.path, nil)
+		rr := httptest.NewRecorder()
+		handleMember(rr, req)
+
+		if rr.Code != tt.code {
+			t.Errorf("%s: expected %d, got %v", tt.path, tt.code, rr.Code)
+		}
+	}
+}
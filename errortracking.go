@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Error Tracking ---
+//
+// Failures nobody is watching for are reported as they happen instead of
+// being noticed days later as missing data:
+//   - responses with a 5xx status, with the route and the response body
+//   - messages logged at the error level by a subsystem (see logging.go),
+//     such as background jobs given up on (dead letters), failed scheduled
+//     reports or visits the sign-out-all could not save
+//
+// Reports go to Sentry when SENTRY_DSN is set, and as JSON to
+// ERROR_WEBHOOK_URL (a Discord or Slack webhook, or any other receiver) when
+// it is set; error tracking is off when neither is. Reports are tagged with
+// SENTRY_ENVIRONMENT (default production) and SENTRY_RELEASE (default the
+// VCS revision the server was built from), and with the trace ID when the
+// failure happened in a traced request.
+//
+// The same failure (subsystem and message, or route and status) is reported
+// once per errorReportCooldown, so an outage does not send a report per
+// request. Reports are sent in the background; those that do not fit in the
+// queue are dropped and counted in error_reports_dropped_total.
+
+const (
+	defaultErrorEnvironment = "production"
+
+	errorReportQueueSize = 256
+	errorReportCooldown  = time.Minute
+
+	// Most bytes of a 5xx response body included in its report
+	errorReportBodyLimit = 1024
+)
+
+// ErrorEvent is a reported failure, in the Sentry event format
+type ErrorEvent struct {
+	EventID     string             `json:"event_id"`
+	Timestamp   time.Time          `json:"timestamp"`
+	Level       string             `json:"level"`
+	Logger      string             `json:"logger"` // Subsystem
+	Platform    string             `json:"platform"`
+	Message     string             `json:"message"`
+	Environment string             `json:"environment"`
+	Release     string             `json:"release,omitempty"`
+	ServerName  string             `json:"server_name,omitempty"`
+	Tags        map[string]string  `json:"tags"`
+	Request     *ErrorEventRequest `json:"request,omitempty"`
+}
+
+// ErrorEventRequest is the request that got a 5xx response
+type ErrorEventRequest struct {
+	Method string `json:"method"`
+	URL    string `json:"url"` // Path only, queries may hold tokens
+}
+
+// errorReporter sends failures to Sentry and/or a webhook
+type errorReporter struct {
+	sentryEndpoint string // Envelope endpoint derived from SENTRY_DSN
+	sentryKey      string
+	webhookURL     string
+	environment    string
+	release        string
+	serverName     string
+	queue          chan *ErrorEvent
+	client         *http.Client
+
+	mu       sync.Mutex
+	reported map[string]time.Time // Last report of each failure, for the cooldown
+}
+
+// activeErrorReporter is nil unless error tracking is configured
+var activeErrorReporter *errorReporter
+
+// parseSentryDSN returns the envelope endpoint and public key of a DSN such
+// as https://<key>@o123.ingest.sentry.io/<project>
+func parseSentryDSN(dsn string) (endpoint, key string, err error) {
+	u, err := url.Parse(dsn)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.User == nil || u.User.Username() == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN, expected https://<key>@<host>/<project>")
+	}
+	prefix, project := "", strings.Trim(u.Path, "/")
+	if i := strings.LastIndex(project, "/"); i >= 0 {
+		prefix, project = "/"+project[:i], project[i+1:]
+	}
+	if project == "" {
+		return "", "", fmt.Errorf("invalid SENTRY_DSN, the project ID is missing")
+	}
+	return fmt.Sprintf("%s://%s%s/api/%s/envelope/", u.Scheme, u.Host, prefix, project), u.User.Username(), nil
+}
+
+// buildRevision returns the VCS revision the binary was built from, if known
+func buildRevision() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	for _, setting := range info.Settings {
+		if setting.Key == "vcs.revision" {
+			return setting.Value
+		}
+	}
+	if info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return ""
+}
+
+// loadErrorReporter reads SENTRY_DSN, ERROR_WEBHOOK_URL, SENTRY_ENVIRONMENT
+// and SENTRY_RELEASE, nil if error tracking is off
+func loadErrorReporter() (*errorReporter, error) {
+	dsn, webhookURL := os.Getenv("SENTRY_DSN"), os.Getenv("ERROR_WEBHOOK_URL")
+	if dsn == "" && webhookURL == "" {
+		return nil, nil
+	}
+
+	e := &errorReporter{
+		webhookURL:  webhookURL,
+		environment: defaultErrorEnvironment,
+		release:     buildRevision(),
+		queue:       make(chan *ErrorEvent, errorReportQueueSize),
+		client:      &http.Client{Timeout: 10 * time.Second},
+		reported:    make(map[string]time.Time),
+	}
+	if dsn != "" {
+		var err error
+		if e.sentryEndpoint, e.sentryKey, err = parseSentryDSN(dsn); err != nil {
+			return nil, err
+		}
+	}
+	if webhookURL != "" {
+		if u, err := url.Parse(webhookURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("invalid ERROR_WEBHOOK_URL %q, expected an http(s) URL", webhookURL)
+		}
+	}
+	if environment := os.Getenv("SENTRY_ENVIRONMENT"); environment != "" {
+		e.environment = environment
+	}
+	if release := os.Getenv("SENTRY_RELEASE"); release != "" {
+		e.release = release
+	}
+	e.serverName, _ = os.Hostname()
+	return e, nil
+}
+
+// reportError reports a failure of a subsystem, unless the same one was
+// reported within the cooldown. fingerprint identifies the failure.
+func reportError(ctx context.Context, subsystem logComponent, fingerprint, message string, request *ErrorEventRequest) {
+	e := activeErrorReporter
+	if e == nil {
+		return
+	}
+
+	now := time.Now()
+	key := string(subsystem) + " " + fingerprint
+	e.mu.Lock()
+	if last, ok := e.reported[key]; ok && now.Sub(last) < errorReportCooldown {
+		e.mu.Unlock()
+		incCounter("error_reports_suppressed_total")
+		return
+	}
+	e.reported[key] = now
+	e.mu.Unlock()
+
+	id := make([]byte, 16)
+	rand.Read(id)
+	event := &ErrorEvent{
+		EventID:     hex.EncodeToString(id),
+		Timestamp:   now.UTC(),
+		Level:       "error",
+		Logger:      string(subsystem),
+		Platform:    "go",
+		Message:     message,
+		Environment: e.environment,
+		Release:     e.release,
+		ServerName:  e.serverName,
+		Tags:        map[string]string{"subsystem": string(subsystem)},
+		Request:     request,
+	}
+	if sc := spanContextFrom(ctx); sc.valid() {
+		event.Tags["trace_id"] = hex.EncodeToString(sc.TraceID[:])
+	}
+
+	select {
+	case e.queue <- event:
+	default:
+		incCounter("error_reports_dropped_total")
+	}
+}
+
+// startErrorReporter sends queued reports. Delivery failures are logged
+// directly, not at the error level, so they are not reported in turn.
+func (e *errorReporter) startErrorReporter() {
+	for event := range e.queue {
+		if err := e.send(event); err != nil {
+			incCounter("error_reports_failed_total")
+			log.Printf("Warning: sending error report %s failed: %v", event.EventID, err)
+			continue
+		}
+		incCounter("error_reports_total")
+	}
+}
+
+// send delivers a report to Sentry and the webhook, whichever are configured
+func (e *errorReporter) send(event *ErrorEvent) error {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	if e.sentryEndpoint != "" {
+		// An envelope: a header, then the event as its only item
+		var body bytes.Buffer
+		fmt.Fprintf(&body, `{"event_id":%q,"sent_at":%q}`+"\n", event.EventID, time.Now().UTC().Format(time.RFC3339))
+		fmt.Fprintf(&body, `{"type":"event","length":%d}`+"\n", len(payload))
+		body.Write(payload)
+		body.WriteString("\n")
+		auth := fmt.Sprintf("Sentry sentry_version=7, sentry_key=%s, sentry_client=%s", e.sentryKey, defaultServiceName)
+		if err := e.post(e.sentryEndpoint, "application/x-sentry-envelope", body.Bytes(), auth); err != nil {
+			errs = append(errs, "sentry: "+err.Error())
+		}
+	}
+	if e.webhookURL != "" {
+		// content and text are shown by Discord and Slack
+		summary := fmt.Sprintf("[%s] %s error: %s", event.Environment, event.Logger, event.Message)
+		body, _ := json.Marshal(map[string]interface{}{"content": summary, "text": summary, "event": event})
+		if err := e.post(e.webhookURL, "application/json", body, ""); err != nil {
+			errs = append(errs, "webhook: "+err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("%s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// post sends a report body to one destination
+func (e *errorReporter) post(endpoint, contentType string, body []byte, auth string) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if auth != "" {
+		req.Header.Set("X-Sentry-Auth", auth)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// errorRecorder keeps the status and the start of the body of a response
+type errorRecorder struct {
+	statusRecorder
+	body bytes.Buffer
+}
+
+func (e *errorRecorder) Write(p []byte) (int, error) {
+	if e.status >= 500 && e.body.Len() < errorReportBodyLimit {
+		e.body.Write(p[:min(len(p), errorReportBodyLimit-e.body.Len())])
+	}
+	return e.statusRecorder.Write(p)
+}
+
+// errorReportMiddleware reports the requests answered with a 5xx status
+func errorReportMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if activeErrorReporter == nil {
+			next(w, r)
+			return
+		}
+
+		rec := &errorRecorder{statusRecorder: statusRecorder{ResponseWriter: w}}
+		next(rec, r)
+		if rec.status < 500 {
+			return
+		}
+
+		route := r.Pattern
+		if route == "" {
+			route = r.URL.Path
+		}
+		message := fmt.Sprintf("%s %s -> %d", r.Method, route, rec.status)
+		if body := strings.TrimSpace(rec.body.String()); body != "" {
+			message += ": " + body
+		}
+		reportError(r.Context(), logHTTP, fmt.Sprintf("%s %s %d", r.Method, route, rec.status), message,
+			&ErrorEventRequest{Method: r.Method, URL: r.URL.Path})
+	}
+}
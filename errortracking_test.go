@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Error Tracking Tests
+// ============================================================================
+
+// recordErrors turns error tracking on with a queue the test reads instead of
+// a destination
+func recordErrors(t *testing.T) *errorReporter {
+	t.Helper()
+
+	e := &errorReporter{environment: "test", release: "abc123", queue: make(chan *ErrorEvent, errorReportQueueSize), reported: make(map[string]time.Time)}
+	activeErrorReporter = e
+	t.Cleanup(func() { activeErrorReporter = nil })
+	return e
+}
+
+// reportedErrors returns the reports queued so far
+func reportedErrors(e *errorReporter) []*ErrorEvent {
+	var reports []*ErrorEvent
+	for {
+		select {
+		case event := <-e.queue:
+			reports = append(reports, event)
+		default:
+			return reports
+		}
+	}
+}
+
+func TestParseSentryDSN(t *testing.T) {
+	endpoint, key, err := parseSentryDSN("https://abc123@o42.ingest.sentry.io/7")
+	if err != nil || endpoint != "https://o42.ingest.sentry.io/api/7/envelope/" || key != "abc123" {
+		t.Errorf("unexpected endpoint %q and key %q (err %v)", endpoint, key, err)
+	}
+	// Self-hosted Sentry behind a path prefix
+	if endpoint, _, _ := parseSentryDSN("http://key@sentry.internal/errors/3"); endpoint != "http://sentry.internal/errors/api/3/envelope/" {
+		t.Errorf("expected the path prefix kept, got %q", endpoint)
+	}
+
+	for _, invalid := range []string{"o42.ingest.sentry.io/7", "https://o42.ingest.sentry.io/7", "https://key@o42.ingest.sentry.io/"} {
+		if _, _, err := parseSentryDSN(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestLoadErrorReporter(t *testing.T) {
+	for _, name := range []string{"SENTRY_DSN", "ERROR_WEBHOOK_URL", "SENTRY_ENVIRONMENT", "SENTRY_RELEASE"} {
+		t.Setenv(name, "")
+	}
+	if e, err := loadErrorReporter(); err != nil || e != nil {
+		t.Errorf("expected error tracking off by default, got %+v (err %v)", e, err)
+	}
+
+	t.Setenv("ERROR_WEBHOOK_URL", "https://discord.example/webhook")
+	t.Setenv("SENTRY_RELEASE", "v1.2.0")
+	e, err := loadErrorReporter()
+	if err != nil || e.webhookURL == "" || e.sentryEndpoint != "" || e.environment != defaultErrorEnvironment || e.release != "v1.2.0" {
+		t.Errorf("unexpected reporter %+v (err %v)", e, err)
+	}
+
+	t.Setenv("ERROR_WEBHOOK_URL", "discord.example/webhook")
+	if _, err := loadErrorReporter(); err == nil {
+		t.Error("expected an error for a webhook URL without a scheme")
+	}
+}
+
+func TestErrorReportMiddleware(t *testing.T) {
+	setupTest()
+	e := recordErrors(t)
+	metricsMu.Lock()
+	suppressedBefore := counters["error_reports_suppressed_total"]
+	metricsMu.Unlock()
+
+	failing := errorReportMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "Database error", http.StatusInternalServerError)
+	})
+	for i := 0; i < 3; i++ {
+		failing(httptest.NewRecorder(), httptest.NewRequest("GET", "/members?token=secret", nil))
+	}
+	errorReportMiddleware(handleMembers)(httptest.NewRecorder(), httptest.NewRequest("GET", "/members", nil))
+
+	reports := reportedErrors(e)
+	if len(reports) != 1 {
+		t.Fatalf("expected one report for repeated failures and none for a success, got %d", len(reports))
+	}
+	r := reports[0]
+	if r.Message != "GET /members -> 500: Database error" || r.Logger != "http" || r.Environment != "test" || r.Release != "abc123" {
+		t.Errorf("unexpected report %+v", r)
+	}
+	if r.Request == nil || r.Request.URL != "/members" {
+		t.Errorf("expected the path without the query, got %+v", r.Request)
+	}
+	metricsMu.Lock()
+	suppressed := counters["error_reports_suppressed_total"] - suppressedBefore
+	metricsMu.Unlock()
+	if suppressed != 2 {
+		t.Errorf("expected 2 suppressed reports, got %v", suppressed)
+	}
+}
+
+func TestErrorReporting_Subsystems(t *testing.T) {
+	setupTest()
+	e := recordErrors(t)
+
+	// Reported whatever the log level
+	setLogLevel(t, `{"level": "error", "components": {"jobs": "error"}}`)
+	logJobs.warnf("Job webhook failed (attempt 1/5)")
+	logJobs.errorf("Dead letter: %s", "job webhook failed after 5 attempt(s)")
+	logIntegrations.errorf("Report schedule %q: failed to generate report", "Weekly")
+
+	reports := reportedErrors(e)
+	if len(reports) != 2 {
+		t.Fatalf("expected the two errors reported, got %d", len(reports))
+	}
+	if reports[0].Tags["subsystem"] != "jobs" || !strings.Contains(reports[0].Message, "Dead letter") {
+		t.Errorf("unexpected job report %+v", reports[0])
+	}
+	if reports[1].Logger != "integrations" {
+		t.Errorf("unexpected integration report %+v", reports[1])
+	}
+}
+
+func TestErrorReporterSend(t *testing.T) {
+	var envelope, webhook []byte
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.HasSuffix(r.URL.Path, "/envelope/") {
+			envelope, auth = body, r.Header.Get("X-Sentry-Auth")
+		} else {
+			webhook = body
+		}
+	}))
+	defer server.Close()
+
+	endpoint, key, _ := parseSentryDSN(strings.Replace(server.URL, "://", "://public@", 1) + "/7")
+	e := &errorReporter{sentryEndpoint: endpoint, sentryKey: key, webhookURL: server.URL + "/hook", client: server.Client()}
+	event := &ErrorEvent{EventID: "0123456789abcdef0123456789abcdef", Level: "error", Logger: "jobs", Message: "Dead letter", Environment: "staging"}
+	if err := e.send(event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if !strings.Contains(auth, "sentry_key=public") {
+		t.Errorf("expected the DSN key, got %q", auth)
+	}
+	lines := bufio.NewScanner(bytes.NewReader(envelope))
+	var items []string
+	for lines.Scan() {
+		items = append(items, lines.Text())
+	}
+	var sent ErrorEvent
+	if len(items) != 3 || !strings.Contains(items[1], `"type":"event"`) || json.Unmarshal([]byte(items[2]), &sent) != nil || sent.Message != "Dead letter" {
+		t.Errorf("unexpected envelope %s", envelope)
+	}
+	if !strings.Contains(string(webhook), `"content":"[staging] jobs error: Dead letter"`) {
+		t.Errorf("unexpected webhook payload %s", webhook)
+	}
+
+	down := httptest.NewServer(http.NotFoundHandler())
+	defer down.Close()
+	e.sentryEndpoint, e.webhookURL = "", down.URL
+	if err := e.send(event); err == nil {
+		t.Error("expected an error when the destinations fail")
+	}
+}
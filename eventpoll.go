@@ -0,0 +1,261 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Event Long-Polling ---
+//
+// GET /events/poll?since=cursor&timeout=30s returns the sign-ins, sign-outs
+// and office openings and closings after a cursor, waiting up to timeout for
+// one if there is none yet, for clients that cannot hold a /status/stream
+// connection open, such as the ESP32 display firmware. Each response carries
+// the cursor to send next. The most recent eventPollSize events are kept in
+// memory like /announcements/next, so with shared state a client must poll
+// the instance its scanners post to. When a client falls further behind
+// than that, or the server restarted since its cursor, the response says
+// reset and the client should reload the state (e.g. /current) instead of
+// replaying events.
+
+const (
+	// eventPollSize is how many events are kept for polling
+	eventPollSize = 100
+
+	// eventPollDefaultTimeout and eventPollMaxTimeout bound how long
+	// /events/poll waits for an event
+	eventPollDefaultTimeout = 30 * time.Second
+	eventPollMaxTimeout     = 60 * time.Second
+)
+
+// polledEventKinds are the events /events/poll returns
+var polledEventKinds = []eventKind{eventSignIn, eventSignOut, eventOfficeOpened, eventOfficeClosed}
+
+// PolledEvent is an event as returned by /events/poll
+type PolledEvent struct {
+	ID   int64     `json:"id"`
+	Kind eventKind `json:"kind"`
+	Time time.Time `json:"time"`
+	Name string    `json:"name,omitempty"` // Redacted for the view, omitted if hidden
+	Room string    `json:"room,omitempty"` // sign_in
+}
+
+// EventPollResponse is the response of /events/poll
+type EventPollResponse struct {
+	Cursor int64         `json:"cursor"` // Send as ?since= on the next poll
+	Events []PolledEvent `json:"events"`
+	Reset  bool          `json:"reset,omitempty"` // Events since the cursor were lost
+}
+
+// loggedEvent is a polled event as stored, with the name kept apart so it
+// can be redacted for each view
+type loggedEvent struct {
+	PolledEvent
+	name     string // Empty when the member may not be named or belongs to another organization
+	initials string // As shown to the member view (see publicName)
+}
+
+// forView returns the event as shown to a view
+func (e loggedEvent) forView(view string) PolledEvent {
+	shown := e.PolledEvent
+	switch view {
+	case scopeAdmin:
+		shown.Name = e.name
+	case scopeMember:
+		shown.Name = e.initials
+	}
+	return shown
+}
+
+// eventLog is a ring buffer of the most recent polled events
+type eventLog struct {
+	mu      sync.Mutex
+	lastID  int64
+	queue   []loggedEvent
+	waiting chan struct{} // Closed when an event is added
+}
+
+// add logs an event and wakes pollers waiting for one
+func (l *eventLog) add(e loggedEvent) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.lastID++
+	e.ID = l.lastID
+	l.queue = append(l.queue, e)
+	if len(l.queue) > eventPollSize {
+		l.queue = l.queue[len(l.queue)-eventPollSize:]
+	}
+	if l.waiting != nil {
+		close(l.waiting)
+		l.waiting = nil
+	}
+}
+
+// since returns the events of the kinds given (any if empty) after a cursor
+// and the cursor to poll from next. reset tells that events after the
+// cursor are no longer kept. If there is no event to return, it also returns
+// a channel closed when another is added.
+func (l *eventLog) since(cursor int64, kinds map[eventKind]bool) (found []loggedEvent, next int64, reset bool, added <-chan struct{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if cursor > l.lastID {
+		// Issued before a restart
+		return nil, l.lastID, true, nil
+	}
+	if len(l.queue) > 0 && l.queue[0].ID > cursor+1 {
+		reset = true
+	}
+	for _, e := range l.queue {
+		if e.ID > cursor && (len(kinds) == 0 || kinds[e.Kind]) {
+			found = append(found, e)
+		}
+	}
+	if len(found) == 0 && !reset {
+		if l.waiting == nil {
+			l.waiting = make(chan struct{})
+		}
+		added = l.waiting
+	}
+	return found, l.lastID, reset, added
+}
+
+// cursor returns the ID of the latest event
+func (l *eventLog) cursor() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.lastID
+}
+
+// reset forgets all events
+func (l *eventLog) reset() {
+	l.mu.Lock()
+	l.queue = nil
+	l.mu.Unlock()
+}
+
+// Events kept for /events/poll
+var polledEvents = &eventLog{}
+
+// logPolledEvent is an event handler keeping an event for /events/poll.
+// Members who opted out of notifications or have not consented to being named,
+// and members of other organizations than the host's, are not named, as on
+// /status/stream.
+func logPolledEvent(e Event) {
+	logged := loggedEvent{PolledEvent: PolledEvent{Kind: e.Kind, Time: e.Time, Room: e.Room}}
+	if e.Kind == eventSignIn && logged.Room == "" {
+		logged.Room = defaultRoom
+	}
+	if e.Member.ID != 0 && nameable(e.Member.ID) && memberOrg(e.Member) == defaultOrg {
+		logged.name = e.Member.Name
+		logged.initials = publicName(e.Member, scopeMember)
+	}
+	if (e.Kind == eventOfficeOpened || e.Kind == eventOfficeClosed) && officeHideName() {
+		logged.name, logged.initials = "", ""
+	}
+	polledEvents.add(logged)
+}
+
+// handleEventsPoll returns the events after a cursor, waiting for one if there is none yet
+// Query parameters:
+//   - since: cursor from the previous response; without it the current
+//     cursor is returned at once, with no events
+//   - timeout: how long to wait for an event, as a Go duration (default 30s, at most 60s)
+//   - kinds: only these event kinds, separated by commas (sign_in, sign_out, office_opened, office_closed)
+//   - view: public (no names), member (initials) or admin (names), limited by the key's scope
+//
+// Responds with no events once the timeout passes.
+func handleEventsPoll(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	view, ok := resolveView(w, r)
+	if !ok {
+		return
+	}
+	query := r.URL.Query()
+
+	timeout := eventPollDefaultTimeout
+	if s := query.Get("timeout"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d < 0 || d > eventPollMaxTimeout {
+			http.Error(w, fmt.Sprintf("Invalid 'timeout' parameter, expected a duration from 0s to %s", eventPollMaxTimeout), http.StatusBadRequest)
+			return
+		}
+		timeout = d
+	}
+
+	kinds := make(map[eventKind]bool)
+	if s := query.Get("kinds"); s != "" {
+		for _, name := range strings.Split(s, ",") {
+			kind := eventKind(strings.TrimSpace(name))
+			if !polledEventKind(kind) {
+				http.Error(w, "Invalid 'kinds' parameter, expected sign_in, sign_out, office_opened or office_closed", http.StatusBadRequest)
+				return
+			}
+			kinds[kind] = true
+		}
+	}
+
+	resp := EventPollResponse{Events: []PolledEvent{}}
+	s := query.Get("since")
+	if s == "" {
+		resp.Cursor = polledEvents.cursor()
+		writeEventPollResponse(w, resp)
+		return
+	}
+	since, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || since < 0 {
+		http.Error(w, "Invalid 'since' parameter", http.StatusBadRequest)
+		return
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		found, next, reset, added := polledEvents.since(since, kinds)
+		resp.Cursor, resp.Reset = next, reset
+		if added == nil {
+			for _, e := range found {
+				resp.Events = append(resp.Events, e.forView(view))
+			}
+			writeEventPollResponse(w, resp)
+			return
+		}
+
+		select {
+		case <-added:
+		case <-timer.C:
+			// Skip past events of other kinds
+			writeEventPollResponse(w, resp)
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// polledEventKind reports whether /events/poll returns events of a kind
+func polledEventKind(kind eventKind) bool {
+	for _, k := range polledEventKinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// writeEventPollResponse writes a poll response, which must not be cached
+func writeEventPollResponse(w http.ResponseWriter, resp EventPollResponse) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Event Long-Polling Tests
+// ============================================================================
+
+// pollEvents calls /events/poll with a scope
+func pollEvents(t *testing.T, url, scope string) EventPollResponse {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handleEventsPoll(rr, scopedRequest("GET", url, scope))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp EventPollResponse
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	return resp
+}
+
+func TestEventsPoll_ReturnsEventsAfterCursor(t *testing.T) {
+	setupTest()
+
+	start := pollEvents(t, "/events/poll", scopeAdmin)
+	if len(start.Events) != 0 {
+		t.Fatalf("expected no events without since, got %+v", start.Events)
+	}
+
+	scanCard("TEST_UID_1")
+	events.wait()
+	since := "/events/poll?timeout=0s&since=" + strconv.FormatInt(start.Cursor, 10)
+	resp := pollEvents(t, since, scopeAdmin)
+	if len(resp.Events) != 2 || resp.Events[0].Kind != eventSignIn || resp.Events[1].Kind != eventOfficeOpened {
+		t.Fatalf("expected the sign-in and the office opening, got %+v", resp.Events)
+	}
+	if e := resp.Events[0]; e.Name != "Alice" || e.Room != defaultRoom {
+		t.Errorf("expected Alice in the office, got %+v", e)
+	}
+	if resp.Cursor != resp.Events[1].ID || resp.Reset {
+		t.Errorf("expected the cursor of the last event, got %+v", resp)
+	}
+
+	// Names follow the view
+	if e := pollEvents(t, since, scopeMember).Events[0]; e.Name != "A." {
+		t.Errorf("expected initials for the member view, got %+v", e)
+	}
+	if e := pollEvents(t, since, scopePublic).Events[0]; e.Name != "" {
+		t.Errorf("expected no name for the public view, got %+v", e)
+	}
+
+	// Only the kinds asked for
+	kinds := pollEvents(t, since+"&kinds=office_opened,office_closed", scopeAdmin)
+	if len(kinds.Events) != 1 || kinds.Events[0].Kind != eventOfficeOpened {
+		t.Errorf("expected only the office opening, got %+v", kinds.Events)
+	}
+}
+
+func TestEventsPoll_WaitsForEvent(t *testing.T) {
+	setupTest()
+	cursor := pollEvents(t, "/events/poll", scopeAdmin).Cursor
+
+	done := make(chan *httptest.ResponseRecorder)
+	go func() {
+		rr := httptest.NewRecorder()
+		handleEventsPoll(rr, scopedRequest("GET", "/events/poll?timeout=5s&kinds=sign_in&since="+strconv.FormatInt(cursor, 10), scopeAdmin))
+		done <- rr
+	}()
+	time.Sleep(50 * time.Millisecond)
+	scanCard("TEST_UID_2")
+
+	select {
+	case rr := <-done:
+		var resp EventPollResponse
+		json.Unmarshal(rr.Body.Bytes(), &resp)
+		if len(resp.Events) != 1 || resp.Events[0].Name != "Bob" {
+			t.Errorf("expected Bob's sign-in, got %+v", resp.Events)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the poll to return once Bob signed in")
+	}
+}
+
+func TestEventsPoll_Timeout(t *testing.T) {
+	setupTest()
+	cursor := pollEvents(t, "/events/poll", scopeAdmin).Cursor
+
+	resp := pollEvents(t, "/events/poll?timeout=20ms&since="+strconv.FormatInt(cursor, 10), scopeAdmin)
+	if len(resp.Events) != 0 || resp.Cursor != cursor || resp.Reset {
+		t.Errorf("expected no events and the same cursor, got %+v", resp)
+	}
+}
+
+func TestEventsPoll_Reset(t *testing.T) {
+	setupTest()
+	cursor := pollEvents(t, "/events/poll", scopeAdmin).Cursor
+	for i := 0; i < eventPollSize+1; i++ {
+		polledEvents.add(loggedEvent{PolledEvent: PolledEvent{Kind: eventSignIn, Time: time.Now()}})
+	}
+
+	resp := pollEvents(t, "/events/poll?timeout=0s&since="+strconv.FormatInt(cursor, 10), scopeAdmin)
+	if !resp.Reset || len(resp.Events) != eventPollSize {
+		t.Errorf("expected a reset with the events still kept, got reset=%v and %d events", resp.Reset, len(resp.Events))
+	}
+
+	// A cursor from before a restart
+	resp = pollEvents(t, "/events/poll?since="+strconv.FormatInt(resp.Cursor+10, 10), scopeAdmin)
+	if !resp.Reset || len(resp.Events) != 0 {
+		t.Errorf("expected a reset without events, got %+v", resp)
+	}
+}
+
+func TestEventsPoll_InvalidParameters(t *testing.T) {
+	setupTest()
+
+	for _, url := range []string{
+		"/events/poll?since=abc",
+		"/events/poll?since=-1",
+		"/events/poll?since=0&timeout=2m",
+		"/events/poll?since=0&timeout=soon",
+		"/events/poll?since=0&kinds=member_created",
+	} {
+		rr := httptest.NewRecorder()
+		handleEventsPoll(rr, scopedRequest("GET", url, scopeAdmin))
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", url, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// --- Event Bus ---
+//
+// State changes (sign-in, sign-out, member created, device offline/online,
+// office opened/closed, someone alone after hours) are published as events;
+// side effects such as goal checks, alerts and metrics subscribe to them
+// instead of living inline in handlers. Every subscriber has its own buffered queue and goroutine, so a
+// slow subscriber never blocks the publisher or other subscribers. When a
+// queue is full the event is dropped for that subscriber and counted in
+// events_dropped_total.
+
+// eventKind names a type of event
+type eventKind string
+
+const (
+	eventSignIn        eventKind = "sign_in"
+	eventSignOut       eventKind = "sign_out"
+	eventMemberCreated eventKind = "member_created"
+	eventDeviceOffline eventKind = "device_offline"
+	eventDeviceOnline  eventKind = "device_online"
+	eventOfficeOpened  eventKind = "office_opened"
+	eventOfficeClosed  eventKind = "office_closed"
+
+	eventAloneAfterHours eventKind = "alone_after_hours"
+)
+
+// defaultEventBuffer is the queue length of each subscriber
+const defaultEventBuffer = 256
+
+// Event is a state change published on the event bus
+type Event struct {
+	Kind       eventKind
+	Time       time.Time
+	Member     Member      // sign_in, sign_out, member_created, office_opened, office_closed, alone_after_hours
+	Room       string      // sign_in
+	SignInTime time.Time   // sign_out: start of the closed session
+	Device     Device      // device_offline, device_online
+	Message    string      // Human readable description
+	Trace      spanContext // Span that published the event, parent of its handlers' spans
+}
+
+// eventSubscriber receives the events of the kinds it subscribed to
+type eventSubscriber struct {
+	name    string
+	kinds   map[eventKind]bool
+	queue   chan Event
+	handler func(Event)
+}
+
+// eventBus delivers published events to subscribers
+type eventBus struct {
+	mu          sync.RWMutex
+	subscribers []*eventSubscriber
+
+	// Events queued but not yet handled, for wait
+	pendingMu sync.Mutex
+	pending   int
+	idle      *sync.Cond
+}
+
+// newEventBus returns an event bus without subscribers
+func newEventBus() *eventBus {
+	b := &eventBus{}
+	b.idle = sync.NewCond(&b.pendingMu)
+	return b
+}
+
+// events is the application's event bus
+var events = newEventBus()
+
+// subscribe starts delivering events of the given kinds to handler on its own goroutine
+func (b *eventBus) subscribe(name string, handler func(Event), kinds ...eventKind) {
+	s := &eventSubscriber{
+		name:    name,
+		kinds:   make(map[eventKind]bool, len(kinds)),
+		queue:   make(chan Event, defaultEventBuffer),
+		handler: handler,
+	}
+	for _, kind := range kinds {
+		s.kinds[kind] = true
+	}
+
+	b.mu.Lock()
+	b.subscribers = append(b.subscribers, s)
+	b.mu.Unlock()
+
+	go func() {
+		for e := range s.queue {
+			_, span := startSpan(withSpanContext(context.Background(), e.Trace), "event "+string(e.Kind)+" "+s.name, spanKindInternal)
+			s.handler(e)
+			span.finish(nil)
+			b.done()
+		}
+	}()
+}
+
+// publish queues an event for its subscribers without blocking
+func (b *eventBus) publish(e Event) {
+	if e.Time.IsZero() {
+		e.Time = time.Now()
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, s := range b.subscribers {
+		if !s.kinds[e.Kind] {
+			continue
+		}
+
+		b.pendingMu.Lock()
+		b.pending++
+		b.pendingMu.Unlock()
+
+		select {
+		case s.queue <- e:
+		default:
+			b.done()
+			incCounter("events_dropped_total")
+			log.Printf("Warning: event queue of %s is full, dropped %s event", s.name, e.Kind)
+		}
+	}
+}
+
+// done marks one queued event as handled
+func (b *eventBus) done() {
+	b.pendingMu.Lock()
+	b.pending--
+	if b.pending == 0 {
+		b.idle.Broadcast()
+	}
+	b.pendingMu.Unlock()
+}
+
+// wait blocks until every queued event has been handled
+func (b *eventBus) wait() {
+	b.pendingMu.Lock()
+	for b.pending > 0 {
+		b.idle.Wait()
+	}
+	b.pendingMu.Unlock()
+}
+
+var subscribeOnce sync.Once
+
+// subscribeEventHandlers subscribes the application's side effects to the event bus
+func subscribeEventHandlers() {
+	subscribeOnce.Do(func() {
+		// Goal progress only changes when a session ends
+		events.subscribe("goals", func(e Event) {
+			checkGoalCompletion(e.Member)
+		}, eventSignOut)
+
+		events.subscribe("alerts", func(e Event) {
+			sendAlert(e.Message)
+		}, eventDeviceOffline, eventDeviceOnline)
+
+		events.subscribe("office", notifyOffice, eventOfficeOpened, eventOfficeClosed)
+		events.subscribe("poll", logPolledEvent, polledEventKinds...)
+		// liveStats is replaced by tests, so look it up on every event
+		events.subscribe("live-stats", func(e Event) { liveStats.apply(e) }, eventSignIn, eventSignOut)
+
+		events.subscribe("after-hours", notifyAfterHoursSignIn, eventSignIn)
+		events.subscribe("buddy-rule", func(e Event) {
+			notify(integrationAfterHours, e.Message)
+		}, eventAloneAfterHours)
+
+		events.subscribe("metrics", func(e Event) {
+			incCounter("events_" + string(e.Kind) + "_total")
+		}, eventSignIn, eventSignOut, eventMemberCreated, eventDeviceOffline, eventDeviceOnline, eventOfficeOpened, eventOfficeClosed,
+			eventAloneAfterHours)
+	})
+}
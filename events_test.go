@@ -0,0 +1,99 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Event Bus Tests
+// ============================================================================
+
+func TestEventBus_DeliversSubscribedKinds(t *testing.T) {
+	bus := newEventBus()
+
+	var mu sync.Mutex
+	var got []eventKind
+	bus.subscribe("test", func(e Event) {
+		mu.Lock()
+		got = append(got, e.Kind)
+		mu.Unlock()
+	}, eventSignIn, eventSignOut)
+
+	bus.publish(Event{Kind: eventSignIn})
+	bus.publish(Event{Kind: eventMemberCreated})
+	bus.publish(Event{Kind: eventSignOut})
+	bus.wait()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(got) != 2 || got[0] != eventSignIn || got[1] != eventSignOut {
+		t.Errorf("expected sign_in and sign_out in order, got %v", got)
+	}
+}
+
+func TestEventBus_FullQueueDropsWithoutBlocking(t *testing.T) {
+	resetMetrics()
+	bus := newEventBus()
+
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	bus.subscribe("slow", func(e Event) {
+		select {
+		case started <- struct{}{}:
+		default:
+		}
+		<-release
+	}, eventSignIn)
+
+	// The first event occupies the subscriber, the next ones fill its queue
+	bus.publish(Event{Kind: eventSignIn})
+	<-started
+
+	done := make(chan struct{})
+	go func() {
+		for i := 0; i < defaultEventBuffer+10; i++ {
+			bus.publish(Event{Kind: eventSignIn})
+		}
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("publish blocked on a slow subscriber")
+	}
+	close(release)
+	bus.wait()
+
+	metricsMu.Lock()
+	dropped := counters["events_dropped_total"]
+	metricsMu.Unlock()
+	if dropped != 10 {
+		t.Errorf("expected 10 dropped events, got %v", dropped)
+	}
+}
+
+func TestEvents_SignInAndOutPublished(t *testing.T) {
+	setupTest()
+	resetMetrics()
+
+	scan(t, "TEST_UID_1")
+	scan(t, "TEST_UID_1")
+	events.wait()
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+	handleMetrics(rr, req)
+
+	body := rr.Body.String()
+	for _, want := range []string{"events_sign_in_total 1", "events_sign_out_total 1"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %q in metrics, got:\n%s", want, body)
+		}
+	}
+}
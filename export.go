@@ -0,0 +1,215 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- Database Export ---
+//
+// GET /admin/export returns a consistent snapshot of the whole database for
+// archival or migration:
+//   - format=sqlite (default): a copy of the database file made with
+//     VACUUM INTO, sent with its length so clients can show progress
+//   - format=jsonl: one JSON object per line, read in a single transaction.
+//     The first line lists the tables and their row counts, then every row
+//     follows as {"table": "members", "row": {...}}, flushed as it goes.
+//
+// The full-text search indexes are left out of the JSONL export; they are
+// rebuilt from members and the audit log.
+
+// exportFlushRows is how many JSONL rows are written between flushes
+const exportFlushRows = 500
+
+// ExportHeader is the first line of a JSONL export
+type ExportHeader struct {
+	ExportedAt time.Time        `json:"exported_at"`
+	Tables     map[string]int64 `json:"tables"` // Row count per table
+}
+
+// ExportRow is a row of a JSONL export
+type ExportRow struct {
+	Table string                 `json:"table"`
+	Row   map[string]interface{} `json:"row"`
+}
+
+// exportTables returns the tables of the database to export, leaving out
+// SQLite's own tables and the full-text indexes
+func exportTables(tx *sql.Tx) ([]string, error) {
+	rows, err := tx.Query(`SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		if !isSearchIndexTable(name) {
+			tables = append(tables, name)
+		}
+	}
+	return tables, rows.Err()
+}
+
+// isSearchIndexTable reports whether a table belongs to a full-text index
+func isSearchIndexTable(name string) bool {
+	for _, idx := range searchIndexes {
+		if name == idx.fts || strings.HasPrefix(name, idx.fts+"_") {
+			return true
+		}
+	}
+	return false
+}
+
+// writeJSONLExport writes every row of the exported tables as JSON lines,
+// all read in one transaction
+func writeJSONLExport(w http.ResponseWriter, r *http.Request) error {
+	tx, err := db.BeginTx(r.Context(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	tables, err := exportTables(tx)
+	if err != nil {
+		return err
+	}
+	header := ExportHeader{ExportedAt: time.Now(), Tables: make(map[string]int64)}
+	for _, table := range tables {
+		var n int64
+		if err := tx.QueryRow(`SELECT COUNT(*) FROM "` + table + `"`).Scan(&n); err != nil {
+			return err
+		}
+		header.Tables[table] = n
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.jsonl"`, header.ExportedAt.Format("2006-01-02")))
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	if err := enc.Encode(header); err != nil {
+		return err
+	}
+
+	written := 0
+	for _, table := range tables {
+		rows, err := tx.Query(`SELECT * FROM "` + table + `"`)
+		if err != nil {
+			return err
+		}
+		columns, err := rows.Columns()
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		values := make([]interface{}, len(columns))
+		pointers := make([]interface{}, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		for rows.Next() {
+			if err := rows.Scan(pointers...); err != nil {
+				rows.Close()
+				return err
+			}
+			row := make(map[string]interface{}, len(columns))
+			for i, column := range columns {
+				if b, ok := values[i].([]byte); ok {
+					row[column] = string(b)
+				} else {
+					row[column] = values[i]
+				}
+			}
+			if err := enc.Encode(ExportRow{Table: table, Row: row}); err != nil {
+				rows.Close()
+				return err
+			}
+
+			written++
+			if written%exportFlushRows == 0 && flusher != nil {
+				flusher.Flush()
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeSQLiteExport copies the database with VACUUM INTO and sends the copy
+func writeSQLiteExport(w http.ResponseWriter) error {
+	dir, err := os.MkdirTemp("", "export")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "attendance.db")
+	if _, err := db.Exec(`VACUUM INTO ?`, path); err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", "application/vnd.sqlite3")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="export-%s.db"`, time.Now().Format("2006-01-02")))
+	w.Header().Set("Content-Length", fmt.Sprint(info.Size()))
+	_, err = io.Copy(w, f)
+	return err
+}
+
+// handleExport streams a snapshot of the whole database
+// Query parameters:
+//   - format: sqlite (default) or jsonl
+func handleExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "sqlite"
+	}
+	if format != "sqlite" && format != "jsonl" {
+		http.Error(w, "Invalid 'format' parameter, expected sqlite or jsonl", http.StatusBadRequest)
+		return
+	}
+	recordAudit("database.exported", clientIP(r), format)
+
+	var err error
+	if format == "jsonl" {
+		err = writeJSONLExport(w, r)
+	} else {
+		err = writeSQLiteExport(w)
+	}
+	if err != nil {
+		log.Printf("Error exporting database: %v", err)
+		// Once the export has started, the client is left with a truncated file
+		if w.Header().Get("Content-Disposition") == "" {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+		}
+	}
+}
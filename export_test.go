@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bufio"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Database Export Tests
+// ============================================================================
+
+func TestHandleExport_JSONL(t *testing.T) {
+	setupTest()
+	saveVisitToDB(1, time.Now().Add(-time.Hour), time.Now())
+
+	rr := httptest.NewRecorder()
+	handleExport(rr, httptest.NewRequest("GET", "/admin/export?format=jsonl", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	scanner := bufio.NewScanner(rr.Body)
+	scanner.Scan()
+	var header ExportHeader
+	if err := json.Unmarshal(scanner.Bytes(), &header); err != nil {
+		t.Fatalf("invalid header: %v", err)
+	}
+	if header.Tables["members"] != 2 || header.Tables["visits"] != 1 {
+		t.Errorf("unexpected row counts: %v", header.Tables)
+	}
+	if _, ok := header.Tables["members_fts"]; ok {
+		t.Error("expected the search index to be left out")
+	}
+
+	// Every row counted in the header follows it
+	counts := make(map[string]int64)
+	for scanner.Scan() {
+		var row ExportRow
+		if err := json.Unmarshal(scanner.Bytes(), &row); err != nil {
+			t.Fatalf("invalid row %s: %v", scanner.Text(), err)
+		}
+		counts[row.Table]++
+		if row.Table == "members" && row.Row["name"] != "Alice" && row.Row["name"] != "Bob" {
+			t.Errorf("unexpected member row: %v", row.Row)
+		}
+	}
+	for table, n := range header.Tables {
+		if counts[table] != n {
+			t.Errorf("%s: expected %d rows, got %d", table, n, counts[table])
+		}
+	}
+}
+
+func TestHandleExport_SQLite(t *testing.T) {
+	setupTest()
+
+	rr := httptest.NewRecorder()
+	handleExport(rr, httptest.NewRequest("GET", "/admin/export", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Length") == "" {
+		t.Error("expected a Content-Length for progress")
+	}
+
+	path := filepath.Join(t.TempDir(), "export.db")
+	os.WriteFile(path, rr.Body.Bytes(), 0o600)
+	exported, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatalf("failed to open export: %v", err)
+	}
+	defer exported.Close()
+
+	var members int
+	if err := exported.QueryRow(`SELECT COUNT(*) FROM members`).Scan(&members); err != nil || members != 2 {
+		t.Errorf("expected 2 members in the export, got %d (err %v)", members, err)
+	}
+}
+
+func TestHandleExport_InvalidFormat(t *testing.T) {
+	setupTest()
+
+	rr := httptest.NewRecorder()
+	handleExport(rr, httptest.NewRequest("GET", "/admin/export?format=csv", nil))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// --- Field-Level Encryption ---
+//
+// The SQLite file sits on a shared Pi, so the sensitive columns listed in
+// encryptedFields (members' Discord IDs, and the Discord IDs and emails of
+// pending signups) can be encrypted by the application. FIELD_ENCRYPTION_KEYS
+// is a comma-separated list of base64 AES-256 keys (32 bytes each), which can
+// come from a secret file like any other secret (see secrets.go). Values are
+// encrypted with the first key and stored as enc1:<key id>:<base64>; the
+// other keys only decrypt.
+// At startup every value not encrypted with the first key, including
+// plaintext from before encryption was enabled, is re-encrypted with it, so
+// rotating a key means putting the new one first, restarting, then removing
+// the old one.
+//
+// Encryption is deterministic (AES-GCM with a nonce derived from the value),
+// so equal values have equal ciphertexts and lookups and UNIQUE constraints on
+// these columns keep working. It reveals which rows share a value, not the
+// value. The search index holds the ciphertext, so /search does not find
+// members by Discord ID while encryption is on.
+
+// fieldCiphertextPrefix marks an encrypted value
+const fieldCiphertextPrefix = "enc1:"
+
+// encryptedFields lists the columns holding encrypted values
+var encryptedFields = []struct {
+	table, column string
+}{
+	{"members", "discord_id"},
+	{"pending_members", "discord_id"},
+	{"pending_members", "email"},
+}
+
+// fieldKey is one key of FIELD_ENCRYPTION_KEYS
+type fieldKey struct {
+	id       string // First 8 hex digits of the SHA-256 of the key
+	aead     cipher.AEAD
+	nonceKey []byte // Derives the nonce of a value
+}
+
+// fieldCipher encrypts with its first key and decrypts with any of them
+type fieldCipher struct {
+	keys []fieldKey
+}
+
+// fieldEncryption is the cipher of encrypted fields, nil when encryption is off (loaded at startup)
+var fieldEncryption *fieldCipher
+
+// deriveFieldKey returns the subkey of key for purpose
+func deriveFieldKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
+
+// parseFieldKeys parses a comma-separated list of base64 keys, nil if there are none
+func parseFieldKeys(value string) (*fieldCipher, error) {
+	c := &fieldCipher{}
+	seen := make(map[string]bool)
+	for _, encoded := range strings.Split(value, ",") {
+		encoded = strings.TrimSpace(encoded)
+		if encoded == "" {
+			continue
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("key %d is not 32 bytes of base64", len(c.keys)+1)
+		}
+
+		sum := sha256.Sum256(key)
+		id := hex.EncodeToString(sum[:4])
+		if seen[id] {
+			return nil, fmt.Errorf("key %d is listed twice", len(c.keys)+1)
+		}
+		seen[id] = true
+
+		block, err := aes.NewCipher(deriveFieldKey(key, "encrypt"))
+		if err != nil {
+			return nil, err
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, err
+		}
+		c.keys = append(c.keys, fieldKey{id: id, aead: aead, nonceKey: deriveFieldKey(key, "nonce")})
+	}
+	if len(c.keys) == 0 {
+		return nil, nil
+	}
+	return c, nil
+}
+
+// loadFieldEncryption loads the field encryption keys from the environment
+func loadFieldEncryption() (*fieldCipher, error) {
+	return parseFieldKeys(os.Getenv("FIELD_ENCRYPTION_KEYS"))
+}
+
+// seal encrypts a value with the first key. Empty values, and all values when
+// encryption is off, are returned unchanged.
+func (c *fieldCipher) seal(value string) string {
+	if c == nil || value == "" {
+		return value
+	}
+	key := c.keys[0]
+	mac := hmac.New(sha256.New, key.nonceKey)
+	mac.Write([]byte(value))
+	nonce := mac.Sum(nil)[:key.aead.NonceSize()]
+
+	sealed := key.aead.Seal(nonce, nonce, []byte(value), nil)
+	return fieldCiphertextPrefix + key.id + ":" + base64.RawStdEncoding.EncodeToString(sealed)
+}
+
+// open decrypts a value sealed with any of the keys, returning plaintext values unchanged
+func (c *fieldCipher) open(value string) (string, error) {
+	rest, ok := strings.CutPrefix(value, fieldCiphertextPrefix)
+	if !ok {
+		return value, nil
+	}
+	id, encoded, _ := strings.Cut(rest, ":")
+	if c == nil {
+		return "", fmt.Errorf("value encrypted with key %s, but no FIELD_ENCRYPTION_KEYS are set", id)
+	}
+
+	for _, key := range c.keys {
+		if key.id != id {
+			continue
+		}
+		sealed, err := base64.RawStdEncoding.DecodeString(encoded)
+		if err != nil || len(sealed) < key.aead.NonceSize() {
+			return "", fmt.Errorf("malformed value encrypted with key %s", id)
+		}
+		nonce, ciphertext := sealed[:key.aead.NonceSize()], sealed[key.aead.NonceSize():]
+		plaintext, err := key.aead.Open(nil, nonce, ciphertext, nil)
+		if err != nil {
+			return "", fmt.Errorf("value encrypted with key %s does not decrypt: %w", id, err)
+		}
+		return string(plaintext), nil
+	}
+	return "", fmt.Errorf("value encrypted with key %s, which is not in FIELD_ENCRYPTION_KEYS", id)
+}
+
+// current reports whether a stored value is in the form seal would write
+func (c *fieldCipher) current(value string) bool {
+	if c == nil || value == "" {
+		return !strings.HasPrefix(value, fieldCiphertextPrefix)
+	}
+	return strings.HasPrefix(value, fieldCiphertextPrefix+c.keys[0].id+":")
+}
+
+// encryptField returns the stored form of a value of an encrypted field, also
+// used to look rows up by it
+func encryptField(value string) string {
+	return fieldEncryption.seal(value)
+}
+
+// decrypted scans an encrypted field into a string, decrypting it
+type decrypted struct {
+	dst *string
+}
+
+// Scan implements sql.Scanner
+func (d decrypted) Scan(src any) error {
+	var raw string
+	switch v := src.(type) {
+	case string:
+		raw = v
+	case []byte:
+		raw = string(v)
+	case nil:
+	default:
+		return fmt.Errorf("cannot scan %T into an encrypted field", src)
+	}
+
+	value, err := fieldEncryption.open(raw)
+	if err != nil {
+		return err
+	}
+	*d.dst = value
+	return nil
+}
+
+// resealFields re-encrypts every stored value of the encrypted fields that
+// is not encrypted with the first key, and returns how many were changed.
+// With encryption off it fails if any value is encrypted.
+func resealFields() (int, error) {
+	changed := 0
+	for _, f := range encryptedFields {
+		tx, err := db.Begin()
+		if err != nil {
+			return changed, err
+		}
+
+		rows, err := tx.Query(fmt.Sprintf(`SELECT id, %s FROM %s`, f.column, f.table))
+		if err != nil {
+			tx.Rollback()
+			return changed, err
+		}
+		stale := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var value string
+			if err := rows.Scan(&id, &value); err != nil {
+				rows.Close()
+				tx.Rollback()
+				return changed, err
+			}
+			if !fieldEncryption.current(value) {
+				stale[id] = value
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			tx.Rollback()
+			return changed, err
+		}
+
+		for id, value := range stale {
+			plaintext, err := fieldEncryption.open(value)
+			if err != nil {
+				tx.Rollback()
+				return changed, fmt.Errorf("%s.%s of row %d: %w", f.table, f.column, id, err)
+			}
+			if _, err := tx.Exec(fmt.Sprintf(`UPDATE %s SET %s = ? WHERE id = ?`, f.table, f.column), encryptField(plaintext), id); err != nil {
+				tx.Rollback()
+				return changed, err
+			}
+		}
+		if err := tx.Commit(); err != nil {
+			return changed, err
+		}
+		changed += len(stale)
+	}
+	return changed, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Field-Level Encryption Tests
+// ============================================================================
+
+// testFieldKey returns a base64 key made of one repeated byte
+func testFieldKey(b byte) string {
+	return base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{b}, 32))
+}
+
+// useFieldEncryption encrypts fields with keys for a test
+func useFieldEncryption(t *testing.T, keys ...string) {
+	t.Helper()
+
+	saved := fieldEncryption
+	c, err := parseFieldKeys(strings.Join(keys, ","))
+	if err != nil {
+		t.Fatalf("invalid keys: %v", err)
+	}
+	fieldEncryption = c
+	t.Cleanup(func() { fieldEncryption = saved })
+}
+
+// storedDiscordID returns the discord_id column of a member as stored
+func storedDiscordID(t *testing.T, id int64) string {
+	t.Helper()
+	var stored string
+	if err := db.QueryRow(`SELECT discord_id FROM members WHERE id = ?`, id).Scan(&stored); err != nil {
+		t.Fatalf("failed to read member %d: %v", id, err)
+	}
+	return stored
+}
+
+func TestFieldCipher_SealOpen(t *testing.T) {
+	old, _ := parseFieldKeys(testFieldKey(1))
+	c, _ := parseFieldKeys(testFieldKey(2) + "," + testFieldKey(1))
+
+	sealed := c.seal("111111111")
+	if !strings.HasPrefix(sealed, fieldCiphertextPrefix) || strings.Contains(sealed, "111111111") {
+		t.Fatalf("expected an encrypted value, got %q", sealed)
+	}
+	if c.seal("111111111") != sealed {
+		t.Error("expected equal values to encrypt equally")
+	}
+	if c.seal("222222222") == sealed {
+		t.Error("expected different values to encrypt differently")
+	}
+	if got, err := c.open(sealed); err != nil || got != "111111111" {
+		t.Errorf("expected the value back, got %q (%v)", got, err)
+	}
+
+	// Older keys still decrypt, plaintext and empty values pass through
+	if got, err := c.open(old.seal("111111111")); err != nil || got != "111111111" {
+		t.Errorf("expected an older key to decrypt, got %q (%v)", got, err)
+	}
+	if got, err := c.open("plain"); err != nil || got != "plain" {
+		t.Errorf("expected plaintext unchanged, got %q (%v)", got, err)
+	}
+	if c.seal("") != "" {
+		t.Error("expected empty values unencrypted")
+	}
+
+	// Missing or wrong keys fail
+	if _, err := old.open(sealed); err == nil {
+		t.Error("expected an error for a value encrypted with an unknown key")
+	}
+	if _, err := (*fieldCipher)(nil).open(sealed); err == nil {
+		t.Error("expected an error without keys")
+	}
+	tampered := sealed[:len(sealed)-2] + "AA"
+	if _, err := c.open(tampered); err == nil {
+		t.Error("expected an error for a tampered value")
+	}
+}
+
+func TestLoadFieldEncryption(t *testing.T) {
+	if c, err := loadFieldEncryption(); err != nil || c != nil {
+		t.Errorf("expected encryption off by default, got %v (%v)", c, err)
+	}
+
+	for _, value := range []string{"not-base64!", base64.StdEncoding.EncodeToString([]byte("short")), testFieldKey(1) + "," + testFieldKey(1)} {
+		t.Setenv("FIELD_ENCRYPTION_KEYS", value)
+		if _, err := loadFieldEncryption(); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+
+	t.Setenv("FIELD_ENCRYPTION_KEYS", testFieldKey(1)+", "+testFieldKey(2))
+	if c, err := loadFieldEncryption(); err != nil || c == nil || len(c.keys) != 2 {
+		t.Errorf("expected two keys, got %v (%v)", c, err)
+	}
+}
+
+func TestHandleMembers_EncryptsDiscordID(t *testing.T) {
+	setupTest()
+	useFieldEncryption(t, testFieldKey(1))
+
+	payload := []byte(`{"name":"Charlie","uid":"TEST_UID_3","discord_id":"333333333"}`)
+	req, _ := http.NewRequest("POST", "/members", bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+	handleMembers(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var id int64
+	db.QueryRow(`SELECT id FROM members WHERE uid = 'TEST_UID_3'`).Scan(&id)
+	if stored := storedDiscordID(t, id); !strings.HasPrefix(stored, fieldCiphertextPrefix) {
+		t.Fatalf("expected the Discord ID encrypted in the database, got %q", stored)
+	}
+
+	req, _ = http.NewRequest("GET", "/members", nil)
+	rr = httptest.NewRecorder()
+	handleMembers(rr, req)
+	if !strings.Contains(rr.Body.String(), `"discord_id":"333333333"`) {
+		t.Errorf("expected the Discord ID decrypted, got %s", rr.Body.String())
+	}
+}
+
+func TestResealFields_Rotation(t *testing.T) {
+	setupTest()
+	useStatelessMode(t)
+
+	// Plaintext rows from before encryption are encrypted
+	useFieldEncryption(t, testFieldKey(1))
+	if n, err := resealFields(); err != nil || n != 2 {
+		t.Fatalf("expected both members encrypted, got %d (%v)", n, err)
+	}
+	first := storedDiscordID(t, 1)
+
+	// Rotating re-encrypts with the new key, lookups keep working
+	useFieldEncryption(t, testFieldKey(2), testFieldKey(1))
+	if n, err := resealFields(); err != nil || n != 2 {
+		t.Fatalf("expected both members re-encrypted, got %d (%v)", n, err)
+	}
+	if stored := storedDiscordID(t, 1); stored == first || !fieldEncryption.current(stored) {
+		t.Errorf("expected the value encrypted with the new key, got %q", stored)
+	}
+	if n, _ := resealFields(); n != 0 {
+		t.Errorf("expected nothing left to re-encrypt, got %d", n)
+	}
+	if m, ok := findMemberByDiscordID("111111111", defaultOrg); !ok || m.Name != "Alice" || m.DiscordID != "111111111" {
+		t.Errorf("expected Alice by Discord ID, got %+v", m)
+	}
+
+	// Dropping the key that encrypted the values fails loudly
+	useFieldEncryption(t, testFieldKey(1))
+	if _, err := resealFields(); err == nil {
+		t.Error("expected an error for values encrypted with a removed key")
+	}
+}
+
+func TestSavePendingMember_Encrypted(t *testing.T) {
+	setupTest()
+	useFieldEncryption(t, testFieldKey(1))
+
+	p := PendingMember{Name: "Dana", DiscordID: "444444444", Email: "dana@example.com", Role: roleMember, SubmittedAt: time.Now()}
+	if added, err := savePendingMember(&p); err != nil || !added {
+		t.Fatalf("expected the signup added, got %v (%v)", added, err)
+	}
+	// The same Discord ID updates the signup
+	p.Email = "dana@uottawa.ca"
+	if added, err := savePendingMember(&p); err != nil || added {
+		t.Fatalf("expected the signup updated, got %v (%v)", added, err)
+	}
+
+	var discordID, email string
+	db.QueryRow(`SELECT discord_id, email FROM pending_members WHERE id = ?`, p.ID).Scan(&discordID, &email)
+	if strings.Contains(discordID, "444444444") || strings.Contains(email, "dana") {
+		t.Errorf("expected encrypted values, got %q and %q", discordID, email)
+	}
+	if loaded, err := loadPendingMember(p.ID); err != nil || loaded.Email != "dana@uottawa.ca" || loaded.DiscordID != "444444444" {
+		t.Errorf("expected the signup decrypted, got %+v (%v)", loaded, err)
+	}
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Firmware Updates ---
+//
+// Admins upload scanner firmware with POST /admin/firmware, tagged with a
+// version and a release channel. Each device follows one channel (stable by
+// default) and asks GET /devices/{id}/firmware?current=<version> whether a
+// newer build is available; the answer includes the download URL and SHA-256
+// the scanner verifies before flashing. Binaries are served from
+// GET /firmware/{id}.
+
+const (
+	defaultFirmwareChannel = "stable"
+	maxFirmwareSize        = 8 << 20 // ESP32 application partitions are far smaller
+)
+
+// firmwareVersionPattern matches versions such as 1.4.2 or v2.0
+var firmwareVersionPattern = regexp.MustCompile(`^v?\d+(\.\d+)*$`)
+
+// firmwareChannelPattern matches channel names such as stable or beta
+var firmwareChannelPattern = regexp.MustCompile(`^[a-z0-9_-]{1,32}$`)
+
+// Firmware is an uploaded firmware release (the binary itself is not included)
+type Firmware struct {
+	ID         int64     `json:"id"`
+	Version    string    `json:"version"`
+	Channel    string    `json:"channel"`
+	SHA256     string    `json:"sha256"`
+	Size       int64     `json:"size"`
+	UploadedAt time.Time `json:"uploaded_at"`
+	URL        string    `json:"url"`
+}
+
+// FirmwareCheckResponse tells a scanner whether it should update
+type FirmwareCheckResponse struct {
+	UpdateAvailable bool      `json:"update_available"`
+	Channel         string    `json:"channel"`
+	CurrentVersion  string    `json:"current_version,omitempty"`
+	Latest          *Firmware `json:"latest,omitempty"`
+}
+
+// firmwareColumns is the column list scanned by scanFirmware
+const firmwareColumns = `id, version, channel, sha256, size, uploaded_at`
+
+// scanFirmware reads a firmware row selected with firmwareColumns
+func scanFirmware(row rowScanner) (Firmware, error) {
+	var f Firmware
+	var uploadedAt string
+	if err := row.Scan(&f.ID, &f.Version, &f.Channel, &f.SHA256, &f.Size, &uploadedAt); err != nil {
+		return Firmware{}, err
+	}
+
+	var err error
+	if f.UploadedAt, err = time.Parse(time.RFC3339, uploadedAt); err != nil {
+		return Firmware{}, err
+	}
+	f.URL = publicPath(fmt.Sprintf("/firmware/%d", f.ID))
+	return f, nil
+}
+
+// loadFirmwares returns firmware releases, optionally limited to one channel, newest upload first
+func loadFirmwares(channel string) ([]Firmware, error) {
+	rows, err := db.Query(`SELECT `+firmwareColumns+` FROM firmware WHERE ? = '' OR channel = ? ORDER BY id DESC`, channel, channel)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	firmwares := []Firmware{}
+	for rows.Next() {
+		f, err := scanFirmware(rows)
+		if err != nil {
+			return nil, err
+		}
+		firmwares = append(firmwares, f)
+	}
+	return firmwares, rows.Err()
+}
+
+// latestFirmware returns the highest version released on a channel
+func latestFirmware(channel string) (Firmware, bool, error) {
+	firmwares, err := loadFirmwares(channel)
+	if err != nil || len(firmwares) == 0 {
+		return Firmware{}, false, err
+	}
+
+	latest := firmwares[0]
+	for _, f := range firmwares[1:] {
+		if compareVersions(f.Version, latest.Version) > 0 {
+			latest = f
+		}
+	}
+	return latest, true, nil
+}
+
+// compareVersions compares dotted version numbers, returning -1, 0 or 1.
+// A leading "v" is ignored and missing components count as zero.
+func compareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// handleFirmwareUploads handles /admin/firmware
+// GET lists releases (?channel= to filter). POST uploads a binary as the raw
+// request body with ?version= and ?channel= (default stable).
+func handleFirmwareUploads(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		firmwares, err := loadFirmwares(r.URL.Query().Get("channel"))
+		if err != nil {
+			log.Printf("Error querying firmware: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(firmwares)
+
+	case http.MethodPost:
+		version := strings.TrimSpace(r.URL.Query().Get("version"))
+		if !firmwareVersionPattern.MatchString(version) {
+			http.Error(w, "Invalid 'version' parameter, expected e.g. 1.4.2", http.StatusBadRequest)
+			return
+		}
+		channel := strings.TrimSpace(r.URL.Query().Get("channel"))
+		if channel == "" {
+			channel = defaultFirmwareChannel
+		}
+		if !firmwareChannelPattern.MatchString(channel) {
+			http.Error(w, "Invalid 'channel' parameter", http.StatusBadRequest)
+			return
+		}
+
+		data, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxFirmwareSize))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			http.Error(w, "Firmware image too large", http.StatusRequestEntityTooLarge)
+			return
+		} else if err != nil {
+			http.Error(w, "Failed to read firmware image", http.StatusBadRequest)
+			return
+		}
+		if len(data) == 0 {
+			http.Error(w, "Firmware image is empty", http.StatusBadRequest)
+			return
+		}
+
+		sum := sha256.Sum256(data)
+		res, err := db.Exec(`INSERT INTO firmware (version, channel, sha256, size, data, uploaded_at) VALUES (?, ?, ?, ?, ?, ?)`,
+			version, channel, hex.EncodeToString(sum[:]), len(data), data, time.Now().Format(time.RFC3339))
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "This version already exists on the channel", http.StatusConflict)
+				return
+			}
+			log.Printf("Error inserting firmware: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		id, _ := res.LastInsertId()
+		firmware, err := scanFirmware(db.QueryRow(`SELECT `+firmwareColumns+` FROM firmware WHERE id = ?`, id))
+		if err != nil {
+			log.Printf("Error loading uploaded firmware: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("firmware.uploaded", clientIP(r), fmt.Sprintf("version=%s channel=%s sha256=%s", version, channel, firmware.SHA256))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(firmware)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleFirmwareDownload serves a firmware binary at /firmware/{id}
+func handleFirmwareDownload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	id, sub, ok := parseIDPath(r.URL.Path, "/firmware/")
+	if !ok || sub != "" {
+		http.Error(w, "Invalid firmware ID", http.StatusBadRequest)
+		return
+	}
+
+	var version, sum string
+	var data []byte
+	err := db.QueryRow(`SELECT version, sha256, data FROM firmware WHERE id = ?`, id).Scan(&version, &sum, &data)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Firmware not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying firmware: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="firmware-%s.bin"`, version))
+	w.Header().Set("X-Firmware-SHA256", sum)
+	w.Write(data)
+}
+
+// handleDeviceFirmware reports whether a newer firmware is available on the device's channel
+// Query parameters:
+//   - current: the firmware version the scanner is running, recorded on the device
+func handleDeviceFirmware(w http.ResponseWriter, r *http.Request, deviceID int64) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	device, err := loadDevice(deviceID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	current := strings.TrimSpace(r.URL.Query().Get("current"))
+	if current != "" {
+		if !firmwareVersionPattern.MatchString(current) {
+			http.Error(w, "Invalid 'current' parameter, expected e.g. 1.4.2", http.StatusBadRequest)
+			return
+		}
+		if _, err := db.Exec(`UPDATE devices SET firmware_version = ? WHERE id = ?`, current, deviceID); err != nil {
+			log.Printf("Warning: Failed to record firmware version of device %d: %v", deviceID, err)
+		}
+	} else {
+		current = device.FirmwareVersion
+	}
+
+	resp := FirmwareCheckResponse{Channel: device.FirmwareChannel, CurrentVersion: current}
+	latest, found, err := latestFirmware(device.FirmwareChannel)
+	if err != nil {
+		log.Printf("Error querying firmware: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if found {
+		resp.Latest = &latest
+		resp.UpdateAvailable = current == "" || compareVersions(latest.Version, current) > 0
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
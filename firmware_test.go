@@ -0,0 +1,190 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// Firmware Upload and Update Tests
+// ============================================================================
+
+func TestCompareVersions(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"v1.2", "1.2.0", 0},
+		{"1.10.0", "1.9.9", 1},
+		{"1.2", "1.2.1", -1},
+		{"2", "1.99", 1},
+	}
+
+	for _, c := range cases {
+		if got := compareVersions(c.a, c.b); got != c.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
+
+// uploadTestFirmware uploads a firmware image and returns the created release
+func uploadTestFirmware(t *testing.T, version, channel string, image []byte) Firmware {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/admin/firmware?version="+version+"&channel="+channel, bytes.NewReader(image))
+	rr := httptest.NewRecorder()
+	handleFirmwareUploads(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var firmware Firmware
+	if err := json.Unmarshal(rr.Body.Bytes(), &firmware); err != nil {
+		t.Fatalf("failed to parse firmware: %v", err)
+	}
+	return firmware
+}
+
+// checkFirmware asks /devices/{id}/firmware whether an update is available
+func checkFirmware(t *testing.T, deviceID int64, query string) FirmwareCheckResponse {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/devices/%d/firmware%s", deviceID, query), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp FirmwareCheckResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return resp
+}
+
+func TestHandleFirmwareUploads_UploadAndDownload(t *testing.T) {
+	setupTest()
+
+	image := []byte("esp32 firmware image")
+	firmware := uploadTestFirmware(t, "1.2.0", "stable", image)
+
+	sum := sha256.Sum256(image)
+	if firmware.SHA256 != hex.EncodeToString(sum[:]) || firmware.Size != int64(len(image)) {
+		t.Errorf("unexpected checksum or size: %+v", firmware)
+	}
+
+	req, _ := http.NewRequest("GET", firmware.URL, nil)
+	rr := httptest.NewRecorder()
+	handleFirmwareDownload(rr, req)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), image) {
+		t.Fatalf("expected the uploaded image, got %v %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("X-Firmware-SHA256") != firmware.SHA256 {
+		t.Errorf("expected checksum header, got %q", rr.Header().Get("X-Firmware-SHA256"))
+	}
+
+	// The same version cannot be uploaded twice to a channel
+	req, _ = http.NewRequest("POST", "/admin/firmware?version=1.2.0&channel=stable", bytes.NewReader(image))
+	rr = httptest.NewRecorder()
+	handleFirmwareUploads(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict, got %v", rr.Code)
+	}
+
+	entries, _ := loadAuditEntries("firmware.uploaded", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected one firmware.uploaded audit entry, got %+v", entries)
+	}
+}
+
+func TestHandleFirmwareUploads_Invalid(t *testing.T) {
+	setupTest()
+
+	tests := []struct {
+		query string
+		body  []byte
+	}{
+		{"?channel=stable", []byte("image")},
+		{"?version=latest", []byte("image")},
+		{"?version=1.0&channel=Not%20Valid", []byte("image")},
+		{"?version=1.0", nil},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/admin/firmware"+tt.query, bytes.NewReader(tt.body))
+		rr := httptest.NewRecorder()
+		handleFirmwareUploads(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %v", tt.query, rr.Code)
+		}
+	}
+}
+
+func TestHandleDeviceFirmware(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+
+	// No releases yet
+	if resp := checkFirmware(t, device.ID, "?current=1.0.0"); resp.UpdateAvailable || resp.Latest != nil || resp.Channel != "stable" {
+		t.Errorf("expected no update without releases, got %+v", resp)
+	}
+
+	uploadTestFirmware(t, "1.10.0", "stable", []byte("new"))
+	uploadTestFirmware(t, "1.9.0", "stable", []byte("old"))
+	uploadTestFirmware(t, "2.0.0", "beta", []byte("beta"))
+
+	resp := checkFirmware(t, device.ID, "?current=1.9.0")
+	if !resp.UpdateAvailable || resp.Latest == nil || resp.Latest.Version != "1.10.0" {
+		t.Errorf("expected an update to 1.10.0, got %+v", resp)
+	}
+	if resp := checkFirmware(t, device.ID, "?current=1.10.0"); resp.UpdateAvailable {
+		t.Errorf("expected no update when up to date, got %+v", resp)
+	}
+
+	// The reported version is recorded on the device
+	updated, _ := loadDevice(device.ID)
+	if updated.FirmwareVersion != "1.10.0" {
+		t.Errorf("expected firmware version 1.10.0 on the device, got %q", updated.FirmwareVersion)
+	}
+
+	// Moving the device to the beta channel offers the beta build
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/devices/%d", device.ID), bytes.NewBufferString(`{"firmware_channel":"beta"}`))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if resp := checkFirmware(t, device.ID, ""); !resp.UpdateAvailable || resp.Latest.Version != "2.0.0" {
+		t.Errorf("expected the beta build, got %+v", resp)
+	}
+}
+
+func TestHandleDeviceFirmware_Invalid(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/devices/%d/firmware?current=abc", device.ID), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/devices/99/firmware", nil)
+	rr = httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found, got %v", rr.Code)
+	}
+}
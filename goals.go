@@ -0,0 +1,482 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Attendance Goals ---
+//
+// A goal sets the office hours expected in a term, either for one member or
+// for every member with a role. A member's own goal takes precedence over
+// their role's. The first time a member signs out having reached their goal a
+// "goal.completed" audit entry is written and a message is posted to
+// NOTIFY_WEBHOOK_URL.
+
+// Goal is an hour target for a member or role within a term
+type Goal struct {
+	ID       int64   `json:"id"`
+	TermID   int64   `json:"term_id"`
+	MemberID *int64  `json:"member_id,omitempty"`
+	Role     string  `json:"role,omitempty"`
+	Hours    float64 `json:"hours"`
+}
+
+// GoalProgress reports a member's progress towards their goal
+type GoalProgress struct {
+	GoalID      int64      `json:"goal_id"`
+	Source      string     `json:"source"` // "member" or "role"
+	TargetHours float64    `json:"target_hours"`
+	Hours       float64    `json:"hours"`
+	Percent     float64    `json:"percent"`
+	Completed   bool       `json:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+}
+
+// MemberStats is the /members/{id}/stats response
+type MemberStats struct {
+	Member     Member        `json:"member"`
+	Term       *Term         `json:"term,omitempty"`
+	VisitCount int           `json:"visit_count"`
+	Hours      float64       `json:"hours"`
+	Goal       *GoalProgress `json:"goal,omitempty"`
+}
+
+// goalColumns is the column list scanned by scanGoal
+const goalColumns = `id, term_id, member_id, role, hours`
+
+// scanGoal reads a goal row selected with goalColumns
+func scanGoal(row rowScanner) (Goal, error) {
+	var g Goal
+	var memberID sql.NullInt64
+	var role sql.NullString
+	if err := row.Scan(&g.ID, &g.TermID, &memberID, &role, &g.Hours); err != nil {
+		return Goal{}, err
+	}
+	if memberID.Valid {
+		g.MemberID = &memberID.Int64
+	}
+	g.Role = role.String
+	return g, nil
+}
+
+// loadGoal fetches a single goal by ID
+func loadGoal(id int64) (Goal, error) {
+	return scanGoal(db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE id = ?`, id))
+}
+
+// loadGoals returns all goals, optionally only those of one term (termID 0 means all)
+func loadGoals(termID int64) ([]Goal, error) {
+	query := `SELECT ` + goalColumns + ` FROM goals`
+	var args []interface{}
+	if termID > 0 {
+		query += ` WHERE term_id = ?`
+		args = append(args, termID)
+	}
+	query += ` ORDER BY id`
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	goals := []Goal{}
+	for rows.Next() {
+		g, err := scanGoal(rows)
+		if err != nil {
+			return nil, err
+		}
+		goals = append(goals, g)
+	}
+	return goals, rows.Err()
+}
+
+// goalForMember returns the goal applying to a member in a term: their own
+// goal if set, otherwise their role's
+func goalForMember(member Member, termID int64) (Goal, string, bool, error) {
+	g, err := scanGoal(db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE term_id = ? AND member_id = ?`, termID, member.ID))
+	if err == nil {
+		return g, "member", true, nil
+	} else if err != sql.ErrNoRows {
+		return Goal{}, "", false, err
+	}
+
+	role := member.Role
+	if role == "" {
+		role = roleMember
+	}
+	g, err = scanGoal(db.QueryRow(`SELECT `+goalColumns+` FROM goals WHERE term_id = ? AND role = ?`, termID, role))
+	if err == sql.ErrNoRows {
+		return Goal{}, "", false, nil
+	} else if err != nil {
+		return Goal{}, "", false, err
+	}
+	return g, "role", true, nil
+}
+
+// memberPresence returns a member's visit count and time in the office over [from, to]
+func memberPresence(memberID int64, from, to, now time.Time, times string) (int, time.Duration, error) {
+	intervals, err := loadPresenceIntervals(from, to, now, times)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	visits := 0
+	for _, p := range intervals {
+		if p.MemberID == memberID {
+			if _, ok := clipInterval(p, from, to); ok {
+				visits++
+			}
+		}
+	}
+
+	var total time.Duration
+	for _, p := range memberIntervals(intervals, memberID, from, to) {
+		total += p.End.Sub(p.Start)
+	}
+	return visits, total, nil
+}
+
+// goalProgress computes a member's progress in a term from their hours and
+// the recorded completion, if any. It never records one: completions are only
+// recorded on sign-out (see checkGoalCompletion). It returns nil if no goal applies.
+func goalProgress(member Member, term Term, hours float64) (*GoalProgress, error) {
+	goal, source, found, err := goalForMember(member, term.ID)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	progress := &GoalProgress{
+		GoalID:      goal.ID,
+		Source:      source,
+		TargetHours: goal.Hours,
+		Hours:       hours,
+		Completed:   hours >= goal.Hours,
+	}
+	if goal.Hours > 0 {
+		progress.Percent = min(100, hours/goal.Hours*100)
+	}
+
+	var completedAt string
+	err = db.QueryRow(`SELECT completed_at FROM goal_completions WHERE goal_id = ? AND member_id = ?`,
+		goal.ID, member.ID).Scan(&completedAt)
+	if err == sql.ErrNoRows {
+		return progress, nil
+	} else if err != nil {
+		return nil, err
+	}
+	t, err := time.Parse(time.RFC3339, completedAt)
+	if err != nil {
+		return nil, err
+	}
+	progress.Completed, progress.CompletedAt = true, &t
+	return progress, nil
+}
+
+// recordGoalCompletion marks a goal as reached by a member, announcing it the first time
+func recordGoalCompletion(goal Goal, member Member, term Term) error {
+	res, err := db.Exec(`INSERT OR IGNORE INTO goal_completions (goal_id, member_id, completed_at) VALUES (?, ?, ?)`,
+		goal.ID, member.ID, time.Now().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+
+	if n, _ := res.RowsAffected(); n == 1 {
+		msg := fmt.Sprintf("%s reached their goal of %g office hours for %s!", member.Name, goal.Hours, term.Name)
+		log.Println(msg)
+		incCounter("goals_completed_total")
+		recordAudit("goal.completed", member.Name, fmt.Sprintf("goal %d (%g hours, %s)", goal.ID, goal.Hours, term.Name))
+		if name := notificationName(member); name != "" {
+			notifyOrg(defaultOrg, integrationGoals, fmt.Sprintf("%s reached their goal of %g office hours for %s!", name, goal.Hours, term.Name))
+		}
+	}
+	return nil
+}
+
+// checkGoalCompletion records a member's goal completion in the current term, if reached.
+// Subscribed to sign-out events; errors are only logged. Terms and goals are
+// the host organization's, so members of other organizations have none.
+func checkGoalCompletion(member Member) {
+	if memberOrg(member) != defaultOrg {
+		return
+	}
+	now := time.Now()
+	term, found, err := currentTerm(now)
+	if err != nil {
+		log.Printf("Error loading current term for goal check: %v", err)
+		return
+	}
+	if !found {
+		return
+	}
+
+	goal, _, found, err := goalForMember(member, term.ID)
+	if err != nil {
+		log.Printf("Error loading goal for member %d: %v", member.ID, err)
+		return
+	}
+	if !found {
+		return
+	}
+	_, total, err := memberPresence(member.ID, term.Start, term.End, now, sessionTimesCorrected)
+	if err != nil {
+		log.Printf("Error loading presence for goal check: %v", err)
+		return
+	}
+	if total.Hours() >= goal.Hours {
+		if err := recordGoalCompletion(goal, member, term); err != nil {
+			log.Printf("Error recording goal completion for member %d: %v", member.ID, err)
+		}
+	}
+}
+
+// handleMemberStats returns a member's hours in a term and their goal progress
+// Query parameters:
+//   - term: term name, or "all" (defaults to the current term if one is defined)
+//   - from: RFC3339 formatted start date (no goal progress is reported)
+//   - to: RFC3339 formatted end date (no goal progress is reported)
+//   - times: corrected (default) or raw
+func handleMemberStats(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	member, found := findMemberByID(id)
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	from, to, termName, ok := parseReportRange(w, r)
+	if !ok {
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	visits, total, err := memberPresence(member.ID, from, to, time.Now(), times)
+	if err != nil {
+		log.Printf("Error loading presence for member %d: %v", member.ID, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	stats := MemberStats{Member: member, VisitCount: visits, Hours: total.Hours()}
+	if termName != "" {
+		term, err := loadTermByName(termName)
+		if err != nil {
+			log.Printf("Error loading term %q: %v", termName, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		stats.Term = &term
+
+		if stats.Goal, err = goalProgress(member, term, stats.Hours); err != nil {
+			log.Printf("Error computing goal progress for member %d: %v", member.ID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// decodeGoal reads and validates a goal payload
+func decodeGoal(w http.ResponseWriter, r *http.Request) (Goal, bool) {
+	var req Goal
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return Goal{}, false
+	}
+
+	if req.TermID < 1 || req.Hours <= 0 {
+		http.Error(w, "term_id and a positive hours are required", http.StatusBadRequest)
+		return Goal{}, false
+	}
+	req.Role = strings.TrimSpace(req.Role)
+	if (req.MemberID == nil) == (req.Role == "") {
+		http.Error(w, "Exactly one of member_id or role is required", http.StatusBadRequest)
+		return Goal{}, false
+	}
+	if req.Role != "" {
+		role, ok := normalizeRole(req.Role)
+		if !ok {
+			http.Error(w, "Invalid 'role', expected member, exec, officer or guest", http.StatusBadRequest)
+			return Goal{}, false
+		}
+		req.Role = role
+	}
+
+	if _, err := loadTerm(req.TermID); err == sql.ErrNoRows {
+		http.Error(w, "Term not found", http.StatusBadRequest)
+		return Goal{}, false
+	} else if err != nil {
+		log.Printf("Error querying term: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return Goal{}, false
+	}
+	if req.MemberID != nil {
+		if _, found := findMemberByID(*req.MemberID); !found {
+			http.Error(w, "Member not found", http.StatusBadRequest)
+			return Goal{}, false
+		}
+	}
+	return req, true
+}
+
+// goalArgs returns the nullable member_id and role columns of a goal
+func goalArgs(g Goal) (interface{}, interface{}) {
+	var memberID, role interface{}
+	if g.MemberID != nil {
+		memberID = *g.MemberID
+	}
+	if g.Role != "" {
+		role = g.Role
+	}
+	return memberID, role
+}
+
+// handleGoals supports GET to list goals (optionally ?term_id=) and POST to create a goal
+func handleGoals(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		var termID int64
+		if termIDStr := r.URL.Query().Get("term_id"); termIDStr != "" {
+			if n, err := fmt.Sscanf(termIDStr, "%d", &termID); err != nil || n != 1 || termID < 1 {
+				http.Error(w, "Invalid 'term_id' parameter, expected positive integer", http.StatusBadRequest)
+				return
+			}
+		}
+
+		goals, err := loadGoals(termID)
+		if err != nil {
+			log.Printf("Error querying goals: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(goals)
+
+	case http.MethodPost:
+		req, ok := decodeGoal(w, r)
+		if !ok {
+			return
+		}
+
+		memberID, role := goalArgs(req)
+		res, err := db.Exec(`INSERT INTO goals (term_id, member_id, role, hours) VALUES (?, ?, ?, ?)`,
+			req.TermID, memberID, role, req.Hours)
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "A goal for this member or role already exists in this term", http.StatusConflict)
+				return
+			}
+			// The term or member was deleted since decodeGoal checked it
+			if isForeignKeyViolation(err) {
+				http.Error(w, "Term or member not found", http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error inserting goal: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		req.ID, _ = res.LastInsertId()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleGoal handles /goals/{id} (GET, PUT, DELETE)
+func handleGoal(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/goals/")
+	if !ok {
+		http.Error(w, "Invalid goal ID", http.StatusBadRequest)
+		return
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		goal, err := loadGoal(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying goal: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(goal)
+
+	case http.MethodPut:
+		req, ok := decodeGoal(w, r)
+		if !ok {
+			return
+		}
+
+		memberID, role := goalArgs(req)
+		result, err := db.Exec(`UPDATE goals SET term_id = ?, member_id = ?, role = ?, hours = ? WHERE id = ?`,
+			req.TermID, memberID, role, req.Hours, id)
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "A goal for this member or role already exists in this term", http.StatusConflict)
+				return
+			}
+			// The term or member was deleted since decodeGoal checked it
+			if isForeignKeyViolation(err) {
+				http.Error(w, "Term or member not found", http.StatusBadRequest)
+				return
+			}
+			log.Printf("Error updating goal: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		}
+
+		req.ID = id
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+
+	case http.MethodDelete:
+		result, err := db.Exec(`DELETE FROM goals WHERE id = ?`, id)
+		if err != nil {
+			log.Printf("Error deleting goal: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Goal not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Goal deleted successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /goals Endpoint Tests
+// ============================================================================
+
+// createTestGoal creates a goal from a JSON body and returns it
+func createTestGoal(t *testing.T, body string) Goal {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/goals", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleGoals(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var goal Goal
+	if err := json.Unmarshal(rr.Body.Bytes(), &goal); err != nil {
+		t.Fatalf("failed to parse goal: %v", err)
+	}
+	return goal
+}
+
+// memberStats fetches /members/{id}/stats
+func memberStats(t *testing.T, id int64, query string) MemberStats {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/members/%d/stats%s", id, query), nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var stats MemberStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to parse stats: %v", err)
+	}
+	return stats
+}
+
+func TestHandleGoals_CreateAndList(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	term := createTestTerm(t, "current", now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+
+	createTestGoal(t, fmt.Sprintf(`{"term_id":%d,"role":"member","hours":20}`, term.ID))
+	goal := createTestGoal(t, fmt.Sprintf(`{"term_id":%d,"member_id":1,"hours":10}`, term.ID))
+	if goal.MemberID == nil || *goal.MemberID != 1 || goal.Role != "" {
+		t.Errorf("unexpected goal: %+v", goal)
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/goals?term_id=%d", term.ID), nil)
+	rr := httptest.NewRecorder()
+	handleGoals(rr, req)
+
+	var goals []Goal
+	if err := json.Unmarshal(rr.Body.Bytes(), &goals); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(goals) != 2 {
+		t.Errorf("expected 2 goals, got %+v", goals)
+	}
+}
+
+func TestHandleGoals_CreateInvalid(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	term := createTestTerm(t, "current", now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+	createTestGoal(t, fmt.Sprintf(`{"term_id":%d,"role":"exec","hours":20}`, term.ID))
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{fmt.Sprintf(`{"term_id":%d,"hours":20}`, term.ID), http.StatusBadRequest},
+		{fmt.Sprintf(`{"term_id":%d,"member_id":1,"role":"exec","hours":20}`, term.ID), http.StatusBadRequest},
+		{fmt.Sprintf(`{"term_id":%d,"role":"exec","hours":0}`, term.ID), http.StatusBadRequest},
+		{fmt.Sprintf(`{"term_id":%d,"role":"president","hours":20}`, term.ID), http.StatusBadRequest},
+		{fmt.Sprintf(`{"term_id":%d,"member_id":99,"hours":20}`, term.ID), http.StatusBadRequest},
+		{`{"term_id":99,"role":"member","hours":20}`, http.StatusBadRequest},
+		{fmt.Sprintf(`{"term_id":%d,"role":"exec","hours":30}`, term.ID), http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/goals", bytes.NewBufferString(tt.body))
+		rr := httptest.NewRecorder()
+		handleGoals(rr, req)
+
+		if rr.Code != tt.code {
+			t.Errorf("%s: expected %d, got %v", tt.body, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestHandleGoal_UpdateDelete(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	term := createTestTerm(t, "current", now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+	goal := createTestGoal(t, fmt.Sprintf(`{"term_id":%d,"role":"member","hours":20}`, term.ID))
+	path := fmt.Sprintf("/goals/%d", goal.ID)
+
+	req, _ := http.NewRequest("PUT", path, bytes.NewBufferString(fmt.Sprintf(`{"term_id":%d,"role":"member","hours":25}`, term.ID)))
+	rr := httptest.NewRecorder()
+	handleGoal(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if updated, _ := loadGoal(goal.ID); updated.Hours != 25 {
+		t.Errorf("expected 25 hours, got %v", updated.Hours)
+	}
+
+	req, _ = http.NewRequest("DELETE", path, nil)
+	rr = httptest.NewRecorder()
+	handleGoal(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	handleGoal(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %v", rr.Code)
+	}
+}
+
+// ============================================================================
+// /members/{id}/stats and Goal Progress Tests
+// ============================================================================
+
+func TestHandleMemberStats_GoalProgress(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	term := createTestTerm(t, "current", now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+	createTestGoal(t, fmt.Sprintf(`{"term_id":%d,"role":"member","hours":4}`, term.ID))
+	saveVisitToDB(1, now.AddDate(0, 0, -2), now.AddDate(0, 0, -2).Add(time.Hour))
+	// Outside the term
+	saveVisitToDB(1, now.AddDate(0, 0, -30), now.AddDate(0, 0, -30).Add(5*time.Hour))
+
+	stats := memberStats(t, 1, "")
+	if stats.Term == nil || stats.Term.Name != "current" {
+		t.Fatalf("expected the current term, got %+v", stats.Term)
+	}
+	if stats.VisitCount != 1 || stats.Hours != 1 {
+		t.Errorf("expected 1 visit and 1 hour, got %d and %v", stats.VisitCount, stats.Hours)
+	}
+	if stats.Goal == nil || stats.Goal.Source != "role" || stats.Goal.Percent != 25 || stats.Goal.Completed {
+		t.Errorf("expected 25%% of the role goal, got %+v", stats.Goal)
+	}
+
+	// A member goal takes precedence over the role goal
+	createTestGoal(t, fmt.Sprintf(`{"term_id":%d,"member_id":1,"hours":1}`, term.ID))
+	stats = memberStats(t, 1, "")
+	if stats.Goal == nil || stats.Goal.Source != "member" || !stats.Goal.Completed || stats.Goal.CompletedAt != nil {
+		t.Errorf("expected the completed member goal, not yet recorded, got %+v", stats.Goal)
+	}
+
+	// Reading progress records nothing; the next sign-out does
+	if entries, _ := loadAuditEntries("goal.completed", 10); len(entries) != 0 {
+		t.Errorf("expected no completion recorded by a GET, got %+v", entries)
+	}
+	checkGoalCompletion(cachedMember("TEST_UID_1"))
+	stats = memberStats(t, 1, "")
+	if stats.Goal == nil || !stats.Goal.Completed || stats.Goal.CompletedAt == nil {
+		t.Errorf("expected the recorded completion, got %+v", stats.Goal)
+	}
+
+	// All-time stats carry no goal
+	stats = memberStats(t, 1, "?term=all")
+	if stats.Hours != 6 || stats.Goal != nil || stats.Term != nil {
+		t.Errorf("expected 6 hours without goal, got %+v", stats)
+	}
+}
+
+func TestHandleMemberStats_NotFound(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/members/99/stats", nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found, got %v", rr.Code)
+	}
+}
+
+func TestGoalCompletion_AnnouncedOnceOnSignOut(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	term := createTestTerm(t, "current", now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+	createTestGoal(t, fmt.Sprintf(`{"term_id":%d,"member_id":1,"hours":1}`, term.ID))
+
+	member := cachedMember("TEST_UID_1")
+	currentAttendees.signIn(member.UID, "", now.Add(-2*time.Hour))
+	if _, err := performSignOut(context.Background(), member); err != nil {
+		t.Fatalf("sign-out failed: %v", err)
+	}
+	currentAttendees.signIn(member.UID, "", now.Add(-time.Hour))
+	if _, err := performSignOut(context.Background(), member); err != nil {
+		t.Fatalf("sign-out failed: %v", err)
+	}
+	events.wait()
+
+	entries, err := loadAuditEntries("goal.completed", 10)
+	if err != nil {
+		t.Fatalf("failed to load audit log: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "Alice" {
+		t.Errorf("expected one goal.completed entry for Alice, got %+v", entries)
+	}
+}
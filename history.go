@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- History Aggregation ---
+//
+// Totals over recorded visits computed by the database, so reporting clients
+// don't have to download and sum every visit. Open sessions are not visits
+// yet and are not counted.
+
+// MemberTotals is one member's row in /history/aggregate
+type MemberTotals struct {
+	MemberID     int64   `json:"member_id"`
+	Name         string  `json:"name"`
+	Role         string  `json:"role"`
+	Sessions     int     `json:"sessions"`
+	TotalSeconds int64   `json:"total_seconds"`
+	Hours        float64 `json:"hours"`
+}
+
+// AggregateResponse is the /history/aggregate response
+type AggregateResponse struct {
+	GroupBy string         `json:"group_by"`
+	Role    string         `json:"role,omitempty"`
+	From    *time.Time     `json:"from,omitempty"`
+	To      *time.Time     `json:"to,omitempty"`
+	Groups  []MemberTotals `json:"groups"`
+}
+
+// loadMemberTotals sums visits per member, keeping visits that started within
+// [from, to] (zero bounds are open) by members with a role ("" for all), most
+// hours first, with the session times given by times
+func loadMemberTotals(from, to time.Time, role, times string) ([]MemberTotals, error) {
+	query := `
+		SELECT m.id, m.name, m.role, COUNT(DISTINCT v.id),
+			CAST(ROUND(SUM(julianday(v.signout_time) - julianday(v.signin_time)) * 86400) AS INTEGER)
+		FROM ` + reportedVisits(times) + ` v
+		JOIN members m ON m.id = v.member_id`
+
+	var conditions []string
+	var args []interface{}
+	if !from.IsZero() {
+		conditions = append(conditions, "julianday(v.signin_time) >= julianday(?)")
+		args = append(args, from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "julianday(v.signin_time) <= julianday(?)")
+		args = append(args, to.Format(time.RFC3339))
+	}
+	if role != "" {
+		conditions = append(conditions, "m.role = ?")
+		args = append(args, role)
+	}
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " GROUP BY m.id ORDER BY 5 DESC, m.name"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	totals := []MemberTotals{}
+	for rows.Next() {
+		var t MemberTotals
+		if err := rows.Scan(&t.MemberID, &t.Name, &t.Role, &t.Sessions, &t.TotalSeconds); err != nil {
+			return nil, err
+		}
+		t.Hours = float64(t.TotalSeconds) / 3600
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// handleHistoryAggregate returns visit totals per group
+// Query parameters:
+//   - group_by: member (default, and currently the only grouping)
+//   - from: RFC3339 formatted start date (inclusive), by sign-in time
+//   - to: RFC3339 formatted end date (inclusive), by sign-in time
+//   - term: term name instead of from/to
+//   - role: only count members with this role (e.g. exec for exec office hours)
+//   - times: corrected (default) or raw
+func handleHistoryAggregate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	groupBy := r.URL.Query().Get("group_by")
+	if groupBy == "" {
+		groupBy = "member"
+	}
+	if groupBy != "member" {
+		http.Error(w, "Invalid 'group_by' parameter, expected member", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	role, ok := roleFromParam(w, r)
+	if !ok {
+		return
+	}
+
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	groups, err := loadMemberTotals(from, to, role, times)
+	if err != nil {
+		log.Printf("Error aggregating visits: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	setSessionLedgerHead(w)
+
+	resp := AggregateResponse{GroupBy: groupBy, Role: role, Groups: groups}
+	if !from.IsZero() {
+		resp.From = &from
+	}
+	if !to.IsZero() {
+		resp.To = &to
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
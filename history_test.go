@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /history/aggregate Endpoint Tests
+// ============================================================================
+
+func TestHandleHistoryAggregate_ByMember(t *testing.T) {
+	setupTest()
+
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	saveVisitToDB(1, base, base.Add(time.Hour))
+	saveVisitToDB(1, base.Add(24*time.Hour), base.Add(24*time.Hour+30*time.Minute))
+	saveVisitToDB(2, base, base.Add(3*time.Hour))
+
+	req, _ := http.NewRequest("GET", "/history/aggregate?group_by=member", nil)
+	rr := httptest.NewRecorder()
+	handleHistoryAggregate(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var resp AggregateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(resp.Groups) != 2 {
+		t.Fatalf("expected 2 members, got %+v", resp.Groups)
+	}
+
+	// Most hours first
+	bob, alice := resp.Groups[0], resp.Groups[1]
+	if bob.Name != "Bob" || bob.Sessions != 1 || bob.TotalSeconds != 3*3600 || bob.Hours != 3 {
+		t.Errorf("unexpected totals for Bob: %+v", bob)
+	}
+	if alice.Name != "Alice" || alice.Sessions != 2 || alice.TotalSeconds != 5400 || alice.Hours != 1.5 {
+		t.Errorf("unexpected totals for Alice: %+v", alice)
+	}
+}
+
+func TestHandleHistoryAggregate_Range(t *testing.T) {
+	setupTest()
+
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	saveVisitToDB(1, base, base.Add(time.Hour))
+	saveVisitToDB(1, base.Add(48*time.Hour), base.Add(50*time.Hour))
+
+	from := url.QueryEscape(base.Add(24 * time.Hour).Format(time.RFC3339))
+	req, _ := http.NewRequest("GET", "/history/aggregate?from="+from, nil)
+	rr := httptest.NewRecorder()
+	handleHistoryAggregate(rr, req)
+
+	var resp AggregateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.From == nil || len(resp.Groups) != 1 || resp.Groups[0].Sessions != 1 || resp.Groups[0].TotalSeconds != 7200 {
+		t.Errorf("expected only the later visit, got %+v", resp)
+	}
+}
+
+func TestHandleHistoryAggregate_Role(t *testing.T) {
+	setupTest()
+	db.Exec(`UPDATE members SET role = 'exec' WHERE id = 2`)
+
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	saveVisitToDB(1, base, base.Add(time.Hour))
+	saveVisitToDB(2, base, base.Add(2*time.Hour))
+
+	req, _ := http.NewRequest("GET", "/history/aggregate?role=exec", nil)
+	rr := httptest.NewRecorder()
+	handleHistoryAggregate(rr, req)
+
+	var resp AggregateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Role != roleExec || len(resp.Groups) != 1 || resp.Groups[0].Name != "Bob" || resp.Groups[0].Role != roleExec || resp.Groups[0].Hours != 2 {
+		t.Errorf("expected only Bob's exec hours, got %+v", resp)
+	}
+
+	req, _ = http.NewRequest("GET", "/history/aggregate?role=alumni", nil)
+	rr = httptest.NewRecorder()
+	handleHistoryAggregate(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an unknown role, got %v", rr.Code)
+	}
+}
+
+func TestHandleHistoryAggregate_NoVisits(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/history/aggregate", nil)
+	rr := httptest.NewRecorder()
+	handleHistoryAggregate(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Body.String() != "{\"group_by\":\"member\",\"groups\":[]}\n" {
+		t.Errorf("expected an empty member grouping, got %v %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleHistoryAggregate_InvalidGroupBy(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/history/aggregate?group_by=room", nil)
+	rr := httptest.NewRecorder()
+	handleHistoryAggregate(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,303 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Database Integrity ---
+//
+// The office Pi loses power regularly, which can corrupt the database. At
+// startup and every INTEGRITY_CHECK_INTERVAL (default 24h) the database is
+// checked with PRAGMA integrity_check and PRAGMA foreign_key_check. A failed
+// check is logged, written to the audit log and sent to ALERT_WEBHOOK_URL;
+// the latest result is served by GET /healthz, with 503 while it fails.
+//
+// With INTEGRITY_RESTORE_DIR set to a folder of database backups (such as
+// copies saved from GET /admin/export), a database found corrupt at startup
+// (integrity_check problems, not foreign key violations alone) is moved aside
+// with a .corrupt-<time> suffix and replaced by the newest backup that is not
+// corrupt itself. Visits since that backup are lost, so
+// the restore is alerted too. A check failing while the server runs only
+// alerts; the restore happens at the next start.
+
+const (
+	defaultIntegrityCheckInterval = 24 * time.Hour
+
+	// Most integrity_check messages kept in a report
+	maxIntegrityProblems = 20
+)
+
+// ForeignKeyViolation is a row referring to a missing parent row
+type ForeignKeyViolation struct {
+	Table  string `json:"table"`
+	RowID  int64  `json:"rowid"`
+	Parent string `json:"parent"`
+}
+
+// IntegrityReport is the result of a database integrity check
+type IntegrityReport struct {
+	CheckedAt            time.Time             `json:"checked_at"`
+	OK                   bool                  `json:"ok"`
+	Problems             []string              `json:"problems"` // integrity_check messages
+	ForeignKeyViolations []ForeignKeyViolation `json:"foreign_key_violations"`
+	Error                string                `json:"error,omitempty"` // The check itself failed
+}
+
+// HealthzResponse is the /healthz response
+type HealthzResponse struct {
+	Status   string          `json:"status"` // ok or failing
+	Database IntegrityReport `json:"database"`
+}
+
+var (
+	// lastIntegrity is the latest integrity check, served by /healthz
+	lastIntegrity   IntegrityReport
+	lastIntegrityMu sync.RWMutex
+)
+
+// loadIntegrityCheckInterval reads INTEGRITY_CHECK_INTERVAL (a Go duration such as 6h)
+func loadIntegrityCheckInterval() (time.Duration, error) {
+	value := os.Getenv("INTEGRITY_CHECK_INTERVAL")
+	if value == "" {
+		return defaultIntegrityCheckInterval, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// checkDatabase runs the integrity and foreign key checks on a database
+func checkDatabase(conn *sql.DB, now time.Time) (IntegrityReport, error) {
+	report := IntegrityReport{CheckedAt: now, Problems: []string{}, ForeignKeyViolations: []ForeignKeyViolation{}}
+
+	rows, err := conn.Query(fmt.Sprintf(`PRAGMA integrity_check(%d)`, maxIntegrityProblems))
+	if err != nil {
+		return report, err
+	}
+	for rows.Next() {
+		var msg string
+		if err := rows.Scan(&msg); err != nil {
+			rows.Close()
+			return report, err
+		}
+		if msg != "ok" {
+			report.Problems = append(report.Problems, msg)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	rows, err = conn.Query(`PRAGMA foreign_key_check`)
+	if err != nil {
+		return report, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var v ForeignKeyViolation
+		var rowID sql.NullInt64
+		var fkID int
+		if err := rows.Scan(&v.Table, &rowID, &v.Parent, &fkID); err != nil {
+			return report, err
+		}
+		v.RowID = rowID.Int64
+		report.ForeignKeyViolations = append(report.ForeignKeyViolations, v)
+	}
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	report.OK = len(report.Problems) == 0 && len(report.ForeignKeyViolations) == 0
+	return report, nil
+}
+
+// corrupt reports whether the check found the database file damaged, as
+// opposed to rows with missing parents only
+func (r IntegrityReport) corrupt() bool {
+	return r.Error != "" || len(r.Problems) > 0
+}
+
+// summary describes a failed check for logs and alerts
+func (r IntegrityReport) summary() string {
+	if r.Error != "" {
+		return "the integrity check failed: " + r.Error
+	}
+	var parts []string
+	if len(r.Problems) > 0 {
+		parts = append(parts, fmt.Sprintf("%d integrity problem(s), first: %s", len(r.Problems), r.Problems[0]))
+	}
+	if len(r.ForeignKeyViolations) > 0 {
+		v := r.ForeignKeyViolations[0]
+		parts = append(parts, fmt.Sprintf("%d foreign key violation(s), first: %s row %d refers to a missing %s",
+			len(r.ForeignKeyViolations), v.Table, v.RowID, v.Parent))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// runIntegrityCheck checks the database, keeps the result for /healthz and
+// alerts if it failed
+func runIntegrityCheck(now time.Time) IntegrityReport {
+	report, err := checkDatabase(db, now)
+	if err != nil {
+		report.Error = err.Error()
+		report.OK = false
+	}
+
+	lastIntegrityMu.Lock()
+	lastIntegrity = report
+	lastIntegrityMu.Unlock()
+
+	if !report.OK {
+		msg := "Database integrity check failed: " + report.summary()
+		log.Println(msg)
+		recordAudit("database.integrity_failed", "integrity-check", report.summary())
+		sendAlert(msg)
+	}
+	return report
+}
+
+// startIntegrityMonitor periodically checks the database
+func startIntegrityMonitor(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		runIntegrityCheck(now)
+	}
+}
+
+// backupHealthy reports whether a database file passes the integrity check
+func backupHealthy(path string) bool {
+	conn, err := sql.Open("sqlite", path)
+	if err != nil {
+		return false
+	}
+	defer conn.Close()
+
+	report, err := checkDatabase(conn, time.Now())
+	return err == nil && !report.corrupt()
+}
+
+// copyFile copies src to dst, replacing dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+// restoreLatestBackup moves the database at dbPath aside and replaces it with
+// the newest healthy *.db backup in dir, returning the backup's path. The
+// database must be closed.
+func restoreLatestBackup(dbPath, dir string, now time.Time) (string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+
+	type backup struct {
+		path    string
+		modTime time.Time
+	}
+	var backups []backup
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".db" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			backups = append(backups, backup{filepath.Join(dir, e.Name()), info.ModTime()})
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool { return backups[i].modTime.After(backups[j].modTime) })
+
+	for _, b := range backups {
+		if !backupHealthy(b.path) {
+			log.Printf("Restore: skipping backup %s, it fails the integrity check", b.path)
+			continue
+		}
+
+		// Keep the corrupt database, with its WAL, for investigation
+		suffix := ".corrupt-" + now.Format("20060102-150405")
+		for _, path := range []string{dbPath, dbPath + "-wal", dbPath + "-shm"} {
+			if err := os.Rename(path, path+suffix); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+		}
+		return b.path, copyFile(b.path, dbPath)
+	}
+	return "", fmt.Errorf("no healthy backup in %s", dir)
+}
+
+// initCheckedDB initializes the database and checks it. A database that is
+// corrupt or cannot be opened is replaced by the newest healthy backup of
+// restoreDir, if set.
+func initCheckedDB(restoreDir string) error {
+	err := initDB()
+	if err == nil {
+		if !runIntegrityCheck(time.Now()).corrupt() || restoreDir == "" {
+			return nil
+		}
+	} else if restoreDir == "" {
+		return err
+	} else {
+		log.Printf("Could not initialize database: %v", err)
+	}
+
+	if db != nil {
+		db.Close()
+	}
+	backup, err := restoreLatestBackup(databaseFilePath, restoreDir, time.Now())
+	if err != nil {
+		return fmt.Errorf("restoring a backup failed: %w", err)
+	}
+	if err := initDB(); err != nil {
+		return err
+	}
+
+	msg := "Database restored from backup " + backup + ", changes since the backup are lost"
+	log.Println(msg)
+	recordAudit("database.restored", "integrity-check", backup)
+	sendAlert(msg)
+	runIntegrityCheck(time.Now())
+	return nil
+}
+
+// handleHealthz reports the latest database integrity check, with 503 while it fails
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	lastIntegrityMu.RLock()
+	report := lastIntegrity
+	lastIntegrityMu.RUnlock()
+
+	resp := HealthzResponse{Status: "ok", Database: report}
+	w.Header().Set("Content-Type", "application/json")
+	if !report.CheckedAt.IsZero() && !report.OK {
+		resp.Status = "failing"
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Database Integrity Tests
+// ============================================================================
+
+// resetIntegrity forgets the latest integrity check after a test
+func resetIntegrity(t *testing.T) {
+	t.Helper()
+	t.Cleanup(func() {
+		lastIntegrityMu.Lock()
+		lastIntegrity = IntegrityReport{}
+		lastIntegrityMu.Unlock()
+	})
+}
+
+// healthz calls /healthz and returns the response
+func healthz(t *testing.T) (*httptest.ResponseRecorder, HealthzResponse) {
+	t.Helper()
+
+	rr := httptest.NewRecorder()
+	handleHealthz(rr, httptest.NewRequest("GET", "/healthz", nil))
+	var resp HealthzResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("invalid response %s: %v", rr.Body.String(), err)
+	}
+	return rr, resp
+}
+
+func TestRunIntegrityCheck_Healthy(t *testing.T) {
+	setupTest()
+	resetIntegrity(t)
+
+	if report := runIntegrityCheck(time.Now()); !report.OK {
+		t.Fatalf("expected a healthy database, got %+v", report)
+	}
+	if rr, resp := healthz(t); rr.Code != http.StatusOK || resp.Status != "ok" || resp.Database.CheckedAt.IsZero() {
+		t.Errorf("expected 200 ok, got %v %+v", rr.Code, resp)
+	}
+}
+
+func TestRunIntegrityCheck_ForeignKeyViolation(t *testing.T) {
+	setupTest()
+	resetIntegrity(t)
+
+	// A row left behind by an interrupted write, with foreign keys off
+	db.Exec(`PRAGMA foreign_keys = OFF`)
+	db.Exec(`INSERT INTO session_allocations (visit_id, project_id, seconds) VALUES (999, 999, 60)`)
+	db.Exec(`PRAGMA foreign_keys = ON`)
+
+	report := runIntegrityCheck(time.Now())
+	if report.OK || report.corrupt() || len(report.ForeignKeyViolations) == 0 {
+		t.Fatalf("expected foreign key violations only, got %+v", report)
+	}
+	if v := report.ForeignKeyViolations[0]; v.Table != "session_allocations" {
+		t.Errorf("unexpected violation: %+v", v)
+	}
+
+	if rr, resp := healthz(t); rr.Code != http.StatusServiceUnavailable || resp.Status != "failing" {
+		t.Errorf("expected 503 failing, got %v %+v", rr.Code, resp)
+	}
+	if entries, _ := loadAuditEntries("database.integrity_failed", 10); len(entries) != 1 {
+		t.Errorf("expected an audit entry, got %d", len(entries))
+	}
+}
+
+func TestHealthz_NotCheckedYet(t *testing.T) {
+	resetIntegrity(t)
+
+	if rr, resp := healthz(t); rr.Code != http.StatusOK || resp.Status != "ok" {
+		t.Errorf("expected 200 ok before the first check, got %v %+v", rr.Code, resp)
+	}
+}
+
+func TestLoadIntegrityCheckInterval(t *testing.T) {
+	t.Setenv("INTEGRITY_CHECK_INTERVAL", "")
+	if d, err := loadIntegrityCheckInterval(); err != nil || d != defaultIntegrityCheckInterval {
+		t.Errorf("expected the default, got %v (err %v)", d, err)
+	}
+	t.Setenv("INTEGRITY_CHECK_INTERVAL", "6h")
+	if d, err := loadIntegrityCheckInterval(); err != nil || d != 6*time.Hour {
+		t.Errorf("expected 6h, got %v (err %v)", d, err)
+	}
+	t.Setenv("INTEGRITY_CHECK_INTERVAL", "-1h")
+	if _, err := loadIntegrityCheckInterval(); err == nil {
+		t.Error("expected an error for a negative interval")
+	}
+}
+
+func TestRestoreLatestBackup(t *testing.T) {
+	setupTest()
+	dir := t.TempDir()
+	backups := filepath.Join(dir, "backups")
+	os.Mkdir(backups, 0755)
+
+	// A healthy backup, and a newer one that is not a database at all
+	healthy := filepath.Join(backups, "monday.db")
+	if _, err := db.Exec(`VACUUM INTO ?`, healthy); err != nil {
+		t.Fatalf("failed to write backup: %v", err)
+	}
+	broken := filepath.Join(backups, "tuesday.db")
+	os.WriteFile(broken, []byte("not a database"), 0644)
+	os.Chtimes(healthy, time.Now().Add(-time.Hour), time.Now().Add(-time.Hour))
+
+	dbPath := filepath.Join(dir, "attendance.db")
+	os.WriteFile(dbPath, []byte("corrupted by a power cut"), 0644)
+
+	now := time.Now()
+	restored, err := restoreLatestBackup(dbPath, backups, now)
+	if err != nil || restored != healthy {
+		t.Fatalf("expected %s restored, got %q (err %v)", healthy, restored, err)
+	}
+
+	conn, _ := sql.Open("sqlite", dbPath)
+	defer conn.Close()
+	var members int
+	if err := conn.QueryRow(`SELECT COUNT(*) FROM members`).Scan(&members); err != nil || members != 2 {
+		t.Errorf("expected the restored database to hold 2 members, got %d (err %v)", members, err)
+	}
+	if _, err := os.Stat(dbPath + ".corrupt-" + now.Format("20060102-150405")); err != nil {
+		t.Errorf("expected the corrupt database kept aside: %v", err)
+	}
+
+	if _, err := restoreLatestBackup(dbPath, t.TempDir(), now); err == nil {
+		t.Error("expected an error without any backup")
+	}
+}
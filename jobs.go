@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// --- Background Jobs ---
+//
+// Slow or network-bound side effects (webhook posts, writing the current
+// attendees file) run on a small worker pool so request handlers such as
+// /scan return immediately. A failed job is retried with exponential backoff
+// (jobRetryBase doubling, up to maxJobAttempts attempts). Jobs that still
+// fail, or that do not fit in the queue, are dead-lettered: logged, counted
+// in jobs_dead_letter_total and written to the audit log as job.dead_letter.
+
+const (
+	jobWorkers     = 4
+	jobQueueSize   = 1024
+	maxJobAttempts = 5
+)
+
+// jobRetryBase is the delay before the first retry of a failed job
+var jobRetryBase = 2 * time.Second
+
+// job is a unit of background work
+type job struct {
+	name     string
+	run      func() error
+	attempts int
+}
+
+// workerPool runs submitted jobs on a fixed number of goroutines
+type workerPool struct {
+	queue chan *job
+
+	// Jobs submitted but not yet finished (including pending retries), for wait
+	pendingMu sync.Mutex
+	pending   int
+	idle      *sync.Cond
+}
+
+// newWorkerPool starts a pool of workers reading from a queue of the given size
+func newWorkerPool(workers, queueSize int) *workerPool {
+	p := &workerPool{queue: make(chan *job, queueSize)}
+	p.idle = sync.NewCond(&p.pendingMu)
+	for i := 0; i < workers; i++ {
+		go p.work()
+	}
+	return p
+}
+
+// jobs is the application's background worker pool
+var jobs = newWorkerPool(jobWorkers, jobQueueSize)
+
+// submit queues a job without blocking. A job that does not fit in the queue is dead-lettered.
+func (p *workerPool) submit(name string, run func() error) {
+	p.pendingMu.Lock()
+	p.pending++
+	p.pendingMu.Unlock()
+
+	p.enqueue(&job{name: name, run: run})
+}
+
+// enqueue puts a job on the queue, dead-lettering it if the queue is full
+func (p *workerPool) enqueue(j *job) {
+	select {
+	case p.queue <- j:
+	default:
+		p.deadLetter(j, fmt.Errorf("job queue full"))
+	}
+}
+
+// work runs queued jobs, scheduling retries of failed ones
+func (p *workerPool) work() {
+	for j := range p.queue {
+		j.attempts++
+		_, span := startSpan(context.Background(), "job "+j.name, spanKindInternal)
+		span.setAttr("job.attempt", j.attempts)
+		err := j.run()
+		span.finish(err)
+		if err == nil {
+			logJobs.debugf("Job %s succeeded (attempt %d)", j.name, j.attempts)
+			p.done()
+			continue
+		}
+
+		if j.attempts >= maxJobAttempts {
+			p.deadLetter(j, err)
+			continue
+		}
+		delay := jobRetryBase << (j.attempts - 1)
+		logJobs.warnf("Job %s failed (attempt %d/%d), retrying in %s: %v", j.name, j.attempts, maxJobAttempts, delay, err)
+		time.AfterFunc(delay, func() { p.enqueue(j) })
+	}
+}
+
+// deadLetter gives up on a job
+func (p *workerPool) deadLetter(j *job, err error) {
+	msg := fmt.Sprintf("job %s failed after %d attempt(s): %v", j.name, j.attempts, err)
+	logJobs.errorf("Dead letter: %s", msg)
+	incCounter("jobs_dead_letter_total")
+	recordAudit("job.dead_letter", j.name, msg)
+	p.done()
+}
+
+// done marks one submitted job as finished
+func (p *workerPool) done() {
+	p.pendingMu.Lock()
+	p.pending--
+	if p.pending == 0 {
+		p.idle.Broadcast()
+	}
+	p.pendingMu.Unlock()
+}
+
+// wait blocks until every submitted job has succeeded or been dead-lettered
+func (p *workerPool) wait() {
+	p.pendingMu.Lock()
+	for p.pending > 0 {
+		p.idle.Wait()
+	}
+	p.pendingMu.Unlock()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Background Job Tests
+// ============================================================================
+
+// fastRetries shortens the retry backoff for the duration of a test
+func fastRetries(t *testing.T) {
+	t.Helper()
+
+	saved := jobRetryBase
+	jobRetryBase = time.Millisecond
+	t.Cleanup(func() { jobRetryBase = saved })
+}
+
+func TestWorkerPool_RetriesUntilSuccess(t *testing.T) {
+	setupTest()
+	fastRetries(t)
+
+	var calls int32
+	jobs.submit("flaky", func() error {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			return errors.New("temporarily down")
+		}
+		return nil
+	})
+	jobs.wait()
+
+	if calls != 3 {
+		t.Errorf("expected 3 attempts, got %d", calls)
+	}
+	if entries, _ := loadAuditEntries("job.dead_letter", 10); len(entries) != 0 {
+		t.Errorf("expected no dead letters, got %+v", entries)
+	}
+}
+
+func TestWorkerPool_DeadLettersAfterMaxAttempts(t *testing.T) {
+	setupTest()
+	fastRetries(t)
+
+	var calls int32
+	jobs.submit("broken", func() error {
+		atomic.AddInt32(&calls, 1)
+		return errors.New("always down")
+	})
+	jobs.wait()
+
+	if calls != maxJobAttempts {
+		t.Errorf("expected %d attempts, got %d", maxJobAttempts, calls)
+	}
+	entries, _ := loadAuditEntries("job.dead_letter", 10)
+	if len(entries) != 1 || entries[0].Actor != "broken" {
+		t.Errorf("expected one dead letter for the broken job, got %+v", entries)
+	}
+}
+
+func TestWorkerPool_FullQueueDeadLetters(t *testing.T) {
+	setupTest()
+
+	pool := newWorkerPool(1, 1)
+	started := make(chan struct{})
+	release := make(chan struct{})
+	pool.submit("blocking", func() error { close(started); <-release; return nil })
+	<-started
+	pool.submit("queued", func() error { return nil })
+	pool.submit("overflow", func() error { return nil })
+	close(release)
+	pool.wait()
+
+	entries, _ := loadAuditEntries("job.dead_letter", 10)
+	if len(entries) != 1 || entries[0].Actor != "overflow" {
+		t.Errorf("expected the overflowing job to be dead-lettered, got %+v", entries)
+	}
+}
+
+func TestPostWebhook_RetriesFailedDelivery(t *testing.T) {
+	setupTest()
+	fastRetries(t)
+
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	postWebhook(server.URL, "hello")
+	jobs.wait()
+
+	if calls != 2 {
+		t.Errorf("expected the webhook to be retried once, got %d calls", calls)
+	}
+}
+
+func TestPerformSignIn_SavesAttendeesInBackground(t *testing.T) {
+	setupTest()
+	os.Remove(currentAttendeesFilePath)
+
+	if _, err := performSignIn(context.Background(), cachedMember("TEST_UID_1"), ""); err != nil {
+		t.Fatalf("sign-in failed: %v", err)
+	}
+	jobs.wait()
+
+	if _, err := os.Stat(currentAttendeesFilePath); err != nil {
+		t.Errorf("expected the current attendees file to be written: %v", err)
+	}
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Kiosk Tokens ---
+//
+// Kiosk tokens let display devices, such as the office wall screen, read a
+// few endpoints without holding an API key. They are passed as ?kiosk_token=
+// (a web page cannot set headers on an EventSource), are read-only, have the
+// public or member scope, and only work on the endpoints they were issued for,
+// which must be among scopedReadRoutes. They do not expire and are revoked
+// with DELETE /admin/kiosk-tokens/{id}. Only a SHA-256 hash of each token is
+// stored, so a token is shown once, when it is issued.
+
+// kioskTokenParam is the query parameter carrying a kiosk token
+const kioskTokenParam = "kiosk_token"
+
+// kioskTokenTouchInterval limits how often a token's last use is saved
+const kioskTokenTouchInterval = time.Minute
+
+// KioskToken is an issued kiosk token
+type KioskToken struct {
+	ID         int64      `json:"id"`
+	Name       string     `json:"name"`
+	Scope      string     `json:"scope"`
+	Endpoints  []string   `json:"endpoints"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Token      string     `json:"token,omitempty"` // Only returned when issued
+}
+
+// CreateKioskTokenRequest is the payload to issue a kiosk token
+type CreateKioskTokenRequest struct {
+	Name      string   `json:"name"`
+	Scope     string   `json:"scope,omitempty"`     // public (default) or member
+	Endpoints []string `json:"endpoints,omitempty"` // Defaults to every endpoint readable with a scope
+}
+
+// kioskTokenColumns is the column list scanned by scanKioskToken
+const kioskTokenColumns = `id, name, scope, endpoints, created_at, last_used_at`
+
+// scanKioskToken reads a kiosk token row selected with kioskTokenColumns
+func scanKioskToken(row rowScanner) (KioskToken, error) {
+	var k KioskToken
+	var endpoints, createdAt string
+	var lastUsedAt sql.NullString
+	if err := row.Scan(&k.ID, &k.Name, &k.Scope, &endpoints, &createdAt, &lastUsedAt); err != nil {
+		return KioskToken{}, err
+	}
+
+	var err error
+	if k.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return KioskToken{}, err
+	}
+	if lastUsedAt.Valid {
+		t, err := time.Parse(time.RFC3339, lastUsedAt.String)
+		if err != nil {
+			return KioskToken{}, err
+		}
+		k.LastUsedAt = &t
+	}
+	k.Endpoints = strings.Split(endpoints, ",")
+	return k, nil
+}
+
+// loadKioskToken fetches a single kiosk token by ID
+func loadKioskToken(id int64) (KioskToken, error) {
+	return scanKioskToken(db.QueryRow(`SELECT `+kioskTokenColumns+` FROM kiosk_tokens WHERE id = ?`, id))
+}
+
+// loadKioskTokens returns all kiosk tokens ordered by ID
+func loadKioskTokens() ([]KioskToken, error) {
+	rows, err := db.Query(`SELECT ` + kioskTokenColumns + ` FROM kiosk_tokens ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tokens := []KioskToken{}
+	for rows.Next() {
+		k, err := scanKioskToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, k)
+	}
+	return tokens, rows.Err()
+}
+
+// hashKioskToken returns the stored form of a kiosk token
+func hashKioskToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// findKioskToken looks a presented token up, returning sql.ErrNoRows if it was never issued or was revoked
+func findKioskToken(token string) (KioskToken, error) {
+	return scanKioskToken(db.QueryRow(`SELECT `+kioskTokenColumns+` FROM kiosk_tokens WHERE token_hash = ?`, hashKioskToken(token)))
+}
+
+// allows reports whether the token may make this request
+func (k KioskToken) allows(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, endpoint := range k.Endpoints {
+		if endpoint == r.URL.Path {
+			return true
+		}
+	}
+	return false
+}
+
+// touch records that the token was used, at most once per kioskTokenTouchInterval
+func (k KioskToken) touch(now time.Time) {
+	if k.LastUsedAt != nil && now.Sub(*k.LastUsedAt) < kioskTokenTouchInterval {
+		return
+	}
+	if _, err := db.Exec(`UPDATE kiosk_tokens SET last_used_at = ? WHERE id = ?`, now.Format(time.RFC3339), k.ID); err != nil {
+		log.Printf("Error saving kiosk token use: %v", err)
+	}
+}
+
+// authenticateKioskToken checks the kiosk token of a request, writing an
+// error response and returning false if it is invalid or does not allow the
+// request, and returns the token's scope otherwise
+func authenticateKioskToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	ip := clientIP(r)
+	k, err := findKioskToken(r.URL.Query().Get(kioskTokenParam))
+	if err == sql.ErrNoRows {
+		writeAuthFailure(w, ip, "invalid kiosk token")
+		return "", false
+	} else if err != nil {
+		log.Printf("Error querying kiosk token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return "", false
+	}
+
+	clearAuthFailures(ip)
+	if !k.allows(r) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]string{
+			"error": "kiosk token does not allow this endpoint",
+		})
+		return "", false
+	}
+
+	k.touch(time.Now())
+	return k.Scope, true
+}
+
+// newKioskToken returns a random kiosk token
+func newKioskToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "kiosk_" + hex.EncodeToString(b), nil
+}
+
+// kioskEndpoints validates the endpoints requested for a token, defaulting to
+// every endpoint readable with a scope
+func kioskEndpoints(requested []string) ([]string, error) {
+	if len(requested) == 0 {
+		for endpoint := range scopedReadRoutes {
+			requested = append(requested, endpoint)
+		}
+	}
+
+	seen := make(map[string]bool)
+	var endpoints []string
+	for _, endpoint := range requested {
+		endpoint = strings.TrimSpace(endpoint)
+		if !scopedReadRoutes[endpoint] {
+			return nil, fmt.Errorf("endpoint %q cannot be read with a kiosk token", endpoint)
+		}
+		if !seen[endpoint] {
+			seen[endpoint] = true
+			endpoints = append(endpoints, endpoint)
+		}
+	}
+	sort.Strings(endpoints)
+	return endpoints, nil
+}
+
+// handleKioskTokens supports GET to list kiosk tokens and POST to issue one
+func handleKioskTokens(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		tokens, err := loadKioskTokens()
+		if err != nil {
+			log.Printf("Error querying kiosk tokens: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(tokens)
+
+	case http.MethodPost:
+		var req CreateKioskTokenRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Name = strings.TrimSpace(req.Name)
+		if req.Name == "" {
+			http.Error(w, "name is required", http.StatusBadRequest)
+			return
+		}
+		req.Scope = strings.ToLower(strings.TrimSpace(req.Scope))
+		if req.Scope == "" {
+			req.Scope = scopePublic
+		}
+		if req.Scope != scopePublic && req.Scope != scopeMember {
+			http.Error(w, "Invalid 'scope', expected public or member", http.StatusBadRequest)
+			return
+		}
+		endpoints, err := kioskEndpoints(req.Endpoints)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		token, err := newKioskToken()
+		if err != nil {
+			log.Printf("Error generating kiosk token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		res, err := db.Exec(`INSERT INTO kiosk_tokens (name, token_hash, scope, endpoints, created_at) VALUES (?, ?, ?, ?, ?)`,
+			req.Name, hashKioskToken(token), req.Scope, strings.Join(endpoints, ","), time.Now().Format(time.RFC3339))
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Kiosk token name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error inserting kiosk token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		id, _ := res.LastInsertId()
+		issued, err := loadKioskToken(id)
+		if err != nil {
+			log.Printf("Error loading issued kiosk token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		issued.Token = token
+		recordAudit("kiosk_token.issued", clientIP(r), fmt.Sprintf("token=%d name=%s scope=%s endpoints=%s",
+			issued.ID, issued.Name, issued.Scope, strings.Join(issued.Endpoints, ",")))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(issued)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleKioskToken handles /admin/kiosk-tokens/{id}: GET and DELETE (revoke)
+func handleKioskToken(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/admin/kiosk-tokens/")
+	if !ok {
+		http.Error(w, "Invalid kiosk token ID", http.StatusBadRequest)
+		return
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		k, err := loadKioskToken(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Kiosk token not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying kiosk token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k)
+
+	case http.MethodDelete:
+		k, err := loadKioskToken(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Kiosk token not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying kiosk token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if _, err := db.Exec(`DELETE FROM kiosk_tokens WHERE id = ?`, id); err != nil {
+			log.Printf("Error deleting kiosk token: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("kiosk_token.revoked", clientIP(r), fmt.Sprintf("token=%d name=%s", k.ID, k.Name))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Kiosk token revoked successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+	}
+}
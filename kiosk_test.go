@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /admin/kiosk-tokens Endpoint Tests
+// ============================================================================
+
+// issueKioskToken issues a kiosk token from a JSON body and returns it
+func issueKioskToken(t *testing.T, body string) KioskToken {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/admin/kiosk-tokens", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleKioskTokens(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var k KioskToken
+	if err := json.Unmarshal(rr.Body.Bytes(), &k); err != nil {
+		t.Fatalf("failed to parse kiosk token: %v", err)
+	}
+	return k
+}
+
+// kioskRequest calls a path through apiKeyMiddleware, returning the response
+// and the scope the handler saw
+func kioskRequest(method, path string) (*httptest.ResponseRecorder, string) {
+	var scope string
+	handler := apiKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		scope = requestScope(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest(method, path, nil)
+	req.RemoteAddr = "198.51.100.7:1234"
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr, scope
+}
+
+func TestHandleKioskTokens_Issue(t *testing.T) {
+	setupTest()
+
+	k := issueKioskToken(t, `{"name":"wall display","endpoints":["/count","/status/stream","/count"]}`)
+	if k.Token == "" || k.Scope != scopePublic {
+		t.Errorf("expected a public token, got %+v", k)
+	}
+	if len(k.Endpoints) != 2 || k.Endpoints[0] != "/count" || k.Endpoints[1] != "/status/stream" {
+		t.Errorf("expected /count and /status/stream, got %v", k.Endpoints)
+	}
+
+	// Only the hash is stored, and listings never show the token
+	var stored string
+	db.QueryRow(`SELECT token_hash FROM kiosk_tokens WHERE id = ?`, k.ID).Scan(&stored)
+	if stored == k.Token || stored != hashKioskToken(k.Token) {
+		t.Errorf("expected the token to be stored hashed, got %q", stored)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/kiosk-tokens", nil)
+	rr := httptest.NewRecorder()
+	handleKioskTokens(rr, req)
+	var tokens []KioskToken
+	json.Unmarshal(rr.Body.Bytes(), &tokens)
+	if len(tokens) != 1 || tokens[0].Token != "" {
+		t.Errorf("expected one token listed without its secret, got %+v", tokens)
+	}
+
+	entries, _ := loadAuditEntries("kiosk_token.issued", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 kiosk_token.issued audit entry, got %d", len(entries))
+	}
+}
+
+func TestHandleKioskTokens_DefaultEndpoints(t *testing.T) {
+	setupTest()
+
+	k := issueKioskToken(t, `{"name":"dashboard","scope":"member"}`)
+	if k.Scope != scopeMember || len(k.Endpoints) != len(scopedReadRoutes) {
+		t.Errorf("expected a member token for every scoped endpoint, got %+v", k)
+	}
+}
+
+func TestHandleKioskTokens_Invalid(t *testing.T) {
+	setupTest()
+
+	tests := []struct {
+		body     string
+		expected int
+	}{
+		{`{"name":""}`, http.StatusBadRequest},
+		{`{"name":"screen","scope":"admin"}`, http.StatusBadRequest},
+		{`{"name":"screen","endpoints":["/members"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/admin/kiosk-tokens", bytes.NewBufferString(tt.body))
+		rr := httptest.NewRecorder()
+		handleKioskTokens(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.body, tt.expected, rr.Code)
+		}
+	}
+
+	issueKioskToken(t, `{"name":"screen"}`)
+	req, _ := http.NewRequest("POST", "/admin/kiosk-tokens", bytes.NewBufferString(`{"name":"screen"}`))
+	rr := httptest.NewRecorder()
+	handleKioskTokens(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate name, got %v", rr.Code)
+	}
+}
+
+// ============================================================================
+// Kiosk Token Authentication Tests
+// ============================================================================
+
+func TestAPIKeyMiddleware_KioskToken(t *testing.T) {
+	setupTest()
+	validAPIKeys = map[string]bool{"admin-key": true}
+
+	k := issueKioskToken(t, `{"name":"wall display","endpoints":["/count"]}`)
+
+	rr, scope := kioskRequest("GET", "/count?kiosk_token="+k.Token)
+	if rr.Code != http.StatusOK || scope != scopePublic {
+		t.Errorf("expected 200 with public scope, got %v %q", rr.Code, scope)
+	}
+
+	loaded, _ := loadKioskToken(k.ID)
+	if loaded.LastUsedAt == nil || time.Since(*loaded.LastUsedAt) > time.Minute {
+		t.Errorf("expected the token's last use to be recorded, got %v", loaded.LastUsedAt)
+	}
+
+	// Other endpoints and writes are refused
+	if rr, _ := kioskRequest("GET", "/current?kiosk_token="+k.Token); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an endpoint not issued, got %v", rr.Code)
+	}
+	if rr, _ := kioskRequest("POST", "/count?kiosk_token="+k.Token); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a write, got %v", rr.Code)
+	}
+}
+
+func TestAPIKeyMiddleware_InvalidKioskToken(t *testing.T) {
+	setupTest()
+	validAPIKeys = map[string]bool{"admin-key": true}
+
+	if rr, _ := kioskRequest("GET", "/count?kiosk_token=kiosk_nope"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown token, got %v", rr.Code)
+	}
+	authFailuresMu.Lock()
+	f := authFailures["198.51.100.7"]
+	authFailuresMu.Unlock()
+	if f == nil || f.Count != 1 {
+		t.Errorf("expected the failure to count towards the lockout, got %+v", f)
+	}
+}
+
+func TestHandleKioskToken_Revoke(t *testing.T) {
+	setupTest()
+	validAPIKeys = map[string]bool{"admin-key": true}
+
+	k := issueKioskToken(t, `{"name":"wall display"}`)
+
+	req, _ := http.NewRequest("DELETE", "/admin/kiosk-tokens/1", nil)
+	rr := httptest.NewRecorder()
+	handleKioskToken(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	if rr, _ := kioskRequest("GET", "/count?kiosk_token="+k.Token); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected a revoked token to be refused, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/admin/kiosk-tokens/1", nil)
+	rr = httptest.NewRecorder()
+	handleKioskToken(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after revoking, got %v", rr.Code)
+	}
+}
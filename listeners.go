@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// --- Listeners ---
+//
+// LISTEN_ADDR lists the addresses the API is served on, separated by commas
+// (default :8080). Each is a TCP address such as 127.0.0.1:8080 or :8080, or
+// a Unix socket such as unix:/run/ieee-office/api.sock for a reverse proxy
+// on the same host. An address prefixed with readonly= only serves reads
+// (GET, HEAD and OPTIONS) outside /admin/ and /metrics, for a public port
+// next to an internal one serving everything:
+//
+//	LISTEN_ADDR=readonly=:8080,127.0.0.1:9090
+//
+// Under systemd socket activation the activated sockets replace LISTEN_ADDR;
+// the one named readonly is read-only (see systemd.go).
+
+const (
+	defaultListenAddr = ":8080"
+
+	listenAll      = "all"
+	listenReadOnly = "readonly"
+)
+
+// readOnlyHiddenPrefixes are not served on read-only listeners at all
+var readOnlyHiddenPrefixes = []string{"/admin/", "/metrics"}
+
+// listenerConfig is one address of LISTEN_ADDR
+type listenerConfig struct {
+	Mode    string // all or readonly
+	Network string // tcp or unix
+	Address string
+}
+
+func (l listenerConfig) String() string {
+	addr := l.Address
+	if l.Network == "unix" {
+		addr = "unix:" + addr
+	}
+	if l.Mode == listenReadOnly {
+		return listenReadOnly + "=" + addr
+	}
+	return addr
+}
+
+// parseListenAddrs parses a LISTEN_ADDR value
+func parseListenAddrs(value string) ([]listenerConfig, error) {
+	var configs []listenerConfig
+	seen := make(map[string]bool)
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		l := listenerConfig{Mode: listenAll, Network: "tcp", Address: entry}
+		if mode, addr, ok := strings.Cut(entry, "="); ok {
+			if mode != listenAll && mode != listenReadOnly {
+				return nil, fmt.Errorf("invalid mode %q in %q, expected readonly or all", mode, entry)
+			}
+			l.Mode, l.Address = mode, addr
+		}
+		if path, ok := strings.CutPrefix(l.Address, "unix:"); ok {
+			if path == "" {
+				return nil, fmt.Errorf("%q is missing the socket path", entry)
+			}
+			l.Network, l.Address = "unix", path
+		} else if _, port, err := net.SplitHostPort(l.Address); err != nil || port == "" {
+			return nil, fmt.Errorf("invalid address %q, expected host:port, :port or unix:/path", l.Address)
+		}
+
+		if seen[l.Network+" "+l.Address] {
+			return nil, fmt.Errorf("address %q is listed twice", l.Address)
+		}
+		seen[l.Network+" "+l.Address] = true
+		configs = append(configs, l)
+	}
+	if len(configs) == 0 {
+		configs = append(configs, listenerConfig{Mode: listenAll, Network: "tcp", Address: defaultListenAddr})
+	}
+	return configs, nil
+}
+
+// loadListenAddrs reads LISTEN_ADDR
+func loadListenAddrs() ([]listenerConfig, error) {
+	return parseListenAddrs(os.Getenv("LISTEN_ADDR"))
+}
+
+// listen opens the listener. A socket file left by a previous run is
+// replaced; new sockets are readable and writable by the owner and group.
+func (l listenerConfig) listen() (net.Listener, error) {
+	if l.Network != "unix" {
+		return net.Listen(l.Network, l.Address)
+	}
+
+	if info, err := os.Lstat(l.Address); err == nil {
+		if info.Mode().Type() != fs.ModeSocket {
+			return nil, fmt.Errorf("%s exists and is not a socket", l.Address)
+		}
+		if err := os.Remove(l.Address); err != nil {
+			return nil, err
+		}
+	}
+	ln, err := net.Listen("unix", l.Address)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(l.Address, 0o660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// handler restricts a read-only listener to reads outside the hidden paths
+func (l listenerConfig) handler(next http.Handler) http.Handler {
+	if l.Mode != listenReadOnly {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range readOnlyHiddenPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				http.NotFound(w, r)
+				return
+			}
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+		default:
+			methodNotAllowed(w, http.MethodGet, http.MethodHead, http.MethodOptions)
+		}
+	})
+}
+
+// apiListener is an open listener of the API
+type apiListener struct {
+	config   listenerConfig
+	listener net.Listener
+}
+
+// openListeners opens the LISTEN_ADDR listeners, or takes the sockets passed
+// by systemd instead. Listeners already open are closed on error.
+func openListeners(configs []listenerConfig, activated []activatedListener) ([]apiListener, error) {
+	var open []apiListener
+	for _, a := range activated {
+		if a.name == sdMTLSSocketName {
+			continue
+		}
+		mode := listenAll
+		if a.name == listenReadOnly {
+			mode = listenReadOnly
+		}
+		addr := a.listener.Addr()
+		open = append(open, apiListener{listenerConfig{Mode: mode, Network: addr.Network(), Address: addr.String()}, a.listener})
+	}
+	if len(open) > 0 {
+		return open, nil
+	}
+
+	for _, config := range configs {
+		ln, err := config.listen()
+		if err != nil {
+			for _, o := range open {
+				o.listener.Close()
+			}
+			return nil, fmt.Errorf("listening on %s: %w", config, err)
+		}
+		open = append(open, apiListener{config, ln})
+	}
+	return open, nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// Listener Tests
+// ============================================================================
+
+func TestParseListenAddrs(t *testing.T) {
+	configs, err := parseListenAddrs("")
+	if err != nil || len(configs) != 1 || configs[0].String() != ":8080" {
+		t.Errorf("expected :8080 by default, got %v (err %v)", configs, err)
+	}
+
+	configs, err = parseListenAddrs("readonly=:8080, 127.0.0.1:9090,unix:/run/office/api.sock")
+	if err != nil || len(configs) != 3 {
+		t.Fatalf("unexpected listeners %v (err %v)", configs, err)
+	}
+	if configs[0].Mode != listenReadOnly || configs[0].Address != ":8080" {
+		t.Errorf("expected a read-only :8080, got %+v", configs[0])
+	}
+	if configs[1].Mode != listenAll || configs[1].Network != "tcp" {
+		t.Errorf("expected a full 127.0.0.1:9090, got %+v", configs[1])
+	}
+	if configs[2].Network != "unix" || configs[2].Address != "/run/office/api.sock" || configs[2].String() != "unix:/run/office/api.sock" {
+		t.Errorf("expected a Unix socket, got %+v", configs[2])
+	}
+
+	for _, invalid := range []string{"8080", "admin=:9090", "unix:", ":8080,:8080", "localhost:"} {
+		if _, err := parseListenAddrs(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestListenerReadOnly(t *testing.T) {
+	setupTest()
+	handler := listenerConfig{Mode: listenReadOnly}.handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/current", http.StatusNoContent},
+		{"OPTIONS", "/count", http.StatusNoContent},
+		{"POST", "/scan", http.StatusMethodNotAllowed},
+		{"DELETE", "/visits", http.StatusMethodNotAllowed},
+		{"GET", "/admin/audit-log", http.StatusNotFound},
+		{"GET", "/metrics", http.StatusNotFound},
+	} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest(tc.method, tc.path, nil))
+		if rr.Code != tc.want {
+			t.Errorf("%s %s: expected %v, got %v", tc.method, tc.path, tc.want, rr.Code)
+		}
+	}
+}
+
+func TestListenUnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "api.sock")
+	config := listenerConfig{Mode: listenAll, Network: "unix", Address: path}
+
+	// A socket left by a previous run is replaced
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	ln, err := config.listen()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	defer ln.Close()
+	if info, err := os.Stat(path); err != nil || info.Mode().Perm() != 0o660 {
+		t.Errorf("expected the socket to be group writable, got %v (err %v)", info.Mode(), err)
+	}
+
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "ok")
+	}))
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	resp, err := client.Get("http://office/health")
+	if err != nil {
+		t.Fatalf("request over the socket failed: %v", err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "ok" {
+		t.Errorf("unexpected response %q", body)
+	}
+
+	// Other files are left alone
+	file := filepath.Join(t.TempDir(), "notes.txt")
+	os.WriteFile(file, []byte("keep"), 0o644)
+	if _, err := (listenerConfig{Network: "unix", Address: file}).listen(); err == nil || !strings.Contains(err.Error(), "not a socket") {
+		t.Errorf("expected a regular file to be refused, got %v", err)
+	}
+}
+
+func TestOpenListeners(t *testing.T) {
+	configs, _ := parseListenAddrs("readonly=127.0.0.1:0,127.0.0.2:0")
+	open, err := openListeners(configs, nil)
+	if err != nil || len(open) != 2 {
+		t.Fatalf("unexpected listeners %v (err %v)", open, err)
+	}
+	for _, l := range open {
+		l.listener.Close()
+	}
+
+	// Activated sockets replace LISTEN_ADDR, except the mTLS one
+	activated, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer activated.Close()
+	mtls, _ := net.Listen("tcp", "127.0.0.1:0")
+	defer mtls.Close()
+	open, err = openListeners(configs, []activatedListener{{"readonly", activated}, {sdMTLSSocketName, mtls}})
+	if err != nil || len(open) != 1 || open[0].config.Mode != listenReadOnly || open[0].listener != activated {
+		t.Errorf("expected the activated read-only socket only, got %+v (err %v)", open, err)
+	}
+}
@@ -0,0 +1,301 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// --- Live Statistics ---
+//
+// GET /stats/live answers from totals kept in memory instead of scanning the
+// visits table: today's and this week's person-hours, visitors and visits,
+// and the members with the longest current streaks. The totals are kept per
+// member and day of the report time zone (see reportLocation) for the last
+// liveStatsWindow, and updated by the sign_in and sign_out events. Open
+// sessions are added when the totals are read. Every
+// liveStatsReconcileInterval they are rebuilt from the database with the
+// corrected session times, which also picks up deleted and amended visits.
+//
+// A streak is the number of consecutive office days a member came in, where
+// office days are the days anyone of the organization came in, so weekends
+// and closures nobody came in on do not break it. A streak is still current
+// if the member has not come in yet today.
+
+const (
+	// liveStatsWindow is how far back totals are kept, and so the longest streak
+	liveStatsWindow = 180 * 24 * time.Hour
+
+	// liveStatsReconcileInterval is how often the totals are rebuilt from the database
+	liveStatsReconcileInterval = 10 * time.Minute
+
+	// defaultStreakLimit is how many streaks /stats/live returns by default
+	defaultStreakLimit = 10
+)
+
+// LiveTotals is the attendance of a day or week so far
+type LiveTotals struct {
+	PersonHours float64 `json:"person_hours"`
+	Visitors    int     `json:"visitors"`
+	Visits      int     `json:"visits"` // Sign-ins
+}
+
+// MemberStreak is a member's current streak
+type MemberStreak struct {
+	MemberID int64  `json:"member_id"`
+	Name     string `json:"name"`
+	Days     int    `json:"days"` // Consecutive office days
+}
+
+// LiveStats is the /stats/live response
+type LiveStats struct {
+	Date         string         `json:"date"`
+	Today        LiveTotals     `json:"today"`
+	WeekStart    string         `json:"week_start"` // Monday
+	Week         LiveTotals     `json:"week"`
+	Streaks      []MemberStreak `json:"streaks"` // Longest first, at least 2 days
+	ReconciledAt time.Time      `json:"reconciled_at"`
+}
+
+// liveMemberDay is a member's attendance on one day
+type liveMemberDay struct {
+	org     string
+	name    string
+	seconds float64 // Of completed sessions
+	visits  int
+}
+
+// liveStatsStore holds the attendance per day and member
+type liveStatsStore struct {
+	mu           sync.Mutex
+	days         map[string]map[int64]*liveMemberDay // By date, then member ID
+	reconciledAt time.Time
+}
+
+// newLiveStatsStore returns an empty store
+func newLiveStatsStore() *liveStatsStore {
+	return &liveStatsStore{days: make(map[string]map[int64]*liveMemberDay)}
+}
+
+// liveStats is the application's live statistics
+var liveStats = newLiveStatsStore()
+
+// liveDate returns the date of an instant in the report time zone
+func liveDate(t time.Time) string {
+	return t.In(reportLocation(defaultOrg)).Format(time.DateOnly)
+}
+
+// memberDay returns the entry of a member on a date, creating it. The caller holds mu.
+func (s *liveStatsStore) memberDay(date string, m Member) *liveMemberDay {
+	day, ok := s.days[date]
+	if !ok {
+		day = make(map[int64]*liveMemberDay)
+		s.days[date] = day
+	}
+	md, ok := day[m.ID]
+	if !ok {
+		md = &liveMemberDay{}
+		day[m.ID] = md
+	}
+	md.org, md.name = memberOrg(m), m.Name
+	return md
+}
+
+// addSession adds a completed session, split at midnight. The caller holds mu.
+func (s *liveStatsStore) addSession(m Member, start, end time.Time) {
+	loc := reportLocation(defaultOrg)
+	for start.Before(end) {
+		next := periodStart(start.In(loc), "day").AddDate(0, 0, 1)
+		sliceEnd := minTime(end, next)
+		s.memberDay(liveDate(start), m).seconds += sliceEnd.Sub(start).Seconds()
+		start = sliceEnd
+	}
+}
+
+// apply updates the totals with a sign_in or sign_out event
+func (s *liveStatsStore) apply(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch e.Kind {
+	case eventSignIn:
+		s.memberDay(liveDate(e.Time), e.Member).visits++
+	case eventSignOut:
+		s.addSession(e.Member, e.SignInTime, e.Time)
+	}
+}
+
+// reconcile rebuilds the totals of the window from the database
+func (s *liveStatsStore) reconcile(now time.Time) error {
+	from := now.Add(-liveStatsWindow)
+	intervals, err := loadPresenceIntervals(from, now, now, sessionTimesCorrected)
+	if err != nil {
+		return err
+	}
+
+	rebuilt := newLiveStatsStore()
+	for _, p := range intervals {
+		m := Member{ID: p.MemberID, Name: p.Name, OrgID: p.OrgID}
+		if !p.Start.Before(from) {
+			rebuilt.memberDay(liveDate(p.Start), m).visits++
+		}
+		if !p.Open {
+			rebuilt.addSession(m, maxTime(p.Start, from), p.End)
+		}
+	}
+
+	s.mu.Lock()
+	s.days, s.reconciledAt = rebuilt.days, now
+	s.mu.Unlock()
+	return nil
+}
+
+// snapshot returns the live statistics of an organization with at most limit streaks
+func (s *liveStatsStore) snapshot(org string, now time.Time, limit int) LiveStats {
+	loc := reportLocation(defaultOrg)
+	dayStart := periodStart(now.In(loc), "day")
+	weekStart := periodStart(now.In(loc), "week")
+	today := dayStart.Format(time.DateOnly)
+	stats := LiveStats{Date: today, WeekStart: weekStart.Format(time.DateOnly), Streaks: []MemberStreak{}}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats.ReconciledAt = s.reconciledAt
+
+	// Completed sessions and sign-ins
+	var todaySeconds, weekSeconds float64
+	todayVisitors, weekVisitors := make(map[int64]bool), make(map[int64]bool)
+	for day := weekStart; !day.After(dayStart); day = day.AddDate(0, 0, 1) {
+		date := day.Format(time.DateOnly)
+		for id, md := range s.days[date] {
+			if md.org != org {
+				continue
+			}
+			weekSeconds += md.seconds
+			stats.Week.Visits += md.visits
+			weekVisitors[id] = true
+			if date == today {
+				todaySeconds += md.seconds
+				stats.Today.Visits += md.visits
+				todayVisitors[id] = true
+			}
+		}
+	}
+
+	// Open sessions
+	names := make(map[int64]string)
+	for _, a := range currentAttendees.list() {
+		member, ok := memberCache.get(a.UID)
+		if !ok || memberOrg(member) != org {
+			continue
+		}
+		names[member.ID] = member.Name
+		todaySeconds += now.Sub(maxTime(a.SignInTime, dayStart)).Seconds()
+		weekSeconds += now.Sub(maxTime(a.SignInTime, weekStart)).Seconds()
+		todayVisitors[member.ID], weekVisitors[member.ID] = true, true
+	}
+	stats.Today.PersonHours, stats.Today.Visitors = todaySeconds/3600, len(todayVisitors)
+	stats.Week.PersonHours, stats.Week.Visitors = weekSeconds/3600, len(weekVisitors)
+
+	// Office days, newest first, with who came in on each
+	type officeDay struct {
+		today   bool
+		present map[int64]bool
+	}
+	var officeDays []officeDay
+	for day := dayStart; !day.Before(dayStart.Add(-liveStatsWindow)); day = day.AddDate(0, 0, -1) {
+		present := make(map[int64]bool)
+		for id, md := range s.days[day.Format(time.DateOnly)] {
+			if md.org == org {
+				present[id] = true
+				if _, ok := names[id]; !ok {
+					names[id] = md.name
+				}
+			}
+		}
+		isToday := day.Equal(dayStart)
+		if isToday {
+			for id := range todayVisitors {
+				present[id] = true
+			}
+		}
+		if len(present) > 0 {
+			officeDays = append(officeDays, officeDay{today: isToday, present: present})
+		}
+	}
+
+	for id, name := range names {
+		days := 0
+		for _, d := range officeDays {
+			if d.present[id] {
+				days++
+			} else if !d.today { // Not coming in yet today does not end a streak
+				break
+			}
+		}
+		if days >= 2 {
+			stats.Streaks = append(stats.Streaks, MemberStreak{MemberID: id, Name: name, Days: days})
+		}
+	}
+	sort.Slice(stats.Streaks, func(i, j int) bool {
+		a, b := stats.Streaks[i], stats.Streaks[j]
+		return a.Days > b.Days || (a.Days == b.Days && a.MemberID < b.MemberID)
+	})
+	if len(stats.Streaks) > limit {
+		stats.Streaks = stats.Streaks[:limit]
+	}
+	return stats
+}
+
+// startLiveStatsReconciler rebuilds the live statistics from the database periodically
+func startLiveStatsReconciler() {
+	ticker := time.NewTicker(liveStatsReconcileInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := liveStats.reconcile(now); err != nil {
+			log.Printf("Error reconciling live statistics: %v", err)
+		}
+	}
+}
+
+// handleStatsLive returns today's and this week's attendance and the current streaks
+// Query parameters:
+//   - limit: most streaks to return (default 10)
+//   - view: public (no streaks), member (initials) or admin (names), limited by the key's scope
+func handleStatsLive(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	view, ok := resolveView(w, r)
+	if !ok {
+		return
+	}
+	limit := defaultStreakLimit
+	if s := r.URL.Query().Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n < 0 {
+			http.Error(w, "Invalid 'limit' parameter, expected positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = n
+	}
+
+	stats := liveStats.snapshot(requestOrg(r), time.Now(), limit)
+	if view == scopePublic {
+		stats.Streaks = []MemberStreak{}
+	}
+	names := publicNames{}
+	for i := range stats.Streaks {
+		stats.Streaks[i].Name = names.of(Member{ID: stats.Streaks[i].MemberID, Name: stats.Streaks[i].Name}, view)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
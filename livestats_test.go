@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Live Statistics Tests
+// ============================================================================
+
+// applySession applies the sign_in and sign_out events of a session
+func applySession(s *liveStatsStore, m Member, start, end time.Time) {
+	s.apply(Event{Kind: eventSignIn, Time: start, Member: m})
+	s.apply(Event{Kind: eventSignOut, Time: end, Member: m, SignInTime: start})
+}
+
+func TestLiveStats_UpdatedByScans(t *testing.T) {
+	setupTest()
+
+	scanCard("TEST_UID_1")
+	events.wait()
+	stats := liveStats.snapshot(defaultOrg, time.Now(), defaultStreakLimit)
+	if stats.Today.Visits != 1 || stats.Today.Visitors != 1 || stats.Week.Visitors != 1 {
+		t.Errorf("expected the open session counted, got %+v", stats)
+	}
+
+	scanCard("TEST_UID_1")
+	events.wait()
+	stats = liveStats.snapshot(defaultOrg, time.Now(), defaultStreakLimit)
+	if stats.Today.Visits != 1 || stats.Today.Visitors != 1 || stats.Today.PersonHours > 0.01 {
+		t.Errorf("expected one short visit, got %+v", stats)
+	}
+}
+
+func TestLiveStats_OpenSessionCountsUpToNow(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-30*time.Minute))
+	stats := liveStats.snapshot(defaultOrg, time.Now(), defaultStreakLimit)
+	if stats.Today.Visitors != 1 || stats.Today.PersonHours <= 0 || stats.Week.PersonHours < stats.Today.PersonHours {
+		t.Errorf("expected the open session's time counted, got %+v", stats)
+	}
+}
+
+func TestLiveStats_ReconcileMatchesIncremental(t *testing.T) {
+	setupTest()
+
+	now := time.Now().Truncate(time.Second)
+	start, end := now.Add(-2*time.Hour), now.Add(-time.Hour)
+	if _, err := db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`,
+		1, start.Format(time.RFC3339), end.Format(time.RFC3339)); err != nil {
+		t.Fatal(err)
+	}
+
+	incremental := newLiveStatsStore()
+	applySession(incremental, Member{ID: 1, Name: "Alice"}, start, end)
+
+	reconciled := newLiveStatsStore()
+	if err := reconciled.reconcile(now); err != nil {
+		t.Fatal(err)
+	}
+
+	a, b := incremental.snapshot(defaultOrg, now, defaultStreakLimit), reconciled.snapshot(defaultOrg, now, defaultStreakLimit)
+	if a.Today != b.Today || a.Week != b.Week {
+		t.Errorf("expected the same totals, got %+v and %+v", a, b)
+	}
+	if math.Abs(b.Week.PersonHours-1) > 0.001 || !b.ReconciledAt.Equal(now) {
+		t.Errorf("expected one person-hour this week, got %+v", b)
+	}
+}
+
+func TestLiveStats_Streaks(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	dayStart := periodStart(now.In(reportLocation(defaultOrg)), "day")
+	alice, bob := Member{ID: 1, Name: "Alice"}, Member{ID: 2, Name: "Bob"}
+	s := newLiveStatsStore()
+	for _, visit := range []struct {
+		m       Member
+		daysAgo int
+	}{{alice, 1}, {alice, 2}, {alice, 3}, {bob, 1}, {bob, 3}} {
+		start := dayStart.AddDate(0, 0, -visit.daysAgo).Add(10 * time.Hour)
+		applySession(s, visit.m, start, start.Add(time.Hour))
+	}
+
+	// Alice has not come in yet today, which keeps her streak; Bob missed an office day
+	stats := s.snapshot(defaultOrg, now, defaultStreakLimit)
+	if len(stats.Streaks) != 1 || stats.Streaks[0].Name != "Alice" || stats.Streaks[0].Days != 3 {
+		t.Fatalf("expected Alice's 3-day streak only, got %+v", stats.Streaks)
+	}
+	if stats.Today.Visits != 0 {
+		t.Errorf("expected no visits today, got %+v", stats.Today)
+	}
+
+	if stats := s.snapshot("ess", now, defaultStreakLimit); len(stats.Streaks) != 0 || stats.Week.Visits != 0 {
+		t.Errorf("expected nothing for another organization, got %+v", stats)
+	}
+	if stats := s.snapshot(defaultOrg, now, 0); len(stats.Streaks) != 0 {
+		t.Errorf("expected the limit applied, got %+v", stats.Streaks)
+	}
+}
+
+func TestHandleStatsLive_Views(t *testing.T) {
+	setupTest()
+
+	start := periodStart(time.Now().In(reportLocation(defaultOrg)), "day").AddDate(0, 0, -1).Add(10 * time.Hour)
+	for _, daysAgo := range []int{0, 1} {
+		s := start.AddDate(0, 0, -daysAgo)
+		applySession(liveStats, Member{ID: 1, Name: "Alice Lee"}, s, s.Add(time.Hour))
+	}
+
+	for scope, want := range map[string]int{scopeAdmin: 1, scopeMember: 1, scopePublic: 0} {
+		rr := httptest.NewRecorder()
+		handleStatsLive(rr, scopedRequest("GET", "/stats/live", scope))
+		var stats LiveStats
+		json.Unmarshal(rr.Body.Bytes(), &stats)
+		if len(stats.Streaks) != want {
+			t.Errorf("%s: expected %d streaks, got %+v", scope, want, stats.Streaks)
+			continue
+		}
+		if want > 0 && stats.Streaks[0].Name != redactName("Alice Lee", scope) {
+			t.Errorf("%s: expected the name redacted, got %q", scope, stats.Streaks[0].Name)
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handleStatsLive(rr, scopedRequest("GET", "/stats/live?limit=-1", scopeAdmin))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a negative limit, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Load Shedding ---
+//
+// Scans must never wait because someone opened the history page. Heavy reads
+// (history, stats, reports, exports and search, see heavyReadRoutes) get a
+// budget of their own: at most HEAVY_READ_CONCURRENCY of them run at once
+// (default a quarter of DB_MAX_OPEN_CONNS, at least 1), which keeps database
+// connections free for scans and sign-ins. Up to HEAVY_READ_QUEUE more
+// (default 8) wait for a slot for at most HEAVY_READ_QUEUE_TIMEOUT (default
+// 5s). Past that the request is shed with 503 Service Unavailable and a
+// Retry-After header, and counted in requests_shed_total. Scans and every
+// other route are not limited.
+
+const (
+	defaultHeavyReadQueue        = 8
+	defaultHeavyReadQueueTimeout = 5 * time.Second
+)
+
+// heavyReadRoutes are the GET routes limited by the heavy read budget; a
+// pattern ending in '*' matches every path with that prefix
+var heavyReadRoutes = []string{
+	"/visits",
+	"/history/*",
+	"/stats/overlap",
+	"/stats/summary",
+	"/stats/heatmap",
+	"/stats/mentorship",
+	"/reports/*",
+	"/attendance/at",
+	"/export-members",
+	"/search",
+	"/admin/export*",
+	"/admin/data-quality",
+	"/admin/duplicates",
+}
+
+// readLimiter bounds how many heavy reads run and wait at once
+type readLimiter struct {
+	slots   chan struct{} // One per running read
+	queue   chan struct{} // One per read waiting for a slot
+	timeout time.Duration // Longest wait for a slot
+}
+
+// newReadLimiter returns a limiter running concurrency reads with queue more waiting
+func newReadLimiter(concurrency, queue int, timeout time.Duration) *readLimiter {
+	return &readLimiter{
+		slots:   make(chan struct{}, concurrency),
+		queue:   make(chan struct{}, queue),
+		timeout: timeout,
+	}
+}
+
+// heavyReads is the heavy read budget, nil for none (loaded at startup)
+var heavyReads *readLimiter
+
+// loadHeavyReadLimiter reads the HEAVY_READ_* settings, sized by the database pool
+func loadHeavyReadLimiter(db DBConfig) (*readLimiter, error) {
+	concurrency := max(1, db.MaxOpenConns/4)
+	queue := defaultHeavyReadQueue
+	for _, setting := range []struct {
+		name     string
+		value    *int
+		minValue int
+	}{
+		{"HEAVY_READ_CONCURRENCY", &concurrency, 1},
+		{"HEAVY_READ_QUEUE", &queue, 0},
+	} {
+		if value := os.Getenv(setting.name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n < setting.minValue {
+				return nil, fmt.Errorf("%s must be a number of at least %d, got %q", setting.name, setting.minValue, value)
+			}
+			*setting.value = n
+		}
+	}
+
+	timeout := defaultHeavyReadQueueTimeout
+	if value := os.Getenv("HEAVY_READ_QUEUE_TIMEOUT"); value != "" {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return nil, fmt.Errorf("HEAVY_READ_QUEUE_TIMEOUT: invalid duration %q", value)
+		}
+		timeout = d
+	}
+	return newReadLimiter(concurrency, queue, timeout), nil
+}
+
+// acquire takes a slot, waiting in the queue if there is room in it. The
+// returned function gives the slot back; ok is false if the read is shed.
+func (l *readLimiter) acquire(ctx context.Context) (release func(), ok bool) {
+	release = func() { <-l.slots }
+	select {
+	case l.slots <- struct{}{}:
+		return release, true
+	default:
+	}
+
+	select {
+	case l.queue <- struct{}{}:
+		defer func() { <-l.queue }()
+	default:
+		return nil, false
+	}
+
+	timer := time.NewTimer(l.timeout)
+	defer timer.Stop()
+	select {
+	case l.slots <- struct{}{}:
+		return release, true
+	case <-timer.C:
+	case <-ctx.Done():
+	}
+	return nil, false
+}
+
+// retryAfter is the Retry-After of shed reads, in whole seconds
+func (l *readLimiter) retryAfter() string {
+	return strconv.Itoa(max(1, int(math.Ceil(l.timeout.Seconds()))))
+}
+
+// isHeavyRead reports whether a request falls under the heavy read budget
+func isHeavyRead(r *http.Request) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	for _, pattern := range heavyReadRoutes {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		} else if r.URL.Path == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// loadShedMiddleware runs heavy reads within their budget, shedding those
+// that cannot get a slot in time
+func loadShedMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		limiter := heavyReads
+		if limiter == nil || !isHeavyRead(r) {
+			next(w, r)
+			return
+		}
+
+		release, ok := limiter.acquire(r.Context())
+		if !ok {
+			incCounter("requests_shed_total")
+			logHTTP.warnf("Warning: shed %s %s, too many heavy reads", r.Method, r.URL.Path)
+			w.Header().Set("Retry-After", limiter.retryAfter())
+			http.Error(w, "Server busy, try again later", http.StatusServiceUnavailable)
+			return
+		}
+		defer release()
+		next(w, r)
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Load Shedding Tests
+// ============================================================================
+
+func TestIsHeavyRead(t *testing.T) {
+	cases := []struct {
+		method, path string
+		want         bool
+	}{
+		{"GET", "/visits", true},
+		{"HEAD", "/stats/heatmap", true},
+		{"GET", "/reports/summary.pdf", true},
+		{"GET", "/admin/export/anonymized", true},
+		{"DELETE", "/visits", false},
+		{"POST", "/scan", false},
+		{"GET", "/current", false},
+		{"GET", "/stats/live", false},
+		{"GET", "/visits/extra", false},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, c.path, nil)
+		if got := isHeavyRead(req); got != c.want {
+			t.Errorf("%s %s: expected %v, got %v", c.method, c.path, c.want, got)
+		}
+	}
+}
+
+func TestLoadShedMiddleware_ShedsHeavyReadsNotScans(t *testing.T) {
+	setupTest()
+	heavyReads = newReadLimiter(1, 0, 10*time.Millisecond)
+
+	// Hold the only slot with a slow read
+	started, finish := make(chan struct{}), make(chan struct{})
+	slow := loadShedMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-finish
+	})
+	go slow(httptest.NewRecorder(), httptest.NewRequest("GET", "/visits", nil))
+	<-started
+	defer close(finish)
+
+	handler := loadShedMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("GET", "/stats/summary", nil))
+	if rr.Code != http.StatusServiceUnavailable || rr.Header().Get("Retry-After") != "1" {
+		t.Errorf("expected 503 with Retry-After, got %v %q", rr.Code, rr.Header().Get("Retry-After"))
+	}
+	if got := counters["requests_shed_total"]; got != 1 {
+		t.Errorf("expected the shed read counted, got %v", got)
+	}
+
+	rr = httptest.NewRecorder()
+	handler(rr, httptest.NewRequest("POST", "/scan", nil))
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected scans to go through, got %v", rr.Code)
+	}
+}
+
+func TestReadLimiter_QueuedReadGetsSlot(t *testing.T) {
+	limiter := newReadLimiter(1, 1, time.Second)
+	release, ok := limiter.acquire(context.Background())
+	if !ok {
+		t.Fatal("expected a free slot")
+	}
+
+	got := make(chan bool)
+	go func() {
+		r, ok := limiter.acquire(context.Background())
+		if ok {
+			r()
+		}
+		got <- ok
+	}()
+
+	// The queue holds one read, so a third is shed at once
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := limiter.acquire(context.Background()); ok {
+		t.Error("expected a read past the queue to be shed")
+	}
+
+	release()
+	if !<-got {
+		t.Error("expected the queued read to get the slot once released")
+	}
+}
+
+func TestLoadHeavyReadLimiter(t *testing.T) {
+	limiter, err := loadHeavyReadLimiter(DBConfig{MaxOpenConns: 8})
+	if err != nil || cap(limiter.slots) != 2 || cap(limiter.queue) != defaultHeavyReadQueue || limiter.timeout != defaultHeavyReadQueueTimeout {
+		t.Errorf("expected the defaults, got %+v (%v)", limiter, err)
+	}
+
+	t.Setenv("HEAVY_READ_CONCURRENCY", "3")
+	t.Setenv("HEAVY_READ_QUEUE", "0")
+	t.Setenv("HEAVY_READ_QUEUE_TIMEOUT", "2500ms")
+	limiter, err = loadHeavyReadLimiter(DBConfig{MaxOpenConns: 8})
+	if err != nil || cap(limiter.slots) != 3 || cap(limiter.queue) != 0 || limiter.retryAfter() != "3" {
+		t.Errorf("expected the configured budget, got %+v (%v)", limiter, err)
+	}
+
+	t.Setenv("HEAVY_READ_CONCURRENCY", "0")
+	if _, err := loadHeavyReadLimiter(DBConfig{MaxOpenConns: 8}); err == nil {
+		t.Error("expected an error for no heavy reads at all")
+	}
+}
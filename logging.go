@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Log Levels ---
+//
+// Routine messages are logged by subsystem, each with its own level, so a
+// noisy subsystem can be quieted, or a failing one made verbose, without a
+// restart:
+//   - http: one line per scan and sign-in/out, dropped office stream events
+//     and, at debug, the redacted bodies of requests (see debuglog.go)
+//   - store: open session, member lookup and Redis failures
+//   - jobs: background job retries, dead letters and, at debug, every run
+//   - integrations: webhooks, quiet hours and scheduled report deliveries
+//
+// Levels are debug, info (default), warn and error; a subsystem logs the
+// messages at its level and above. Startup messages and handler errors are
+// always logged.
+//
+// LOG_LEVEL sets the level of every subsystem, LOG_COMPONENT_LEVELS overrides
+// it for some (such as http=warn,jobs=debug) and LOG_DEBUG_ROUTES limits
+// body logging to some paths. GET and PUT /admin/log-level read and change
+// them at runtime, optionally for a limited time after which the levels
+// return to info.
+
+const (
+	logLevelDebug = "debug"
+	logLevelInfo  = "info"
+	logLevelWarn  = "warn"
+	logLevelError = "error"
+)
+
+// logLevelRank orders the levels, 0 for unknown ones
+var logLevelRank = map[string]int{logLevelDebug: 1, logLevelInfo: 2, logLevelWarn: 3, logLevelError: 4}
+
+// logComponent is a subsystem with its own log level
+type logComponent string
+
+const (
+	logHTTP         logComponent = "http"
+	logStore        logComponent = "store"
+	logJobs         logComponent = "jobs"
+	logIntegrations logComponent = "integrations"
+)
+
+// logComponents lists the subsystems, for validation
+var logComponents = []logComponent{logHTTP, logStore, logJobs, logIntegrations}
+
+// LogLevel is the logging configuration, served and set by /admin/log-level
+type LogLevel struct {
+	Level      string            `json:"level"`      // Level of the subsystems not in Components
+	Components map[string]string `json:"components"` // Levels of individual subsystems
+	Routes     []string          `json:"routes"`     // Path prefixes logged with bodies at debug level, all if empty
+	ExpiresAt  *time.Time        `json:"expires_at,omitempty"`
+}
+
+// LogLevelRequest is the body of PUT /admin/log-level
+type LogLevelRequest struct {
+	Level      string            `json:"level"`
+	Components map[string]string `json:"components"`
+	Routes     []string          `json:"routes"`
+	For        string            `json:"for"` // Go duration after which the levels return to info (optional)
+}
+
+var (
+	// logLevel is the current logging configuration
+	logLevel   = defaultLogLevel()
+	logLevelMu sync.RWMutex
+)
+
+// defaultLogLevel logs every subsystem at info
+func defaultLogLevel() LogLevel {
+	return LogLevel{Level: logLevelInfo, Components: map[string]string{}, Routes: []string{}}
+}
+
+// level returns the level of a subsystem
+func (l LogLevel) level(c logComponent) string {
+	if level, ok := l.Components[string(c)]; ok {
+		return level
+	}
+	return l.Level
+}
+
+// normalizeLogLevel validates a level name, info if empty
+func normalizeLogLevel(level string) (string, error) {
+	level = strings.ToLower(strings.TrimSpace(level))
+	if level == "" {
+		return logLevelInfo, nil
+	}
+	if logLevelRank[level] == 0 {
+		return "", fmt.Errorf("invalid level %q, expected debug, info, warn or error", level)
+	}
+	return level, nil
+}
+
+// parseComponentLevels parses component=level pairs separated by commas
+func parseComponentLevels(value string) (map[string]string, error) {
+	levels := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		component, level, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid entry %q, expected component=level", pair)
+		}
+		levels[strings.TrimSpace(component)] = strings.TrimSpace(level)
+	}
+	return levels, nil
+}
+
+// newLogLevel validates a logging configuration
+func newLogLevel(level string, components map[string]string, routes []string) (LogLevel, error) {
+	l := defaultLogLevel()
+
+	var err error
+	if l.Level, err = normalizeLogLevel(level); err != nil {
+		return l, err
+	}
+	for component, level := range components {
+		known := false
+		for _, c := range logComponents {
+			known = known || string(c) == component
+		}
+		if !known {
+			return l, fmt.Errorf("unknown component %q, expected http, store, jobs or integrations", component)
+		}
+		if l.Components[component], err = normalizeLogLevel(level); err != nil {
+			return l, fmt.Errorf("%s: %w", component, err)
+		}
+	}
+	for _, route := range routes {
+		if route = strings.TrimSpace(route); route == "" {
+			continue
+		}
+		if !strings.HasPrefix(route, "/") {
+			return l, fmt.Errorf("route %q must start with /", route)
+		}
+		l.Routes = append(l.Routes, route)
+	}
+	return l, nil
+}
+
+// loadLogLevel reads LOG_LEVEL, LOG_COMPONENT_LEVELS and LOG_DEBUG_ROUTES
+func loadLogLevel(level, componentLevels, routes string) (LogLevel, error) {
+	components, err := parseComponentLevels(componentLevels)
+	if err != nil {
+		return defaultLogLevel(), err
+	}
+	return newLogLevel(level, components, strings.Split(routes, ","))
+}
+
+// currentLogLevel returns the logging configuration, back to info once it expired
+func currentLogLevel(now time.Time) LogLevel {
+	logLevelMu.RLock()
+	l := logLevel
+	logLevelMu.RUnlock()
+
+	if l.ExpiresAt != nil && !now.Before(*l.ExpiresAt) {
+		return defaultLogLevel()
+	}
+	return l
+}
+
+// enabled reports whether the subsystem logs messages of a level
+func (c logComponent) enabled(level string) bool {
+	return logLevelRank[level] >= logLevelRank[currentLogLevel(time.Now()).level(c)]
+}
+
+// logf logs a message of the subsystem if its level allows it
+func (c logComponent) logf(level, format string, args ...interface{}) {
+	if c.enabled(level) {
+		log.Printf(format, args...)
+	}
+}
+
+func (c logComponent) debugf(format string, args ...interface{}) {
+	c.logf(logLevelDebug, format, args...)
+}
+
+func (c logComponent) infof(format string, args ...interface{}) {
+	c.logf(logLevelInfo, format, args...)
+}
+
+func (c logComponent) warnf(format string, args ...interface{}) {
+	c.logf(logLevelWarn, format, args...)
+}
+
+// errorf also reports the message when error tracking is on (see errortracking.go)
+func (c logComponent) errorf(format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	reportError(context.Background(), c, message, message, nil)
+	c.logf(logLevelError, "%s", message)
+}
+
+// describe summarizes a logging configuration for logs and the audit log
+func (l LogLevel) describe() string {
+	detail := l.Level
+	components := make([]string, 0, len(l.Components))
+	for component, level := range l.Components {
+		components = append(components, component+"="+level)
+	}
+	sort.Strings(components)
+	if len(components) > 0 {
+		detail += " (" + strings.Join(components, ", ") + ")"
+	}
+	if len(l.Routes) > 0 {
+		detail += ", bodies of " + strings.Join(l.Routes, ", ")
+	}
+	if l.ExpiresAt != nil {
+		detail += " until " + l.ExpiresAt.Format(time.RFC3339)
+	}
+	return detail
+}
+
+// handleLogLevel reads (GET) or changes (PUT) the log levels
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(currentLogLevel(time.Now()))
+
+	case http.MethodPut:
+		var req LogLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.Level == "" && len(req.Components) == 0 {
+			http.Error(w, "'level' or 'components' is required", http.StatusBadRequest)
+			return
+		}
+		l, err := newLogLevel(req.Level, req.Components, req.Routes)
+		if err != nil {
+			http.Error(w, "Invalid log level: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.For != "" {
+			d, err := time.ParseDuration(req.For)
+			if err != nil || d <= 0 {
+				http.Error(w, "Invalid 'for', expected a Go duration such as 30m", http.StatusBadRequest)
+				return
+			}
+			expires := time.Now().Add(d)
+			l.ExpiresAt = &expires
+		}
+
+		logLevelMu.Lock()
+		logLevel = l
+		logLevelMu.Unlock()
+
+		log.Printf("Log level set to %s", l.describe())
+		recordAudit("log_level.changed", clientIP(r), l.describe())
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(l)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Log Level Tests
+// ============================================================================
+
+func TestHandleLogLevel(t *testing.T) {
+	setupTest()
+
+	rr := setLogLevel(t, `{"level": "debug", "for": "30m"}`)
+	var level LogLevel
+	if err := json.Unmarshal(rr.Body.Bytes(), &level); err != nil || level.Level != logLevelDebug || level.ExpiresAt == nil {
+		t.Fatalf("expected debug with an expiry, got %s", rr.Body.String())
+	}
+	if entries, _ := loadAuditEntries("log_level.changed", 10); len(entries) != 1 {
+		t.Errorf("expected an audit entry, got %d", len(entries))
+	}
+
+	// Back to info once expired
+	if l := currentLogLevel(time.Now().Add(31 * time.Minute)); l.Level != logLevelInfo {
+		t.Errorf("expected the debug level to expire, got %+v", l)
+	}
+
+	for _, body := range []string{
+		`{"level": "verbose"}`,
+		`{}`,
+		`{"level": "debug", "routes": ["scan"]}`,
+		`{"level": "debug", "for": "soon"}`,
+		`{"components": {"scanner": "debug"}}`,
+		`{"components": {"jobs": "loud"}}`,
+	} {
+		if rr := setLogLevel(t, body); rr.Code != http.StatusBadRequest {
+			t.Errorf("expected 400 for %s, got %v", body, rr.Code)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handleLogLevel(rr, httptest.NewRequest("DELETE", "/admin/log-level", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %v", rr.Code)
+	}
+}
+
+func TestHandleLogLevel_Components(t *testing.T) {
+	setupTest()
+
+	rr := setLogLevel(t, `{"components": {"http": "WARN", "jobs": "debug"}}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %v %s", rr.Code, rr.Body.String())
+	}
+
+	rr = httptest.NewRecorder()
+	handleLogLevel(rr, httptest.NewRequest("GET", "/admin/log-level", nil))
+	var level LogLevel
+	if err := json.Unmarshal(rr.Body.Bytes(), &level); err != nil {
+		t.Fatalf("invalid response %s", rr.Body.String())
+	}
+	if level.Level != logLevelInfo || level.Components["http"] != logLevelWarn || level.Components["jobs"] != logLevelDebug {
+		t.Errorf("unexpected levels %+v", level)
+	}
+	if entries, _ := loadAuditEntries("log_level.changed", 10); len(entries) != 1 || !strings.Contains(entries[0].Detail, "http=warn, jobs=debug") {
+		t.Errorf("expected the component levels audited, got %+v", entries)
+	}
+}
+
+func TestLogComponents(t *testing.T) {
+	setupTest()
+	setLogLevel(t, `{"level": "warn", "components": {"store": "debug", "integrations": "error"}}`)
+	logs := captureLog(t)
+
+	// Welcome lines are http info messages, quiet at warn
+	scanCard("TEST_UID_1")
+	if strings.Contains(logs.String(), "Welcome") {
+		t.Errorf("expected the sign-in line suppressed, got %s", logs.String())
+	}
+
+	logHTTP.warnf("http warning")
+	logStore.debugf("store detail")
+	logJobs.infof("job info")
+	logIntegrations.warnf("integration warning")
+	logIntegrations.errorf("integration error")
+	out := logs.String()
+	for _, want := range []string{"http warning", "store detail", "integration error"} {
+		if !strings.Contains(out, want) {
+			t.Errorf("expected %q logged, got %s", want, out)
+		}
+	}
+	for _, quiet := range []string{"job info", "integration warning"} {
+		if strings.Contains(out, quiet) {
+			t.Errorf("expected %q suppressed, got %s", quiet, out)
+		}
+	}
+
+	// Request bodies are logged when http alone is at debug
+	setLogLevel(t, `{"components": {"http": "debug"}}`)
+	if !debugLogged("/scan", time.Now()) {
+		t.Error("expected bodies logged with http at debug")
+	}
+	setLogLevel(t, `{"level": "debug", "components": {"http": "info"}}`)
+	if debugLogged("/scan", time.Now()) {
+		t.Error("expected no bodies logged with http at info")
+	}
+}
+
+func TestLoadLogLevel(t *testing.T) {
+	l, err := loadLogLevel("DEBUG", "", "/scan, /checkin/nfc")
+	if err != nil || l.Level != logLevelDebug || len(l.Routes) != 2 || l.Routes[1] != "/checkin/nfc" {
+		t.Errorf("unexpected level %+v (err %v)", l, err)
+	}
+
+	l, err = loadLogLevel("", "http=warn, jobs = debug", "")
+	if err != nil || l.Level != logLevelInfo || l.level(logHTTP) != logLevelWarn || l.level(logJobs) != logLevelDebug || l.level(logStore) != logLevelInfo {
+		t.Errorf("unexpected component levels %+v (err %v)", l, err)
+	}
+
+	for _, invalid := range [][2]string{{"trace", ""}, {"", "http"}, {"", "db=debug"}, {"", "jobs=verbose"}} {
+		if _, err := loadLogLevel(invalid[0], invalid[1], ""); err == nil {
+			t.Errorf("expected an error for %v", invalid)
+		}
+	}
+}
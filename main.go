@@ -1,15 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/csv"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -24,26 +28,52 @@ const (
 	currentAttendeesFilePath = dataFolder + "current_attendees.json"
 	membersFilePath          = dataFolder + "members.json"
 	databaseFilePath         = dataFolder + "attendance.db"
+
+	// Room assumed for scans that don't name one
+	defaultRoom = "office"
+
+	// Local hour at which everyone still inside is signed out
+	nightlyCleanupHour = 4
+)
+
+// Member roles
+const (
+	roleMember  = "member"
+	roleExec    = "exec"
+	roleOfficer = "officer"
+	roleGuest   = "guest"
 )
 
 // --- Data Structures ---
 
 // ScanRequest is the JSON payload we expect from the ESP32
 type ScanRequest struct {
-	UID string `json:"uid"`
+	UID  string     `json:"uid"`
+	Room string     `json:"room,omitempty"` // Optional, defaults to defaultRoom
+	Time *time.Time `json:"time,omitempty"` // Optional scanner clock reading, used to measure clock skew
 }
 
 // Visit represents a completed visit (Signin + Signout)
 type Visit struct {
+	ID          int64     `json:"id"`
 	Name        string    `json:"name"`
 	SignInTime  time.Time `json:"signin_time"`
 	SignOutTime time.Time `json:"signout_time"`
+	AfterHours  bool      `json:"after_hours"` // Partly outside OFFICE_HOURS
+
+	memberID int64 // Whose visit, to name them as they chose
 }
 
 // ActiveAttendee represents someone currently in the room
 type ActiveAttendee struct {
-	Name       string    `json:"name"`
-	SignInTime time.Time `json:"signin_time"`
+	Name            string    `json:"name"`
+	SignInTime      time.Time `json:"signin_time"`
+	DurationSeconds int64     `json:"duration_seconds"`
+	AutoSignOutAt   time.Time `json:"will_auto_signout_at"` // Next nightly cleanup
+	MemberID        int64     `json:"member_id,omitempty"`
+	UID             string    `json:"uid,omitempty"`        // Masked in the member view
+	DiscordID       string    `json:"discord_id,omitempty"` // Admin view only
+	AfterHours      bool      `json:"after_hours"`          // Any time outside OFFICE_HOURS since signing in
 }
 
 // ScanEvent captures a single scan with timestamp (most recent 10 kept in memory)
@@ -58,6 +88,18 @@ type Member struct {
 	Name      string `json:"name"`
 	UID       string `json:"uid"`
 	DiscordID string `json:"discord_id"`
+	Role      string `json:"role"`
+	Status    string `json:"status"`
+	OrgID     string `json:"org_id"`
+	PhotoURL  string `json:"photo_url,omitempty"`  // Set by GET /members and /me if the member has a photo
+	AvatarURL string `json:"avatar_url,omitempty"` // Discord avatar, set instead of PhotoURL when known
+}
+
+// MemberDetails is a member as returned by GET /members/{id}
+type MemberDetails struct {
+	Member
+	Consent ConsentState       `json:"consent"`
+	Privacy PrivacyPreferences `json:"privacy"`
 }
 
 // CreateMemberRequest is the payload to create a member
@@ -65,61 +107,37 @@ type CreateMemberRequest struct {
 	Name      string `json:"name"`
 	UID       string `json:"uid"`
 	DiscordID string `json:"discord_id"`
+	Role      string `json:"role,omitempty"`   // member (default), exec, officer or guest
+	Status    string `json:"status,omitempty"` // active (default), pending, inactive or alumni
+}
+
+// CountBreakdown is the detailed /count response
+type CountBreakdown struct {
+	Total    int            `json:"total"`
+	ByRoom   map[string]int `json:"by_room"`
+	Members  int            `json:"members"`
+	Guests   int            `json:"guests"`
+	Execs    int            `json:"execs"`
+	Officers int            `json:"officers"`
 }
 
 // --- Global State ---
 
 var (
-	// In-memory cache for UID -> Member (loaded from DB at startup)
-	userDB map[string]Member
-
-	// In-memory ring buffer storing last 10 scan events
-	scanHistory []ScanEvent
-
-	// Map of attendees currently in room (Map[UID]SignInTime)
-	currentAttendees = make(map[string]time.Time)
-
 	// SQLite database connection
 	db *sql.DB
 
-	// Mutex to protect our maps/slices from concurrent access
-	mu sync.RWMutex
-
 	// API keys for client authentication
 	validAPIKeys map[string]bool // Map of valid API keys (loaded from env)
 )
 
 // --- Helpers ---
 
-// corsMiddleware adds CORS headers to allow cross-origin requests
-func corsMiddleware(next http.HandlerFunc) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		// Get allowed origins from environment variable, default to "*"
-		allowedOrigins := os.Getenv("ALLOWED_ORIGINS")
-		if allowedOrigins == "" {
-			allowedOrigins = "*"
-		}
-
-		w.Header().Set("Access-Control-Allow-Origin", allowedOrigins)
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
-		w.Header().Set("Access-Control-Max-Age", "3600")
-
-		// Handle preflight OPTIONS request
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
-
-		next(w, r)
-	}
-}
-
 // apiKeyMiddleware validates API key before processing requests
 func apiKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Health check endpoint is always allowed
-		if r.URL.Path == "/health" {
+		if r.URL.Path == "/health" || r.URL.Path == "/healthz" {
 			next(w, r)
 			return
 		}
@@ -133,24 +151,65 @@ func apiKeyMiddleware(next http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
+		// Clients locked out after repeated failures are only refused when
+		// they fail again (see authguard.go)
+		ip := clientIP(r)
+
+		// Display devices authenticate with a kiosk token instead of a key
+		if apiKey == "" && r.URL.Query().Has(kioskTokenParam) {
+			if scope, ok := authenticateKioskToken(w, r); ok {
+				next(w, r.WithContext(withScope(r.Context(), scope)))
+			}
+			return
+		}
+
 		// Validate API key
 		if apiKey == "" || !validAPIKeys[apiKey] {
+			writeAuthFailure(w, ip, "missing or invalid API key")
+			return
+		}
+
+		clearAuthFailures(ip)
+		apiKeyUsage.record(apiKey, r, time.Now())
+
+		// Restrict non-admin keys to the read endpoints their scope allows
+		scope := scopeAdmin
+		if s, ok := apiKeyScopes[apiKey]; ok {
+			scope = s
+		}
+		if !scopeAllowsRequest(scope, r) {
 			w.Header().Set("Content-Type", "application/json")
-			w.WriteHeader(http.StatusUnauthorized)
+			w.WriteHeader(http.StatusForbidden)
 			json.NewEncoder(w).Encode(map[string]string{
-				"error": "missing or invalid API key",
+				"error": "API key scope does not allow this endpoint",
 			})
 			return
 		}
 
-		next(w, r)
+		// Keep keys of other organizations to the endpoints that separate organizations
+		org := defaultOrg
+		if o, ok := apiKeyOrgs[apiKey]; ok {
+			org = o
+		}
+		if !orgAllowsRequest(org, r) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "API key organization does not allow this endpoint",
+			})
+			return
+		}
+
+		next(w, r.WithContext(withOrg(withScope(r.Context(), scope), org)))
 	}
 }
 
 // initDB initializes the SQLite database and creates the members and visits tables
 func initDB() error {
+	// Busy timeout, foreign keys and synchronous mode are set on every
+	// connection by the DSN (see dbconfig.go)
 	var err error
-	db, err = sql.Open("sqlite", databaseFilePath)
+	db, err = dbConfig.openDB(databaseFilePath)
 	if err != nil {
 		return err
 	}
@@ -159,63 +218,841 @@ func initDB() error {
 	if _, err := db.Exec(`PRAGMA journal_mode = WAL;`); err != nil {
 		return fmt.Errorf("failed to enable WAL: %w", err)
 	}
-	if _, err := db.Exec(`PRAGMA busy_timeout = 5000;`); err != nil {
-		return fmt.Errorf("failed to set busy timeout: %w", err)
+
+	// Create members table
+	createMembersSQL := `CREATE TABLE IF NOT EXISTS members (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		uid TEXT NOT NULL UNIQUE,
+		discord_id TEXT NOT NULL,
+		role TEXT NOT NULL DEFAULT 'member',
+		status TEXT NOT NULL DEFAULT 'active',
+		deleted_at TEXT,
+		merged_into INTEGER
+	);`
+
+	if _, err = db.Exec(createMembersSQL); err != nil {
+		return err
+	}
+
+	// Create visits table referencing members
+	createVisitsSQL := `CREATE TABLE IF NOT EXISTS visits (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		member_id INTEGER NOT NULL,
+		signin_time TEXT NOT NULL,
+		signout_time TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err = db.Exec(createVisitsSQL); err != nil {
+		return err
+	}
+	// Lets reports find the sessions overlapping a period (see loadPresenceIntervals)
+	if _, err = db.Exec(`CREATE INDEX IF NOT EXISTS idx_visits_signout ON visits(signout_time, signin_time)`); err != nil {
+		return err
+	}
+
+	return createTables()
+}
+
+// createTables creates the supporting tables used alongside members and visits
+func createTables() error {
+	// Audit log of security- and admin-relevant events
+	createAuditLogSQL := `CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		created_at TEXT NOT NULL,
+		action TEXT NOT NULL,
+		actor TEXT NOT NULL,
+		detail TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createAuditLogSQL); err != nil {
+		return err
+	}
+
+	// Member roles were added after the members table
+	if err := ensureColumn("members", "role", `TEXT NOT NULL DEFAULT 'member'`); err != nil {
+		return err
+	}
+
+	// Member lifecycle status (see memberstatus.go)
+	if err := ensureColumn("members", "status", `TEXT NOT NULL DEFAULT 'active'`); err != nil {
+		return err
+	}
+
+	// Soft deletion of members merged into another member
+	if err := ensureColumn("members", "deleted_at", `TEXT`); err != nil {
+		return err
+	}
+	if err := ensureColumn("members", "merged_into", `INTEGER`); err != nil {
+		return err
+	}
+
+	// Organization of each member (see orgs.go)
+	if err := ensureColumn("members", "org_id", `TEXT NOT NULL DEFAULT '`+defaultOrg+`'`); err != nil {
+		return err
+	}
+
+	// Scanner devices and their client certificates
+	createDevicesSQL := `CREATE TABLE IF NOT EXISTS devices (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		created_at TEXT NOT NULL,
+		cert_fingerprint TEXT UNIQUE,
+		cert_pem TEXT,
+		cert_expires_at TEXT,
+		card_format TEXT NOT NULL DEFAULT 'raw',
+		firmware_channel TEXT NOT NULL DEFAULT 'stable',
+		firmware_version TEXT,
+		last_seen_at TEXT,
+		offline_since TEXT,
+		clock_skew_seconds REAL,
+		org_id TEXT NOT NULL DEFAULT '` + defaultOrg + `'
+	);`
+
+	if _, err := db.Exec(createDevicesSQL); err != nil {
+		return err
+	}
+	if err := ensureColumn("devices", "card_format", `TEXT NOT NULL DEFAULT 'raw'`); err != nil {
+		return err
+	}
+	if err := ensureColumn("devices", "firmware_channel", `TEXT NOT NULL DEFAULT 'stable'`); err != nil {
+		return err
+	}
+	if err := ensureColumn("devices", "firmware_version", `TEXT`); err != nil {
+		return err
+	}
+	if err := ensureColumn("devices", "last_seen_at", `TEXT`); err != nil {
+		return err
+	}
+	if err := ensureColumn("devices", "offline_since", `TEXT`); err != nil {
+		return err
+	}
+	if err := ensureColumn("devices", "clock_skew_seconds", `REAL`); err != nil {
+		return err
+	}
+	if err := ensureColumn("devices", "org_id", `TEXT NOT NULL DEFAULT '`+defaultOrg+`'`); err != nil {
+		return err
+	}
+
+	// Settings served to scanners, versioned so devices know when to refresh
+	createDeviceConfigsSQL := `CREATE TABLE IF NOT EXISTS device_configs (
+		device_id INTEGER PRIMARY KEY REFERENCES devices(id) ON DELETE CASCADE,
+		version INTEGER NOT NULL,
+		settings TEXT NOT NULL,
+		updated_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createDeviceConfigsSQL); err != nil {
+		return err
+	}
+
+	// Scanner firmware releases
+	createFirmwareSQL := `CREATE TABLE IF NOT EXISTS firmware (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		version TEXT NOT NULL,
+		channel TEXT NOT NULL,
+		sha256 TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		data BLOB NOT NULL,
+		uploaded_at TEXT NOT NULL,
+		UNIQUE(version, channel)
+	);`
+
+	if _, err := db.Exec(createFirmwareSQL); err != nil {
+		return err
+	}
+
+	// Academic terms used as reporting periods
+	createTermsSQL := `CREATE TABLE IF NOT EXISTS terms (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		start_time TEXT NOT NULL,
+		end_time TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createTermsSQL); err != nil {
+		return err
+	}
+
+	// Days the office is closed (see closures.go), dates inclusive
+	createClosuresSQL := `CREATE TABLE IF NOT EXISTS closures (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		start_date TEXT NOT NULL,
+		end_date TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createClosuresSQL); err != nil {
+		return err
+	}
+
+	// Hour goals per term, for one member or everyone with a role
+	createGoalsSQL := `CREATE TABLE IF NOT EXISTS goals (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		term_id INTEGER NOT NULL,
+		member_id INTEGER,
+		role TEXT,
+		hours REAL NOT NULL,
+		UNIQUE(term_id, member_id),
+		UNIQUE(term_id, role),
+		FOREIGN KEY(term_id) REFERENCES terms(id) ON DELETE CASCADE,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createGoalsSQL); err != nil {
+		return err
+	}
+
+	// Goals already reached, so completion is only announced once
+	createGoalCompletionsSQL := `CREATE TABLE IF NOT EXISTS goal_completions (
+		goal_id INTEGER NOT NULL,
+		member_id INTEGER NOT NULL,
+		completed_at TEXT NOT NULL,
+		PRIMARY KEY(goal_id, member_id),
+		FOREIGN KEY(goal_id) REFERENCES goals(id) ON DELETE CASCADE,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createGoalCompletionsSQL); err != nil {
+		return err
+	}
+
+	// Members currently inside, used instead of current_attendees.json in stateless mode
+	createOpenSessionsSQL := `CREATE TABLE IF NOT EXISTS open_sessions (
+		uid TEXT PRIMARY KEY,
+		room TEXT NOT NULL DEFAULT '',
+		signin_time TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createOpenSessionsSQL); err != nil {
+		return err
+	}
+
+	// Reports delivered on a recurring schedule, and the history of their runs
+	createReportSchedulesSQL := `CREATE TABLE IF NOT EXISTS report_schedules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		report TEXT NOT NULL,
+		schedule TEXT NOT NULL,
+		hour INTEGER NOT NULL,
+		target TEXT NOT NULL,
+		destination TEXT NOT NULL,
+		enabled INTEGER NOT NULL DEFAULT 1,
+		next_run_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createReportSchedulesSQL); err != nil {
+		return err
+	}
+
+	createReportRunsSQL := `CREATE TABLE IF NOT EXISTS report_runs (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		schedule_id INTEGER NOT NULL,
+		started_at TEXT NOT NULL,
+		finished_at TEXT NOT NULL,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		size INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(schedule_id) REFERENCES report_schedules(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createReportRunsSQL); err != nil {
+		return err
+	}
+
+	// Signups from the membership form waiting for a card to be enrolled
+	createPendingMembersSQL := `CREATE TABLE IF NOT EXISTS pending_members (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		discord_id TEXT NOT NULL UNIQUE,
+		email TEXT NOT NULL DEFAULT '',
+		role TEXT NOT NULL DEFAULT 'member',
+		submitted_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createPendingMembersSQL); err != nil {
+		return err
+	}
+
+	// Quiet hours of notification integrations
+	createQuietHoursSQL := `CREATE TABLE IF NOT EXISTS quiet_hours (
+		integration TEXT PRIMARY KEY,
+		start_hour INTEGER NOT NULL,
+		end_hour INTEGER NOT NULL
+	);`
+
+	if _, err := db.Exec(createQuietHoursSQL); err != nil {
+		return err
+	}
+
+	// Members who opted out of being named in notifications
+	createNotificationOptOutsSQL := `CREATE TABLE IF NOT EXISTS notification_opt_outs (
+		member_id INTEGER PRIMARY KEY,
+		opted_out_at TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createNotificationOptOutsSQL); err != nil {
+		return err
+	}
+
+	// Consent acknowledgements and withdrawals, latest last (see consent.go)
+	createMemberConsentsSQL := `CREATE TABLE IF NOT EXISTS member_consents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		member_id INTEGER NOT NULL,
+		version TEXT NOT NULL,
+		method TEXT NOT NULL,
+		recorded_by TEXT NOT NULL,
+		withdrawn INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createMemberConsentsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_member_consents_member ON member_consents(member_id, id)`); err != nil {
+		return err
+	}
+
+	// Display aliases and visibility outside the admin view (see privacy.go)
+	createMemberPrivacySQL := `CREATE TABLE IF NOT EXISTS member_privacy (
+		member_id INTEGER PRIMARY KEY,
+		alias TEXT NOT NULL DEFAULT '',
+		visibility TEXT NOT NULL DEFAULT 'full',
+		updated_at TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createMemberPrivacySQL); err != nil {
+		return err
+	}
+
+	// Read-only tokens for display devices, stored hashed
+	createKioskTokensSQL := `CREATE TABLE IF NOT EXISTS kiosk_tokens (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		token_hash TEXT NOT NULL UNIQUE,
+		scope TEXT NOT NULL,
+		endpoints TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		last_used_at TEXT
+	);`
+
+	if _, err := db.Exec(createKioskTokensSQL); err != nil {
+		return err
+	}
+
+	// Requests per API key and endpoint, see apikeyusage.go
+	createAPIKeyUsageSQL := `CREATE TABLE IF NOT EXISTS api_key_usage (
+		key_id TEXT NOT NULL,
+		endpoint TEXT NOT NULL,
+		requests INTEGER NOT NULL,
+		last_used_at TEXT NOT NULL,
+		PRIMARY KEY(key_id, endpoint)
+	);`
+
+	if _, err := db.Exec(createAPIKeyUsageSQL); err != nil {
+		return err
+	}
+
+	// Notifications posted to webhooks and each attempt, see webhooks.go
+	createWebhookDeliveriesSQL := `CREATE TABLE IF NOT EXISTS webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		integration TEXT NOT NULL,
+		org TEXT NOT NULL,
+		webhook TEXT NOT NULL,
+		message TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createWebhookDeliveriesSQL); err != nil {
+		return err
+	}
+	if err := dropWebhookDeliveryURLs(); err != nil {
+		return err
+	}
+
+	createWebhookDeliveryAttemptsSQL := `CREATE TABLE IF NOT EXISTS webhook_delivery_attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		delivery_id INTEGER NOT NULL,
+		attempted_at TEXT NOT NULL,
+		response_code INTEGER NOT NULL,
+		error TEXT NOT NULL,
+		FOREIGN KEY(delivery_id) REFERENCES webhook_deliveries(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createWebhookDeliveryAttemptsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_webhook_delivery_attempts_delivery ON webhook_delivery_attempts(delivery_id)`); err != nil {
+		return err
+	}
+
+	// Phone keys for NFC check-ins, one per member, and outstanding challenges
+	createNFCKeysSQL := `CREATE TABLE IF NOT EXISTS nfc_keys (
+		member_id INTEGER PRIMARY KEY,
+		key_id TEXT NOT NULL UNIQUE,
+		secret TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		last_used_at TEXT,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createNFCKeysSQL); err != nil {
+		return err
+	}
+
+	createNFCChallengesSQL := `CREATE TABLE IF NOT EXISTS nfc_challenges (
+		challenge TEXT PRIMARY KEY,
+		expires_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createNFCChallengesSQL); err != nil {
+		return err
+	}
+
+	// Remote sign-ins awaiting confirmation, at most one per member
+	createPendingSignInsSQL := `CREATE TABLE IF NOT EXISTS pending_signins (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		member_id INTEGER NOT NULL UNIQUE,
+		room TEXT NOT NULL,
+		requested_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createPendingSignInsSQL); err != nil {
+		return err
+	}
+
+	// Projects members allocate session time to
+	createProjectsSQL := `CREATE TABLE IF NOT EXISTS projects (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		description TEXT NOT NULL DEFAULT '',
+		archived INTEGER NOT NULL DEFAULT 0,
+		created_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createProjectsSQL); err != nil {
+		return err
+	}
+
+	// Co-curricular record activity code of each project (see ccrexport.go)
+	if err := ensureColumn("projects", "ccr_code", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// Time of each visit allocated to projects
+	createSessionAllocationsSQL := `CREATE TABLE IF NOT EXISTS session_allocations (
+		visit_id INTEGER NOT NULL,
+		project_id INTEGER NOT NULL,
+		seconds INTEGER NOT NULL,
+		PRIMARY KEY (visit_id, project_id),
+		FOREIGN KEY(visit_id) REFERENCES visits(id) ON DELETE CASCADE,
+		FOREIGN KEY(project_id) REFERENCES projects(id)
+	);`
+
+	if _, err := db.Exec(createSessionAllocationsSQL); err != nil {
+		return err
+	}
+
+	// Per-organization settings (see orgsettings.go); empty greetings use the defaults
+	createOrgSettingsSQL := `CREATE TABLE IF NOT EXISTS org_settings (
+		org_id TEXT PRIMARY KEY,
+		welcome_message TEXT NOT NULL DEFAULT '',
+		goodbye_message TEXT NOT NULL DEFAULT '',
+		webhook_url TEXT NOT NULL DEFAULT '',
+		cleanup_hour INTEGER,
+		capacity INTEGER NOT NULL DEFAULT 0,
+		timezone TEXT NOT NULL DEFAULT '',
+		updated_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createOrgSettingsSQL); err != nil {
+		return err
+	}
+	// Report time zones were added after the org_settings table
+	if err := ensureColumn("org_settings", "timezone", `TEXT NOT NULL DEFAULT ''`); err != nil {
+		return err
+	}
+
+	// Last run of periodic maintenance tasks (see maintenance.go)
+	createMaintenanceRunsSQL := `CREATE TABLE IF NOT EXISTS maintenance_runs (
+		task TEXT PRIMARY KEY,
+		last_run_at TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createMaintenanceRunsSQL); err != nil {
+		return err
+	}
+
+	// Per-day segments of visits crossing midnight, for reports (see visitsegments.go)
+	createVisitSegmentsSQL := `CREATE TABLE IF NOT EXISTS visit_segments (
+		visit_id INTEGER NOT NULL,
+		start_time TEXT NOT NULL,
+		end_time TEXT NOT NULL,
+		PRIMARY KEY (visit_id, start_time),
+		FOREIGN KEY(visit_id) REFERENCES visits(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createVisitSegmentsSQL); err != nil {
+		return err
+	}
+
+	// Keys generated by the server, such as the anonymization key (see anonymizedexport.go)
+	createServerSecretsSQL := `CREATE TABLE IF NOT EXISTS server_secrets (
+		name TEXT PRIMARY KEY,
+		value TEXT NOT NULL
+	);`
+
+	if _, err := db.Exec(createServerSecretsSQL); err != nil {
+		return err
+	}
+
+	// Member photos, the images themselves are in the photo storage (see photos.go)
+	createMemberPhotosSQL := `CREATE TABLE IF NOT EXISTS member_photos (
+		member_id INTEGER PRIMARY KEY,
+		storage_key TEXT NOT NULL,
+		content_type TEXT NOT NULL,
+		size INTEGER NOT NULL,
+		width INTEGER NOT NULL,
+		height INTEGER NOT NULL,
+		sha256 TEXT NOT NULL,
+		uploaded_at TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createMemberPhotosSQL); err != nil {
+		return err
+	}
+
+	// Commands queued for scanners, see devicecommands.go
+	createDeviceCommandsSQL := `CREATE TABLE IF NOT EXISTS device_commands (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		device_id INTEGER NOT NULL,
+		command TEXT NOT NULL,
+		payload TEXT,
+		status TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		sent_at TEXT,
+		acked_at TEXT,
+		FOREIGN KEY(device_id) REFERENCES devices(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createDeviceCommandsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_device_commands_device ON device_commands(device_id, status)`); err != nil {
+		return err
+	}
+
+	// Who may unlock the door, when and where (see accessrules.go)
+	createAccessRulesSQL := `CREATE TABLE IF NOT EXISTS access_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		member_id INTEGER,
+		role TEXT NOT NULL DEFAULT '',
+		rooms TEXT NOT NULL DEFAULT '',
+		hours TEXT NOT NULL DEFAULT '',
+		created_at TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createAccessRulesSQL); err != nil {
+		return err
+	}
+
+	// Time-boxed door access (see accessgrants.go), times in UTC
+	createAccessGrantsSQL := `CREATE TABLE IF NOT EXISTS access_grants (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		member_id INTEGER NOT NULL,
+		reason TEXT NOT NULL,
+		rooms TEXT NOT NULL DEFAULT '',
+		starts_at TEXT NOT NULL,
+		ends_at TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_by TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
+	);`
+
+	if _, err := db.Exec(createAccessGrantsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`CREATE INDEX IF NOT EXISTS idx_access_grants_member ON access_grants(member_id, status)`); err != nil {
+		return err
 	}
 
-	// Enable foreign keys
-	if _, err = db.Exec(`PRAGMA foreign_keys = ON;`); err != nil {
+	// Destructive operations awaiting a second admin (see pendingops.go), times in UTC
+	createPendingOperationsSQL := `CREATE TABLE IF NOT EXISTS pending_operations (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		method TEXT NOT NULL,
+		path TEXT NOT NULL,
+		org_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		requested_by TEXT NOT NULL,
+		requested_at TEXT NOT NULL,
+		expires_at TEXT NOT NULL,
+		decided_by TEXT,
+		decided_at TEXT,
+		result_status INTEGER,
+		result TEXT
+	);`
+
+	if _, err := db.Exec(createPendingOperationsSQL); err != nil {
 		return err
 	}
 
-	// Create members table
-	createMembersSQL := `CREATE TABLE IF NOT EXISTS members (
+	// Sign-out-alls that can be undone and the visits they saved (see operations.go)
+	createBulkOperationsSQL := `CREATE TABLE IF NOT EXISTS bulk_operations (
 		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		name TEXT NOT NULL,
-		uid TEXT NOT NULL UNIQUE,
-		discord_id TEXT NOT NULL
+		kind TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		undone_at TEXT
+	);`
+	createBulkOperationVisitsSQL := `CREATE TABLE IF NOT EXISTS bulk_operation_visits (
+		operation_id INTEGER NOT NULL,
+		visit_id INTEGER NOT NULL,
+		member_id INTEGER NOT NULL,
+		room TEXT NOT NULL,
+		signin_time TEXT NOT NULL,
+		FOREIGN KEY(operation_id) REFERENCES bulk_operations(id) ON DELETE CASCADE,
+		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
 	);`
 
-	if _, err = db.Exec(createMembersSQL); err != nil {
+	if _, err := db.Exec(createBulkOperationsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createBulkOperationVisitsSQL); err != nil {
 		return err
 	}
 
-	// Create visits table referencing members
-	createVisitsSQL := `CREATE TABLE IF NOT EXISTS visits (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
+	// Visits of trashed members and their project time (see trash.go)
+	createTrashedVisitsSQL := `CREATE TABLE IF NOT EXISTS trashed_visits (
+		id INTEGER PRIMARY KEY,
 		member_id INTEGER NOT NULL,
 		signin_time TEXT NOT NULL,
 		signout_time TEXT NOT NULL,
 		FOREIGN KEY(member_id) REFERENCES members(id) ON DELETE CASCADE
 	);`
+	createTrashedAllocationsSQL := `CREATE TABLE IF NOT EXISTS trashed_session_allocations (
+		visit_id INTEGER NOT NULL,
+		project_id INTEGER NOT NULL,
+		seconds INTEGER NOT NULL,
+		PRIMARY KEY (visit_id, project_id),
+		FOREIGN KEY(visit_id) REFERENCES trashed_visits(id) ON DELETE CASCADE
+	);`
 
-	if _, err = db.Exec(createVisitsSQL); err != nil {
+	if _, err := db.Exec(createTrashedVisitsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createTrashedAllocationsSQL); err != nil {
+		return err
+	}
+
+	// Corrections of completed sessions, which are append-only (see sessionamendments.go)
+	createVisitAmendmentsSQL := `CREATE TABLE IF NOT EXISTS visit_amendments (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		visit_id INTEGER NOT NULL,
+		signin_time TEXT NOT NULL,
+		signout_time TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		amended_by TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY(visit_id) REFERENCES visits(id) ON DELETE CASCADE
+	);`
+	createVisitAmendmentSegmentsSQL := `CREATE TABLE IF NOT EXISTS visit_amendment_segments (
+		amendment_id INTEGER NOT NULL,
+		start_time TEXT NOT NULL,
+		end_time TEXT NOT NULL,
+		PRIMARY KEY (amendment_id, start_time),
+		FOREIGN KEY(amendment_id) REFERENCES visit_amendments(id) ON DELETE CASCADE
+	);`
+	createTrashedAmendmentsSQL := `CREATE TABLE IF NOT EXISTS trashed_visit_amendments (
+		id INTEGER PRIMARY KEY,
+		visit_id INTEGER NOT NULL,
+		signin_time TEXT NOT NULL,
+		signout_time TEXT NOT NULL,
+		reason TEXT NOT NULL,
+		amended_by TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		FOREIGN KEY(visit_id) REFERENCES trashed_visits(id) ON DELETE CASCADE
+	);`
+	createVisitsAppendOnlySQL := `CREATE TRIGGER IF NOT EXISTS visits_append_only BEFORE UPDATE OF signin_time, signout_time ON visits BEGIN
+		SELECT RAISE(ABORT, 'completed sessions are append-only; record an amendment instead');
+	END;`
+	createAmendmentsAppendOnlySQL := `CREATE TRIGGER IF NOT EXISTS visit_amendments_append_only BEFORE UPDATE ON visit_amendments BEGIN
+		SELECT RAISE(ABORT, 'amendments are append-only; record another amendment instead');
+	END;`
+
+	if _, err := db.Exec(createVisitAmendmentsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createVisitAmendmentSegmentsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createTrashedAmendmentsSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createVisitsAppendOnlySQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createAmendmentsAppendOnlySQL); err != nil {
+		return err
+	}
+
+	// Hash chain over changes to the sessions, appended by the server (see sessionledger.go)
+	createSessionLedgerSQL := `CREATE TABLE IF NOT EXISTS session_ledger (
+		seq INTEGER PRIMARY KEY AUTOINCREMENT,
+		kind TEXT NOT NULL,
+		record_id INTEGER NOT NULL,
+		payload TEXT NOT NULL,
+		created_at TEXT NOT NULL,
+		hash TEXT
+	);`
+	createSessionLedgerAppendOnlySQL := `CREATE TRIGGER IF NOT EXISTS session_ledger_append_only BEFORE UPDATE ON session_ledger WHEN OLD.hash IS NOT NULL BEGIN
+		SELECT RAISE(ABORT, 'the session ledger is append-only');
+	END;`
+	createSessionLedgerNoDeleteSQL := `CREATE TRIGGER IF NOT EXISTS session_ledger_no_delete BEFORE DELETE ON session_ledger BEGIN
+		SELECT RAISE(ABORT, 'the session ledger is append-only');
+	END;`
+
+	if _, err := db.Exec(createSessionLedgerSQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createSessionLedgerAppendOnlySQL); err != nil {
+		return err
+	}
+	if _, err := db.Exec(createSessionLedgerNoDeleteSQL); err != nil {
+		return err
+	}
+
+	// Full-text indexes for /search
+	if err := createSearchIndex(); err != nil {
 		return err
 	}
 
 	return nil
 }
 
+// ensureColumn adds a column to an existing table if it is missing
+func ensureColumn(table, column, definition string) error {
+	found, err := hasColumn(table, column)
+	if err != nil || found {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE ` + table + ` ADD COLUMN ` + column + ` ` + definition)
+	return err
+}
+
+// hasColumn reports whether a table has a column
+func hasColumn(table, column string) (bool, error) {
+	rows, err := db.Query(`PRAGMA table_info(` + table + `)`)
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cid, notNull, pk int
+		var name, colType string
+		var dflt sql.NullString
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dflt, &pk); err != nil {
+			return false, err
+		}
+		if name == column {
+			return true, nil
+		}
+	}
+	return false, rows.Err()
+}
+
+// normalizeRole validates a member role, defaulting empty roles to member
+func normalizeRole(role string) (string, bool) {
+	switch role = strings.ToLower(strings.TrimSpace(role)); role {
+	case "":
+		return roleMember, true
+	case roleMember, roleExec, roleOfficer, roleGuest:
+		return role, true
+	}
+	return "", false
+}
+
+// insertVisit inserts a completed visit, recording it in the session ledger
+// when that is on, and returns its ID
+func insertVisit(memberID int64, signin time.Time, signout time.Time) (int64, error) {
+	if sessionLedgerKey == nil {
+		res, err := execStmt(queryInsertVisit, memberID, signin.Format(time.RFC3339), signout.Format(time.RFC3339))
+		if err != nil {
+			return 0, err
+		}
+		return res.LastInsertId()
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(queryInsertVisit, memberID, signin.Format(time.RFC3339), signout.Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	id, _ := res.LastInsertId()
+	if err := appendLedgerEntries(tx, "visit.saved", "id = ?", id); err != nil {
+		return 0, err
+	}
+	return id, tx.Commit()
+}
+
 // saveVisitToDB saves a completed visit to the database using member_id
 func saveVisitToDB(memberID int64, signin time.Time, signout time.Time) error {
-	insertSQL := `INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`
-	_, err := db.Exec(insertSQL, memberID, signin.Format(time.RFC3339), signout.Format(time.RFC3339))
+	_, err := saveVisit(memberID, signin, signout)
 	return err
 }
 
+// saveVisit saves a completed visit like saveVisitToDB and returns its ID
+func saveVisit(memberID int64, signin time.Time, signout time.Time) (int64, error) {
+	id, err := insertVisit(memberID, signin, signout)
+	if err != nil {
+		return 0, err
+	}
+	if !splitSessionsAtMidnight() {
+		return id, nil
+	}
+
+	// The visit is saved either way; a backfill can split it later
+	if _, err := saveVisitSegments(db, id, signin, signout); err != nil {
+		logStore.warnf("Warning: splitting visit %d at midnight failed: %v", id, err)
+	}
+	return id, nil
+}
+
 // loadVisitsFromDB retrieves visits from the database with optional filtering
+// org: organization of the members
 // from: RFC3339 formatted start date (inclusive)
 // to: RFC3339 formatted end date (inclusive)
 // memberID: filter by specific member ID (0 means no filter)
 // limit: maximum number of records to return (0 means no limit)
-func loadVisitsFromDB(from, to string, memberID int64, limit int) ([]Visit, error) {
+// times: sessionTimesCorrected or sessionTimesRaw
+func loadVisitsFromDB(org, from, to string, memberID int64, limit int, times string) ([]Visit, error) {
+	// Looked up before the query, whose rows hold a connection until closed
+	loc := reportLocation(defaultOrg)
+
 	query := `
-		SELECT m.name, v.signin_time, v.signout_time
-		FROM visits v
+		SELECT v.id, v.member_id, m.name, v.signin_time, v.signout_time
+		FROM ` + reportedVisits(times) + ` v
 		JOIN members m ON m.id = v.member_id`
 
-	var conditions []string
-	var args []interface{}
+	conditions := []string{"m.org_id = ?"}
+	args := []interface{}{org}
 
 	// Add date range filters if provided
 	if from != "" {
@@ -231,11 +1068,7 @@ func loadVisitsFromDB(from, to string, memberID int64, limit int) ([]Visit, erro
 		args = append(args, memberID)
 	}
 
-	// Build WHERE clause if we have conditions
-	if len(conditions) > 0 {
-		query += " WHERE " + strings.Join(conditions, " AND ")
-	}
-
+	query += " WHERE " + strings.Join(conditions, " AND ")
 	query += " ORDER BY v.signin_time DESC"
 
 	// Add limit if specified
@@ -253,7 +1086,7 @@ func loadVisitsFromDB(from, to string, memberID int64, limit int) ([]Visit, erro
 	for rows.Next() {
 		var s Visit
 		var signinTime, signoutTime string
-		err := rows.Scan(&s.Name, &signinTime, &signoutTime)
+		err := rows.Scan(&s.ID, &s.memberID, &s.Name, &signinTime, &signoutTime)
 		if err != nil {
 			return nil, err
 		}
@@ -265,6 +1098,7 @@ func loadVisitsFromDB(from, to string, memberID int64, limit int) ([]Visit, erro
 		if err != nil {
 			return nil, err
 		}
+		s.AfterHours = officeHours.afterHours(s.SignInTime, s.SignOutTime, loc)
 		visits = append(visits, s)
 	}
 	return visits, rows.Err()
@@ -284,8 +1118,9 @@ func loadAPIKeys() map[string]bool {
 
 	// Load comma-separated list of API keys from API_KEYS environment variable
 	if apiKeys := os.Getenv("API_KEYS"); apiKeys != "" {
-		for _, key := range strings.Split(apiKeys, ",") {
-			key = strings.TrimSpace(key)
+		for _, entry := range strings.Split(apiKeys, ",") {
+			// Entries may carry a scope suffix (key:scope), see loadAPIKeyScopes
+			key, _, _ := parseAPIKeyEntry(entry)
 			if key != "" {
 				keys[key] = true
 			}
@@ -295,25 +1130,38 @@ func loadAPIKeys() map[string]bool {
 	return keys
 }
 
+// attendeesFileMu serializes writes of the current attendees file
+var attendeesFileMu sync.Mutex
+
 // saveCurrentAttendees saves the current attendees map to a JSON file
 func saveCurrentAttendees() error {
-	// Snapshot under read lock to avoid holding lock during I/O
-	mu.RLock()
-	copyMap := make(map[string]time.Time, len(currentAttendees))
-	for k, v := range currentAttendees {
-		copyMap[k] = v
+	if !attendeesInFile() {
+		return nil // Shared storage persists the state itself
 	}
-	mu.RUnlock()
 
-	data, err := json.MarshalIndent(copyMap, "", "  ")
+	attendeesFileMu.Lock()
+	defer attendeesFileMu.Unlock()
+
+	// Snapshot to avoid holding the store lock during I/O
+	data, err := json.MarshalIndent(currentAttendees.snapshot(), "", "  ")
 	if err != nil {
 		return err
 	}
 	return os.WriteFile(currentAttendeesFilePath, data, 0644)
 }
 
+// saveCurrentAttendeesInBackground saves the current attendees file on the worker pool.
+// The snapshot is taken when the job runs, so the latest state is always written last.
+func saveCurrentAttendeesInBackground() {
+	jobs.submit("save-current-attendees", saveCurrentAttendees)
+}
+
 // loadCurrentAttendees loads the current attendees from a JSON file
 func loadCurrentAttendees() error {
+	if !attendeesInFile() {
+		return nil // Other instances may have changed the shared state since
+	}
+
 	file, err := os.Open(currentAttendeesFilePath)
 	if err != nil {
 		if os.IsNotExist(err) {
@@ -332,131 +1180,304 @@ func loadCurrentAttendees() error {
 	if err := json.Unmarshal(bytes, &loaded); err != nil {
 		return err
 	}
-	mu.Lock()
-	currentAttendees = loaded
-	mu.Unlock()
+	currentAttendees.replace(loaded)
 	return nil
 }
 
-// loadMembersIntoCache populates userDB from the members table
+// loadMembersIntoCache populates memberCache from the members table. UIDs of
+// members merged into another member resolve to the surviving member.
 func loadMembersIntoCache() error {
-	rows, err := db.Query(`SELECT id, name, uid, discord_id FROM members`)
+	rows, err := db.Query(`SELECT id, name, uid, discord_id, role, status, org_id FROM members WHERE deleted_at IS NULL`)
 	if err != nil {
 		return err
 	}
 	defer rows.Close()
 
 	cache := make(map[string]Member)
+	byID := make(map[int64]Member)
 	for rows.Next() {
 		var m Member
-		if err := rows.Scan(&m.ID, &m.Name, &m.UID, &m.DiscordID); err != nil {
+		if err := rows.Scan(&m.ID, &m.Name, &m.UID, decrypted{&m.DiscordID}, &m.Role, &m.Status, &m.OrgID); err != nil {
 			return err
 		}
 		cache[m.UID] = m
+		byID[m.ID] = m
 	}
 	if err := rows.Err(); err != nil {
 		return err
 	}
+	rows.Close()
+
+	merged, err := db.Query(`SELECT uid, merged_into FROM members WHERE deleted_at IS NOT NULL AND merged_into IS NOT NULL`)
+	if err != nil {
+		return err
+	}
+	defer merged.Close()
+
+	for merged.Next() {
+		var uid string
+		var into int64
+		if err := merged.Scan(&uid, &into); err != nil {
+			return err
+		}
+		if m, ok := byID[into]; ok {
+			cache[uid] = m
+		}
+	}
+	if err := merged.Err(); err != nil {
+		return err
+	}
 
-	mu.Lock()
-	userDB = cache
-	mu.Unlock()
+	memberCache.replace(cache)
 	return nil
 }
 
+// parseIDPath extracts the numeric ID and any trailing sub-path from a URL path
+// such as /devices/12/certificate (prefix "/devices/" yields 12 and "certificate")
+func parseIDPath(path, prefix string) (int64, string, bool) {
+	rest := strings.TrimPrefix(path, prefix)
+	if rest == "" || rest == path {
+		return 0, "", false
+	}
+
+	idStr, sub, _ := strings.Cut(rest, "/")
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id < 1 {
+		return 0, "", false
+	}
+	return id, sub, true
+}
+
+// findMemberByDiscordID looks up a cached member of an organization by their
+// linked Discord ID; the same account may belong to members of several organizations
+func findMemberByDiscordID(discordID, org string) (Member, bool) {
+	if discordID == "" {
+		return Member{}, false
+	}
+	return memberCache.findByDiscordID(discordID, org)
+}
+
+// findMemberByID looks up a cached member by their database ID
+func findMemberByID(id int64) (Member, bool) {
+	return memberCache.findByID(id)
+}
+
 // recordScanEvent appends a scan to history while keeping only the last 10 entries
 func recordScanEvent(uid string, t time.Time) {
-	mu.Lock()
-	scanHistory = append(scanHistory, ScanEvent{UID: uid, Time: t})
-	if len(scanHistory) > 10 {
-		scanHistory = scanHistory[len(scanHistory)-10:]
-	}
-	mu.Unlock()
+	scanHistory.record(uid, t)
 }
 
-// performSignIn signs in a member and returns message
-func performSignIn(member Member) (string, error) {
-	mu.Lock()
-	currentAttendees[member.UID] = time.Now()
-	mu.Unlock()
+var (
+	// errAlreadySignedIn is returned by performSignIn for a member already inside
+	errAlreadySignedIn = errors.New("member already signed in")
 
-	if err := saveCurrentAttendees(); err != nil {
-		return "", err
-	}
+	// errNotSignedIn is returned by performSignOut for a member not inside
+	errNotSignedIn = errors.New("member not signed in")
+
+	// errAttendeeStore wraps a failure of the current attendees store (e.g.
+	// Redis unreachable) in performSignIn and performSignOut
+	errAttendeeStore = errors.New("attendee store unavailable")
+)
+
+// performSignIn signs in a member at a room (defaultRoom if empty) and returns message.
+// It fails with errAlreadySignedIn if the member is already inside and with
+// errAtCapacity if their organization's capacity is reached.
+func performSignIn(ctx context.Context, member Member, room string) (string, error) {
+	return performSignInAt(ctx, member, room, time.Now())
+}
 
-	msg := fmt.Sprintf("Welcome, %s!", member.Name)
+// performSignInAt is performSignIn with the session starting at signInTime
+// (used for remote sign-ins confirmed later, see remotesignin.go)
+func performSignInAt(ctx context.Context, member Member, room string, signInTime time.Time) (string, error) {
+	if room == "" {
+		room = defaultRoom
+	}
+
+	settings := settingsOf(memberOrg(member))
+
+	// Includes waiting for officeMu behind other scans
+	_, span := startSpan(ctx, "attendees.sign_in", spanKindInternal)
+	span.setAttr("member.id", member.ID)
+	span.setAttr("attendees.store", attendeeStoreKind())
+	// The store checks capacity and signs in atomically, also across replicas
+	officeMu.Lock()
+	result, wasEmpty, err := currentAttendees.signInWithin(member.UID, room, signInTime, memberOrg(member), settings.Capacity)
+	officeMu.Unlock()
+	signedIn := err == nil && result == signInAccepted
+	opened := signedIn && wasEmpty
+	span.setAttr("attendees.signed_in", signedIn)
+	switch {
+	case err != nil:
+		span.finish(err)
+		return "", fmt.Errorf("%w: %v", errAttendeeStore, err)
+	case result == signInAtCapacity:
+		span.finish(errAtCapacity)
+		return "", errAtCapacity
+	}
+	span.finish(nil)
+	if !signedIn {
+		return "", errAlreadySignedIn
+	}
+
+	saveCurrentAttendeesInBackground()
+
+	msg := settings.welcome(member.Name)
+	events.publish(Event{Kind: eventSignIn, Time: signInTime, Member: member, Room: room, Message: msg, Trace: spanContextFrom(ctx)})
+	if opened {
+		publishOfficeOpened(ctx, member, signInTime)
+	}
 	return msg, nil
 }
 
-// performSignOut signs out a member and returns message
-func performSignOut(member Member, signInTime time.Time) (string, error) {
-	mu.Lock()
-	delete(currentAttendees, member.UID)
-	mu.Unlock()
+// performSignOut signs out a member and returns message.
+// It fails with errNotSignedIn if the member is not inside.
+func performSignOut(ctx context.Context, member Member) (string, error) {
+	_, span := startSpan(ctx, "attendees.sign_out", spanKindInternal)
+	span.setAttr("member.id", member.ID)
+	span.setAttr("attendees.store", attendeeStoreKind())
+	officeMu.Lock()
+	signInTime, isInside, err := currentAttendees.signOutIfPresent(member.UID)
+	closed := isInside && currentAttendees.count() == 0
+	officeMu.Unlock()
+	span.setAttr("attendees.signed_out", isInside)
+	span.finish(err)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", errAttendeeStore, err)
+	}
+	if !isInside {
+		return "", errNotSignedIn
+	}
 
 	signOutTime := time.Now()
-	if err := saveVisitToDB(member.ID, signInTime, signOutTime); err != nil {
+	_, span = startSpan(ctx, "db.save_visit", spanKindClient)
+	span.setAttr("db.system", "sqlite")
+	err = saveVisitToDB(member.ID, signInTime, signOutTime)
+	span.finish(err)
+	if err != nil {
 		return "", err
 	}
 
-	if err := saveCurrentAttendees(); err != nil {
-		return "", err
-	}
+	saveCurrentAttendeesInBackground()
 
 	duration := signOutTime.Sub(signInTime)
-	msg := fmt.Sprintf("Goodbye, %s! Duration: %s", member.Name, duration.Round(time.Second))
+	msg := fmt.Sprintf("%s Duration: %s", settingsOf(memberOrg(member)).goodbye(member.Name), duration.Round(time.Second))
+	events.publish(Event{Kind: eventSignOut, Time: signOutTime, Member: member, SignInTime: signInTime, Message: msg, Trace: spanContextFrom(ctx)})
+	if closed {
+		publishOfficeClosed(ctx, member, "", signOutTime)
+	}
 	return msg, nil
 }
 
+// writeSignInOutError responds to a failed performSignIn or performSignOut
+func writeSignInOutError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errAlreadySignedIn):
+		http.Error(w, "Member already signed in", http.StatusConflict)
+	case errors.Is(err, errNotSignedIn):
+		http.Error(w, "Member not signed in", http.StatusConflict)
+	case errors.Is(err, errAtCapacity):
+		http.Error(w, "Organization is at capacity", http.StatusConflict)
+	case errors.Is(err, errAttendeeStore):
+		log.Printf("Error updating current attendees: %v", err)
+		http.Error(w, "Attendee store unavailable, try again", http.StatusServiceUnavailable)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// nextNightlyCleanup returns the first nightly cleanup time after now
+func nextNightlyCleanup(now time.Time) time.Time {
+	next := time.Date(now.Year(), now.Month(), now.Day(), nightlyCleanupHour, 0, 0, 0, now.Location())
+	if !next.After(now) {
+		next = next.AddDate(0, 0, 1)
+	}
+	return next
+}
+
 // startNightlyCleanup runs a goroutine that forces sign-out of all attendees at 4:00 AM daily
 func startNightlyCleanup() {
 	for {
 		now := time.Now()
-		// Calculate duration until next 4:00 AM
-		next := time.Date(now.Year(), now.Month(), now.Day(), 4, 0, 0, 0, now.Location())
-		if next.Before(now) {
-			next = next.Add(24 * time.Hour)
-		}
-		timer := time.NewTimer(next.Sub(now))
+		timer := time.NewTimer(nextNightlyCleanup(now).Sub(now))
 
 		<-timer.C
 
-		// Copy and clear under lock, then persist outside
-		mu.Lock()
-		cnt := len(currentAttendees)
-		toSignOut := make(map[string]time.Time, cnt)
-		for uid, signin := range currentAttendees {
-			toSignOut[uid] = signin
-		}
-		currentAttendees = make(map[string]time.Time)
-		mu.Unlock()
-
-		if cnt > 0 {
-			log.Printf("Nightly Cleanup: Force signing out %d people", cnt)
-			for uid, signin := range toSignOut {
-				mu.RLock()
-				member, ok := userDB[uid]
-				mu.RUnlock()
-				if !ok {
-					log.Printf("Nightly Cleanup: skipping unknown UID %s in current attendees", uid)
-					continue
-				}
-
-				if err := saveVisitToDB(member.ID, signin, time.Now()); err != nil {
-					log.Printf("Nightly Cleanup: failed to save visit for UID %s: %v", uid, err)
-				}
-
-				// Save the cleared currentAttendees to file
-				if err := saveCurrentAttendees(); err != nil {
-					log.Printf("Nightly Cleanup: failed to save current attendees: %v", err)
-				}
-			}
+		if cnt := signOutAll("the nightly cleanup"); cnt > 0 {
+			log.Printf("Nightly Cleanup: Force signed out %d people", cnt)
 		} else {
 			log.Println("Nightly Cleanup: No attendees to sign out")
 		}
 	}
 }
 
+// signOutAll signs out everyone currently inside, saving their visits, and
+// returns how many were signed out. by describes who did it for event messages.
+func signOutAll(by string) int {
+	count, _ := signOutEveryone(by)
+	return count
+}
+
+// signOutEveryone signs out everyone like signOutAll, also returning the
+// visits saved for them with the rooms they were in
+func signOutEveryone(by string) (int, []signedOutVisit) {
+	officeMu.Lock()
+	inside := currentAttendees.list()
+	toSignOut := currentAttendees.clear()
+	officeMu.Unlock()
+
+	// Persist cleared state
+	if err := saveCurrentAttendees(); err != nil {
+		logStore.errorf("Sign-out-all: failed to save current attendees: %v", err)
+	}
+
+	rooms := make(map[string]string, len(inside))
+	for _, a := range inside {
+		rooms[a.UID] = a.Room
+	}
+	saved := saveSignedOut(toSignOut, by)
+	for i := range saved {
+		saved[i].Room = rooms[saved[i].UID]
+	}
+	if len(toSignOut) > 0 {
+		publishOfficeClosed(context.Background(), Member{}, by, time.Now())
+	}
+	return len(toSignOut), saved
+}
+
+// signedOutVisit is the visit saved for a member signed out at once with others
+type signedOutVisit struct {
+	UID        string
+	MemberID   int64
+	Room       string
+	SignInTime time.Time
+	VisitID    int64
+}
+
+// saveSignedOut saves the visits of members signed out at once by by, keyed
+// by UID with their sign-in times, publishes their sign-outs and returns the
+// visits saved
+func saveSignedOut(toSignOut map[string]time.Time, by string) []signedOutVisit {
+	var saved []signedOutVisit
+	for uid, signinTime := range toSignOut {
+		member, ok := memberCache.get(uid)
+		if !ok {
+			logStore.warnf("Sign-out-all: skipping unknown UID %s in current attendees", uid)
+			continue
+		}
+
+		signOutTime := time.Now()
+		visitID, err := saveVisit(member.ID, signinTime, signOutTime)
+		if err != nil {
+			logStore.errorf("Sign-out-all: failed to save visit for UID %s: %v", uid, err)
+			continue
+		}
+		saved = append(saved, signedOutVisit{UID: uid, MemberID: member.ID, SignInTime: signinTime, VisitID: visitID})
+		events.publish(Event{Kind: eventSignOut, Time: signOutTime, Member: member, SignInTime: signinTime,
+			Message: fmt.Sprintf("%s was signed out by %s", member.Name, by)})
+	}
+	return saved
+}
+
 // --- Handlers ---
 
 // /scan endpoint
@@ -465,78 +1486,160 @@ func startNightlyCleanup() {
 // handleScan processes the RFID tap
 func handleScan(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodPost)
 		return
 	}
 
 	var req ScanRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if err := decodeDeviceBody(r, &req); err != nil {
+		http.Error(w, invalidBodyMessage(r), http.StatusBadRequest)
+		return
+	}
+
+	// Answer at once and process in the background (see scanasync.go)
+	if r.URL.Query().Get("async") == "true" {
+		acceptAsyncScan(w, scanFromRequest(r, req))
+		return
+	}
+	processScan(w, scanFromRequest(r, req))
+}
+
+// processScan runs a scan through the pipeline and signs the member in or out
+// (also used by /checkin/nfc, see nfc.go)
+func processScan(w http.ResponseWriter, sc *ScanContext) {
+	ctx := sc.Request.Context()
+
+	// Identify the device and normalize the UID (see scanpipeline.go)
+	if err := runScanHooks(scanStagePreValidate, sc); err != nil {
+		writeScanError(w, scanStagePreValidate, err)
 		return
 	}
 
 	// Record scan event before processing sign-in/out
-	eventTime := time.Now()
-	recordScanEvent(req.UID, eventTime)
-
-	// Identify the Member (read lock)
-	mu.RLock()
-	member, exists := userDB[req.UID]
-	mu.RUnlock()
-	if !exists {
-		log.Printf("Unknown tag scanned: %s", req.UID)
+	recordScanEvent(sc.UID, sc.Time)
+
+	// Identify the Member; cards of other organizations are unknown to this scanner
+	_, span := startSpan(ctx, "members.lookup", spanKindInternal)
+	span.setAttr("members.stateless", statelessMode)
+	member, exists := memberCache.get(sc.UID)
+	span.setAttr("members.found", exists)
+	span.finish(nil)
+	if !exists || !inRequestOrg(sc.Request, member) {
+		logHTTP.infof("Unknown tag scanned: %s", sc.UID)
 		http.Error(w, "Unknown UID", http.StatusForbidden)
 		return
 	}
 
 	// Check Logic: Are they logging IN or OUT?
-	mu.RLock()
-	signInTime, isInside := currentAttendees[req.UID]
-	mu.RUnlock()
+	// (member.UID differs from sc.UID for cards of merged members)
+	signInTime, isInside, err := currentAttendees.get(member.UID)
+	if err != nil {
+		writeSignInOutError(w, fmt.Errorf("%w: %v", errAttendeeStore, err))
+		return
+	}
+	sc.Member, sc.SigningIn, sc.SignInTime = member, !isInside, signInTime
+
+	if err := runScanHooks(scanStageValidate, sc); err != nil {
+		writeScanError(w, scanStageValidate, err)
+		return
+	}
+
 	if isInside {
 		// --- LOGOUT LOGIC ---
-		msg, err := performSignOut(member, signInTime)
+		// A concurrent scan of the same card may have won the race since the check
+		msg, err := performSignOut(ctx, member)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeSignInOutError(w, err)
 			return
 		}
-		log.Println(msg)
-		json.NewEncoder(w).Encode(map[string]string{"message": msg, "status": "out"})
+		sc.Message = msg
+		logHTTP.infof("%s", msg)
+		runPostScanHooks(scanStagePostSignOut, sc)
+		writeScanResponse(w, sc, "out")
 
 	} else {
 		// --- LOGIN LOGIC ---
-		msg, err := performSignIn(member)
+		msg, err := performSignIn(ctx, member, sc.Room)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+			writeSignInOutError(w, err)
 			return
 		}
-		log.Println(msg)
-		json.NewEncoder(w).Encode(map[string]string{"message": msg, "status": "in"})
+		sc.Message = msg
+		logHTTP.infof("%s", msg)
+		runPostScanHooks(scanStagePostSignIn, sc)
+		writeScanResponse(w, sc, "in")
 	}
 }
 
+// writeScanResponse writes the result of a scan, with the speaker greeting if any,
+// as JSON or the binary format the scanner accepts (see binaryformats.go and scannerproto.go)
+func writeScanResponse(w http.ResponseWriter, sc *ScanContext, status string) {
+	writeNegotiated(w, sc.Request, http.StatusOK, ScanResponse{Status: status, Message: sc.Message, Announcement: sc.Announcement})
+}
+
 // /current endpoint
 // Returns list of current attendees
 
 // handleCurrent returns a list of who is currently inside, sorted by sign-in time (oldest first)
+// Query parameters:
+//   - view: public (count only), member (initials, masked UID) or admin (names, UID and
+//     Discord ID), limited by the key's scope
 func handleCurrent(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
+	view, ok := resolveView(w, r)
+	if !ok {
+		return
+	}
+
+	org := requestOrg(r)
+	resp, err := renderedResponses.render("current:"+org+":"+view, time.Now(), func() (any, error) {
+		return currentAttendeesOf(org, view, time.Now()), nil
+	})
+	if err != nil {
+		log.Printf("Error rendering current attendees: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp.body)
+}
+
+// currentAttendeesOf returns the /current response of an organization in a
+// view: the attendees sorted by sign-in time, or only their count
+func currentAttendeesOf(org, view string, now time.Time) any {
+	autoSignOut := nextCleanup(settingsOf(org), now)
+	loc := reportLocation(defaultOrg)
 	activeList := make([]ActiveAttendee, 0)
-	for uid, signinTime := range currentAttendees {
-		activeList = append(activeList, ActiveAttendee{
-			Name:       userDB[uid].Name,
-			SignInTime: signinTime,
-		})
+	for _, a := range currentAttendees.list() {
+		member, _ := memberCache.get(a.UID)
+		if memberOrg(member) != org {
+			continue
+		}
+		attendee := ActiveAttendee{
+			Name:            publicName(member, view),
+			SignInTime:      a.SignInTime,
+			DurationSeconds: int64(now.Sub(a.SignInTime).Seconds()),
+			AutoSignOutAt:   autoSignOut,
+			MemberID:        member.ID,
+			UID:             maskUID(member.UID),
+			AfterHours:      officeHours.afterHours(a.SignInTime, now, loc),
+		}
+		if view == scopeAdmin {
+			attendee.UID = member.UID
+			attendee.DiscordID = member.DiscordID
+		}
+		activeList = append(activeList, attendee)
+	}
+
+	if view == scopePublic {
+		return map[string]int{"count": len(activeList)}
 	}
-	mu.RUnlock()
 
 	// Sort by sign-in time (oldest first)
 	sort.Slice(activeList, func(i, j int) bool {
 		return activeList[i].SignInTime.Before(activeList[j].SignInTime)
 	})
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(activeList)
+	return activeList
 }
 
 // /visits endpoint
@@ -548,6 +1651,8 @@ func handleCurrent(w http.ResponseWriter, r *http.Request) {
 //   - to: RFC3339 formatted end date (e.g., 2024-12-31T23:59:59Z)
 //   - member_id: filter by specific member ID (e.g., 123)
 //   - limit: maximum number of records to return (e.g., 100)
+//   - view: public (count only), member (initials) or admin (names), limited by the key's scope
+//   - times: corrected (default) or raw, for sessions that were amended
 //
 // Query parameters for DELETE:
 //   - from: RFC3339 formatted start date (e.g., 2024-01-01T00:00:00Z)
@@ -597,12 +1702,31 @@ func handleVisits(w http.ResponseWriter, r *http.Request) {
 			}
 		}
 
-		visits, err := loadVisitsFromDB(from, to, memberID, limit)
+		view, ok := resolveView(w, r)
+		if !ok {
+			return
+		}
+		times, ok := parseSessionTimes(w, r)
+		if !ok {
+			return
+		}
+
+		visits, err := loadVisitsFromDB(requestOrg(r), from, to, memberID, limit, times)
 		if err != nil {
 			log.Printf("Error loading visits from database: %v", err)
 			http.Error(w, "Error loading visits", http.StatusInternalServerError)
 			return
 		}
+		setSessionLedgerHead(w)
+
+		if view == scopePublic {
+			writeCountOnly(w, len(visits))
+			return
+		}
+		names := publicNames{}
+		for i := range visits {
+			visits[i].Name = names.of(Member{ID: visits[i].memberID, Name: visits[i].Name}, view)
+		}
 
 		// Check if CSV format is requested
 		if format == "csv" {
@@ -646,10 +1770,10 @@ func handleVisits(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		// Build DELETE query with conditions
+		// Build DELETE query with conditions, limited to the caller's organization
 		query := "DELETE FROM visits"
-		var conditions []string
-		var args []interface{}
+		conditions := []string{"member_id IN (SELECT id FROM members WHERE org_id = ?)"}
+		args := []interface{}{requestOrg(r)}
 
 		if from != "" {
 			conditions = append(conditions, "signin_time >= ?")
@@ -664,12 +1788,26 @@ func handleVisits(w http.ResponseWriter, r *http.Request) {
 			args = append(args, memberID)
 		}
 
-		if len(conditions) > 0 {
-			query += " WHERE " + strings.Join(conditions, " AND ")
-		}
+		where := strings.Join(conditions, " AND ")
+		query += " WHERE " + where
 
-		// Execute deletion
-		result, err := db.Exec(query, args...)
+		// Execute deletion, recorded in the session ledger
+		tx, err := db.Begin()
+		if err != nil {
+			log.Printf("Error deleting visits: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		defer tx.Rollback()
+		if err := appendVisitDeletions(tx, where, args...); err != nil {
+			log.Printf("Error recording deleted visits in the session ledger: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		result, err := tx.Exec(query, args...)
+		if err == nil {
+			err = tx.Commit()
+		}
 		if err != nil {
 			log.Printf("Error deleting visits: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -686,23 +1824,20 @@ func handleVisits(w http.ResponseWriter, r *http.Request) {
 		})
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
 	}
 }
 
 // handleScanHistory returns the most recent 10 scan events (newest first)
 func handleScanHistory(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodGet)
 		return
 	}
 
-	mu.RLock()
-	history := make([]ScanEvent, len(scanHistory))
-	copy(history, scanHistory)
-	mu.RUnlock()
+	history := scanHistory.list()
 
-	// Reverse to return newest first without mutating shared slice
+	// Reverse to return newest first
 	for i, j := 0, len(history)-1; i < j; i, j = i+1, j-1 {
 		history[i], history[j] = history[j], history[i]
 	}
@@ -711,10 +1846,51 @@ func handleScanHistory(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(history)
 }
 
-// handleMember handles updating or deleting a single member by ID (PUT/DELETE)
-func handleMember(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPut && r.Method != http.MethodDelete {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+// handleMember handles reading, updating or deleting a single member by ID (GET/PUT/DELETE)
+func handleMember(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/members/import" {
+		handleMemberImport(w, r)
+		return
+	}
+	if r.URL.Path == "/members/pending" {
+		handlePendingMembers(w, r)
+		return
+	}
+	if strings.HasPrefix(r.URL.Path, "/members/pending/") {
+		handlePendingMember(w, r)
+		return
+	}
+
+	// Members of other organizations are unknown to the caller
+	if id, _, ok := parseIDPath(r.URL.Path, "/members/"); ok && !checkMemberOrg(w, r, id) {
+		return
+	}
+
+	// Member sub-resources, e.g. /members/123/stats or /members/123/merge
+	if id, sub, ok := parseIDPath(r.URL.Path, "/members/"); ok && sub != "" {
+		switch sub {
+		case "stats":
+			handleMemberStats(w, r, id)
+		case "merge":
+			handleMemberMerge(w, r, id)
+		case "status":
+			handleMemberStatus(w, r, id)
+		case "notifications":
+			handleMemberNotifications(w, r, id)
+		case "consent":
+			handleMemberConsent(w, r, id)
+		case "privacy":
+			handleMemberPrivacy(w, r, id)
+		case "photo":
+			handleMemberPhoto(w, r, id)
+		default:
+			http.NotFound(w, r)
+		}
+		return
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodPut && r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
 		return
 	}
 
@@ -732,11 +1908,30 @@ func handleMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Handle GET request: the member with their consent and privacy preferences
+	if r.Method == http.MethodGet {
+		member, found := findMemberByID(id)
+		if !found {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		}
+		consent, err := loadConsent(id, false)
+		if err != nil {
+			log.Printf("Error loading consent: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(MemberDetails{Member: withPhotoURL(member), Consent: consent, Privacy: privacyOf(id)})
+		return
+	}
+
 	// Handle DELETE request
 	if r.Method == http.MethodDelete {
 		// Check if member exists and get UID before deletion
 		var uid string
-		err := db.QueryRow(`SELECT uid FROM members WHERE id = ?`, id).Scan(&uid)
+		err := db.QueryRow(`SELECT uid FROM members WHERE id = ? AND deleted_at IS NULL`, id).Scan(&uid)
 		if err == sql.ErrNoRows {
 			http.Error(w, "Member not found", http.StatusNotFound)
 			return
@@ -747,37 +1942,37 @@ func handleMember(w http.ResponseWriter, r *http.Request) {
 		}
 
 		// Check if member is currently signed in
-		mu.RLock()
-		_, isSignedIn := currentAttendees[uid]
-		mu.RUnlock()
-
+		_, isSignedIn, err := currentAttendees.get(uid)
+		if err != nil {
+			writeSignInOutError(w, fmt.Errorf("%w: %v", errAttendeeStore, err))
+			return
+		}
 		if isSignedIn {
 			http.Error(w, "Cannot delete member who is currently signed in", http.StatusConflict)
 			return
 		}
 
-		// Delete from database (CASCADE will delete related visits)
-		result, err := db.Exec(`DELETE FROM members WHERE id = ?`, id)
-		if err != nil {
+		// Move to the trash, restorable for 30 days (see trash.go)
+		trashed, err := trashMember(id, r.URL.Query().Get("keep_sessions") == "true", time.Now())
+		if err == sql.ErrNoRows {
+			http.Error(w, "Member not found", http.StatusNotFound)
+			return
+		} else if err != nil {
 			log.Printf("Error deleting member: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 
-		rowsAffected, _ := result.RowsAffected()
-		if rowsAffected == 0 {
-			http.Error(w, "Member not found", http.StatusNotFound)
-			return
-		}
-
-		// Reload cache to reflect deletion
-		if err := loadMembersIntoCache(); err != nil {
-			log.Printf("Warning: Failed to reload members cache: %v", err)
-		}
+		memberCache.removeID(id)
+		recordAudit("member.trashed", clientIP(r), fmt.Sprintf("member=%d name=%q visits=%d kept_visits=%d",
+			id, trashed.Name, trashed.TrashedSessions, trashed.KeptSessions))
 
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusOK)
-		json.NewEncoder(w).Encode(map[string]string{"message": "Member deleted successfully"})
+		json.NewEncoder(w).Encode(map[string]string{
+			"message":          "Member deleted successfully",
+			"restorable_until": trashed.PurgeAt.Format(time.RFC3339),
+		})
 		return
 	}
 
@@ -786,6 +1981,7 @@ func handleMember(w http.ResponseWriter, r *http.Request) {
 		Name      string `json:"name"`
 		UID       string `json:"uid"`
 		DiscordID string `json:"discord_id"`
+		Role      string `json:"role"` // Optional, unchanged if omitted
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -795,19 +1991,33 @@ func handleMember(w http.ResponseWriter, r *http.Request) {
 	req.Name = strings.TrimSpace(req.Name)
 	req.UID = strings.TrimSpace(req.UID)
 	req.DiscordID = strings.TrimSpace(req.DiscordID)
+	req.Role = strings.TrimSpace(req.Role)
 
 	if req.Name == "" || req.UID == "" || req.DiscordID == "" {
 		http.Error(w, "name, uid, and discord_id are required", http.StatusBadRequest)
 		return
 	}
+	if req.Role != "" {
+		role, ok := normalizeRole(req.Role)
+		if !ok {
+			http.Error(w, "Invalid 'role', expected member, exec, officer or guest", http.StatusBadRequest)
+			return
+		}
+		req.Role = role
+	}
 
 	// Update in database
-	result, err := db.Exec(`UPDATE members SET name = ?, uid = ?, discord_id = ? WHERE id = ?`,
-		req.Name, req.UID, req.DiscordID, id)
-	if err != nil {
+	var member Member
+	err := db.QueryRow(`UPDATE members SET name = ?, uid = ?, discord_id = ?, role = COALESCE(NULLIF(?, ''), role) WHERE id = ? AND deleted_at IS NULL
+		RETURNING id, name, uid, discord_id, role, status, org_id`,
+		req.Name, req.UID, encryptField(req.DiscordID), req.Role, id).Scan(&member.ID, &member.Name, &member.UID, decrypted{&member.DiscordID}, &member.Role, &member.Status, &member.OrgID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	} else if err != nil {
 		// Handle unique constraint on uid
-		if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "unique") {
-			http.Error(w, "UID already exists", http.StatusConflict)
+		if isUniqueViolation(err) {
+			writeUIDConflict(w, r, req.UID)
 			return
 		}
 		log.Printf("Error updating member: %v", err)
@@ -815,20 +2025,10 @@ func handleMember(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	rowsAffected, _ := result.RowsAffected()
-	if rowsAffected == 0 {
-		http.Error(w, "Member not found", http.StatusNotFound)
-		return
-	}
-
-	// Reload cache to reflect changes
-	if err := loadMembersIntoCache(); err != nil {
-		log.Printf("Warning: Failed to reload members cache: %v", err)
-	}
+	memberCache.put(member)
 
-	member := Member{ID: id, Name: req.Name, UID: req.UID, DiscordID: req.DiscordID}
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(member)
+	json.NewEncoder(w).Encode(withPhotoURL(member))
 }
 
 // handleMembers supports POST to create a new member and GET to list members
@@ -847,13 +2047,25 @@ func handleMembers(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "name, uid, and discord_id are required", http.StatusBadRequest)
 			return
 		}
+		role, ok := normalizeRole(req.Role)
+		if !ok {
+			http.Error(w, "Invalid 'role', expected member, exec, officer or guest", http.StatusBadRequest)
+			return
+		}
+
+		status, ok := normalizeStatus(req.Status)
+		if !ok {
+			http.Error(w, "Invalid 'status', expected pending, active, inactive or alumni", http.StatusBadRequest)
+			return
+		}
 
 		// Insert into DB
-		res, err := db.Exec(`INSERT INTO members (name, uid, discord_id) VALUES (?, ?, ?)`, req.Name, req.UID, req.DiscordID)
+		org := requestOrg(r)
+		res, err := db.Exec(`INSERT INTO members (name, uid, discord_id, role, status, org_id) VALUES (?, ?, ?, ?, ?, ?)`, req.Name, req.UID, encryptField(req.DiscordID), role, status, org)
 		if err != nil {
 			// Handle unique constraint on uid
-			if strings.Contains(err.Error(), "UNIQUE") || strings.Contains(err.Error(), "unique") {
-				http.Error(w, "UID already exists", http.StatusConflict)
+			if isUniqueViolation(err) {
+				writeUIDConflict(w, r, req.UID)
 				return
 			}
 			log.Printf("Error inserting member: %v", err)
@@ -863,16 +2075,38 @@ func handleMembers(w http.ResponseWriter, r *http.Request) {
 
 		id, _ := res.LastInsertId()
 
-		loadMembersIntoCache()
+		member := Member{ID: id, Name: req.Name, UID: req.UID, DiscordID: req.DiscordID, Role: role, Status: status, OrgID: org}
+		memberCache.put(member)
+		events.publish(Event{Kind: eventMemberCreated, Member: member, Message: fmt.Sprintf("Member %s created", member.Name)})
 
-		member := Member{ID: id, Name: req.Name, UID: req.UID, DiscordID: req.DiscordID}
 		w.Header().Set("Content-Type", "application/json")
 		w.WriteHeader(http.StatusCreated)
 		json.NewEncoder(w).Encode(member)
 
 	case http.MethodGet:
-		// Return list of members
-		rows, err := db.Query(`SELECT id, name, uid, discord_id FROM members`)
+		// Return list of members, optionally only those with a ?status= or ?role=
+		query := `SELECT id, name, uid, discord_id, role, status, org_id, p.member_id IS NOT NULL FROM members
+			LEFT JOIN member_photos p ON p.member_id = members.id WHERE deleted_at IS NULL AND org_id = ?`
+		args := []interface{}{requestOrg(r)}
+		if roleParam := r.URL.Query().Get("role"); roleParam != "" {
+			role, ok := normalizeRole(roleParam)
+			if !ok {
+				http.Error(w, "Invalid 'role' parameter, expected member, exec, officer or guest", http.StatusBadRequest)
+				return
+			}
+			query += ` AND role = ?`
+			args = append(args, role)
+		}
+		if statusParam := r.URL.Query().Get("status"); statusParam != "" {
+			status, ok := normalizeStatus(statusParam)
+			if !ok {
+				http.Error(w, "Invalid 'status' parameter, expected pending, active, inactive or alumni", http.StatusBadRequest)
+				return
+			}
+			query += ` AND status = ?`
+			args = append(args, status)
+		}
+		rows, err := db.Query(query, args...)
 		if err != nil {
 			log.Printf("Error querying members: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -883,11 +2117,17 @@ func handleMembers(w http.ResponseWriter, r *http.Request) {
 		var members []Member
 		for rows.Next() {
 			var m Member
-			if err := rows.Scan(&m.ID, &m.Name, &m.UID, &m.DiscordID); err != nil {
+			var hasPhoto bool
+			if err := rows.Scan(&m.ID, &m.Name, &m.UID, decrypted{&m.DiscordID}, &m.Role, &m.Status, &m.OrgID, &hasPhoto); err != nil {
 				log.Printf("Error scanning member row: %v", err)
 				http.Error(w, "Internal server error", http.StatusInternalServerError)
 				return
 			}
+			if hasPhoto {
+				m.PhotoURL = memberPhotoURL(m.ID)
+			} else {
+				m.AvatarURL = discordAvatars.avatarURL(m.DiscordID)
+			}
 			members = append(members, m)
 		}
 
@@ -895,18 +2135,66 @@ func handleMembers(w http.ResponseWriter, r *http.Request) {
 		json.NewEncoder(w).Encode(members)
 
 	default:
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
 	}
 }
 
 // handleCount returns the number of current attendees
+// Query parameters:
+//   - detailed: if true, return a CountBreakdown by room and role instead of a single count
 func handleCount(w http.ResponseWriter, r *http.Request) {
-	mu.RLock()
-	count := len(currentAttendees)
-	mu.RUnlock()
+	org := requestOrg(r)
+	detailed := r.URL.Query().Get("detailed") == "true"
+	key := "count:" + org
+	if detailed {
+		key = "count-detailed:" + org
+	}
+
+	resp, err := renderedResponses.render(key, time.Now(), func() (any, error) {
+		breakdown := currentBreakdown(org)
+		if detailed {
+			return breakdown, nil
+		}
+		return map[string]int{"count": breakdown.Total}, nil
+	})
+	if err != nil {
+		log.Printf("Error rendering count: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]int{"count": count})
+	w.Write(resp.body)
+}
+
+// currentBreakdown counts the current attendees of an organization by room and member role
+func currentBreakdown(org string) CountBreakdown {
+	breakdown := CountBreakdown{ByRoom: make(map[string]int)}
+	for _, a := range currentAttendees.list() {
+		member, _ := memberCache.get(a.UID)
+		if memberOrg(member) != org {
+			continue
+		}
+		breakdown.Total++
+
+		room := a.Room
+		if room == "" {
+			room = defaultRoom
+		}
+		breakdown.ByRoom[room]++
+
+		switch member.Role {
+		case roleExec:
+			breakdown.Execs++
+		case roleOfficer:
+			breakdown.Officers++
+		case roleGuest:
+			breakdown.Guests++
+		default:
+			breakdown.Members++
+		}
+	}
+	return breakdown
 }
 
 // handleHealth returns a simple health check response
@@ -918,97 +2206,107 @@ func handleHealth(w http.ResponseWriter, r *http.Request) {
 // handleSignoutAll signs out all current attendees
 func handleSignoutAll(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodPost)
 		return
 	}
 
-	// Copy current attendees and clear under lock
-	mu.Lock()
-	count := len(currentAttendees)
-	toSignOut := make(map[string]time.Time, count)
-	for uid, t := range currentAttendees {
-		toSignOut[uid] = t
-	}
-	currentAttendees = make(map[string]time.Time)
-	mu.Unlock()
-
-	// Persist cleared state
-	_ = saveCurrentAttendees()
-
-	// Save visits for those who were signed out
-	for uid, signinTime := range toSignOut {
-		mu.RLock()
-		member, ok := userDB[uid]
-		mu.RUnlock()
-		if !ok {
-			log.Printf("Sign-out-all: skipping unknown UID %s in current attendees", uid)
-			continue
-		}
-
-		signOutTime := time.Now()
-		if err := saveVisitToDB(member.ID, signinTime, signOutTime); err != nil {
-			log.Printf("Error saving visit to database during signout all for UID %s: %v", uid, err)
-		}
-	}
+	count, saved := signOutEveryone("sign-out-all")
 
 	w.Header().Set("Content-Type", "application/json")
 	msg := fmt.Sprintf("Signed out all attendees (%d total).", count)
 	log.Println(msg)
-	json.NewEncoder(w).Encode(map[string]string{"message": msg})
+	resp := map[string]interface{}{"message": msg}
+
+	// Can be undone for a while (see operations.go)
+	if len(saved) > 0 {
+		op, err := recordBulkOperation(operationSignOutAll, saved, time.Now())
+		if err != nil {
+			log.Printf("Error recording sign-out-all for undo: %v", err)
+		} else {
+			resp["operation_id"] = op.ID
+			resp["undoable_until"] = op.UndoableUntil
+		}
+	}
+	json.NewEncoder(w).Encode(resp)
 }
 
 func handleSignInWithDiscordID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodPost)
 		return
 	}
 
-	// Parse Discord ID from request
+	// Parse Discord ID and optional network evidence from request
 	var req struct {
-		DiscordID string `json:"discord_id"`
+		DiscordID string           `json:"discord_id"`
+		Network   *NetworkEvidence `json:"network,omitempty"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	// Find member by Discord ID (read lock)
-	mu.RLock()
-	var member Member
-	found := false
-	for _, m := range userDB {
-		if m.DiscordID == req.DiscordID {
-			member = m // copy
-			found = true
-			break
-		}
-	}
-	mu.RUnlock()
+	// Find member by Discord ID
+	member, found := findMemberByDiscordID(req.DiscordID, requestOrg(r))
 	if !found {
 		http.Error(w, "Member not found", http.StatusNotFound)
 		return
 	}
+	if reason := signInRefusal(member.Status); reason != "" {
+		http.Error(w, fmt.Sprintf("%s: %s", member.Name, reason), http.StatusForbidden)
+		return
+	}
 
-	// Check if already signed in and sign in atomically
-	mu.Lock()
-	if _, isInside := currentAttendees[member.UID]; isInside {
-		mu.Unlock()
-		http.Error(w, "Member already signed in", http.StatusConflict)
+	// Check the device is on the office network (see officenetwork.go)
+	onOfficeNetwork, err := officeNetwork.verify(req.Network)
+	if err != nil {
+		http.Error(w, "Invalid network evidence: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Network != nil {
+		logHTTP.infof("Remote sign-in of %s from ip=%q bssid=%q ssid=%q (office network: %t)",
+			member.Name, req.Network.IP, req.Network.BSSID, req.Network.SSID, onOfficeNetwork)
+	}
+	if officeNetwork.Required && !onOfficeNetwork {
+		incCounter("remote_signins_refused_total")
+		recordAudit("remote_signin.refused", clientIP(r), fmt.Sprintf("member=%d reason=not on office network", member.ID))
+		http.Error(w, "Remote sign-ins must come from the office network", http.StatusForbidden)
+		return
+	}
+
+	// Remote sign-ins may need confirmation from someone in the office (see remotesignin.go)
+	if remoteSignInApproval > 0 {
+		p, err := requestRemoteSignIn(member, "", time.Now())
+		if err != nil {
+			if errors.Is(err, errAlreadySignedIn) || errors.Is(err, errAttendeeStore) {
+				writeSignInOutError(w, err)
+			} else if pendingSignInConflict(err) {
+				http.Error(w, "Sign-in already pending confirmation", http.StatusConflict)
+			} else {
+				log.Printf("Error recording remote sign-in: %v", err)
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+			}
+			return
+		}
+		logHTTP.infof("Remote sign-in of %s pending confirmation", member.Name)
+		recordAudit("remote_signin.requested", clientIP(r), fmt.Sprintf("pending=%d member=%d", p.ID, member.ID))
+		writePendingSignIn(w, p)
 		return
 	}
-	mu.Unlock()
-	msg, err := performSignIn(member)
+
+	// Check if already signed in and sign in atomically
+	msg, err := performSignIn(r.Context(), member, "")
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeSignInOutError(w, err)
 		return
 	}
-	log.Println(msg)
+	logHTTP.infof("%s", msg)
 	json.NewEncoder(w).Encode(map[string]string{"message": msg, "status": "in"})
 }
 
 func handleSignOutWithDiscordID(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodPost)
 		return
 	}
 
@@ -1021,49 +2319,31 @@ func handleSignOutWithDiscordID(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Find member by Discord ID (read lock)
-	mu.RLock()
-	var member Member
-	found := false
-	for _, m := range userDB {
-		if m.DiscordID == req.DiscordID {
-			member = m // copy
-			found = true
-			break
-		}
-	}
-	mu.RUnlock()
+	// Find member by Discord ID
+	member, found := findMemberByDiscordID(req.DiscordID, requestOrg(r))
 	if !found {
 		http.Error(w, "Member not found", http.StatusNotFound)
 		return
 	}
 
-	// Check if signed in and remove under lock
-	mu.Lock()
-	signInTime, isInside := currentAttendees[member.UID]
-	if !isInside {
-		mu.Unlock()
-		http.Error(w, "Member not signed in", http.StatusConflict)
-		return
-	}
-	mu.Unlock()
-	msg, err := performSignOut(member, signInTime)
+	// Check if signed in and sign out atomically
+	msg, err := performSignOut(r.Context(), member)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeSignInOutError(w, err)
 		return
 	}
-	log.Println(msg)
+	logHTTP.infof("%s", msg)
 	json.NewEncoder(w).Encode(map[string]string{"message": msg, "status": "out"})
 }
 
 // Export members in database to members.json file
 func handleExportMembers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodGet)
 		return
 	}
 
-	rows, err := db.Query(`SELECT id, name, uid, discord_id FROM members`)
+	rows, err := db.Query(`SELECT id, name, uid, discord_id, role, status, org_id FROM members WHERE deleted_at IS NULL`)
 	if err != nil {
 		log.Printf("Error querying members for export: %v", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -1074,7 +2354,7 @@ func handleExportMembers(w http.ResponseWriter, r *http.Request) {
 	var members []Member
 	for rows.Next() {
 		var m Member
-		if err := rows.Scan(&m.ID, &m.Name, &m.UID, &m.DiscordID); err != nil {
+		if err := rows.Scan(&m.ID, &m.Name, &m.UID, decrypted{&m.DiscordID}, &m.Role, &m.Status, &m.OrgID); err != nil {
 			log.Printf("Error scanning member row for export: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
@@ -1103,7 +2383,7 @@ func handleExportMembers(w http.ResponseWriter, r *http.Request) {
 // Import members from members.json file to database
 func handleImportMembers(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		methodNotAllowed(w, http.MethodPost)
 		return
 	}
 
@@ -1123,15 +2403,27 @@ func handleImportMembers(w http.ResponseWriter, r *http.Request) {
 
 	importedCount := 0
 	for _, m := range members {
-		_, err := db.Exec(`INSERT OR IGNORE INTO members (name, uid, discord_id) VALUES (?, ?, ?)`, m.Name, m.UID, m.DiscordID)
+		role, ok := normalizeRole(m.Role)
+		if !ok {
+			role = roleMember
+		}
+		status, ok := normalizeStatus(m.Status)
+		if !ok {
+			status = statusActive
+		}
+		res, err := db.Exec(`INSERT OR IGNORE INTO members (name, uid, discord_id, role, status) VALUES (?, ?, ?, ?, ?)`, m.Name, m.UID, encryptField(m.DiscordID), role, status)
 		if err != nil {
 			log.Printf("Error inserting member during import: %v", err)
 			continue
 		}
 		importedCount++
-	}
 
-	loadMembersIntoCache()
+		// Existing UIDs are ignored and keep their cached member
+		if inserted, _ := res.RowsAffected(); inserted == 1 {
+			id, _ := res.LastInsertId()
+			memberCache.put(Member{ID: id, Name: m.Name, UID: m.UID, DiscordID: m.DiscordID, Role: role, Status: status})
+		}
+	}
 
 	msg := fmt.Sprintf("Imported %d members from %s", importedCount, membersFilePath)
 	log.Println(msg)
@@ -1141,6 +2433,21 @@ func handleImportMembers(w http.ResponseWriter, r *http.Request) {
 // --- Main ---
 
 func main() {
+	migrateJSON := flag.Bool("migrate-json", false, "import legacy members.json and current_attendees.json into the database, then exit")
+	check := flag.Bool("check", false, "validate the configuration, data folder, database and integrations, print a report, then exit")
+	flag.Parse()
+
+	// Read secrets given as files (NAME_FILE) before any setting is loaded;
+	// --check reports a failure instead
+	if err := loadSecretFiles(); err != nil && !*check {
+		log.Fatal("Invalid secret file: ", err)
+	}
+
+	// Self-check of the configuration and environment, then exit (--check)
+	if *check {
+		os.Exit(runSelfCheck(os.Stdout))
+	}
+
 	// Create data folder if it doesn't exist
 	if _, err := os.Stat(dataFolder); os.IsNotExist(err) {
 		if err := os.Mkdir(dataFolder, 0755); err != nil {
@@ -1148,27 +2455,86 @@ func main() {
 		}
 	}
 
-	// Initialize SQLite database
-	if err := initDB(); err != nil {
+	// Load the SQLite connection pool settings
+	var err error
+	if dbConfig, err = loadDBConfig(); err != nil {
+		log.Fatal("Invalid database configuration: ", err)
+	}
+
+	// Load the budget of heavy reads, which keeps connections free for scans
+	if heavyReads, err = loadHeavyReadLimiter(dbConfig); err != nil {
+		log.Fatal("Invalid HEAVY_READ_* configuration: ", err)
+	}
+
+	// Load the keys of encrypted member fields
+	if fieldEncryption, err = loadFieldEncryption(); err != nil {
+		log.Fatal("Invalid FIELD_ENCRYPTION_KEYS: ", err)
+	}
+
+	// Initialize and check the SQLite database, restoring a backup if it is corrupt
+	if err := initCheckedDB(os.Getenv("INTEGRITY_RESTORE_DIR")); err != nil {
 		log.Fatal("Could not initialize database: ", err)
 	}
 	defer db.Close()
 	log.Println("Database initialized successfully.")
 
-	// Load members into memory cache from database
-	if err := loadMembersIntoCache(); err != nil {
-		log.Fatal("Could not load members: ", err)
+	// Encrypt sensitive fields with the current key, after enabling encryption or rotating keys
+	if n, err := resealFields(); err != nil {
+		log.Fatal("Could not encrypt member fields: ", err)
+	} else if n > 0 {
+		log.Printf("Encrypted %d member field value(s) with the current key.", n)
+	}
+
+	// Chain changes to the sessions with hashes for tamper evidence (optional)
+	if sessionLedgerKey, err = loadSessionLedgerKey(); err != nil {
+		log.Fatal("Invalid SESSION_LEDGER_KEY: ", err)
+	}
+	if err := setupSessionLedger(); err != nil {
+		log.Fatal("Could not set up the session ledger: ", err)
+	}
+	if sessionLedgerKey != nil {
+		log.Println("Session ledger enabled: changes to sessions are chained with hashes.")
+	}
+
+	// Only name members who acknowledged the current notice (optional)
+	if version, err := loadConsentVersion(); err != nil {
+		log.Fatal("Invalid CONSENT_VERSION: ", err)
+	} else if version != "" {
+		log.Printf("Consent required: members are named on public views once they acknowledge notice %s.", version)
+	}
+
+	// Read members and open sessions from the database only (optional)
+	if err := configureStatelessMode(); err != nil {
+		log.Fatal("Invalid STATELESS configuration: ", err)
+	}
+	if statelessMode {
+		log.Println("Stateless mode: members and open sessions are read from the database.")
+	} else {
+		// Load members into memory cache from database
+		if err := loadMembersIntoCache(); err != nil {
+			log.Fatal("Could not load members: ", err)
+		}
+		log.Printf("Loaded %d members into cache.", memberCache.count())
+	}
+
+	// Share current attendees with other instances through Redis (optional)
+	if err := configureSharedState(); err != nil {
+		log.Fatal("Invalid REDIS_URL: ", err)
+	}
+	if sharedStateClient != nil {
+		log.Printf("Sharing current attendees through Redis at %s.", sharedStateClient.addr)
+	}
+
+	// One-shot migration of legacy JSON files, then exit (--migrate-json)
+	if *migrateJSON {
+		os.Exit(runJSONMigration())
 	}
-	mu.RLock()
-	loadedMembers := len(userDB)
-	mu.RUnlock()
-	log.Printf("Loaded %d members into cache.", loadedMembers)
 
 	// Load current attendees from file (if exists)
 	if err := loadCurrentAttendees(); err != nil {
 		log.Printf("Warning: Could not load current attendees: %v", err)
 	} else {
-		log.Printf("Loaded %d current attendees from file.", len(currentAttendees))
+		log.Printf("Loaded %d current attendees from file.", currentAttendees.count())
 	}
 
 	// Load API keys from environment
@@ -1179,32 +2545,406 @@ func main() {
 		log.Println("Warning: No API keys configured. All endpoints are public. Set SCANNER_API_KEY, DISCORD_BOT_API_KEY, or API_KEYS environment variables for security.")
 	}
 
-	// Define Routes with CORS and API key middleware
-	wrapRoute := func(handler http.HandlerFunc) http.HandlerFunc {
-		return corsMiddleware(apiKeyMiddleware(handler))
+	scopes, err := loadAPIKeyScopes()
+	if err != nil {
+		log.Fatal("Invalid API_KEYS: ", err)
+	}
+	apiKeyScopes = scopes
+	orgs, err := loadAPIKeyOrgs()
+	if err != nil {
+		log.Fatal("Invalid API_KEYS: ", err)
+	}
+	apiKeyOrgs = orgs
+
+	// Load network policy (CIDR allowlists per endpoint group)
+	policies, err := loadNetworkPolicies()
+	if err != nil {
+		log.Fatal("Invalid NETWORK_POLICY: ", err)
+	}
+	networkPolicies = policies
+
+	// Load the office network remote sign-ins are checked against
+	if officeNetwork, err = loadOfficeNetworkPolicy(); err != nil {
+		log.Fatal("Invalid office network settings: ", err)
+	}
+	if len(networkPolicies) > 0 {
+		log.Printf("Loaded %d network policy rule(s).", len(networkPolicies))
+	}
+
+	// Load office hours and the buddy rule for time outside them
+	if officeHours, err = loadOfficeHours(); err != nil {
+		log.Fatal("Invalid OFFICE_HOURS: ", err)
+	}
+	if buddyRuleAfter, err = loadBuddyRuleAfter(); err != nil {
+		log.Fatal("Invalid BUDDY_RULE_AFTER: ", err)
+	}
+
+	// Load CORS configuration
+	cors, err := loadCORSConfig()
+	if err != nil {
+		log.Fatal("Invalid CORS configuration: ", err)
+	}
+	corsSettings = cors
+
+	// Load the heartbeat timeout after which devices are reported offline
+	if deviceOfflineAfter, err = loadDeviceOfflineAfter(); err != nil {
+		log.Fatal("Invalid DEVICE_OFFLINE_AFTER: ", err)
+	}
+
+	// Load how often the database integrity is checked
+	integrityCheckInterval, err := loadIntegrityCheckInterval()
+	if err != nil {
+		log.Fatal("Invalid INTEGRITY_CHECK_INTERVAL: ", err)
+	}
+
+	// Load how often the WAL is checkpointed and the database vacuumed
+	maintenanceInterval, err := loadMaintenanceDuration("MAINTENANCE_INTERVAL", defaultMaintenanceInterval)
+	if err != nil {
+		log.Fatal("Invalid MAINTENANCE_INTERVAL: ", err)
+	}
+	if maintenanceVacuumInterval, err = loadMaintenanceDuration("VACUUM_INTERVAL", defaultVacuumInterval); err != nil {
+		log.Fatal("Invalid VACUUM_INTERVAL: ", err)
+	}
+
+	// Load how long remote sign-ins wait for confirmation, if they need it
+	if remoteSignInApproval, err = loadRemoteSignInApproval(); err != nil {
+		log.Fatal("Invalid REMOTE_SIGNIN_APPROVAL: ", err)
+	}
+
+	// Load how long destructive operations wait for a second admin, if they need one
+	if twoPersonApproval, err = loadTwoPersonApproval(); err != nil {
+		log.Fatal("Invalid TWO_PERSON_APPROVAL: ", err)
+	}
+	if twoPersonApproval > 0 {
+		log.Printf("Two-person approval enabled: destructive operations wait up to %s for a second admin", twoPersonApproval)
+	}
+
+	// Load the door relay controller unlocked by scans (optional)
+	if doorRelay, err = loadDoorRelay(); err != nil {
+		log.Fatal("Invalid door relay configuration: ", err)
+	}
+	if doorRelay != nil {
+		log.Printf("Door control enabled: scans unlock the door through %s", doorRelay.url.Redacted())
+	}
+
+	// Load the device clock skew above which a warning is sent
+	if clockSkewThreshold, err = loadClockSkewThreshold(); err != nil {
+		log.Fatal("Invalid CLOCK_SKEW_THRESHOLD: ", err)
+	}
+
+	// Load the log levels, debug http logs request and response bodies (optional)
+	if logLevel, err = loadLogLevel(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_COMPONENT_LEVELS"), os.Getenv("LOG_DEBUG_ROUTES")); err != nil {
+		log.Fatal("Invalid LOG_LEVEL, LOG_COMPONENT_LEVELS or LOG_DEBUG_ROUTES: ", err)
+	}
+	if logLevel.Level != logLevelInfo || len(logLevel.Components) > 0 {
+		log.Printf("Log level set to %s", logLevel.describe())
+	}
+
+	// Load the OTLP trace exporter (optional)
+	tr, err := loadTracer()
+	if err != nil {
+		log.Fatal("Invalid tracing configuration: ", err)
+	}
+	activeTracer.Store(tr)
+
+	// Load Sentry and/or error webhook reporting (optional)
+	if activeErrorReporter, err = loadErrorReporter(); err != nil {
+		log.Fatal("Invalid error tracking configuration: ", err)
+	}
+
+	// Configure where member photos are stored (disk unless PHOTO_S3_BUCKET is set)
+	if activePhotoStorage, err = loadPhotoStorage(); err != nil {
+		log.Fatal("Invalid photo storage: ", err)
+	}
+	if _, ok := activePhotoStorage.(s3PhotoStorage); ok {
+		log.Printf("Storing member photos in S3 bucket %s", os.Getenv("PHOTO_S3_BUCKET"))
+	}
+
+	// Load client CA for scanner mTLS (optional)
+	if err := loadMTLSConfig(); err != nil {
+		log.Fatal("Invalid mTLS configuration: ", err)
+	}
+
+	// Take the sockets passed by systemd socket activation and the watchdog interval (optional)
+	listeners, err := systemdListeners()
+	if err != nil {
+		log.Fatal("Invalid socket activation: ", err)
+	}
+	mtlsListener, err := activatedMTLSListener(listeners)
+	if err != nil {
+		log.Fatal("Invalid socket activation: ", err)
+	}
+	if len(listeners) > 0 {
+		log.Printf("Socket activated by systemd with %d socket(s)", len(listeners))
 	}
+	watchdog, err := watchdogInterval()
+	if err != nil {
+		log.Fatal("Invalid systemd watchdog: ", err)
+	}
+
+	// Load the addresses the API is served on
+	listenConfigs, err := loadListenAddrs()
+	if err != nil {
+		log.Fatal("Invalid LISTEN_ADDR: ", err)
+	}
+
+	// Load the reverse proxies whose X-Forwarded-For is believed and the URL prefix (optional)
+	if trustedProxies, err = loadTrustedProxies(); err != nil {
+		log.Fatal("Invalid TRUSTED_PROXIES: ", err)
+	}
+	if basePath, err = loadBasePath(); err != nil {
+		log.Fatal("Invalid BASE_PATH: ", err)
+	}
+	if basePath != "" {
+		log.Printf("Serving under %s/", basePath)
+	}
+
+	// Define Routes with CORS, method handling, network policy, API key, two-person approval and load shedding middleware
+	wrapRoute := func(handler http.HandlerFunc, methods ...string) http.HandlerFunc {
+		return traceMiddleware(errorReportMiddleware(debugLogMiddleware(corsMiddleware(methodsMiddleware(networkPolicyMiddleware(apiKeyMiddleware(twoPersonApprovalMiddleware(loadShedMiddleware(handler)))), methods...), methods...))))
+	}
+
+	http.HandleFunc("/scan", wrapRoute(handleScan, "POST"))                                   // POST: ESP32 sends UID here (?async=true to answer at once)
+	http.HandleFunc("/scan/result/", wrapRoute(handleScanResult, "GET"))                      // GET: result of an asynchronous scan by token
+	http.HandleFunc("/current", wrapRoute(handleCurrent, "GET"))                              // GET: See who is in the room
+	http.HandleFunc("/visits", wrapRoute(handleVisits, "GET", "DELETE"))                      // GET: retrieve visits (JSON or CSV with ?format=csv), DELETE: delete visits
+	http.HandleFunc("/scan-history", wrapRoute(handleScanHistory, "GET"))                     // GET: See recent scan events
+	http.HandleFunc("/members/", wrapRoute(handleMember, "GET", "POST", "PUT", "DELETE"))     // GET: member by ID with consent and privacy, PUT: update member by ID, DELETE: move member to the trash (?keep_sessions=true), GET /members/{id}/stats, POST /members/{id}/merge, POST /members/import (CSV), /members/pending
+	http.HandleFunc("/members", wrapRoute(handleMembers, "GET", "POST"))                      // GET: list members, POST: create member
+	http.HandleFunc("/count", wrapRoute(handleCount, "GET"))                                  // GET: get current attendee count
+	http.HandleFunc("/health", corsMiddleware(methodsMiddleware(handleHealth, "GET"), "GET")) // GET: health check (no API key needed)
+	http.HandleFunc("/sign-out-all", wrapRoute(handleSignoutAll, "POST"))                     // POST: sign out all attendees (undo with /admin/operations/{id}/undo)
+	http.HandleFunc("/sign-in-discord", wrapRoute(handleSignInWithDiscordID, "POST"))         // POST: sign in with Discord ID
+	http.HandleFunc("/sign-out-discord", wrapRoute(handleSignOutWithDiscordID, "POST"))       // POST: sign out with Discord ID
+	http.HandleFunc("/export-members", wrapRoute(handleExportMembers, "GET"))                 // GET: export members as json file
+	http.HandleFunc("/import-members", wrapRoute(handleImportMembers, "POST"))                // POST: import members from json file
+	http.HandleFunc("/me", wrapRoute(handleMe, "GET"))                                        // GET: calling member's record and status (X-Discord-ID)
+	http.HandleFunc("/me/sessions", wrapRoute(handleMeSessions, "GET"))                       // GET: calling member's visits
+	http.HandleFunc("/me/stats", wrapRoute(handleMeStats, "GET"))                             // GET: calling member's visit totals
+	http.HandleFunc("/me/sign-out", wrapRoute(handleMeSignOut, "POST"))                       // POST: sign out the calling member
+	http.HandleFunc("/admin/audit-log", wrapRoute(handleAuditLog, "GET"))                     // GET: recent audit log entries
+	http.HandleFunc("/admin/data-quality", wrapRoute(handleDataQuality, "GET"))               // GET: suspicious records to review before reporting
+	http.HandleFunc("/admin/cache/refresh", wrapRoute(handleCacheRefresh, "POST"))            // POST: reload the member cache from the database
+	http.HandleFunc("/admin/duplicates", wrapRoute(handleDuplicates, "GET"))                  // GET: likely duplicate members
+	http.HandleFunc("/admin/firmware", wrapRoute(handleFirmwareUploads, "GET", "POST"))       // GET: list firmware, POST: upload firmware (?version=&channel=)
+	http.HandleFunc("/firmware/", wrapRoute(handleFirmwareDownload, "GET"))                   // GET: download a firmware binary
+	http.HandleFunc("/metrics", wrapRoute(handleMetrics, "GET"))                              // GET: Prometheus metrics
+	http.HandleFunc("/devices", wrapRoute(handleDevices, "GET", "POST"))                      // GET: list devices, POST: register device
+	http.HandleFunc("/devices/", wrapRoute(handleDevice, "GET", "POST", "PUT", "DELETE"))     // GET/PUT/DELETE device, /devices/{id}/certificate, /config, /firmware and /heartbeat
+	http.HandleFunc("/attendance/at", wrapRoute(handleAttendanceAt, "GET"))                   // GET: who was inside at ?time=
+	http.HandleFunc("/stats/overlap", wrapRoute(handleStatsOverlap, "GET"))                   // GET: co-present time of ?member_a= and ?member_b=
+	http.HandleFunc("/stats/summary", wrapRoute(handleStatsSummary, "GET"))                   // GET: per-day or per-week attendance summary
+	http.HandleFunc("/stats/mentorship", wrapRoute(handleStatsMentorship, "GET"))             // GET: verified hours of ?mentor= with ?mentee= (JSON or CSV)
+	http.HandleFunc("/history/aggregate", wrapRoute(handleHistoryAggregate, "GET"))           // GET: visit totals per member (?group_by=member)
+	http.HandleFunc("/stats/heatmap", wrapRoute(handleStatsHeatmap, "GET"))                   // GET: average occupancy by weekday and hour
+	http.HandleFunc("/stats/live", wrapRoute(handleStatsLive, "GET"))                         // GET: today's and this week's totals and current streaks, from memory
+	http.HandleFunc("/reports/summary.pdf", wrapRoute(handleSummaryPDF, "GET"))               // GET: attendance summary with charts (?from=&to=)
+	http.HandleFunc("/reports/term.xlsx", wrapRoute(handleTermReportXLSX, "GET"))             // GET: term report workbook (?term=)
+	http.HandleFunc("/reports/ccr.csv", wrapRoute(handleCCRExport, "GET"))                    // GET: co-curricular record hours per member and activity code (?term=)
+	http.HandleFunc("/terms", wrapRoute(handleTerms, "GET", "POST"))                          // GET: list terms, POST: create term
+	http.HandleFunc("/terms/", wrapRoute(handleTerm, "GET", "PUT", "DELETE"))                 // GET/PUT/DELETE term by ID
+	http.HandleFunc("/goals", wrapRoute(handleGoals, "GET", "POST"))                          // GET: list goals, POST: create goal
+	http.HandleFunc("/goals/", wrapRoute(handleGoal, "GET", "PUT", "DELETE"))                 // GET/PUT/DELETE goal by ID
+	http.HandleFunc("/closures", wrapRoute(handleClosures, "GET", "POST"))                    // GET: list closures, POST: create closure
+	http.HandleFunc("/closures/", wrapRoute(handleClosure, "GET", "PUT", "DELETE"))           // GET/PUT/DELETE closure by ID
+	http.HandleFunc("/access-rules", wrapRoute(handleAccessRules, "GET", "POST"))             // GET: list door access rules, POST: create one
+	http.HandleFunc("/access-rules/", wrapRoute(handleAccessRule, "GET", "PUT", "DELETE"))    // GET/PUT/DELETE access rule by ID
+	http.HandleFunc("/access-rules/simulate", wrapRoute(handleAccessRulesSimulate, "GET"))    // GET: would a member unlock the door
+	http.HandleFunc("/access-grants", wrapRoute(handleAccessGrants, "GET", "POST"))           // GET: list time-boxed door access, POST: grant it
+	http.HandleFunc("/access-grants/", wrapRoute(handleAccessGrant, "GET", "DELETE"))         // GET/DELETE (revoke) access grant by ID
+
+	// Report schedules: GET list, POST create; /{id}: GET/PUT/DELETE, GET /{id}/runs, POST /{id}/run
+	http.HandleFunc("/admin/report-schedules", wrapRoute(handleReportSchedules, "GET", "POST"))
+	http.HandleFunc("/admin/report-schedules/", wrapRoute(handleReportSchedule, "GET", "POST", "PUT", "DELETE"))
+
+	// Full-text search over members and audit entries (?q=&type=&limit=)
+	http.HandleFunc("/search", wrapRoute(handleSearch, "GET"))
+
+	// Signups from the membership form, creating pending members awaiting card enrollment
+	http.HandleFunc("/integrations/membership-webhook", wrapRoute(handleMembershipWebhook, "POST"))
+
+	// Office open intervals of the day, and office opened/closed events as server-sent events
+	http.HandleFunc("/status/today", wrapRoute(handleStatusToday, "GET"))
+	http.HandleFunc("/status/stream", wrapRoute(handleStatusStream, "GET"))
+
+	// Sign-ins, sign-outs and office events after ?since=, long-polled for clients that cannot stream
+	http.HandleFunc("/events/poll", wrapRoute(handleEventsPoll, "GET"))
+
+	// Notification quiet hours per integration (GET list; PUT/DELETE /{integration}) and opt-outs
+	http.HandleFunc("/admin/quiet-hours", wrapRoute(handleQuietHoursList, "GET"))
+	http.HandleFunc("/admin/quiet-hours/", wrapRoute(handleQuietHours, "PUT", "DELETE"))
+	http.HandleFunc("/me/notifications", wrapRoute(handleMeNotifications, "GET", "PUT"))
+
+	// Kiosk tokens for display devices: GET list, POST issue; /{id}: GET, DELETE revoke
+	http.HandleFunc("/admin/kiosk-tokens", wrapRoute(handleKioskTokens, "GET", "POST"))
+	http.HandleFunc("/admin/kiosk-tokens/", wrapRoute(handleKioskToken, "GET", "DELETE"))
+
+	// API key usage: GET list of configured keys; /{id}/usage: GET requests by endpoint
+	http.HandleFunc("/admin/api-keys", wrapRoute(handleAPIKeys, "GET"))
+	http.HandleFunc("/admin/api-keys/", wrapRoute(handleAPIKeyUsage, "GET"))
+
+	// Webhook delivery log: /{integration}/deliveries GET; /{integration}/deliveries/{n}/retry POST
+	http.HandleFunc("/webhooks/", wrapRoute(handleWebhooks, "GET", "POST"))
+
+	// Public open/closed snapshot polled by the website (no API key needed)
+	http.HandleFunc("/presence", corsMiddleware(methodsMiddleware(handlePresence, "GET"), "GET"))
+
+	// Door sign summary for e-paper displays (?format=json|png&view=&max_names=&width=&height=)
+	http.HandleFunc("/display/summary", wrapRoute(handleDisplaySummary, "GET"))
+
+	// Greetings for the office speaker (?after=&room=&wait=), long-polled
+	http.HandleFunc("/announcements/next", wrapRoute(handleAnnouncementsNext, "GET"))
+
+	// Phone check-ins: POST a challenge, then POST the phone's signed answer; keys from /me/nfc-key
+	http.HandleFunc("/checkin/nfc/challenge", wrapRoute(handleNFCChallenge, "POST"))
+	http.HandleFunc("/checkin/nfc", wrapRoute(handleNFCCheckIn, "POST"))
+	http.HandleFunc("/me/nfc-key", wrapRoute(handleMeNFCKey, "GET", "POST", "DELETE"))
+
+	// Remote sign-ins awaiting confirmation: GET list; POST /{id}/confirm or /{id}/reject by an exec in the office
+	http.HandleFunc("/remote-signins", wrapRoute(handleRemoteSignIns, "GET"))
+	http.HandleFunc("/remote-signins/", wrapRoute(handleRemoteSignIn, "POST"))
+
+	// Projects (GET list, POST create; /{id}: GET, PUT, DELETE; /{id}/hours), session time allocated to them (/sessions/{id}/allocate) and session amendments (/sessions/{id}/amendments)
+	http.HandleFunc("/projects", wrapRoute(handleProjects, "GET", "POST"))
+	http.HandleFunc("/projects/", wrapRoute(handleProject, "GET", "PUT", "DELETE"))
+	http.HandleFunc("/sessions/", wrapRoute(handleSession, "GET", "POST"))
+
+	// Organization settings: greetings, webhook, cleanup hour and capacity (/{id}/settings: GET, PUT)
+	http.HandleFunc("/orgs/", wrapRoute(handleOrgSettings, "GET", "PUT"))
+
+	// Snapshot of the whole database for archival or migration (?format=sqlite|jsonl)
+	http.HandleFunc("/admin/export", wrapRoute(handleExport, "GET"))
+
+	// Split visits saved before SPLIT_SESSIONS_AT_MIDNIGHT was turned on into per-day segments
+	http.HandleFunc("/admin/visit-segments/backfill", wrapRoute(handleVisitSegmentsBackfill, "POST"))
+
+	// Visits with pseudonyms instead of identities, for research (?from=&to=&term=&dataset=&format=csv|jsonl)
+	http.HandleFunc("/admin/export/anonymized", wrapRoute(handleAnonymizedExport, "GET"))
+
+	// Import legacy members.json and current_attendees.json into the database, archiving them
+	http.HandleFunc("/admin/migrate-json", wrapRoute(handleMigrateJSON, "POST"))
+
+	// Destructive operations awaiting a second admin (?status=; /{id}: GET, /{id}/approve and /{id}/reject: POST)
+	http.HandleFunc("/admin/pending-ops", wrapRoute(handlePendingOperations, "GET"))
+	http.HandleFunc("/admin/pending-ops/", wrapRoute(handlePendingOperation, "GET", "POST"))
+
+	// Undo a sign-out-all within 10 minutes (/{id}: GET, /{id}/undo: POST)
+	http.HandleFunc("/admin/operations/", wrapRoute(handleBulkOperation, "GET", "POST"))
+
+	// Deleted members, restorable for 30 days (/{id}: GET, DELETE to purge; /{id}/restore: POST)
+	http.HandleFunc("/admin/trash", wrapRoute(handleTrash, "GET"))
+	http.HandleFunc("/admin/trash/", wrapRoute(handleTrashedMember, "GET", "POST", "DELETE"))
+
+	// Check the hash chain over changes to sessions (?hash= a report's X-Session-Ledger-Head)
+	http.HandleFunc("/admin/verify-ledger", wrapRoute(handleVerifyLedger, "GET"))
+
+	// Calling member's consent to being named (GET; POST acknowledges or withdraws); /members/{id}/consent for admins
+	http.HandleFunc("/me/consent", wrapRoute(handleMeConsent, "GET", "POST"))
+
+	// Calling member's display alias and visibility (GET, PUT); /members/{id}/privacy for admins
+	http.HandleFunc("/me/privacy", wrapRoute(handleMePrivacy, "GET", "PUT"))
 
-	http.HandleFunc("/scan", wrapRoute(handleScan))                             // POST: ESP32 sends UID here
-	http.HandleFunc("/current", wrapRoute(handleCurrent))                       // GET: See who is in the room
-	http.HandleFunc("/visits", wrapRoute(handleVisits))                         // GET: retrieve visits (JSON or CSV with ?format=csv), DELETE: delete visits
-	http.HandleFunc("/scan-history", wrapRoute(handleScanHistory))              // GET: See recent scan events
-	http.HandleFunc("/members/", wrapRoute(handleMember))                       // PUT: update member by ID, DELETE: delete member by ID
-	http.HandleFunc("/members", wrapRoute(handleMembers))                       // GET: list members, POST: create member
-	http.HandleFunc("/count", wrapRoute(handleCount))                           // GET: get current attendee count
-	http.HandleFunc("/health", corsMiddleware(handleHealth))                    // GET: health check (no API key needed)
-	http.HandleFunc("/sign-out-all", wrapRoute(handleSignoutAll))               // POST: sign out all attendees
-	http.HandleFunc("/sign-in-discord", wrapRoute(handleSignInWithDiscordID))   // POST: sign in with Discord ID
-	http.HandleFunc("/sign-out-discord", wrapRoute(handleSignOutWithDiscordID)) // POST: sign out with Discord ID
-	http.HandleFunc("/export-members", wrapRoute(handleExportMembers))          // GET: export members as json file
-	http.HandleFunc("/import-members", wrapRoute(handleImportMembers))          // POST: import members from json file
+	// Read or change the log level at runtime, debug logs redacted request and response bodies
+	http.HandleFunc("/admin/log-level", wrapRoute(handleLogLevel, "GET", "PUT"))
+
+	// Checkpoint the WAL, optimize and vacuum the database now (?vacuum=true)
+	http.HandleFunc("/admin/maintenance", wrapRoute(handleMaintenance, "POST"))
+
+	// Latest database integrity check, 503 while it fails (no API key needed)
+	http.HandleFunc("/healthz", corsMiddleware(methodsMiddleware(handleHealthz, "GET"), "GET"))
+
+	// Subscribe side effects (goal checks, alerts, office notifications, metrics) to the event bus
+	subscribeEventHandlers()
+
+	// Drop or close open sessions that no longer match members and visits
+	reconcileAttendees(time.Now())
 
 	// Start Nightly Cleanup Goroutine
 	go startNightlyCleanup()
 
-	// Start Server
-	port := ":8080"
-	log.Printf("Server starting on port %s...", port)
-	if err := http.ListenAndServe(port, nil); err != nil {
+	// Start the cleanups of organizations with their own cleanup hour
+	go startOrgCleanups()
+
+	// Start the device heartbeat monitor
+	go startDeviceMonitor()
+
+	// Load the live statistics and keep rebuilding them from the database
+	if err := liveStats.reconcile(time.Now()); err != nil {
+		log.Printf("Error loading live statistics: %v", err)
+	}
+	go startLiveStatsReconciler()
+
+	// Start saving API key usage
+	go startAPIKeyUsageFlusher()
+
+	// Start the buddy rule monitor
+	if buddyRuleAfter > 0 {
+		go startBuddyRuleMonitor()
+	}
+
+	// Start the periodic database integrity check
+	go startIntegrityMonitor(integrityCheckInterval)
+
+	// Start the periodic WAL checkpoint, optimize and vacuum
+	go startMaintenance(maintenanceInterval, maintenanceVacuumInterval)
+
+	// Start sending spans to the OTLP collector
+	if tr := activeTracer.Load(); tr != nil {
+		go tr.startTraceExporter()
+		log.Printf("Tracing enabled, exporting to %s", tr.endpoint)
+	}
+	if activeErrorReporter != nil {
+		go activeErrorReporter.startErrorReporter()
+		log.Printf("Error tracking enabled (environment %s, release %q)", activeErrorReporter.environment, activeErrorReporter.release)
+	}
+
+	// Start delivering scheduled reports
+	go startReportScheduler()
+
+	// Start discarding remote sign-ins not confirmed in time
+	go startRemoteSignInMonitor()
+
+	// Start marking access grants that ran out as expired
+	go startAccessGrantSweeper()
+
+	// Purge members deleted more than 30 days ago
+	go startTrashPurger()
+
+	// Start the scanner mTLS listener if configured
+	if addr := os.Getenv("MTLS_LISTEN_ADDR"); addr != "" || mtlsListener != nil {
+		ln, err := listenMTLS(addr, mtlsListener)
+		if err != nil {
+			log.Fatal("mTLS listener: ", err)
+		}
+		go startMTLSServer(ln)
+	}
+
+	// Open the LISTEN_ADDR listeners, or take the sockets passed by systemd
+	apiListeners, err := openListeners(listenConfigs, listeners)
+	if err != nil {
 		log.Fatal(err)
 	}
+	addrs := make([]string, len(apiListeners))
+	for i, l := range apiListeners {
+		addrs[i] = l.config.String()
+	}
+
+	// Tell systemd the server is ready, and keep its watchdog fed (optional)
+	if err := sdNotify("READY=1\nSTATUS=Serving on " + strings.Join(addrs, ", ")); err != nil {
+		log.Printf("Warning: notifying systemd failed: %v", err)
+	}
+	if watchdog > 0 {
+		go startWatchdog(watchdog)
+		log.Printf("systemd watchdog enabled, notifying every %s", watchdog/2)
+	}
+
+	// Start Server
+	serveErrs := make(chan error, len(apiListeners))
+	for _, l := range apiListeners {
+		log.Printf("Server starting on %s...", l.config)
+		go func() {
+			serveErrs <- http.Serve(l.listener, basePathMiddleware(l.config.handler(http.DefaultServeMux)))
+		}()
+	}
+	log.Fatal(<-serveErrs)
 }
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"database/sql"
 	"encoding/json"
 	"fmt"
@@ -9,6 +10,7 @@ import (
 	"net/http/httptest"
 	"os"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -21,22 +23,73 @@ import (
 
 // setupTest resets global state for a clean testing environment
 func setupTest() {
+	// Let side effects of the previous test finish before resetting state
+	subscribeEventHandlers()
+	events.wait()
+	jobs.wait()
+
 	// Ensure data folder exists for file-based helpers used by handlers
 	if err := os.MkdirAll(dataFolder, 0o755); err != nil {
 		panic(err)
 	}
 
 	// Reset User DB
-	userDB = map[string]Member{
+	testMembers := map[string]Member{
 		"TEST_UID_1": {ID: 1, Name: "Alice", UID: "TEST_UID_1", DiscordID: "111111111"},
 		"TEST_UID_2": {ID: 2, Name: "Bob", UID: "TEST_UID_2", DiscordID: "222222222"},
 	}
+	statelessMode = false
+	memberCache = newMemberStore()
+	memberCache.replace(testMembers)
 
 	// Reset Active Attendees
-	currentAttendees = make(map[string]time.Time)
+	sharedStateClient = nil
+	currentAttendees = newAttendeeStore()
 
 	// Reset scan history
-	scanHistory = nil
+	scanHistory.reset()
+	announcements.reset()
+	liveStats = newLiveStatsStore()
+	renderedResponses.reset()
+	scanResults.reset()
+	polledEvents.reset()
+	deviceChannels.reset()
+	doorRelay = nil
+	twoPersonApproval = 0
+	sessionLedgerKey = nil
+
+	// Reset network policy, load shedding and reverse proxy settings
+	networkPolicies = nil
+	heavyReads = nil
+	trustedProxies = trustedProxyConfig{}
+	basePath = ""
+
+	// Photos on disk, tests that upload any use usePhotoDir
+	activePhotoStorage = diskPhotoStorage{dir: photosFolder}
+	discordAvatars.reset()
+
+	// Tracing off unless a test records spans, info log level
+	activeTracer.Store(nil)
+	activeErrorReporter = nil
+	logLevel = defaultLogLevel()
+
+	// Reset auth failure tracking, network rejections, API key usage and metrics
+	resetAuthFailures()
+	resetNetworkRejections()
+	apiKeyUsage = &apiKeyUsageCounter{counts: make(map[[2]string]*apiKeyUsageCount)}
+	resetMetrics()
+
+	// Reset API key scopes and organizations
+	apiKeyScopes = nil
+	apiKeyOrgs = nil
+
+	// Reset CORS configuration
+	corsSettings = corsConfig{AllowAll: true}
+
+	// Reset mTLS configuration
+	mtlsClientCAs = nil
+	mtlsCACert = nil
+	mtlsCAKey = nil
 
 	// Reset Database (Use in-memory DB for speed)
 	if db != nil {
@@ -48,6 +101,8 @@ func setupTest() {
 	if err != nil {
 		panic(err)
 	}
+	// Each connection to :memory: is a separate, empty database
+	db.SetMaxOpenConns(1)
 
 	// Set WAL journal mode
 	if _, err := db.Exec(`PRAGMA journal_mode = WAL;`); err != nil {
@@ -73,8 +128,8 @@ func setupTest() {
 		panic(err)
 	}
 
-	// Seed members according to userDB
-	for _, m := range userDB {
+	// Seed members according to the cache
+	for _, m := range testMembers {
 		if _, err := db.Exec(`INSERT INTO members (id, name, uid, discord_id) VALUES (?, ?, ?, ?)`, m.ID, m.Name, m.UID, m.DiscordID); err != nil {
 			panic(err)
 		}
@@ -90,6 +145,17 @@ func setupTest() {
 	if _, err := db.Exec(createVisitsSQL); err != nil {
 		panic(err)
 	}
+
+	// Create supporting tables
+	if err := createTables(); err != nil {
+		panic(err)
+	}
+}
+
+// cachedMember returns the cached member of a UID (zero Member if unknown)
+func cachedMember(uid string) Member {
+	m, _ := memberCache.get(uid)
+	return m
 }
 
 // ============================================================================
@@ -146,7 +212,7 @@ func TestHandleScan_Login(t *testing.T) {
 	}
 
 	// Verify Internal State
-	if _, inside := currentAttendees["TEST_UID_1"]; !inside {
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
 		t.Error("Alice should be in currentAttendees map")
 	}
 }
@@ -155,7 +221,7 @@ func TestHandleScan_Logout(t *testing.T) {
 	setupTest()
 
 	// Pre-condition: Alice is already inside
-	currentAttendees["TEST_UID_1"] = time.Now().Add(-1 * time.Hour) // Entered 1 hour ago
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-1*time.Hour)) // Entered 1 hour ago
 
 	// Alice taps again
 	payload := []byte(`{"uid": "TEST_UID_1"}`)
@@ -172,7 +238,7 @@ func TestHandleScan_Logout(t *testing.T) {
 	}
 
 	// Verify she was removed from memory
-	if _, inside := currentAttendees["TEST_UID_1"]; inside {
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
 		t.Error("Alice should have been removed from currentAttendees")
 	}
 
@@ -234,6 +300,51 @@ func TestHandleMembers_Create(t *testing.T) {
 	}
 }
 
+func TestHandleMembers_CreateWithRole(t *testing.T) {
+	setupTest()
+
+	payload := []byte(`{"name":"Charlie","uid":"TEST_UID_3","discord_id":"333333333","role":"exec"}`)
+	req, _ := http.NewRequest("POST", "/members", bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+
+	handleMembers(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected status 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if cachedMember("TEST_UID_3").Role != roleExec {
+		t.Errorf("expected cached role exec, got %q", cachedMember("TEST_UID_3").Role)
+	}
+
+	// Role defaults to member
+	payload = []byte(`{"name":"Dan","uid":"TEST_UID_4","discord_id":"444444444"}`)
+	req, _ = http.NewRequest("POST", "/members", bytes.NewBuffer(payload))
+	rr = httptest.NewRecorder()
+	handleMembers(rr, req)
+
+	var m Member
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("failed to parse response JSON: %v", err)
+	}
+	if m.Role != roleMember {
+		t.Errorf("expected default role member, got %q", m.Role)
+	}
+}
+
+func TestHandleMembers_CreateInvalidRole(t *testing.T) {
+	setupTest()
+
+	payload := []byte(`{"name":"Charlie","uid":"TEST_UID_3","discord_id":"333333333","role":"president"}`)
+	req, _ := http.NewRequest("POST", "/members", bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+
+	handleMembers(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
 func TestHandleMembers_CreateDuplicate(t *testing.T) {
 	setupTest()
 
@@ -331,6 +442,21 @@ func TestHandleMembers_List(t *testing.T) {
 	}
 }
 
+func TestHandleMembers_RoleFilter(t *testing.T) {
+	setupTest()
+	db.Exec(`UPDATE members SET role = 'officer' WHERE id = 1`)
+
+	req, _ := http.NewRequest("GET", "/members?role=officer", nil)
+	rr := httptest.NewRecorder()
+	handleMembers(rr, req)
+
+	var members []Member
+	json.Unmarshal(rr.Body.Bytes(), &members)
+	if len(members) != 1 || members[0].Name != "Alice" || members[0].Role != roleOfficer {
+		t.Errorf("expected only Alice, got %+v", members)
+	}
+}
+
 // ============================================================================
 // /count, /current, /health Endpoint Tests
 // ============================================================================
@@ -361,8 +487,8 @@ func TestHandleCount_WithAttendees(t *testing.T) {
 	setupTest()
 
 	// Add two attendees
-	currentAttendees["TEST_UID_1"] = time.Now()
-	currentAttendees["TEST_UID_2"] = time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+	currentAttendees.signIn("TEST_UID_2", "", time.Now())
 
 	req, _ := http.NewRequest("GET", "/count", nil)
 	rr := httptest.NewRecorder()
@@ -383,6 +509,90 @@ func TestHandleCount_WithAttendees(t *testing.T) {
 	}
 }
 
+func TestHandleCount_Detailed(t *testing.T) {
+	setupTest()
+
+	memberCache.replace(map[string]Member{
+		"TEST_UID_1": cachedMember("TEST_UID_1"),
+		"TEST_UID_2": cachedMember("TEST_UID_2"),
+		"TEST_UID_3": {ID: 3, Name: "Carol", UID: "TEST_UID_3", DiscordID: "333333333", Role: roleExec},
+		"TEST_UID_4": {ID: 4, Name: "Dan", UID: "TEST_UID_4", DiscordID: "444444444", Role: roleGuest},
+	})
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+	performSignIn(context.Background(), cachedMember("TEST_UID_2"), "lab")
+	performSignIn(context.Background(), cachedMember("TEST_UID_3"), "lab")
+	performSignIn(context.Background(), cachedMember("TEST_UID_4"), "")
+
+	req, _ := http.NewRequest("GET", "/count?detailed=true", nil)
+	rr := httptest.NewRecorder()
+
+	handleCount(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	var resp CountBreakdown
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if resp.Total != 4 {
+		t.Errorf("expected total 4, got %d", resp.Total)
+	}
+	if resp.ByRoom[defaultRoom] != 2 || resp.ByRoom["lab"] != 2 {
+		t.Errorf("expected 2 in %s and 2 in lab, got %v", defaultRoom, resp.ByRoom)
+	}
+	if resp.Members != 2 || resp.Execs != 1 || resp.Guests != 1 {
+		t.Errorf("expected 2 members, 1 exec, 1 guest, got %+v", resp)
+	}
+}
+
+func TestHandleCount_DetailedEmpty(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/count?detailed=true", nil)
+	rr := httptest.NewRecorder()
+
+	handleCount(rr, req)
+
+	var resp CountBreakdown
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if resp.Total != 0 || resp.ByRoom == nil || len(resp.ByRoom) != 0 {
+		t.Errorf("expected empty breakdown, got %+v", resp)
+	}
+}
+
+func TestHandleScan_RecordsRoom(t *testing.T) {
+	setupTest()
+
+	body := []byte(`{"uid": "TEST_UID_1", "room": "lab"}`)
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+
+	handleScan(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if room, _ := currentAttendees.room("TEST_UID_1"); room != "lab" {
+		t.Errorf("expected room lab, got %q", room)
+	}
+
+	// Signing out clears the room
+	req, _ = http.NewRequest("POST", "/scan", bytes.NewBuffer(body))
+	rr = httptest.NewRecorder()
+	handleScan(rr, req)
+
+	if _, ok := currentAttendees.room("TEST_UID_1"); ok {
+		t.Error("expected room to be cleared on sign-out")
+	}
+}
+
 func TestHandleCurrent_Empty(t *testing.T) {
 	setupTest()
 
@@ -408,8 +618,8 @@ func TestHandleCurrent_WithAttendees(t *testing.T) {
 	setupTest()
 
 	// Add attendees
-	currentAttendees["TEST_UID_1"] = time.Now().Add(-10 * time.Minute)
-	currentAttendees["TEST_UID_2"] = time.Now().Add(-5 * time.Minute)
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-10*time.Minute))
+	currentAttendees.signIn("TEST_UID_2", "", time.Now().Add(-5*time.Minute))
 
 	req, _ := http.NewRequest("GET", "/current", nil)
 	rr := httptest.NewRecorder()
@@ -427,7 +637,7 @@ func TestHandleCurrent_WithAttendees(t *testing.T) {
 	if len(list) != 2 {
 		t.Fatalf("expected 2 attendees, got %d", len(list))
 	}
-	// Names should match userDB mapping
+	// Names should match the member cache
 	names := map[string]bool{"Alice": false, "Bob": false}
 	for _, a := range list {
 		if _, ok := names[a.Name]; ok {
@@ -1636,8 +1846,8 @@ func TestHandleSignoutAll_NoAttendees(t *testing.T) {
 	}
 
 	// Verify attendees map is empty
-	if len(currentAttendees) != 0 {
-		t.Errorf("expected currentAttendees to be empty, got %d", len(currentAttendees))
+	if currentAttendees.count() != 0 {
+		t.Errorf("expected currentAttendees to be empty, got %d", currentAttendees.count())
 	}
 }
 
@@ -1645,8 +1855,8 @@ func TestHandleSignoutAll_WithAttendees(t *testing.T) {
 	setupTest()
 
 	// Add three attendees
-	currentAttendees["TEST_UID_1"] = time.Now().Add(-30 * time.Minute)
-	currentAttendees["TEST_UID_2"] = time.Now().Add(-20 * time.Minute)
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-30*time.Minute))
+	currentAttendees.signIn("TEST_UID_2", "", time.Now().Add(-20*time.Minute))
 
 	req, _ := http.NewRequest("POST", "/signout_all", nil)
 	rr := httptest.NewRecorder()
@@ -1657,18 +1867,24 @@ func TestHandleSignoutAll_WithAttendees(t *testing.T) {
 		t.Fatalf("expected 200 OK, got %v", rr.Code)
 	}
 
-	var resp map[string]string
+	var resp struct {
+		Message     string `json:"message"`
+		OperationID int64  `json:"operation_id"`
+	}
 	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
 		t.Fatalf("failed to parse response: %v", err)
 	}
 
-	if !bytes.Contains([]byte(resp["message"]), []byte("2 total")) {
-		t.Errorf("expected message to contain '2 total', got %q", resp["message"])
+	if !bytes.Contains([]byte(resp.Message), []byte("2 total")) {
+		t.Errorf("expected message to contain '2 total', got %q", resp.Message)
+	}
+	if resp.OperationID == 0 {
+		t.Errorf("expected an operation ID to undo it, got %s", rr.Body.String())
 	}
 
 	// Verify attendees map is cleared
-	if len(currentAttendees) != 0 {
-		t.Errorf("expected currentAttendees to be empty, got %d", len(currentAttendees))
+	if currentAttendees.count() != 0 {
+		t.Errorf("expected currentAttendees to be empty, got %d", currentAttendees.count())
 	}
 }
 
@@ -1690,44 +1906,43 @@ func TestHandleSignoutAll_MethodNotAllowed(t *testing.T) {
 // Nightly Cleanup Tests
 // ============================================================================
 
+func TestNextNightlyCleanup(t *testing.T) {
+	loc := time.Local
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 3, 10, 2, 0, 0, 0, loc), time.Date(2025, 3, 10, nightlyCleanupHour, 0, 0, 0, loc)},
+		{time.Date(2025, 3, 10, 9, 0, 0, 0, loc), time.Date(2025, 3, 11, nightlyCleanupHour, 0, 0, 0, loc)},
+		{time.Date(2025, 3, 10, nightlyCleanupHour, 0, 0, 0, loc), time.Date(2025, 3, 11, nightlyCleanupHour, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := nextNightlyCleanup(tt.now); !got.Equal(tt.want) {
+			t.Errorf("nextNightlyCleanup(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
 func TestStartNightlyCleanup_SignOutAllAttendees(t *testing.T) {
 	setupTest()
 
 	// Simulate some attendees being signed in
 	now := time.Now()
-	currentAttendees["TEST_UID_1"] = now.Add(-2 * time.Hour)
-	currentAttendees["TEST_UID_2"] = now.Add(-3 * time.Hour)
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-2*time.Hour))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-3*time.Hour))
 
 	// Record visits before cleanup
 	var visitsBefore int
 	db.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visitsBefore)
 
-	// Manually run cleanup logic (instead of waiting for goroutine)
-	mu.Lock()
-	cnt := len(currentAttendees)
-	toSignOut := make(map[string]time.Time, cnt)
-	for uid, signin := range currentAttendees {
-		toSignOut[uid] = signin
-	}
-	currentAttendees = make(map[string]time.Time)
-	mu.Unlock()
-
-	// Process sign-outs
-	for uid, signin := range toSignOut {
-		mu.RLock()
-		member, ok := userDB[uid]
-		mu.RUnlock()
-		if !ok {
-			t.Fatalf("member not found: %s", uid)
-		}
-		if err := saveVisitToDB(member.ID, signin, time.Now()); err != nil {
-			t.Fatalf("failed to save visit: %v", err)
-		}
+	// Run the cleanup directly (instead of waiting for goroutine)
+	if cnt := signOutAll("the nightly cleanup"); cnt != 2 {
+		t.Errorf("expected 2 people signed out, got %d", cnt)
 	}
 
 	// Verify all attendees were signed out
-	if len(currentAttendees) != 0 {
-		t.Errorf("expected currentAttendees to be empty, got %d attendees", len(currentAttendees))
+	if currentAttendees.count() != 0 {
+		t.Errorf("expected currentAttendees to be empty, got %d attendees", currentAttendees.count())
 	}
 
 	// Verify visits were recorded
@@ -1742,24 +1957,18 @@ func TestStartNightlyCleanup_NoAttendees(t *testing.T) {
 	setupTest()
 
 	// Verify no attendees signed in initially
-	if len(currentAttendees) != 0 {
-		t.Fatalf("expected no attendees initially, got %d", len(currentAttendees))
+	if currentAttendees.count() != 0 {
+		t.Fatalf("expected no attendees initially, got %d", currentAttendees.count())
 	}
 
-	// Manually run cleanup logic with no attendees
-	mu.Lock()
-	cnt := len(currentAttendees)
-	currentAttendees = make(map[string]time.Time)
-	mu.Unlock()
-
 	// Should complete without error and not attempt sign-out
-	if cnt != 0 {
+	if cnt := signOutAll("the nightly cleanup"); cnt != 0 {
 		t.Errorf("expected cnt to be 0, got %d", cnt)
 	}
 
 	// Verify currentAttendees is still empty
-	if len(currentAttendees) != 0 {
-		t.Errorf("expected currentAttendees to remain empty, got %d", len(currentAttendees))
+	if currentAttendees.count() != 0 {
+		t.Errorf("expected currentAttendees to remain empty, got %d", currentAttendees.count())
 	}
 }
 
@@ -1767,37 +1976,21 @@ func TestStartNightlyCleanup_UnknownUID(t *testing.T) {
 	setupTest()
 
 	// Add an attendee with unknown UID
-	now := time.Now()
-	currentAttendees["UNKNOWN_UID"] = now.Add(-2 * time.Hour)
-
-	// Manually run cleanup logic
-	mu.Lock()
-	cnt := len(currentAttendees)
-	toSignOut := make(map[string]time.Time, cnt)
-	for uid, signin := range currentAttendees {
-		toSignOut[uid] = signin
-	}
-	currentAttendees = make(map[string]time.Time)
-	mu.Unlock()
-
-	// Process sign-outs, unknown UID should be skipped
-	skipped := 0
-	for uid, signin := range toSignOut {
-		mu.RLock()
-		member, ok := userDB[uid]
-		mu.RUnlock()
-		if !ok {
-			skipped++
-			continue
-		}
-		if err := saveVisitToDB(member.ID, signin, time.Now()); err != nil {
-			t.Fatalf("failed to save visit: %v", err)
-		}
-	}
+	currentAttendees.signIn("UNKNOWN_UID", "", time.Now().Add(-2*time.Hour))
+
+	var visitsBefore int
+	db.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visitsBefore)
+
+	// Unknown UID should be skipped but still cleared
+	signOutAll("the nightly cleanup")
 
-	// Verify unknown UID was skipped
-	if skipped != 1 {
-		t.Errorf("expected 1 unknown UID to be skipped, got %d", skipped)
+	var visitsAfter int
+	db.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visitsAfter)
+	if visitsAfter != visitsBefore {
+		t.Errorf("expected no visit for the unknown UID, before=%d after=%d", visitsBefore, visitsAfter)
+	}
+	if currentAttendees.count() != 0 {
+		t.Errorf("expected currentAttendees to be empty, got %d", currentAttendees.count())
 	}
 }
 
@@ -1805,36 +1998,15 @@ func TestStartNightlyCleanup_MixedValidAndInvalidUIDs(t *testing.T) {
 	setupTest()
 
 	now := time.Now()
-	currentAttendees["TEST_UID_1"] = now.Add(-2 * time.Hour)
-	currentAttendees["UNKNOWN_UID"] = now.Add(-1 * time.Hour)
-	currentAttendees["TEST_UID_2"] = now.Add(-3 * time.Hour)
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-2*time.Hour))
+	currentAttendees.signIn("UNKNOWN_UID", "", now.Add(-1*time.Hour))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-3*time.Hour))
 
 	// Record visits before cleanup
 	var visitsBefore int
 	db.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visitsBefore)
 
-	// Manually run cleanup logic
-	mu.Lock()
-	cnt := len(currentAttendees)
-	toSignOut := make(map[string]time.Time, cnt)
-	for uid, signin := range currentAttendees {
-		toSignOut[uid] = signin
-	}
-	currentAttendees = make(map[string]time.Time)
-	mu.Unlock()
-
-	// Process sign-outs
-	for uid, signin := range toSignOut {
-		mu.RLock()
-		member, ok := userDB[uid]
-		mu.RUnlock()
-		if !ok {
-			continue // Skip unknown UIDs
-		}
-		if err := saveVisitToDB(member.ID, signin, time.Now()); err != nil {
-			t.Fatalf("failed to save visit: %v", err)
-		}
-	}
+	signOutAll("the nightly cleanup")
 
 	// Verify only valid members were signed out
 	var visitsAfter int
@@ -1911,7 +2083,7 @@ func TestHandleExportMembers_EmptyMembers(t *testing.T) {
 	if err != nil {
 		t.Fatalf("failed to clear members: %v", err)
 	}
-	userDB = make(map[string]Member)
+	memberCache.replace(make(map[string]Member))
 
 	req, _ := http.NewRequest("GET", "/export_members", nil)
 	rr := httptest.NewRecorder()
@@ -2133,7 +2305,7 @@ func TestHandleSignInWithDiscordID_Success(t *testing.T) {
 	}
 
 	// Verify member is in currentAttendees
-	if _, inside := currentAttendees["TEST_UID_1"]; !inside {
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
 		t.Error("Alice should be in currentAttendees map")
 	}
 }
@@ -2156,7 +2328,7 @@ func TestHandleSignInWithDiscordID_AlreadySignedIn(t *testing.T) {
 	setupTest()
 
 	// Pre-condition: Alice is already signed in
-	currentAttendees["TEST_UID_1"] = time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
 
 	payload := []byte(`{"discord_id":"111111111"}`)
 	req, _ := http.NewRequest("POST", "/signin_discord", bytes.NewBuffer(payload))
@@ -2169,6 +2341,40 @@ func TestHandleSignInWithDiscordID_AlreadySignedIn(t *testing.T) {
 	}
 }
 
+func TestHandleSignInWithDiscordID_ConcurrentRequests(t *testing.T) {
+	setupTest()
+
+	// Bot and scanner traffic racing to sign Alice in: exactly one may succeed
+	codes := make(chan int, 20)
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest("POST", "/signin_discord", bytes.NewBufferString(`{"discord_id":"111111111"}`))
+			rr := httptest.NewRecorder()
+			handleSignInWithDiscordID(rr, req)
+			codes <- rr.Code
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	succeeded := 0
+	for code := range codes {
+		switch code {
+		case http.StatusOK:
+			succeeded++
+		case http.StatusConflict:
+		default:
+			t.Errorf("unexpected status %v", code)
+		}
+	}
+	if succeeded != 1 {
+		t.Errorf("expected exactly one successful sign-in, got %d", succeeded)
+	}
+}
+
 func TestHandleSignInWithDiscordID_InvalidJSON(t *testing.T) {
 	setupTest()
 
@@ -2200,7 +2406,7 @@ func TestHandleSignOutWithDiscordID_Success(t *testing.T) {
 	setupTest()
 
 	// Pre-condition: Alice is already signed in
-	currentAttendees["TEST_UID_1"] = time.Now().Add(-1 * time.Hour)
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-1*time.Hour))
 
 	payload := []byte(`{"discord_id":"111111111"}`)
 	req, _ := http.NewRequest("POST", "/signout_discord", bytes.NewBuffer(payload))
@@ -2222,7 +2428,7 @@ func TestHandleSignOutWithDiscordID_Success(t *testing.T) {
 	}
 
 	// Verify member is removed from currentAttendees
-	if _, inside := currentAttendees["TEST_UID_1"]; inside {
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
 		t.Error("Alice should be removed from currentAttendees map")
 	}
 
@@ -2686,9 +2892,55 @@ func TestHandleMember_UpdateSuccess(t *testing.T) {
 		t.Fatalf("expected updated values, got name=%q uid=%q discord_id=%q", name, uid, discordID)
 	}
 
-	// Verify cache was reloaded
-	if userDB["TEST_UID_1"].Name != "Alice Updated" {
-		t.Fatalf("cache not updated, got name=%q", userDB["TEST_UID_1"].Name)
+	// Verify cache was updated
+	if cachedMember("TEST_UID_1").Name != "Alice Updated" {
+		t.Fatalf("cache not updated, got name=%q", cachedMember("TEST_UID_1").Name)
+	}
+}
+
+func TestHandleMember_UpdateUIDMovesCacheEntry(t *testing.T) {
+	setupTest()
+
+	payload := []byte(`{"name":"Alice","uid":"NEW_UID","discord_id":"111111111"}`)
+	req, _ := http.NewRequest("PUT", "/members/1", bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	if _, ok := memberCache.get("TEST_UID_1"); ok {
+		t.Error("expected the old UID to be dropped from the cache")
+	}
+	if m, ok := memberCache.get("NEW_UID"); !ok || m.ID != 1 {
+		t.Errorf("expected the new UID to resolve to Alice, got %+v", m)
+	}
+}
+
+func TestHandleMember_UpdateRole(t *testing.T) {
+	setupTest()
+
+	payload := []byte(`{"name":"Alice","uid":"TEST_UID_1","discord_id":"111111111","role":"exec"}`)
+	req, _ := http.NewRequest("PUT", "/members/1", bytes.NewBuffer(payload))
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected status 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	// Omitting role keeps the existing one
+	payload = []byte(`{"name":"Alice L","uid":"TEST_UID_1","discord_id":"111111111"}`)
+	req, _ = http.NewRequest("PUT", "/members/1", bytes.NewBuffer(payload))
+	rr = httptest.NewRecorder()
+	handleMember(rr, req)
+
+	var m Member
+	if err := json.Unmarshal(rr.Body.Bytes(), &m); err != nil {
+		t.Fatalf("failed to parse response JSON: %v", err)
+	}
+	if m.Role != roleExec || m.Name != "Alice L" {
+		t.Errorf("expected Alice L with role exec, got %+v", m)
 	}
 }
 
@@ -2796,7 +3048,7 @@ func TestHandleMember_UpdateNoID(t *testing.T) {
 func TestHandleMember_MethodNotAllowed(t *testing.T) {
 	setupTest()
 
-	req, _ := http.NewRequest("GET", "/members/1", nil)
+	req, _ := http.NewRequest("POST", "/members/1", nil)
 	rr := httptest.NewRecorder()
 
 	handleMember(rr, req)
@@ -2806,6 +3058,64 @@ func TestHandleMember_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestHandleMember_Get(t *testing.T) {
+	setupTest()
+
+	getMember := func() MemberDetails {
+		t.Helper()
+		req, _ := http.NewRequest("GET", "/members/1", nil)
+		rr := httptest.NewRecorder()
+		handleMember(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+		}
+		var details MemberDetails
+		if err := json.Unmarshal(rr.Body.Bytes(), &details); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return details
+	}
+
+	details := getMember()
+	if details.ID != 1 || details.Name != "Alice" || details.UID != "TEST_UID_1" || details.DiscordID != "111111111" {
+		t.Errorf("unexpected member: %+v", details.Member)
+	}
+	if details.Consent.MemberID != 1 || details.Consent.Required || !details.Consent.Named || details.Consent.Latest != nil {
+		t.Errorf("expected no consent recorded and none required, got %+v", details.Consent)
+	}
+	if details.Privacy.Alias != "" || details.Privacy.Visibility != visibilityFull {
+		t.Errorf("expected full visibility under their name by default, got %+v", details.Privacy)
+	}
+
+	// An alias and visibility change how Alice is shown elsewhere, not their record
+	for _, body := range []string{`{"alias":"Ace","visibility":"initials"}`, `{"alias":"Ace","visibility":"hidden"}`} {
+		req, _ := http.NewRequest("PUT", "/members/1/privacy", bytes.NewBufferString(body))
+		rr := httptest.NewRecorder()
+		handleMember(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+		}
+
+		details := getMember()
+		var want PrivacyPreferences
+		json.Unmarshal([]byte(body), &want)
+		if details.Name != "Alice" || details.Privacy.Alias != want.Alias || details.Privacy.Visibility != want.Visibility {
+			t.Errorf("%s: expected Alice with their preferences, got %+v", body, details)
+		}
+	}
+	alice, _ := findMemberByID(1)
+	if name := publicName(alice, scopeMember); name != "" {
+		t.Errorf("expected hidden Alice left unnamed outside the admin view, got %q", name)
+	}
+
+	req, _ := http.NewRequest("GET", "/members/99", nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown member, got %v", rr.Code)
+	}
+}
+
 func TestHandleMember_UpdateWithWhitespace(t *testing.T) {
 	setupTest()
 
@@ -2860,9 +3170,9 @@ func TestHandleMember_DeleteSuccess(t *testing.T) {
 		t.Fatalf("unexpected message: %v", resp["message"])
 	}
 
-	// Verify member is deleted from DB
+	// Verify member is deleted from DB, into the trash
 	var count int
-	err := db.QueryRow(`SELECT COUNT(*) FROM members WHERE id = ?`, 1).Scan(&count)
+	err := db.QueryRow(`SELECT COUNT(*) FROM members WHERE id = ? AND deleted_at IS NULL`, 1).Scan(&count)
 	if err != nil {
 		t.Fatalf("error querying DB: %v", err)
 	}
@@ -2871,9 +3181,7 @@ func TestHandleMember_DeleteSuccess(t *testing.T) {
 	}
 
 	// Verify cache was updated
-	mu.RLock()
-	_, exists := userDB["TEST_UID_1"]
-	mu.RUnlock()
+	_, exists := memberCache.get("TEST_UID_1")
 	if exists {
 		t.Fatalf("member should be removed from cache")
 	}
@@ -2897,7 +3205,7 @@ func TestHandleMember_DeleteSignedInMember(t *testing.T) {
 	setupTest()
 
 	// Sign in Alice
-	currentAttendees["TEST_UID_1"] = time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
 
 	// Try to delete Alice while she's signed in
 	req, _ := http.NewRequest("DELETE", "/members/1", nil)
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// --- Database Maintenance ---
+//
+// SQLite only shrinks the WAL file at a checkpoint that finds no reader, so
+// on a busy server it can grow to hundreds of MB. Every MAINTENANCE_INTERVAL
+// (default 1h) the WAL is checkpointed and truncated and PRAGMA optimize
+// refreshes the query planner statistics. Once every VACUUM_INTERVAL (default
+// 7 days, tracked in maintenance_runs so restarts do not reset it) the
+// database is also rebuilt with VACUUM to return free pages to the disk.
+// Each run also deletes expired webhook deliveries (see webhooks.go).
+// VACUUM blocks writes while it runs, so it waits for the office to be empty.
+//
+// Sizes before and after the latest run are exposed at /metrics;
+// POST /admin/maintenance runs it immediately.
+
+const (
+	defaultMaintenanceInterval = time.Hour
+	defaultVacuumInterval      = 7 * 24 * time.Hour
+)
+
+// maintenanceVacuumInterval is how often the database is vacuumed
+var maintenanceVacuumInterval = defaultVacuumInterval
+
+// MaintenanceReport is the outcome of a maintenance run
+type MaintenanceReport struct {
+	StartedAt       time.Time `json:"started_at"`
+	DurationMs      int64     `json:"duration_ms"`
+	SizeBefore      int64     `json:"size_before_bytes"` // Database pages, including those still in the WAL
+	SizeAfter       int64     `json:"size_after_bytes"`
+	WALBefore       int64     `json:"wal_before_bytes"`
+	WALAfter        int64     `json:"wal_after_bytes"`
+	CheckpointBusy  bool      `json:"checkpoint_busy"` // A reader kept the checkpoint from completing
+	Vacuumed        bool      `json:"vacuumed"`
+	VacuumPostponed bool      `json:"vacuum_postponed,omitempty"` // Due, but people are signed in
+
+	WebhookDeliveriesPruned int64 `json:"webhook_deliveries_pruned"` // Older than webhookDeliveryRetention
+}
+
+// loadMaintenanceDuration reads a maintenance interval (a Go duration such as 30m)
+func loadMaintenanceDuration(name string, def time.Duration) (time.Duration, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return def, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// databaseSize returns the size of the database pages and of the WAL file
+func databaseSize() (int64, int64, error) {
+	var pages, pageSize int64
+	if err := db.QueryRow(`PRAGMA page_count`).Scan(&pages); err != nil {
+		return 0, 0, err
+	}
+	if err := db.QueryRow(`PRAGMA page_size`).Scan(&pageSize); err != nil {
+		return 0, 0, err
+	}
+
+	var wal int64
+	if info, err := os.Stat(databaseFilePath + "-wal"); err == nil {
+		wal = info.Size()
+	}
+	return pages * pageSize, wal, nil
+}
+
+// vacuumDue reports whether the last VACUUM is older than the interval
+func vacuumDue(now time.Time, interval time.Duration) (bool, error) {
+	var last string
+	err := db.QueryRow(`SELECT last_run_at FROM maintenance_runs WHERE task = 'vacuum'`).Scan(&last)
+	if err == sql.ErrNoRows {
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+	t, err := time.Parse(time.RFC3339, last)
+	return err != nil || now.Sub(t) >= interval, nil
+}
+
+// runMaintenance checkpoints the WAL, optimizes and, if due or forced and the
+// office is empty, vacuums the database
+func runMaintenance(now time.Time, vacuumInterval time.Duration, forceVacuum bool) (MaintenanceReport, error) {
+	report := MaintenanceReport{StartedAt: now}
+	start := time.Now()
+
+	var err error
+	if report.SizeBefore, report.WALBefore, err = databaseSize(); err != nil {
+		return report, err
+	}
+	if report.WebhookDeliveriesPruned, err = pruneWebhookDeliveries(now); err != nil {
+		return report, fmt.Errorf("prune webhook deliveries: %w", err)
+	}
+
+	due := forceVacuum
+	if !due {
+		if due, err = vacuumDue(now, vacuumInterval); err != nil {
+			return report, err
+		}
+	}
+	if due && currentAttendees.count() > 0 {
+		report.VacuumPostponed = true
+	} else if due {
+		if _, err := db.Exec(`VACUUM`); err != nil {
+			return report, fmt.Errorf("vacuum: %w", err)
+		}
+		if _, err := db.Exec(`INSERT INTO maintenance_runs (task, last_run_at) VALUES ('vacuum', ?)
+			ON CONFLICT(task) DO UPDATE SET last_run_at = excluded.last_run_at`, now.Format(time.RFC3339)); err != nil {
+			return report, err
+		}
+		report.Vacuumed = true
+		incCounter("database_vacuums_total")
+	}
+
+	// After VACUUM, which writes the whole database through the WAL
+	var busy, logFrames, checkpointed int
+	if err := db.QueryRow(`PRAGMA wal_checkpoint(TRUNCATE)`).Scan(&busy, &logFrames, &checkpointed); err != nil {
+		return report, fmt.Errorf("checkpoint: %w", err)
+	}
+	report.CheckpointBusy = busy != 0
+	if _, err := db.Exec(`PRAGMA optimize`); err != nil {
+		return report, fmt.Errorf("optimize: %w", err)
+	}
+
+	if report.SizeAfter, report.WALAfter, err = databaseSize(); err != nil {
+		return report, err
+	}
+	report.DurationMs = time.Since(start).Milliseconds()
+
+	incCounter("database_maintenance_runs_total")
+	setGauge("database_maintenance_size_before_bytes", float64(report.SizeBefore+report.WALBefore))
+	setGauge("database_maintenance_size_after_bytes", float64(report.SizeAfter+report.WALAfter))
+	return report, nil
+}
+
+// startMaintenance runs a goroutine doing database maintenance periodically
+func startMaintenance(interval, vacuumInterval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		report, err := runMaintenance(now, vacuumInterval, false)
+		if err != nil {
+			log.Printf("Database maintenance failed: %v", err)
+			continue
+		}
+		if report.Vacuumed || report.WALBefore != report.WALAfter {
+			log.Printf("Database maintenance: %d bytes (WAL %d) -> %d bytes (WAL %d), vacuumed=%t",
+				report.SizeBefore, report.WALBefore, report.SizeAfter, report.WALAfter, report.Vacuumed)
+		}
+	}
+}
+
+// handleMaintenance runs database maintenance now (POST)
+// Query parameters:
+//   - vacuum: true to vacuum even if not due (still postponed while anyone is inside)
+func handleMaintenance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	report, err := runMaintenance(time.Now(), maintenanceVacuumInterval, r.URL.Query().Get("vacuum") == "true")
+	if err != nil {
+		log.Printf("Error running database maintenance: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	recordAudit("database.maintenance", clientIP(r), fmt.Sprintf("vacuumed=%t, %d -> %d bytes",
+		report.Vacuumed, report.SizeBefore+report.WALBefore, report.SizeAfter+report.WALAfter))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
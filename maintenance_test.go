@@ -0,0 +1,99 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Database Maintenance Tests
+// ============================================================================
+
+func TestRunMaintenance_VacuumsWhenDue(t *testing.T) {
+	setupTest()
+	now := time.Now()
+
+	report, err := runMaintenance(now, time.Hour, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.Vacuumed || report.SizeBefore == 0 || report.SizeAfter == 0 {
+		t.Errorf("expected the first run to vacuum, got %+v", report)
+	}
+
+	// The last VACUUM is remembered, so the next run only checkpoints
+	report, err = runMaintenance(now.Add(30*time.Minute), time.Hour, false)
+	if err != nil || report.Vacuumed || report.VacuumPostponed {
+		t.Errorf("expected no vacuum before the interval, got %+v (err %v)", report, err)
+	}
+	if report, _ = runMaintenance(now.Add(time.Hour), time.Hour, false); !report.Vacuumed {
+		t.Errorf("expected a vacuum once the interval passed, got %+v", report)
+	}
+
+	metricsMu.Lock()
+	runs, vacuums := counters["database_maintenance_runs_total"], counters["database_vacuums_total"]
+	after := gauges["database_maintenance_size_after_bytes"]
+	metricsMu.Unlock()
+	if runs != 3 || vacuums != 2 || after == 0 {
+		t.Errorf("expected 3 runs, 2 vacuums and a size, got %v, %v and %v", runs, vacuums, after)
+	}
+}
+
+func TestRunMaintenance_PostponedWhileOccupied(t *testing.T) {
+	setupTest()
+	scanCard("TEST_UID_1")
+
+	report, err := runMaintenance(time.Now(), time.Hour, true)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Vacuumed || !report.VacuumPostponed {
+		t.Errorf("expected the vacuum postponed while Alice is inside, got %+v", report)
+	}
+	if due, _ := vacuumDue(time.Now(), time.Hour); !due {
+		t.Error("expected the vacuum to stay due")
+	}
+}
+
+func TestHandleMaintenance(t *testing.T) {
+	setupTest()
+
+	rr := httptest.NewRecorder()
+	handleMaintenance(rr, httptest.NewRequest("GET", "/admin/maintenance", nil))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %v", rr.Code)
+	}
+
+	// Not due after a first run, but forced
+	runMaintenance(time.Now(), time.Hour, false)
+	rr = httptest.NewRecorder()
+	handleMaintenance(rr, httptest.NewRequest("POST", "/admin/maintenance?vacuum=true", nil))
+	var report MaintenanceReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil || rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 with a report, got %v %s", rr.Code, rr.Body.String())
+	}
+	if !report.Vacuumed {
+		t.Errorf("expected a forced vacuum, got %+v", report)
+	}
+	if entries, _ := loadAuditEntries("database.maintenance", 10); len(entries) != 1 {
+		t.Errorf("expected an audit entry, got %d", len(entries))
+	}
+}
+
+func TestLoadMaintenanceDuration(t *testing.T) {
+	t.Setenv("VACUUM_INTERVAL", "")
+	if d, err := loadMaintenanceDuration("VACUUM_INTERVAL", defaultVacuumInterval); err != nil || d != defaultVacuumInterval {
+		t.Errorf("expected the default, got %v (err %v)", d, err)
+	}
+	t.Setenv("VACUUM_INTERVAL", "72h")
+	if d, err := loadMaintenanceDuration("VACUUM_INTERVAL", defaultVacuumInterval); err != nil || d != 72*time.Hour {
+		t.Errorf("expected 72h, got %v (err %v)", d, err)
+	}
+	t.Setenv("VACUUM_INTERVAL", "weekly")
+	if _, err := loadMaintenanceDuration("VACUUM_INTERVAL", defaultVacuumInterval); err == nil {
+		t.Error("expected an error for an invalid duration")
+	}
+}
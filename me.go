@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// --- Self-Service Member Portal ---
+//
+// The /me endpoints let a member look up their own status and hours. The
+// caller is identified through their linked Discord identity: a trusted
+// client (the Discord bot) authenticates with its API key and forwards the
+// member's Discord ID in the X-Discord-ID header.
+
+const discordIDHeader = "X-Discord-ID"
+
+// MeResponse describes the calling member and their current presence
+type MeResponse struct {
+	Member     Member     `json:"member"`
+	SignedIn   bool       `json:"signed_in"`
+	SignInTime *time.Time `json:"signin_time,omitempty"`
+}
+
+// MeStats summarises the calling member's completed visits
+type MeStats struct {
+	Term           string     `json:"term,omitempty"` // Term the totals cover, if any
+	VisitCount     int        `json:"visit_count"`
+	TotalSeconds   int64      `json:"total_seconds"`
+	TotalHours     float64    `json:"total_hours"`
+	LastVisit      *time.Time `json:"last_visit,omitempty"`
+	CurrentSeconds int64      `json:"current_session_seconds"`
+	SignedIn       bool       `json:"signed_in"`
+}
+
+// memberFromRequest resolves the calling member from the linked Discord identity header
+func memberFromRequest(w http.ResponseWriter, r *http.Request) (Member, bool) {
+	discordID := r.Header.Get(discordIDHeader)
+	if discordID == "" {
+		http.Error(w, discordIDHeader+" header required", http.StatusUnauthorized)
+		return Member{}, false
+	}
+
+	member, found := findMemberByDiscordID(discordID, requestOrg(r))
+	if !found {
+		http.Error(w, "No member linked to this Discord account", http.StatusNotFound)
+		return Member{}, false
+	}
+	return member, true
+}
+
+// handleMe returns the calling member's record and whether they are signed in
+func handleMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	signInTime, isInside, err := currentAttendees.get(member.UID)
+	if err != nil {
+		writeSignInOutError(w, fmt.Errorf("%w: %v", errAttendeeStore, err))
+		return
+	}
+	resp := MeResponse{Member: withPhotoURL(member)}
+	if isInside {
+		resp.SignedIn = true
+		resp.SignInTime = &signInTime
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// handleMeSessions returns the calling member's completed visits (newest first)
+// Query parameters:
+//   - from: RFC3339 formatted start date
+//   - to: RFC3339 formatted end date
+//   - limit: maximum number of records to return
+//   - times: corrected (default) or raw
+func handleMeSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	queryParams := r.URL.Query()
+	from := queryParams.Get("from")
+	to := queryParams.Get("to")
+
+	if from != "" {
+		if _, err := time.Parse(time.RFC3339, from); err != nil {
+			http.Error(w, "Invalid 'from' date format, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if to != "" {
+		if _, err := time.Parse(time.RFC3339, to); err != nil {
+			http.Error(w, "Invalid 'to' date format, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+
+	var limit int
+	if limitStr := queryParams.Get("limit"); limitStr != "" {
+		if n, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || n != 1 || limit < 0 {
+			http.Error(w, "Invalid 'limit' parameter, expected positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	visits, err := loadVisitsFromDB(memberOrg(member), from, to, member.ID, limit, times)
+	if err != nil {
+		log.Printf("Error loading visits for member %d: %v", member.ID, err)
+		http.Error(w, "Error loading visits", http.StatusInternalServerError)
+		return
+	}
+	if visits == nil {
+		visits = []Visit{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(visits)
+}
+
+// handleMeStats returns totals over the calling member's completed visits
+// Query parameters:
+//   - term: term name, or "all" (defaults to the current term if one is defined)
+//   - from: RFC3339 formatted start date
+//   - to: RFC3339 formatted end date
+//   - times: corrected (default) or raw
+func handleMeStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	from, to, termName, ok := parseReportRange(w, r)
+	if !ok {
+		return
+	}
+
+	var fromStr, toStr string
+	if !from.IsZero() {
+		fromStr = from.Format(time.RFC3339)
+	}
+	if !to.IsZero() {
+		toStr = to.Format(time.RFC3339)
+	}
+
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	visits, err := loadVisitsFromDB(memberOrg(member), fromStr, toStr, member.ID, 0, times)
+	if err != nil {
+		log.Printf("Error loading visits for member %d: %v", member.ID, err)
+		http.Error(w, "Error loading visits", http.StatusInternalServerError)
+		return
+	}
+
+	stats := MeStats{Term: termName}
+	var total time.Duration
+	for _, v := range visits {
+		total += v.SignOutTime.Sub(v.SignInTime)
+	}
+	stats.VisitCount = len(visits)
+	stats.TotalSeconds = int64(total.Seconds())
+	stats.TotalHours = total.Hours()
+	if len(visits) > 0 {
+		// Visits are ordered newest first
+		last := visits[0].SignInTime
+		stats.LastVisit = &last
+	}
+
+	signInTime, isInside, err := currentAttendees.get(member.UID)
+	if err != nil {
+		writeSignInOutError(w, fmt.Errorf("%w: %v", errAttendeeStore, err))
+		return
+	}
+	if isInside {
+		stats.SignedIn = true
+		stats.CurrentSeconds = int64(time.Since(signInTime).Seconds())
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+// handleMeSignOut signs the calling member out if they are currently signed in
+func handleMeSignOut(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	msg, err := performSignOut(r.Context(), member)
+	if err != nil {
+		writeSignInOutError(w, err)
+		return
+	}
+	logHTTP.infof("%s", msg)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": msg, "status": "out"})
+}
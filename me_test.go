@@ -0,0 +1,192 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /me Endpoint Tests
+// ============================================================================
+
+func TestHandleMe_MissingDiscordHeader(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	rr := httptest.NewRecorder()
+
+	handleMe(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized, got %v", rr.Code)
+	}
+}
+
+func TestHandleMe_UnlinkedDiscordID(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("X-Discord-ID", "999999999")
+	rr := httptest.NewRecorder()
+
+	handleMe(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found, got %v", rr.Code)
+	}
+}
+
+func TestHandleMe_SignedIn(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-15*time.Minute))
+
+	req, _ := http.NewRequest("GET", "/me", nil)
+	req.Header.Set("X-Discord-ID", "111111111")
+	rr := httptest.NewRecorder()
+
+	handleMe(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp MeResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Member.Name != "Alice" {
+		t.Errorf("expected member Alice, got %q", resp.Member.Name)
+	}
+	if !resp.SignedIn || resp.SignInTime == nil {
+		t.Errorf("expected Alice to be signed in, got %+v", resp)
+	}
+}
+
+func TestHandleMe_MethodNotAllowed(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/me", nil)
+	req.Header.Set("X-Discord-ID", "111111111")
+	rr := httptest.NewRecorder()
+
+	handleMe(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 Method Not Allowed, got %v", rr.Code)
+	}
+}
+
+func TestHandleMeSessions_OnlyOwnVisits(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`, 1, now.Add(-3*time.Hour).Format(time.RFC3339), now.Add(-2*time.Hour).Format(time.RFC3339))
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`, 2, now.Add(-3*time.Hour).Format(time.RFC3339), now.Add(-1*time.Hour).Format(time.RFC3339))
+
+	req, _ := http.NewRequest("GET", "/me/sessions", nil)
+	req.Header.Set("X-Discord-ID", "111111111")
+	rr := httptest.NewRecorder()
+
+	handleMeSessions(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	var visits []Visit
+	if err := json.Unmarshal(rr.Body.Bytes(), &visits); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(visits) != 1 || visits[0].Name != "Alice" {
+		t.Fatalf("expected only Alice's visit, got %+v", visits)
+	}
+}
+
+func TestHandleMeSessions_InvalidFromDate(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/me/sessions?from=yesterday", nil)
+	req.Header.Set("X-Discord-ID", "111111111")
+	rr := httptest.NewRecorder()
+
+	handleMeSessions(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestHandleMeStats_Totals(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`, 1, now.Add(-5*time.Hour).Format(time.RFC3339), now.Add(-4*time.Hour).Format(time.RFC3339))
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`, 1, now.Add(-3*time.Hour).Format(time.RFC3339), now.Add(-1*time.Hour).Format(time.RFC3339))
+
+	req, _ := http.NewRequest("GET", "/me/stats", nil)
+	req.Header.Set("X-Discord-ID", "111111111")
+	rr := httptest.NewRecorder()
+
+	handleMeStats(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	var stats MeStats
+	if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if stats.VisitCount != 2 {
+		t.Errorf("expected 2 visits, got %d", stats.VisitCount)
+	}
+	if stats.TotalSeconds != 3*3600 {
+		t.Errorf("expected %d total seconds, got %d", 3*3600, stats.TotalSeconds)
+	}
+	if stats.SignedIn {
+		t.Error("expected Alice to not be signed in")
+	}
+}
+
+func TestHandleMeSignOut_Success(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-1*time.Hour))
+
+	req, _ := http.NewRequest("POST", "/me/sign-out", nil)
+	req.Header.Set("X-Discord-ID", "111111111")
+	rr := httptest.NewRecorder()
+
+	handleMeSignOut(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
+		t.Error("Alice should have been removed from currentAttendees")
+	}
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM visits WHERE member_id = 1`).Scan(&count)
+	if count != 1 {
+		t.Errorf("expected 1 visit recorded, got %d", count)
+	}
+}
+
+func TestHandleMeSignOut_NotSignedIn(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/me/sign-out", nil)
+	req.Header.Set("X-Discord-ID", "111111111")
+	rr := httptest.NewRecorder()
+
+	handleMeSignOut(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- CSV Member Import ---
+//
+// POST /members/import takes a CSV file whose first row is a header, such as
+// an export from the membership platform. ?mapping= tells which column holds
+// each field as field:column pairs, e.g.
+//
+//	mapping=name:Full Name,uid:Card Number,discord:Discord ID
+//
+// where a column is a header name (case-insensitive) or a 1-based column
+// number. Fields are name, uid and discord (required) and role (optional);
+// without a mapping the columns named name, uid, discord_id and role are used.
+//
+// Every row is validated first. With ?dry_run=true only the report is
+// returned; otherwise the valid rows are added in one transaction and the
+// invalid ones are reported and skipped.
+
+// maxImportSize caps the size of an uploaded CSV file
+const maxImportSize = 5 << 20
+
+// importFields are the member fields a CSV column can be mapped to
+var importFields = []string{"name", "uid", "discord", "role"}
+
+// ImportRow is the outcome of one CSV row
+type ImportRow struct {
+	Row       int      `json:"row"` // Line in the file, the header being line 1
+	Name      string   `json:"name"`
+	UID       string   `json:"uid"`
+	DiscordID string   `json:"discord_id"`
+	Role      string   `json:"role"`
+	Status    string   `json:"status"` // valid (dry run), created or invalid
+	Errors    []string `json:"errors,omitempty"`
+	MemberID  int64    `json:"member_id,omitempty"`
+}
+
+// ImportReport is the response of /members/import
+type ImportReport struct {
+	DryRun  bool        `json:"dry_run"`
+	Total   int         `json:"total"`
+	Valid   int         `json:"valid"`
+	Invalid int         `json:"invalid"`
+	Created int         `json:"created"`
+	Rows    []ImportRow `json:"rows"`
+}
+
+// parseImportMapping resolves the column index of every field from a mapping
+// parameter and the CSV header
+func parseImportMapping(mapping string, header []string) (map[string]int, error) {
+	pairs := map[string]string{"name": "name", "uid": "uid", "discord": "discord_id", "role": "role"}
+	if strings.TrimSpace(mapping) != "" {
+		pairs = make(map[string]string)
+		for _, pair := range strings.Split(mapping, ",") {
+			field, column, found := strings.Cut(pair, ":")
+			field = strings.ToLower(strings.TrimSpace(field))
+			column = strings.TrimSpace(column)
+			if field == "discord_id" {
+				field = "discord"
+			}
+			if !found || column == "" {
+				return nil, fmt.Errorf("invalid mapping %q, expected field:column", pair)
+			}
+			known := false
+			for _, f := range importFields {
+				known = known || f == field
+			}
+			if !known {
+				return nil, fmt.Errorf("unknown field %q in mapping, expected name, uid, discord or role", field)
+			}
+			pairs[field] = column
+		}
+	}
+
+	columns := make(map[string]int)
+	for field, column := range pairs {
+		index := -1
+		if n, err := strconv.Atoi(column); err == nil {
+			if n < 1 || n > len(header) {
+				return nil, fmt.Errorf("column %d for %s is out of range, the file has %d columns", n, field, len(header))
+			}
+			index = n - 1
+		} else {
+			for i, h := range header {
+				if strings.EqualFold(strings.TrimSpace(h), column) {
+					index = i
+					break
+				}
+			}
+		}
+		if index >= 0 {
+			columns[field] = index
+		} else if field != "role" || strings.TrimSpace(mapping) != "" {
+			return nil, fmt.Errorf("column %q for %s not found in header", column, field)
+		}
+	}
+
+	for _, field := range []string{"name", "uid", "discord"} {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("no column mapped to %s", field)
+		}
+	}
+	return columns, nil
+}
+
+// readImportRows parses and validates a CSV file against the existing members
+func readImportRows(body io.Reader, mapping string) ([]ImportRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, fmt.Errorf("CSV file is empty")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid CSV: %w", err)
+	}
+	if len(header) > 0 {
+		header[0] = strings.TrimPrefix(header[0], "\ufeff") // Byte order mark of Excel exports
+	}
+	columns, err := parseImportMapping(mapping, header)
+	if err != nil {
+		return nil, err
+	}
+
+	// UIDs are unique across all members, deleted ones included; the ID of a
+	// trashed member is kept to say which one holds the card
+	existing := make(map[string]int64)
+	uidRows, err := db.Query(`SELECT uid, CASE WHEN deleted_at IS NOT NULL AND merged_into IS NULL THEN id ELSE 0 END FROM members`)
+	if err != nil {
+		return nil, err
+	}
+	defer uidRows.Close()
+	for uidRows.Next() {
+		var uid string
+		var trashedID int64
+		if err := uidRows.Scan(&uid, &trashedID); err != nil {
+			return nil, err
+		}
+		existing[uid] = trashedID
+	}
+	if err := uidRows.Err(); err != nil {
+		return nil, err
+	}
+
+	var rows []ImportRow
+	seen := make(map[string]int)
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		line, _ := reader.FieldPos(0)
+
+		value := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		row := ImportRow{Row: line, Name: value("name"), UID: value("uid"), DiscordID: value("discord")}
+
+		// Skip blank lines left by spreadsheet exports
+		if row.Name == "" && row.UID == "" && row.DiscordID == "" && value("role") == "" {
+			continue
+		}
+
+		if row.Name == "" {
+			row.Errors = append(row.Errors, "name is required")
+		}
+		if row.DiscordID == "" {
+			row.Errors = append(row.Errors, "discord_id is required")
+		}
+		trashedID, taken := existing[row.UID]
+		switch first, repeated := seen[row.UID]; {
+		case row.UID == "":
+			row.Errors = append(row.Errors, "uid is required")
+		case taken && trashedID != 0:
+			row.Errors = append(row.Errors, fmt.Sprintf("uid belongs to member %d in the trash, restore or purge them first", trashedID))
+		case taken:
+			row.Errors = append(row.Errors, "uid already exists")
+		case repeated:
+			row.Errors = append(row.Errors, fmt.Sprintf("uid already used on row %d", first))
+		default:
+			seen[row.UID] = row.Row
+		}
+		role, ok := normalizeRole(value("role"))
+		if !ok {
+			row.Errors = append(row.Errors, "invalid role, expected member, exec, officer or guest")
+			role = value("role")
+		}
+		row.Role = role
+
+		row.Status = "valid"
+		if len(row.Errors) > 0 {
+			row.Status = "invalid"
+		}
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// importMembers adds the valid rows in one transaction, setting their member IDs
+func importMembers(rows []ImportRow) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range rows {
+		if rows[i].Status != "valid" {
+			continue
+		}
+		res, err := tx.Exec(`INSERT INTO members (name, uid, discord_id, role) VALUES (?, ?, ?, ?)`,
+			rows[i].Name, rows[i].UID, encryptField(rows[i].DiscordID), rows[i].Role)
+		if err != nil {
+			return err
+		}
+		rows[i].MemberID, _ = res.LastInsertId()
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	for i := range rows {
+		if rows[i].MemberID != 0 {
+			rows[i].Status = "created"
+			memberCache.put(Member{ID: rows[i].MemberID, Name: rows[i].Name, UID: rows[i].UID, DiscordID: rows[i].DiscordID, Role: rows[i].Role, Status: statusActive})
+		}
+	}
+	return nil
+}
+
+// handleMemberImport imports members from a CSV request body
+// Query parameters:
+//   - mapping: field:column pairs, e.g. name:Full Name,uid:Card,discord:Discord ID
+//   - dry_run: if true, validate and report without saving
+func handleMemberImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+	rows, err := readImportRows(http.MaxBytesReader(w, r.Body, maxImportSize), r.URL.Query().Get("mapping"))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, "CSV file too large", http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report := ImportReport{DryRun: dryRun, Total: len(rows), Rows: rows}
+	for _, row := range rows {
+		if row.Status == "valid" {
+			report.Valid++
+		} else {
+			report.Invalid++
+		}
+	}
+	if report.Rows == nil {
+		report.Rows = []ImportRow{}
+	}
+
+	if !dryRun && report.Valid > 0 {
+		if err := importMembers(report.Rows); err != nil {
+			// A UID added since validation
+			if isUniqueViolation(err) {
+				http.Error(w, "UID already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error importing members: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		report.Created = report.Valid
+
+		msg := fmt.Sprintf("Imported %d members from CSV, %d invalid rows skipped", report.Created, report.Invalid)
+		log.Println(msg)
+		recordAudit("members.imported", clientIP(r), msg)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
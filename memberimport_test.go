@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// /members/import Endpoint Tests
+// ============================================================================
+
+// importCSV posts a CSV file to /members/import
+func importCSV(query, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/members/import?"+query, strings.NewReader(body))
+	req.Header.Set("Content-Type", "text/csv")
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	return rr
+}
+
+// decodeImportReport parses a successful import response
+func decodeImportReport(t *testing.T, rr *httptest.ResponseRecorder) ImportReport {
+	t.Helper()
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var report ImportReport
+	if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return report
+}
+
+// membershipExport is a CSV export whose columns don't match the member schema
+const membershipExport = "\ufeffFirst Last,Student Number,Card Number,Discord ID\n" +
+	"Carol Chen,300100200,CARD_C,333333333\n" +
+	"Dan Diaz,300100201,TEST_UID_1,444444444\n" +
+	",300100202,CARD_E,555555555\n" +
+	"\n" +
+	"Frank Fox,300100203,CARD_C,666666666\n"
+
+const membershipMapping = "name:First Last,uid:Card Number,discord:Discord ID"
+
+func TestHandleMemberImport_DryRun(t *testing.T) {
+	setupTest()
+
+	rr := importCSV("dry_run=true&mapping="+url.QueryEscape(membershipMapping), membershipExport)
+	report := decodeImportReport(t, rr)
+
+	if !report.DryRun || report.Total != 4 || report.Valid != 1 || report.Invalid != 3 || report.Created != 0 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	carol, dan, blank, frank := report.Rows[0], report.Rows[1], report.Rows[2], report.Rows[3]
+	if carol.Row != 2 || carol.Status != "valid" || carol.Name != "Carol Chen" || carol.UID != "CARD_C" || carol.Role != roleMember {
+		t.Errorf("unexpected row for Carol: %+v", carol)
+	}
+	if dan.Status != "invalid" || len(dan.Errors) != 1 || dan.Errors[0] != "uid already exists" {
+		t.Errorf("expected existing UID to be rejected: %+v", dan)
+	}
+	if blank.Status != "invalid" || blank.Errors[0] != "name is required" {
+		t.Errorf("expected missing name to be rejected: %+v", blank)
+	}
+	if frank.Row != 6 || frank.Status != "invalid" || frank.Errors[0] != "uid already used on row 2" {
+		t.Errorf("expected repeated UID to be rejected: %+v", frank)
+	}
+
+	// Nothing saved
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM members`).Scan(&count)
+	if count != 2 {
+		t.Errorf("expected dry run to leave 2 members, got %d", count)
+	}
+}
+
+func TestHandleMemberImport_Commit(t *testing.T) {
+	setupTest()
+
+	rr := importCSV("mapping="+url.QueryEscape(membershipMapping), membershipExport)
+	report := decodeImportReport(t, rr)
+
+	if report.DryRun || report.Created != 1 || report.Invalid != 3 {
+		t.Fatalf("unexpected totals: %+v", report)
+	}
+	carol := report.Rows[0]
+	if carol.Status != "created" || carol.MemberID == 0 {
+		t.Fatalf("expected Carol to be created: %+v", carol)
+	}
+	if m := cachedMember("CARD_C"); m.ID != carol.MemberID || m.Name != "Carol Chen" || m.DiscordID != "333333333" {
+		t.Errorf("expected Carol in the cache, got %+v", m)
+	}
+
+	var count int
+	db.QueryRow(`SELECT COUNT(*) FROM members`).Scan(&count)
+	if count != 3 {
+		t.Errorf("expected 3 members, got %d", count)
+	}
+	entries, _ := loadAuditEntries("members.imported", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected import to be audited, got %+v", entries)
+	}
+}
+
+func TestHandleMemberImport_DefaultColumnsAndRole(t *testing.T) {
+	setupTest()
+
+	body := "uid,Name,discord_id,role\nCARD_G,Grace,777777777,Exec\nCARD_H,Hank,888888888,president\n"
+	report := decodeImportReport(t, importCSV("", body))
+
+	if report.Created != 1 || report.Rows[0].Role != roleExec {
+		t.Errorf("expected Grace imported as exec: %+v", report)
+	}
+	if report.Rows[1].Status != "invalid" || !strings.Contains(report.Rows[1].Errors[0], "invalid role") {
+		t.Errorf("expected invalid role to be rejected: %+v", report.Rows[1])
+	}
+
+	// Columns by number
+	body = "a,b,c\nIvy,CARD_I,999999999\n"
+	report = decodeImportReport(t, importCSV("mapping="+url.QueryEscape("name:1,uid:2,discord:3"), body))
+	if report.Created != 1 || report.Rows[0].Name != "Ivy" {
+		t.Errorf("expected Ivy imported by column numbers: %+v", report)
+	}
+}
+
+func TestHandleMemberImport_InvalidRequests(t *testing.T) {
+	setupTest()
+
+	tests := []struct {
+		name, query, body string
+	}{
+		{"empty file", "", ""},
+		{"missing default column", "", "name,uid\nAlice,X\n"},
+		{"unknown field", "mapping=email:Email", "Email\na@b.c\n"},
+		{"malformed mapping", "mapping=name", "name\nA\n"},
+		{"column not in header", "mapping=" + url.QueryEscape("name:Full,uid:uid,discord:discord"), "name,uid,discord\nA,B,C\n"},
+		{"column out of range", "mapping=" + url.QueryEscape("name:1,uid:2,discord:4"), "a,b,c\nA,B,C\n"},
+		{"malformed CSV", "", "name,uid,discord_id\n\"A,B,C\n"},
+	}
+	for _, tt := range tests {
+		rr := importCSV(tt.query, tt.body)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400 Bad Request, got %v; body=%s", tt.name, rr.Code, rr.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/members/import", nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET, got %v", rr.Code)
+	}
+}
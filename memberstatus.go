@@ -0,0 +1,144 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// --- Member Lifecycle ---
+//
+// Every member has a status:
+//   - pending: has a card but has not finished registering; scans are refused
+//     with a message sending them to an exec
+//   - active: a current member (the default)
+//   - inactive: no longer a current member, e.g. dues not renewed; scans are
+//     refused until an exec reactivates them
+//   - alumni: graduated members, who may still sign in when visiting
+//
+// Status changes go through POST /members/{id}/status and must follow
+// memberTransitions. Members who are inside can always sign out.
+
+// Member statuses
+const (
+	statusPending  = "pending"
+	statusActive   = "active"
+	statusInactive = "inactive"
+	statusAlumni   = "alumni"
+)
+
+// memberTransitions lists the statuses each status may change to
+var memberTransitions = map[string][]string{
+	statusPending:  {statusActive},
+	statusActive:   {statusInactive, statusAlumni},
+	statusInactive: {statusActive, statusAlumni},
+	statusAlumni:   {statusActive},
+}
+
+// StatusRequest is the body of POST /members/{id}/status
+type StatusRequest struct {
+	Status string `json:"status"`
+}
+
+// normalizeStatus lower-cases a status and defaults it to active, or returns false if unknown
+func normalizeStatus(status string) (string, bool) {
+	switch status = strings.ToLower(strings.TrimSpace(status)); status {
+	case "":
+		return statusActive, true
+	case statusPending, statusActive, statusInactive, statusAlumni:
+		return status, true
+	}
+	return "", false
+}
+
+// canTransition reports whether a member may change from one status to another
+func canTransition(from, to string) bool {
+	for _, s := range memberTransitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// signInRefusal returns why a member with the given status may not sign in,
+// or "" if they may
+func signInRefusal(status string) string {
+	switch status {
+	case statusPending:
+		return "see an exec to finish registration"
+	case statusInactive:
+		return "membership inactive, see an exec to reactivate it"
+	}
+	return ""
+}
+
+// checkMemberStatus is a validate hook refusing sign-ins of pending and inactive members
+func checkMemberStatus(sc *ScanContext) error {
+	if !sc.SigningIn {
+		return nil
+	}
+	if reason := signInRefusal(sc.Member.Status); reason != "" {
+		return rejectScan(http.StatusForbidden, "%s: %s", sc.Member.Name, reason)
+	}
+	return nil
+}
+
+// handleMemberStatus changes a member's status (POST /members/{id}/status)
+func handleMemberStatus(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req StatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	status, ok := normalizeStatus(req.Status)
+	if !ok || strings.TrimSpace(req.Status) == "" {
+		http.Error(w, "Invalid 'status', expected pending, active, inactive or alumni", http.StatusBadRequest)
+		return
+	}
+
+	var from string
+	if err := db.QueryRow(`SELECT status FROM members WHERE id = ? AND deleted_at IS NULL`, id).Scan(&from); err == sql.ErrNoRows {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying member status: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !canTransition(from, status) {
+		http.Error(w, fmt.Sprintf("Cannot change status from %s to %s", from, status), http.StatusConflict)
+		return
+	}
+
+	// The status is checked again in case of a concurrent change
+	var member Member
+	err := db.QueryRow(`UPDATE members SET status = ? WHERE id = ? AND status = ? AND deleted_at IS NULL
+		RETURNING id, name, uid, discord_id, role, status, org_id`, status, id, from).
+		Scan(&member.ID, &member.Name, &member.UID, decrypted{&member.DiscordID}, &member.Role, &member.Status, &member.OrgID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Member status changed concurrently, retry", http.StatusConflict)
+		return
+	} else if err != nil {
+		log.Printf("Error updating member status: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	memberCache.put(member)
+
+	msg := fmt.Sprintf("Member %s (%d) changed from %s to %s", member.Name, member.ID, from, status)
+	log.Println(msg)
+	recordAudit("member.status_changed", clientIP(r), msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(member)
+}
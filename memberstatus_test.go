@@ -0,0 +1,178 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Member Lifecycle Tests
+// ============================================================================
+
+// setMemberStatus calls POST /members/{id}/status
+func setMemberStatus(path, status string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", path, strings.NewReader(`{"status": "`+status+`"}`))
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	return rr
+}
+
+// scanCard posts a scan of a card UID
+func scanCard(uid string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid": "`+uid+`"}`))
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+	return rr
+}
+
+func TestHandleMemberStatus_Transitions(t *testing.T) {
+	setupTest()
+
+	// active -> inactive -> active -> alumni
+	for _, status := range []string{statusInactive, statusActive, statusAlumni} {
+		rr := setMemberStatus("/members/1/status", status)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK changing to %s, got %v; body=%s", status, rr.Code, rr.Body.String())
+		}
+		var member Member
+		json.Unmarshal(rr.Body.Bytes(), &member)
+		if member.Status != status {
+			t.Fatalf("expected status %s, got %+v", status, member)
+		}
+		if m := cachedMember("TEST_UID_1"); m.Status != status {
+			t.Errorf("expected cached status %s, got %q", status, m.Status)
+		}
+	}
+
+	// alumni -> inactive is not a valid transition
+	if rr := setMemberStatus("/members/1/status", statusInactive); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict, got %v", rr.Code)
+	}
+	// Nobody goes back to pending
+	if rr := setMemberStatus("/members/2/status", statusPending); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict, got %v", rr.Code)
+	}
+
+	entries, _ := loadAuditEntries("member.status_changed", 10)
+	if len(entries) != 3 {
+		t.Errorf("expected 3 audited changes, got %d", len(entries))
+	}
+}
+
+func TestHandleMemberStatus_Invalid(t *testing.T) {
+	setupTest()
+
+	if rr := setMemberStatus("/members/1/status", "banned"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown status, got %v", rr.Code)
+	}
+	if rr := setMemberStatus("/members/1/status", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a missing status, got %v", rr.Code)
+	}
+	if rr := setMemberStatus("/members/99/status", statusInactive); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown member, got %v", rr.Code)
+	}
+}
+
+func TestHandleScan_PendingMemberRefused(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/members", strings.NewReader(`{"name": "Carol", "uid": "CARD_C", "discord_id": "333333333", "status": "pending"}`))
+	rr := httptest.NewRecorder()
+	handleMembers(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var carol Member
+	json.Unmarshal(rr.Body.Bytes(), &carol)
+
+	rr = scanCard("CARD_C")
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "see an exec to finish registration") {
+		t.Fatalf("expected pending member to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if _, inside, _ := currentAttendees.get("CARD_C"); inside {
+		t.Error("pending member should not be signed in")
+	}
+
+	// Activation lets them in
+	if rr := setMemberStatus(fmt.Sprintf("/members/%d/status", carol.ID), statusActive); rr.Code != http.StatusOK {
+		t.Fatalf("expected activation to succeed, got %v", rr.Code)
+	}
+	if rr := scanCard("CARD_C"); rr.Code != http.StatusOK {
+		t.Errorf("expected active member to sign in, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleScan_InactiveMember(t *testing.T) {
+	setupTest()
+
+	// Alice is inside when her membership lapses and can still sign out
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-time.Hour))
+	setMemberStatus("/members/1/status", statusInactive)
+
+	if rr := scanCard("TEST_UID_1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected inactive member to sign out, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := scanCard("TEST_UID_1"); rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "membership inactive") {
+		t.Errorf("expected inactive member to be refused, got %v: %s", rr.Code, rr.Body.String())
+	}
+
+	// Nor through Discord
+	req, _ := http.NewRequest("POST", "/sign-in-discord", strings.NewReader(`{"discord_id": "111111111"}`))
+	rr := httptest.NewRecorder()
+	handleSignInWithDiscordID(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected Discord sign-in to be refused, got %v", rr.Code)
+	}
+
+	// Alumni may visit
+	setMemberStatus("/members/1/status", statusAlumni)
+	if rr := scanCard("TEST_UID_1"); rr.Code != http.StatusOK {
+		t.Errorf("expected alumni to sign in, got %v: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleMembers_StatusFilter(t *testing.T) {
+	setupTest()
+	setMemberStatus("/members/2/status", statusAlumni)
+
+	req, _ := http.NewRequest("GET", "/members?status=alumni", nil)
+	rr := httptest.NewRecorder()
+	handleMembers(rr, req)
+
+	var members []Member
+	json.Unmarshal(rr.Body.Bytes(), &members)
+	if len(members) != 1 || members[0].Name != "Bob" || members[0].Status != statusAlumni {
+		t.Errorf("expected only Bob, got %+v", members)
+	}
+
+	req, _ = http.NewRequest("GET", "/members?status=gone", nil)
+	rr = httptest.NewRecorder()
+	handleMembers(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown status, got %v", rr.Code)
+	}
+}
+
+func TestPendingMember_EnrollAsPending(t *testing.T) {
+	setupTest()
+
+	rr := postSignup(`{"name": "Carol", "discord_id": "333333333"}`)
+	var pending PendingMember
+	json.Unmarshal(rr.Body.Bytes(), &pending)
+
+	rr = pendingRequest("POST", fmt.Sprintf("/members/pending/%d/enroll", pending.ID), `{"uid": "CARD_C", "status": "pending"}`)
+	var member Member
+	json.Unmarshal(rr.Body.Bytes(), &member)
+	if rr.Code != http.StatusCreated || member.Status != statusPending {
+		t.Fatalf("expected a pending member, got %v: %s", rr.Code, rr.Body.String())
+	}
+	if rr := scanCard("CARD_C"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected scan to be refused, got %v", rr.Code)
+	}
+}
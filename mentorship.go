@@ -0,0 +1,170 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"log"
+	"net/http"
+	"time"
+)
+
+// --- Mentorship Hours ---
+//
+// The mentorship program requires verified in-person hours. A mentor and
+// mentee are credited with the stretches they were in the office together
+// (see coPresence), as long as each stretch lasts at least min_overlap so
+// that passing each other at the door does not count. Stretches where both
+// are still signed in are not counted until one of them signs out.
+
+// mentorshipDefaultMinOverlap is the shortest stretch together that counts by default
+const mentorshipDefaultMinOverlap = 15 * time.Minute
+
+// MentorshipSession is one stretch a mentor and mentee spent together
+type MentorshipSession struct {
+	Start   time.Time `json:"start"`
+	End     time.Time `json:"end"`
+	Seconds int64     `json:"seconds"`
+}
+
+// MentorshipResponse is the /stats/mentorship response
+type MentorshipResponse struct {
+	Mentor            Member              `json:"mentor"`
+	Mentee            Member              `json:"mentee"`
+	From              *time.Time          `json:"from,omitempty"`
+	To                *time.Time          `json:"to,omitempty"`
+	MinOverlapSeconds int64               `json:"min_overlap_seconds"`
+	VerifiedSeconds   int64               `json:"verified_seconds"`
+	VerifiedHours     float64             `json:"verified_hours"`
+	Sessions          []MentorshipSession `json:"sessions"`
+	TooShort          int                 `json:"too_short"` // Stretches together shorter than the minimum
+}
+
+// mentorshipSessions keeps the completed stretches lasting at least
+// minOverlap, also returning how many were too short
+func mentorshipSessions(shared []presenceInterval, minOverlap time.Duration) ([]MentorshipSession, int) {
+	sessions := []MentorshipSession{}
+	tooShort := 0
+	for _, p := range shared {
+		if p.Open {
+			continue
+		}
+		d := p.End.Sub(p.Start)
+		if d < minOverlap {
+			tooShort++
+			continue
+		}
+		sessions = append(sessions, MentorshipSession{Start: p.Start, End: p.End, Seconds: int64(d.Seconds())})
+	}
+	return sessions, tooShort
+}
+
+// handleStatsMentorship reports the verified in-person hours of a mentor and mentee
+// Query parameters:
+//   - mentor, mentee: member IDs (required)
+//   - term: term name, in place of from/to
+//   - from: RFC3339 formatted start of the period
+//   - to: RFC3339 formatted end of the period
+//   - min_overlap: shortest stretch together that counts, as a Go duration (default 15m)
+//   - format: json (default) or csv
+//   - times: corrected (default) or raw
+func handleStatsMentorship(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	mentor, ok := memberFromParam(w, r, "mentor")
+	if !ok {
+		return
+	}
+	mentee, ok := memberFromParam(w, r, "mentee")
+	if !ok {
+		return
+	}
+	if mentor.ID == mentee.ID {
+		http.Error(w, "'mentor' and 'mentee' must be different members", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+
+	minOverlap := mentorshipDefaultMinOverlap
+	if param := r.URL.Query().Get("min_overlap"); param != "" {
+		d, err := time.ParseDuration(param)
+		if err != nil || d < 0 {
+			http.Error(w, "Invalid 'min_overlap' parameter, expected a duration such as 30m", http.StatusBadRequest)
+			return
+		}
+		minOverlap = d
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "Invalid 'format' parameter, expected json or csv", http.StatusBadRequest)
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	intervals, err := loadPresenceIntervals(from, to, time.Now(), times)
+	if err != nil {
+		log.Printf("Error loading attendance intervals: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	shared := coPresence(memberIntervals(intervals, mentor.ID, from, to), memberIntervals(intervals, mentee.ID, from, to))
+	sessions, tooShort := mentorshipSessions(shared, minOverlap)
+
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", "attachment; filename=mentorship.csv")
+
+		writer := csv.NewWriter(w)
+		defer writer.Flush()
+
+		if err := writer.Write([]string{"Mentor", "Mentee", "Start", "End", "Duration"}); err != nil {
+			log.Printf("Error writing CSV header: %v", err)
+			return
+		}
+		for _, s := range sessions {
+			if err := writer.Write([]string{
+				mentor.Name,
+				mentee.Name,
+				s.Start.Format(time.RFC3339),
+				s.End.Format(time.RFC3339),
+				s.End.Sub(s.Start).Round(time.Second).String(),
+			}); err != nil {
+				log.Printf("Error writing CSV record: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	resp := MentorshipResponse{
+		Mentor:            mentor,
+		Mentee:            mentee,
+		MinOverlapSeconds: int64(minOverlap.Seconds()),
+		Sessions:          sessions,
+		TooShort:          tooShort,
+	}
+	if !from.IsZero() {
+		resp.From = &from
+	}
+	if !to.IsZero() {
+		resp.To = &to
+	}
+	for _, s := range sessions {
+		resp.VerifiedSeconds += s.Seconds
+	}
+	resp.VerifiedHours = float64(resp.VerifiedSeconds) / 3600
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
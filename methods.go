@@ -0,0 +1,96 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// --- Method Handling ---
+//
+// methodsMiddleware gives every route consistent method semantics: HEAD is
+// served by the GET handler with the body discarded, OPTIONS reports the
+// allowed methods, and anything else unsupported gets a 405 carrying an Allow
+// header.
+
+// allowHeader builds the Allow header value for a route supporting methods
+func allowHeader(methods ...string) string {
+	allow := append([]string{}, methods...)
+	for _, m := range methods {
+		if m == http.MethodGet {
+			allow = append(allow, http.MethodHead)
+			break
+		}
+	}
+	allow = append(allow, http.MethodOptions)
+	return strings.Join(allow, ", ")
+}
+
+// methodNotAllowed responds with 405 and the route's Allow header
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", allowHeader(methods...))
+	http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+}
+
+// headResponseWriter discards the body of a GET response while counting its
+// length, so HEAD responses carry the same headers including Content-Length
+type headResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int
+}
+
+func (h *headResponseWriter) WriteHeader(status int) {
+	if h.status == 0 {
+		h.status = status
+	}
+}
+
+func (h *headResponseWriter) Write(p []byte) (int, error) {
+	if h.status == 0 {
+		h.status = http.StatusOK
+	}
+	h.written += len(p)
+	return len(p), nil
+}
+
+// finish sends the buffered status line and headers
+func (h *headResponseWriter) finish() {
+	if h.status == 0 {
+		h.status = http.StatusOK
+	}
+	if h.Header().Get("Content-Length") == "" && h.written > 0 {
+		h.Header().Set("Content-Length", strconv.Itoa(h.written))
+	}
+	h.ResponseWriter.WriteHeader(h.status)
+}
+
+// methodsMiddleware enforces the route's methods and implements HEAD and OPTIONS for it
+func methodsMiddleware(next http.HandlerFunc, methods ...string) http.HandlerFunc {
+	allowed := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		allowed[m] = true
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodOptions:
+			w.Header().Set("Allow", allowHeader(methods...))
+			w.WriteHeader(http.StatusNoContent)
+
+		case r.Method == http.MethodHead && allowed[http.MethodGet]:
+			// Run the GET handler on a copy of the request and drop the body
+			getReq := r.Clone(r.Context())
+			getReq.Method = http.MethodGet
+			hw := &headResponseWriter{ResponseWriter: w}
+			next(hw, getReq)
+			hw.finish()
+
+		case allowed[r.Method]:
+			next(w, r)
+
+		default:
+			methodNotAllowed(w, methods...)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// HEAD / OPTIONS / 405 Handling Tests
+// ============================================================================
+
+func TestMethodsMiddleware_HeadMatchesGetHeaders(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+	handler := methodsMiddleware(handleCurrent, "GET")
+
+	getReq, _ := http.NewRequest("GET", "/current", nil)
+	getRR := httptest.NewRecorder()
+	handler.ServeHTTP(getRR, getReq)
+
+	headReq, _ := http.NewRequest("HEAD", "/current", nil)
+	headRR := httptest.NewRecorder()
+	handler.ServeHTTP(headRR, headReq)
+
+	if headRR.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK for HEAD, got %v", headRR.Code)
+	}
+	if headRR.Body.Len() != 0 {
+		t.Errorf("expected empty body for HEAD, got %q", headRR.Body.String())
+	}
+	if got := headRR.Header().Get("Content-Type"); got != getRR.Header().Get("Content-Type") {
+		t.Errorf("expected Content-Type %q, got %q", getRR.Header().Get("Content-Type"), got)
+	}
+	if got, want := headRR.Header().Get("Content-Length"), strconv.Itoa(getRR.Body.Len()); got != want {
+		t.Errorf("expected Content-Length %s, got %s", want, got)
+	}
+}
+
+func TestMethodsMiddleware_HeadOnHandlerWithMethodCheck(t *testing.T) {
+	setupTest()
+
+	// handleScanHistory itself only accepts GET; HEAD must still work
+	handler := methodsMiddleware(handleScanHistory, "GET")
+
+	req, _ := http.NewRequest("HEAD", "/scan-history", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %v", rr.Code)
+	}
+}
+
+func TestMethodsMiddleware_HeadNotAllowedWithoutGet(t *testing.T) {
+	setupTest()
+
+	handler := methodsMiddleware(handleScan, "POST")
+
+	req, _ := http.NewRequest("HEAD", "/scan", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %v", rr.Code)
+	}
+	if got := rr.Header().Get("Allow"); got != "POST, OPTIONS" {
+		t.Errorf("expected Allow: POST, OPTIONS, got %q", got)
+	}
+}
+
+func TestMethodsMiddleware_MethodNotAllowedAdvertisesAllow(t *testing.T) {
+	setupTest()
+
+	handler := methodsMiddleware(handleVisits, "GET", "DELETE")
+
+	req, _ := http.NewRequest("POST", "/visits", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %v", rr.Code)
+	}
+	if got := rr.Header().Get("Allow"); got != "GET, DELETE, HEAD, OPTIONS" {
+		t.Errorf("expected Allow: GET, DELETE, HEAD, OPTIONS, got %q", got)
+	}
+}
+
+func TestMethodsMiddleware_Options(t *testing.T) {
+	setupTest()
+
+	handler := methodsMiddleware(handleMembers, "GET", "POST")
+
+	req, _ := http.NewRequest("OPTIONS", "/members", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusNoContent {
+		t.Fatalf("expected 204 No Content, got %v", rr.Code)
+	}
+	if got := rr.Header().Get("Allow"); got != "GET, POST, HEAD, OPTIONS" {
+		t.Errorf("expected Allow: GET, POST, HEAD, OPTIONS, got %q", got)
+	}
+}
+
+func TestHandlerMethodNotAllowed_SetsAllow(t *testing.T) {
+	setupTest()
+
+	// Handlers called directly also advertise their methods
+	req, _ := http.NewRequest("GET", "/sign-out-all", nil)
+	rr := httptest.NewRecorder()
+	handleSignoutAll(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Fatalf("expected 405, got %v", rr.Code)
+	}
+	if got := rr.Header().Get("Allow"); got != "POST, OPTIONS" {
+		t.Errorf("expected Allow: POST, OPTIONS, got %q", got)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// --- Metrics ---
+//
+// A minimal set of counters and gauges exposed in the Prometheus text format
+// at /metrics. Names are registered lazily the first time they are touched.
+
+var (
+	metricsMu sync.Mutex
+	counters  = make(map[string]float64)
+	gauges    = make(map[string]float64)
+)
+
+// incCounter increments a monotonically increasing counter
+func incCounter(name string) {
+	metricsMu.Lock()
+	counters[name]++
+	metricsMu.Unlock()
+}
+
+// setGauge sets a gauge to the given value
+func setGauge(name string, value float64) {
+	metricsMu.Lock()
+	gauges[name] = value
+	metricsMu.Unlock()
+}
+
+// resetMetrics clears all counters and gauges
+func resetMetrics() {
+	metricsMu.Lock()
+	counters = make(map[string]float64)
+	gauges = make(map[string]float64)
+	metricsMu.Unlock()
+}
+
+// handleMetrics renders all metrics in the Prometheus text exposition format
+func handleMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	// Refresh gauges derived from live state before rendering
+	setGauge("office_current_attendees", float64(currentAttendees.count()))
+	setGauge("auth_locked_clients", float64(lockedClientCount()))
+	if size, wal, err := databaseSize(); err == nil {
+		setGauge("database_size_bytes", float64(size))
+		setGauge("database_wal_size_bytes", float64(wal))
+	}
+
+	metricsMu.Lock()
+	defer metricsMu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	writeMetricFamily(w, "counter", counters)
+	writeMetricFamily(w, "gauge", gauges)
+}
+
+// writeMetricFamily writes metrics of one type sorted by name
+func writeMetricFamily(w http.ResponseWriter, kind string, values map[string]float64) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		fmt.Fprintf(w, "# TYPE %s %s\n%s %g\n", name, kind, name, values[name])
+	}
+}
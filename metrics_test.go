@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /metrics Endpoint Tests
+// ============================================================================
+
+func TestHandleMetrics_PrometheusFormat(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+	incCounter("auth_failures_total")
+	incCounter("auth_failures_total")
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+
+	handleMetrics(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	body := rr.Body.String()
+	for _, want := range []string{
+		"# TYPE auth_failures_total counter\nauth_failures_total 2\n",
+		"# TYPE office_current_attendees gauge\noffice_current_attendees 1\n",
+		"auth_locked_clients 0\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected metrics to contain %q, got:\n%s", want, body)
+		}
+	}
+}
+
+func TestHandleMetrics_CountsLockedClients(t *testing.T) {
+	setupTest()
+
+	for i := 0; i < authMaxFailures; i++ {
+		recordAuthFailure("10.0.0.9", time.Now())
+	}
+
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+
+	handleMetrics(rr, req)
+
+	body := rr.Body.String()
+	if !strings.Contains(body, "auth_locked_clients 1\n") {
+		t.Errorf("expected one locked client, got:\n%s", body)
+	}
+	if !strings.Contains(body, "auth_lockouts_total 1\n") {
+		t.Errorf("expected one lockout counted, got:\n%s", body)
+	}
+}
+
+func TestHandleMetrics_MethodNotAllowed(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("POST", "/metrics", nil)
+	rr := httptest.NewRecorder()
+
+	handleMetrics(rr, req)
+
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 Method Not Allowed, got %v", rr.Code)
+	}
+}
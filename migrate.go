@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Legacy JSON Migration ---
+//
+// Older deployments kept members in data/members.json and open sessions in
+// data/current_attendees.json only. Running the server with --migrate-json,
+// or calling POST /admin/migrate-json, ingests both into the database:
+//   - members.json: every member is validated like POST /members; members
+//     whose UID is already registered are skipped
+//   - current_attendees.json: moved into the shared store (the open_sessions
+//     table with STATELESS=true, or Redis). Sessions of unknown cards or
+//     signing in in the future are rejected, and sessions from before the
+//     last nightly cleanup are closed at it and recorded as visits. Without
+//     shared storage the file is still the live store, so it is left alone.
+//
+// A file that was read is then archived next to itself with a .migrated-<time>
+// suffix, so the migration runs once; rejected entries remain in the archive.
+// The report is returned, logged and written to the audit log.
+
+// errInvalidLegacyFile is returned for a legacy file that cannot be parsed
+var errInvalidLegacyFile = errors.New("invalid legacy file")
+
+// MigrationFileReport is the outcome of migrating one legacy file
+type MigrationFileReport struct {
+	File       string   `json:"file"`
+	Found      bool     `json:"found"`
+	Imported   int      `json:"imported"`
+	Skipped    []string `json:"skipped"`          // Already in the database
+	Invalid    []string `json:"invalid"`          // Rejected entries, with the reason
+	Closed     []string `json:"closed,omitempty"` // Sessions closed at a missed nightly cleanup
+	ArchivedTo string   `json:"archived_to,omitempty"`
+	Note       string   `json:"note,omitempty"`
+}
+
+// MigrationReport is the outcome of a legacy JSON migration
+type MigrationReport struct {
+	Members   MigrationFileReport `json:"members"`
+	Attendees MigrationFileReport `json:"current_attendees"`
+}
+
+// String summarizes a file's migration for logs and the audit log
+func (r MigrationFileReport) String() string {
+	if !r.Found {
+		return r.File + ": not found"
+	}
+	parts := []string{fmt.Sprintf("%d imported", r.Imported)}
+	if len(r.Skipped) > 0 {
+		parts = append(parts, fmt.Sprintf("%d skipped", len(r.Skipped)))
+	}
+	if len(r.Invalid) > 0 {
+		parts = append(parts, fmt.Sprintf("%d invalid", len(r.Invalid)))
+	}
+	if len(r.Closed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d closed", len(r.Closed)))
+	}
+	if r.Note != "" {
+		parts = append(parts, r.Note)
+	}
+	return r.File + ": " + strings.Join(parts, ", ")
+}
+
+// String summarizes the migration for logs and the audit log
+func (r MigrationReport) String() string {
+	return r.Members.String() + "; " + r.Attendees.String()
+}
+
+// archiveLegacyFile renames a migrated file so it is not migrated again
+func archiveLegacyFile(path string, now time.Time) (string, error) {
+	archived := path + ".migrated-" + now.Format("20060102-150405")
+	return archived, os.Rename(path, archived)
+}
+
+// migrateMembersFile imports the members of a legacy members.json file
+func migrateMembersFile(path string, now time.Time) (MigrationFileReport, error) {
+	report := MigrationFileReport{File: path, Skipped: []string{}, Invalid: []string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return report, nil
+	} else if err != nil {
+		return report, err
+	}
+	report.Found = true
+
+	var members []Member
+	if err := json.Unmarshal(data, &members); err != nil {
+		return report, fmt.Errorf("%w: %s is not a list of members: %v", errInvalidLegacyFile, path, err)
+	}
+
+	for i, m := range members {
+		name, uid, discordID := strings.TrimSpace(m.Name), strings.TrimSpace(m.UID), strings.TrimSpace(m.DiscordID)
+		entry := fmt.Sprintf("#%d %s (%s)", i+1, name, uid)
+		role, roleOK := normalizeRole(m.Role)
+		status, statusOK := normalizeStatus(m.Status)
+		org := m.OrgID
+		if org == "" {
+			org = defaultOrg
+		}
+
+		switch {
+		case name == "" || uid == "" || discordID == "":
+			report.Invalid = append(report.Invalid, entry+": name, uid, and discord_id are required")
+			continue
+		case !roleOK:
+			report.Invalid = append(report.Invalid, entry+": invalid role "+m.Role)
+			continue
+		case !statusOK:
+			report.Invalid = append(report.Invalid, entry+": invalid status "+m.Status)
+			continue
+		case !orgIDPattern.MatchString(org):
+			report.Invalid = append(report.Invalid, entry+": invalid organization "+m.OrgID)
+			continue
+		}
+
+		res, err := db.Exec(`INSERT OR IGNORE INTO members (name, uid, discord_id, role, status, org_id) VALUES (?, ?, ?, ?, ?, ?)`,
+			name, uid, encryptField(discordID), role, status, org)
+		if err != nil {
+			return report, err
+		}
+		if inserted, _ := res.RowsAffected(); inserted == 0 {
+			report.Skipped = append(report.Skipped, entry)
+			continue
+		}
+		id, _ := res.LastInsertId()
+		memberCache.put(Member{ID: id, Name: name, UID: uid, DiscordID: discordID, Role: role, Status: status, OrgID: org})
+		report.Imported++
+	}
+
+	report.ArchivedTo, err = archiveLegacyFile(path, now)
+	return report, err
+}
+
+// migrateAttendeesFile moves the open sessions of a legacy
+// current_attendees.json file into the shared store
+func migrateAttendeesFile(path string, now time.Time) (MigrationFileReport, error) {
+	report := MigrationFileReport{File: path, Skipped: []string{}, Invalid: []string{}}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return report, nil
+	} else if err != nil {
+		return report, err
+	}
+	report.Found = true
+
+	if attendeesInFile() {
+		report.Note = "left in place, it is the live store without STATELESS=true or REDIS_URL"
+		return report, nil
+	}
+
+	var sessions map[string]time.Time
+	if err := json.Unmarshal(data, &sessions); err != nil {
+		return report, fmt.Errorf("%w: %s is not a map of UIDs to sign-in times: %v", errInvalidLegacyFile, path, err)
+	}
+
+	uids := make([]string, 0, len(sessions))
+	for uid := range sessions {
+		uids = append(uids, uid)
+	}
+	sort.Strings(uids)
+
+	cleanup := lastNightlyCleanup(now)
+	for _, uid := range uids {
+		signInTime := sessions[uid]
+		member, known := memberCache.get(uid)
+		switch {
+		case !known:
+			report.Invalid = append(report.Invalid, uid+": unknown card")
+
+		case signInTime.After(now.Add(reconcileClockAllowance)):
+			report.Invalid = append(report.Invalid, uid+": signed in in the future")
+
+		case signInTime.Before(cleanup):
+			if err := saveVisitToDB(member.ID, signInTime, cleanup); err != nil {
+				return report, err
+			}
+			report.Closed = append(report.Closed, uid)
+			events.publish(Event{Kind: eventSignOut, Time: cleanup, Member: member, SignInTime: signInTime,
+				Message: fmt.Sprintf("%s was signed out by the JSON migration", member.Name)})
+
+		default:
+			signedIn, err := currentAttendees.signInIfAbsent(uid, "", signInTime)
+			if err != nil {
+				return report, err
+			}
+			if !signedIn {
+				report.Skipped = append(report.Skipped, uid)
+				continue
+			}
+			report.Imported++
+		}
+	}
+
+	report.ArchivedTo, err = archiveLegacyFile(path, now)
+	return report, err
+}
+
+// migrateJSONFiles migrates the legacy members.json and current_attendees.json
+// files, members first so the sessions of migrated members are kept
+func migrateJSONFiles(now time.Time) (MigrationReport, error) {
+	var report MigrationReport
+	var err error
+	if report.Members, err = migrateMembersFile(membersFilePath, now); err != nil {
+		return report, err
+	}
+	if report.Attendees, err = migrateAttendeesFile(currentAttendeesFilePath, now); err != nil {
+		return report, err
+	}
+
+	log.Printf("JSON migration: %s", report)
+	if report.Members.Found || report.Attendees.Found {
+		recordAudit("migration.json", "migration", report.String())
+	}
+	return report, nil
+}
+
+// runJSONMigration runs the --migrate-json command, printing the report, and
+// returns the process exit code
+func runJSONMigration() int {
+	report, err := migrateJSONFiles(time.Now())
+	out, _ := json.MarshalIndent(report, "", "  ")
+	fmt.Println(string(out))
+	if err != nil {
+		log.Printf("JSON migration failed: %v", err)
+		return 1
+	}
+	return 0
+}
+
+// handleMigrateJSON migrates the legacy JSON files and returns the report (POST)
+func handleMigrateJSON(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	report, err := migrateJSONFiles(time.Now())
+	if errors.Is(err, errInvalidLegacyFile) {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	} else if err != nil {
+		log.Printf("Error migrating JSON files: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Legacy JSON Migration Tests
+// ============================================================================
+
+// writeLegacyFile writes a legacy JSON file in a temporary folder and returns its path
+func writeLegacyFile(t *testing.T, name, content string) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestMigrateMembersFile(t *testing.T) {
+	setupTest()
+	path := writeLegacyFile(t, "members.json", `[
+		{"name": "Carol", "uid": "TEST_UID_3", "discord_id": "333333333", "role": "exec"},
+		{"name": "Alice again", "uid": "TEST_UID_1", "discord_id": "111111111"},
+		{"name": "Dave", "uid": "TEST_UID_4"},
+		{"name": "Erin", "uid": "TEST_UID_5", "discord_id": "555555555", "role": "captain"}
+	]`)
+
+	report, err := migrateMembersFile(path, time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !report.Found || report.Imported != 1 || len(report.Skipped) != 1 || len(report.Invalid) != 2 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if m, ok := memberCache.get("TEST_UID_3"); !ok || m.Role != roleExec || memberOrg(m) != defaultOrg {
+		t.Errorf("expected Carol imported as an exec, got %+v", m)
+	}
+
+	// The file is archived so the migration runs once
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("expected members.json to be moved")
+	}
+	if _, err := os.Stat(report.ArchivedTo); err != nil {
+		t.Errorf("expected the archive at %s: %v", report.ArchivedTo, err)
+	}
+}
+
+func TestMigrateMembersFile_Invalid(t *testing.T) {
+	setupTest()
+	path := writeLegacyFile(t, "members.json", `{"not": "a list"}`)
+
+	if _, err := migrateMembersFile(path, time.Now()); err == nil {
+		t.Error("expected an error for a malformed file")
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("expected a malformed file to stay in place")
+	}
+
+	report, err := migrateMembersFile(filepath.Join(t.TempDir(), "members.json"), time.Now())
+	if err != nil || report.Found {
+		t.Errorf("expected a missing file to be reported as not found, got %+v (err %v)", report, err)
+	}
+}
+
+func TestMigrateAttendeesFile(t *testing.T) {
+	setupTest()
+	useStatelessMode(t)
+
+	now := time.Now()
+	cleanup := lastNightlyCleanup(now)
+	path := writeLegacyFile(t, "current_attendees.json", `{
+		"TEST_UID_1": "`+cleanup.Add(time.Minute).Format(time.RFC3339)+`",
+		"TEST_UID_2": "`+cleanup.Add(-time.Hour).Format(time.RFC3339)+`",
+		"UNKNOWN": "`+now.Format(time.RFC3339)+`"
+	}`)
+
+	report, err := migrateAttendeesFile(path, now)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if report.Imported != 1 || len(report.Closed) != 1 || len(report.Invalid) != 1 || report.ArchivedTo == "" {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
+		t.Error("expected Alice's session in the open_sessions table")
+	}
+
+	// Bob's session from before the cleanup is recorded as a visit ending at it
+	var signout string
+	db.QueryRow(`SELECT signout_time FROM visits WHERE member_id = 2`).Scan(&signout)
+	if signout != cleanup.Format(time.RFC3339) {
+		t.Errorf("expected Bob's visit to end at %v, got %q", cleanup, signout)
+	}
+}
+
+func TestMigrateAttendeesFile_LiveStore(t *testing.T) {
+	setupTest()
+	path := writeLegacyFile(t, "current_attendees.json", `{}`)
+
+	report, err := migrateAttendeesFile(path, time.Now())
+	if err != nil || report.Note == "" || report.ArchivedTo != "" {
+		t.Errorf("expected the live file to be left alone, got %+v (err %v)", report, err)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Error("expected current_attendees.json to stay in place")
+	}
+}
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Mutual TLS for Scanners ---
+//
+// When MTLS_LISTEN_ADDR is set, a second HTTPS listener is started that
+// requires a client certificate signed by MTLS_CLIENT_CA_FILE. Scanners
+// connecting there are identified by the SHA-256 fingerprint of their
+// certificate, which must be registered on a device through
+// /devices/{id}/certificate. No API key is needed on that listener.
+
+const deviceCertValidity = 2 * 365 * 24 * time.Hour
+
+var (
+	// CA pool used to verify scanner client certificates
+	mtlsClientCAs *x509.CertPool
+
+	// Optional CA certificate and key used to issue device certificates
+	mtlsCACert *x509.Certificate
+	mtlsCAKey  crypto.Signer
+)
+
+// deviceContextKey is the request context key holding the authenticated Device
+type deviceContextKey struct{}
+
+// DeviceCertificateResponse describes a device certificate (and its key when freshly issued)
+type DeviceCertificateResponse struct {
+	DeviceID    int64     `json:"device_id"`
+	Fingerprint string    `json:"fingerprint"`
+	ExpiresAt   time.Time `json:"expires_at"`
+	Certificate string    `json:"certificate"`
+	PrivateKey  string    `json:"private_key,omitempty"`
+}
+
+// certFingerprint returns the hex SHA-256 fingerprint of a DER-encoded certificate
+func certFingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return hex.EncodeToString(sum[:])
+}
+
+// loadMTLSConfig loads the client CA (and optional CA key) from the environment
+func loadMTLSConfig() error {
+	caFile := os.Getenv("MTLS_CLIENT_CA_FILE")
+	if caFile == "" {
+		return nil
+	}
+
+	caPEM, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA: %w", err)
+	}
+	block, _ := pem.Decode(caPEM)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return fmt.Errorf("client CA file does not contain a PEM certificate")
+	}
+	caCert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return fmt.Errorf("failed to parse client CA: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(caCert)
+	mtlsClientCAs = pool
+	mtlsCACert = caCert
+
+	keyFile := os.Getenv("MTLS_CLIENT_CA_KEY_FILE")
+	if keyFile == "" {
+		return nil
+	}
+	keyPEM, err := os.ReadFile(keyFile)
+	if err != nil {
+		return fmt.Errorf("failed to read client CA key: %w", err)
+	}
+	keyBlock, _ := pem.Decode(keyPEM)
+	if keyBlock == nil {
+		return fmt.Errorf("client CA key file does not contain a PEM key")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		if ecKey, ecErr := x509.ParseECPrivateKey(keyBlock.Bytes); ecErr == nil {
+			key = ecKey
+		} else {
+			return fmt.Errorf("failed to parse client CA key: %w", err)
+		}
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return fmt.Errorf("client CA key cannot sign certificates")
+	}
+	mtlsCAKey = signer
+	return nil
+}
+
+// issueDeviceCertificate creates a new client certificate for the device signed by the CA
+func issueDeviceCertificate(device Device) (certPEM, keyPEM []byte, cert *x509.Certificate, err error) {
+	if mtlsCACert == nil || mtlsCAKey == nil {
+		return nil, nil, nil, errors.New("certificate issuance is not configured")
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: device.Name},
+		NotBefore:    now.Add(-5 * time.Minute),
+		NotAfter:     now.Add(deviceCertValidity),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, mtlsCACert, key.Public(), mtlsCAKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	cert, err = x509.ParseCertificate(der)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, cert, nil
+}
+
+// parseDeviceCertificate parses a PEM certificate and verifies it against the client CA if configured
+func parseDeviceCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(certPEM))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("certificate must be PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	if mtlsClientCAs != nil {
+		if _, err := cert.Verify(x509.VerifyOptions{
+			Roots:     mtlsClientCAs,
+			KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		}); err != nil {
+			return nil, fmt.Errorf("certificate is not signed by the client CA: %w", err)
+		}
+	}
+	return cert, nil
+}
+
+// storeDeviceCertificate saves the certificate as the device's current identity
+func storeDeviceCertificate(deviceID int64, cert *x509.Certificate) error {
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: cert.Raw})
+	_, err := db.Exec(`UPDATE devices SET cert_fingerprint = ?, cert_pem = ?, cert_expires_at = ? WHERE id = ?`,
+		certFingerprint(cert.Raw), string(certPEM), cert.NotAfter.Format(time.RFC3339), deviceID)
+	return err
+}
+
+// handleDeviceCertificate manages /devices/{id}/certificate
+//   - GET: return the registered certificate
+//   - POST: issue a new certificate and key signed by the configured CA
+//   - PUT: register an externally issued certificate, body: {"certificate": "<PEM>"}
+//   - DELETE: revoke the device's certificate
+func handleDeviceCertificate(w http.ResponseWriter, r *http.Request, deviceID int64) {
+	device, err := loadDevice(deviceID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying device: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		var certPEM sql.NullString
+		if err := db.QueryRow(`SELECT cert_pem FROM devices WHERE id = ?`, deviceID).Scan(&certPEM); err != nil {
+			log.Printf("Error querying device certificate: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !certPEM.Valid || device.CertExpiresAt == nil {
+			http.Error(w, "Device has no certificate", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeviceCertificateResponse{
+			DeviceID:    device.ID,
+			Fingerprint: device.CertFingerprint,
+			ExpiresAt:   *device.CertExpiresAt,
+			Certificate: certPEM.String,
+		})
+
+	case http.MethodPost:
+		certPEM, keyPEM, cert, err := issueDeviceCertificate(device)
+		if err != nil {
+			log.Printf("Error issuing certificate for device %d: %v", deviceID, err)
+			http.Error(w, "Could not issue certificate: "+err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		if err := storeDeviceCertificate(deviceID, cert); err != nil {
+			log.Printf("Error storing certificate for device %d: %v", deviceID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("device.certificate.issued", clientIP(r), fmt.Sprintf("device=%d fingerprint=%s", deviceID, certFingerprint(cert.Raw)))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(DeviceCertificateResponse{
+			DeviceID:    deviceID,
+			Fingerprint: certFingerprint(cert.Raw),
+			ExpiresAt:   cert.NotAfter,
+			Certificate: string(certPEM),
+			PrivateKey:  string(keyPEM),
+		})
+
+	case http.MethodPut:
+		var req struct {
+			Certificate string `json:"certificate"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		cert, err := parseDeviceCertificate(strings.TrimSpace(req.Certificate))
+		if err != nil {
+			http.Error(w, "Invalid certificate: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := storeDeviceCertificate(deviceID, cert); err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Certificate already registered to another device", http.StatusConflict)
+				return
+			}
+			log.Printf("Error storing certificate for device %d: %v", deviceID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("device.certificate.registered", clientIP(r), fmt.Sprintf("device=%d fingerprint=%s", deviceID, certFingerprint(cert.Raw)))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(DeviceCertificateResponse{
+			DeviceID:    deviceID,
+			Fingerprint: certFingerprint(cert.Raw),
+			ExpiresAt:   cert.NotAfter,
+			Certificate: strings.TrimSpace(req.Certificate),
+		})
+
+	case http.MethodDelete:
+		if _, err := db.Exec(`UPDATE devices SET cert_fingerprint = NULL, cert_pem = NULL, cert_expires_at = NULL WHERE id = ?`, deviceID); err != nil {
+			log.Printf("Error revoking certificate for device %d: %v", deviceID, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("device.certificate.revoked", clientIP(r), fmt.Sprintf("device=%d", deviceID))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Certificate revoked"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// mtlsDeviceMiddleware admits only requests presenting the certificate of a registered device
+func mtlsDeviceMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS == nil || len(r.TLS.PeerCertificates) == 0 {
+			http.Error(w, "Client certificate required", http.StatusUnauthorized)
+			return
+		}
+
+		fingerprint := certFingerprint(r.TLS.PeerCertificates[0].Raw)
+		device, err := scanDevice(db.QueryRow(`SELECT `+deviceColumns+` FROM devices WHERE cert_fingerprint = ?`, fingerprint))
+		if err == sql.ErrNoRows {
+			log.Printf("mTLS: rejected unregistered certificate %s from %s", fingerprint, clientIP(r))
+			recordAudit("device.certificate.rejected", clientIP(r), "fingerprint="+fingerprint)
+			http.Error(w, "Certificate not registered to a device", http.StatusForbidden)
+			return
+		} else if err != nil {
+			log.Printf("Error looking up device certificate: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		// Scanners act for their device's organization
+		ctx := context.WithValue(withOrg(r.Context(), device.OrgID), deviceContextKey{}, device)
+		next(w, r.WithContext(ctx))
+	}
+}
+
+// deviceFromContext returns the device authenticated for this request, if any
+func deviceFromContext(ctx context.Context) (Device, bool) {
+	device, ok := ctx.Value(deviceContextKey{}).(Device)
+	return device, ok
+}
+
+// handleScannerDevice serves a scanner's own device resources on the mTLS listener
+func handleScannerDevice(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/devices/")
+	if !ok {
+		http.Error(w, "Invalid device ID", http.StatusBadRequest)
+		return
+	}
+	if device, _ := deviceFromContext(r.Context()); device.ID != id {
+		http.Error(w, "Forbidden: certificate belongs to another device", http.StatusForbidden)
+		return
+	}
+
+	switch sub {
+	case "channel":
+		handleDeviceChannel(w, r, id)
+	case "config":
+		handleDeviceConfig(w, r, id)
+	case "firmware":
+		handleDeviceFirmware(w, r, id)
+	case "heartbeat":
+		handleDeviceHeartbeat(w, r, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// listenMTLS opens the scanner mTLS listener on addr, or takes the socket
+// activated by systemd
+func listenMTLS(addr string, activated net.Listener) (net.Listener, error) {
+	if os.Getenv("MTLS_CERT_FILE") == "" || os.Getenv("MTLS_KEY_FILE") == "" || mtlsClientCAs == nil {
+		return nil, fmt.Errorf("the mTLS listener requires MTLS_CERT_FILE, MTLS_KEY_FILE and MTLS_CLIENT_CA_FILE")
+	}
+	if activated != nil {
+		return activated, nil
+	}
+	return net.Listen("tcp", addr)
+}
+
+// startMTLSServer serves scanner endpoints on a listener that requires client certificates
+func startMTLSServer(ln net.Listener) {
+	certFile := os.Getenv("MTLS_CERT_FILE")
+	keyFile := os.Getenv("MTLS_KEY_FILE")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/scan", methodsMiddleware(mtlsDeviceMiddleware(handleScan), "POST"))                 // POST: scanner sends UID here
+	mux.HandleFunc("/scan/result/", methodsMiddleware(mtlsDeviceMiddleware(handleScanResult), "GET"))    // GET: result of an asynchronous scan
+	mux.HandleFunc("/health", methodsMiddleware(handleHealth, "GET"))                                    // GET: health check
+	mux.HandleFunc("/devices/", methodsMiddleware(mtlsDeviceMiddleware(handleScannerDevice), "GET"))     // GET: /devices/{id}/config and /devices/{id}/firmware of the scanner's own device
+	mux.HandleFunc("/firmware/", methodsMiddleware(mtlsDeviceMiddleware(handleFirmwareDownload), "GET")) // GET: download a firmware binary
+
+	server := &http.Server{
+		Handler: basePathMiddleware(mux),
+		TLSConfig: &tls.Config{
+			ClientAuth: tls.RequireAndVerifyClientCert,
+			ClientCAs:  mtlsClientCAs,
+			MinVersion: tls.VersionTLS12,
+		},
+	}
+
+	log.Printf("mTLS scanner listener starting on %s...", ln.Addr())
+	if err := server.ServeTLS(ln, certFile, keyFile); err != nil {
+		log.Fatal("mTLS listener: ", err)
+	}
+}
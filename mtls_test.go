@@ -0,0 +1,239 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// mTLS / Device Certificate Tests
+// ============================================================================
+
+// setupTestCA installs a freshly generated client CA for issuing device certificates
+func setupTestCA(t *testing.T) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate CA key: %v", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "Test Scanner CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(24 * time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+	if err != nil {
+		t.Fatalf("failed to create CA: %v", err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+
+	mtlsCACert = cert
+	mtlsCAKey = key
+	mtlsClientCAs = x509.NewCertPool()
+	mtlsClientCAs.AddCert(cert)
+}
+
+// issueTestCertificate issues a device certificate through the API
+func issueTestCertificate(t *testing.T, deviceID int64) DeviceCertificateResponse {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/devices/%d/certificate", deviceID), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp DeviceCertificateResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return resp
+}
+
+// tlsStateFor builds a connection state presenting the given PEM certificate
+func tlsStateFor(t *testing.T, certPEM string) *tls.ConnectionState {
+	t.Helper()
+
+	block, _ := pem.Decode([]byte(certPEM))
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+}
+
+func TestHandleDeviceCertificate_IssueNotConfigured(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/devices/%d/certificate", device.ID), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 when no CA key is configured, got %v", rr.Code)
+	}
+}
+
+func TestHandleDeviceCertificate_IssueAndGet(t *testing.T) {
+	setupTest()
+	setupTestCA(t)
+
+	device := createTestDevice(t, "front-door")
+	issued := issueTestCertificate(t, device.ID)
+
+	if issued.PrivateKey == "" || issued.Certificate == "" || issued.Fingerprint == "" {
+		t.Fatalf("expected certificate, key and fingerprint, got %+v", issued)
+	}
+
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/devices/%d/certificate", device.ID), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	var got DeviceCertificateResponse
+	json.Unmarshal(rr.Body.Bytes(), &got)
+	if got.Fingerprint != issued.Fingerprint {
+		t.Errorf("expected fingerprint %s, got %s", issued.Fingerprint, got.Fingerprint)
+	}
+	if got.PrivateKey != "" {
+		t.Error("private key must not be returned after issuance")
+	}
+}
+
+func TestHandleDeviceCertificate_RegisterExternal(t *testing.T) {
+	setupTest()
+	setupTestCA(t)
+
+	first := createTestDevice(t, "front-door")
+	issued := issueTestCertificate(t, first.ID)
+
+	// Registering the same certificate on a second device conflicts
+	second := createTestDevice(t, "back-door")
+	body, _ := json.Marshal(map[string]string{"certificate": issued.Certificate})
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/devices/%d/certificate", second.ID), bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleDeviceCertificate_RegisterInvalid(t *testing.T) {
+	setupTest()
+
+	device := createTestDevice(t, "front-door")
+
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/devices/%d/certificate", device.ID), bytes.NewBufferString(`{"certificate":"nope"}`))
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestHandleDeviceCertificate_DeviceNotFound(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/devices/42/certificate", nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found, got %v", rr.Code)
+	}
+}
+
+func TestMTLSDeviceMiddleware_RegisteredCertificate(t *testing.T) {
+	setupTest()
+	setupTestCA(t)
+
+	device := createTestDevice(t, "front-door")
+	issued := issueTestCertificate(t, device.ID)
+
+	var seen Device
+	handler := mtlsDeviceMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		seen, _ = deviceFromContext(r.Context())
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("POST", "/scan", nil)
+	req.TLS = tlsStateFor(t, issued.Certificate)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if seen.ID != device.ID {
+		t.Errorf("expected device %d in context, got %+v", device.ID, seen)
+	}
+}
+
+func TestMTLSDeviceMiddleware_RevokedCertificate(t *testing.T) {
+	setupTest()
+	setupTestCA(t)
+
+	device := createTestDevice(t, "front-door")
+	issued := issueTestCertificate(t, device.ID)
+
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/devices/%d/certificate", device.ID), nil)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK on revoke, got %v", rr.Code)
+	}
+
+	handler := mtlsDeviceMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	})
+
+	req, _ = http.NewRequest("POST", "/scan", nil)
+	req.TLS = tlsStateFor(t, issued.Certificate)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden for revoked certificate, got %v", rr.Code)
+	}
+}
+
+func TestMTLSDeviceMiddleware_NoCertificate(t *testing.T) {
+	setupTest()
+
+	handler := mtlsDeviceMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	})
+
+	req, _ := http.NewRequest("POST", "/scan", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 Unauthorized, got %v", rr.Code)
+	}
+}
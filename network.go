@@ -0,0 +1,242 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Network Policy ---
+//
+// NETWORK_POLICY restricts endpoint groups to CIDR allowlists, e.g.
+//
+//	NETWORK_POLICY=/scan=192.168.1.0/24;/admin/*=10.8.0.0/24,127.0.0.1/32
+//
+// Rules are separated by ';'. Each rule is a path pattern and a comma-separated
+// list of CIDRs (or bare IPs). A pattern ending in '*' matches every path with
+// that prefix; otherwise it must match the path exactly. When several rules
+// match, the most specific (longest) pattern wins. Paths without a matching
+// rule are not restricted.
+//
+// Rejections come before authentication, so anyone can cause them. Each one is
+// counted in network_rejected_total, but only the first from a client in every
+// networkAuditWindow is logged and audited; the next audited one says how many
+// were left out. Clients idle for a window are pruned as rejections come in,
+// with a summary entry for any rejections of theirs that were left out.
+
+// networkAuditWindow is how often rejections from one client are audited
+const networkAuditWindow = 10 * time.Minute
+
+// networkRejection tracks the audited rejections of a single client
+type networkRejection struct {
+	AuditedAt  time.Time
+	LastSeen   time.Time
+	Suppressed int // Rejections since AuditedAt that were not audited
+}
+
+var (
+	networkRejectionsMu sync.Mutex
+	networkRejections   = make(map[string]*networkRejection)
+	networkPrunedAt     time.Time // Last prune of networkRejections
+)
+
+// networkPolicy is a single path pattern with its allowed networks
+type networkPolicy struct {
+	Pattern  string
+	Networks []*net.IPNet
+}
+
+// networkPolicies holds the parsed NETWORK_POLICY rules (loaded at startup)
+var networkPolicies []networkPolicy
+
+// matches reports whether the policy pattern applies to the given path
+func (p networkPolicy) matches(path string) bool {
+	if prefix, ok := strings.CutSuffix(p.Pattern, "*"); ok {
+		return strings.HasPrefix(path, prefix)
+	}
+	return path == p.Pattern
+}
+
+// allows reports whether ip falls inside one of the policy's networks
+func (p networkPolicy) allows(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseNetworkPolicies parses a NETWORK_POLICY value into rules
+func parseNetworkPolicies(value string) ([]networkPolicy, error) {
+	var policies []networkPolicy
+	for _, rule := range strings.Split(value, ";") {
+		rule = strings.TrimSpace(rule)
+		if rule == "" {
+			continue
+		}
+
+		pattern, cidrs, ok := strings.Cut(rule, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || !strings.HasPrefix(pattern, "/") {
+			return nil, fmt.Errorf("invalid network policy rule %q, expected /path=cidr[,cidr]", rule)
+		}
+
+		policy := networkPolicy{Pattern: pattern}
+		for _, cidr := range strings.Split(cidrs, ",") {
+			cidr = strings.TrimSpace(cidr)
+			if cidr == "" {
+				continue
+			}
+			network, err := parseNetwork(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network %q in rule for %s: %w", cidr, pattern, err)
+			}
+			policy.Networks = append(policy.Networks, network)
+		}
+		if len(policy.Networks) == 0 {
+			return nil, fmt.Errorf("network policy rule for %s has no networks", pattern)
+		}
+
+		policies = append(policies, policy)
+	}
+	return policies, nil
+}
+
+// parseNetwork parses a CIDR, treating a bare IP address as a single-host network
+func parseNetwork(value string) (*net.IPNet, error) {
+	if !strings.Contains(value, "/") {
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return nil, fmt.Errorf("not an IP address")
+		}
+		bits := 128
+		if ip.To4() != nil {
+			ip = ip.To4()
+			bits = 32
+		}
+		return &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)}, nil
+	}
+	_, network, err := net.ParseCIDR(value)
+	return network, err
+}
+
+// loadNetworkPolicies loads network policy rules from the NETWORK_POLICY environment variable
+func loadNetworkPolicies() ([]networkPolicy, error) {
+	return parseNetworkPolicies(os.Getenv("NETWORK_POLICY"))
+}
+
+// policyForPath returns the most specific policy matching the path, if any
+func policyForPath(path string) (networkPolicy, bool) {
+	var best networkPolicy
+	found := false
+	for _, p := range networkPolicies {
+		if p.matches(path) && (!found || len(p.Pattern) > len(best.Pattern)) {
+			best = p
+			found = true
+		}
+	}
+	return best, found
+}
+
+// clientIP returns the IP address of the client, taken from X-Forwarded-For
+// when the request came through a trusted proxy (see proxy.go)
+func clientIP(r *http.Request) string {
+	peer, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		peer = r.RemoteAddr
+	}
+	if trustedProxies.trusts(net.ParseIP(peer)) || (trustedProxies.Unix && viaUnixSocket(r)) {
+		return forwardedClientIP(r, peer)
+	}
+	return peer
+}
+
+// auditNetworkRejection registers a rejection from a client and reports
+// whether it is audited, with how many rejections were left out before it
+func auditNetworkRejection(ip string, now time.Time) (bool, int) {
+	networkRejectionsMu.Lock()
+	var idle map[string]int // Rejections left out for clients being pruned
+	if now.Sub(networkPrunedAt) > networkAuditWindow {
+		for client, rej := range networkRejections {
+			if now.Sub(rej.LastSeen) > networkAuditWindow {
+				if rej.Suppressed > 0 {
+					if idle == nil {
+						idle = make(map[string]int)
+					}
+					idle[client] = rej.Suppressed
+				}
+				delete(networkRejections, client)
+			}
+		}
+		networkPrunedAt = now
+	}
+
+	audit, suppressed := true, 0
+	if rej, ok := networkRejections[ip]; !ok {
+		networkRejections[ip] = &networkRejection{AuditedAt: now, LastSeen: now}
+	} else if rej.LastSeen = now; now.Sub(rej.AuditedAt) < networkAuditWindow {
+		rej.Suppressed++
+		audit = false
+	} else {
+		suppressed = rej.Suppressed
+		rej.AuditedAt, rej.Suppressed = now, 0
+	}
+	networkRejectionsMu.Unlock()
+
+	// Summarize what was left out for clients that went quiet
+	for client, n := range idle {
+		recordAudit("network.rejected", client, fmt.Sprintf("%d more rejected since the last entry", n))
+	}
+	return audit, suppressed
+}
+
+// resetNetworkRejections forgets the rejections of every client
+func resetNetworkRejections() {
+	networkRejectionsMu.Lock()
+	networkRejections = make(map[string]*networkRejection)
+	networkPrunedAt = time.Time{}
+	networkRejectionsMu.Unlock()
+}
+
+// networkPolicyMiddleware rejects requests from networks not allowed for the requested path
+func networkPolicyMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		policy, restricted := policyForPath(r.URL.Path)
+		if !restricted {
+			next(w, r)
+			return
+		}
+
+		ip := clientIP(r)
+		if !policy.allows(net.ParseIP(ip)) {
+			incCounter("network_rejected_total")
+			if audit, suppressed := auditNetworkRejection(ip, time.Now()); audit {
+				detail := fmt.Sprintf("%s %s (policy %s)", r.Method, r.URL.Path, policy.Pattern)
+				if suppressed > 0 {
+					detail += fmt.Sprintf(", %d more rejected since the last entry", suppressed)
+				}
+				log.Printf("Network policy: rejected %s from %s", detail, ip)
+				recordAudit("network.rejected", ip, detail)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			json.NewEncoder(w).Encode(map[string]string{
+				"error": "access from this network is not allowed",
+			})
+			return
+		}
+
+		next(w, r)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Network Policy Tests
+// ============================================================================
+
+func TestParseNetworkPolicies_Valid(t *testing.T) {
+	policies, err := parseNetworkPolicies("/scan=192.168.1.0/24; /admin/*=10.8.0.0/24,127.0.0.1")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policies) != 2 {
+		t.Fatalf("expected 2 policies, got %d", len(policies))
+	}
+	if policies[1].Pattern != "/admin/*" || len(policies[1].Networks) != 2 {
+		t.Errorf("unexpected admin policy: %+v", policies[1])
+	}
+}
+
+func TestParseNetworkPolicies_Invalid(t *testing.T) {
+	cases := []string{
+		"scan=192.168.1.0/24",  // pattern must start with /
+		"/scan",                // missing networks
+		"/scan=",               // empty networks
+		"/scan=not-an-ip",      // invalid address
+		"/scan=192.168.1.0/99", // invalid mask
+	}
+	for _, c := range cases {
+		if _, err := parseNetworkPolicies(c); err == nil {
+			t.Errorf("expected error for %q", c)
+		}
+	}
+}
+
+func TestPolicyForPath_MostSpecificWins(t *testing.T) {
+	setupTest()
+
+	networkPolicies, _ = parseNetworkPolicies("/admin/*=10.0.0.0/8;/admin/audit-log=127.0.0.1")
+
+	policy, ok := policyForPath("/admin/audit-log")
+	if !ok || policy.Pattern != "/admin/audit-log" {
+		t.Errorf("expected exact rule to win, got %+v", policy)
+	}
+
+	policy, ok = policyForPath("/admin/other")
+	if !ok || policy.Pattern != "/admin/*" {
+		t.Errorf("expected prefix rule, got %+v", policy)
+	}
+
+	if _, ok := policyForPath("/scan"); ok {
+		t.Error("expected /scan to be unrestricted")
+	}
+}
+
+func TestNetworkPolicyMiddleware_AllowsListedNetwork(t *testing.T) {
+	setupTest()
+
+	networkPolicies, _ = parseNetworkPolicies("/scan=192.168.1.0/24")
+
+	handler := networkPolicyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("POST", "/scan", nil)
+	req.RemoteAddr = "192.168.1.42:51234"
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK from allowed network, got %v", rr.Code)
+	}
+}
+
+func TestNetworkPolicyMiddleware_RejectsAndAudits(t *testing.T) {
+	setupTest()
+
+	networkPolicies, _ = parseNetworkPolicies("/scan=192.168.1.0/24")
+
+	handler := networkPolicyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	})
+
+	req, _ := http.NewRequest("POST", "/scan", nil)
+	req.RemoteAddr = "203.0.113.9:40000"
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 Forbidden, got %v", rr.Code)
+	}
+
+	entries, err := loadAuditEntries("network.", 0)
+	if err != nil {
+		t.Fatalf("failed to load audit log: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Actor != "203.0.113.9" {
+		t.Errorf("expected one rejection audited for 203.0.113.9, got %+v", entries)
+	}
+}
+
+func TestNetworkPolicyMiddleware_AuditsOncePerWindow(t *testing.T) {
+	setupTest()
+
+	networkPolicies, _ = parseNetworkPolicies("/scan=192.168.1.0/24")
+
+	handler := networkPolicyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be reached")
+	})
+
+	for _, addr := range []string{"203.0.113.9:40000", "203.0.113.9:40001", "203.0.113.9:40002", "198.51.100.7:40000"} {
+		req, _ := http.NewRequest("POST", "/scan", nil)
+		req.RemoteAddr = addr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != http.StatusForbidden {
+			t.Fatalf("expected 403 Forbidden from %s, got %v", addr, rr.Code)
+		}
+	}
+
+	entries, err := loadAuditEntries("network.", 0)
+	if err != nil {
+		t.Fatalf("failed to load audit log: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected one audit entry per client, got %+v", entries)
+	}
+	if got := counters["network_rejected_total"]; got != 4 {
+		t.Errorf("expected every rejection counted, got %v", got)
+	}
+
+	// After the window, the next rejection is audited with the ones left out
+	start := time.Now()
+	if audit, _ := auditNetworkRejection("203.0.113.9", start.Add(networkAuditWindow-time.Second)); audit {
+		t.Error("expected a rejection within the window not to be audited")
+	}
+	audit, suppressed := auditNetworkRejection("203.0.113.9", start.Add(networkAuditWindow+time.Second))
+	if !audit || suppressed != 3 {
+		t.Errorf("expected an audit reporting 3 left out, got %v, %d", audit, suppressed)
+	}
+
+	// A client that went quiet is pruned with a summary of what was left out
+	auditNetworkRejection("198.51.100.7", start.Add(networkAuditWindow+2*time.Second))
+	auditNetworkRejection("198.51.100.7", start.Add(networkAuditWindow+3*time.Second))
+	auditNetworkRejection("192.0.2.1", start.Add(3*networkAuditWindow))
+	entries, err = loadAuditEntries("network.", 0)
+	if err != nil {
+		t.Fatalf("failed to load audit log: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Actor != "198.51.100.7" || !strings.HasPrefix(entries[0].Detail, "1 more rejected") {
+		t.Errorf("expected a summary entry for 198.51.100.7, got %+v", entries)
+	}
+}
+
+func TestNetworkPolicyMiddleware_UnrestrictedPath(t *testing.T) {
+	setupTest()
+
+	networkPolicies, _ = parseNetworkPolicies("/admin/*=10.8.0.0/24")
+
+	handler := networkPolicyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	req, _ := http.NewRequest("GET", "/current", nil)
+	req.RemoteAddr = "203.0.113.9:40000"
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK for unrestricted path, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- NFC Phone Check-In ---
+//
+// Members can tap a phone running a card emulation (HCE) app instead of a
+// card. Each member provisions a key through the self-service portal
+// (POST /me/nfc-key): a key ID and a secret shared with the phone app. A
+// check-in is a challenge-response exchange relayed by the scanner:
+//
+//  1. The scanner asks for a challenge with POST /checkin/nfc/challenge.
+//  2. It sends the challenge to the phone, which answers with a token
+//     "nfc1.<key_id>.<mac>", mac being the unpadded base64url encoded
+//     HMAC-SHA256 of "nfc1.<key_id>.<challenge>" keyed with the secret.
+//  3. The scanner posts the challenge and token to POST /checkin/nfc, which
+//     signs the member in or out like a card scan.
+//
+// Challenges expire after nfcChallengeTTL and can only be used once, so a
+// recorded token cannot be replayed. They are stored in the database so any
+// instance can verify them.
+
+const (
+	// nfcTokenVersion prefixes tokens and the data they sign
+	nfcTokenVersion = "nfc1"
+
+	// nfcChallengeTTL is how long the scanner has to relay a challenge
+	nfcChallengeTTL = 30 * time.Second
+)
+
+// NFCKey is a member's phone key; the secret is only returned when provisioned
+type NFCKey struct {
+	MemberID   int64      `json:"member_id"`
+	KeyID      string     `json:"key_id"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	Secret     string     `json:"secret,omitempty"` // Base64url, only returned when provisioned
+}
+
+// NFCChallenge is a challenge for the phone to sign
+type NFCChallenge struct {
+	Challenge string    `json:"challenge"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NFCCheckInRequest is the payload of POST /checkin/nfc
+type NFCCheckInRequest struct {
+	Challenge string `json:"challenge"`
+	Token     string `json:"token"`
+	Room      string `json:"room,omitempty"` // Optional, defaults to defaultRoom
+}
+
+// nfcKeyColumns is the column list scanned by scanNFCKey
+const nfcKeyColumns = `member_id, key_id, secret, created_at, last_used_at`
+
+// scanNFCKey reads an NFC key row selected with nfcKeyColumns, including its secret
+func scanNFCKey(row rowScanner) (NFCKey, error) {
+	var k NFCKey
+	var createdAt string
+	var lastUsedAt sql.NullString
+	if err := row.Scan(&k.MemberID, &k.KeyID, &k.Secret, &createdAt, &lastUsedAt); err != nil {
+		return NFCKey{}, err
+	}
+
+	var err error
+	if k.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return NFCKey{}, err
+	}
+	if lastUsedAt.Valid {
+		t, err := time.Parse(time.RFC3339, lastUsedAt.String)
+		if err != nil {
+			return NFCKey{}, err
+		}
+		k.LastUsedAt = &t
+	}
+	return k, nil
+}
+
+// loadNFCKey fetches a member's NFC key
+func loadNFCKey(memberID int64) (NFCKey, error) {
+	return scanNFCKey(db.QueryRow(`SELECT `+nfcKeyColumns+` FROM nfc_keys WHERE member_id = ?`, memberID))
+}
+
+// findNFCKey fetches an NFC key by its key ID
+func findNFCKey(keyID string) (NFCKey, error) {
+	return scanNFCKey(db.QueryRow(`SELECT `+nfcKeyColumns+` FROM nfc_keys WHERE key_id = ?`, keyID))
+}
+
+// randomHex returns n random bytes as hex
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// provisionNFCKey creates a new key for a member, replacing any previous one
+func provisionNFCKey(memberID int64, now time.Time) (NFCKey, error) {
+	keyID, err := randomHex(8)
+	if err != nil {
+		return NFCKey{}, err
+	}
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return NFCKey{}, err
+	}
+
+	k := NFCKey{
+		MemberID:  memberID,
+		KeyID:     keyID,
+		CreatedAt: now.Truncate(time.Second),
+		Secret:    base64.RawURLEncoding.EncodeToString(secret),
+	}
+	_, err = db.Exec(`INSERT INTO nfc_keys (member_id, key_id, secret, created_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT(member_id) DO UPDATE SET key_id = excluded.key_id, secret = excluded.secret,
+			created_at = excluded.created_at, last_used_at = NULL`,
+		k.MemberID, k.KeyID, k.Secret, k.CreatedAt.Format(time.RFC3339))
+	if err != nil {
+		return NFCKey{}, err
+	}
+	return k, nil
+}
+
+// nfcMAC returns the MAC a phone holding secret answers a challenge with
+func nfcMAC(secret []byte, keyID, challenge string) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(nfcTokenVersion + "." + keyID + "." + challenge))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// issueNFCChallenge stores and returns a new challenge, dropping expired ones
+func issueNFCChallenge(now time.Time) (NFCChallenge, error) {
+	challenge, err := randomHex(16)
+	if err != nil {
+		return NFCChallenge{}, err
+	}
+	c := NFCChallenge{Challenge: challenge, ExpiresAt: now.Add(nfcChallengeTTL).Truncate(time.Second)}
+
+	if _, err := db.Exec(`DELETE FROM nfc_challenges WHERE expires_at < ?`, now.UTC().Format(time.RFC3339)); err != nil {
+		return NFCChallenge{}, err
+	}
+	if _, err := db.Exec(`INSERT INTO nfc_challenges (challenge, expires_at) VALUES (?, ?)`,
+		c.Challenge, c.ExpiresAt.UTC().Format(time.RFC3339)); err != nil {
+		return NFCChallenge{}, err
+	}
+	return c, nil
+}
+
+// consumeNFCChallenge uses up a challenge, reporting whether it was issued and
+// has not expired or been used before
+func consumeNFCChallenge(challenge string, now time.Time) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nfc_challenges WHERE challenge = ? AND expires_at >= ?`,
+		challenge, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// verifyNFCToken checks a token answering a challenge and returns the key that signed it
+func verifyNFCToken(token, challenge string) (NFCKey, bool, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != nfcTokenVersion {
+		return NFCKey{}, false, nil
+	}
+
+	k, err := findNFCKey(parts[1])
+	if err == sql.ErrNoRows {
+		return NFCKey{}, false, nil
+	} else if err != nil {
+		return NFCKey{}, false, err
+	}
+	secret, err := base64.RawURLEncoding.DecodeString(k.Secret)
+	if err != nil {
+		return NFCKey{}, false, err
+	}
+	if !hmac.Equal([]byte(parts[2]), []byte(nfcMAC(secret, k.KeyID, challenge))) {
+		return NFCKey{}, false, nil
+	}
+	return k, true, nil
+}
+
+// handleNFCChallenge issues a challenge for a scanner to relay to a phone
+func handleNFCChallenge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	c, err := issueNFCChallenge(time.Now())
+	if err != nil {
+		log.Printf("Error issuing NFC challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// handleNFCCheckIn verifies a phone's answer to a challenge and signs the
+// member in or out like a card scan
+func handleNFCCheckIn(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req NFCCheckInRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	if req.Challenge == "" || req.Token == "" {
+		http.Error(w, "challenge and token are required", http.StatusBadRequest)
+		return
+	}
+
+	fresh, err := consumeNFCChallenge(req.Challenge, time.Now())
+	if err != nil {
+		log.Printf("Error checking NFC challenge: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !fresh {
+		incCounter("nfc_checkins_rejected_total")
+		http.Error(w, "Unknown, expired or used challenge", http.StatusUnauthorized)
+		return
+	}
+
+	k, valid, err := verifyNFCToken(req.Token, req.Challenge)
+	if err != nil {
+		log.Printf("Error verifying NFC token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		incCounter("nfc_checkins_rejected_total")
+		http.Error(w, "Invalid NFC token", http.StatusUnauthorized)
+		return
+	}
+
+	// Keys of deleted members stop working
+	member, found := findMemberByID(k.MemberID)
+	if !found {
+		incCounter("nfc_checkins_rejected_total")
+		http.Error(w, "Invalid NFC token", http.StatusUnauthorized)
+		return
+	}
+	if _, err := db.Exec(`UPDATE nfc_keys SET last_used_at = ? WHERE key_id = ?`, time.Now().Format(time.RFC3339), k.KeyID); err != nil {
+		log.Printf("Error saving NFC key use: %v", err)
+	}
+
+	sc := scanFromRequest(r, ScanRequest{UID: member.UID, Room: req.Room})
+	sc.NFCKeyID = k.KeyID
+	processScan(w, sc)
+}
+
+// handleMeNFCKey manages the calling member's phone key: GET shows it, POST
+// provisions a new one (replacing any previous key) and DELETE revokes it
+func handleMeNFCKey(w http.ResponseWriter, r *http.Request) {
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		k, err := loadNFCKey(member.ID)
+		if err == sql.ErrNoRows {
+			http.Error(w, "No NFC key provisioned", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying NFC key: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		k.Secret = ""
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(k)
+
+	case http.MethodPost:
+		k, err := provisionNFCKey(member.ID, time.Now())
+		if err != nil {
+			log.Printf("Error provisioning NFC key: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("member.nfc_key_provisioned", clientIP(r), fmt.Sprintf("member=%d key=%s", member.ID, k.KeyID))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(k)
+
+	case http.MethodDelete:
+		res, err := db.Exec(`DELETE FROM nfc_keys WHERE member_id = ?`, member.ID)
+		if err != nil {
+			log.Printf("Error deleting NFC key: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			http.Error(w, "No NFC key provisioned", http.StatusNotFound)
+			return
+		}
+		recordAudit("member.nfc_key_revoked", clientIP(r), fmt.Sprintf("member=%d", member.ID))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "NFC key revoked successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
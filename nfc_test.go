@@ -0,0 +1,212 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /me/nfc-key Endpoint Tests
+// ============================================================================
+
+// meNFCKeyRequest calls /me/nfc-key as the member with a Discord ID
+func meNFCKeyRequest(method, discordID string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/me/nfc-key", nil)
+	req.Header.Set("X-Discord-ID", discordID)
+	rr := httptest.NewRecorder()
+	handleMeNFCKey(rr, req)
+	return rr
+}
+
+// provisionTestNFCKey provisions a key for the member with a Discord ID
+func provisionTestNFCKey(t *testing.T, discordID string) NFCKey {
+	t.Helper()
+
+	rr := meNFCKeyRequest("POST", discordID)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var k NFCKey
+	json.Unmarshal(rr.Body.Bytes(), &k)
+	return k
+}
+
+func TestHandleMeNFCKey_Provision(t *testing.T) {
+	setupTest()
+
+	k := provisionTestNFCKey(t, "111111111")
+	if k.MemberID != 1 || k.KeyID == "" || k.Secret == "" {
+		t.Fatalf("expected a key with its secret for Alice, got %+v", k)
+	}
+
+	// The secret is only shown once
+	var shown NFCKey
+	json.Unmarshal(meNFCKeyRequest("GET", "111111111").Body.Bytes(), &shown)
+	if shown.KeyID != k.KeyID || shown.Secret != "" {
+		t.Errorf("expected the key without its secret, got %+v", shown)
+	}
+
+	// Provisioning again replaces the key
+	replaced := provisionTestNFCKey(t, "111111111")
+	if replaced.KeyID == k.KeyID {
+		t.Error("expected a new key ID")
+	}
+	if _, err := findNFCKey(k.KeyID); err == nil {
+		t.Error("expected the old key to be gone")
+	}
+
+	entries, _ := loadAuditEntries("member.nfc_key_provisioned", 10)
+	if len(entries) != 2 {
+		t.Errorf("expected 2 audit entries, got %d", len(entries))
+	}
+}
+
+func TestHandleMeNFCKey_Revoke(t *testing.T) {
+	setupTest()
+
+	if rr := meNFCKeyRequest("GET", "222222222"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without a key, got %v", rr.Code)
+	}
+	provisionTestNFCKey(t, "222222222")
+	if rr := meNFCKeyRequest("DELETE", "222222222"); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %v", rr.Code)
+	}
+	if rr := meNFCKeyRequest("DELETE", "222222222"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 once revoked, got %v", rr.Code)
+	}
+	if rr := meNFCKeyRequest("GET", "999"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unlinked Discord ID, got %v", rr.Code)
+	}
+}
+
+// ============================================================================
+// /checkin/nfc Endpoint Tests
+// ============================================================================
+
+// nfcChallenge requests a challenge
+func nfcChallenge(t *testing.T) string {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/checkin/nfc/challenge", nil)
+	rr := httptest.NewRecorder()
+	handleNFCChallenge(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	var c NFCChallenge
+	json.Unmarshal(rr.Body.Bytes(), &c)
+	if c.Challenge == "" || !c.ExpiresAt.After(time.Now()) {
+		t.Fatalf("expected a challenge expiring later, got %+v", c)
+	}
+	return c.Challenge
+}
+
+// phoneToken answers a challenge as a phone holding the key would
+func phoneToken(k NFCKey, challenge string) string {
+	secret, _ := base64.RawURLEncoding.DecodeString(k.Secret)
+	return "nfc1." + k.KeyID + "." + nfcMAC(secret, k.KeyID, challenge)
+}
+
+// nfcCheckIn posts a check-in
+func nfcCheckIn(challenge, token string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(NFCCheckInRequest{Challenge: challenge, Token: token})
+	req, _ := http.NewRequest("POST", "/checkin/nfc", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handleNFCCheckIn(rr, req)
+	return rr
+}
+
+func TestHandleNFCCheckIn_SignsInAndOut(t *testing.T) {
+	setupTest()
+	k := provisionTestNFCKey(t, "111111111")
+
+	challenge := nfcChallenge(t)
+	rr := nfcCheckIn(challenge, phoneToken(k, challenge))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var resp map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp["status"] != "in" {
+		t.Errorf("expected status 'in', got %v", resp["status"])
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
+		t.Error("Alice should be signed in")
+	}
+
+	challenge = nfcChallenge(t)
+	nfcCheckIn(challenge, phoneToken(k, challenge))
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
+		t.Error("Alice should be signed out by a second tap")
+	}
+
+	used, _ := loadNFCKey(1)
+	if used.LastUsedAt == nil {
+		t.Error("expected the key's last use to be recorded")
+	}
+}
+
+func TestHandleNFCCheckIn_Rejected(t *testing.T) {
+	setupTest()
+	alice := provisionTestNFCKey(t, "111111111")
+	bob := provisionTestNFCKey(t, "222222222")
+
+	// A used challenge cannot be replayed
+	challenge := nfcChallenge(t)
+	token := phoneToken(alice, challenge)
+	nfcCheckIn(challenge, token)
+	if rr := nfcCheckIn(challenge, token); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a replayed challenge, got %v", rr.Code)
+	}
+
+	// Nor can a challenge that was never issued
+	if rr := nfcCheckIn("0123456789abcdef", phoneToken(alice, "0123456789abcdef")); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for an unknown challenge, got %v", rr.Code)
+	}
+
+	// Tokens signed with another key or malformed ones are refused
+	challenge = nfcChallenge(t)
+	forged := "nfc1." + alice.KeyID + "." + nfcMAC([]byte("wrong"), alice.KeyID, challenge)
+	if rr := nfcCheckIn(challenge, forged); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a forged token, got %v", rr.Code)
+	}
+	challenge = nfcChallenge(t)
+	if rr := nfcCheckIn(challenge, "not-a-token"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a malformed token, got %v", rr.Code)
+	}
+
+	// Revoked keys stop working
+	meNFCKeyRequest("DELETE", "222222222")
+	challenge = nfcChallenge(t)
+	if rr := nfcCheckIn(challenge, phoneToken(bob, challenge)); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for a revoked key, got %v", rr.Code)
+	}
+
+	if rr := nfcCheckIn("", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 without a challenge and token, got %v", rr.Code)
+	}
+
+	metricsMu.Lock()
+	rejected := counters["nfc_checkins_rejected_total"]
+	metricsMu.Unlock()
+	if rejected != 5 {
+		t.Errorf("expected 5 rejected check-ins, got %v", rejected)
+	}
+}
+
+func TestConsumeNFCChallenge_Expired(t *testing.T) {
+	setupTest()
+
+	c, err := issueNFCChallenge(time.Now().Add(-time.Minute))
+	if err != nil {
+		t.Fatalf("failed to issue challenge: %v", err)
+	}
+	if fresh, _ := consumeNFCChallenge(c.Challenge, time.Now()); fresh {
+		t.Error("expected an expired challenge to be refused")
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Notification Quiet Hours and Opt-Outs ---
+//
+// Webhook notifications are sent through an integration:
+//   - alerts: security and scanner alerts (ALERT_WEBHOOK_URL)
+//   - goals: reached hour goals (NOTIFY_WEBHOOK_URL)
+//   - office: the office opening and closing (OFFICE_WEBHOOK_URL)
+//   - after_hours: sign-ins outside office hours (AFTER_HOURS_WEBHOOK_URL, see officehours.go)
+//
+// Deliveries are logged so missed ones can be sent again (see webhooks.go).
+//
+// An integration may have quiet hours, a range of local hours during which its
+// notifications are dropped (counted in notifications_suppressed_total), so a
+// 2 AM scan does not ping the announcements channel. Members may opt out of
+// notifications: they are never named, so their goals are not announced and
+// office notifications leave them out. Both are stored in the database.
+
+// Notification integrations
+const (
+	integrationAlerts = "alerts"
+	integrationGoals  = "goals"
+	integrationOffice = "office"
+
+	integrationAfterHours = "after_hours"
+)
+
+// notificationIntegrations lists the integrations and the webhook URL of each
+var notificationIntegrations = []struct {
+	name string
+	url  func() string
+}{
+	{integrationAlerts, func() string { return os.Getenv("ALERT_WEBHOOK_URL") }},
+	{integrationGoals, func() string { return os.Getenv("NOTIFY_WEBHOOK_URL") }},
+	{integrationOffice, func() string {
+		if url := os.Getenv("OFFICE_WEBHOOK_URL"); url != "" {
+			return url
+		}
+		return os.Getenv("NOTIFY_WEBHOOK_URL")
+	}},
+	{integrationAfterHours, func() string { return os.Getenv("AFTER_HOURS_WEBHOOK_URL") }},
+}
+
+// QuietHours is the range of local hours during which an integration is silent
+type QuietHours struct {
+	Integration string `json:"integration"`
+	StartHour   int    `json:"start_hour"` // First silent hour (0-23)
+	EndHour     int    `json:"end_hour"`   // First hour notifications resume (0-23), may be earlier than start_hour to wrap midnight
+	Active      bool   `json:"active"`     // Whether notifications are being suppressed right now
+}
+
+// NotificationPreferences is a member's notification opt-out
+type NotificationPreferences struct {
+	MemberID int64 `json:"member_id"`
+	OptOut   bool  `json:"opt_out"`
+}
+
+// knownIntegration reports whether name is a notification integration
+func knownIntegration(name string) bool {
+	for _, i := range notificationIntegrations {
+		if i.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// includesHour reports whether the quiet hours include the hour of t
+func (q QuietHours) includesHour(t time.Time) bool {
+	hour := t.Hour()
+	if q.StartHour < q.EndHour {
+		return hour >= q.StartHour && hour < q.EndHour
+	}
+	return hour >= q.StartHour || hour < q.EndHour
+}
+
+// loadQuietHours returns the quiet hours of every integration that has them
+func loadQuietHours(now time.Time) ([]QuietHours, error) {
+	rows, err := db.Query(`SELECT integration, start_hour, end_hour FROM quiet_hours ORDER BY integration`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	quiet := []QuietHours{}
+	for rows.Next() {
+		var q QuietHours
+		if err := rows.Scan(&q.Integration, &q.StartHour, &q.EndHour); err != nil {
+			return nil, err
+		}
+		q.Active = q.includesHour(now)
+		quiet = append(quiet, q)
+	}
+	return quiet, rows.Err()
+}
+
+// inQuietHours reports whether an integration is in its quiet hours at t
+func inQuietHours(integration string, t time.Time) (bool, error) {
+	var q QuietHours
+	err := db.QueryRow(`SELECT start_hour, end_hour FROM quiet_hours WHERE integration = ?`, integration).Scan(&q.StartHour, &q.EndHour)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	return q.includesHour(t), nil
+}
+
+// notificationsOptedOut reports whether a member opted out of notifications
+func notificationsOptedOut(memberID int64) bool {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM notification_opt_outs WHERE member_id = ?`, memberID).Scan(&n); err != nil {
+		// Not naming someone is the safe side
+		log.Printf("Error querying notification opt-out of member %d: %v", memberID, err)
+		return true
+	}
+	return n > 0
+}
+
+// Webhooks a notification can be posted to, stored with its delivery so the
+// URL, a secret, is looked up again when it is retried (see webhooks.go)
+const (
+	webhookOfIntegration = "integration" // The integration's own URL
+	webhookOfOrg         = "org"         // The organization's webhook_url setting
+)
+
+// integrationURL returns the webhook URL of an integration, empty if unset
+func integrationURL(integration string) string {
+	for _, i := range notificationIntegrations {
+		if i.name == integration {
+			return i.url()
+		}
+	}
+	return ""
+}
+
+// webhookURL returns the current URL of an organization's integration webhook
+// (webhookOfIntegration or webhookOfOrg), empty if it is not configured
+func webhookURL(org, integration, webhook string) string {
+	if webhook == webhookOfOrg {
+		return settingsOf(org).WebhookURL
+	}
+	return integrationURL(integration)
+}
+
+// notify posts a message to an integration's webhook unless it is in its quiet hours
+func notify(integration, message string) {
+	notifyWebhook(defaultOrg, integration, webhookOfIntegration, message)
+}
+
+// notifyOrg posts a message of an integration to an organization's webhook
+// (see orgsettings.go), falling back to the integration's for the host
+func notifyOrg(org, integration, message string) {
+	if settingsOf(org).WebhookURL != "" {
+		notifyWebhook(org, integration, webhookOfOrg, message)
+	} else if org == defaultOrg {
+		notify(integration, message)
+	}
+}
+
+// notifyWebhook posts a message of an organization's integration to a webhook
+// (see webhookURL) unless the integration is in its quiet hours
+func notifyWebhook(org, integration, webhook, message string) {
+	url := webhookURL(org, integration, webhook)
+	if url == "" {
+		return
+	}
+
+	quiet, err := inQuietHours(integration, time.Now())
+	if err != nil {
+		log.Printf("Error querying quiet hours of %s: %v", integration, err)
+	}
+	if quiet {
+		incCounter("notifications_suppressed_total")
+		logIntegrations.infof("Quiet hours: suppressed %s notification %q", integration, message)
+		return
+	}
+	deliverWebhook(org, integration, webhook, url, message)
+}
+
+// handleQuietHoursList lists the quiet hours of every integration that has them (GET)
+func handleQuietHoursList(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	quiet, err := loadQuietHours(time.Now())
+	if err != nil {
+		log.Printf("Error querying quiet hours: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quiet)
+}
+
+// handleQuietHours sets (PUT) or removes (DELETE) the quiet hours of an
+// integration, /admin/quiet-hours/{integration}
+func handleQuietHours(w http.ResponseWriter, r *http.Request) {
+	integration := strings.TrimPrefix(r.URL.Path, "/admin/quiet-hours/")
+	if !knownIntegration(integration) {
+		http.Error(w, "Unknown integration, expected alerts, goals, office or after_hours", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPut:
+		var req QuietHours
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if req.StartHour < 0 || req.StartHour > 23 || req.EndHour < 0 || req.EndHour > 23 {
+			http.Error(w, "'start_hour' and 'end_hour' must be between 0 and 23", http.StatusBadRequest)
+			return
+		}
+		if req.StartHour == req.EndHour {
+			http.Error(w, "'start_hour' and 'end_hour' must differ", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := db.Exec(`INSERT INTO quiet_hours (integration, start_hour, end_hour) VALUES (?, ?, ?)
+			ON CONFLICT(integration) DO UPDATE SET start_hour = excluded.start_hour, end_hour = excluded.end_hour`,
+			integration, req.StartHour, req.EndHour); err != nil {
+			log.Printf("Error saving quiet hours: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("notifications.quiet_hours_set", clientIP(r), fmt.Sprintf("%s silent from %d:00 to %d:00", integration, req.StartHour, req.EndHour))
+
+		req.Integration = integration
+		req.Active = req.includesHour(time.Now())
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+
+	case http.MethodDelete:
+		result, err := db.Exec(`DELETE FROM quiet_hours WHERE integration = ?`, integration)
+		if err != nil {
+			log.Printf("Error deleting quiet hours: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Integration has no quiet hours", http.StatusNotFound)
+			return
+		}
+		recordAudit("notifications.quiet_hours_removed", clientIP(r), integration)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Quiet hours deleted successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// writeNotificationPreferences saves the preferences of a PUT and responds
+// with the member's notification preferences
+func writeNotificationPreferences(w http.ResponseWriter, r *http.Request, member Member) {
+	if r.Method == http.MethodPut {
+		var req NotificationPreferences
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if req.OptOut {
+			_, err = db.Exec(`INSERT OR IGNORE INTO notification_opt_outs (member_id, opted_out_at) VALUES (?, ?)`,
+				member.ID, time.Now().Format(time.RFC3339))
+		} else {
+			_, err = db.Exec(`DELETE FROM notification_opt_outs WHERE member_id = ?`, member.ID)
+		}
+		if err != nil {
+			log.Printf("Error saving notification preferences: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		renderedResponses.invalidate()
+		recordAudit("member.notifications_changed", clientIP(r), fmt.Sprintf("Member %s (%d) opt_out=%t", member.Name, member.ID, req.OptOut))
+	}
+
+	prefs := NotificationPreferences{MemberID: member.ID, OptOut: notificationsOptedOut(member.ID)}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(prefs)
+}
+
+// handleMemberNotifications handles GET and PUT /members/{id}/notifications
+func handleMemberNotifications(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	member, found := findMemberByID(id)
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	writeNotificationPreferences(w, r, member)
+}
+
+// handleMeNotifications handles GET and PUT of the calling member's notification preferences
+func handleMeNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+	writeNotificationPreferences(w, r, member)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Quiet Hours Tests
+// ============================================================================
+
+// quietHoursRequest calls /admin/quiet-hours/{integration}
+func quietHoursRequest(method, integration, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/admin/quiet-hours/"+integration, bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleQuietHours(rr, req)
+	return rr
+}
+
+func TestQuietHours_IncludesHour(t *testing.T) {
+	at := func(hour int) time.Time { return time.Date(2025, 1, 15, hour, 30, 0, 0, time.Local) }
+
+	tests := []struct {
+		start, end, hour int
+		expected         bool
+	}{
+		{9, 17, 9, true},
+		{9, 17, 16, true},
+		{9, 17, 17, false},
+		{9, 17, 8, false},
+		{22, 7, 23, true},
+		{22, 7, 2, true},
+		{22, 7, 7, false},
+		{22, 7, 12, false},
+	}
+	for _, tt := range tests {
+		q := QuietHours{StartHour: tt.start, EndHour: tt.end}
+		if got := q.includesHour(at(tt.hour)); got != tt.expected {
+			t.Errorf("%d-%d at %d:30: expected %v, got %v", tt.start, tt.end, tt.hour, tt.expected, got)
+		}
+	}
+}
+
+func TestHandleQuietHours_SetListDelete(t *testing.T) {
+	setupTest()
+
+	rr := quietHoursRequest("PUT", "office", `{"start_hour":22,"end_hour":7}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	// Setting them again replaces them
+	quietHoursRequest("PUT", "office", `{"start_hour":23,"end_hour":8}`)
+
+	req, _ := http.NewRequest("GET", "/admin/quiet-hours", nil)
+	rr = httptest.NewRecorder()
+	handleQuietHoursList(rr, req)
+
+	var quiet []QuietHours
+	json.Unmarshal(rr.Body.Bytes(), &quiet)
+	if len(quiet) != 1 || quiet[0].Integration != "office" || quiet[0].StartHour != 23 || quiet[0].EndHour != 8 {
+		t.Errorf("expected office quiet from 23 to 8, got %+v", quiet)
+	}
+
+	if rr := quietHoursRequest("DELETE", "office", ""); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %v", rr.Code)
+	}
+	if rr := quietHoursRequest("DELETE", "office", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an integration without quiet hours, got %v", rr.Code)
+	}
+
+	entries, _ := loadAuditEntries("notifications.quiet_hours_set", 10)
+	if len(entries) != 2 {
+		t.Errorf("expected 2 quiet_hours_set audit entries, got %d", len(entries))
+	}
+}
+
+func TestHandleQuietHours_Invalid(t *testing.T) {
+	setupTest()
+
+	if rr := quietHoursRequest("PUT", "announcements", `{"start_hour":22,"end_hour":7}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown integration, got %v", rr.Code)
+	}
+	if rr := quietHoursRequest("PUT", "office", `{"start_hour":22,"end_hour":24}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for hour 24, got %v", rr.Code)
+	}
+	if rr := quietHoursRequest("PUT", "office", `{"start_hour":5,"end_hour":5}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty range, got %v", rr.Code)
+	}
+	if rr := quietHoursRequest("GET", "office", ""); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %v", rr.Code)
+	}
+}
+
+func TestNotify_SuppressedInQuietHours(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "OFFICE_WEBHOOK_URL")
+
+	// Quiet for the current hour
+	hour := time.Now().Hour()
+	quietHoursRequest("PUT", "office", fmt.Sprintf(`{"start_hour":%d,"end_hour":%d}`, hour, (hour+1)%24))
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+	performSignOut(context.Background(), cachedMember("TEST_UID_1"))
+
+	if messages := delivered(); len(messages) != 0 {
+		t.Errorf("expected no notification in quiet hours, got %q", messages)
+	}
+	metricsMu.Lock()
+	suppressed := counters["notifications_suppressed_total"]
+	metricsMu.Unlock()
+	if suppressed != 2 {
+		t.Errorf("expected 2 suppressed notifications, got %v", suppressed)
+	}
+
+	// Other integrations are not affected
+	if quiet, _ := inQuietHours(integrationAlerts, time.Now()); quiet {
+		t.Error("expected alerts to have no quiet hours")
+	}
+}
+
+// ============================================================================
+// Notification Opt-Out Tests
+// ============================================================================
+
+func TestHandleMemberNotifications_OptOut(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "OFFICE_WEBHOOK_URL")
+
+	req, _ := http.NewRequest("PUT", "/members/1/notifications", bytes.NewBufferString(`{"opt_out":true}`))
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var prefs NotificationPreferences
+	json.Unmarshal(rr.Body.Bytes(), &prefs)
+	if prefs.MemberID != 1 || !prefs.OptOut {
+		t.Errorf("expected member 1 to be opted out, got %+v", prefs)
+	}
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+	if messages := delivered(); len(messages) != 1 || messages[0] != "The office is open" {
+		t.Errorf("expected the opening without Alice's name, got %q", messages)
+	}
+}
+
+func TestHandleMemberNotifications_UnknownMember(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/members/99/notifications", nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found, got %v", rr.Code)
+	}
+}
+
+func TestHandleMeNotifications(t *testing.T) {
+	setupTest()
+
+	for _, optOut := range []bool{true, false} {
+		req, _ := http.NewRequest("PUT", "/me/notifications", bytes.NewBufferString(fmt.Sprintf(`{"opt_out":%t}`, optOut)))
+		req.Header.Set("X-Discord-ID", "222222222")
+		rr := httptest.NewRecorder()
+		handleMeNotifications(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+		}
+
+		if notificationsOptedOut(2) != optOut {
+			t.Errorf("expected Bob's opt-out to be %v", optOut)
+		}
+	}
+
+	entries, _ := loadAuditEntries("member.notifications_changed", 10)
+	if len(entries) != 2 {
+		t.Errorf("expected 2 audit entries, got %d", len(entries))
+	}
+}
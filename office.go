@@ -0,0 +1,308 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// --- Office Open/Close ---
+//
+// The office is open while anyone is signed in. The sign-in that finds it
+// empty publishes office_opened and the sign-out that empties it publishes
+// office_closed. Both are posted to OFFICE_WEBHOOK_URL (NOTIFY_WEBHOOK_URL if
+// unset, or the host's webhook setting) and to the webhook of every other
+// organization that has one, outside the office integration's quiet hours,
+// and sent to clients of GET /status/stream as server-sent events.
+// With OFFICE_NOTIFY_HIDE_NAME=true the person who opened or closed the
+// office is left out of both; otherwise the stream shows them as the caller's
+// view allows (initials for member keys, nobody for public keys). Members who
+// opted out of notifications or have not consented to being named (see
+// consent.go) are never named.
+//
+// GET /status/today summarizes when the office was open during the current
+// office day, which starts at the nightly cleanup. On closure days (see
+// closures.go) webhooks get no office notifications.
+
+// officeStreamKeepAlive is how often an idle event stream gets a comment line,
+// so proxies do not close it
+var officeStreamKeepAlive = 30 * time.Second
+
+// officeMu serializes this instance's sign-ins and sign-outs with the
+// attendee count that tells whether they closed the office. Sign-ins learn
+// whether they opened it, and are checked against capacity, from the store
+// itself (see attendeeState.signInWithin), which also holds across replicas.
+var officeMu sync.Mutex
+
+// OfficeNotification is an office_opened or office_closed event as streamed
+// by /status/stream
+type OfficeNotification struct {
+	Event   string    `json:"event"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Name    string    `json:"name,omitempty"` // Redacted for the view, omitted if hidden
+}
+
+// OpenInterval is a period during which someone was inside
+type OpenInterval struct {
+	OpenedAt time.Time  `json:"opened_at"`
+	ClosedAt *time.Time `json:"closed_at"` // null while still open
+}
+
+// TodayStatus is the response of /status/today
+type TodayStatus struct {
+	Date        string         `json:"date"` // Office day, starting at the nightly cleanup
+	Open        bool           `json:"open"`
+	Count       int            `json:"count"`
+	OpenedAt    *time.Time     `json:"opened_at"` // First opening of the day, null if it has not opened
+	OpenSeconds int64          `json:"open_seconds"`
+	Intervals   []OpenInterval `json:"intervals"`
+	Closure     *Closure       `json:"closure,omitempty"` // Closure covering the day, if any
+}
+
+// officeHideName reports whether office notifications leave out who opened or closed it
+func officeHideName() bool {
+	return os.Getenv("OFFICE_NOTIFY_HIDE_NAME") == "true"
+}
+
+// officeMessage describes an office event naming the person who caused it,
+// unless name is empty
+func officeMessage(kind eventKind, name string) string {
+	switch {
+	case kind == eventOfficeOpened && name != "":
+		return fmt.Sprintf("The office is open, %s signed in", name)
+	case kind == eventOfficeOpened:
+		return "The office is open"
+	case name != "":
+		return fmt.Sprintf("The office is closed, %s signed out", name)
+	}
+	return "The office is closed"
+}
+
+// publishOfficeOpened publishes office_opened for the member whose sign-in opened the office
+func publishOfficeOpened(ctx context.Context, member Member, t time.Time) {
+	name := member.Name
+	if officeHideName() {
+		name = ""
+	}
+	events.publish(Event{Kind: eventOfficeOpened, Time: t, Member: member, Message: officeMessage(eventOfficeOpened, name),
+		Trace: spanContextFrom(ctx)})
+}
+
+// publishOfficeClosed publishes office_closed for the member whose sign-out
+// closed the office, or for everyone signed out at once by by
+func publishOfficeClosed(ctx context.Context, member Member, by string, t time.Time) {
+	if by != "" {
+		events.publish(Event{Kind: eventOfficeClosed, Time: t,
+			Message: fmt.Sprintf("The office is closed, everyone was signed out by %s", by), Trace: spanContextFrom(ctx)})
+		return
+	}
+
+	name := member.Name
+	if officeHideName() {
+		name = ""
+	}
+	events.publish(Event{Kind: eventOfficeClosed, Time: t, Member: member, Message: officeMessage(eventOfficeClosed, name),
+		Trace: spanContextFrom(ctx)})
+}
+
+// notifyOffice posts an office event to the office webhook of the host and of
+// every organization with a webhook, and to stream clients, leaving out
+// members who may not be named and naming others as they chose (see
+// privacy.go). Each organization only sees the names of its own members.
+func notifyOffice(e Event) {
+	if e.Member.ID != 0 {
+		if name := notificationName(e.Member); name == "" {
+			e.Member = Member{}
+			e.Message = officeMessage(e.Kind, "")
+		} else if !officeHideName() {
+			e.Message = officeMessage(e.Kind, name)
+		}
+	}
+
+	if c, closed := closedOn(e.Time); closed {
+		// Someone dropping by on a holiday is not news
+		incCounter("notifications_suppressed_total")
+		logIntegrations.infof("Closure %q: suppressed office notification %q", c.Name, e.Message)
+	} else {
+		orgs, err := webhookOrgs()
+		if err != nil {
+			log.Printf("Error loading organization webhooks: %v", err)
+		}
+		for _, org := range append([]string{defaultOrg}, orgs...) {
+			message := e.Message
+			if e.Member.ID != 0 && memberOrg(e.Member) != org {
+				message = officeMessage(e.Kind, "")
+			}
+			notifyOrg(org, integrationOffice, message)
+		}
+	}
+
+	if e.Member.ID != 0 && memberOrg(e.Member) != defaultOrg {
+		e.Member = Member{}
+		e.Message = officeMessage(e.Kind, "")
+	}
+	officeStream.broadcast(e)
+}
+
+// officeNotification returns the stream form of an office event for a view
+func officeNotification(e Event, view string) OfficeNotification {
+	n := OfficeNotification{Event: string(e.Kind), Time: e.Time, Message: e.Message}
+	if e.Member.ID == 0 || officeHideName() {
+		return n
+	}
+	if view != scopePublic {
+		n.Name = publicName(e.Member, view)
+	}
+	n.Message = officeMessage(e.Kind, n.Name)
+	return n
+}
+
+// officeStreamClients fans office events out to /status/stream clients
+type officeStreamClients struct {
+	mu      sync.Mutex
+	clients map[chan Event]bool
+}
+
+// officeStream holds the connected /status/stream clients
+var officeStream = &officeStreamClients{clients: make(map[chan Event]bool)}
+
+// add registers a client and returns its channel
+func (s *officeStreamClients) add() chan Event {
+	ch := make(chan Event, 16)
+	s.mu.Lock()
+	s.clients[ch] = true
+	s.mu.Unlock()
+	return ch
+}
+
+// remove unregisters a client
+func (s *officeStreamClients) remove(ch chan Event) {
+	s.mu.Lock()
+	delete(s.clients, ch)
+	s.mu.Unlock()
+}
+
+// broadcast sends an event to every client, skipping clients too slow to keep up
+func (s *officeStreamClients) broadcast(e Event) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for ch := range s.clients {
+		select {
+		case ch <- e:
+		default:
+			logHTTP.warnf("Warning: office stream client is full, dropped %s event", e.Kind)
+		}
+	}
+}
+
+// writeServerSentEvent writes one event to an event stream and flushes it
+func writeServerSentEvent(w http.ResponseWriter, flusher http.Flusher, event string, data any) {
+	payload, _ := json.Marshal(data)
+	fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	flusher.Flush()
+}
+
+// handleStatusStream streams office_opened and office_closed events as
+// server-sent events, starting with a status event holding the current state
+// Query parameters:
+//   - view: public (no names), member (initials) or admin (names), limited by the key's scope
+func handleStatusStream(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	view, ok := resolveView(w, r)
+	if !ok {
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming not supported", http.StatusInternalServerError)
+		return
+	}
+
+	ch := officeStream.add()
+	defer officeStream.remove(ch)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	count := currentAttendees.count()
+	writeServerSentEvent(w, flusher, "status", map[string]any{"open": count > 0, "count": count})
+
+	keepAlive := time.NewTicker(officeStreamKeepAlive)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case e := <-ch:
+			writeServerSentEvent(w, flusher, string(e.Kind), officeNotification(e, view))
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+// todayStatus summarizes the open intervals between the start of the office day and now
+func todayStatus(now time.Time) (TodayStatus, error) {
+	start := lastNightlyCleanup(now)
+	intervals, err := loadPresenceIntervals(start, now, now, sessionTimesCorrected)
+	if err != nil {
+		return TodayStatus{}, err
+	}
+
+	var clipped []presenceInterval
+	for _, p := range intervals {
+		if c, ok := clipInterval(p, start, now); ok {
+			clipped = append(clipped, c)
+		}
+	}
+
+	count := currentAttendees.count()
+	status := TodayStatus{Date: start.Format("2006-01-02"), Open: count > 0, Count: count, Intervals: []OpenInterval{}}
+	for _, p := range mergeIntervals(clipped) {
+		interval := OpenInterval{OpenedAt: p.Start}
+		if !p.Open {
+			closedAt := p.End
+			interval.ClosedAt = &closedAt
+		}
+		status.OpenSeconds += int64(p.End.Sub(p.Start).Seconds())
+		status.Intervals = append(status.Intervals, interval)
+	}
+	if len(status.Intervals) > 0 {
+		status.OpenedAt = &status.Intervals[0].OpenedAt
+	}
+	if c, closed := closedOn(now); closed {
+		status.Closure = &c
+	}
+	return status, nil
+}
+
+// handleStatusToday returns when the office was open today
+func handleStatusToday(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	status, err := todayStatus(time.Now())
+	if err != nil {
+		log.Printf("Error loading today's open intervals: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(status)
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Office Open/Close Notification Tests
+// ============================================================================
+
+// officeWebhook points the webhook variable key at a test server and returns
+// a function listing the messages posted to it once delivered, sorted
+func officeWebhook(t *testing.T, key string) func() []string {
+	t.Helper()
+
+	var mu sync.Mutex
+	var messages []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload map[string]string
+		json.NewDecoder(r.Body).Decode(&payload)
+		mu.Lock()
+		messages = append(messages, payload["content"])
+		mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv(key, server.URL)
+
+	return func() []string {
+		events.wait()
+		jobs.wait()
+		mu.Lock()
+		defer mu.Unlock()
+
+		// Webhooks are delivered concurrently, in any order
+		sorted := append([]string(nil), messages...)
+		sort.Strings(sorted)
+		return sorted
+	}
+}
+
+func TestOfficeNotifications_FirstInLastOut(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "OFFICE_WEBHOOK_URL")
+	alice, bob := cachedMember("TEST_UID_1"), cachedMember("TEST_UID_2")
+
+	performSignIn(context.Background(), alice, "")
+	performSignIn(context.Background(), bob, "")
+	performSignOut(context.Background(), alice)
+	performSignOut(context.Background(), bob)
+
+	messages := delivered()
+	expected := []string{"The office is closed, Bob signed out", "The office is open, Alice signed in"}
+	if strings.Join(messages, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestOfficeNotifications_HideName(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "OFFICE_WEBHOOK_URL")
+	t.Setenv("OFFICE_NOTIFY_HIDE_NAME", "true")
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+	performSignOut(context.Background(), cachedMember("TEST_UID_1"))
+
+	messages := delivered()
+	expected := []string{"The office is closed", "The office is open"}
+	if strings.Join(messages, "|") != strings.Join(expected, "|") {
+		t.Errorf("expected %q, got %q", expected, messages)
+	}
+}
+
+func TestOfficeNotifications_FallsBackToNotifyWebhook(t *testing.T) {
+	setupTest()
+	t.Setenv("OFFICE_WEBHOOK_URL", "")
+	delivered := officeWebhook(t, "NOTIFY_WEBHOOK_URL")
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+
+	if messages := delivered(); len(messages) != 1 {
+		t.Errorf("expected the opening to be posted to NOTIFY_WEBHOOK_URL, got %q", messages)
+	}
+}
+
+func TestOfficeNotifications_SignOutAll(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "OFFICE_WEBHOOK_URL")
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+	performSignIn(context.Background(), cachedMember("TEST_UID_2"), "")
+	signOutAll("the nightly cleanup")
+
+	messages := delivered()
+	if len(messages) != 2 || messages[0] != "The office is closed, everyone was signed out by the nightly cleanup" {
+		t.Errorf("expected one closing by the nightly cleanup, got %q", messages)
+	}
+
+	// Nobody inside: no closing to announce
+	signOutAll("the nightly cleanup")
+	if messages := delivered(); len(messages) != 2 {
+		t.Errorf("expected no notification for an empty office, got %q", messages)
+	}
+}
+
+// ============================================================================
+// /status/stream Endpoint Tests
+// ============================================================================
+
+// readServerSentEvent reads the next event and its data from an event stream
+func readServerSentEvent(t *testing.T, reader *bufio.Reader) (string, string) {
+	t.Helper()
+
+	var event, data string
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("failed to read event stream: %v", err)
+		}
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && event != "":
+			return event, data
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+}
+
+func TestHandleStatusStream_OfficeEvents(t *testing.T) {
+	setupTest()
+
+	server := httptest.NewServer(http.HandlerFunc(handleStatusStream))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, "GET", server.URL+"/status/stream?view=member", nil)
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("failed to open event stream: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if ct := resp.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Errorf("expected text/event-stream, got %q", ct)
+	}
+
+	reader := bufio.NewReader(resp.Body)
+	if event, data := readServerSentEvent(t, reader); event != "status" || data != `{"count":0,"open":false}` {
+		t.Fatalf("expected the closed status first, got %s %s", event, data)
+	}
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+
+	event, data := readServerSentEvent(t, reader)
+	var n OfficeNotification
+	if err := json.Unmarshal([]byte(data), &n); err != nil {
+		t.Fatalf("failed to parse notification: %v", err)
+	}
+	if event != "office_opened" || n.Event != "office_opened" {
+		t.Errorf("expected office_opened, got %s %+v", event, n)
+	}
+	if n.Name != "A." || n.Message != "The office is open, A. signed in" {
+		t.Errorf("expected the member view to show initials, got %+v", n)
+	}
+}
+
+func TestOfficeNotification_Views(t *testing.T) {
+	e := Event{Kind: eventOfficeClosed, Member: Member{ID: 1, Name: "Alice Lee"}, Message: "The office is closed, Alice Lee signed out"}
+
+	if n := officeNotification(e, scopeAdmin); n.Name != "Alice Lee" || n.Message != e.Message {
+		t.Errorf("expected the admin view to show the name, got %+v", n)
+	}
+	if n := officeNotification(e, scopePublic); n.Name != "" || n.Message != "The office is closed" {
+		t.Errorf("expected the public view to hide the name, got %+v", n)
+	}
+
+	t.Setenv("OFFICE_NOTIFY_HIDE_NAME", "true")
+	if n := officeNotification(e, scopeAdmin); n.Name != "" {
+		t.Errorf("expected OFFICE_NOTIFY_HIDE_NAME to hide the name from admins too, got %+v", n)
+	}
+}
+
+func TestHandleStatusStream_InvalidView(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/status/stream?view=nobody", nil)
+	rr := httptest.NewRecorder()
+	handleStatusStream(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+	if body, _ := io.ReadAll(rr.Body); strings.Contains(string(body), "event:") {
+		t.Errorf("expected no events on error, got %s", body)
+	}
+}
+
+// ============================================================================
+// /status/today Endpoint Tests
+// ============================================================================
+
+// statusToday fetches /status/today
+func statusToday(t *testing.T) TodayStatus {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", "/status/today", nil)
+	rr := httptest.NewRecorder()
+	handleStatusToday(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var status TodayStatus
+	if err := json.Unmarshal(rr.Body.Bytes(), &status); err != nil {
+		t.Fatalf("failed to parse status: %v", err)
+	}
+	return status
+}
+
+func TestHandleStatusToday_NotOpened(t *testing.T) {
+	setupTest()
+
+	// Yesterday's visits are not part of today
+	start := lastNightlyCleanup(time.Now())
+	saveVisitToDB(1, start.Add(-3*time.Hour), start.Add(-2*time.Hour))
+
+	status := statusToday(t)
+	if status.Open || status.OpenedAt != nil || status.OpenSeconds != 0 || len(status.Intervals) != 0 {
+		t.Errorf("expected the office not to have opened, got %+v", status)
+	}
+	if status.Date != start.Format("2006-01-02") {
+		t.Errorf("expected date %s, got %s", start.Format("2006-01-02"), status.Date)
+	}
+}
+
+func TestHandleStatusToday_MergesIntervals(t *testing.T) {
+	setupTest()
+
+	// Spread the sessions over the office day so far, whatever the time
+	start := lastNightlyCleanup(time.Now())
+	step := time.Since(start) / 10
+	if step < time.Second {
+		t.Skip("too close to the nightly cleanup to spread sessions")
+	}
+	at := func(n int) time.Time { return start.Add(time.Duration(n) * step).Truncate(time.Second) }
+
+	saveVisitToDB(1, at(1), at(3))
+	saveVisitToDB(2, at(2), at(4)) // Overlaps Alice's visit
+	saveVisitToDB(1, at(6), at(7))
+	currentAttendees.signIn("TEST_UID_2", "", at(8))
+
+	status := statusToday(t)
+	if !status.Open || status.Count != 1 {
+		t.Errorf("expected the office to be open with 1 person, got %+v", status)
+	}
+	if len(status.Intervals) != 3 {
+		t.Fatalf("expected 3 intervals, got %+v", status.Intervals)
+	}
+
+	first := status.Intervals[0]
+	if !first.OpenedAt.Equal(at(1)) || first.ClosedAt == nil || !first.ClosedAt.Equal(at(4)) {
+		t.Errorf("expected the overlapping visits to merge into %v-%v, got %+v", at(1), at(4), first)
+	}
+	if status.OpenedAt == nil || !status.OpenedAt.Equal(at(1)) {
+		t.Errorf("expected the office to have opened at %v, got %v", at(1), status.OpenedAt)
+	}
+	if last := status.Intervals[2]; !last.OpenedAt.Equal(at(8)) || last.ClosedAt != nil {
+		t.Errorf("expected the last interval to be open since %v, got %+v", at(8), last)
+	}
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Office Hours ---
+//
+// OFFICE_HOURS defines when the office is staffed, e.g.
+// "mon-fri 08:00-22:00, sat 10:00-18:00", in the host's report time zone (see
+// reportLocation). Scans outside these hours still work, but lab safety rules
+// require tracking them:
+//   - visits (/visits, /me/sessions) and /current attendees with any time
+//     outside office hours have after_hours set
+//   - signing in outside office hours posts to AFTER_HOURS_WEBHOOK_URL, an
+//     integration with its own quiet hours (see notifications.go)
+//   - /stats/summary reports after_hours_person_hours per period
+//
+// Without OFFICE_HOURS there are no office hours and nothing is after hours.
+
+// minutesPerDay is the length of a day in minutes, also the end of a range to midnight
+const minutesPerDay = 24 * 60
+
+// minuteRange is a range of minutes of the day [Start, End)
+type minuteRange struct {
+	Start int
+	End   int
+}
+
+// officeHoursPolicy holds the office hours of each weekday, Sunday first
+type officeHoursPolicy struct {
+	Days [7][]minuteRange
+}
+
+// officeHours is the office hours policy (loaded at startup)
+var officeHours officeHoursPolicy
+
+// weekdayNames maps the day names of OFFICE_HOURS to weekdays
+var weekdayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// parseClockMinutes parses an HH:MM time of day, 24:00 being the end of the day
+func parseClockMinutes(value string) (int, error) {
+	hours, minutes, ok := strings.Cut(value, ":")
+	h, errH := strconv.Atoi(hours)
+	m, errM := strconv.Atoi(minutes)
+	if !ok || errH != nil || errM != nil || h < 0 || m < 0 || m > 59 || h*60+m > minutesPerDay {
+		return 0, fmt.Errorf("invalid time %q, expected HH:MM", value)
+	}
+	return h*60 + m, nil
+}
+
+// parseOfficeHours parses an OFFICE_HOURS value: comma-separated rules of a
+// day or range of days and a range of times
+func parseOfficeHours(value string) (officeHoursPolicy, error) {
+	var policy officeHoursPolicy
+	for _, rule := range strings.Split(value, ",") {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+		days, times, ok := strings.Cut(rule, " ")
+		if !ok {
+			return officeHoursPolicy{}, fmt.Errorf("invalid rule %q, expected days and times such as mon-fri 08:00-22:00", rule)
+		}
+
+		firstName, lastName, isRange := strings.Cut(days, "-")
+		if !isRange {
+			lastName = firstName
+		}
+		first, okFirst := weekdayNames[firstName]
+		last, okLast := weekdayNames[lastName]
+		if !okFirst || !okLast {
+			return officeHoursPolicy{}, fmt.Errorf("invalid days %q in rule %q, expected mon to sun", days, rule)
+		}
+
+		startValue, endValue, ok := strings.Cut(strings.TrimSpace(times), "-")
+		if !ok {
+			return officeHoursPolicy{}, fmt.Errorf("invalid times %q in rule %q, expected HH:MM-HH:MM", times, rule)
+		}
+		start, err := parseClockMinutes(startValue)
+		if err != nil {
+			return officeHoursPolicy{}, err
+		}
+		end, err := parseClockMinutes(endValue)
+		if err != nil {
+			return officeHoursPolicy{}, err
+		}
+		if end <= start {
+			return officeHoursPolicy{}, fmt.Errorf("times %q in rule %q must end after they start", times, rule)
+		}
+
+		// Ranges of days may wrap the week (sat-sun, fri-mon)
+		for d := first; ; d = (d + 1) % 7 {
+			for _, r := range policy.Days[d] {
+				if start < r.End && r.Start < end {
+					return officeHoursPolicy{}, fmt.Errorf("rule %q overlaps another rule on %s", rule, d)
+				}
+			}
+			policy.Days[d] = append(policy.Days[d], minuteRange{start, end})
+			if d == last {
+				break
+			}
+		}
+	}
+	return policy, nil
+}
+
+// loadOfficeHours loads the office hours policy from the environment
+func loadOfficeHours() (officeHoursPolicy, error) {
+	return parseOfficeHours(os.Getenv("OFFICE_HOURS"))
+}
+
+// enabled reports whether office hours are configured
+func (p officeHoursPolicy) enabled() bool {
+	for _, ranges := range p.Days {
+		if len(ranges) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// outside returns how much of [start, end) falls outside office hours, with
+// office hours in loc. It is zero when no office hours are configured.
+func (p officeHoursPolicy) outside(start, end time.Time, loc *time.Location) time.Duration {
+	if !p.enabled() || !end.After(start) {
+		return 0
+	}
+	start, end = start.In(loc), end.In(loc)
+
+	outside := end.Sub(start)
+	for day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, loc); day.Before(end); day = day.AddDate(0, 0, 1) {
+		for _, r := range p.Days[day.Weekday()] {
+			// Wall-clock times, so days with a DST change keep their hours (24:00 is the next midnight)
+			open := time.Date(day.Year(), day.Month(), day.Day(), r.Start/60, r.Start%60, 0, 0, loc)
+			closes := time.Date(day.Year(), day.Month(), day.Day(), r.End/60, r.End%60, 0, 0, loc)
+
+			overlapStart, overlapEnd := maxTime(start, open), minTime(end, closes)
+			if overlapEnd.After(overlapStart) {
+				outside -= overlapEnd.Sub(overlapStart)
+			}
+		}
+	}
+	return max(outside, 0)
+}
+
+// afterHours reports whether any of [start, end) is outside office hours
+func (p officeHoursPolicy) afterHours(start, end time.Time, loc *time.Location) bool {
+	return p.outside(start, end, loc) > 0
+}
+
+// maxTime returns the later of two times
+func maxTime(a, b time.Time) time.Time {
+	if a.After(b) {
+		return a
+	}
+	return b
+}
+
+// minTime returns the earlier of two times
+func minTime(a, b time.Time) time.Time {
+	if a.Before(b) {
+		return a
+	}
+	return b
+}
+
+// notifyAfterHoursSignIn posts a sign-in outside office hours to the
+// after-hours integration, naming the member unless they may not be named
+func notifyAfterHoursSignIn(e Event) {
+	loc := reportLocation(defaultOrg)
+	if !officeHours.afterHours(e.Time, e.Time.Add(time.Second), loc) {
+		return
+	}
+
+	name := e.Member.Name
+	if e.Member.ID != 0 {
+		if name = notificationName(e.Member); name == "" {
+			name = "Someone"
+		}
+	}
+	notify(integrationAfterHours, fmt.Sprintf("After-hours sign-in: %s signed in at %s", name, e.Time.In(loc).Format("Mon 15:04")))
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Office Hours Tests
+// ============================================================================
+
+// useOfficeHours sets the office hours policy for a test
+func useOfficeHours(t *testing.T, value string) {
+	t.Helper()
+
+	saved := officeHours
+	policy, err := parseOfficeHours(value)
+	if err != nil {
+		t.Fatalf("invalid office hours %q: %v", value, err)
+	}
+	officeHours = policy
+	t.Cleanup(func() { officeHours = saved })
+}
+
+// closedAllToday returns office hours that exclude every time of today
+func closedAllToday() string {
+	tomorrow := time.Now().AddDate(0, 0, 1).Weekday().String()[:3]
+	return strings.ToLower(tomorrow) + " 08:00-22:00"
+}
+
+func TestParseOfficeHours(t *testing.T) {
+	policy, err := parseOfficeHours("mon-fri 08:00-22:00, Sat 10:00-18:00, sat 20:00-24:00")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if got := policy.Days[time.Wednesday]; len(got) != 1 || got[0] != (minuteRange{8 * 60, 22 * 60}) {
+		t.Errorf("unexpected Wednesday hours: %+v", got)
+	}
+	if got := policy.Days[time.Saturday]; len(got) != 2 || got[1].End != minutesPerDay {
+		t.Errorf("unexpected Saturday hours: %+v", got)
+	}
+	if len(policy.Days[time.Sunday]) != 0 {
+		t.Errorf("expected no Sunday hours, got %+v", policy.Days[time.Sunday])
+	}
+
+	// Ranges of days wrap the week
+	policy, _ = parseOfficeHours("fri-mon 10:00-16:00")
+	for _, d := range []time.Weekday{time.Friday, time.Saturday, time.Sunday, time.Monday} {
+		if len(policy.Days[d]) != 1 {
+			t.Errorf("expected hours on %s, got %+v", d, policy.Days[d])
+		}
+	}
+	if len(policy.Days[time.Wednesday]) != 0 {
+		t.Errorf("expected no Wednesday hours, got %+v", policy.Days[time.Wednesday])
+	}
+
+	if policy, err := parseOfficeHours(""); err != nil || policy.enabled() {
+		t.Errorf("expected no office hours when unset, got %+v (%v)", policy, err)
+	}
+}
+
+func TestParseOfficeHours_Invalid(t *testing.T) {
+	invalid := []string{
+		"mon-fri",
+		"weekdays 08:00-22:00",
+		"mon 8am-10pm",
+		"mon 22:00-08:00",
+		"mon 08:00-24:30",
+		"mon-fri 08:00-22:00, wed 21:00-23:00",
+	}
+	for _, value := range invalid {
+		if _, err := parseOfficeHours(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestOfficeHoursOutside(t *testing.T) {
+	policy, _ := parseOfficeHours("mon-fri 08:00-22:00")
+	// A Friday evening into Saturday morning
+	friday := time.Date(2025, 1, 17, 0, 0, 0, 0, time.Local)
+
+	cases := []struct {
+		start, end time.Duration
+		want       time.Duration
+	}{
+		{9 * time.Hour, 17 * time.Hour, 0},
+		{7 * time.Hour, 9 * time.Hour, time.Hour},
+		{21 * time.Hour, 26 * time.Hour, 4 * time.Hour},
+		{-3 * time.Hour, 9 * time.Hour, 10 * time.Hour},
+	}
+	for _, c := range cases {
+		got := policy.outside(friday.Add(c.start), friday.Add(c.end), time.Local)
+		if got != c.want {
+			t.Errorf("%v to %v: expected %v outside, got %v", c.start, c.end, c.want, got)
+		}
+	}
+
+	if (officeHoursPolicy{}).afterHours(friday, friday.Add(24*time.Hour), time.Local) {
+		t.Error("expected nothing after hours without office hours")
+	}
+}
+
+func TestHandleVisits_AfterHours(t *testing.T) {
+	setupTest()
+	useOfficeHours(t, "mon-fri 08:00-22:00")
+
+	friday := time.Date(2025, 1, 17, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, friday.Add(10*time.Hour), friday.Add(12*time.Hour))
+	saveVisitToDB(1, friday.Add(21*time.Hour), friday.Add(23*time.Hour))
+
+	req, _ := http.NewRequest("GET", "/visits", nil)
+	rr := httptest.NewRecorder()
+	handleVisits(rr, req)
+
+	var visits []Visit
+	if err := json.Unmarshal(rr.Body.Bytes(), &visits); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	// Newest first
+	if len(visits) != 2 || !visits[0].AfterHours || visits[1].AfterHours {
+		t.Errorf("expected only the late visit after hours, got %+v", visits)
+	}
+}
+
+func TestAfterHoursSignIn_Notifies(t *testing.T) {
+	setupTest()
+	delivered := officeWebhook(t, "AFTER_HOURS_WEBHOOK_URL")
+	alice := cachedMember("TEST_UID_1")
+
+	useOfficeHours(t, "sun-sat 00:00-24:00")
+	performSignIn(context.Background(), alice, "")
+	performSignOut(context.Background(), alice)
+	if messages := delivered(); len(messages) != 0 {
+		t.Fatalf("expected no notification during office hours, got %q", messages)
+	}
+
+	useOfficeHours(t, closedAllToday())
+	performSignIn(context.Background(), alice, "")
+	messages := delivered()
+	if len(messages) != 1 || !strings.HasPrefix(messages[0], "After-hours sign-in: "+alice.Name) {
+		t.Errorf("expected an after-hours notification, got %q", messages)
+	}
+
+	req, _ := http.NewRequest("GET", "/current", nil)
+	rr := httptest.NewRecorder()
+	handleCurrent(rr, req)
+	if !strings.Contains(rr.Body.String(), `"after_hours":true`) {
+		t.Errorf("expected the attendee flagged after hours, got %s", rr.Body.String())
+	}
+}
+
+func TestHandleStatsSummary_AfterHours(t *testing.T) {
+	setupTest()
+	useOfficeHours(t, "mon-fri 08:00-22:00")
+
+	friday := time.Date(2025, 1, 17, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, friday.Add(7*time.Hour), friday.Add(9*time.Hour))
+	saveVisitToDB(2, friday.Add(21*time.Hour+30*time.Minute), friday.Add(24*time.Hour))
+
+	resp := statsSummary(t, "")
+	if len(resp.Periods) != 1 {
+		t.Fatalf("expected 1 period, got %+v", resp.Periods)
+	}
+	if got := resp.Periods[0].AfterHoursPersonHours; got != 3 {
+		t.Errorf("expected 3 after-hours person-hours, got %v", got)
+	}
+}
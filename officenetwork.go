@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+// --- Office Network Evidence ---
+//
+// Remote sign-ins (/sign-in-discord) may carry evidence of where the member
+// is: the IP address and the Wi-Fi access point (BSSID and SSID) of their
+// device, as reported by the client. Evidence is verified when the IP is in
+// OFFICE_NETWORKS or the BSSID is in OFFICE_BSSIDS; the SSID is only logged,
+// as any access point can use it. With REMOTE_SIGNIN_REQUIRE_OFFICE_NETWORK
+// set to true, remote sign-ins without verified evidence are refused.
+
+// NetworkEvidence is the network a member's device reports being on
+type NetworkEvidence struct {
+	IP    string `json:"ip,omitempty"`
+	BSSID string `json:"bssid,omitempty"`
+	SSID  string `json:"ssid,omitempty"`
+}
+
+// officeNetworkPolicy describes the office network and whether remote sign-ins must come from it
+type officeNetworkPolicy struct {
+	Networks []*net.IPNet
+	BSSIDs   map[string]bool
+	Required bool
+}
+
+// officeNetwork is the office network policy (loaded at startup)
+var officeNetwork officeNetworkPolicy
+
+// normalizeBSSID returns a BSSID in lower-case colon notation
+func normalizeBSSID(value string) (string, error) {
+	mac, err := net.ParseMAC(strings.TrimSpace(value))
+	if err != nil || len(mac) != 6 {
+		return "", fmt.Errorf("invalid BSSID %q", value)
+	}
+	return mac.String(), nil
+}
+
+// parseOfficeNetworkPolicy parses the OFFICE_NETWORKS, OFFICE_BSSIDS and
+// REMOTE_SIGNIN_REQUIRE_OFFICE_NETWORK values
+func parseOfficeNetworkPolicy(networks, bssids, required string) (officeNetworkPolicy, error) {
+	policy := officeNetworkPolicy{BSSIDs: make(map[string]bool)}
+	for _, cidr := range strings.Split(networks, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		network, err := parseNetwork(cidr)
+		if err != nil {
+			return officeNetworkPolicy{}, fmt.Errorf("invalid office network %q: %w", cidr, err)
+		}
+		policy.Networks = append(policy.Networks, network)
+	}
+	for _, value := range strings.Split(bssids, ",") {
+		if strings.TrimSpace(value) == "" {
+			continue
+		}
+		bssid, err := normalizeBSSID(value)
+		if err != nil {
+			return officeNetworkPolicy{}, err
+		}
+		policy.BSSIDs[bssid] = true
+	}
+
+	switch required {
+	case "", "false":
+	case "true":
+		if len(policy.Networks) == 0 && len(policy.BSSIDs) == 0 {
+			return officeNetworkPolicy{}, fmt.Errorf("REMOTE_SIGNIN_REQUIRE_OFFICE_NETWORK needs OFFICE_NETWORKS or OFFICE_BSSIDS")
+		}
+		policy.Required = true
+	default:
+		return officeNetworkPolicy{}, fmt.Errorf("invalid REMOTE_SIGNIN_REQUIRE_OFFICE_NETWORK %q, expected true or false", required)
+	}
+	return policy, nil
+}
+
+// loadOfficeNetworkPolicy loads the office network policy from the environment
+func loadOfficeNetworkPolicy() (officeNetworkPolicy, error) {
+	return parseOfficeNetworkPolicy(os.Getenv("OFFICE_NETWORKS"), os.Getenv("OFFICE_BSSIDS"),
+		os.Getenv("REMOTE_SIGNIN_REQUIRE_OFFICE_NETWORK"))
+}
+
+// verify reports whether the evidence places the device on the office
+// network, failing for malformed evidence
+func (p officeNetworkPolicy) verify(e *NetworkEvidence) (bool, error) {
+	if e == nil {
+		return false, nil
+	}
+
+	verified := false
+	if e.IP != "" {
+		ip := net.ParseIP(strings.TrimSpace(e.IP))
+		if ip == nil {
+			return false, fmt.Errorf("invalid IP address %q", e.IP)
+		}
+		for _, n := range p.Networks {
+			if n.Contains(ip) {
+				verified = true
+			}
+		}
+	}
+	if e.BSSID != "" {
+		bssid, err := normalizeBSSID(e.BSSID)
+		if err != nil {
+			return false, err
+		}
+		if p.BSSIDs[bssid] {
+			verified = true
+		}
+	}
+	return verified, nil
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// Office Network Policy Tests
+// ============================================================================
+
+func TestParseOfficeNetworkPolicy(t *testing.T) {
+	policy, err := parseOfficeNetworkPolicy("192.168.10.0/24, 203.0.113.7", "AA-BB-CC-DD-EE-FF", "true")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(policy.Networks) != 2 || !policy.BSSIDs["aa:bb:cc:dd:ee:ff"] || !policy.Required {
+		t.Errorf("unexpected policy: %+v", policy)
+	}
+
+	invalid := []struct{ networks, bssids, required string }{
+		{"192.168.10.0/33", "", ""},
+		{"", "not-a-bssid", ""},
+		{"192.168.10.0/24", "", "yes"},
+		{"", "", "true"}, // Required without an office network
+	}
+	for _, tt := range invalid {
+		if _, err := parseOfficeNetworkPolicy(tt.networks, tt.bssids, tt.required); err == nil {
+			t.Errorf("expected an error for %+v", tt)
+		}
+	}
+}
+
+func TestOfficeNetworkPolicy_Verify(t *testing.T) {
+	policy, _ := parseOfficeNetworkPolicy("192.168.10.0/24", "aa:bb:cc:dd:ee:ff", "")
+
+	tests := []struct {
+		evidence *NetworkEvidence
+		expected bool
+	}{
+		{nil, false},
+		{&NetworkEvidence{IP: "192.168.10.42"}, true},
+		{&NetworkEvidence{IP: "10.0.0.5"}, false},
+		{&NetworkEvidence{BSSID: "AA:BB:CC:DD:EE:FF"}, true},
+		{&NetworkEvidence{IP: "10.0.0.5", BSSID: "aa:bb:cc:dd:ee:ff"}, true},
+		{&NetworkEvidence{SSID: "IEEE-Office"}, false}, // The SSID alone proves nothing
+	}
+	for _, tt := range tests {
+		if got, err := policy.verify(tt.evidence); err != nil || got != tt.expected {
+			t.Errorf("%+v: expected %v, got %v (err %v)", tt.evidence, tt.expected, got, err)
+		}
+	}
+
+	if _, err := policy.verify(&NetworkEvidence{IP: "nope"}); err == nil {
+		t.Error("expected an error for a malformed IP")
+	}
+}
+
+// ============================================================================
+// Remote Sign-In Network Requirement Tests
+// ============================================================================
+
+// requireOfficeNetwork requires remote sign-ins to come from 192.168.10.0/24 for a test
+func requireOfficeNetwork(t *testing.T) {
+	t.Helper()
+
+	saved := officeNetwork
+	officeNetwork, _ = parseOfficeNetworkPolicy("192.168.10.0/24", "", "true")
+	t.Cleanup(func() { officeNetwork = saved })
+}
+
+// signInWithEvidence calls /sign-in-discord with a raw JSON body
+func signInWithEvidence(body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/sign-in-discord", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleSignInWithDiscordID(rr, req)
+	return rr
+}
+
+func TestSignInDiscord_RequiresOfficeNetwork(t *testing.T) {
+	setupTest()
+	requireOfficeNetwork(t)
+
+	if rr := signInWithEvidence(`{"discord_id":"111111111"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 without evidence, got %v", rr.Code)
+	}
+	if rr := signInWithEvidence(`{"discord_id":"111111111","network":{"ip":"10.0.0.5","ssid":"IEEE-Office"}}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 from another network, got %v", rr.Code)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
+		t.Fatal("expected Alice not to be signed in")
+	}
+
+	if rr := signInWithEvidence(`{"discord_id":"111111111","network":{"ip":"192.168.10.42"}}`); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK from the office network, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
+		t.Error("expected Alice to be signed in")
+	}
+
+	entries, _ := loadAuditEntries("remote_signin.refused", 10)
+	if len(entries) != 2 {
+		t.Errorf("expected 2 refused audit entries, got %d", len(entries))
+	}
+}
+
+func TestSignInDiscord_NetworkEvidenceOptional(t *testing.T) {
+	setupTest()
+
+	// Evidence is accepted but not enforced without the requirement
+	if rr := signInWithEvidence(`{"discord_id":"111111111","network":{"ip":"10.0.0.5"}}`); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %v", rr.Code)
+	}
+	if rr := signInWithEvidence(`{"discord_id":"222222222","network":{"bssid":"zz"}}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for malformed evidence, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,259 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// --- Undoing Bulk Operations ---
+//
+// A sign-out-all made by mistake closes everyone's session at once. It is
+// recorded as a bulk operation, with the visit saved for each member and the
+// room they were in, and /sign-out-all returns its operation_id. For
+// undoWindow afterwards, POST /admin/operations/{id}/undo signs those members
+// back in as of their original sign-in times and deletes the visits the
+// sign-out saved, as if it never happened. Members who signed in again since
+// are left as they are, keeping the visit. Operations can only be undone
+// once, and are deleted once they can no longer be undone.
+
+const (
+	undoWindow = 10 * time.Minute
+
+	operationSignOutAll = "sign_out_all"
+)
+
+// BulkOperation is a bulk operation that can be undone for a while
+type BulkOperation struct {
+	ID            int64      `json:"id"`
+	Kind          string     `json:"kind"`
+	Count         int        `json:"count"` // Visits it saved
+	CreatedAt     time.Time  `json:"created_at"`
+	UndoableUntil time.Time  `json:"undoable_until"`
+	UndoneAt      *time.Time `json:"undone_at,omitempty"`
+}
+
+// loadBulkOperation fetches a bulk operation by ID
+func loadBulkOperation(id int64) (BulkOperation, error) {
+	var op BulkOperation
+	var createdAt string
+	var undoneAt sql.NullString
+	err := db.QueryRow(`SELECT o.id, o.kind, o.created_at, o.undone_at, (SELECT COUNT(*) FROM bulk_operation_visits WHERE operation_id = o.id)
+		FROM bulk_operations o WHERE o.id = ?`, id).Scan(&op.ID, &op.Kind, &createdAt, &undoneAt, &op.Count)
+	if err != nil {
+		return BulkOperation{}, err
+	}
+
+	if op.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return BulkOperation{}, err
+	}
+	op.UndoableUntil = op.CreatedAt.Add(undoWindow)
+	if undoneAt.Valid {
+		t, err := time.Parse(time.RFC3339, undoneAt.String)
+		if err != nil {
+			return BulkOperation{}, err
+		}
+		op.UndoneAt = &t
+	}
+	return op, nil
+}
+
+// recordBulkOperation records the visits a bulk sign-out saved so it can be
+// undone, first deleting the operations that can no longer be
+func recordBulkOperation(kind string, visits []signedOutVisit, now time.Time) (BulkOperation, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return BulkOperation{}, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM bulk_operations WHERE created_at < ?`, now.Add(-undoWindow).UTC().Format(time.RFC3339)); err != nil {
+		return BulkOperation{}, err
+	}
+	res, err := tx.Exec(`INSERT INTO bulk_operations (kind, created_at) VALUES (?, ?)`, kind, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return BulkOperation{}, err
+	}
+	id, _ := res.LastInsertId()
+	for _, v := range visits {
+		if _, err := tx.Exec(`INSERT INTO bulk_operation_visits (operation_id, visit_id, member_id, room, signin_time) VALUES (?, ?, ?, ?, ?)`,
+			id, v.VisitID, v.MemberID, v.Room, v.SignInTime.Format(time.RFC3339Nano)); err != nil {
+			return BulkOperation{}, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return BulkOperation{}, err
+	}
+	return loadBulkOperation(id)
+}
+
+// loadBulkOperationVisits returns the visits saved by a bulk operation
+func loadBulkOperationVisits(id int64) ([]signedOutVisit, error) {
+	rows, err := db.Query(`SELECT visit_id, member_id, room, signin_time FROM bulk_operation_visits WHERE operation_id = ? ORDER BY signin_time`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var visits []signedOutVisit
+	for rows.Next() {
+		var v signedOutVisit
+		var signinTime string
+		if err := rows.Scan(&v.VisitID, &v.MemberID, &v.Room, &signinTime); err != nil {
+			return nil, err
+		}
+		if v.SignInTime, err = time.Parse(time.RFC3339Nano, signinTime); err != nil {
+			return nil, err
+		}
+		visits = append(visits, v)
+	}
+	return visits, rows.Err()
+}
+
+// deleteVisit deletes a visit, recording it in the session ledger
+func deleteVisit(id int64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := appendVisitDeletions(tx, "id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM visits WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// undoSignOutAll signs the members of a sign-out-all back in and deletes the
+// visits it saved, returning how many were restored and the names of those
+// left as they are
+func undoSignOutAll(ctx context.Context, visits []signedOutVisit) (int, []string) {
+	restored := 0
+	skipped := []string{}
+	for _, v := range visits {
+		member, found := findMemberByID(v.MemberID)
+		if !found {
+			continue
+		}
+
+		officeMu.Lock()
+		result, wasEmpty, err := currentAttendees.signInWithin(member.UID, v.Room, v.SignInTime, memberOrg(member), 0)
+		officeMu.Unlock()
+		signedIn := result == signInAccepted
+		opened := signedIn && wasEmpty
+		if err != nil {
+			logStore.errorf("Undo: failed to sign %s back in: %v", member.Name, err)
+			skipped = append(skipped, member.Name)
+			continue
+		}
+		if !signedIn {
+			// Signed in again since; the visit saved for them stands
+			skipped = append(skipped, member.Name)
+			continue
+		}
+
+		if err := deleteVisit(v.VisitID); err != nil {
+			logStore.errorf("Undo: failed to delete visit %d of %s: %v", v.VisitID, member.Name, err)
+		}
+		restored++
+		events.publish(Event{Kind: eventSignIn, Time: v.SignInTime, Member: member, Room: v.Room,
+			Message: fmt.Sprintf("%s was signed back in, undoing the sign-out-all", member.Name), Trace: spanContextFrom(ctx)})
+		if opened {
+			publishOfficeOpened(ctx, member, time.Now())
+		}
+	}
+
+	if restored > 0 {
+		saveCurrentAttendeesInBackground()
+	}
+	return restored, skipped
+}
+
+// handleBulkOperation handles GET /admin/operations/{id} and POST /admin/operations/{id}/undo
+func handleBulkOperation(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := parseIDPath(r.URL.Path, "/admin/operations/")
+	if !ok {
+		http.Error(w, "Invalid operation ID", http.StatusBadRequest)
+		return
+	}
+	switch action {
+	case "":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+	case "undo":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	op, err := loadBulkOperation(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Operation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying operation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if action == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(op)
+		return
+	}
+
+	now := time.Now()
+	if op.UndoneAt != nil {
+		http.Error(w, "Operation already undone", http.StatusConflict)
+		return
+	}
+	if now.After(op.UndoableUntil) {
+		http.Error(w, fmt.Sprintf("Operation can only be undone for %s", undoWindow), http.StatusGone)
+		return
+	}
+
+	// Whoever marks it first undoes it, should two admins click at once
+	res, err := db.Exec(`UPDATE bulk_operations SET undone_at = ? WHERE id = ? AND undone_at IS NULL`, now.UTC().Format(time.RFC3339), op.ID)
+	if err != nil {
+		log.Printf("Error marking operation undone: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		http.Error(w, "Operation already undone", http.StatusConflict)
+		return
+	}
+
+	visits, err := loadBulkOperationVisits(op.ID)
+	if err != nil {
+		log.Printf("Error querying operation visits: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	restored, skipped := undoSignOutAll(r.Context(), visits)
+
+	msg := fmt.Sprintf("Undid %s %d: signed %d attendees back in", op.Kind, op.ID, restored)
+	if len(skipped) > 0 {
+		msg += fmt.Sprintf(", %d had signed in again", len(skipped))
+	}
+	logHTTP.infof("%s", msg)
+	recordAudit("operation.undone", clientIP(r), fmt.Sprintf("op=%d kind=%s restored=%d skipped=%d", op.ID, op.Kind, restored, len(skipped)))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message":  msg,
+		"restored": restored,
+		"skipped":  skipped,
+	})
+}
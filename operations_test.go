@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Bulk Operation Undo Tests
+// ============================================================================
+
+// signOutAllForUndo calls /sign-out-all and returns the operation ID
+func signOutAllForUndo(t *testing.T) int64 {
+	t.Helper()
+	req, _ := http.NewRequest("POST", "/sign-out-all", nil)
+	rr := httptest.NewRecorder()
+	handleSignoutAll(rr, req)
+	var resp struct {
+		OperationID int64 `json:"operation_id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if rr.Code != http.StatusOK || resp.OperationID == 0 {
+		t.Fatalf("expected an operation ID, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	return resp.OperationID
+}
+
+// undoOperation calls POST /admin/operations/{id}/undo
+func undoOperation(id int64) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/operations/%d/undo", id), nil)
+	rr := httptest.NewRecorder()
+	handleBulkOperation(rr, req)
+	return rr
+}
+
+func TestUndoSignOutAll(t *testing.T) {
+	setupTest()
+
+	aliceSince := time.Now().Add(-2 * time.Hour).Truncate(time.Second)
+	currentAttendees.signIn("TEST_UID_1", "lab", aliceSince)
+	currentAttendees.signIn("TEST_UID_2", "", time.Now().Add(-time.Hour))
+	id := signOutAllForUndo(t)
+
+	var visits int
+	db.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visits)
+	if visits != 2 || currentAttendees.count() != 0 {
+		t.Fatalf("expected 2 visits and nobody inside, got %d visits and %d inside", visits, currentAttendees.count())
+	}
+
+	// Bob came back in meanwhile; his visit stands
+	scanCard("TEST_UID_2")
+
+	rr := undoOperation(id)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Restored int      `json:"restored"`
+		Skipped  []string `json:"skipped"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Restored != 1 || len(resp.Skipped) != 1 || resp.Skipped[0] != "Bob" {
+		t.Errorf("expected Alice restored and Bob skipped, got %s", rr.Body.String())
+	}
+
+	since, inside, _ := currentAttendees.get("TEST_UID_1")
+	room, _ := currentAttendees.room("TEST_UID_1")
+	if !inside || !since.Equal(aliceSince) || room != "lab" {
+		t.Errorf("expected Alice back in the lab since %s, got %v %s %q", aliceSince, inside, since, room)
+	}
+	var aliceVisits int
+	db.QueryRow(`SELECT COUNT(*) FROM visits WHERE member_id = 1`).Scan(&aliceVisits)
+	if aliceVisits != 0 {
+		t.Errorf("expected Alice's generated session removed, got %d", aliceVisits)
+	}
+
+	if rr := undoOperation(id); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 undoing twice, got %v", rr.Code)
+	}
+	if entries, _ := loadAuditEntries("operation.undone", 10); len(entries) != 1 {
+		t.Errorf("expected the undo audited, got %+v", entries)
+	}
+}
+
+func TestUndoSignOutAll_WindowClosed(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-time.Hour))
+	saved := saveSignedOut(currentAttendees.clear(), "sign-out-all")
+	op, err := recordBulkOperation(operationSignOutAll, saved, time.Now().Add(-undoWindow-time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op.Count != 1 {
+		t.Errorf("expected 1 visit recorded, got %+v", op)
+	}
+
+	if rr := undoOperation(op.ID); rr.Code != http.StatusGone {
+		t.Errorf("expected 410 after the undo window, got %v", rr.Code)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
+		t.Error("expected Alice to stay signed out")
+	}
+	if rr := undoOperation(999); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown operation, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+)
+
+// --- Organizations ---
+//
+// One deployment can host several branches or clubs (e.g. IEEE and ESS).
+// Members and devices belong to an organization (org_id); visits, rooms and
+// open sessions follow their member. Keys listed in API_KEYS may name their
+// organization with an @org suffix, e.g. API_KEYS=ess-bot@ess,ess-tv:public@ess.
+// Every other key (SCANNER_API_KEY, DISCORD_BOT_API_KEY, keys without a
+// suffix, kiosk tokens) belongs to the host organization, defaultOrg.
+//
+// A key only sees the members, devices, visits and attendance of its own
+// organization; a card or Discord account of another organization is unknown
+// to it. Card UIDs stay unique across organizations, since open sessions are
+// kept by UID in the shared office state; a card taken by another organization
+// is refused like any taken card (see writeUIDConflict). Keys of other
+// organizations may only call the endpoints in orgRoutes, and their own
+// /orgs/{id}/settings (see orgsettings.go). The remaining endpoints (terms,
+// goals, reports, admin tools...) serve host keys only.
+
+// defaultOrg is the host organization, owning everything created before organizations existed
+const defaultOrg = "default"
+
+var (
+	// Organization per API key; keys without an entry belong to defaultOrg
+	apiKeyOrgs map[string]string
+
+	// Endpoints keys of other organizations may call; they only see their own organization
+	orgRoutes = map[string]bool{
+		"/scan":             true,
+		"/current":          true,
+		"/count":            true,
+		"/visits":           true,
+		"/members":          true,
+		"/devices":          true,
+		"/sign-in-discord":  true,
+		"/sign-out-discord": true,
+		"/me":               true,
+		"/me/sessions":      true,
+		"/me/stats":         true,
+		"/me/sign-out":      true,
+		"/attendance/at":    true,
+		"/stats/overlap":    true,
+		"/stats/summary":    true,
+		"/stats/mentorship": true,
+		"/stats/heatmap":    true,
+		"/stats/live":       true,
+	}
+
+	// Resources by ID keys of other organizations may use, e.g. /members/12/stats
+	orgIDRoutes = []string{"/members/", "/devices/"}
+
+	// orgIDPattern is the form of organization IDs
+	orgIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{0,31}$`)
+)
+
+// orgContextKey is the request context key holding the caller's organization
+type orgContextKey struct{}
+
+// splitAPIKeyOrg splits an API_KEYS entry of the form key[:scope][@org] into
+// the entry without the organization and the organization ("" if none)
+func splitAPIKeyOrg(entry string) (string, string) {
+	i := strings.LastIndex(entry, "@")
+	if i < 0 {
+		return entry, ""
+	}
+	return entry[:i], strings.ToLower(strings.TrimSpace(entry[i+1:]))
+}
+
+// loadAPIKeyOrgs returns the organization of every key listed in API_KEYS
+// with an @org suffix, failing on malformed organization IDs
+func loadAPIKeyOrgs() (map[string]string, error) {
+	orgs := make(map[string]string)
+	for _, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		rest, org := splitAPIKeyOrg(entry)
+		if org == "" {
+			continue
+		}
+		if !orgIDPattern.MatchString(org) {
+			return nil, fmt.Errorf("invalid organization %q, expected lower-case letters, digits and dashes", org)
+		}
+		if key, _, _ := parseAPIKeyEntry(rest); key != "" && org != defaultOrg {
+			orgs[key] = org
+		}
+	}
+	return orgs, nil
+}
+
+// withOrg returns a context carrying the caller's organization
+func withOrg(ctx context.Context, org string) context.Context {
+	return context.WithValue(ctx, orgContextKey{}, org)
+}
+
+// requestOrg returns the caller's organization (defaultOrg unless a key or device says otherwise)
+func requestOrg(r *http.Request) string {
+	if org, ok := r.Context().Value(orgContextKey{}).(string); ok && org != "" {
+		return org
+	}
+	return defaultOrg
+}
+
+// orgAllowsRequest reports whether a key of the given organization may make this request
+func orgAllowsRequest(org string, r *http.Request) bool {
+	if org == defaultOrg || orgRoutes[r.URL.Path] || r.URL.Path == "/orgs/"+org+"/settings" {
+		return true
+	}
+	for _, prefix := range orgIDRoutes {
+		if _, _, ok := parseIDPath(r.URL.Path, prefix); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// memberOrg returns the organization of a member ("" for the zero Member)
+func memberOrg(m Member) string {
+	if m.ID != 0 && m.OrgID == "" {
+		return defaultOrg
+	}
+	return m.OrgID
+}
+
+// inRequestOrg reports whether a member belongs to the caller's organization
+func inRequestOrg(r *http.Request, m Member) bool {
+	return memberOrg(m) == requestOrg(r)
+}
+
+// checkMemberOrg writes a 404 and returns false if the member with this ID
+// exists but belongs to another organization than the caller's, so handlers
+// treat it like any unknown member
+func checkMemberOrg(w http.ResponseWriter, r *http.Request, id int64) bool {
+	var org string
+	err := db.QueryRow(`SELECT org_id FROM members WHERE id = ?`, id).Scan(&org)
+	if err == nil && org != requestOrg(r) {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// checkDeviceOrg is checkMemberOrg for devices
+func checkDeviceOrg(w http.ResponseWriter, r *http.Request, id int64) bool {
+	var org string
+	err := db.QueryRow(`SELECT org_id FROM devices WHERE id = ?`, id).Scan(&org)
+	if err == nil && org != requestOrg(r) {
+		http.Error(w, "Device not found", http.StatusNotFound)
+		return false
+	}
+	return true
+}
+
+// filterOrg keeps the intervals of members of an organization
+func filterOrg(intervals []presenceInterval, org string) []presenceInterval {
+	var kept []presenceInterval
+	for _, p := range intervals {
+		if p.OrgID == org {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
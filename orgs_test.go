@@ -0,0 +1,195 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// Organization Tests
+// ============================================================================
+
+// asOrg returns a request made by a key of an organization
+func asOrg(method, path, body, org string) *http.Request {
+	req, _ := http.NewRequest(method, path, bytes.NewBufferString(body))
+	return req.WithContext(withOrg(req.Context(), org))
+}
+
+// addESSMember adds Carol, a member of the ess organization with Alice's Discord ID
+func addESSMember(t *testing.T) {
+	t.Helper()
+
+	if _, err := db.Exec(`INSERT INTO members (id, name, uid, discord_id, org_id) VALUES (3, 'Carol', 'TEST_UID_3', '111111111', 'ess')`); err != nil {
+		t.Fatalf("failed to insert member: %v", err)
+	}
+	if err := loadMembersIntoCache(); err != nil {
+		t.Fatalf("failed to reload members: %v", err)
+	}
+}
+
+func TestSplitAPIKeyOrg(t *testing.T) {
+	tests := []struct{ entry, rest, org string }{
+		{"key", "key", ""},
+		{"key@ESS", "key", "ess"},
+		{"key:public@ess", "key:public", "ess"},
+		{"k@y@ess", "k@y", "ess"},
+	}
+	for _, tt := range tests {
+		if rest, org := splitAPIKeyOrg(tt.entry); rest != tt.rest || org != tt.org {
+			t.Errorf("%q: expected (%q, %q), got (%q, %q)", tt.entry, tt.rest, tt.org, rest, org)
+		}
+	}
+}
+
+func TestLoadAPIKeyOrgs(t *testing.T) {
+	defer os.Unsetenv("API_KEYS")
+
+	os.Setenv("API_KEYS", "host-key,ess-bot@ess,ess-tv:public@ess,host-tv:public@default")
+	orgs, err := loadAPIKeyOrgs()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(orgs) != 2 || orgs["ess-bot"] != "ess" || orgs["ess-tv"] != "ess" {
+		t.Errorf("unexpected organizations: %v", orgs)
+	}
+
+	os.Setenv("API_KEYS", "key@Not An Org")
+	if _, err := loadAPIKeyOrgs(); err == nil {
+		t.Error("expected an error for a malformed organization")
+	}
+}
+
+func TestAPIKeyMiddleware_OrgRoutes(t *testing.T) {
+	setupTest()
+	validAPIKeys = map[string]bool{"host-key": true, "ess-key": true}
+	apiKeyOrgs = map[string]string{"ess-key": "ess"}
+
+	var org string
+	handler := apiKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		org = requestOrg(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	tests := []struct {
+		key, path string
+		code      int
+		org       string
+	}{
+		{"host-key", "/terms", http.StatusOK, defaultOrg},
+		{"ess-key", "/members", http.StatusOK, "ess"},
+		{"ess-key", "/members/3/stats", http.StatusOK, "ess"},
+		{"ess-key", "/terms", http.StatusForbidden, ""},
+		{"ess-key", "/audit-log", http.StatusForbidden, ""},
+	}
+	for _, tt := range tests {
+		org = ""
+		req, _ := http.NewRequest("GET", tt.path, nil)
+		req.Header.Set("X-API-Key", tt.key)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		if rr.Code != tt.code || org != tt.org {
+			t.Errorf("%s %s: expected %v in %q, got %v in %q", tt.key, tt.path, tt.code, tt.org, rr.Code, org)
+		}
+	}
+}
+
+func TestHandleMembers_OrgIsolation(t *testing.T) {
+	setupTest()
+	addESSMember(t)
+
+	rr := httptest.NewRecorder()
+	handleMembers(rr, asOrg("POST", "/members", `{"name":"Dave","uid":"TEST_UID_4","discord_id":"444444444"}`, "ess"))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var members []Member
+	rr = httptest.NewRecorder()
+	handleMembers(rr, asOrg("GET", "/members", "", "ess"))
+	json.Unmarshal(rr.Body.Bytes(), &members)
+	if len(members) != 2 || members[0].OrgID != "ess" || members[1].OrgID != "ess" {
+		t.Errorf("expected only Carol and Dave, got %+v", members)
+	}
+
+	rr = httptest.NewRecorder()
+	handleMembers(rr, httptest.NewRequest("GET", "/members", nil))
+	json.Unmarshal(rr.Body.Bytes(), &members)
+	if len(members) != 2 || members[0].Name != "Alice" || members[1].Name != "Bob" {
+		t.Errorf("expected only Alice and Bob for the host, got %+v", members)
+	}
+
+	rr = httptest.NewRecorder()
+	handleMember(rr, asOrg("GET", "/members/1", "", "ess"))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a member of another organization, got %v", rr.Code)
+	}
+}
+
+func TestHandleMembers_CardOfAnotherOrg(t *testing.T) {
+	setupTest()
+	addESSMember(t)
+	deleteMember(t, "2")
+
+	// Live and trashed cards of the host answer like any taken card
+	for _, uid := range []string{"TEST_UID_1", "TEST_UID_2"} {
+		rr := httptest.NewRecorder()
+		handleMembers(rr, asOrg("POST", "/members", `{"name":"Dave","uid":"`+uid+`","discord_id":"444444444"}`, "ess"))
+		if rr.Code != http.StatusConflict || strings.TrimSpace(rr.Body.String()) != "UID already exists" {
+			t.Errorf("%s: expected a plain conflict, got %v; body=%s", uid, rr.Code, rr.Body.String())
+		}
+
+		rr = httptest.NewRecorder()
+		handleMember(rr, asOrg("PUT", "/members/3", `{"name":"Carol","uid":"`+uid+`","discord_id":"111111111"}`, "ess"))
+		if rr.Code != http.StatusConflict || strings.TrimSpace(rr.Body.String()) != "UID already exists" {
+			t.Errorf("%s: expected a plain conflict updating, got %v; body=%s", uid, rr.Code, rr.Body.String())
+		}
+	}
+}
+
+func TestScan_OrgIsolation(t *testing.T) {
+	setupTest()
+	addESSMember(t)
+
+	rr := httptest.NewRecorder()
+	handleScan(rr, asOrg("POST", "/scan", `{"uid":"TEST_UID_1"}`, "ess"))
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a card of another organization, got %v", rr.Code)
+	}
+
+	rr = httptest.NewRecorder()
+	handleScan(rr, asOrg("POST", "/scan", `{"uid":"TEST_UID_3"}`, "ess"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	scanCard("TEST_UID_1")
+
+	// Each organization only counts its own members
+	for org, expected := range map[string]int{defaultOrg: 1, "ess": 1, "cs": 0} {
+		if count := currentBreakdown(org).Total; count != expected {
+			t.Errorf("%s: expected %d present, got %d", org, expected, count)
+		}
+	}
+}
+
+func TestSignInDiscord_PerOrg(t *testing.T) {
+	setupTest()
+	addESSMember(t)
+
+	// The same Discord account signs in the member of the caller's organization
+	rr := httptest.NewRecorder()
+	handleSignInWithDiscordID(rr, asOrg("POST", "/sign-in-discord", `{"discord_id":"111111111"}`, "ess"))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_3"); !inside {
+		t.Error("expected Carol to be signed in")
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
+		t.Error("expected Alice not to be signed in")
+	}
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// --- Organization Settings ---
+//
+// Each organization (see orgs.go) may configure, through /orgs/{id}/settings:
+//   - its sign-in and sign-out greetings, with {name} standing for the member
+//   - a webhook receiving its notifications: office opening and closing and,
+//     for the host, reached goals. The host falls back to the integration's
+//     webhook URL; other organizations get no notifications without one.
+//   - a cleanup hour at which its members still inside are signed out. The
+//     nightly cleanup still signs out everyone left and ends the office day.
+//   - a capacity, the most of its members inside at once (0 for no limit)
+//   - a time zone for its reports, so days and hours of /stats and /reports
+//     start at its local midnight rather than the server's
+//
+// Organizations without settings use the defaults below.
+
+const (
+	defaultWelcomeMessage = "Welcome, {name}!"
+	defaultGoodbyeMessage = "Goodbye, {name}!"
+
+	// Longest greeting accepted
+	maxGreetingLength = 200
+)
+
+// errAtCapacity is returned by performSignIn when the member's organization is full
+var errAtCapacity = errors.New("organization at capacity")
+
+// OrgSettings is the configuration of an organization
+type OrgSettings struct {
+	OrgID          string     `json:"org_id"`
+	WelcomeMessage string     `json:"welcome_message"` // {name} is replaced by the member's name
+	GoodbyeMessage string     `json:"goodbye_message"`
+	WebhookURL     string     `json:"webhook_url"`
+	CleanupHour    *int       `json:"cleanup_hour"` // Local hour (0-23), null for the nightly cleanup only
+	Capacity       int        `json:"capacity"`     // 0 for no limit
+	Timezone       string     `json:"timezone"`     // IANA time zone of reports, "" for the server's
+	UpdatedAt      *time.Time `json:"updated_at,omitempty"`
+}
+
+// greeting returns a greeting template with the member's name filled in
+func greeting(template, name string) string {
+	return strings.ReplaceAll(template, "{name}", name)
+}
+
+// welcome returns the sign-in greeting of the organization for a member
+func (s OrgSettings) welcome(name string) string {
+	return greeting(s.WelcomeMessage, name)
+}
+
+// goodbye returns the sign-out greeting of the organization for a member
+func (s OrgSettings) goodbye(name string) string {
+	return greeting(s.GoodbyeMessage, name)
+}
+
+// loadOrgSettings returns the settings of an organization, the defaults if it has none
+func loadOrgSettings(org string) (OrgSettings, error) {
+	s := OrgSettings{OrgID: org, WelcomeMessage: defaultWelcomeMessage, GoodbyeMessage: defaultGoodbyeMessage}
+
+	var welcome, goodbye, webhook, updatedAt sql.NullString
+	var cleanupHour sql.NullInt64
+	err := db.QueryRow(`SELECT welcome_message, goodbye_message, webhook_url, cleanup_hour, capacity, timezone, updated_at
+		FROM org_settings WHERE org_id = ?`, org).Scan(&welcome, &goodbye, &webhook, &cleanupHour, &s.Capacity, &s.Timezone, &updatedAt)
+	if err == sql.ErrNoRows {
+		return s, nil
+	} else if err != nil {
+		return s, err
+	}
+
+	if welcome.String != "" {
+		s.WelcomeMessage = welcome.String
+	}
+	if goodbye.String != "" {
+		s.GoodbyeMessage = goodbye.String
+	}
+	s.WebhookURL = webhook.String
+	if cleanupHour.Valid {
+		hour := int(cleanupHour.Int64)
+		s.CleanupHour = &hour
+	}
+	if t, err := time.Parse(time.RFC3339, updatedAt.String); err == nil {
+		s.UpdatedAt = &t
+	}
+	return s, nil
+}
+
+// settingsOf returns the settings of an organization, falling back to the
+// defaults (and logging) if they cannot be loaded
+func settingsOf(org string) OrgSettings {
+	s, err := loadOrgSettings(org)
+	if err != nil {
+		log.Printf("Error loading settings of organization %s: %v", org, err)
+	}
+	return s
+}
+
+// reportLocation returns the time zone the reports of an organization are in:
+// its configured one, or the server's
+func reportLocation(org string) *time.Location {
+	s := settingsOf(org)
+	if s.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(s.Timezone)
+	if err != nil {
+		log.Printf("Error loading time zone of organization %s: %v", org, err)
+		return time.Local
+	}
+	return loc
+}
+
+// webhookOrgs returns the organizations other than the host with a webhook
+func webhookOrgs() ([]string, error) {
+	rows, err := db.Query(`SELECT org_id FROM org_settings WHERE webhook_url != '' AND org_id != ? ORDER BY org_id`, defaultOrg)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var orgs []string
+	for rows.Next() {
+		var org string
+		if err := rows.Scan(&org); err != nil {
+			return nil, err
+		}
+		orgs = append(orgs, org)
+	}
+	return orgs, rows.Err()
+}
+
+// nextCleanup returns when members of an organization still inside after now
+// are next signed out: its cleanup hour or the nightly cleanup, whichever comes first
+func nextCleanup(s OrgSettings, now time.Time) time.Time {
+	next := nextNightlyCleanup(now)
+	if s.CleanupHour == nil {
+		return next
+	}
+
+	own := time.Date(now.Year(), now.Month(), now.Day(), *s.CleanupHour, 0, 0, 0, now.Location())
+	if !own.After(now) {
+		own = own.AddDate(0, 0, 1)
+	}
+	if own.Before(next) {
+		return own
+	}
+	return next
+}
+
+// startOrgCleanups runs a goroutine that signs out, every hour on the hour,
+// the members of organizations whose cleanup hour it is
+func startOrgCleanups() {
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), now.Hour(), 0, 0, 0, now.Location()).Add(time.Hour)
+		timer := time.NewTimer(next.Sub(now))
+
+		<-timer.C
+
+		if err := runOrgCleanups(next.Hour()); err != nil {
+			log.Printf("Organization cleanup: %v", err)
+		}
+	}
+}
+
+// runOrgCleanups signs out the members of organizations cleaning up at an hour
+func runOrgCleanups(hour int) error {
+	if hour == nightlyCleanupHour {
+		return nil // The nightly cleanup signs out everyone
+	}
+
+	rows, err := db.Query(`SELECT org_id FROM org_settings WHERE cleanup_hour = ?`, hour)
+	if err != nil {
+		return err
+	}
+	var orgs []string
+	for rows.Next() {
+		var org string
+		if err := rows.Scan(&org); err != nil {
+			rows.Close()
+			return err
+		}
+		orgs = append(orgs, org)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, org := range orgs {
+		if cnt := signOutOrg(org, "the "+org+" cleanup"); cnt > 0 {
+			log.Printf("Organization cleanup: Force signed out %d people of %s", cnt, org)
+		}
+	}
+	return nil
+}
+
+// signOutOrg signs out the members of an organization currently inside,
+// saving their visits, and returns how many were signed out
+func signOutOrg(org, by string) int {
+	officeMu.Lock()
+	toSignOut := make(map[string]time.Time)
+	for _, a := range currentAttendees.list() {
+		if member, _ := memberCache.get(a.UID); memberOrg(member) != org {
+			continue
+		}
+		signInTime, ok, err := currentAttendees.signOutIfPresent(a.UID)
+		if err != nil {
+			log.Printf("Error signing out UID %s of %s: %v", a.UID, org, err)
+		} else if ok {
+			toSignOut[a.UID] = signInTime
+		}
+	}
+	closed := len(toSignOut) > 0 && currentAttendees.count() == 0
+	officeMu.Unlock()
+
+	if len(toSignOut) > 0 {
+		saveCurrentAttendeesInBackground()
+	}
+	saveSignedOut(toSignOut, by)
+	if closed {
+		publishOfficeClosed(context.Background(), Member{}, by, time.Now())
+	}
+	return len(toSignOut)
+}
+
+// orgSettingsPath returns the organization of an /orgs/{id}/settings path
+func orgSettingsPath(path string) (string, bool) {
+	org, sub, _ := strings.Cut(strings.TrimPrefix(path, "/orgs/"), "/")
+	return org, sub == "settings" && orgIDPattern.MatchString(org)
+}
+
+// validWebhookURL reports whether a webhook URL is an absolute http(s) URL
+func validWebhookURL(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// handleOrgSettings returns (GET) or replaces (PUT) the settings of an
+// organization, /orgs/{id}/settings. Keys of other organizations than the
+// host may only use their own.
+func handleOrgSettings(w http.ResponseWriter, r *http.Request) {
+	org, ok := orgSettingsPath(r.URL.Path)
+	if !ok || (requestOrg(r) != defaultOrg && org != requestOrg(r)) {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		s, err := loadOrgSettings(org)
+		if err != nil {
+			log.Printf("Error loading organization settings: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+
+	case http.MethodPut:
+		var req OrgSettings
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		if len(req.WelcomeMessage) > maxGreetingLength || len(req.GoodbyeMessage) > maxGreetingLength {
+			http.Error(w, fmt.Sprintf("Greetings must be at most %d characters", maxGreetingLength), http.StatusBadRequest)
+			return
+		}
+		if req.WebhookURL != "" && !validWebhookURL(req.WebhookURL) {
+			http.Error(w, "Invalid 'webhook_url', expected an http or https URL", http.StatusBadRequest)
+			return
+		}
+		if req.CleanupHour != nil && (*req.CleanupHour < 0 || *req.CleanupHour > 23) {
+			http.Error(w, "'cleanup_hour' must be between 0 and 23", http.StatusBadRequest)
+			return
+		}
+		if req.Capacity < 0 {
+			http.Error(w, "'capacity' must not be negative", http.StatusBadRequest)
+			return
+		}
+		if _, err := time.LoadLocation(req.Timezone); err != nil || req.Timezone == "Local" {
+			http.Error(w, "Invalid 'timezone', expected an IANA time zone such as America/Toronto", http.StatusBadRequest)
+			return
+		}
+
+		var cleanupHour interface{}
+		if req.CleanupHour != nil {
+			cleanupHour = *req.CleanupHour
+		}
+		if _, err := db.Exec(`INSERT INTO org_settings (org_id, welcome_message, goodbye_message, webhook_url, cleanup_hour, capacity, timezone, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(org_id) DO UPDATE SET welcome_message = excluded.welcome_message, goodbye_message = excluded.goodbye_message,
+				webhook_url = excluded.webhook_url, cleanup_hour = excluded.cleanup_hour, capacity = excluded.capacity,
+				timezone = excluded.timezone, updated_at = excluded.updated_at`,
+			org, req.WelcomeMessage, req.GoodbyeMessage, req.WebhookURL, cleanupHour, req.Capacity, req.Timezone, time.Now().Format(time.RFC3339)); err != nil {
+			log.Printf("Error saving organization settings: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		renderedResponses.invalidate()
+		recordAudit("org.settings_changed", clientIP(r), fmt.Sprintf("Organization %s capacity=%d", org, req.Capacity))
+
+		s, err := loadOrgSettings(org)
+		if err != nil {
+			log.Printf("Error loading organization settings: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(s)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+	}
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Organization Settings Tests
+// ============================================================================
+
+// putOrgSettings calls PUT /orgs/{org}/settings as a key of an organization
+func putOrgSettings(org, callerOrg, body string) *httptest.ResponseRecorder {
+	rr := httptest.NewRecorder()
+	handleOrgSettings(rr, asOrg("PUT", "/orgs/"+org+"/settings", body, callerOrg))
+	return rr
+}
+
+func TestHandleOrgSettings_Defaults(t *testing.T) {
+	setupTest()
+
+	rr := httptest.NewRecorder()
+	handleOrgSettings(rr, httptest.NewRequest("GET", "/orgs/ess/settings", nil))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var s OrgSettings
+	json.Unmarshal(rr.Body.Bytes(), &s)
+	if s.OrgID != "ess" || s.WelcomeMessage != defaultWelcomeMessage || s.CleanupHour != nil || s.Capacity != 0 {
+		t.Errorf("expected the defaults, got %+v", s)
+	}
+}
+
+func TestHandleOrgSettings_Update(t *testing.T) {
+	setupTest()
+
+	rr := putOrgSettings("ess", "ess", `{"welcome_message":"Bienvenue, {name}!","cleanup_hour":22,"capacity":5}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var s OrgSettings
+	json.Unmarshal(rr.Body.Bytes(), &s)
+	if s.WelcomeMessage != "Bienvenue, {name}!" || s.GoodbyeMessage != defaultGoodbyeMessage ||
+		s.CleanupHour == nil || *s.CleanupHour != 22 || s.Capacity != 5 || s.UpdatedAt == nil {
+		t.Errorf("unexpected settings: %+v", s)
+	}
+
+	invalid := []string{
+		`{"cleanup_hour":24}`,
+		`{"capacity":-1}`,
+		`{"webhook_url":"ftp://example.com"}`,
+		`{"timezone":"Mars/Olympus_Mons"}`,
+		`{"welcome_message":"` + strings.Repeat("a", maxGreetingLength+1) + `"}`,
+	}
+	for _, body := range invalid {
+		if rr := putOrgSettings("ess", defaultOrg, body); rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected 400, got %v", body, rr.Code)
+		}
+	}
+}
+
+func TestHandleOrgSettings_OtherOrganizations(t *testing.T) {
+	setupTest()
+
+	if rr := putOrgSettings("cs", "ess", `{"capacity":1}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another organization's settings, got %v", rr.Code)
+	}
+	if rr := putOrgSettings("cs", defaultOrg, `{"capacity":1}`); rr.Code != http.StatusOK {
+		t.Errorf("expected the host to manage any organization, got %v", rr.Code)
+	}
+
+	rr := httptest.NewRecorder()
+	handleOrgSettings(rr, httptest.NewRequest("GET", "/orgs/ess/members", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown path, got %v", rr.Code)
+	}
+}
+
+func TestOrgSettings_Greetings(t *testing.T) {
+	setupTest()
+	putOrgSettings(defaultOrg, defaultOrg, `{"welcome_message":"Hey {name}, welcome in","goodbye_message":"See you, {name}."}`)
+
+	msg, err := performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+	if err != nil || msg != "Hey Alice, welcome in" {
+		t.Errorf("expected the host's greeting, got %q (err %v)", msg, err)
+	}
+	msg, err = performSignOut(context.Background(), cachedMember("TEST_UID_1"))
+	if err != nil || !strings.HasPrefix(msg, "See you, Alice. Duration: ") {
+		t.Errorf("expected the host's goodbye, got %q (err %v)", msg, err)
+	}
+}
+
+func TestOrgSettings_Capacity(t *testing.T) {
+	setupTest()
+	addESSMember(t)
+	putOrgSettings(defaultOrg, defaultOrg, `{"capacity":1}`)
+
+	if _, err := performSignIn(context.Background(), cachedMember("TEST_UID_1"), ""); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if rr := scanCard("TEST_UID_2"); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 at capacity, got %v", rr.Code)
+	}
+	if _, err := performSignIn(context.Background(), cachedMember("TEST_UID_1"), ""); err != errAlreadySignedIn {
+		t.Errorf("expected errAlreadySignedIn for a member inside, got %v", err)
+	}
+
+	// Other organizations have their own capacity
+	if _, err := performSignIn(context.Background(), cachedMember("TEST_UID_3"), ""); err != nil {
+		t.Errorf("expected Carol to sign in, got %v", err)
+	}
+}
+
+func TestNextCleanup(t *testing.T) {
+	loc := time.Local
+	now := time.Date(2025, 3, 10, 20, 0, 0, 0, loc)
+	evening, early := 22, 6
+
+	tests := []struct {
+		hour *int
+		want time.Time
+	}{
+		{nil, time.Date(2025, 3, 11, nightlyCleanupHour, 0, 0, 0, loc)},
+		{&evening, time.Date(2025, 3, 10, 22, 0, 0, 0, loc)},
+		{&early, time.Date(2025, 3, 11, nightlyCleanupHour, 0, 0, 0, loc)}, // After the nightly cleanup
+	}
+	for _, tt := range tests {
+		if got := nextCleanup(OrgSettings{CleanupHour: tt.hour}, now); !got.Equal(tt.want) {
+			t.Errorf("cleanup hour %v: expected %v, got %v", tt.hour, tt.want, got)
+		}
+	}
+}
+
+func TestRunOrgCleanups(t *testing.T) {
+	setupTest()
+	addESSMember(t)
+	putOrgSettings("ess", defaultOrg, `{"cleanup_hour":22}`)
+	performSignIn(context.Background(), cachedMember("TEST_UID_1"), "")
+	performSignIn(context.Background(), cachedMember("TEST_UID_3"), "")
+
+	if err := runOrgCleanups(22); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_3"); inside {
+		t.Error("expected Carol to be signed out")
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
+		t.Error("expected Alice to stay signed in")
+	}
+
+	var visits int
+	db.QueryRow(`SELECT COUNT(*) FROM visits WHERE member_id = 3`).Scan(&visits)
+	if visits != 1 {
+		t.Errorf("expected Carol's visit saved, got %d", visits)
+	}
+}
+
+func TestOfficeNotifications_OrgWebhooks(t *testing.T) {
+	setupTest()
+	addESSMember(t)
+	host := officeWebhook(t, "OFFICE_WEBHOOK_URL")
+	ess := officeWebhook(t, "ESS_TEST_WEBHOOK_URL")
+	putOrgSettings("ess", defaultOrg, `{"webhook_url":"`+os.Getenv("ESS_TEST_WEBHOOK_URL")+`"}`)
+
+	performSignIn(context.Background(), cachedMember("TEST_UID_3"), "")
+
+	// Each organization only sees the names of its own members
+	if messages := host(); len(messages) != 1 || messages[0] != "The office is open" {
+		t.Errorf("expected the host not to see Carol's name, got %q", messages)
+	}
+	if messages := ess(); len(messages) != 1 || messages[0] != "The office is open, Carol signed in" {
+		t.Errorf("expected ESS to see Carol's name, got %q", messages)
+	}
+}
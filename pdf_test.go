@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// PDF Writer Tests
+// ============================================================================
+
+// checkPDFStructure fails the test unless every xref entry points at its object
+func checkPDFStructure(t *testing.T, data []byte) {
+	t.Helper()
+
+	if !bytes.HasPrefix(data, []byte("%PDF-1.4\n")) || !bytes.HasSuffix(data, []byte("%%EOF\n")) {
+		t.Fatalf("missing PDF header or trailer")
+	}
+	m := regexp.MustCompile(`startxref\n(\d+)\n`).FindSubmatch(data)
+	if m == nil {
+		t.Fatal("missing startxref")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(data[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(data[xref:], -1)
+	if len(entries) == 0 {
+		t.Fatal("empty xref table")
+	}
+	for i, e := range entries {
+		offset, _ := strconv.Atoi(string(e[1]))
+		if want := strconv.Itoa(i+1) + " 0 obj\n"; !bytes.HasPrefix(data[offset:], []byte(want)) {
+			t.Errorf("xref entry %d points at %q", i+1, data[offset:offset+10])
+		}
+	}
+}
+
+func TestPDFEscape(t *testing.T) {
+	tests := map[string]string{
+		"Alice":       "Alice",
+		`a (b) \ c`:   `a \(b\) \\ c`,
+		"Émilie":      `\311milie`,
+		"日本":          "??",
+		"line\nbreak": "line?break",
+	}
+	for in, want := range tests {
+		if got := pdfEscape(in); got != want {
+			t.Errorf("pdfEscape(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	first, second := &pdfPage{}, &pdfPage{}
+	first.text(72, 720, 12, true, "Hello (world)")
+	first.rect(72, 600, 100, 50, 0.5)
+	second.line(0, 0, 100, 100)
+
+	var buf bytes.Buffer
+	if err := writePDF(&buf, "Test", []*pdfPage{first, second}); err != nil {
+		t.Fatalf("writePDF failed: %v", err)
+	}
+	checkPDFStructure(t, buf.Bytes())
+
+	out := buf.String()
+	if !strings.Contains(out, "/Count 2") || !strings.Contains(out, "/Kids [6 0 R 8 0 R]") {
+		t.Errorf("expected two pages in the page tree, got %s", out)
+	}
+	if !strings.Contains(out, `BT /F2 12.0 Tf 72.00 720.00 Td (Hello \(world\)) Tj ET`) {
+		t.Errorf("expected escaped bold text, got %s", out)
+	}
+}
@@ -0,0 +1,291 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Pending Members ---
+//
+// The membership signup form posts each submission to
+// POST /integrations/membership-webhook, which records a pending member: a
+// person who signed up but has no card yet. When their card is issued, an
+// exec enrolls it with POST /members/pending/{id}/enroll, which creates the
+// member and removes the pending entry. A new submission with the Discord ID
+// of a pending member updates that entry instead of adding another one.
+
+// PendingMember is a signup awaiting card enrollment
+type PendingMember struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	DiscordID   string    `json:"discord_id"`
+	Email       string    `json:"email"`
+	Role        string    `json:"role"`
+	SubmittedAt time.Time `json:"submitted_at"`
+}
+
+// MembershipSubmission is the payload posted by the membership signup form
+type MembershipSubmission struct {
+	Name        string     `json:"name"`
+	DiscordID   string     `json:"discord_id"`
+	Email       string     `json:"email"`
+	Role        string     `json:"role"`                   // Optional, member by default
+	SubmittedAt *time.Time `json:"submitted_at,omitempty"` // Optional, time received by default
+}
+
+// EnrollRequest is the body of POST /members/pending/{id}/enroll
+type EnrollRequest struct {
+	UID    string `json:"uid"`
+	Status string `json:"status,omitempty"` // active (default) or pending
+}
+
+// pendingMemberColumns is the column list scanned by scanPendingMember
+const pendingMemberColumns = `id, name, discord_id, email, role, submitted_at`
+
+// scanPendingMember reads a pending member row selected with pendingMemberColumns
+func scanPendingMember(row rowScanner) (PendingMember, error) {
+	var p PendingMember
+	var submittedAt string
+	if err := row.Scan(&p.ID, &p.Name, decrypted{&p.DiscordID}, decrypted{&p.Email}, &p.Role, &submittedAt); err != nil {
+		return PendingMember{}, err
+	}
+
+	var err error
+	if p.SubmittedAt, err = time.Parse(time.RFC3339, submittedAt); err != nil {
+		return PendingMember{}, err
+	}
+	return p, nil
+}
+
+// loadPendingMember fetches a single pending member by ID
+func loadPendingMember(id int64) (PendingMember, error) {
+	return scanPendingMember(db.QueryRow(`SELECT `+pendingMemberColumns+` FROM pending_members WHERE id = ?`, id))
+}
+
+// loadPendingMembers returns all pending members, oldest signup first
+func loadPendingMembers() ([]PendingMember, error) {
+	rows, err := db.Query(`SELECT ` + pendingMemberColumns + ` FROM pending_members ORDER BY submitted_at, id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []PendingMember{}
+	for rows.Next() {
+		p, err := scanPendingMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// savePendingMember adds a pending member, or updates the one with the same
+// Discord ID, and reports whether it was added
+func savePendingMember(p *PendingMember) (bool, error) {
+	var id int64
+	err := db.QueryRow(`SELECT id FROM pending_members WHERE discord_id = ?`, encryptField(p.DiscordID)).Scan(&id)
+	if err == sql.ErrNoRows {
+		res, err := db.Exec(`INSERT INTO pending_members (name, discord_id, email, role, submitted_at) VALUES (?, ?, ?, ?, ?)`,
+			p.Name, encryptField(p.DiscordID), encryptField(p.Email), p.Role, p.SubmittedAt.Format(time.RFC3339))
+		if err != nil {
+			return false, err
+		}
+		p.ID, _ = res.LastInsertId()
+		return true, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	p.ID = id
+	_, err = db.Exec(`UPDATE pending_members SET name = ?, email = ?, role = ?, submitted_at = ? WHERE id = ?`,
+		p.Name, encryptField(p.Email), p.Role, p.SubmittedAt.Format(time.RFC3339), id)
+	return false, err
+}
+
+// enrollPendingMember creates the member of a pending signup with a card UID
+// and status, and removes the pending entry
+func enrollPendingMember(p PendingMember, uid, status string) (Member, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Member{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO members (name, uid, discord_id, role, status) VALUES (?, ?, ?, ?, ?)`, p.Name, uid, encryptField(p.DiscordID), p.Role, status)
+	if err != nil {
+		return Member{}, err
+	}
+	if _, err := tx.Exec(`DELETE FROM pending_members WHERE id = ?`, p.ID); err != nil {
+		return Member{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return Member{}, err
+	}
+
+	id, _ := res.LastInsertId()
+	return Member{ID: id, Name: p.Name, UID: uid, DiscordID: p.DiscordID, Role: p.Role, Status: status}, nil
+}
+
+// handleMembershipWebhook records a membership form submission as a pending member
+func handleMembershipWebhook(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	var req MembershipSubmission
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	req.DiscordID = strings.TrimSpace(req.DiscordID)
+	req.Email = strings.TrimSpace(req.Email)
+	if req.Name == "" || req.DiscordID == "" {
+		http.Error(w, "name and discord_id are required", http.StatusBadRequest)
+		return
+	}
+	role, ok := normalizeRole(req.Role)
+	if !ok {
+		http.Error(w, "Invalid 'role', expected member, exec, officer or guest", http.StatusBadRequest)
+		return
+	}
+
+	if member, found := findMemberByDiscordID(req.DiscordID, requestOrg(r)); found {
+		http.Error(w, fmt.Sprintf("Discord ID already belongs to member %d", member.ID), http.StatusConflict)
+		return
+	}
+
+	pending := PendingMember{Name: req.Name, DiscordID: req.DiscordID, Email: req.Email, Role: role, SubmittedAt: time.Now().Truncate(time.Second)}
+	if req.SubmittedAt != nil {
+		pending.SubmittedAt = *req.SubmittedAt
+	}
+	created, err := savePendingMember(&pending)
+	if err != nil {
+		log.Printf("Error saving pending member: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	action, status := "pending_member.updated", http.StatusOK
+	if created {
+		action, status = "pending_member.created", http.StatusCreated
+	}
+	recordAudit(action, clientIP(r), fmt.Sprintf("pending=%d name=%s discord_id=%s", pending.ID, pending.Name, pending.DiscordID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(pending)
+}
+
+// handlePendingMembers lists the pending members (GET)
+func handlePendingMembers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	pending, err := loadPendingMembers()
+	if err != nil {
+		log.Printf("Error querying pending members: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// handlePendingMember handles a single pending member: GET, DELETE (dismiss)
+// and POST /members/pending/{id}/enroll
+func handlePendingMember(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/members/pending/")
+	if !ok {
+		http.Error(w, "Invalid pending member ID", http.StatusBadRequest)
+		return
+	}
+	if sub != "" && sub != "enroll" {
+		http.NotFound(w, r)
+		return
+	}
+
+	if sub == "enroll" && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+	if sub == "" && r.Method != http.MethodGet && r.Method != http.MethodDelete {
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+		return
+	}
+
+	pending, err := loadPendingMember(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Pending member not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying pending member: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch {
+	case sub == "enroll":
+		var req EnrollRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.UID = strings.TrimSpace(req.UID)
+		if req.UID == "" {
+			http.Error(w, "uid is required", http.StatusBadRequest)
+			return
+		}
+
+		status, ok := normalizeStatus(req.Status)
+		if !ok || (status != statusActive && status != statusPending) {
+			http.Error(w, "Invalid 'status', expected active or pending", http.StatusBadRequest)
+			return
+		}
+
+		member, err := enrollPendingMember(pending, req.UID, status)
+		if err != nil {
+			if isUniqueViolation(err) {
+				writeUIDConflict(w, r, req.UID)
+				return
+			}
+			log.Printf("Error enrolling pending member: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		memberCache.put(member)
+		events.publish(Event{Kind: eventMemberCreated, Member: member, Message: fmt.Sprintf("Member %s created", member.Name)})
+		recordAudit("pending_member.enrolled", clientIP(r), fmt.Sprintf("pending=%d member=%d name=%s", pending.ID, member.ID, member.Name))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(member)
+
+	case r.Method == http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(pending)
+
+	default:
+		if _, err := db.Exec(`DELETE FROM pending_members WHERE id = ?`, id); err != nil {
+			log.Printf("Error deleting pending member: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("pending_member.deleted", clientIP(r), fmt.Sprintf("pending=%d name=%s", pending.ID, pending.Name))
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Pending member deleted successfully"})
+	}
+}
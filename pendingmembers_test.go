@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// Membership Webhook and Pending Member Tests
+// ============================================================================
+
+// postSignup posts a membership form submission to the webhook
+func postSignup(body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/integrations/membership-webhook", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	handleMembershipWebhook(rr, req)
+	return rr
+}
+
+// pendingRequest calls a /members/pending endpoint through the member router
+func pendingRequest(method, path, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	return rr
+}
+
+func TestMembershipWebhook_CreatesPendingMember(t *testing.T) {
+	setupTest()
+
+	rr := postSignup(`{"name": " Carol ", "discord_id": "333333333", "email": "carol@uottawa.ca", "submitted_at": "2025-09-03T14:00:00Z"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var pending PendingMember
+	if err := json.Unmarshal(rr.Body.Bytes(), &pending); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if pending.ID == 0 || pending.Name != "Carol" || pending.Role != roleMember || pending.SubmittedAt.Format("2006-01-02") != "2025-09-03" {
+		t.Errorf("unexpected pending member: %+v", pending)
+	}
+
+	// Signing up again updates the same entry
+	rr = postSignup(`{"name": "Carol Chen", "discord_id": "333333333", "email": "carol@uottawa.ca"}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK for a repeated signup, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr = pendingRequest("GET", "/members/pending", "")
+	var list []PendingMember
+	json.Unmarshal(rr.Body.Bytes(), &list)
+	if len(list) != 1 || list[0].ID != pending.ID || list[0].Name != "Carol Chen" {
+		t.Errorf("expected one updated pending member, got %+v", list)
+	}
+}
+
+func TestMembershipWebhook_Rejects(t *testing.T) {
+	setupTest()
+
+	tests := []struct {
+		name, body string
+		code       int
+	}{
+		{"invalid JSON", `{`, http.StatusBadRequest},
+		{"missing name", `{"discord_id": "333333333"}`, http.StatusBadRequest},
+		{"missing discord_id", `{"name": "Carol"}`, http.StatusBadRequest},
+		{"invalid role", `{"name": "Carol", "discord_id": "333333333", "role": "president"}`, http.StatusBadRequest},
+		{"existing member", `{"name": "Alice", "discord_id": "111111111"}`, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rr := postSignup(tt.body); rr.Code != tt.code {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestPendingMember_Enroll(t *testing.T) {
+	setupTest()
+
+	rr := postSignup(`{"name": "Carol", "discord_id": "333333333", "role": "exec"}`)
+	var pending PendingMember
+	json.Unmarshal(rr.Body.Bytes(), &pending)
+	path := fmt.Sprintf("/members/pending/%d", pending.ID)
+
+	// UIDs already in use are refused
+	rr = pendingRequest("POST", path+"/enroll", `{"uid": "TEST_UID_1"}`)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 Conflict for a used UID, got %v", rr.Code)
+	}
+	rr = pendingRequest("POST", path+"/enroll", `{"uid": ""}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Fatalf("expected 400 Bad Request without a UID, got %v", rr.Code)
+	}
+
+	rr = pendingRequest("POST", path+"/enroll", `{"uid": "CARD_C"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var member Member
+	json.Unmarshal(rr.Body.Bytes(), &member)
+	if member.ID == 0 || member.Name != "Carol" || member.UID != "CARD_C" || member.DiscordID != "333333333" || member.Role != roleExec {
+		t.Errorf("unexpected member: %+v", member)
+	}
+	if m := cachedMember("CARD_C"); m.ID != member.ID {
+		t.Errorf("expected enrolled member in the cache, got %+v", m)
+	}
+
+	// No longer pending
+	if rr = pendingRequest("GET", path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after enrollment, got %v", rr.Code)
+	}
+	entries, _ := loadAuditEntries("pending_member.enrolled", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected enrollment to be audited, got %+v", entries)
+	}
+}
+
+func TestPendingMember_GetAndDelete(t *testing.T) {
+	setupTest()
+
+	rr := postSignup(`{"name": "Carol", "discord_id": "333333333"}`)
+	var pending PendingMember
+	json.Unmarshal(rr.Body.Bytes(), &pending)
+	path := fmt.Sprintf("/members/pending/%d", pending.ID)
+
+	if rr = pendingRequest("GET", path, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if rr = pendingRequest("DELETE", path, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK on delete, got %v", rr.Code)
+	}
+	if rr = pendingRequest("DELETE", path, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a deleted entry, got %v", rr.Code)
+	}
+	if rr = pendingRequest("GET", "/members/pending/abc", ""); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an invalid ID, got %v", rr.Code)
+	}
+	if rr = pendingRequest("PUT", path, ""); rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for PUT, got %v", rr.Code)
+	}
+}
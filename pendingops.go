@@ -0,0 +1,486 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Two-Person Approval ---
+//
+// With TWO_PERSON_APPROVAL set (a Go duration such as 1h), destructive
+// operations are not run when they are requested. They are queued as pending
+// operations that a second admin, calling with another API key, must approve
+// within that time. Only the host's admin keys listed in API_KEYS approve
+// (see approverKeys): SCANNER_API_KEY and DISCORD_BOT_API_KEY belong to
+// devices, not people; the operation then runs as it was requested and its
+// response is kept with it. Either admin may reject it instead, and one not
+// approved in time expires. The guarded operations are listed in
+// destructiveOperations:
+//   - DELETE /visits (purging visits)
+//   - DELETE /members/{id} and DELETE /admin/trash/{id} (erasing a member
+//     and their visits)
+//   - POST /sign-out-all
+//   - POST /import-members and POST /admin/migrate-json (restoring members
+//     and visits from files)
+//
+// Requests, approvals, rejections and expiries are recorded in the audit log.
+
+const (
+	pendingOpPending  = "pending"
+	pendingOpApproved = "approved"
+	pendingOpRejected = "rejected"
+	pendingOpExpired  = "expired"
+)
+
+// twoPersonApproval is how long a destructive operation waits for approval; 0 runs them right away
+var twoPersonApproval time.Duration
+
+// destructiveOperation is a request that needs a second admin's approval
+type destructiveOperation struct {
+	kind    string
+	method  string
+	path    string // A path ending in "{id}" matches any ID without a sub-path
+	handler http.HandlerFunc
+}
+
+// destructiveOperations are the requests queued for approval
+var destructiveOperations = []destructiveOperation{
+	{"visits.delete", http.MethodDelete, "/visits", handleVisits},
+	{"member.delete", http.MethodDelete, "/members/{id}", handleMember},
+	{"member.purge", http.MethodDelete, "/admin/trash/{id}", handleTrashedMember},
+	{"attendees.sign_out_all", http.MethodPost, "/sign-out-all", handleSignoutAll},
+	{"members.import", http.MethodPost, "/import-members", handleImportMembers},
+	{"database.migrate_json", http.MethodPost, "/admin/migrate-json", handleMigrateJSON},
+}
+
+// matches reports whether a request is this operation
+func (op destructiveOperation) matches(r *http.Request) bool {
+	if r.Method != op.method {
+		return false
+	}
+	if prefix, ok := strings.CutSuffix(op.path, "{id}"); ok {
+		_, sub, ok := parseIDPath(r.URL.Path, prefix)
+		return ok && sub == ""
+	}
+	return r.URL.Path == op.path
+}
+
+// findDestructiveOperation returns the guarded operation a request is, if any
+func findDestructiveOperation(r *http.Request) (destructiveOperation, bool) {
+	for _, op := range destructiveOperations {
+		if op.matches(r) {
+			return op, true
+		}
+	}
+	return destructiveOperation{}, false
+}
+
+// loadTwoPersonApproval reads TWO_PERSON_APPROVAL (a Go duration such as 1h,
+// empty to disable). Approving needs a second key, so at least two approver
+// keys must be configured.
+func loadTwoPersonApproval() (time.Duration, error) {
+	value := os.Getenv("TWO_PERSON_APPROVAL")
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+
+	approvers, err := approverKeys()
+	if err != nil {
+		return 0, err
+	}
+	if len(approvers) < 2 {
+		return 0, fmt.Errorf("requires at least two admin keys in API_KEYS, %d configured", len(approvers))
+	}
+	return d, nil
+}
+
+// approverKeys returns the keys that may approve pending operations: the
+// admin entries of API_KEYS without another organization
+func approverKeys() (map[string]bool, error) {
+	approvers := make(map[string]bool)
+	for i, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		rest, org := splitAPIKeyOrg(entry)
+		key, scope, err := parseAPIKeyEntry(rest)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if key != "" && scope == scopeAdmin && (org == "" || org == defaultOrg) {
+			approvers[key] = true
+		}
+	}
+	return approvers, nil
+}
+
+// PendingOperation is a destructive operation awaiting a second admin
+type PendingOperation struct {
+	ID           int64           `json:"id"`
+	Kind         string          `json:"kind"`
+	Method       string          `json:"method"`
+	Path         string          `json:"path"` // With the query string
+	OrgID        string          `json:"org_id"`
+	Status       string          `json:"status"`
+	RequestedBy  string          `json:"requested_by"` // API key ID
+	RequestedAt  time.Time       `json:"requested_at"`
+	ExpiresAt    time.Time       `json:"expires_at"`
+	DecidedBy    string          `json:"decided_by,omitempty"`
+	DecidedAt    *time.Time      `json:"decided_at,omitempty"`
+	ResultStatus int             `json:"result_status,omitempty"` // Response of the approved operation
+	Result       json.RawMessage `json:"result,omitempty"`
+}
+
+// pendingOperationColumns is the column list scanned by scanPendingOperation
+const pendingOperationColumns = `id, kind, method, path, org_id, status, requested_by, requested_at, expires_at,
+	decided_by, decided_at, result_status, result`
+
+// scanPendingOperation reads a row selected with pendingOperationColumns
+func scanPendingOperation(row rowScanner) (PendingOperation, error) {
+	var p PendingOperation
+	var requestedAt, expiresAt string
+	var decidedBy, decidedAt, result sql.NullString
+	var resultStatus sql.NullInt64
+	if err := row.Scan(&p.ID, &p.Kind, &p.Method, &p.Path, &p.OrgID, &p.Status, &p.RequestedBy, &requestedAt, &expiresAt,
+		&decidedBy, &decidedAt, &resultStatus, &result); err != nil {
+		return PendingOperation{}, err
+	}
+
+	var err error
+	if p.RequestedAt, err = time.Parse(time.RFC3339, requestedAt); err != nil {
+		return PendingOperation{}, err
+	}
+	if p.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+		return PendingOperation{}, err
+	}
+	if decidedAt.Valid {
+		t, err := time.Parse(time.RFC3339, decidedAt.String)
+		if err != nil {
+			return PendingOperation{}, err
+		}
+		p.DecidedAt = &t
+	}
+	p.DecidedBy = decidedBy.String
+	p.ResultStatus = int(resultStatus.Int64)
+	if result.Valid {
+		// Plain text responses (errors) are shown as a JSON string
+		if json.Valid([]byte(result.String)) {
+			p.Result = json.RawMessage(result.String)
+		} else {
+			p.Result, _ = json.Marshal(strings.TrimSpace(result.String))
+		}
+	}
+	return p, nil
+}
+
+// loadPendingOperation fetches a pending operation by ID
+func loadPendingOperation(id int64) (PendingOperation, error) {
+	return scanPendingOperation(db.QueryRow(`SELECT `+pendingOperationColumns+` FROM pending_operations WHERE id = ?`, id))
+}
+
+// loadPendingOperations returns operations, newest first, optionally of one status
+func loadPendingOperations(status string) ([]PendingOperation, error) {
+	query := `SELECT ` + pendingOperationColumns + ` FROM pending_operations`
+	var args []interface{}
+	if status != "" {
+		query += ` WHERE status = ?`
+		args = append(args, status)
+	}
+	rows, err := db.Query(query+` ORDER BY id DESC`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ops := []PendingOperation{}
+	for rows.Next() {
+		p, err := scanPendingOperation(rows)
+		if err != nil {
+			return nil, err
+		}
+		ops = append(ops, p)
+	}
+	return ops, rows.Err()
+}
+
+// queuePendingOperation records a request for a destructive operation
+func queuePendingOperation(op destructiveOperation, r *http.Request, now time.Time) (PendingOperation, error) {
+	res, err := db.Exec(`INSERT INTO pending_operations (kind, method, path, org_id, status, requested_by, requested_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		op.kind, r.Method, r.URL.RequestURI(), requestOrg(r), pendingOpPending, apiKeyID(r.Header.Get("X-API-Key")),
+		now.UTC().Format(time.RFC3339), now.Add(twoPersonApproval).UTC().Format(time.RFC3339))
+	if err != nil {
+		return PendingOperation{}, err
+	}
+	id, _ := res.LastInsertId()
+	return loadPendingOperation(id)
+}
+
+// decidePendingOperation approves or rejects a pending operation, reporting
+// whether it was still pending
+func decidePendingOperation(id int64, status, by string, now time.Time) (bool, error) {
+	res, err := db.Exec(`UPDATE pending_operations SET status = ?, decided_by = ?, decided_at = ? WHERE id = ? AND status = ?`,
+		status, by, now.UTC().Format(time.RFC3339), id, pendingOpPending)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// expirePendingOperations marks the operations not approved in time expired
+func expirePendingOperations(now time.Time) error {
+	rows, err := db.Query(`UPDATE pending_operations SET status = ? WHERE status = ? AND expires_at <= ? RETURNING id, kind, requested_by`,
+		pendingOpExpired, pendingOpPending, now.UTC().Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	var details []string
+	for rows.Next() {
+		var id int64
+		var kind, requestedBy string
+		if err := rows.Scan(&id, &kind, &requestedBy); err != nil {
+			return err
+		}
+		details = append(details, fmt.Sprintf("op=%d kind=%s requested_by=%s", id, kind, requestedBy))
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, detail := range details {
+		recordAudit("pending_op.expired", "system", detail)
+	}
+	return nil
+}
+
+// operationRecorder keeps the response of an approved operation
+type operationRecorder struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func (o *operationRecorder) Header() http.Header { return o.header }
+
+func (o *operationRecorder) WriteHeader(status int) {
+	if o.status == 0 {
+		o.status = status
+	}
+}
+
+func (o *operationRecorder) Write(p []byte) (int, error) {
+	if o.status == 0 {
+		o.status = http.StatusOK
+	}
+	return o.body.Write(p)
+}
+
+// runPendingOperation runs an approved operation as it was requested, in the
+// requester's organization, and saves its response
+func runPendingOperation(r *http.Request, p PendingOperation) (PendingOperation, error) {
+	var op destructiveOperation
+	for _, o := range destructiveOperations {
+		if o.kind == p.Kind {
+			op = o
+		}
+	}
+	if op.handler == nil {
+		return p, fmt.Errorf("unknown operation %q", p.Kind)
+	}
+
+	req, err := http.NewRequestWithContext(withOrg(r.Context(), p.OrgID), p.Method, p.Path, nil)
+	if err != nil {
+		return p, err
+	}
+	req.Header = r.Header.Clone()
+	req.RemoteAddr = r.RemoteAddr
+
+	rec := &operationRecorder{header: make(http.Header)}
+	op.handler(rec, req)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+
+	if _, err := db.Exec(`UPDATE pending_operations SET result_status = ?, result = ? WHERE id = ?`, rec.status, rec.body.String(), p.ID); err != nil {
+		return p, err
+	}
+	return loadPendingOperation(p.ID)
+}
+
+// twoPersonApprovalMiddleware queues destructive operations for a second
+// admin's approval instead of running them
+func twoPersonApprovalMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		op, ok := findDestructiveOperation(r)
+		if twoPersonApproval == 0 || !ok {
+			next(w, r)
+			return
+		}
+
+		p, err := queuePendingOperation(op, r, time.Now())
+		if err != nil {
+			log.Printf("Error queueing pending operation: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("pending_op.requested", clientIP(r), fmt.Sprintf("op=%d kind=%s path=%s requested_by=%s", p.ID, p.Kind, p.Path, p.RequestedBy))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"message": fmt.Sprintf("Operation pending: another admin must approve it with POST /admin/pending-ops/%d/approve by %s",
+				p.ID, p.ExpiresAt.Local().Format("15:04")),
+			"status":     pendingOpPending,
+			"pending_id": p.ID,
+			"expires_at": p.ExpiresAt,
+		})
+	}
+}
+
+// handlePendingOperations lists pending operations (?status= to filter), newest first
+func handlePendingOperations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", pendingOpPending, pendingOpApproved, pendingOpRejected, pendingOpExpired:
+	default:
+		http.Error(w, "Invalid 'status' parameter, expected pending, approved, rejected or expired", http.StatusBadRequest)
+		return
+	}
+
+	if err := expirePendingOperations(time.Now()); err != nil {
+		log.Printf("Error expiring pending operations: %v", err)
+	}
+	ops, err := loadPendingOperations(status)
+	if err != nil {
+		log.Printf("Error querying pending operations: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ops)
+}
+
+// handlePendingOperation handles GET /admin/pending-ops/{id} and POST
+// /admin/pending-ops/{id}/approve and /reject. Only an approver key (see
+// approverKeys) other than the requester's may approve.
+func handlePendingOperation(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := parseIDPath(r.URL.Path, "/admin/pending-ops/")
+	if !ok {
+		http.Error(w, "Invalid pending operation ID", http.StatusBadRequest)
+		return
+	}
+	switch {
+	case action == "" && r.Method != http.MethodGet:
+		methodNotAllowed(w, http.MethodGet)
+		return
+	case action == "approve" || action == "reject":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+	case action != "":
+		http.NotFound(w, r)
+		return
+	}
+
+	now := time.Now()
+	p, err := loadPendingOperation(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Pending operation not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying pending operation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if p.Status == pendingOpPending && !now.Before(p.ExpiresAt) {
+		if err := expirePendingOperations(now); err != nil {
+			log.Printf("Error expiring pending operations: %v", err)
+		}
+		p.Status = pendingOpExpired
+	}
+
+	if action == "" {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+		return
+	}
+
+	if p.Status == pendingOpExpired {
+		http.Error(w, "Pending operation expired", http.StatusGone)
+		return
+	}
+	if p.Status != pendingOpPending {
+		http.Error(w, "Pending operation already "+p.Status, http.StatusConflict)
+		return
+	}
+	key := r.Header.Get("X-API-Key")
+	by := apiKeyID(key)
+	if action == "approve" {
+		approvers, err := approverKeys()
+		if err != nil {
+			log.Printf("Error loading approver keys: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !approvers[key] {
+			http.Error(w, "Only admin keys listed in API_KEYS may approve operations", http.StatusForbidden)
+			return
+		}
+		if by == p.RequestedBy {
+			http.Error(w, "The operation must be approved with another admin's API key", http.StatusForbidden)
+			return
+		}
+	}
+
+	// Whoever decides first wins, should two admins answer at once
+	status := pendingOpApproved
+	if action == "reject" {
+		status = pendingOpRejected
+	}
+	decided, err := decidePendingOperation(p.ID, status, by, now)
+	if err != nil {
+		log.Printf("Error deciding pending operation: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !decided {
+		http.Error(w, "Pending operation already decided", http.StatusConflict)
+		return
+	}
+	detail := fmt.Sprintf("op=%d kind=%s path=%s requested_by=%s by=%s", p.ID, p.Kind, p.Path, p.RequestedBy, by)
+
+	if action == "reject" {
+		recordAudit("pending_op.rejected", clientIP(r), detail)
+		p, err = loadPendingOperation(p.ID)
+	} else {
+		recordAudit("pending_op.approved", clientIP(r), detail)
+		logHTTP.infof("Running %s %s approved by key %s", p.Method, p.Path, by)
+		p, err = runPendingOperation(r, p)
+	}
+	if err != nil {
+		log.Printf("Error completing pending operation %d: %v", id, err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
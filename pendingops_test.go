@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Two-Person Approval Tests
+// ============================================================================
+
+// guardedRequest makes a request through twoPersonApprovalMiddleware with an API key
+func guardedRequest(handler http.HandlerFunc, method, path, key string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	req.Header.Set("X-API-Key", key)
+	rr := httptest.NewRecorder()
+	twoPersonApprovalMiddleware(handler)(rr, req)
+	return rr
+}
+
+// decideOperation approves or rejects a pending operation with an API key
+func decideOperation(id int64, action, key string) (*httptest.ResponseRecorder, PendingOperation) {
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/pending-ops/%d/%s", id, action), nil)
+	req.Header.Set("X-API-Key", key)
+	rr := httptest.NewRecorder()
+	handlePendingOperation(rr, req)
+	var p PendingOperation
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	return rr, p
+}
+
+// queuedOperationID returns the pending_id of a 202 response
+func queuedOperationID(t *testing.T, rr *httptest.ResponseRecorder) int64 {
+	t.Helper()
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Status    string `json:"status"`
+		PendingID int64  `json:"pending_id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Status != pendingOpPending || resp.PendingID == 0 {
+		t.Fatalf("expected a pending operation, got %s", rr.Body.String())
+	}
+	return resp.PendingID
+}
+
+func TestLoadTwoPersonApproval(t *testing.T) {
+	t.Setenv("SCANNER_API_KEY", "")
+	t.Setenv("DISCORD_BOT_API_KEY", "")
+	t.Setenv("API_KEYS", "alice-key,kiosk-key:public")
+	t.Setenv("TWO_PERSON_APPROVAL", "")
+	if d, err := loadTwoPersonApproval(); d != 0 || err != nil {
+		t.Errorf("expected approval off, got %v %v", d, err)
+	}
+
+	// A public key cannot approve anything
+	t.Setenv("TWO_PERSON_APPROVAL", "1h")
+	if _, err := loadTwoPersonApproval(); err == nil {
+		t.Error("expected a single admin key rejected")
+	}
+
+	// Device keys and other organizations' keys do not approve either
+	t.Setenv("SCANNER_API_KEY", "scanner-key")
+	t.Setenv("DISCORD_BOT_API_KEY", "bot-key")
+	t.Setenv("API_KEYS", "alice-key,kiosk-key:public,ess-key@ess")
+	if _, err := loadTwoPersonApproval(); err == nil {
+		t.Error("expected device and other organizations' keys not counted")
+	}
+
+	t.Setenv("API_KEYS", "alice-key,bob-key:admin,kiosk-key:public")
+	if d, err := loadTwoPersonApproval(); d != time.Hour || err != nil {
+		t.Errorf("expected 1h, got %v %v", d, err)
+	}
+	t.Setenv("TWO_PERSON_APPROVAL", "soon")
+	if _, err := loadTwoPersonApproval(); err == nil {
+		t.Error("expected an invalid duration rejected")
+	}
+}
+
+func TestTwoPersonApproval_DeleteMember(t *testing.T) {
+	setupTest()
+	twoPersonApproval = time.Hour
+	t.Setenv("SCANNER_API_KEY", "scanner-key")
+	t.Setenv("API_KEYS", "alice-key,bob-key,carol-key,kiosk-key:public")
+
+	// Other routes and methods are not held back
+	if rr := guardedRequest(handleMember, "DELETE", "/members/2/photo", "alice-key"); rr.Code == http.StatusAccepted {
+		t.Errorf("expected only DELETE /members/{id} guarded, got %v", rr.Code)
+	}
+
+	id := queuedOperationID(t, guardedRequest(handleMember, "DELETE", "/members/2", "alice-key"))
+	if _, found := findMemberByID(2); !found {
+		t.Fatal("expected Bob kept until the deletion is approved")
+	}
+
+	// The requester cannot approve their own operation, nor can device or scoped keys
+	if rr, _ := decideOperation(id, "approve", "alice-key"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 approving with the same key, got %v", rr.Code)
+	}
+	for _, key := range []string{"scanner-key", "kiosk-key"} {
+		if rr, _ := decideOperation(id, "approve", key); rr.Code != http.StatusForbidden {
+			t.Errorf("expected 403 approving with %s, got %v", key, rr.Code)
+		}
+	}
+
+	rr, p := decideOperation(id, "approve", "bob-key")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if p.Status != pendingOpApproved || p.ResultStatus != http.StatusOK || p.RequestedBy != apiKeyID("alice-key") || p.DecidedBy != apiKeyID("bob-key") {
+		t.Errorf("unexpected operation %+v", p)
+	}
+	if _, found := findMemberByID(2); found {
+		t.Error("expected Bob deleted once approved")
+	}
+	if rr, _ := decideOperation(id, "approve", "carol-key"); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 approving twice, got %v", rr.Code)
+	}
+
+	for _, action := range []string{"pending_op.requested", "pending_op.approved"} {
+		if entries, _ := loadAuditEntries(action, 10); len(entries) != 1 {
+			t.Errorf("expected %s audited, got %+v", action, entries)
+		}
+	}
+}
+
+func TestTwoPersonApproval_RejectAndExpire(t *testing.T) {
+	setupTest()
+	twoPersonApproval = time.Hour
+	t.Setenv("API_KEYS", "alice-key,bob-key")
+
+	scanCard("TEST_UID_1")
+	rejected := queuedOperationID(t, guardedRequest(handleSignoutAll, "POST", "/sign-out-all", "alice-key"))
+	if rr, p := decideOperation(rejected, "reject", "alice-key"); rr.Code != http.StatusOK || p.Status != pendingOpRejected || p.ResultStatus != 0 {
+		t.Errorf("expected the operation rejected, got %v %+v", rr.Code, p)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
+		t.Error("expected Alice still signed in")
+	}
+
+	expired := queuedOperationID(t, guardedRequest(handleVisits, "DELETE", "/visits?member_id=1", "alice-key"))
+	if err := expirePendingOperations(time.Now().Add(2 * time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if rr, _ := decideOperation(expired, "approve", "bob-key"); rr.Code != http.StatusGone {
+		t.Errorf("expected 410 approving an expired operation, got %v", rr.Code)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/pending-ops?status=expired", nil)
+	rr := httptest.NewRecorder()
+	handlePendingOperations(rr, req)
+	var ops []PendingOperation
+	json.Unmarshal(rr.Body.Bytes(), &ops)
+	if len(ops) != 1 || ops[0].ID != expired || ops[0].Path != "/visits?member_id=1" {
+		t.Errorf("expected the expired purge listed, got %+v", ops)
+	}
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/jpeg" // Registers the JPEG decoder
+	_ "image/png"  // Registers the PNG decoder
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// --- Member Photos ---
+//
+// Members may have a photo, shown by the dashboard and Discord embeds next to
+// their name. POST /members/{id}/photo uploads one as multipart form data
+// (field "photo"), replacing the previous one; GET serves it and DELETE
+// removes it. Photos must be JPEG or PNG images of at most 2 MiB and
+// 2048x2048 pixels, and are validated by decoding them.
+//
+// The images are stored in data/photos/, or in an S3 bucket (or any S3
+// compatible store) when PHOTO_S3_BUCKET is set; the database keeps their
+// metadata. Member records returned by GET /members and /me include a
+// photo_url when the member has a photo.
+
+const (
+	maxPhotoSize      = 2 << 20
+	maxPhotoDimension = 2048
+	photoFormField    = "photo"
+	photosFolder      = dataFolder + "photos/"
+)
+
+// photoContentTypes maps the accepted image formats to their content type and extension
+var photoContentTypes = map[string]struct{ contentType, ext string }{
+	"jpeg": {"image/jpeg", ".jpg"},
+	"png":  {"image/png", ".png"},
+}
+
+// MemberPhoto describes a member's photo (the image itself is not included)
+type MemberPhoto struct {
+	MemberID    int64     `json:"member_id"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	Width       int       `json:"width"`
+	Height      int       `json:"height"`
+	SHA256      string    `json:"sha256"`
+	UploadedAt  time.Time `json:"uploaded_at"`
+	URL         string    `json:"url"`
+
+	key string // Storage key of the image
+}
+
+// photoStorage stores photo images by key
+type photoStorage interface {
+	put(key, contentType string, data []byte) error
+	get(key string) ([]byte, error)
+	remove(key string) error
+}
+
+// activePhotoStorage stores member photos (configured at startup)
+var activePhotoStorage photoStorage = diskPhotoStorage{dir: photosFolder}
+
+// diskPhotoStorage stores photos as files under a folder
+type diskPhotoStorage struct {
+	dir string
+}
+
+func (s diskPhotoStorage) put(key, contentType string, data []byte) error {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	// Written aside and renamed so readers never see half a photo
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func (s diskPhotoStorage) get(key string) ([]byte, error) {
+	return os.ReadFile(filepath.Join(s.dir, filepath.FromSlash(key)))
+}
+
+func (s diskPhotoStorage) remove(key string) error {
+	err := os.Remove(filepath.Join(s.dir, filepath.FromSlash(key)))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// s3PhotoStorage stores photos in an S3 bucket, addressed path-style so S3
+// compatible stores such as MinIO work too. Requests are signed with AWS
+// Signature Version 4.
+type s3PhotoStorage struct {
+	endpoint  string // e.g. https://s3.ca-central-1.amazonaws.com
+	bucket    string
+	prefix    string // Prepended to keys, e.g. office/
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// loadPhotoStorage reads PHOTO_S3_BUCKET, PHOTO_S3_REGION, PHOTO_S3_ENDPOINT,
+// PHOTO_S3_PREFIX, AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, storing photos
+// on disk if no bucket is set
+func loadPhotoStorage() (photoStorage, error) {
+	bucket := strings.TrimSpace(os.Getenv("PHOTO_S3_BUCKET"))
+	if bucket == "" {
+		return diskPhotoStorage{dir: photosFolder}, nil
+	}
+
+	s := s3PhotoStorage{
+		bucket:    bucket,
+		prefix:    strings.TrimPrefix(os.Getenv("PHOTO_S3_PREFIX"), "/"),
+		region:    os.Getenv("PHOTO_S3_REGION"),
+		accessKey: os.Getenv("AWS_ACCESS_KEY_ID"),
+		secretKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		client:    &http.Client{Timeout: 30 * time.Second},
+	}
+	if s.region == "" {
+		s.region = "us-east-1"
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, fmt.Errorf("PHOTO_S3_BUCKET requires AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+
+	s.endpoint = strings.TrimRight(os.Getenv("PHOTO_S3_ENDPOINT"), "/")
+	if s.endpoint == "" {
+		s.endpoint = "https://s3." + s.region + ".amazonaws.com"
+	}
+	u, err := url.Parse(s.endpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid PHOTO_S3_ENDPOINT %q, expected an http(s) URL", s.endpoint)
+	}
+	return s, nil
+}
+
+// objectURL returns the URL of the object of a key
+func (s s3PhotoStorage) objectURL(key string) string {
+	return s.endpoint + "/" + s3Escape(s.bucket) + "/" + s3Escape(s.prefix+key)
+}
+
+// s3Escape escapes an object path as S3 signs it, keeping the slashes
+func s3Escape(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = strings.ReplaceAll(url.PathEscape(segment), "+", "%2B")
+	}
+	return strings.Join(segments, "/")
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of data with key
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// sign adds the AWS Signature Version 4 headers to a request whose body hashes to payloadHash
+func (s s3PhotoStorage) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		"host:" + req.URL.Host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		s.accessKey, scope, signedHeaders, signature))
+}
+
+// do sends a signed request for the object of a key and returns the response body
+func (s s3PhotoStorage) do(method, key, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, s.objectURL(key), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(body)
+	s.sign(req, hex.EncodeToString(sum[:]), time.Now())
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxPhotoSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fs.ErrNotExist
+	}
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("S3 %s %s returned %s", method, key, resp.Status)
+	}
+	return data, nil
+}
+
+func (s s3PhotoStorage) put(key, contentType string, data []byte) error {
+	_, err := s.do(http.MethodPut, key, contentType, data)
+	return err
+}
+
+func (s s3PhotoStorage) get(key string) ([]byte, error) {
+	return s.do(http.MethodGet, key, "", nil)
+}
+
+func (s s3PhotoStorage) remove(key string) error {
+	_, err := s.do(http.MethodDelete, key, "", nil)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// memberPhotoURL returns the URL clients fetch a member's photo from
+func memberPhotoURL(memberID int64) string {
+	return publicPath(fmt.Sprintf("/members/%d/photo", memberID))
+}
+
+// loadMemberPhoto returns the photo of a member, sql.ErrNoRows if it has none
+func loadMemberPhoto(memberID int64) (MemberPhoto, error) {
+	p := MemberPhoto{MemberID: memberID}
+	var uploadedAt string
+	err := db.QueryRow(`SELECT storage_key, content_type, size, width, height, sha256, uploaded_at FROM member_photos WHERE member_id = ?`, memberID).
+		Scan(&p.key, &p.ContentType, &p.Size, &p.Width, &p.Height, &p.SHA256, &uploadedAt)
+	if err != nil {
+		return MemberPhoto{}, err
+	}
+	if p.UploadedAt, err = time.Parse(time.RFC3339, uploadedAt); err != nil {
+		return MemberPhoto{}, err
+	}
+	p.URL = memberPhotoURL(memberID)
+	return p, nil
+}
+
+// withPhotoURL sets the photo URL of a member that has a photo, or the
+// Discord avatar URL of one that does not (see avatars.go)
+func withPhotoURL(m Member) Member {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM member_photos WHERE member_id = ?`, m.ID).Scan(&n); err != nil {
+		log.Printf("Error querying photo of member %d: %v", m.ID, err)
+	}
+	if n > 0 {
+		m.PhotoURL = memberPhotoURL(m.ID)
+	} else {
+		m.AvatarURL = discordAvatars.avatarURL(m.DiscordID)
+	}
+	return m
+}
+
+// decodePhoto validates an uploaded image, returning its format and size
+func decodePhoto(data []byte) (format string, width, height int, err error) {
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", 0, 0, errors.New("Photo must be a JPEG or PNG image")
+	}
+	if _, ok := photoContentTypes[format]; !ok {
+		return "", 0, 0, errors.New("Photo must be a JPEG or PNG image")
+	}
+	if config.Width > maxPhotoDimension || config.Height > maxPhotoDimension {
+		return "", 0, 0, fmt.Errorf("Photo is %dx%d pixels, the limit is %dx%d", config.Width, config.Height, maxPhotoDimension, maxPhotoDimension)
+	}
+	// The header alone does not catch truncated or corrupt images
+	if _, _, err := image.Decode(bytes.NewReader(data)); err != nil {
+		return "", 0, 0, fmt.Errorf("Photo could not be decoded: %v", err)
+	}
+	return format, config.Width, config.Height, nil
+}
+
+// readPhotoUpload reads the image of a multipart upload
+func readPhotoUpload(w http.ResponseWriter, r *http.Request) ([]byte, int, error) {
+	// Room for the multipart headers around the image
+	r.Body = http.MaxBytesReader(w, r.Body, maxPhotoSize+64<<10)
+	file, _, err := r.FormFile(photoFormField)
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("Photo too large, the limit is 2 MiB")
+	} else if err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("Expected multipart form data with a %q file", photoFormField)
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxPhotoSize+1))
+	if err != nil {
+		return nil, http.StatusBadRequest, errors.New("Failed to read photo")
+	}
+	if len(data) > maxPhotoSize {
+		return nil, http.StatusRequestEntityTooLarge, errors.New("Photo too large, the limit is 2 MiB")
+	}
+	return data, 0, nil
+}
+
+// removeMemberPhoto deletes a member's photo and its image, if any
+func removeMemberPhoto(memberID int64) (bool, error) {
+	var key string
+	err := db.QueryRow(`DELETE FROM member_photos WHERE member_id = ? RETURNING storage_key`, memberID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	if err := activePhotoStorage.remove(key); err != nil {
+		log.Printf("Warning: removing photo %s of member %d failed: %v", key, memberID, err)
+	}
+	return true, nil
+}
+
+// handleMemberPhoto handles GET, POST and DELETE /members/{id}/photo
+func handleMemberPhoto(w http.ResponseWriter, r *http.Request, id int64) {
+	member, found := findMemberByID(id)
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		photo, err := loadMemberPhoto(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Member has no photo", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying photo of member %d: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		etag := `"` + photo.SHA256 + `"`
+		w.Header().Set("ETag", etag)
+		w.Header().Set("Cache-Control", "private, no-cache")
+		if r.Header.Get("If-None-Match") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		data, err := activePhotoStorage.get(photo.key)
+		if err != nil {
+			log.Printf("Error reading photo %s of member %d: %v", photo.key, id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", photo.ContentType)
+		w.Header().Set("Content-Length", fmt.Sprint(len(data)))
+		w.Write(data)
+
+	case http.MethodPost:
+		data, status, err := readPhotoUpload(w, r)
+		if err != nil {
+			http.Error(w, err.Error(), status)
+			return
+		}
+		format, width, height, err := decodePhoto(data)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		sum := sha256.Sum256(data)
+		photo := MemberPhoto{
+			MemberID:    id,
+			ContentType: photoContentTypes[format].contentType,
+			Size:        int64(len(data)),
+			Width:       width,
+			Height:      height,
+			SHA256:      hex.EncodeToString(sum[:]),
+			UploadedAt:  time.Now().Truncate(time.Second),
+			URL:         memberPhotoURL(id),
+		}
+		// Each image gets its own key, so a failed upload leaves the previous photo in place
+		photo.key = fmt.Sprintf("members/%d/%s%s", id, photo.SHA256[:16], photoContentTypes[format].ext)
+		if err := activePhotoStorage.put(photo.key, photo.ContentType, data); err != nil {
+			log.Printf("Error storing photo of member %d: %v", id, err)
+			http.Error(w, "Failed to store photo", http.StatusInternalServerError)
+			return
+		}
+
+		var previousKey sql.NullString
+		db.QueryRow(`SELECT storage_key FROM member_photos WHERE member_id = ?`, id).Scan(&previousKey)
+		_, err = db.Exec(`INSERT INTO member_photos (member_id, storage_key, content_type, size, width, height, sha256, uploaded_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+			ON CONFLICT(member_id) DO UPDATE SET storage_key = excluded.storage_key, content_type = excluded.content_type,
+				size = excluded.size, width = excluded.width, height = excluded.height, sha256 = excluded.sha256, uploaded_at = excluded.uploaded_at`,
+			id, photo.key, photo.ContentType, photo.Size, photo.Width, photo.Height, photo.SHA256, photo.UploadedAt.Format(time.RFC3339))
+		if err != nil {
+			log.Printf("Error saving photo of member %d: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if previousKey.Valid && previousKey.String != photo.key {
+			if err := activePhotoStorage.remove(previousKey.String); err != nil {
+				log.Printf("Warning: removing previous photo %s of member %d failed: %v", previousKey.String, id, err)
+			}
+		}
+		recordAudit("member.photo_uploaded", clientIP(r), fmt.Sprintf("Member %s (%d) %s %dx%d", member.Name, id, photo.ContentType, width, height))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(photo)
+
+	case http.MethodDelete:
+		removed, err := removeMemberPhoto(id)
+		if err != nil {
+			log.Printf("Error deleting photo of member %d: %v", id, err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !removed {
+			http.Error(w, "Member has no photo", http.StatusNotFound)
+			return
+		}
+		recordAudit("member.photo_removed", clientIP(r), fmt.Sprintf("Member %s (%d)", member.Name, id))
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost, http.MethodDelete)
+	}
+}
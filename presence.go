@@ -0,0 +1,114 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// --- Public Presence ---
+//
+// GET /presence is the snapshot the branch website polls (every 30 seconds)
+// to show whether the office is open: open or closed, how many people are
+// inside, their initials and when someone last signed in or out. It needs no
+// API key and holds nothing more personal than initials; members of other
+// organizations and members who opted out of notifications or have not
+// consented to being named are counted but not listed. Unlike /current it has no sign-in times or rooms.
+//
+// Responses only change when someone signs in or out, so they are cacheable:
+// shared caches (the website's CDN) may serve them for presenceCacheSeconds
+// and clients revalidate cheaply with If-None-Match.
+
+const presenceCacheSeconds = 15
+
+// Presence is the response of /presence
+type Presence struct {
+	Open       bool       `json:"open"`
+	Count      int        `json:"count"`
+	Initials   []string   `json:"initials"`    // Oldest sign-in first
+	LastChange *time.Time `json:"last_change"` // Last sign-in or sign-out, null if nobody ever signed in
+}
+
+// lastPresenceChange returns the time of the last sign-in or sign-out
+func lastPresenceChange(attendees []attendee) (*time.Time, error) {
+	var last time.Time
+	for _, a := range attendees {
+		if a.SignInTime.After(last) {
+			last = a.SignInTime
+		}
+	}
+
+	var signout sql.NullString
+	if err := db.QueryRow(`SELECT MAX(signout_time) FROM visits`).Scan(&signout); err != nil {
+		return nil, err
+	}
+	if signout.Valid {
+		t, err := time.Parse(time.RFC3339, signout.String)
+		if err != nil {
+			return nil, err
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+
+	if last.IsZero() {
+		return nil, nil
+	}
+	last = last.UTC().Truncate(time.Second)
+	return &last, nil
+}
+
+// buildPresence gathers the presence snapshot
+func buildPresence() (Presence, error) {
+	attendees := currentAttendees.list()
+	sort.Slice(attendees, func(i, j int) bool { return attendees[i].SignInTime.Before(attendees[j].SignInTime) })
+
+	presence := Presence{Open: len(attendees) > 0, Count: len(attendees), Initials: []string{}}
+	for _, a := range attendees {
+		member, _ := memberCache.get(a.UID)
+		if member.ID == 0 || memberOrg(member) != defaultOrg || !nameable(member.ID) {
+			continue
+		}
+		if name := publicName(member, scopeMember); name != "" {
+			presence.Initials = append(presence.Initials, name)
+		}
+	}
+
+	var err error
+	presence.LastChange, err = lastPresenceChange(attendees)
+	return presence, err
+}
+
+// handlePresence serves the public presence snapshot
+func handlePresence(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	resp, err := renderedResponses.render("presence", time.Now(), func() (any, error) {
+		return buildPresence()
+	})
+	if err != nil {
+		log.Printf("Error building presence: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d", presenceCacheSeconds, 2*presenceCacheSeconds))
+	w.Header().Set("ETag", resp.etag)
+	if lastChange := resp.value.(Presence).LastChange; lastChange != nil {
+		w.Header().Set("Last-Modified", lastChange.Format(http.TimeFormat))
+	}
+	if r.Header.Get("If-None-Match") == resp.etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(resp.body)
+}
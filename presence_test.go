@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Public Presence Tests
+// ============================================================================
+
+// getPresence requests /presence, optionally revalidating an ETag
+func getPresence(t *testing.T, etag string) (*httptest.ResponseRecorder, Presence) {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/presence", nil)
+	if etag != "" {
+		req.Header.Set("If-None-Match", etag)
+	}
+	rr := httptest.NewRecorder()
+	handlePresence(rr, req)
+
+	var p Presence
+	if rr.Code == http.StatusOK {
+		if err := json.Unmarshal(rr.Body.Bytes(), &p); err != nil {
+			t.Fatalf("failed to parse presence: %v; body=%s", err, rr.Body.String())
+		}
+	}
+	return rr, p
+}
+
+func TestPresence(t *testing.T) {
+	setupTest()
+
+	rr, p := getPresence(t, "")
+	if rr.Code != http.StatusOK || p.Open || p.Count != 0 || len(p.Initials) != 0 || p.LastChange != nil {
+		t.Fatalf("expected the office closed and never used, got %v %+v", rr.Code, p)
+	}
+	if rr.Header().Get("Cache-Control") != "public, max-age=15, stale-while-revalidate=30" {
+		t.Errorf("unexpected Cache-Control %q", rr.Header().Get("Cache-Control"))
+	}
+
+	memberCache.put(Member{ID: 1, Name: "Alice Liddell", UID: "TEST_UID_1", DiscordID: "111111111"})
+	scanCard("TEST_UID_1")
+	scanCard("TEST_UID_2")
+	rr, p = getPresence(t, "")
+	if !p.Open || p.Count != 2 || len(p.Initials) != 2 || p.Initials[0] != "A.L." || p.Initials[1] != "B." {
+		t.Errorf("expected Alice and Bob inside, got %+v", p)
+	}
+	if p.LastChange == nil || time.Since(*p.LastChange) > time.Minute {
+		t.Errorf("expected a recent last change, got %v", p.LastChange)
+	}
+	if rr.Header().Get("Last-Modified") == "" {
+		t.Error("expected a Last-Modified header")
+	}
+
+	// Unchanged snapshots are not sent again
+	etag := rr.Header().Get("ETag")
+	if rr, _ := getPresence(t, etag); rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 Not Modified, got %v", rr.Code)
+	}
+
+	// Members who opted out are counted but not listed
+	req, _ := http.NewRequest("PUT", "/members/2/notifications", bytes.NewBufferString(`{"opt_out":true}`))
+	handleMember(httptest.NewRecorder(), req)
+	rr, p = getPresence(t, etag)
+	if rr.Code != http.StatusOK || p.Count != 2 || len(p.Initials) != 1 || p.Initials[0] != "A.L." {
+		t.Errorf("expected Bob left out, got %v %+v", rr.Code, p)
+	}
+
+	// The last sign-out is the last change once everyone left
+	scanCard("TEST_UID_1")
+	scanCard("TEST_UID_2")
+	if _, p = getPresence(t, ""); p.Open || p.Count != 0 || p.LastChange == nil {
+		t.Errorf("expected the office closed after a recent sign-out, got %+v", p)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// --- Display Names and Visibility ---
+//
+// Members choose how they appear on public-facing endpoints and in
+// notifications: under a display alias instead of their name, and with a
+// visibility of full (the default), initials or hidden. This applies
+// wherever members are named outside the admin view:
+//   - non-admin views of /current, /visits and /stats/live, the wall display
+//     and kiosks, /presence, /status/stream and /events/poll
+//   - the office speaker's announcements and webhook (Discord) messages
+//
+// Non-admin views still show initials only (see views.go), so there full and
+// initials look the same; in notifications full shows the whole alias or
+// name. Hidden members are counted but never named, like members who opted
+// out of notifications. The admin view always shows the member's name.
+
+// Visibilities of a member on public-facing endpoints and notifications
+const (
+	visibilityFull     = "full"
+	visibilityInitials = "initials"
+	visibilityHidden   = "hidden"
+)
+
+// maxAliasLength is the longest display alias, in characters
+const maxAliasLength = 32
+
+// PrivacyPreferences is how a member appears outside the admin view
+type PrivacyPreferences struct {
+	MemberID   int64  `json:"member_id"`
+	Alias      string `json:"alias"`      // Shown instead of the name, empty for none
+	Visibility string `json:"visibility"` // full, initials or hidden
+}
+
+// displayName returns the name a member goes by: their alias if they have
+// one, empty if they are hidden
+func (p PrivacyPreferences) displayName(name string) string {
+	if p.Visibility == visibilityHidden {
+		return ""
+	}
+	if p.Alias != "" {
+		return p.Alias
+	}
+	return name
+}
+
+// normalizeVisibility validates a visibility, defaulting to full
+func normalizeVisibility(visibility string) (string, bool) {
+	switch visibility = strings.ToLower(strings.TrimSpace(visibility)); visibility {
+	case "":
+		return visibilityFull, true
+	case visibilityFull, visibilityInitials, visibilityHidden:
+		return visibility, true
+	}
+	return "", false
+}
+
+// validAlias reports whether an alias is short and printable
+func validAlias(alias string) bool {
+	if utf8.RuneCountInString(alias) > maxAliasLength {
+		return false
+	}
+	for _, r := range alias {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// privacyOf returns a member's privacy preferences, full visibility under
+// their name if they have none
+func privacyOf(memberID int64) PrivacyPreferences {
+	p := PrivacyPreferences{MemberID: memberID, Visibility: visibilityFull}
+	err := db.QueryRow(`SELECT alias, visibility FROM member_privacy WHERE member_id = ?`, memberID).Scan(&p.Alias, &p.Visibility)
+	if err != nil && err != sql.ErrNoRows {
+		// Not naming someone is the safe side
+		log.Printf("Error querying privacy preferences of member %d: %v", memberID, err)
+		p.Visibility = visibilityHidden
+	}
+	return p
+}
+
+// notificationName returns the name a member goes by in notifications, empty
+// if they may not be named
+func notificationName(member Member) string {
+	if !nameable(member.ID) {
+		return ""
+	}
+	p := privacyOf(member.ID)
+	if p.Visibility == visibilityInitials {
+		return initials(p.displayName(member.Name))
+	}
+	return p.displayName(member.Name)
+}
+
+// writePrivacyPreferences saves the preferences of a PUT and responds with
+// the member's privacy preferences
+func writePrivacyPreferences(w http.ResponseWriter, r *http.Request, member Member) {
+	if r.Method == http.MethodPut {
+		var req PrivacyPreferences
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		req.Alias = strings.TrimSpace(req.Alias)
+		if !validAlias(req.Alias) {
+			http.Error(w, fmt.Sprintf("Invalid 'alias', expected at most %d printable characters", maxAliasLength), http.StatusBadRequest)
+			return
+		}
+		visibility, ok := normalizeVisibility(req.Visibility)
+		if !ok {
+			http.Error(w, "Invalid 'visibility', expected full, initials or hidden", http.StatusBadRequest)
+			return
+		}
+
+		_, err := db.Exec(`INSERT INTO member_privacy (member_id, alias, visibility, updated_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT(member_id) DO UPDATE SET alias = excluded.alias, visibility = excluded.visibility, updated_at = excluded.updated_at`,
+			member.ID, req.Alias, visibility, time.Now().Format(time.RFC3339))
+		if err != nil {
+			log.Printf("Error saving privacy preferences: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		renderedResponses.invalidate()
+		recordAudit("member.privacy_changed", clientIP(r), fmt.Sprintf("Member %s (%d) alias=%q visibility=%s", member.Name, member.ID, req.Alias, visibility))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(privacyOf(member.ID))
+}
+
+// handleMemberPrivacy handles GET and PUT /members/{id}/privacy
+func handleMemberPrivacy(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	member, found := findMemberByID(id)
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	writePrivacyPreferences(w, r, member)
+}
+
+// handleMePrivacy handles GET and PUT of the calling member's privacy preferences
+func handleMePrivacy(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+
+	member, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+	writePrivacyPreferences(w, r, member)
+}
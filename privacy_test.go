@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Display Name and Visibility Tests
+// ============================================================================
+
+func TestMemberPrivacy(t *testing.T) {
+	setupTest()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown visibility", `{"visibility":"secret"}`, http.StatusBadRequest},
+		{"alias too long", `{"alias":"` + strings.Repeat("x", maxAliasLength+1) + `"}`, http.StatusBadRequest},
+		{"alias with control characters", `{"alias":"A\u0007ce"}`, http.StatusBadRequest},
+		{"alias trimmed", `{"alias":" Ace\n"}`, http.StatusOK},
+		{"alias shown in initials", `{"alias":"Ace Ventura","visibility":"initials"}`, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if rr := memberRequest("PUT", "/members/1/privacy", tt.body); rr.Code != tt.want {
+			t.Errorf("%s: expected %v, got %v; body=%s", tt.name, tt.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	var details MemberDetails
+	json.Unmarshal(memberRequest("GET", "/members/1", "").Body.Bytes(), &details)
+	if details.Privacy.Alias != "Ace Ventura" || details.Privacy.Visibility != visibilityInitials {
+		t.Fatalf("expected the preferences on the member record, got %+v", details.Privacy)
+	}
+
+	alice, _ := findMemberByID(1)
+	if name := notificationName(alice); name != "A.V." {
+		t.Errorf("expected the alias's initials in notifications, got %q", name)
+	}
+	if name := publicName(alice, scopeAdmin); name != "Alice" {
+		t.Errorf("expected the admin view to show the name, got %q", name)
+	}
+
+	memberRequest("PUT", "/members/1/privacy", `{"alias":"Ace Ventura","visibility":"full"}`)
+	if name := notificationName(alice); name != "Ace Ventura" {
+		t.Errorf("expected the whole alias in notifications, got %q", name)
+	}
+	if name := publicName(alice, scopeMember); name != "A.V." {
+		t.Errorf("expected the member view to show the alias's initials, got %q", name)
+	}
+
+	if entries, _ := loadAuditEntries("member.privacy_changed", 10); len(entries) != 3 {
+		t.Errorf("expected each change audited, got %+v", entries)
+	}
+}
+
+func TestMemberPrivacy_Hidden(t *testing.T) {
+	setupTest()
+
+	// Bob hides from public-facing views through the Discord bot
+	req, _ := http.NewRequest("PUT", "/me/privacy", bytes.NewBufferString(`{"visibility":"hidden"}`))
+	req.Header.Set(discordIDHeader, "222222222")
+	rr := httptest.NewRecorder()
+	handleMePrivacy(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-10*time.Minute))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-5*time.Minute))
+
+	if names := currentNames(t, scopeMember); len(names) != 2 || names[1] != "A." || names[2] != "" {
+		t.Errorf("expected Bob counted but not named, got %v", names)
+	}
+	if names := currentNames(t, scopeAdmin); names[2] != "Bob" {
+		t.Errorf("expected the admin view unchanged, got %v", names)
+	}
+
+	presence, err := buildPresence()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if presence.Count != 2 || len(presence.Initials) != 1 || presence.Initials[0] != "A." {
+		t.Errorf("expected only Alice's initials on /presence, got %+v", presence)
+	}
+
+	bob, _ := findMemberByID(2)
+	if name := notificationName(bob); name != "" {
+		t.Errorf("expected Bob left out of notifications, got %q", name)
+	}
+}
@@ -0,0 +1,549 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Projects ---
+//
+// Projects (e.g. a robotics team's rover) collect the time members spend on
+// them, for teams that report lab hours to sponsors or to the co-curricular
+// record (see ccrexport.go). Members allocate a
+// completed session, or part of it, to one or more projects with
+// POST /sessions/{id}/allocate (through the bot, with X-Discord-ID), and
+// /projects/{id}/hours reports the allocated time per member. Archived
+// projects keep their hours but take no new allocations.
+
+// Project is something members allocate session time to
+type Project struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	Archived    bool      `json:"archived"`
+	CCRCode     string    `json:"ccr_code"` // Co-curricular record activity code, if any
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// projectColumns is the column list scanned by scanProject
+const projectColumns = `id, name, description, archived, ccr_code, created_at`
+
+// scanProject reads a project row selected with projectColumns
+func scanProject(row rowScanner) (Project, error) {
+	var p Project
+	var createdAt string
+	if err := row.Scan(&p.ID, &p.Name, &p.Description, &p.Archived, &p.CCRCode, &createdAt); err != nil {
+		return Project{}, err
+	}
+
+	var err error
+	if p.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+		return Project{}, err
+	}
+	return p, nil
+}
+
+// loadProject fetches a single project by ID
+func loadProject(id int64) (Project, error) {
+	return scanProject(db.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE id = ?`, id))
+}
+
+// loadProjectByName fetches a single project by name
+func loadProjectByName(name string) (Project, error) {
+	return scanProject(db.QueryRow(`SELECT `+projectColumns+` FROM projects WHERE name = ?`, name))
+}
+
+// loadProjects returns projects ordered by name, including archived ones if asked
+func loadProjects(includeArchived bool) ([]Project, error) {
+	query := `SELECT ` + projectColumns + ` FROM projects`
+	if !includeArchived {
+		query += ` WHERE archived = 0`
+	}
+	rows, err := db.Query(query + ` ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	projects := []Project{}
+	for rows.Next() {
+		p, err := scanProject(rows)
+		if err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+// decodeProject reads and validates a project payload
+func decodeProject(w http.ResponseWriter, r *http.Request) (Project, bool) {
+	var req Project
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return Project{}, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Description = strings.TrimSpace(req.Description)
+	req.CCRCode = strings.ToUpper(strings.TrimSpace(req.CCRCode))
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return Project{}, false
+	}
+	if !validCCRCode(req.CCRCode) {
+		http.Error(w, "ccr_code may only hold letters, digits and dashes, up to 32 characters", http.StatusBadRequest)
+		return Project{}, false
+	}
+	return req, true
+}
+
+// handleProjects supports GET to list projects (?archived=true to include
+// archived ones) and POST to create a project
+func handleProjects(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		projects, err := loadProjects(r.URL.Query().Get("archived") == "true")
+		if err != nil {
+			log.Printf("Error querying projects: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(projects)
+
+	case http.MethodPost:
+		req, ok := decodeProject(w, r)
+		if !ok {
+			return
+		}
+
+		req.CreatedAt = time.Now().Truncate(time.Second)
+		res, err := db.Exec(`INSERT INTO projects (name, description, archived, ccr_code, created_at) VALUES (?, ?, ?, ?, ?)`,
+			req.Name, req.Description, req.Archived, req.CCRCode, req.CreatedAt.Format(time.RFC3339))
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Project name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error inserting project: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		req.ID, _ = res.LastInsertId()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleProject handles /projects/{id} (GET, PUT, DELETE) and /projects/{id}/hours
+func handleProject(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/projects/")
+	if !ok {
+		http.Error(w, "Invalid project ID", http.StatusBadRequest)
+		return
+	}
+	if sub == "hours" {
+		handleProjectHours(w, r, id)
+		return
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		p, err := loadProject(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying project: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(p)
+
+	case http.MethodPut:
+		req, ok := decodeProject(w, r)
+		if !ok {
+			return
+		}
+
+		result, err := db.Exec(`UPDATE projects SET name = ?, description = ?, archived = ?, ccr_code = ? WHERE id = ?`,
+			req.Name, req.Description, req.Archived, req.CCRCode, id)
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Project name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error updating project: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+
+		updated, err := loadProject(id)
+		if err != nil {
+			log.Printf("Error loading updated project: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(updated)
+
+	case http.MethodDelete:
+		// Hours reported to sponsors must not disappear with the project
+		var allocated bool
+		if err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM session_allocations WHERE project_id = ?)`, id).Scan(&allocated); err != nil {
+			log.Printf("Error checking project allocations: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if allocated {
+			http.Error(w, "Project has allocated hours, archive it instead", http.StatusConflict)
+			return
+		}
+
+		result, err := db.Exec(`DELETE FROM projects WHERE id = ?`, id)
+		if err != nil {
+			log.Printf("Error deleting project: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Project not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Project deleted successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// --- Session Allocations ---
+
+// Allocation is time of a session allocated to a project
+type Allocation struct {
+	ProjectID int64  `json:"project_id"`
+	Project   string `json:"project"`
+	Seconds   int64  `json:"seconds"`
+}
+
+// SessionAllocations is a session with the time allocated from it
+type SessionAllocations struct {
+	SessionID   int64        `json:"session_id"`
+	MemberID    int64        `json:"member_id"`
+	SignInTime  time.Time    `json:"signin_time"`
+	SignOutTime time.Time    `json:"signout_time"`
+	Seconds     int64        `json:"seconds"`
+	Unallocated int64        `json:"unallocated_seconds"`
+	Allocations []Allocation `json:"allocations"`
+}
+
+// AllocateRequest is the payload of POST /sessions/{id}/allocate
+type AllocateRequest struct {
+	ProjectID int64  `json:"project_id,omitempty"`
+	Project   string `json:"project,omitempty"` // Project name, instead of project_id
+	Seconds   *int64 `json:"seconds,omitempty"` // Defaults to the unallocated rest of the session; 0 removes the allocation
+}
+
+// loadSessionAllocations fetches a session, with its corrected times, and the
+// time allocated from it
+func loadSessionAllocations(visitID int64) (SessionAllocations, error) {
+	var s SessionAllocations
+	var signinTime, signoutTime string
+	err := db.QueryRow(`SELECT id, member_id, signin_time, signout_time FROM `+correctedVisits+` v WHERE id = ?`, visitID).
+		Scan(&s.SessionID, &s.MemberID, &signinTime, &signoutTime)
+	if err != nil {
+		return SessionAllocations{}, err
+	}
+	if s.SignInTime, err = time.Parse(time.RFC3339, signinTime); err != nil {
+		return SessionAllocations{}, err
+	}
+	if s.SignOutTime, err = time.Parse(time.RFC3339, signoutTime); err != nil {
+		return SessionAllocations{}, err
+	}
+	s.Seconds = int64(s.SignOutTime.Sub(s.SignInTime).Seconds())
+
+	rows, err := db.Query(`
+		SELECT a.project_id, p.name, a.seconds
+		FROM session_allocations a
+		JOIN projects p ON p.id = a.project_id
+		WHERE a.visit_id = ?
+		ORDER BY p.name`, visitID)
+	if err != nil {
+		return SessionAllocations{}, err
+	}
+	defer rows.Close()
+
+	s.Allocations = []Allocation{}
+	s.Unallocated = s.Seconds
+	for rows.Next() {
+		var a Allocation
+		if err := rows.Scan(&a.ProjectID, &a.Project, &a.Seconds); err != nil {
+			return SessionAllocations{}, err
+		}
+		s.Allocations = append(s.Allocations, a)
+		s.Unallocated -= a.Seconds
+	}
+	return s, rows.Err()
+}
+
+// allocated returns the seconds of the session allocated to a project
+func (s SessionAllocations) allocated(projectID int64) int64 {
+	for _, a := range s.Allocations {
+		if a.ProjectID == projectID {
+			return a.Seconds
+		}
+	}
+	return 0
+}
+
+// projectFromAllocateRequest resolves the project named by an allocation,
+// writing an error response if it is missing, unknown or archived
+func projectFromAllocateRequest(w http.ResponseWriter, req AllocateRequest) (Project, bool) {
+	var p Project
+	var err error
+	switch {
+	case req.ProjectID > 0:
+		p, err = loadProject(req.ProjectID)
+	case strings.TrimSpace(req.Project) != "":
+		p, err = loadProjectByName(strings.TrimSpace(req.Project))
+	default:
+		http.Error(w, "project_id or project is required", http.StatusBadRequest)
+		return Project{}, false
+	}
+	if err == sql.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return Project{}, false
+	} else if err != nil {
+		log.Printf("Error querying project: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return Project{}, false
+	}
+	if p.Archived {
+		http.Error(w, "Project is archived", http.StatusConflict)
+		return Project{}, false
+	}
+	return p, true
+}
+
+// handleSession handles /sessions/{id}/allocate: GET shows the session's
+// allocations and POST allocates time to a project. With X-Discord-ID the
+// session must be the caller's own. /sessions/{id}/amendments is handled by
+// handleSessionAmendments.
+func handleSession(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/sessions/")
+	if !ok {
+		http.Error(w, "Invalid session ID", http.StatusBadRequest)
+		return
+	}
+	if sub == "amendments" {
+		handleSessionAmendments(w, r, id)
+		return
+	}
+	if sub != "allocate" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+
+	session, err := loadSessionAllocations(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if r.Header.Get(discordIDHeader) != "" {
+		member, ok := memberFromRequest(w, r)
+		if !ok {
+			return
+		}
+		if member.ID != session.MemberID {
+			http.Error(w, "Session belongs to another member", http.StatusForbidden)
+			return
+		}
+	}
+
+	if r.Method == http.MethodPost {
+		var req AllocateRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid JSON", http.StatusBadRequest)
+			return
+		}
+		project, ok := projectFromAllocateRequest(w, req)
+		if !ok {
+			return
+		}
+
+		// Time already allocated to this project is being replaced
+		available := session.Unallocated + session.allocated(project.ID)
+		seconds := available
+		if req.Seconds != nil {
+			seconds = *req.Seconds
+		}
+		if seconds < 0 || seconds > available {
+			http.Error(w, "seconds must be between 0 and the session's unallocated time", http.StatusBadRequest)
+			return
+		}
+
+		if seconds == 0 {
+			_, err = db.Exec(`DELETE FROM session_allocations WHERE visit_id = ? AND project_id = ?`, id, project.ID)
+		} else {
+			_, err = db.Exec(`INSERT INTO session_allocations (visit_id, project_id, seconds) VALUES (?, ?, ?)
+				ON CONFLICT(visit_id, project_id) DO UPDATE SET seconds = excluded.seconds`, id, project.ID, seconds)
+		}
+		if isForeignKeyViolation(err) {
+			// The session or project was deleted meanwhile
+			http.Error(w, "Session or project not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error saving allocation: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		if session, err = loadSessionAllocations(id); err != nil {
+			log.Printf("Error loading session allocations: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+// --- Project Hours ---
+
+// ProjectMemberHours is one member's time on a project
+type ProjectMemberHours struct {
+	MemberID     int64   `json:"member_id"`
+	Name         string  `json:"name"`
+	Sessions     int     `json:"sessions"`
+	TotalSeconds int64   `json:"total_seconds"`
+	Hours        float64 `json:"hours"`
+}
+
+// ProjectHours is the /projects/{id}/hours response
+type ProjectHours struct {
+	Project      Project              `json:"project"`
+	Term         string               `json:"term,omitempty"`
+	From         *time.Time           `json:"from,omitempty"`
+	To           *time.Time           `json:"to,omitempty"`
+	TotalSeconds int64                `json:"total_seconds"`
+	Hours        float64              `json:"hours"`
+	Members      []ProjectMemberHours `json:"members"`
+}
+
+// loadProjectMemberHours sums a project's allocations per member, keeping
+// sessions that started within [from, to] (zero bounds are open), most hours first
+func loadProjectMemberHours(projectID int64, from, to time.Time) ([]ProjectMemberHours, error) {
+	query := `
+		SELECT m.id, m.name, COUNT(*), SUM(a.seconds)
+		FROM session_allocations a
+		JOIN visits v ON v.id = a.visit_id
+		JOIN members m ON m.id = v.member_id
+		WHERE a.project_id = ?`
+	args := []interface{}{projectID}
+	if !from.IsZero() {
+		query += " AND julianday(v.signin_time) >= julianday(?)"
+		args = append(args, from.Format(time.RFC3339))
+	}
+	if !to.IsZero() {
+		query += " AND julianday(v.signin_time) <= julianday(?)"
+		args = append(args, to.Format(time.RFC3339))
+	}
+	query += " GROUP BY m.id ORDER BY 4 DESC, m.name"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ProjectMemberHours{}
+	for rows.Next() {
+		var h ProjectMemberHours
+		if err := rows.Scan(&h.MemberID, &h.Name, &h.Sessions, &h.TotalSeconds); err != nil {
+			return nil, err
+		}
+		h.Hours = float64(h.TotalSeconds) / 3600
+		members = append(members, h)
+	}
+	return members, rows.Err()
+}
+
+// handleProjectHours reports the time allocated to a project per member
+// Query parameters:
+//   - term: term name, or "all" (defaults to the current term if one is defined)
+//   - from: RFC3339 formatted start date
+//   - to: RFC3339 formatted end date
+func handleProjectHours(w http.ResponseWriter, r *http.Request, id int64) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	project, err := loadProject(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Project not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying project: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	from, to, termName, ok := parseReportRange(w, r)
+	if !ok {
+		return
+	}
+
+	members, err := loadProjectMemberHours(id, from, to)
+	if err != nil {
+		log.Printf("Error summing project hours: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	resp := ProjectHours{Project: project, Term: termName, Members: members}
+	if !from.IsZero() {
+		resp.From = &from
+	}
+	if !to.IsZero() {
+		resp.To = &to
+	}
+	for _, m := range members {
+		resp.TotalSeconds += m.TotalSeconds
+	}
+	resp.Hours = float64(resp.TotalSeconds) / 3600
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
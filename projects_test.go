@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Project Tests
+// ============================================================================
+
+// createProject creates a project through the API and returns it
+func createProject(t *testing.T, name string) Project {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/projects", bytes.NewBufferString(`{"name":"`+name+`","description":"Sponsored"}`))
+	rr := httptest.NewRecorder()
+	handleProjects(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var p Project
+	json.Unmarshal(rr.Body.Bytes(), &p)
+	return p
+}
+
+// insertSession records a finished session of a member lasting d, ending an hour ago
+func insertSession(t *testing.T, memberID int64, d time.Duration) int64 {
+	t.Helper()
+
+	end := time.Now().Add(-time.Hour).Truncate(time.Second)
+	res, err := db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`,
+		memberID, end.Add(-d).Format(time.RFC3339), end.Format(time.RFC3339))
+	if err != nil {
+		t.Fatalf("failed to insert session: %v", err)
+	}
+	id, _ := res.LastInsertId()
+	return id
+}
+
+// allocateSession calls POST /sessions/{id}/allocate as the member with a Discord ID
+func allocateSession(sessionID int64, discordID, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/sessions/"+strconv.FormatInt(sessionID, 10)+"/allocate", bytes.NewBufferString(body))
+	if discordID != "" {
+		req.Header.Set("X-Discord-ID", discordID)
+	}
+	rr := httptest.NewRecorder()
+	handleSession(rr, req)
+	return rr
+}
+
+func TestHandleProjects_CRUD(t *testing.T) {
+	setupTest()
+
+	p := createProject(t, "Rover")
+	if p.ID == 0 || p.Name != "Rover" || p.Archived {
+		t.Fatalf("unexpected project: %+v", p)
+	}
+
+	req, _ := http.NewRequest("POST", "/projects", bytes.NewBufferString(`{"name":"Rover"}`))
+	rr := httptest.NewRecorder()
+	handleProjects(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a duplicate name, got %v", rr.Code)
+	}
+
+	// Archived projects are hidden unless asked for
+	req, _ = http.NewRequest("PUT", "/projects/"+strconv.FormatInt(p.ID, 10), bytes.NewBufferString(`{"name":"Rover","archived":true}`))
+	rr = httptest.NewRecorder()
+	handleProject(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var projects []Project
+	req, _ = http.NewRequest("GET", "/projects", nil)
+	rr = httptest.NewRecorder()
+	handleProjects(rr, req)
+	json.Unmarshal(rr.Body.Bytes(), &projects)
+	if len(projects) != 0 {
+		t.Errorf("expected no active projects, got %+v", projects)
+	}
+
+	req, _ = http.NewRequest("GET", "/projects?archived=true", nil)
+	rr = httptest.NewRecorder()
+	handleProjects(rr, req)
+	json.Unmarshal(rr.Body.Bytes(), &projects)
+	if len(projects) != 1 || !projects[0].Archived {
+		t.Errorf("expected the archived project, got %+v", projects)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/projects/"+strconv.FormatInt(p.ID, 10), nil)
+	rr = httptest.NewRecorder()
+	handleProject(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK, got %v", rr.Code)
+	}
+}
+
+func TestHandleSession_Allocate(t *testing.T) {
+	setupTest()
+	rover := createProject(t, "Rover")
+	arm := createProject(t, "Arm")
+	session := insertSession(t, 1, 3*time.Hour)
+
+	rr := allocateSession(session, "111111111", `{"project":"Rover","seconds":3600}`)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	// Without seconds, the rest of the session goes to the project
+	rr = allocateSession(session, "111111111", `{"project_id":`+strconv.FormatInt(arm.ID, 10)+`}`)
+	var s SessionAllocations
+	json.Unmarshal(rr.Body.Bytes(), &s)
+	if s.Seconds != 10800 || s.Unallocated != 0 || s.allocated(rover.ID) != 3600 || s.allocated(arm.ID) != 7200 {
+		t.Fatalf("unexpected allocations: %+v", s)
+	}
+
+	if rr := allocateSession(session, "111111111", `{"project":"Rover","seconds":3601}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 beyond the session's length, got %v", rr.Code)
+	}
+
+	// Zero seconds frees the time again
+	rr = allocateSession(session, "111111111", `{"project":"Rover","seconds":0}`)
+	json.Unmarshal(rr.Body.Bytes(), &s)
+	if len(s.Allocations) != 1 || s.Unallocated != 3600 {
+		t.Errorf("expected Rover's allocation removed, got %+v", s)
+	}
+}
+
+func TestHandleSession_AllocateRestrictions(t *testing.T) {
+	setupTest()
+	createProject(t, "Rover")
+	session := insertSession(t, 1, time.Hour)
+
+	if rr := allocateSession(session, "222222222", `{"project":"Rover"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for another member's session, got %v", rr.Code)
+	}
+	if rr := allocateSession(session, "111111111", `{"project":"Drone"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown project, got %v", rr.Code)
+	}
+	if rr := allocateSession(session+1, "111111111", `{"project":"Rover"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %v", rr.Code)
+	}
+
+	db.Exec(`UPDATE projects SET archived = 1`)
+	if rr := allocateSession(session, "111111111", `{"project":"Rover"}`); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for an archived project, got %v", rr.Code)
+	}
+}
+
+func TestHandleProject_DeleteWithHours(t *testing.T) {
+	setupTest()
+	p := createProject(t, "Rover")
+	allocateSession(insertSession(t, 1, time.Hour), "", `{"project":"Rover"}`)
+
+	req, _ := http.NewRequest("DELETE", "/projects/"+strconv.FormatInt(p.ID, 10), nil)
+	rr := httptest.NewRecorder()
+	handleProject(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a project with hours, got %v", rr.Code)
+	}
+}
+
+func TestHandleProject_Hours(t *testing.T) {
+	setupTest()
+	p := createProject(t, "Rover")
+	allocateSession(insertSession(t, 1, 2*time.Hour), "", `{"project":"Rover"}`)
+	allocateSession(insertSession(t, 1, time.Hour), "", `{"project":"Rover","seconds":1800}`)
+	allocateSession(insertSession(t, 2, time.Hour), "", `{"project":"Rover"}`)
+
+	req, _ := http.NewRequest("GET", "/projects/"+strconv.FormatInt(p.ID, 10)+"/hours?term=all", nil)
+	rr := httptest.NewRecorder()
+	handleProject(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var hours ProjectHours
+	json.Unmarshal(rr.Body.Bytes(), &hours)
+	if hours.TotalSeconds != 12600 || hours.Hours != 3.5 || len(hours.Members) != 2 {
+		t.Fatalf("unexpected hours: %+v", hours)
+	}
+	if m := hours.Members[0]; m.Name != "Alice" || m.Sessions != 2 || m.TotalSeconds != 9000 {
+		t.Errorf("expected Alice first with 2.5 hours, got %+v", m)
+	}
+
+	// Sessions outside the range are left out
+	from := time.Now().Format(time.RFC3339)
+	req, _ = http.NewRequest("GET", "/projects/"+strconv.FormatInt(p.ID, 10)+"/hours?from="+url.QueryEscape(from), nil)
+	rr = httptest.NewRecorder()
+	handleProject(rr, req)
+	json.Unmarshal(rr.Body.Bytes(), &hours)
+	if hours.TotalSeconds != 0 || len(hours.Members) != 0 {
+		t.Errorf("expected no hours from now on, got %+v", hours)
+	}
+}
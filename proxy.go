@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// --- Reverse Proxy ---
+//
+// Behind a reverse proxy such as the branch website's nginx, every request
+// comes from the proxy's address. TRUSTED_PROXIES lists the proxies (CIDRs,
+// bare IPs, and unix for requests over a Unix socket listener, separated by
+// commas) whose X-Forwarded-For header is believed: the client IP is then the
+// rightmost address of the header that is not itself a trusted proxy, so a
+// client cannot pass another IP by sending the header itself. The client IP
+// is what logs, the audit log, network policies and brute-force lockouts see.
+//
+// BASE_PATH serves the API under a URL prefix, such as /attendance when
+// nginx forwards https://ieee.example/attendance/ without stripping it. The
+// prefix is removed before routing, and links in responses (firmware URLs)
+// include it. Requests without the prefix are still served, for health
+// checks and proxies that strip it.
+
+// trustedProxyConfig holds the parsed TRUSTED_PROXIES
+type trustedProxyConfig struct {
+	Networks []*net.IPNet
+	Unix     bool // Requests over Unix socket listeners come from a trusted proxy
+}
+
+var (
+	// trustedProxies are the proxies whose X-Forwarded-For is believed (loaded at startup)
+	trustedProxies trustedProxyConfig
+
+	// basePath is the URL prefix the API is served under, "" for none (loaded at startup)
+	basePath string
+)
+
+// parseTrustedProxies parses a TRUSTED_PROXIES value
+func parseTrustedProxies(value string) (trustedProxyConfig, error) {
+	var cfg trustedProxyConfig
+	for _, entry := range strings.Split(value, ",") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+		if entry == "unix" {
+			cfg.Unix = true
+			continue
+		}
+		network, err := parseNetwork(entry)
+		if err != nil {
+			return trustedProxyConfig{}, fmt.Errorf("invalid proxy %q: %w", entry, err)
+		}
+		cfg.Networks = append(cfg.Networks, network)
+	}
+	return cfg, nil
+}
+
+// loadTrustedProxies reads TRUSTED_PROXIES
+func loadTrustedProxies() (trustedProxyConfig, error) {
+	return parseTrustedProxies(os.Getenv("TRUSTED_PROXIES"))
+}
+
+// trusts reports whether ip is a trusted proxy
+func (c trustedProxyConfig) trusts(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range c.Networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// viaUnixSocket reports whether a request came in over a Unix socket listener
+func viaUnixSocket(r *http.Request) bool {
+	addr, ok := r.Context().Value(http.LocalAddrContextKey).(net.Addr)
+	return ok && addr.Network() == "unix"
+}
+
+// forwardedClientIP returns the client IP of a request from a trusted proxy:
+// the rightmost X-Forwarded-For address that is not a trusted proxy, or the
+// leftmost if all are, or peer without the header. Entries that are not IP
+// addresses are skipped; if they leave only trusted proxies, peer is returned
+// rather than naming a proxy as the client.
+func forwardedClientIP(r *http.Request, peer string) string {
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		for _, hop := range strings.Split(header, ",") {
+			if hop = strings.TrimSpace(hop); hop != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	if len(hops) == 0 {
+		return peer
+	}
+	garbage := false
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(hops[i])
+		if ip == nil {
+			garbage = true
+			continue
+		}
+		if !trustedProxies.trusts(ip) {
+			return ip.String()
+		}
+	}
+	if garbage {
+		return peer
+	}
+	return net.ParseIP(hops[0]).String()
+}
+
+// parseBasePath validates a BASE_PATH value, returned without a trailing slash
+func parseBasePath(value string) (string, error) {
+	value = strings.TrimRight(strings.TrimSpace(value), "/")
+	if value == "" {
+		return "", nil
+	}
+	if !strings.HasPrefix(value, "/") || strings.ContainsAny(value, "?#") {
+		return "", fmt.Errorf("invalid base path %q, expected a path such as /attendance", value)
+	}
+	if u, err := url.Parse(value); err != nil || u.Path != value {
+		return "", fmt.Errorf("invalid base path %q, expected a path such as /attendance", value)
+	}
+	return value, nil
+}
+
+// loadBasePath reads BASE_PATH
+func loadBasePath() (string, error) {
+	return parseBasePath(os.Getenv("BASE_PATH"))
+}
+
+// basePathMiddleware removes BASE_PATH from request paths before routing
+func basePathMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if basePath == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		path, ok := strings.CutPrefix(r.URL.Path, basePath)
+		if !ok || (path != "" && !strings.HasPrefix(path, "/")) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if path == "" {
+			path = "/"
+		}
+
+		r2 := new(http.Request)
+		*r2 = *r
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = path
+		r2.URL.RawPath = ""
+		next.ServeHTTP(w, r2)
+	})
+}
+
+// publicPath returns the path clients reach a route at, with BASE_PATH
+func publicPath(path string) string {
+	return basePath + path
+}
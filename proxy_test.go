@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// Reverse Proxy Tests
+// ============================================================================
+
+// proxiedRequest builds a request from peer with an X-Forwarded-For header
+func proxiedRequest(peer, forwardedFor string) *http.Request {
+	req := httptest.NewRequest("GET", "/current", nil)
+	req.RemoteAddr = peer
+	if forwardedFor != "" {
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+	}
+	return req
+}
+
+func TestClientIP_TrustedProxies(t *testing.T) {
+	setupTest()
+	var err error
+	if trustedProxies, err = parseTrustedProxies("10.0.0.0/8, 127.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tc := range []struct {
+		name, peer, forwardedFor, want string
+	}{
+		{"direct", "203.0.113.7:5000", "", "203.0.113.7"},
+		{"untrusted peer cannot forward", "203.0.113.7:5000", "198.51.100.1", "203.0.113.7"},
+		{"proxy", "127.0.0.1:5000", "198.51.100.1", "198.51.100.1"},
+		{"spoofed header is skipped", "127.0.0.1:5000", "1.2.3.4, 198.51.100.1", "198.51.100.1"},
+		{"chain of proxies", "127.0.0.1:5000", "198.51.100.1, 10.1.2.3", "198.51.100.1"},
+		{"only proxies", "127.0.0.1:5000", "10.1.2.3", "10.1.2.3"},
+		{"proxy without header", "127.0.0.1:5000", "", "127.0.0.1"},
+		{"garbage is skipped", "127.0.0.1:5000", "198.51.100.1, not-an-ip, 10.1.2.3", "198.51.100.1"},
+		{"garbage before proxies", "127.0.0.1:5000", "not-an-ip, 10.1.2.3", "127.0.0.1"},
+		{"only garbage", "127.0.0.1:5000", "not-an-ip", "127.0.0.1"},
+	} {
+		if got := clientIP(proxiedRequest(tc.peer, tc.forwardedFor)); got != tc.want {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+
+	if _, err := parseTrustedProxies("10.0.0.0/8,nginx"); err == nil {
+		t.Error("expected an error for a host name")
+	}
+}
+
+func TestClientIP_UnixSocketProxy(t *testing.T) {
+	setupTest()
+	req := proxiedRequest("@", "198.51.100.1")
+	req = req.WithContext(context.WithValue(req.Context(), http.LocalAddrContextKey, &net.UnixAddr{Name: "/run/office.sock", Net: "unix"}))
+
+	if got := clientIP(req); got != "@" {
+		t.Errorf("expected the header ignored without TRUSTED_PROXIES, got %s", got)
+	}
+	trustedProxies, _ = parseTrustedProxies("unix")
+	if got := clientIP(req); got != "198.51.100.1" {
+		t.Errorf("expected the forwarded client, got %s", got)
+	}
+}
+
+func TestBasePath(t *testing.T) {
+	setupTest()
+	var err error
+	if basePath, err = parseBasePath("/attendance/"); err != nil || basePath != "/attendance" {
+		t.Fatalf("unexpected base path %q (err %v)", basePath, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/count", handleCount)
+	handler := basePathMiddleware(mux)
+	for _, path := range []string{"/attendance/count", "/count"} {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, httptest.NewRequest("GET", path, nil))
+		if rr.Code != http.StatusOK {
+			t.Errorf("expected %s served, got %v", path, rr.Code)
+		}
+	}
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", "/attendancecount", nil))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected a path only sharing the prefix's letters not stripped, got %v", rr.Code)
+	}
+
+	// Links include the prefix
+	if f := uploadTestFirmware(t, "1.0.0", "stable", []byte("image")); f.URL != fmt.Sprintf("/attendance/firmware/%d", f.ID) {
+		t.Errorf("expected the firmware URL under the prefix, got %s", f.URL)
+	}
+
+	for _, invalid := range []string{"attendance", "/attendance?x=1", "/attendance%zz"} {
+		if _, err := parseBasePath(invalid); err == nil {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
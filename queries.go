@@ -0,0 +1,116 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"sync"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+)
+
+// --- Query Layer ---
+//
+// Constraint errors are recognized by their SQLite result code, not by their
+// message. The queries run on every scan are kept here and prepared once per
+// database; database/sql re-prepares them on each pooled connection as needed.
+// Every query takes its values as ? parameters; only constant column lists
+// and condition strings are concatenated into SQL.
+
+// isUniqueViolation reports whether err is a UNIQUE or PRIMARY KEY constraint
+// failure, such as a UID that is already registered
+func isUniqueViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	if !errors.As(err, &sqliteErr) {
+		return false
+	}
+	code := sqliteErr.Code()
+	return code == sqlite3.SQLITE_CONSTRAINT_UNIQUE || code == sqlite3.SQLITE_CONSTRAINT_PRIMARYKEY
+}
+
+// isForeignKeyViolation reports whether err is a FOREIGN KEY constraint
+// failure, such as a row referring to a deleted member
+func isForeignKeyViolation(err error) bool {
+	var sqliteErr *sqlite.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.Code() == sqlite3.SQLITE_CONSTRAINT_FOREIGNKEY
+}
+
+// Queries run on every scan
+const (
+	queryInsertVisit = `INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`
+
+	queryMemberByUID = `SELECT m.id, m.name, m.uid, m.discord_id, m.role, m.status, m.org_id
+		FROM members c
+		JOIN members m ON m.id = CASE WHEN c.deleted_at IS NULL THEN c.id ELSE c.merged_into END
+		WHERE c.uid = ? AND m.deleted_at IS NULL`
+	queryMemberByID        = `SELECT id, name, uid, discord_id, role, status, org_id FROM members WHERE id = ? AND deleted_at IS NULL`
+	queryMemberByDiscordID = `SELECT id, name, uid, discord_id, role, status, org_id FROM members
+		WHERE discord_id = ? AND org_id = ? AND deleted_at IS NULL ORDER BY id LIMIT 1`
+
+	queryOpenSessionTime    = `SELECT signin_time FROM open_sessions WHERE uid = ?`
+	queryOpenSessionRoom    = `SELECT room FROM open_sessions WHERE uid = ?`
+	queryOpenSessionCount   = `SELECT COUNT(*) FROM open_sessions`
+	queryReplaceOpenSession = `INSERT OR REPLACE INTO open_sessions (uid, room, signin_time) VALUES (?, ?, ?)`
+	queryInsertOpenSession  = `INSERT OR IGNORE INTO open_sessions (uid, room, signin_time) VALUES (?, ?, ?)`
+	queryDeleteOpenSession  = `DELETE FROM open_sessions WHERE uid = ?`
+	queryCloseOpenSession   = `DELETE FROM open_sessions WHERE uid = ? RETURNING signin_time`
+
+	// Everyone inside, whether the UID is, and how many are members of an organization
+	queryOpenSessionAdmission = `SELECT COUNT(*), COALESCE(SUM(o.uid = ?), 0), COALESCE(SUM(m.org_id = ?), 0)
+		FROM open_sessions o
+		LEFT JOIN members c ON c.uid = o.uid
+		LEFT JOIN members m ON m.id = CASE WHEN c.deleted_at IS NULL THEN c.id ELSE c.merged_into END AND m.deleted_at IS NULL`
+)
+
+// stmtCache holds the statements prepared on the current database
+type stmtCache struct {
+	mu    sync.Mutex
+	db    *sql.DB
+	stmts map[string]*sql.Stmt
+}
+
+// statements prepares the queries above on first use
+var statements stmtCache
+
+// prepare returns the statement for query, preparing it on first use. The
+// cache starts over when the database is reopened (after a restore, or in tests).
+func (c *stmtCache) prepare(query string) (*sql.Stmt, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.db != db {
+		for _, stmt := range c.stmts {
+			stmt.Close()
+		}
+		c.db = db
+		c.stmts = make(map[string]*sql.Stmt)
+	}
+	if stmt, ok := c.stmts[query]; ok {
+		return stmt, nil
+	}
+	stmt, err := db.Prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	c.stmts[query] = stmt
+	return stmt, nil
+}
+
+// execStmt runs a prepared statement that returns no rows
+func execStmt(query string, args ...interface{}) (sql.Result, error) {
+	stmt, err := statements.prepare(query)
+	if err != nil {
+		return nil, err
+	}
+	return stmt.Exec(args...)
+}
+
+// queryRowStmt runs a prepared statement returning at most one row. A query
+// that cannot be prepared runs unprepared, so its error surfaces from Scan.
+func queryRowStmt(query string, args ...interface{}) *sql.Row {
+	stmt, err := statements.prepare(query)
+	if err != nil {
+		return db.QueryRow(query, args...)
+	}
+	return stmt.QueryRow(args...)
+}
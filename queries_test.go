@@ -0,0 +1,57 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Query Layer Tests
+// ============================================================================
+
+func TestConstraintErrors(t *testing.T) {
+	setupTest()
+
+	_, err := db.Exec(`INSERT INTO members (name, uid, discord_id) VALUES ('Alice again', 'TEST_UID_1', '111111111')`)
+	if !isUniqueViolation(err) || isForeignKeyViolation(err) {
+		t.Errorf("expected a unique violation, got %v", err)
+	}
+	if wrapped := fmt.Errorf("importing: %w", err); !isUniqueViolation(wrapped) {
+		t.Error("expected a wrapped unique violation to be recognized")
+	}
+
+	err = saveVisitToDB(999, time.Now().Add(-time.Hour), time.Now())
+	if !isForeignKeyViolation(err) || isUniqueViolation(err) {
+		t.Errorf("expected a foreign key violation, got %v", err)
+	}
+
+	for _, err := range []error{nil, sql.ErrNoRows, errors.New("UNIQUE constraint failed: members.uid")} {
+		if isUniqueViolation(err) || isForeignKeyViolation(err) {
+			t.Errorf("expected %v not to be a constraint error", err)
+		}
+	}
+}
+
+func TestStatementsReusedAndReprepared(t *testing.T) {
+	setupTest()
+
+	first, err := statements.prepare(queryInsertVisit)
+	if err != nil {
+		t.Fatalf("failed to prepare: %v", err)
+	}
+	if again, _ := statements.prepare(queryInsertVisit); again != first {
+		t.Error("expected the prepared statement to be reused")
+	}
+
+	// A new database, as after a restore, gets its own statements
+	setupTest()
+	if err := saveVisitToDB(1, time.Now().Add(-time.Hour), time.Now()); err != nil {
+		t.Fatalf("expected the visit saved on the new database, got %v", err)
+	}
+	if again, _ := statements.prepare(queryInsertVisit); again == first {
+		t.Error("expected the statement prepared again on the new database")
+	}
+}
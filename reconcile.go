@@ -0,0 +1,119 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+)
+
+// --- Startup Reconciliation ---
+//
+// Current attendees survive restarts (current_attendees.json, Redis or the
+// open_sessions table) while members and visits live in the database, so the
+// two can disagree after a crash, a restore or a member deletion. On boot,
+// before serving requests, every open session is checked:
+//   - the member no longer exists: dropped, no visit can be recorded
+//   - the sign-in time is in the future: dropped, the session is impossible
+//   - the session spans a nightly cleanup that did not run (the server was
+//     down at 4:00 AM): closed at that cleanup time and recorded as a visit
+//
+// The outcome is logged and, if anything changed, written to the audit log
+// as attendees.reconciled.
+
+// reconcileClockAllowance is how far in the future a sign-in time may be
+// before it is considered impossible (clock differences between replicas)
+const reconcileClockAllowance = 5 * time.Minute
+
+// ReconcileReport lists what startup reconciliation changed
+type ReconcileReport struct {
+	Kept          int      `json:"kept"`
+	UnknownMember []string `json:"unknown_member"` // UIDs dropped because their member is gone
+	Future        []string `json:"future"`         // UIDs dropped for signing in after now
+	Closed        []string `json:"closed"`         // UIDs closed at a missed nightly cleanup
+}
+
+// changed reports whether reconciliation dropped or closed any session
+func (r ReconcileReport) changed() bool {
+	return len(r.UnknownMember)+len(r.Future)+len(r.Closed) > 0
+}
+
+// String summarizes the report for logs and the audit log
+func (r ReconcileReport) String() string {
+	parts := []string{fmt.Sprintf("%d kept", r.Kept)}
+	if len(r.UnknownMember) > 0 {
+		parts = append(parts, fmt.Sprintf("%d dropped for unknown members (%s)", len(r.UnknownMember), strings.Join(r.UnknownMember, ", ")))
+	}
+	if len(r.Future) > 0 {
+		parts = append(parts, fmt.Sprintf("%d dropped for future sign-in times (%s)", len(r.Future), strings.Join(r.Future, ", ")))
+	}
+	if len(r.Closed) > 0 {
+		parts = append(parts, fmt.Sprintf("%d closed at a missed nightly cleanup (%s)", len(r.Closed), strings.Join(r.Closed, ", ")))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// lastNightlyCleanup returns the most recent nightly cleanup time at or before now
+func lastNightlyCleanup(now time.Time) time.Time {
+	cleanup := time.Date(now.Year(), now.Month(), now.Day(), nightlyCleanupHour, 0, 0, 0, now.Location())
+	if cleanup.After(now) {
+		cleanup = cleanup.AddDate(0, 0, -1)
+	}
+	return cleanup
+}
+
+// reconcileAttendees checks the current attendees against members and the
+// nightly cleanup schedule, dropping or closing impossible sessions
+func reconcileAttendees(now time.Time) ReconcileReport {
+	var report ReconcileReport
+	cleanup := lastNightlyCleanup(now)
+
+	for _, a := range currentAttendees.list() {
+		member, known := memberCache.get(a.UID)
+		switch {
+		case !known:
+			if _, ok, err := currentAttendees.signOutIfPresent(a.UID); err != nil {
+				log.Printf("Reconciliation: failed to drop UID %s: %v", a.UID, err)
+			} else if ok {
+				report.UnknownMember = append(report.UnknownMember, a.UID)
+			}
+
+		case a.SignInTime.After(now.Add(reconcileClockAllowance)):
+			if _, ok, err := currentAttendees.signOutIfPresent(a.UID); err != nil {
+				log.Printf("Reconciliation: failed to drop UID %s: %v", a.UID, err)
+			} else if ok {
+				report.Future = append(report.Future, a.UID)
+			}
+
+		case a.SignInTime.Before(cleanup):
+			// Another replica may be reconciling the same session
+			signInTime, ok, err := currentAttendees.signOutIfPresent(a.UID)
+			if err != nil {
+				log.Printf("Reconciliation: failed to close session of UID %s: %v", a.UID, err)
+				continue
+			}
+			if !ok {
+				continue
+			}
+			if err := saveVisitToDB(member.ID, signInTime, cleanup); err != nil {
+				log.Printf("Reconciliation: failed to save visit for UID %s: %v", a.UID, err)
+				continue
+			}
+			report.Closed = append(report.Closed, a.UID)
+			events.publish(Event{Kind: eventSignOut, Time: cleanup, Member: member, SignInTime: signInTime,
+				Message: fmt.Sprintf("%s was signed out by startup reconciliation", member.Name)})
+
+		default:
+			report.Kept++
+		}
+	}
+
+	log.Printf("Reconciliation: %s", report)
+	if report.changed() {
+		recordAudit("attendees.reconciled", "startup", report.String())
+		if err := saveCurrentAttendees(); err != nil {
+			log.Printf("Reconciliation: failed to save current attendees: %v", err)
+		}
+	}
+	return report
+}
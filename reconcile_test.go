@@ -0,0 +1,87 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Startup Reconciliation Tests
+// ============================================================================
+
+func TestLastNightlyCleanup(t *testing.T) {
+	loc := time.Local
+	tests := []struct {
+		now  time.Time
+		want time.Time
+	}{
+		{time.Date(2025, 3, 10, 9, 0, 0, 0, loc), time.Date(2025, 3, 10, nightlyCleanupHour, 0, 0, 0, loc)},
+		{time.Date(2025, 3, 10, 2, 0, 0, 0, loc), time.Date(2025, 3, 9, nightlyCleanupHour, 0, 0, 0, loc)},
+		{time.Date(2025, 3, 10, nightlyCleanupHour, 0, 0, 0, loc), time.Date(2025, 3, 10, nightlyCleanupHour, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := lastNightlyCleanup(tt.now); !got.Equal(tt.want) {
+			t.Errorf("lastNightlyCleanup(%v) = %v, want %v", tt.now, got, tt.want)
+		}
+	}
+}
+
+func TestReconcileAttendees(t *testing.T) {
+	setupTest()
+
+	now := time.Date(2025, 3, 10, 12, 0, 0, 0, time.Local)
+	cleanup := lastNightlyCleanup(now)
+
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-time.Hour))       // fine
+	currentAttendees.signIn("TEST_UID_2", "", cleanup.Add(-2*time.Hour)) // missed the cleanup
+	currentAttendees.signIn("DELETED_UID", "", now.Add(-time.Hour))      // member deleted
+	currentAttendees.signIn("TEST_UID_3", "", now.Add(time.Hour))        // unknown and in the future
+
+	report := reconcileAttendees(now)
+	events.wait()
+
+	if report.Kept != 1 || len(report.Closed) != 1 || len(report.UnknownMember) != 2 || len(report.Future) != 0 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if currentAttendees.count() != 1 {
+		t.Errorf("expected only Alice to remain inside, got %v", currentAttendees.snapshot())
+	}
+
+	var signout string
+	if err := db.QueryRow(`SELECT signout_time FROM visits WHERE member_id = 2`).Scan(&signout); err != nil {
+		t.Fatalf("expected a visit for Bob: %v", err)
+	}
+	if signout != cleanup.Format(time.RFC3339) {
+		t.Errorf("expected Bob signed out at the missed cleanup %v, got %s", cleanup, signout)
+	}
+
+	if entries, _ := loadAuditEntries("attendees.reconciled", 10); len(entries) != 1 {
+		t.Errorf("expected one attendees.reconciled audit entry, got %+v", entries)
+	}
+}
+
+func TestReconcileAttendees_FutureSignIn(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(time.Hour))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(time.Minute)) // within the clock allowance
+
+	report := reconcileAttendees(now)
+	if len(report.Future) != 1 || report.Future[0] != "TEST_UID_1" || report.Kept != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+}
+
+func TestReconcileAttendees_NothingToDo(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+
+	if report := reconcileAttendees(time.Now()); report.changed() || report.Kept != 1 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	if entries, _ := loadAuditEntries("attendees.reconciled", 10); len(entries) != 0 {
+		t.Errorf("expected no audit entry, got %+v", entries)
+	}
+}
@@ -0,0 +1,529 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Shared State (Redis) ---
+//
+// By default current attendees live in process memory and in
+// current_attendees.json, which only works with a single backend instance.
+// With REDIS_URL set (redis://[:password@]host[:port][/db], or rediss:// for
+// TLS) they are kept in a Redis hash instead, so several replicas behind a
+// load balancer see the same people inside. Sign-in and sign-out stay atomic
+// across replicas (HSETNX and Lua scripts), and so does the capacity check: the
+// attendees are read under WATCH and the sign-in written with MULTI/EXEC,
+// starting over if another replica changed them in between. The local
+// attendees file is then neither read nor written, since Redis persists the
+// state itself.
+//
+// Only the small subset of the Redis protocol (RESP) needed here is
+// implemented, to avoid pulling in a client library.
+
+const (
+	defaultRedisKeyPrefix = "ieee-office:"
+	redisTimeout          = 5 * time.Second
+
+	// redisWatchAttempts is how many times a check-and-set starts over
+	// because other replicas kept changing the key
+	redisWatchAttempts = 10
+)
+
+// sharedStateClient is the Redis connection for shared state, nil when REDIS_URL is unset
+var sharedStateClient *redisClient
+
+// redisNil is returned by redisClient.do for a nil reply (missing key or field)
+var redisNil = errors.New("redis: nil")
+
+// redisError is an error reply sent by the Redis server
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// redisClient sends commands to a Redis server over a single connection,
+// reconnecting after network errors
+type redisClient struct {
+	addr     string
+	password string
+	db       int
+	useTLS   bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	rd   *bufio.Reader
+}
+
+// parseRedisURL returns a client for a redis:// or rediss:// URL without connecting
+func parseRedisURL(raw string) (*redisClient, error) {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return nil, fmt.Errorf("invalid URL %q", raw)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("unsupported scheme %q, expected redis or rediss", u.Scheme)
+	}
+	if u.Hostname() == "" {
+		return nil, fmt.Errorf("missing host in %q", raw)
+	}
+
+	c := &redisClient{addr: u.Host, useTLS: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		// redis://:password@host and redis://password@host both name the password
+		if password, ok := u.User.Password(); ok {
+			c.password = password
+		} else {
+			c.password = u.User.Username()
+		}
+	}
+	if dbStr := strings.Trim(u.Path, "/"); dbStr != "" {
+		db, err := strconv.Atoi(dbStr)
+		if err != nil || db < 0 {
+			return nil, fmt.Errorf("invalid database %q, expected non-negative integer", dbStr)
+		}
+		c.db = db
+	}
+	return c, nil
+}
+
+// do sends a command and returns its reply: a string, int64 or []interface{},
+// or an error (redisNil for nil replies, redisError for error replies)
+func (c *redisClient) do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.send(args)
+}
+
+// watch runs a check-and-set on key: it WATCHes key, calls check, which reads
+// through the given do, then runs the commands check returns in MULTI/EXEC.
+// The connection is held throughout. It reports false if another client
+// changed key in between, so nothing was written; check returning no
+// commands leaves key alone.
+func (c *redisClient) watch(key string, check func(do func(args ...string) (interface{}, error)) ([][]string, error)) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, err := c.send([]string{"WATCH", key}); err != nil {
+		return false, err
+	}
+	commands, err := check(func(args ...string) (interface{}, error) { return c.send(args) })
+	if err != nil || len(commands) == 0 {
+		if _, unwatchErr := c.send([]string{"UNWATCH"}); err == nil {
+			err = unwatchErr
+		}
+		return err == nil, err
+	}
+
+	if _, err := c.send([]string{"MULTI"}); err != nil {
+		return false, err
+	}
+	for _, args := range commands {
+		if _, err := c.send(args); err != nil {
+			c.send([]string{"DISCARD"})
+			return false, err
+		}
+	}
+	switch _, err := c.send([]string{"EXEC"}); err {
+	case nil:
+		return true, nil
+	case redisNil:
+		return false, nil
+	default:
+		return false, err
+	}
+}
+
+// send sends a command on the connection, which the caller holds
+func (c *redisClient) send(args []string) (interface{}, error) {
+	if c.conn == nil {
+		if err := c.connect(); err != nil {
+			return nil, err
+		}
+	}
+
+	reply, err := c.roundTrip(args)
+	var serverErr redisError
+	if err != nil && err != redisNil && !errors.As(err, &serverErr) {
+		// The connection is in an unknown state, start over next time
+		c.conn.Close()
+		c.conn, c.rd = nil, nil
+	}
+	return reply, err
+}
+
+// connect dials the server, then authenticates and selects the database
+func (c *redisClient) connect() error {
+	dialer := &net.Dialer{Timeout: redisTimeout}
+	var conn net.Conn
+	var err error
+	if c.useTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, nil)
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn, c.rd = conn, bufio.NewReader(conn)
+
+	if c.password != "" {
+		if _, err := c.roundTrip([]string{"AUTH", c.password}); err != nil {
+			c.conn.Close()
+			c.conn, c.rd = nil, nil
+			return err
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTrip([]string{"SELECT", strconv.Itoa(c.db)}); err != nil {
+			c.conn.Close()
+			c.conn, c.rd = nil, nil
+			return err
+		}
+	}
+	return nil
+}
+
+// roundTrip writes one command and reads its reply on the open connection
+func (c *redisClient) roundTrip(args []string) (interface{}, error) {
+	c.conn.SetDeadline(time.Now().Add(redisTimeout))
+	if _, err := c.conn.Write(encodeRedisCommand(args)); err != nil {
+		return nil, err
+	}
+	return readRedisReply(c.rd)
+}
+
+// encodeRedisCommand encodes a command as a RESP array of bulk strings
+func encodeRedisCommand(args []string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	return []byte(b.String())
+}
+
+// readRedisReply reads one RESP reply
+func readRedisReply(rd *bufio.Reader) (interface{}, error) {
+	line, err := rd.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, fmt.Errorf("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, redisNil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(rd, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: invalid array length %q", line)
+		}
+		if n < 0 {
+			return nil, redisNil
+		}
+		items := make([]interface{}, 0, n)
+		for i := 0; i < n; i++ {
+			item, err := readRedisReply(rd)
+			if err == redisNil {
+				item, err = nil, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, item)
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// --- Redis Attendee Store ---
+
+// attendeeRecord is the value stored per UID in the attendees hash
+type attendeeRecord struct {
+	Since time.Time `json:"since"`
+	Room  string    `json:"room,omitempty"`
+}
+
+const (
+	// Removes a field and returns its previous value
+	redisPopScript = `local v = redis.call('HGET', KEYS[1], ARGV[1])
+if v then redis.call('HDEL', KEYS[1], ARGV[1]) end
+return v`
+
+	// Deletes a hash and returns its previous contents
+	redisClearScript = `local v = redis.call('HGETALL', KEYS[1])
+redis.call('DEL', KEYS[1])
+return v`
+
+	// Replaces a hash with the field/value pairs in ARGV
+	redisReplaceScript = `redis.call('DEL', KEYS[1])
+for i = 1, #ARGV, 2 do redis.call('HSET', KEYS[1], ARGV[i], ARGV[i + 1]) end
+return 1`
+)
+
+// redisAttendeeStore keeps current attendees in a Redis hash of UID -> attendeeRecord.
+// Redis errors are logged and counted in redis_errors_total; reads then behave
+// as if nobody was inside, while get and the sign-ins and sign-outs return the
+// error so the scan fails instead of being dropped.
+type redisAttendeeStore struct {
+	client *redisClient
+	key    string
+}
+
+// newRedisAttendeeStore stores attendees under <prefix>attendees
+func newRedisAttendeeStore(client *redisClient, prefix string) *redisAttendeeStore {
+	return &redisAttendeeStore{client: client, key: prefix + "attendees"}
+}
+
+// warn logs a failed Redis operation
+func (s *redisAttendeeStore) warn(op string, err error) {
+	incCounter("redis_errors_total")
+	logStore.warnf("Warning: redis %s on %s failed: %v", op, s.key, err)
+}
+
+// record reads a stored attendee, reporting whether the field existed
+func (s *redisAttendeeStore) record(op string, reply interface{}, err error) (attendeeRecord, bool) {
+	if err == redisNil {
+		return attendeeRecord{}, false
+	}
+	if err != nil {
+		s.warn(op, err)
+		return attendeeRecord{}, false
+	}
+	value, ok := reply.(string)
+	if !ok {
+		s.warn(op, fmt.Errorf("unexpected reply %v", reply))
+		return attendeeRecord{}, false
+	}
+	var rec attendeeRecord
+	if err := json.Unmarshal([]byte(value), &rec); err != nil {
+		s.warn(op, err)
+		return attendeeRecord{}, false
+	}
+	return rec, true
+}
+
+// records decodes an HGETALL style reply into UID -> record
+func (s *redisAttendeeStore) records(op string, reply interface{}, err error) map[string]attendeeRecord {
+	recs := make(map[string]attendeeRecord)
+	if err == redisNil {
+		return recs
+	}
+	if err != nil {
+		s.warn(op, err)
+		return recs
+	}
+	items, _ := reply.([]interface{})
+	for i := 0; i+1 < len(items); i += 2 {
+		uid, _ := items[i].(string)
+		if rec, ok := s.record(op, items[i+1], nil); ok {
+			recs[uid] = rec
+		}
+	}
+	return recs
+}
+
+// encode serializes an attendee record for storage
+func (s *redisAttendeeStore) encode(room string, t time.Time) string {
+	data, _ := json.Marshal(attendeeRecord{Since: t, Room: room})
+	return string(data)
+}
+
+func (s *redisAttendeeStore) get(uid string) (time.Time, bool, error) {
+	reply, err := s.client.do("HGET", s.key, uid)
+	if err != nil && err != redisNil {
+		s.warn("HGET", err)
+		return time.Time{}, false, err
+	}
+	rec, ok := s.record("HGET", reply, err)
+	return rec.Since, ok, nil
+}
+
+func (s *redisAttendeeStore) room(uid string) (string, bool) {
+	reply, err := s.client.do("HGET", s.key, uid)
+	rec, ok := s.record("HGET", reply, err)
+	return rec.Room, ok
+}
+
+func (s *redisAttendeeStore) count() int {
+	reply, err := s.client.do("HLEN", s.key)
+	if err != nil {
+		s.warn("HLEN", err)
+		return 0
+	}
+	n, _ := reply.(int64)
+	return int(n)
+}
+
+func (s *redisAttendeeStore) signIn(uid, room string, t time.Time) {
+	defer renderedResponses.invalidate()
+	if _, err := s.client.do("HSET", s.key, uid, s.encode(room, t)); err != nil {
+		s.warn("HSET", err)
+	}
+}
+
+func (s *redisAttendeeStore) signInIfAbsent(uid, room string, t time.Time) (bool, error) {
+	defer renderedResponses.invalidate()
+	reply, err := s.client.do("HSETNX", s.key, uid, s.encode(room, t))
+	if err != nil {
+		s.warn("HSETNX", err)
+		return false, err
+	}
+	return reply == int64(1), nil
+}
+
+func (s *redisAttendeeStore) signInWithin(uid, room string, t time.Time, org string, capacity int) (signInResult, bool, error) {
+	defer renderedResponses.invalidate()
+	for attempt := 0; attempt < redisWatchAttempts; attempt++ {
+		var result signInResult
+		var empty bool
+		done, err := s.client.watch(s.key, func(do func(args ...string) (interface{}, error)) ([][]string, error) {
+			reply, err := do("HKEYS", s.key)
+			if err != nil && err != redisNil {
+				return nil, err
+			}
+			items, _ := reply.([]interface{})
+			inside := make([]string, 0, len(items))
+			for _, item := range items {
+				if uid, ok := item.(string); ok {
+					inside = append(inside, uid)
+				}
+			}
+			result, empty = admitSignIn(uid, inside, org, capacity), len(inside) == 0
+			if result != signInAccepted {
+				return nil, nil
+			}
+			return [][]string{{"HSET", s.key, uid, s.encode(room, t)}}, nil
+		})
+		if err != nil {
+			s.warn("sign-in", err)
+			return 0, false, err
+		}
+		if done {
+			return result, empty, nil
+		}
+	}
+	err := fmt.Errorf("attendees kept changing during %d attempts", redisWatchAttempts)
+	s.warn("sign-in", err)
+	return 0, false, err
+}
+
+func (s *redisAttendeeStore) signOutIfPresent(uid string) (time.Time, bool, error) {
+	defer renderedResponses.invalidate()
+	reply, err := s.client.do("EVAL", redisPopScript, "1", s.key, uid)
+	if err != nil && err != redisNil {
+		s.warn("EVAL pop", err)
+		return time.Time{}, false, err
+	}
+	rec, ok := s.record("EVAL pop", reply, err)
+	return rec.Since, ok, nil
+}
+
+func (s *redisAttendeeStore) remove(uid string) {
+	defer renderedResponses.invalidate()
+	if _, err := s.client.do("HDEL", s.key, uid); err != nil {
+		s.warn("HDEL", err)
+	}
+}
+
+func (s *redisAttendeeStore) list() []attendee {
+	reply, err := s.client.do("HGETALL", s.key)
+	recs := s.records("HGETALL", reply, err)
+	list := make([]attendee, 0, len(recs))
+	for uid, rec := range recs {
+		list = append(list, attendee{UID: uid, SignInTime: rec.Since, Room: rec.Room})
+	}
+	return list
+}
+
+func (s *redisAttendeeStore) snapshot() map[string]time.Time {
+	reply, err := s.client.do("HGETALL", s.key)
+	since := make(map[string]time.Time)
+	for uid, rec := range s.records("HGETALL", reply, err) {
+		since[uid] = rec.Since
+	}
+	return since
+}
+
+func (s *redisAttendeeStore) clear() map[string]time.Time {
+	defer renderedResponses.invalidate()
+	reply, err := s.client.do("EVAL", redisClearScript, "1", s.key)
+	since := make(map[string]time.Time)
+	for uid, rec := range s.records("EVAL clear", reply, err) {
+		since[uid] = rec.Since
+	}
+	return since
+}
+
+func (s *redisAttendeeStore) replace(since map[string]time.Time) {
+	defer renderedResponses.invalidate()
+	args := []string{"EVAL", redisReplaceScript, "1", s.key}
+	for uid, t := range since {
+		args = append(args, uid, s.encode("", t))
+	}
+	if _, err := s.client.do(args...); err != nil {
+		s.warn("EVAL replace", err)
+	}
+}
+
+// configureSharedState switches current attendees to Redis when REDIS_URL is
+// set (key prefix REDIS_KEY_PREFIX, default "ieee-office:"). It checks the
+// connection so a wrong URL fails at startup.
+func configureSharedState() error {
+	raw := os.Getenv("REDIS_URL")
+	if raw == "" {
+		return nil
+	}
+	client, err := parseRedisURL(raw)
+	if err != nil {
+		return err
+	}
+	if _, err := client.do("PING"); err != nil {
+		return fmt.Errorf("cannot reach %s: %v", client.addr, err)
+	}
+
+	prefix := os.Getenv("REDIS_KEY_PREFIX")
+	if prefix == "" {
+		prefix = defaultRedisKeyPrefix
+	}
+	sharedStateClient = client
+	currentAttendees = newRedisAttendeeStore(client, prefix)
+	return nil
+}
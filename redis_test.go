@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Redis Shared State Tests
+// ============================================================================
+
+// fakeRedis is an in-process server speaking enough RESP for redisAttendeeStore.
+// EVAL runs the known scripts natively instead of interpreting Lua.
+type fakeRedis struct {
+	password string
+
+	mu       sync.Mutex
+	hashes   map[string]map[string]string
+	versions map[string]int // Writes per key, for WATCH
+	commands []string
+}
+
+// startFakeRedis listens on a loopback port and returns the server and its address
+func startFakeRedis(t *testing.T, password string) (*fakeRedis, string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	f := &fakeRedis{password: password, hashes: make(map[string]map[string]string), versions: make(map[string]int)}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(conn)
+		}
+	}()
+	return f, ln.Addr().String()
+}
+
+func (f *fakeRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	rd := bufio.NewReader(conn)
+	authed := f.password == ""
+	watched := make(map[string]int) // Key -> version when watched
+	var queued [][]string           // Commands after MULTI, nil outside one
+	for {
+		reply, err := readRedisReply(rd)
+		if err != nil {
+			return
+		}
+		items, _ := reply.([]interface{})
+		args := make([]string, len(items))
+		for i, item := range items {
+			args[i], _ = item.(string)
+		}
+		if len(args) == 0 {
+			return
+		}
+
+		cmd := strings.ToUpper(args[0])
+		if cmd == "AUTH" {
+			authed = args[1] == f.password
+		}
+		if !authed {
+			conn.Write([]byte("-NOAUTH Authentication required.\r\n"))
+			continue
+		}
+
+		switch {
+		case cmd == "WATCH":
+			f.mu.Lock()
+			watched[args[1]] = f.versions[args[1]]
+			f.mu.Unlock()
+			conn.Write([]byte("+OK\r\n"))
+		case cmd == "UNWATCH":
+			clear(watched)
+			conn.Write([]byte("+OK\r\n"))
+		case cmd == "MULTI":
+			queued = [][]string{}
+			conn.Write([]byte("+OK\r\n"))
+		case cmd == "DISCARD":
+			queued = nil
+			clear(watched)
+			conn.Write([]byte("+OK\r\n"))
+		case cmd == "EXEC":
+			f.mu.Lock()
+			changed := false
+			for key, version := range watched {
+				changed = changed || f.versions[key] != version
+			}
+			f.mu.Unlock()
+			if changed {
+				conn.Write([]byte("*-1\r\n"))
+			} else {
+				replies := []byte("*" + strconv.Itoa(len(queued)) + "\r\n")
+				for _, q := range queued {
+					replies = append(replies, f.handle(strings.ToUpper(q[0]), q[1:])...)
+				}
+				conn.Write(replies)
+			}
+			queued = nil
+			clear(watched)
+		case queued != nil:
+			queued = append(queued, args)
+			conn.Write([]byte("+QUEUED\r\n"))
+		default:
+			conn.Write(f.handle(cmd, args[1:]))
+		}
+	}
+}
+
+func (f *fakeRedis) handle(cmd string, args []string) []byte {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.commands = append(f.commands, cmd)
+
+	hash := func(key string) map[string]string {
+		if f.hashes[key] == nil {
+			f.hashes[key] = make(map[string]string)
+		}
+		return f.hashes[key]
+	}
+	bulk := func(v string, ok bool) []byte {
+		if !ok {
+			return []byte("$-1\r\n")
+		}
+		return []byte("$" + strconv.Itoa(len(v)) + "\r\n" + v + "\r\n")
+	}
+	all := func(h map[string]string) []byte {
+		fields := make([]string, 0, len(h))
+		for field := range h {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		var b bytes.Buffer
+		b.WriteString("*" + strconv.Itoa(2*len(fields)) + "\r\n")
+		for _, field := range fields {
+			b.Write(bulk(field, true))
+			b.Write(bulk(h[field], true))
+		}
+		return b.Bytes()
+	}
+	integer := func(n int) []byte { return []byte(":" + strconv.Itoa(n) + "\r\n") }
+
+	switch cmd {
+	case "HSET", "HSETNX", "HDEL":
+		f.versions[args[0]]++
+	case "EVAL":
+		f.versions[args[2]]++
+	}
+
+	switch cmd {
+	case "AUTH", "SELECT", "PING":
+		return []byte("+OK\r\n")
+	case "HGET":
+		v, ok := hash(args[0])[args[1]]
+		return bulk(v, ok)
+	case "HSET":
+		hash(args[0])[args[1]] = args[2]
+		return integer(1)
+	case "HSETNX":
+		h := hash(args[0])
+		if _, ok := h[args[1]]; ok {
+			return integer(0)
+		}
+		h[args[1]] = args[2]
+		return integer(1)
+	case "HDEL":
+		delete(hash(args[0]), args[1])
+		return integer(1)
+	case "HLEN":
+		return integer(len(hash(args[0])))
+	case "HGETALL":
+		return all(hash(args[0]))
+	case "HKEYS":
+		var b bytes.Buffer
+		b.WriteString("*" + strconv.Itoa(len(hash(args[0]))) + "\r\n")
+		for field := range hash(args[0]) {
+			b.Write(bulk(field, true))
+		}
+		return b.Bytes()
+	case "EVAL":
+		script, key, argv := args[0], args[2], args[3:]
+		h := hash(key)
+		switch script {
+		case redisPopScript:
+			v, ok := h[argv[0]]
+			delete(h, argv[0])
+			return bulk(v, ok)
+		case redisClearScript:
+			reply := all(h)
+			delete(f.hashes, key)
+			return reply
+		case redisReplaceScript:
+			delete(f.hashes, key)
+			h = hash(key)
+			for i := 0; i+1 < len(argv); i += 2 {
+				h[argv[i]] = argv[i+1]
+			}
+			return integer(1)
+		}
+	}
+	return []byte("-ERR unknown command '" + cmd + "'\r\n")
+}
+
+func TestParseRedisURL(t *testing.T) {
+	tests := []struct {
+		raw      string
+		addr     string
+		password string
+		db       int
+		tls      bool
+		wantErr  bool
+	}{
+		{raw: "redis://localhost", addr: "localhost:6379"},
+		{raw: "redis://:secret@cache:6380/2", addr: "cache:6380", password: "secret", db: 2},
+		{raw: "redis://secret@cache", addr: "cache:6379", password: "secret"},
+		{raw: "rediss://cache:6380", addr: "cache:6380", tls: true},
+		{raw: "http://cache", wantErr: true},
+		{raw: "redis://", wantErr: true},
+		{raw: "redis://cache/abc", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		c, err := parseRedisURL(tt.raw)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("%s: expected an error", tt.raw)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: unexpected error: %v", tt.raw, err)
+			continue
+		}
+		if c.addr != tt.addr || c.password != tt.password || c.db != tt.db || c.useTLS != tt.tls {
+			t.Errorf("%s: got addr=%q password=%q db=%d tls=%v", tt.raw, c.addr, c.password, c.db, c.useTLS)
+		}
+	}
+}
+
+func TestReadRedisReply(t *testing.T) {
+	rd := bufio.NewReader(strings.NewReader("+OK\r\n:42\r\n$5\r\nhello\r\n$-1\r\n*2\r\n$1\r\na\r\n$-1\r\n-ERR boom\r\n"))
+
+	if reply, err := readRedisReply(rd); err != nil || reply != "OK" {
+		t.Errorf("simple string: got %v, %v", reply, err)
+	}
+	if reply, err := readRedisReply(rd); err != nil || reply != int64(42) {
+		t.Errorf("integer: got %v, %v", reply, err)
+	}
+	if reply, err := readRedisReply(rd); err != nil || reply != "hello" {
+		t.Errorf("bulk string: got %v, %v", reply, err)
+	}
+	if _, err := readRedisReply(rd); err != redisNil {
+		t.Errorf("nil bulk string: expected redisNil, got %v", err)
+	}
+	if reply, err := readRedisReply(rd); err != nil || len(reply.([]interface{})) != 2 || reply.([]interface{})[1] != nil {
+		t.Errorf("array: got %v, %v", reply, err)
+	}
+	if _, err := readRedisReply(rd); err == nil || err.Error() != "redis: ERR boom" {
+		t.Errorf("error: got %v", err)
+	}
+}
+
+func TestRedisAttendeeStore(t *testing.T) {
+	setupTest()
+
+	server, addr := startFakeRedis(t, "secret")
+	client, err := parseRedisURL("redis://:secret@" + addr)
+	if err != nil {
+		t.Fatalf("parseRedisURL failed: %v", err)
+	}
+	s := newRedisAttendeeStore(client, "test:")
+	since := time.Now().Add(-time.Hour).Truncate(time.Second)
+
+	if ok, err := s.signInIfAbsent("A", "lab", since); err != nil || !ok {
+		t.Fatal("expected the first sign-in to succeed")
+	}
+	if ok, _ := s.signInIfAbsent("A", "", time.Now()); ok {
+		t.Error("expected a second sign-in to be refused")
+	}
+	if got, ok, _ := s.get("A"); !ok || !got.Equal(since) {
+		t.Errorf("expected A signed in since %v, got %v (%v)", since, got, ok)
+	}
+	if room, _ := s.room("A"); room != "lab" {
+		t.Errorf("expected room lab, got %q", room)
+	}
+
+	s.signIn("B", "", since)
+	if s.count() != 2 || len(s.list()) != 2 || len(s.snapshot()) != 2 {
+		t.Errorf("expected 2 attendees, got %v", s.snapshot())
+	}
+
+	if got, ok, _ := s.signOutIfPresent("A"); !ok || !got.Equal(since) {
+		t.Errorf("expected to sign out the session started at %v, got %v (%v)", since, got, ok)
+	}
+	if _, ok, _ := s.signOutIfPresent("A"); ok {
+		t.Error("expected a second sign-out to be refused")
+	}
+
+	if previous := s.clear(); len(previous) != 1 || s.count() != 0 {
+		t.Errorf("expected clear to return B and empty the hash, got %v", previous)
+	}
+
+	s.replace(map[string]time.Time{"C": since})
+	if _, ok, _ := s.get("C"); !ok || s.count() != 1 {
+		t.Errorf("expected only C after replace, got %v", s.snapshot())
+	}
+
+	server.mu.Lock()
+	defer server.mu.Unlock()
+	if server.commands[0] != "AUTH" {
+		t.Errorf("expected the client to authenticate first, got %v", server.commands)
+	}
+	if _, ok := server.hashes["test:attendees"]; !ok {
+		t.Errorf("expected attendees under test:attendees, got %v", server.hashes)
+	}
+}
+
+func TestRedisAttendeeStore_SignInWithin(t *testing.T) {
+	setupTest()
+
+	_, addr := startFakeRedis(t, "")
+	client, _ := parseRedisURL("redis://" + addr)
+	checkSignInWithin(t, newRedisAttendeeStore(client, "test:"))
+}
+
+func TestRedisAttendeeStore_CapacityAcrossInstances(t *testing.T) {
+	setupTest()
+
+	// Two replicas, each with its own connection, let in Alice and Bob at once
+	_, addr := startFakeRedis(t, "")
+	var wg sync.WaitGroup
+	results := make([]signInResult, 2)
+	for i, uid := range []string{"TEST_UID_1", "TEST_UID_2"} {
+		client, _ := parseRedisURL("redis://" + addr)
+		s := newRedisAttendeeStore(client, "test:")
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i], _, _ = s.signInWithin(uid, "", time.Now(), defaultOrg, 1)
+		}()
+	}
+	wg.Wait()
+
+	if accepted := (results[0] == signInAccepted) != (results[1] == signInAccepted); !accepted {
+		t.Errorf("expected exactly one sign-in within capacity, got %v", results)
+	}
+}
+
+func TestRedisClient_WatchConflict(t *testing.T) {
+	setupTest()
+
+	_, addr := startFakeRedis(t, "")
+	client, _ := parseRedisURL("redis://" + addr)
+	other, _ := parseRedisURL("redis://" + addr)
+	s, replica := newRedisAttendeeStore(client, "test:"), newRedisAttendeeStore(other, "test:")
+
+	// Another replica signs Bob in between the check and the write
+	done, err := client.watch(s.key, func(do func(args ...string) (interface{}, error)) ([][]string, error) {
+		replica.signIn("TEST_UID_2", "", time.Now())
+		return [][]string{{"HSET", s.key, "TEST_UID_1", s.encode("", time.Now())}}, nil
+	})
+	if err != nil || done {
+		t.Errorf("expected the write dropped, got done=%v (%v)", done, err)
+	}
+	if _, ok, _ := s.get("TEST_UID_1"); ok {
+		t.Error("expected Alice not signed in")
+	}
+
+	// With nobody else writing it goes through
+	done, err = client.watch(s.key, func(do func(args ...string) (interface{}, error)) ([][]string, error) {
+		return [][]string{{"HSET", s.key, "TEST_UID_1", s.encode("", time.Now())}}, nil
+	})
+	if err != nil || !done {
+		t.Errorf("expected the write to go through, got done=%v (%v)", done, err)
+	}
+}
+
+func TestRedisAttendeeStore_ServerDown(t *testing.T) {
+	setupTest()
+
+	// Nothing listens on this port once the listener is closed
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client, _ := parseRedisURL("redis://" + addr)
+	s := newRedisAttendeeStore(client, "test:")
+
+	if ok, err := s.signInIfAbsent("A", "", time.Now()); ok || err == nil {
+		t.Errorf("expected sign-in to fail without Redis, got %v (%v)", ok, err)
+	}
+	if _, ok, err := s.signOutIfPresent("A"); ok || err == nil {
+		t.Errorf("expected sign-out to fail without Redis, got %v (%v)", ok, err)
+	}
+	if _, ok, err := s.get("A"); ok || err == nil {
+		t.Errorf("expected the lookup to fail without Redis, got %v (%v)", ok, err)
+	}
+	if s.count() != 0 {
+		t.Errorf("expected no attendees without Redis, got %d", s.count())
+	}
+	if counters["redis_errors_total"] != 4 {
+		t.Errorf("expected 4 Redis errors counted, got %v", counters["redis_errors_total"])
+	}
+}
+
+func TestHandleScan_RedisUnreachable(t *testing.T) {
+	setupTest()
+
+	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+	addr := ln.Addr().String()
+	ln.Close()
+
+	client, _ := parseRedisURL("redis://" + addr)
+	currentAttendees = newRedisAttendeeStore(client, defaultRedisKeyPrefix)
+	t.Cleanup(func() { currentAttendees = newAttendeeStore() })
+
+	// The scanner is told to retry rather than shown a welcome that was never recorded
+	rr := scan(t, "TEST_UID_1")
+	if rr.Code != http.StatusServiceUnavailable {
+		t.Errorf("expected 503 Service Unavailable, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if _, err := performSignOut(context.Background(), cachedMember("TEST_UID_1")); !errors.Is(err, errAttendeeStore) {
+		t.Errorf("expected the sign-out to fail on the store, got %v", err)
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM visits`); n != 0 {
+		t.Errorf("expected no visit saved, got %d", n)
+	}
+}
+
+func TestHandleScan_SharedStateAcrossInstances(t *testing.T) {
+	setupTest()
+
+	_, addr := startFakeRedis(t, "")
+	t.Setenv("REDIS_URL", "redis://"+addr)
+	t.Cleanup(func() {
+		jobs.wait()
+		sharedStateClient = nil
+		currentAttendees = newAttendeeStore()
+	})
+	if err := configureSharedState(); err != nil {
+		t.Fatalf("configureSharedState failed: %v", err)
+	}
+
+	// Signed in through this instance...
+	if rr := scan(t, "TEST_UID_1"); !strings.Contains(rr.Body.String(), `"status":"in"`) {
+		t.Fatalf("expected sign-in, got %s", rr.Body.String())
+	}
+
+	// ...and seen by another one sharing the same Redis
+	client, _ := parseRedisURL("redis://" + addr)
+	other := newRedisAttendeeStore(client, defaultRedisKeyPrefix)
+	if _, ok, _ := other.get("TEST_UID_1"); !ok {
+		t.Error("expected Alice to be signed in for the other instance")
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// --- Remote Sign-In Approval ---
+//
+// With REMOTE_SIGNIN_APPROVAL set (a Go duration such as 10m), sign-ins that
+// do not come from a scanner (/sign-in-discord) are not applied right away.
+// They create a pending sign-in that must be confirmed within that time,
+// either by the member scanning their card or by an exec or officer who is
+// signed in themselves, i.e. in the office. A confirmed sign-in starts when it
+// was requested; one not confirmed in time is discarded. Every outcome is
+// recorded in the audit log.
+
+const remoteSignInMonitorInterval = time.Minute
+
+// remoteSignInApproval is how long a remote sign-in waits for confirmation; 0 applies them right away
+var remoteSignInApproval time.Duration
+
+// loadRemoteSignInApproval reads REMOTE_SIGNIN_APPROVAL (a Go duration such as 10m, empty to disable)
+func loadRemoteSignInApproval() (time.Duration, error) {
+	value := os.Getenv("REMOTE_SIGNIN_APPROVAL")
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid duration %q", value)
+	}
+	return d, nil
+}
+
+// PendingSignIn is a remote sign-in awaiting confirmation
+type PendingSignIn struct {
+	ID          int64     `json:"id"`
+	MemberID    int64     `json:"member_id"`
+	Name        string    `json:"name"`
+	Room        string    `json:"room"`
+	RequestedAt time.Time `json:"requested_at"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
+// pendingSignInColumns is the column list scanned by scanPendingSignIn
+const pendingSignInColumns = `p.id, p.member_id, m.name, p.room, p.requested_at, p.expires_at`
+
+// pendingSignInFrom joins pending sign-ins to their members for pendingSignInColumns
+const pendingSignInFrom = ` FROM pending_signins p JOIN members m ON m.id = p.member_id`
+
+// scanPendingSignIn reads a pending sign-in row selected with pendingSignInColumns
+func scanPendingSignIn(row rowScanner) (PendingSignIn, error) {
+	var p PendingSignIn
+	var requestedAt, expiresAt string
+	if err := row.Scan(&p.ID, &p.MemberID, &p.Name, &p.Room, &requestedAt, &expiresAt); err != nil {
+		return PendingSignIn{}, err
+	}
+
+	var err error
+	if p.RequestedAt, err = time.Parse(time.RFC3339, requestedAt); err != nil {
+		return PendingSignIn{}, err
+	}
+	if p.ExpiresAt, err = time.Parse(time.RFC3339, expiresAt); err != nil {
+		return PendingSignIn{}, err
+	}
+	return p, nil
+}
+
+// loadPendingSignIn fetches a pending sign-in by ID
+func loadPendingSignIn(id int64) (PendingSignIn, error) {
+	return scanPendingSignIn(db.QueryRow(`SELECT `+pendingSignInColumns+pendingSignInFrom+` WHERE p.id = ?`, id))
+}
+
+// loadPendingSignIns returns pending sign-ins, oldest first
+func loadPendingSignIns() ([]PendingSignIn, error) {
+	rows, err := db.Query(`SELECT ` + pendingSignInColumns + pendingSignInFrom + ` ORDER BY p.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []PendingSignIn{}
+	for rows.Next() {
+		p, err := scanPendingSignIn(rows)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+// requestRemoteSignIn records a pending sign-in for a member, failing with
+// errAlreadySignedIn if they are inside and errAttendeeStore if that can't be
+// checked
+func requestRemoteSignIn(member Member, room string, now time.Time) (PendingSignIn, error) {
+	if room == "" {
+		room = defaultRoom
+	}
+	if _, inside, err := currentAttendees.get(member.UID); err != nil {
+		return PendingSignIn{}, fmt.Errorf("%w: %v", errAttendeeStore, err)
+	} else if inside {
+		return PendingSignIn{}, errAlreadySignedIn
+	}
+
+	res, err := db.Exec(`INSERT INTO pending_signins (member_id, room, requested_at, expires_at) VALUES (?, ?, ?, ?)`,
+		member.ID, room, now.Format(time.RFC3339), now.Add(remoteSignInApproval).Format(time.RFC3339))
+	if err != nil {
+		return PendingSignIn{}, err
+	}
+	id, _ := res.LastInsertId()
+	return loadPendingSignIn(id)
+}
+
+// deletePendingSignIn removes a pending sign-in, reporting whether it was still there
+func deletePendingSignIn(id int64) (bool, error) {
+	res, err := db.Exec(`DELETE FROM pending_signins WHERE id = ?`, id)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// discardExpiredSignIns drops pending sign-ins that were not confirmed in time
+func discardExpiredSignIns(now time.Time) error {
+	pending, err := loadPendingSignIns()
+	if err != nil {
+		return err
+	}
+
+	for _, p := range pending {
+		if now.Before(p.ExpiresAt) {
+			continue
+		}
+		// Another instance may have discarded or confirmed it meanwhile
+		deleted, err := deletePendingSignIn(p.ID)
+		if err != nil {
+			return err
+		}
+		if deleted {
+			logHTTP.infof("Discarded unconfirmed remote sign-in of %s", p.Name)
+			recordAudit("remote_signin.discarded", "system", fmt.Sprintf("pending=%d member=%d", p.ID, p.MemberID))
+		}
+	}
+	return nil
+}
+
+// startRemoteSignInMonitor periodically discards remote sign-ins not confirmed in time
+func startRemoteSignInMonitor() {
+	ticker := time.NewTicker(remoteSignInMonitorInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := discardExpiredSignIns(now); err != nil {
+			log.Printf("Error discarding expired remote sign-ins: %v", err)
+		}
+	}
+}
+
+// confirmRemoteSignInByScan is a post-sign-in hook confirming a member's
+// pending remote sign-in when they scan their card
+func confirmRemoteSignInByScan(sc *ScanContext) error {
+	var id int64
+	err := db.QueryRow(`SELECT id FROM pending_signins WHERE member_id = ?`, sc.Member.ID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if deleted, err := deletePendingSignIn(id); err != nil || !deleted {
+		return err
+	}
+	recordAudit("remote_signin.confirmed", "scanner", fmt.Sprintf("pending=%d member=%d", id, sc.Member.ID))
+	return nil
+}
+
+// writePendingSignIn responds to a remote sign-in awaiting confirmation
+func writePendingSignIn(w http.ResponseWriter, p PendingSignIn) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"message": fmt.Sprintf("Sign-in pending: scan your card or ask an exec in the office to confirm it by %s",
+			p.ExpiresAt.Format("15:04")),
+		"status":     "pending",
+		"pending_id": p.ID,
+		"expires_at": p.ExpiresAt,
+	})
+}
+
+// handleRemoteSignIns lists the pending remote sign-ins
+func handleRemoteSignIns(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	if err := discardExpiredSignIns(time.Now()); err != nil {
+		log.Printf("Error discarding expired remote sign-ins: %v", err)
+	}
+	pending, err := loadPendingSignIns()
+	if err != nil {
+		log.Printf("Error querying pending sign-ins: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(pending)
+}
+
+// handleRemoteSignIn handles POST /remote-signins/{id}/confirm and /reject,
+// made for an exec or officer in the office identified by X-Discord-ID
+func handleRemoteSignIn(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := parseIDPath(r.URL.Path, "/remote-signins/")
+	if !ok {
+		http.Error(w, "Invalid pending sign-in ID", http.StatusBadRequest)
+		return
+	}
+	if action != "confirm" && action != "reject" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	approver, ok := memberFromRequest(w, r)
+	if !ok {
+		return
+	}
+	if approver.Role != roleExec && approver.Role != roleOfficer {
+		http.Error(w, "Only execs and officers can confirm remote sign-ins", http.StatusForbidden)
+		return
+	}
+	if _, inside, err := currentAttendees.get(approver.UID); err != nil {
+		writeSignInOutError(w, fmt.Errorf("%w: %v", errAttendeeStore, err))
+		return
+	} else if !inside {
+		http.Error(w, "You must be signed in at the office to confirm remote sign-ins", http.StatusForbidden)
+		return
+	}
+
+	p, err := loadPendingSignIn(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Pending sign-in not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying pending sign-in: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if p.MemberID == approver.ID {
+		http.Error(w, "You cannot confirm your own sign-in", http.StatusForbidden)
+		return
+	}
+	if !time.Now().Before(p.ExpiresAt) {
+		if err := discardExpiredSignIns(time.Now()); err != nil {
+			log.Printf("Error discarding expired remote sign-ins: %v", err)
+		}
+		http.Error(w, "Pending sign-in expired", http.StatusGone)
+		return
+	}
+
+	// Whoever deletes it first decides, should two execs answer at once
+	deleted, err := deletePendingSignIn(p.ID)
+	if err != nil {
+		log.Printf("Error deleting pending sign-in: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !deleted {
+		http.Error(w, "Pending sign-in not found", http.StatusNotFound)
+		return
+	}
+	detail := fmt.Sprintf("pending=%d member=%d by=%d", p.ID, p.MemberID, approver.ID)
+
+	if action == "reject" {
+		recordAudit("remote_signin.rejected", clientIP(r), detail)
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("Sign-in of %s rejected", p.Name)})
+		return
+	}
+
+	member, found := findMemberByID(p.MemberID)
+	if !found {
+		http.Error(w, "Member not found", http.StatusNotFound)
+		return
+	}
+	recordAudit("remote_signin.confirmed", clientIP(r), detail)
+	msg, err := performSignInAt(r.Context(), member, p.Room, p.RequestedAt)
+	if err != nil {
+		writeSignInOutError(w, err)
+		return
+	}
+	logHTTP.infof("%s", msg)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": msg, "status": "in"})
+}
+
+// pendingSignInConflict reports whether err is the unique constraint allowing
+// one pending sign-in per member
+func pendingSignInConflict(err error) bool {
+	return isUniqueViolation(err)
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Remote Sign-In Approval Tests
+// ============================================================================
+
+// requireRemoteApproval turns the approval policy on for a test, with Bob as
+// an exec who can confirm
+func requireRemoteApproval(t *testing.T, within time.Duration) {
+	t.Helper()
+
+	saved := remoteSignInApproval
+	remoteSignInApproval = within
+	t.Cleanup(func() { remoteSignInApproval = saved })
+
+	db.Exec(`UPDATE members SET role = 'exec' WHERE id = 2`)
+	loadMembersIntoCache()
+}
+
+// remoteSignIn calls /sign-in-discord for a Discord ID
+func remoteSignIn(discordID string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/sign-in-discord", bytes.NewBufferString(`{"discord_id":"`+discordID+`"}`))
+	rr := httptest.NewRecorder()
+	handleSignInWithDiscordID(rr, req)
+	return rr
+}
+
+// answerRemoteSignIn confirms or rejects a pending sign-in as the member with a Discord ID
+func answerRemoteSignIn(id int64, action, discordID string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/remote-signins/"+strconv.FormatInt(id, 10)+"/"+action, nil)
+	req.Header.Set("X-Discord-ID", discordID)
+	rr := httptest.NewRecorder()
+	handleRemoteSignIn(rr, req)
+	return rr
+}
+
+// requestPendingSignIn makes Alice's remote sign-in and returns its ID
+func requestPendingSignIn(t *testing.T) int64 {
+	t.Helper()
+
+	rr := remoteSignIn("111111111")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var resp struct {
+		Status    string `json:"status"`
+		PendingID int64  `json:"pending_id"`
+	}
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.Status != "pending" || resp.PendingID == 0 {
+		t.Fatalf("expected a pending sign-in, got %s", rr.Body.String())
+	}
+	return resp.PendingID
+}
+
+func TestRemoteSignIn_DisabledByDefault(t *testing.T) {
+	setupTest()
+
+	if rr := remoteSignIn("111111111"); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK without the policy, got %v", rr.Code)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
+		t.Error("expected Alice to be signed in right away")
+	}
+}
+
+func TestRemoteSignIn_ConfirmedByExec(t *testing.T) {
+	setupTest()
+	requireRemoteApproval(t, 10*time.Minute)
+
+	id := requestPendingSignIn(t)
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
+		t.Fatal("expected Alice not to be signed in before confirmation")
+	}
+	if rr := remoteSignIn("111111111"); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 for a second request, got %v", rr.Code)
+	}
+
+	// The exec must be in the office
+	if rr := answerRemoteSignIn(id, "confirm", "222222222"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for an exec not signed in, got %v", rr.Code)
+	}
+	performSignIn(context.Background(), cachedMember("TEST_UID_2"), "")
+	rr := answerRemoteSignIn(id, "confirm", "222222222")
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	signInTime, inside, _ := currentAttendees.get("TEST_UID_1")
+	if !inside || time.Since(signInTime) > time.Minute {
+		t.Errorf("expected Alice signed in from her request, got %v %v", inside, signInTime)
+	}
+	if rr := answerRemoteSignIn(id, "confirm", "222222222"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 once confirmed, got %v", rr.Code)
+	}
+
+	entries, _ := loadAuditEntries("remote_signin.confirmed", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 confirmed audit entry, got %d", len(entries))
+	}
+}
+
+func TestRemoteSignIn_OnlyExecs(t *testing.T) {
+	setupTest()
+	requireRemoteApproval(t, 10*time.Minute)
+	db.Exec(`UPDATE members SET role = 'member' WHERE id = 2`)
+	loadMembersIntoCache()
+
+	id := requestPendingSignIn(t)
+	performSignIn(context.Background(), cachedMember("TEST_UID_2"), "")
+	if rr := answerRemoteSignIn(id, "confirm", "222222222"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a member, got %v", rr.Code)
+	}
+}
+
+func TestRemoteSignIn_Rejected(t *testing.T) {
+	setupTest()
+	requireRemoteApproval(t, 10*time.Minute)
+
+	id := requestPendingSignIn(t)
+	performSignIn(context.Background(), cachedMember("TEST_UID_2"), "")
+	if rr := answerRemoteSignIn(id, "reject", "222222222"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); inside {
+		t.Error("expected Alice not to be signed in")
+	}
+
+	entries, _ := loadAuditEntries("remote_signin.rejected", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 rejected audit entry, got %d", len(entries))
+	}
+}
+
+func TestRemoteSignIn_ConfirmedByScan(t *testing.T) {
+	setupTest()
+	requireRemoteApproval(t, 10*time.Minute)
+
+	requestPendingSignIn(t)
+	if rr := scanCard("TEST_UID_1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	pending, _ := loadPendingSignIns()
+	if len(pending) != 0 {
+		t.Errorf("expected the scan to confirm the pending sign-in, got %+v", pending)
+	}
+	entries, _ := loadAuditEntries("remote_signin.confirmed", 10)
+	if len(entries) != 1 || entries[0].Actor != "scanner" {
+		t.Errorf("expected a confirmation by the scanner, got %+v", entries)
+	}
+}
+
+func TestRemoteSignIn_Expired(t *testing.T) {
+	setupTest()
+	requireRemoteApproval(t, 10*time.Minute)
+
+	id := requestPendingSignIn(t)
+	if err := discardExpiredSignIns(time.Now()); err != nil {
+		t.Fatalf("failed to discard: %v", err)
+	}
+	if pending, _ := loadPendingSignIns(); len(pending) != 1 {
+		t.Fatalf("expected the sign-in to still be pending, got %+v", pending)
+	}
+
+	discardExpiredSignIns(time.Now().Add(11 * time.Minute))
+	performSignIn(context.Background(), cachedMember("TEST_UID_2"), "")
+	if rr := answerRemoteSignIn(id, "confirm", "222222222"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 once discarded, got %v", rr.Code)
+	}
+	entries, _ := loadAuditEntries("remote_signin.discarded", 10)
+	if len(entries) != 1 {
+		t.Errorf("expected 1 discarded audit entry, got %d", len(entries))
+	}
+}
+
+func TestHandleRemoteSignIns_List(t *testing.T) {
+	setupTest()
+	requireRemoteApproval(t, 10*time.Minute)
+
+	requestPendingSignIn(t)
+
+	req, _ := http.NewRequest("GET", "/remote-signins", nil)
+	rr := httptest.NewRecorder()
+	handleRemoteSignIns(rr, req)
+
+	var pending []PendingSignIn
+	json.Unmarshal(rr.Body.Bytes(), &pending)
+	if len(pending) != 1 || pending[0].Name != "Alice" || pending[0].Room != defaultRoom {
+		t.Errorf("expected Alice's pending sign-in, got %+v", pending)
+	}
+}
@@ -0,0 +1,459 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// --- Reports ---
+//
+// Downloadable documents built from the same presence intervals as /stats,
+// for people who need a file rather than an API. Like /stats, days and times
+// are those of ?tz= or the report time zone.
+
+// loadActiveMembers returns every member of an organization that is not deleted
+func loadActiveMembers(org string) ([]Member, error) {
+	rows, err := db.Query(`SELECT id, name, uid, discord_id, role, status, org_id FROM members WHERE deleted_at IS NULL AND org_id = ?`, org)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var members []Member
+	for rows.Next() {
+		var m Member
+		if err := rows.Scan(&m.ID, &m.Name, &m.UID, decrypted{&m.DiscordID}, &m.Role, &m.Status, &m.OrgID); err != nil {
+			return nil, err
+		}
+		members = append(members, m)
+	}
+	return members, rows.Err()
+}
+
+// reportTerm resolves ?term=, defaulting to the current term. It writes an
+// error response and returns false if there is no such term.
+func reportTerm(w http.ResponseWriter, r *http.Request) (Term, bool) {
+	term, found, ok := termFromParam(w, r)
+	if !ok {
+		return Term{}, false
+	}
+	if found {
+		return term, true
+	}
+
+	term, found, err := currentTerm(time.Now())
+	if err != nil {
+		log.Printf("Error loading current term: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return Term{}, false
+	}
+	if !found {
+		http.Error(w, "'term' parameter is required when no term is in progress", http.StatusBadRequest)
+		return Term{}, false
+	}
+	return term, true
+}
+
+// termReportSheets builds the sheets of a term report: a summary, hours per
+// member with their goal, and daily occupancy in a time zone
+func termReportSheets(term Term, members []Member, intervals []presenceInterval, now time.Time, loc *time.Location) ([]xlsxSheet, error) {
+	closed, err := closureDays(term.Start, term.End)
+	if err != nil {
+		return nil, err
+	}
+
+	type memberRow struct {
+		member Member
+		visits int
+		hours  float64
+	}
+	rows := make([]memberRow, 0, len(members))
+	for _, m := range members {
+		row := memberRow{member: m}
+		for _, p := range intervals {
+			if p.MemberID == m.ID {
+				if _, ok := clipInterval(p, term.Start, term.End); ok {
+					row.visits++
+				}
+			}
+		}
+		var total time.Duration
+		for _, p := range memberIntervals(intervals, m.ID, term.Start, term.End) {
+			total += p.End.Sub(p.Start)
+		}
+		row.hours = total.Hours()
+		rows = append(rows, row)
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].hours != rows[j].hours {
+			return rows[i].hours > rows[j].hours
+		}
+		return rows[i].member.Name < rows[j].member.Name
+	})
+
+	hoursSheet := xlsxSheet{
+		Name:   "Member hours",
+		Header: []string{"Member ID", "Name", "Role", "Visits", "Hours", "Goal hours", "Goal reached"},
+	}
+	var totalHours float64
+	visitors := 0
+	for _, row := range rows {
+		goal, _, found, err := goalForMember(row.member, term.ID)
+		if err != nil {
+			return nil, err
+		}
+		var goalHours, reached interface{}
+		if found {
+			goalHours = goal.Hours
+			reached = "no"
+			if row.hours >= goal.Hours {
+				reached = "yes"
+			}
+		}
+		hoursSheet.Rows = append(hoursSheet.Rows, []interface{}{
+			row.member.ID, row.member.Name, row.member.Role, row.visits, row.hours, goalHours, reached,
+		})
+		totalHours += row.hours
+		if row.visits > 0 {
+			visitors++
+		}
+	}
+
+	daysSheet := xlsxSheet{
+		Name:   "Daily occupancy",
+		Header: []string{"Date", "Unique visitors", "Person hours", "Busiest hour", "First activity", "Last activity"},
+	}
+	for _, day := range summarizePeriods(intervals, term.Start, term.End, "day", loc) {
+		var busiest, first, last interface{}
+		if day.BusiestHour != nil {
+			busiest = *day.BusiestHour
+		}
+		if day.FirstActivity != nil {
+			first = *day.FirstActivity
+		}
+		if day.LastActivity != nil {
+			last = *day.LastActivity
+		}
+		daysSheet.Rows = append(daysSheet.Rows, []interface{}{
+			xlsxDate(day.PeriodStart), day.UniqueVisitors, day.PersonHours, busiest, first, last,
+		})
+	}
+
+	summarySheet := xlsxSheet{
+		Name:   "Summary",
+		Header: []string{"Item", "Value"},
+		Rows: [][]interface{}{
+			{"Term", term.Name},
+			{"Start", term.Start.In(loc)},
+			{"End", term.End.In(loc)},
+			{"Generated", now.In(loc)},
+			{"Time zone", loc.String()},
+			{"Members", len(members)},
+			{"Members who visited", visitors},
+			{"Total hours", totalHours},
+			{"Days with activity", len(daysSheet.Rows)},
+			{"Closure days", closed},
+		},
+	}
+
+	return []xlsxSheet{summarySheet, hoursSheet, daysSheet}, nil
+}
+
+// buildTermReport renders the term report workbook
+func buildTermReport(term Term, now time.Time, loc *time.Location, times string) ([]byte, error) {
+	intervals, err := loadPresenceIntervals(term.Start, term.End, now, times)
+	if err != nil {
+		return nil, err
+	}
+	intervals = filterOrg(intervals, defaultOrg)
+	members, err := loadActiveMembers(defaultOrg)
+	if err != nil {
+		return nil, err
+	}
+	sheets, err := termReportSheets(term, members, intervals, now, loc)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := writeXLSX(&buf, sheets); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleTermReportXLSX returns a term report as an Excel workbook
+// Query parameters:
+//   - term: term name (defaults to the current term)
+//   - tz: IANA time zone of the days and times
+//   - times: corrected (default) or raw
+func handleTermReportXLSX(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	term, ok := reportTerm(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := locationFromParam(w, r)
+	if !ok {
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := buildTermReport(term, time.Now(), loc, times)
+	if err != nil {
+		log.Printf("Error building term report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", xlsxContentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s-report.xlsx"`, term.Name))
+	w.Write(data)
+}
+
+// summaryDefaultRange is the period covered by /reports/summary.pdf when no from is given
+const summaryDefaultRange = 30 * 24 * time.Hour
+
+// summaryDailyLimit is the longest period charted per day; longer ones are charted per week
+const summaryDailyLimit = 62 * 24 * time.Hour
+
+// summaryTopMembers is the number of members listed in the summary
+const summaryTopMembers = 10
+
+// memberHours is a member's time in the office over a report period
+type memberHours struct {
+	Name  string
+	Hours float64
+}
+
+// attendanceSummary holds the figures of /reports/summary.pdf
+type attendanceSummary struct {
+	From, To       time.Time
+	Location       *time.Location // Time zone of the days and times
+	UniqueVisitors int
+	Visits         int
+	PersonHours    float64
+	Granularity    string          // day or week
+	Periods        []PeriodSummary // Periods with activity, oldest first
+	BusiestDay     *PeriodSummary
+	Weekdays       [7]float64 // Person-hours by weekday, Monday first
+	TopMembers     []memberHours
+}
+
+// summarizeAttendance computes the summary figures of intervals clipped to [from, to]
+func summarizeAttendance(intervals []presenceInterval, from, to time.Time, loc *time.Location) attendanceSummary {
+	s := attendanceSummary{From: from, To: to, Location: loc, Granularity: "day"}
+	if to.Sub(from) > summaryDailyLimit {
+		s.Granularity = "week"
+	}
+
+	names := make(map[int64]string)
+	for _, p := range intervals {
+		if _, ok := clipInterval(p, from, to); ok {
+			s.Visits++
+			names[p.MemberID] = p.Name
+		}
+	}
+	s.UniqueVisitors = len(names)
+
+	for id, name := range names {
+		var total time.Duration
+		for _, p := range memberIntervals(intervals, id, from, to) {
+			total += p.End.Sub(p.Start)
+		}
+		s.TopMembers = append(s.TopMembers, memberHours{Name: name, Hours: total.Hours()})
+	}
+	sort.Slice(s.TopMembers, func(i, j int) bool {
+		if s.TopMembers[i].Hours != s.TopMembers[j].Hours {
+			return s.TopMembers[i].Hours > s.TopMembers[j].Hours
+		}
+		return s.TopMembers[i].Name < s.TopMembers[j].Name
+	})
+	if len(s.TopMembers) > summaryTopMembers {
+		s.TopMembers = s.TopMembers[:summaryTopMembers]
+	}
+
+	for _, day := range summarizePeriods(intervals, from, to, "day", loc) {
+		s.PersonHours += day.PersonHours
+		s.Weekdays[weekdayIndex(day.PeriodStart.Weekday())] += day.PersonHours
+		if s.BusiestDay == nil || day.PersonHours > s.BusiestDay.PersonHours {
+			busiest := day
+			s.BusiestDay = &busiest
+		}
+		if s.Granularity == "day" {
+			s.Periods = append(s.Periods, day)
+		}
+	}
+	if s.Granularity == "week" {
+		s.Periods = summarizePeriods(intervals, from, to, "week", loc)
+	}
+	return s
+}
+
+// drawBarChart draws a titled bar chart of values in the box at (x, y) of
+// size w x h, labelling at most about 12 bars
+func drawBarChart(p *pdfPage, x, y, w, h float64, title string, values []float64, labels []string) {
+	p.text(x, y+h+8, 11, true, title)
+	p.line(x, y, x+w, y)
+	p.line(x, y, x, y+h)
+
+	peak := 0.0
+	for _, v := range values {
+		peak = max(peak, v)
+	}
+	if len(values) == 0 || peak == 0 {
+		p.text(x+8, y+h/2, 9, false, "No attendance in this period")
+		return
+	}
+	p.text(x+4, y+h-10, 8, false, fmt.Sprintf("%.1f h", peak))
+
+	slot := w / float64(len(values))
+	step := (len(values) + 11) / 12
+	for i, v := range values {
+		barX := x + float64(i)*slot + slot*0.15
+		p.rect(barX, y, slot*0.7, v/peak*(h-16), 0.35)
+		if i%step == 0 && i < len(labels) {
+			p.text(barX, y-11, 7, false, labels[i])
+		}
+	}
+}
+
+// renderSummaryPDF lays out the summary on one page
+func renderSummaryPDF(s attendanceSummary, now time.Time) *pdfPage {
+	p := &pdfPage{}
+	const left, width = 54.0, 504.0
+
+	p.text(left, 740, 20, true, "Office attendance summary")
+	p.text(left, 722, 10, false, fmt.Sprintf("%s to %s, generated %s (%s)",
+		s.From.In(s.Location).Format("2006-01-02 15:04"), s.To.In(s.Location).Format("2006-01-02 15:04"),
+		now.In(s.Location).Format("2006-01-02 15:04"), s.Location))
+
+	average := 0.0
+	if s.Visits > 0 {
+		average = s.PersonHours / float64(s.Visits)
+	}
+	busiest := "-"
+	if s.BusiestDay != nil {
+		busiest = s.BusiestDay.PeriodStart.Format("Mon Jan 2")
+	}
+	stats := []struct{ label, value string }{
+		{"Unique visitors", fmt.Sprintf("%d", s.UniqueVisitors)},
+		{"Visits", fmt.Sprintf("%d", s.Visits)},
+		{"Person-hours", fmt.Sprintf("%.1f", s.PersonHours)},
+		{"Average visit", fmt.Sprintf("%.1f h", average)},
+		{"Busiest day", busiest},
+	}
+	box := width / float64(len(stats))
+	for i, stat := range stats {
+		x := left + float64(i)*box
+		p.rect(x, 660, box-8, 44, 0.92)
+		p.text(x+6, 690, 8, false, stat.label)
+		p.text(x+6, 668, 14, true, stat.value)
+	}
+
+	values := make([]float64, len(s.Periods))
+	labels := make([]string, len(s.Periods))
+	for i, period := range s.Periods {
+		values[i] = period.PersonHours
+		labels[i] = period.PeriodStart.Format("Jan 2")
+	}
+	drawBarChart(p, left, 450, width, 170, "Person-hours per "+s.Granularity, values, labels)
+
+	weekdays := []string{"Mon", "Tue", "Wed", "Thu", "Fri", "Sat", "Sun"}
+	drawBarChart(p, left, 270, width, 120, "Person-hours by weekday", s.Weekdays[:], weekdays)
+
+	p.text(left, 230, 11, true, "Top members by hours")
+	peak := 0.0
+	if len(s.TopMembers) > 0 {
+		peak = s.TopMembers[0].Hours
+	}
+	for i, m := range s.TopMembers {
+		y := 212 - float64(i)*16
+		name := m.Name
+		if len([]rune(name)) > 36 {
+			name = string([]rune(name)[:35]) + "..."
+		}
+		p.text(left, y, 9, false, name)
+		if peak > 0 {
+			p.rect(left+220, y-1, m.Hours/peak*230, 9, 0.35)
+		}
+		p.text(left+456, y, 9, false, fmt.Sprintf("%.1f h", m.Hours))
+	}
+	return p
+}
+
+// buildSummaryReport renders the attendance summary PDF for [from, to] in a time zone
+func buildSummaryReport(from, to, now time.Time, loc *time.Location, times string) ([]byte, error) {
+	intervals, err := loadPresenceIntervals(from, to, now, times)
+	if err != nil {
+		return nil, err
+	}
+	intervals = filterOrg(intervals, defaultOrg)
+
+	page := renderSummaryPDF(summarizeAttendance(intervals, from, to, loc), now)
+	var buf bytes.Buffer
+	if err := writePDF(&buf, "Office attendance summary", []*pdfPage{page}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// handleSummaryPDF returns an attendance summary with charts as a PDF
+// Query parameters:
+//   - from: RFC3339 formatted start (defaults to 30 days before to)
+//   - to: RFC3339 formatted end (defaults to now)
+//   - term: term name instead of from/to
+//   - tz: IANA time zone of the days and times
+//   - times: corrected (default) or raw
+func handleSummaryPDF(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := locationFromParam(w, r)
+	if !ok {
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+	now := time.Now()
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.Add(-summaryDefaultRange)
+	}
+	if !to.After(from) {
+		http.Error(w, "'from' must be before 'to' and not in the future", http.StatusBadRequest)
+		return
+	}
+
+	data, err := buildSummaryReport(from, to, now, loc, times)
+	if err != nil {
+		log.Printf("Error building summary report: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="summary-%s.pdf"`, to.In(loc).Format("2006-01-02")))
+	w.Write(data)
+}
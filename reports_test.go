@@ -0,0 +1,164 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /reports Endpoint Tests
+// ============================================================================
+
+func TestHandleTermReportXLSX(t *testing.T) {
+	setupTest()
+
+	start := time.Now().Add(-10 * 24 * time.Hour).Truncate(time.Hour)
+	term := createTestTerm(t, "fall-2025", start, start.Add(90*24*time.Hour))
+	if _, err := db.Exec(`INSERT INTO goals (term_id, role, hours) VALUES (?, 'member', 2)`, term.ID); err != nil {
+		t.Fatalf("failed to create goal: %v", err)
+	}
+
+	visit := start.Add(48 * time.Hour)
+	saveVisitToDB(1, visit, visit.Add(3*time.Hour))
+	saveVisitToDB(2, visit, visit.Add(time.Hour))
+
+	req, _ := http.NewRequest("GET", "/reports/term.xlsx?term=fall-2025", nil)
+	rr := httptest.NewRecorder()
+	handleTermReportXLSX(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != xlsxContentType {
+		t.Errorf("unexpected Content-Type %q", rr.Header().Get("Content-Type"))
+	}
+	if !strings.Contains(rr.Header().Get("Content-Disposition"), `filename="fall-2025-report.xlsx"`) {
+		t.Errorf("unexpected Content-Disposition %q", rr.Header().Get("Content-Disposition"))
+	}
+
+	files := readXLSX(t, rr.Body.Bytes())
+	workbook := files["xl/workbook.xml"]
+	for _, name := range []string{"Summary", "Member hours", "Daily occupancy"} {
+		if !strings.Contains(workbook, `name="`+name+`"`) {
+			t.Errorf("expected a %q sheet, got %s", name, workbook)
+		}
+	}
+
+	// Alice first with 3 hours and her goal reached, then Bob with 1 hour short of it
+	hours := files["xl/worksheets/sheet2.xml"]
+	alice := strings.Index(hours, ">Alice<")
+	bob := strings.Index(hours, ">Bob<")
+	if alice < 0 || bob < 0 || alice > bob {
+		t.Fatalf("expected Alice before Bob, got %s", hours)
+	}
+	if !strings.Contains(hours, `<c r="E2" s="4"><v>3</v></c>`) || !strings.Contains(hours, `<c r="G2" s="0" t="inlineStr"><is><t xml:space="preserve">yes</t>`) {
+		t.Errorf("expected 3 hours with the goal reached for Alice, got %s", hours)
+	}
+	if !strings.Contains(hours, `<c r="G3" s="0" t="inlineStr"><is><t xml:space="preserve">no</t>`) {
+		t.Errorf("expected Bob's goal not reached, got %s", hours)
+	}
+
+	if days := files["xl/worksheets/sheet3.xml"]; !strings.Contains(days, `<c r="B2" s="0"><v>2</v></c>`) {
+		t.Errorf("expected one day with 2 visitors, got %s", days)
+	}
+}
+
+func TestHandleTermReportXLSX_NoTerm(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/reports/term.xlsx", nil)
+	rr := httptest.NewRecorder()
+	handleTermReportXLSX(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request without a current term, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/reports/term.xlsx?term=missing", nil)
+	rr = httptest.NewRecorder()
+	handleTermReportXLSX(rr, req)
+
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found for an unknown term, got %v", rr.Code)
+	}
+}
+
+func TestSummarizeAttendance(t *testing.T) {
+	setupTest()
+
+	// Monday 10:00
+	monday := time.Date(2025, 3, 10, 10, 0, 0, 0, time.Local)
+	saveVisitToDB(1, monday, monday.Add(3*time.Hour))
+	saveVisitToDB(1, monday.Add(24*time.Hour), monday.Add(25*time.Hour))
+	saveVisitToDB(2, monday, monday.Add(time.Hour))
+
+	from, to := monday.Add(-24*time.Hour), monday.Add(7*24*time.Hour)
+	intervals, err := loadPresenceIntervals(from, to, to, sessionTimesCorrected)
+	if err != nil {
+		t.Fatalf("loadPresenceIntervals failed: %v", err)
+	}
+	s := summarizeAttendance(intervals, from, to, time.Local)
+
+	if s.UniqueVisitors != 2 || s.Visits != 3 || s.PersonHours != 5 {
+		t.Errorf("expected 2 visitors, 3 visits and 5 person-hours, got %d, %d, %v", s.UniqueVisitors, s.Visits, s.PersonHours)
+	}
+	if s.Granularity != "day" || len(s.Periods) != 2 {
+		t.Errorf("expected 2 days with activity, got %s %+v", s.Granularity, s.Periods)
+	}
+	if s.BusiestDay == nil || !s.BusiestDay.PeriodStart.Equal(periodStart(monday, "day")) {
+		t.Errorf("expected Monday as the busiest day, got %+v", s.BusiestDay)
+	}
+	if s.Weekdays[0] != 4 || s.Weekdays[1] != 1 {
+		t.Errorf("expected 4 hours on Monday and 1 on Tuesday, got %v", s.Weekdays)
+	}
+	if len(s.TopMembers) != 2 || s.TopMembers[0].Name != "Alice" || s.TopMembers[0].Hours != 4 {
+		t.Errorf("expected Alice first with 4 hours, got %+v", s.TopMembers)
+	}
+
+	if s := summarizeAttendance(intervals, from.Add(-90*24*time.Hour), to, time.Local); s.Granularity != "week" || len(s.Periods) != 1 {
+		t.Errorf("expected one week for a long range, got %s %+v", s.Granularity, s.Periods)
+	}
+}
+
+func TestHandleSummaryPDF(t *testing.T) {
+	setupTest()
+
+	visit := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	saveVisitToDB(1, visit, visit.Add(2*time.Hour))
+
+	req, _ := http.NewRequest("GET", "/reports/summary.pdf", nil)
+	rr := httptest.NewRecorder()
+	handleSummaryPDF(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Content-Type") != "application/pdf" {
+		t.Errorf("unexpected Content-Type %q", rr.Header().Get("Content-Type"))
+	}
+	checkPDFStructure(t, rr.Body.Bytes())
+
+	body := rr.Body.String()
+	for _, want := range []string{"(Office attendance summary)", "(Alice)", "(2.0 h)", "(Person-hours per day)"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("expected %s in the PDF", want)
+		}
+	}
+}
+
+func TestHandleSummaryPDF_InvalidRange(t *testing.T) {
+	setupTest()
+
+	future := time.Now().Add(time.Hour).Format(time.RFC3339)
+	req, _ := http.NewRequest("GET", "/reports/summary.pdf?from="+url.QueryEscape(future), nil)
+	rr := httptest.NewRecorder()
+	handleSummaryPDF(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for a future 'from', got %v", rr.Code)
+	}
+}
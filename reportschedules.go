@@ -0,0 +1,611 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// --- Scheduled Reports ---
+//
+// Admins configure recurring reports under /admin/report-schedules: which
+// report, how often, and where to deliver it. A schedule runs daily, weekly
+// (Mondays) or monthly (the 1st) at an hour of the host's report time zone
+// (see reportLocation); daily runs are skipped on closure days (see
+// closures.go). startReportScheduler checks
+// for due schedules every reportSchedulerInterval, claims each one by moving
+// its next_run_at forward (so only one replica runs it) and hands the run to
+// the background job pool. Delivery failures are retried by the pool; every
+// attempt is recorded in report_runs.
+//
+// Reports:
+//   - summary.pdf: the attendance summary of the period since the previous run
+//   - term.xlsx: the term report of the term in progress
+//
+// Targets:
+//   - email: sent through SMTP_HOST to comma separated addresses
+//   - discord: uploaded to a Discord webhook URL
+//   - webhook: POSTed as the request body to any URL (e.g. a Google Apps
+//     Script that appends it to a Sheet)
+
+// reportSchedulerInterval is how often due report schedules are checked
+const reportSchedulerInterval = time.Minute
+
+// reportRunHistory is the number of runs returned by /admin/report-schedules/{id}/runs
+const reportRunHistory = 50
+
+var (
+	reportKinds     = map[string]bool{"summary.pdf": true, "term.xlsx": true}
+	reportSchedules = map[string]bool{"daily": true, "weekly": true, "monthly": true}
+)
+
+// errNoTermInProgress is returned when a term report runs outside of any term
+var errNoTermInProgress = errors.New("no term in progress")
+
+// ReportSchedule is a report delivered on a recurring schedule
+type ReportSchedule struct {
+	ID          int64     `json:"id"`
+	Name        string    `json:"name"`
+	Report      string    `json:"report"`      // summary.pdf or term.xlsx
+	Schedule    string    `json:"schedule"`    // daily, weekly or monthly
+	Hour        int       `json:"hour"`        // Hour of day the report runs at, in the report time zone
+	Target      string    `json:"target"`      // email, discord or webhook
+	Destination string    `json:"destination"` // Email addresses or URL
+	Enabled     *bool     `json:"enabled"`     // Defaults to true
+	NextRunAt   time.Time `json:"next_run_at"`
+}
+
+// ReportRun is one attempt at running a scheduled report
+type ReportRun struct {
+	ID         int64     `json:"id"`
+	ScheduleID int64     `json:"schedule_id"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Status     string    `json:"status"` // succeeded or failed
+	Error      string    `json:"error,omitempty"`
+	Size       int       `json:"size"` // Report size in bytes
+}
+
+// reportScheduleColumns is the column list scanned by scanReportSchedule
+const reportScheduleColumns = `id, name, report, schedule, hour, target, destination, enabled, next_run_at`
+
+// scanReportSchedule reads a schedule row selected with reportScheduleColumns
+func scanReportSchedule(row rowScanner) (ReportSchedule, error) {
+	var s ReportSchedule
+	var enabled bool
+	var nextRunAt string
+	if err := row.Scan(&s.ID, &s.Name, &s.Report, &s.Schedule, &s.Hour, &s.Target, &s.Destination, &enabled, &nextRunAt); err != nil {
+		return ReportSchedule{}, err
+	}
+	s.Enabled = &enabled
+
+	var err error
+	if s.NextRunAt, err = time.Parse(time.RFC3339, nextRunAt); err != nil {
+		return ReportSchedule{}, err
+	}
+	return s, nil
+}
+
+// loadReportSchedule fetches a single schedule by ID
+func loadReportSchedule(id int64) (ReportSchedule, error) {
+	return scanReportSchedule(db.QueryRow(`SELECT `+reportScheduleColumns+` FROM report_schedules WHERE id = ?`, id))
+}
+
+// loadReportSchedules returns all schedules ordered by name
+func loadReportSchedules() ([]ReportSchedule, error) {
+	rows, err := db.Query(`SELECT ` + reportScheduleColumns + ` FROM report_schedules ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	schedules := []ReportSchedule{}
+	for rows.Next() {
+		s, err := scanReportSchedule(rows)
+		if err != nil {
+			return nil, err
+		}
+		schedules = append(schedules, s)
+	}
+	return schedules, rows.Err()
+}
+
+// loadReportRuns returns a schedule's most recent runs, newest first
+func loadReportRuns(scheduleID int64, limit int) ([]ReportRun, error) {
+	rows, err := db.Query(`SELECT id, schedule_id, started_at, finished_at, status, error, size
+		FROM report_runs WHERE schedule_id = ? ORDER BY id DESC LIMIT ?`, scheduleID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	runs := []ReportRun{}
+	for rows.Next() {
+		var run ReportRun
+		var startedAt, finishedAt string
+		if err := rows.Scan(&run.ID, &run.ScheduleID, &startedAt, &finishedAt, &run.Status, &run.Error, &run.Size); err != nil {
+			return nil, err
+		}
+		if run.StartedAt, err = time.Parse(time.RFC3339, startedAt); err != nil {
+			return nil, err
+		}
+		if run.FinishedAt, err = time.Parse(time.RFC3339, finishedAt); err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
+
+// nextReportRun returns the first run time of a schedule after the given
+// time, with the hour in the location of that time
+func nextReportRun(schedule string, hour int, after time.Time) time.Time {
+	loc := after.Location()
+	switch schedule {
+	case "weekly":
+		next := time.Date(after.Year(), after.Month(), after.Day(), hour, 0, 0, 0, loc)
+		next = next.AddDate(0, 0, -weekdayIndex(next.Weekday()))
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 7)
+		}
+		return next
+	case "monthly":
+		next := time.Date(after.Year(), after.Month(), 1, hour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 1, 0)
+		}
+		return next
+	default:
+		next := time.Date(after.Year(), after.Month(), after.Day(), hour, 0, 0, 0, loc)
+		if !next.After(after) {
+			next = next.AddDate(0, 0, 1)
+		}
+		return next
+	}
+}
+
+// reportPeriodStart returns the start of the period covered by a run at runAt:
+// the previous day, week or month
+func reportPeriodStart(schedule string, runAt time.Time) time.Time {
+	switch schedule {
+	case "weekly":
+		return runAt.AddDate(0, 0, -7)
+	case "monthly":
+		return runAt.AddDate(0, -1, 0)
+	default:
+		return runAt.AddDate(0, 0, -1)
+	}
+}
+
+// generateScheduledReport renders a schedule's report for a run at runAt and
+// returns it with its file name and content type
+func generateScheduledReport(s ReportSchedule, runAt time.Time) ([]byte, string, string, error) {
+	loc := reportLocation(defaultOrg)
+	switch s.Report {
+	case "term.xlsx":
+		term, found, err := currentTerm(runAt)
+		if err != nil {
+			return nil, "", "", err
+		}
+		if !found {
+			return nil, "", "", errNoTermInProgress
+		}
+		data, err := buildTermReport(term, time.Now(), loc, sessionTimesCorrected)
+		return data, term.Name + "-report.xlsx", xlsxContentType, err
+	default:
+		data, err := buildSummaryReport(reportPeriodStart(s.Schedule, runAt), runAt, time.Now(), loc, sessionTimesCorrected)
+		return data, "summary-" + runAt.In(loc).Format("2006-01-02") + ".pdf", "application/pdf", err
+	}
+}
+
+// splitAddresses splits a comma separated list of email addresses
+func splitAddresses(list string) []string {
+	var addresses []string
+	for _, a := range strings.Split(list, ",") {
+		if a = strings.TrimSpace(a); a != "" {
+			addresses = append(addresses, a)
+		}
+	}
+	return addresses
+}
+
+// base64Lines encodes data as base64 in lines of 76 characters, as MIME requires
+func base64Lines(data []byte) []byte {
+	encoded := base64.StdEncoding.EncodeToString(data)
+	var b bytes.Buffer
+	for len(encoded) > 76 {
+		b.WriteString(encoded[:76] + "\r\n")
+		encoded = encoded[76:]
+	}
+	b.WriteString(encoded + "\r\n")
+	return b.Bytes()
+}
+
+// buildReportEmail returns an email message with a report attached
+func buildReportEmail(from string, to []string, subject, body, filename, contentType string, data []byte) ([]byte, error) {
+	var msg bytes.Buffer
+	mw := multipart.NewWriter(&msg)
+
+	fmt.Fprintf(&msg, "From: %s\r\nTo: %s\r\nSubject: %s\r\nMIME-Version: 1.0\r\nContent-Type: multipart/mixed; boundary=%s\r\n\r\n",
+		from, strings.Join(to, ", "), subject, mw.Boundary())
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{"Content-Type": {"text/plain; charset=utf-8"}})
+	if err != nil {
+		return nil, err
+	}
+	text.Write([]byte(body + "\r\n"))
+
+	attachment, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {contentType},
+		"Content-Transfer-Encoding": {"base64"},
+		"Content-Disposition":       {fmt.Sprintf(`attachment; filename="%s"`, filename)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	attachment.Write(base64Lines(data))
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return msg.Bytes(), nil
+}
+
+// deliverReport sends a report to a schedule's target
+func deliverReport(s ReportSchedule, filename, contentType string, data []byte) error {
+	message := fmt.Sprintf("Scheduled report %q (%s)", s.Name, filename)
+	client := &http.Client{Timeout: 30 * time.Second}
+
+	switch s.Target {
+	case "email":
+		host := os.Getenv("SMTP_HOST")
+		if host == "" {
+			return fmt.Errorf("SMTP_HOST is not set")
+		}
+		from := os.Getenv("SMTP_FROM")
+		to := splitAddresses(s.Destination)
+		msg, err := buildReportEmail(from, to, message, "The report is attached.", filename, contentType, data)
+		if err != nil {
+			return err
+		}
+		var auth smtp.Auth
+		if user := os.Getenv("SMTP_USERNAME"); user != "" {
+			auth = smtp.PlainAuth("", user, os.Getenv("SMTP_PASSWORD"), strings.Split(host, ":")[0])
+		}
+		return smtp.SendMail(host, auth, from, to, msg)
+
+	case "discord":
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		payload, _ := json.Marshal(map[string]string{"content": message})
+		mw.WriteField("payload_json", string(payload))
+		part, err := mw.CreateFormFile("files[0]", filename)
+		if err != nil {
+			return err
+		}
+		part.Write(data)
+		if err := mw.Close(); err != nil {
+			return err
+		}
+		return postReport(client, s.Destination, mw.FormDataContentType(), "", &body)
+
+	default:
+		return postReport(client, s.Destination, contentType, filename, bytes.NewReader(data))
+	}
+}
+
+// postReport POSTs a report body to a URL
+func postReport(client *http.Client, target, contentType, filename string, body io.Reader) error {
+	req, err := http.NewRequest(http.MethodPost, target, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if filename != "" {
+		req.Header.Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, filename))
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("%s returned status %d", req.URL.Host, resp.StatusCode)
+	}
+	return nil
+}
+
+// recordReportRun adds an attempt to a schedule's run history
+func recordReportRun(scheduleID int64, startedAt time.Time, size int, runErr error) {
+	status, errMsg := "succeeded", ""
+	if runErr != nil {
+		status, errMsg = "failed", runErr.Error()
+	}
+	if _, err := db.Exec(`INSERT INTO report_runs (schedule_id, started_at, finished_at, status, error, size) VALUES (?, ?, ?, ?, ?, ?)`,
+		scheduleID, startedAt.Format(time.RFC3339), time.Now().Format(time.RFC3339), status, errMsg, size); err != nil {
+		log.Printf("Error recording report run of schedule %d: %v", scheduleID, err)
+	}
+}
+
+// runReport generates and delivers a schedule's report for a run at runAt.
+// Reports that cannot be generated are recorded as failed and not retried;
+// delivery errors are returned so the job pool retries them.
+func runReport(s ReportSchedule, runAt time.Time) error {
+	startedAt := time.Now()
+	data, filename, contentType, err := generateScheduledReport(s, runAt)
+	if err != nil {
+		logIntegrations.errorf("Report schedule %q: failed to generate report: %v", s.Name, err)
+		recordReportRun(s.ID, startedAt, 0, fmt.Errorf("generating report: %w", err))
+		return nil
+	}
+
+	if err := deliverReport(s, filename, contentType, data); err != nil {
+		recordReportRun(s.ID, startedAt, len(data), fmt.Errorf("delivering to %s: %w", s.Target, err))
+		return err
+	}
+	logIntegrations.infof("Report schedule %q: delivered %s (%d bytes) by %s", s.Name, filename, len(data), s.Target)
+	recordReportRun(s.ID, startedAt, len(data), nil)
+	return nil
+}
+
+// submitReportRun queues a run of a schedule on the background job pool
+func submitReportRun(s ReportSchedule, runAt time.Time) {
+	jobs.submit("report:"+s.Name, func() error { return runReport(s, runAt) })
+}
+
+// runDueReports claims the enabled schedules due at now and submits their
+// runs. A schedule that missed several runs (server down) runs once.
+func runDueReports(now time.Time) error {
+	schedules, err := loadReportSchedules()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range schedules {
+		if !*s.Enabled || s.NextRunAt.After(now) {
+			continue
+		}
+		// Another replica may have claimed it already
+		next := nextReportRun(s.Schedule, s.Hour, now.In(reportLocation(defaultOrg)))
+		res, err := db.Exec(`UPDATE report_schedules SET next_run_at = ? WHERE id = ? AND next_run_at = ?`,
+			next.Format(time.RFC3339), s.ID, s.NextRunAt.Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n != 1 {
+			continue
+		}
+		if c, closed := closedOn(s.NextRunAt); closed && s.Schedule == "daily" {
+			log.Printf("Report schedule %s: skipped the run of %s, closed for %s", s.Name, closureDate(s.NextRunAt), c.Name)
+			continue
+		}
+		submitReportRun(s, s.NextRunAt)
+	}
+	return nil
+}
+
+// startReportScheduler periodically runs due report schedules
+func startReportScheduler() {
+	ticker := time.NewTicker(reportSchedulerInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := runDueReports(now); err != nil {
+			log.Printf("Error running report schedules: %v", err)
+		}
+	}
+}
+
+// decodeReportSchedule reads and validates a schedule payload
+func decodeReportSchedule(w http.ResponseWriter, r *http.Request) (ReportSchedule, bool) {
+	var req ReportSchedule
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return ReportSchedule{}, false
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	req.Destination = strings.TrimSpace(req.Destination)
+	if req.Name == "" || req.Destination == "" {
+		http.Error(w, "name and destination are required", http.StatusBadRequest)
+		return ReportSchedule{}, false
+	}
+	if !reportKinds[req.Report] {
+		http.Error(w, "Invalid 'report', expected summary.pdf or term.xlsx", http.StatusBadRequest)
+		return ReportSchedule{}, false
+	}
+	if !reportSchedules[req.Schedule] {
+		http.Error(w, "Invalid 'schedule', expected daily, weekly or monthly", http.StatusBadRequest)
+		return ReportSchedule{}, false
+	}
+	if req.Hour < 0 || req.Hour > 23 {
+		http.Error(w, "'hour' must be between 0 and 23", http.StatusBadRequest)
+		return ReportSchedule{}, false
+	}
+
+	switch req.Target {
+	case "email":
+		if os.Getenv("SMTP_HOST") == "" {
+			http.Error(w, "Email delivery requires SMTP_HOST to be configured", http.StatusBadRequest)
+			return ReportSchedule{}, false
+		}
+		for _, address := range splitAddresses(req.Destination) {
+			if _, err := mail.ParseAddress(address); err != nil {
+				http.Error(w, fmt.Sprintf("Invalid email address %q", address), http.StatusBadRequest)
+				return ReportSchedule{}, false
+			}
+		}
+	case "discord", "webhook":
+		u, err := url.Parse(req.Destination)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			http.Error(w, "Invalid destination, expected an http(s) URL", http.StatusBadRequest)
+			return ReportSchedule{}, false
+		}
+	default:
+		http.Error(w, "Invalid 'target', expected email, discord or webhook", http.StatusBadRequest)
+		return ReportSchedule{}, false
+	}
+
+	if req.Enabled == nil {
+		enabled := true
+		req.Enabled = &enabled
+	}
+	req.NextRunAt = nextReportRun(req.Schedule, req.Hour, time.Now().In(reportLocation(defaultOrg)))
+	return req, true
+}
+
+// handleReportSchedules supports GET to list schedules and POST to create one
+func handleReportSchedules(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		schedules, err := loadReportSchedules()
+		if err != nil {
+			log.Printf("Error querying report schedules: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedules)
+
+	case http.MethodPost:
+		req, ok := decodeReportSchedule(w, r)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`INSERT INTO report_schedules (name, report, schedule, hour, target, destination, enabled, next_run_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+			req.Name, req.Report, req.Schedule, req.Hour, req.Target, req.Destination, *req.Enabled, req.NextRunAt.Format(time.RFC3339))
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "A report schedule with this name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error inserting report schedule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		req.ID, _ = res.LastInsertId()
+		recordAudit("report_schedule.created", clientIP(r), fmt.Sprintf("schedule=%d name=%s report=%s target=%s", req.ID, req.Name, req.Report, req.Target))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleReportSchedule handles /admin/report-schedules/{id} (GET, PUT, DELETE),
+// /admin/report-schedules/{id}/runs (GET) and /admin/report-schedules/{id}/run (POST)
+func handleReportSchedule(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/admin/report-schedules/")
+	if !ok {
+		http.Error(w, "Invalid report schedule ID", http.StatusBadRequest)
+		return
+	}
+
+	schedule, err := loadReportSchedule(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Report schedule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying report schedule: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	switch sub {
+	case "":
+	case "runs":
+		if r.Method != http.MethodGet {
+			methodNotAllowed(w, http.MethodGet)
+			return
+		}
+		runs, err := loadReportRuns(id, reportRunHistory)
+		if err != nil {
+			log.Printf("Error querying report runs: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(runs)
+		return
+	case "run":
+		if r.Method != http.MethodPost {
+			methodNotAllowed(w, http.MethodPost)
+			return
+		}
+		submitReportRun(schedule, time.Now())
+		recordAudit("report_schedule.run", clientIP(r), fmt.Sprintf("schedule=%d name=%s", id, schedule.Name))
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]string{"message": "Report run queued"})
+		return
+	default:
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(schedule)
+
+	case http.MethodPut:
+		req, ok := decodeReportSchedule(w, r)
+		if !ok {
+			return
+		}
+
+		_, err := db.Exec(`UPDATE report_schedules SET name = ?, report = ?, schedule = ?, hour = ?, target = ?, destination = ?, enabled = ?, next_run_at = ?
+			WHERE id = ?`,
+			req.Name, req.Report, req.Schedule, req.Hour, req.Target, req.Destination, *req.Enabled, req.NextRunAt.Format(time.RFC3339), id)
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "A report schedule with this name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error updating report schedule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		req.ID = id
+		recordAudit("report_schedule.updated", clientIP(r), fmt.Sprintf("schedule=%d name=%s report=%s target=%s", id, req.Name, req.Report, req.Target))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+
+	case http.MethodDelete:
+		if _, err := db.Exec(`DELETE FROM report_schedules WHERE id = ?`, id); err != nil {
+			log.Printf("Error deleting report schedule: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		recordAudit("report_schedule.deleted", clientIP(r), fmt.Sprintf("schedule=%d name=%s", id, schedule.Name))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Report schedule deleted"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
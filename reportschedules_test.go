@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/mail"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Scheduled Report Tests
+// ============================================================================
+
+// reportReceiver is a test server recording the reports POSTed to it
+type reportReceiver struct {
+	mu       sync.Mutex
+	status   int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func startReportReceiver(t *testing.T, status int) (*reportReceiver, string) {
+	rr := &reportReceiver{status: status}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rr.mu.Lock()
+		rr.requests = append(rr.requests, r)
+		rr.bodies = append(rr.bodies, body)
+		rr.mu.Unlock()
+		w.WriteHeader(rr.status)
+	}))
+	t.Cleanup(server.Close)
+	return rr, server.URL
+}
+
+// createTestReportSchedule creates a schedule and returns it
+func createTestReportSchedule(t *testing.T, body string) ReportSchedule {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/admin/report-schedules", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleReportSchedules(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var s ReportSchedule
+	if err := json.Unmarshal(rr.Body.Bytes(), &s); err != nil {
+		t.Fatalf("failed to parse schedule: %v", err)
+	}
+	return s
+}
+
+func TestNextReportRun(t *testing.T) {
+	loc := time.Local
+	// Wednesday
+	now := time.Date(2025, 3, 12, 10, 30, 0, 0, loc)
+	tests := []struct {
+		schedule string
+		hour     int
+		want     time.Time
+	}{
+		{"daily", 11, time.Date(2025, 3, 12, 11, 0, 0, 0, loc)},
+		{"daily", 9, time.Date(2025, 3, 13, 9, 0, 0, 0, loc)},
+		{"weekly", 8, time.Date(2025, 3, 17, 8, 0, 0, 0, loc)},
+		{"monthly", 8, time.Date(2025, 4, 1, 8, 0, 0, 0, loc)},
+	}
+	for _, tt := range tests {
+		if got := nextReportRun(tt.schedule, tt.hour, now); !got.Equal(tt.want) {
+			t.Errorf("nextReportRun(%s, %d) = %v, want %v", tt.schedule, tt.hour, got, tt.want)
+		}
+	}
+
+	// A run exactly at the scheduled time moves to the next one
+	monday := time.Date(2025, 3, 17, 8, 0, 0, 0, loc)
+	if got := nextReportRun("weekly", 8, monday); !got.Equal(monday.AddDate(0, 0, 7)) {
+		t.Errorf("expected the following Monday, got %v", got)
+	}
+}
+
+func TestHandleReportSchedules_CreateAndList(t *testing.T) {
+	setupTest()
+
+	s := createTestReportSchedule(t, `{"name":"weekly board","report":"summary.pdf","schedule":"weekly","hour":8,"target":"webhook","destination":"https://example.com/hook"}`)
+	if s.ID == 0 || s.Enabled == nil || !*s.Enabled || !s.NextRunAt.After(time.Now()) || s.NextRunAt.Weekday() != time.Monday {
+		t.Errorf("unexpected schedule: %+v", s)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/report-schedules", nil)
+	rr := httptest.NewRecorder()
+	handleReportSchedules(rr, req)
+
+	var schedules []ReportSchedule
+	if err := json.Unmarshal(rr.Body.Bytes(), &schedules); err != nil || len(schedules) != 1 || schedules[0].Name != "weekly board" {
+		t.Errorf("expected the created schedule, got %s", rr.Body.String())
+	}
+
+	// Names are unique
+	req, _ = http.NewRequest("POST", "/admin/report-schedules", bytes.NewBufferString(
+		`{"name":"weekly board","report":"term.xlsx","schedule":"daily","hour":8,"target":"webhook","destination":"https://example.com/hook"}`))
+	rr = httptest.NewRecorder()
+	handleReportSchedules(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict for a duplicate name, got %v", rr.Code)
+	}
+}
+
+func TestHandleReportSchedules_CreateInvalid(t *testing.T) {
+	setupTest()
+
+	valid := map[string]interface{}{
+		"name": "r", "report": "summary.pdf", "schedule": "daily", "hour": 8, "target": "webhook", "destination": "https://example.com/hook",
+	}
+	tests := []struct {
+		field string
+		value interface{}
+	}{
+		{"name", ""},
+		{"report", "visits.csv"},
+		{"schedule", "hourly"},
+		{"hour", 24},
+		{"target", "sheets"},
+		{"destination", "ftp://example.com"},
+		{"target", "email"}, // SMTP_HOST is not set
+	}
+
+	for _, tt := range tests {
+		payload := make(map[string]interface{})
+		for k, v := range valid {
+			payload[k] = v
+		}
+		payload[tt.field] = tt.value
+		body, _ := json.Marshal(payload)
+
+		req, _ := http.NewRequest("POST", "/admin/report-schedules", bytes.NewReader(body))
+		rr := httptest.NewRecorder()
+		handleReportSchedules(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s=%v: expected 400 Bad Request, got %v", tt.field, tt.value, rr.Code)
+		}
+	}
+
+	t.Setenv("SMTP_HOST", "smtp.example.com:587")
+	for _, destination := range []string{"not an address", "a@example.com, nope"} {
+		payload := fmt.Sprintf(`{"name":"r","report":"summary.pdf","schedule":"daily","hour":8,"target":"email","destination":%q}`, destination)
+		req, _ := http.NewRequest("POST", "/admin/report-schedules", bytes.NewBufferString(payload))
+		rr := httptest.NewRecorder()
+		handleReportSchedules(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("destination %q: expected 400 Bad Request, got %v", destination, rr.Code)
+		}
+	}
+}
+
+func TestHandleReportSchedule_UpdateAndDelete(t *testing.T) {
+	setupTest()
+
+	s := createTestReportSchedule(t, `{"name":"daily","report":"summary.pdf","schedule":"daily","hour":8,"target":"webhook","destination":"https://example.com/hook"}`)
+	path := fmt.Sprintf("/admin/report-schedules/%d", s.ID)
+
+	req, _ := http.NewRequest("PUT", path, bytes.NewBufferString(
+		`{"name":"monthly","report":"term.xlsx","schedule":"monthly","hour":6,"target":"webhook","destination":"https://example.com/hook","enabled":false}`))
+	rr := httptest.NewRecorder()
+	handleReportSchedule(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	updated, err := loadReportSchedule(s.ID)
+	if err != nil {
+		t.Fatalf("loadReportSchedule failed: %v", err)
+	}
+	if updated.Name != "monthly" || updated.Report != "term.xlsx" || *updated.Enabled || updated.NextRunAt.Day() != 1 {
+		t.Errorf("unexpected schedule after update: %+v", updated)
+	}
+
+	req, _ = http.NewRequest("DELETE", path, nil)
+	rr = httptest.NewRecorder()
+	handleReportSchedule(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	handleReportSchedule(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 Not Found after delete, got %v", rr.Code)
+	}
+}
+
+func TestRunDueReports_DeliversToWebhook(t *testing.T) {
+	setupTest()
+
+	receiver, hookURL := startReportReceiver(t, http.StatusOK)
+	s := createTestReportSchedule(t, fmt.Sprintf(
+		`{"name":"daily","report":"summary.pdf","schedule":"daily","hour":8,"target":"webhook","destination":%q}`, hookURL))
+	due := time.Now().Add(-time.Minute).Truncate(time.Second)
+	if _, err := db.Exec(`UPDATE report_schedules SET next_run_at = ? WHERE id = ?`, due.Format(time.RFC3339), s.ID); err != nil {
+		t.Fatalf("failed to make the schedule due: %v", err)
+	}
+
+	if err := runDueReports(time.Now()); err != nil {
+		t.Fatalf("runDueReports failed: %v", err)
+	}
+	jobs.wait()
+
+	receiver.mu.Lock()
+	if len(receiver.requests) != 1 || receiver.requests[0].Header.Get("Content-Type") != "application/pdf" ||
+		!bytes.HasPrefix(receiver.bodies[0], []byte("%PDF-")) {
+		t.Errorf("expected one PDF delivered, got %d request(s)", len(receiver.requests))
+	}
+	receiver.mu.Unlock()
+
+	runs, err := loadReportRuns(s.ID, 10)
+	if err != nil || len(runs) != 1 || runs[0].Status != "succeeded" || runs[0].Size == 0 {
+		t.Errorf("expected one successful run, got %+v (%v)", runs, err)
+	}
+
+	// The schedule moved to its next run, so it is not due again
+	s, _ = loadReportSchedule(s.ID)
+	if !s.NextRunAt.After(time.Now()) {
+		t.Errorf("expected next_run_at in the future, got %v", s.NextRunAt)
+	}
+	runDueReports(time.Now())
+	jobs.wait()
+	if runs, _ := loadReportRuns(s.ID, 10); len(runs) != 1 {
+		t.Errorf("expected no second run, got %d", len(runs))
+	}
+}
+
+func TestRunDueReports_SkipsDisabled(t *testing.T) {
+	setupTest()
+
+	s := createTestReportSchedule(t, `{"name":"off","report":"summary.pdf","schedule":"daily","hour":8,"target":"webhook","destination":"http://127.0.0.1:1/hook","enabled":false}`)
+	db.Exec(`UPDATE report_schedules SET next_run_at = ? WHERE id = ?`, time.Now().Add(-time.Hour).Format(time.RFC3339), s.ID)
+
+	runDueReports(time.Now())
+	jobs.wait()
+
+	if runs, _ := loadReportRuns(s.ID, 10); len(runs) != 0 {
+		t.Errorf("expected a disabled schedule not to run, got %+v", runs)
+	}
+}
+
+func TestRunReport_DeliveryFailure(t *testing.T) {
+	setupTest()
+
+	_, hookURL := startReportReceiver(t, http.StatusInternalServerError)
+	s := createTestReportSchedule(t, fmt.Sprintf(
+		`{"name":"daily","report":"summary.pdf","schedule":"daily","hour":8,"target":"webhook","destination":%q}`, hookURL))
+
+	if err := runReport(s, time.Now()); err == nil {
+		t.Error("expected the delivery error to be returned for a retry")
+	}
+	runs, _ := loadReportRuns(s.ID, 10)
+	if len(runs) != 1 || runs[0].Status != "failed" || !strings.Contains(runs[0].Error, "status 500") {
+		t.Errorf("expected a failed run, got %+v", runs)
+	}
+}
+
+func TestRunReport_TermReportWithoutTerm(t *testing.T) {
+	setupTest()
+
+	receiver, hookURL := startReportReceiver(t, http.StatusOK)
+	s := createTestReportSchedule(t, fmt.Sprintf(
+		`{"name":"term","report":"term.xlsx","schedule":"weekly","hour":8,"target":"webhook","destination":%q}`, hookURL))
+
+	// Not retried: another attempt would fail the same way
+	if err := runReport(s, time.Now()); err != nil {
+		t.Errorf("expected no retry, got %v", err)
+	}
+	runs, _ := loadReportRuns(s.ID, 10)
+	if len(runs) != 1 || runs[0].Status != "failed" || !strings.Contains(runs[0].Error, errNoTermInProgress.Error()) {
+		t.Errorf("expected a failed run, got %+v", runs)
+	}
+	if len(receiver.requests) != 0 {
+		t.Error("expected nothing delivered")
+	}
+}
+
+func TestHandleReportSchedule_RunNowAndHistory(t *testing.T) {
+	setupTest()
+
+	start := time.Now().Add(-24 * time.Hour)
+	createTestTerm(t, "fall-2025", start, start.Add(90*24*time.Hour))
+	receiver, hookURL := startReportReceiver(t, http.StatusOK)
+	s := createTestReportSchedule(t, fmt.Sprintf(
+		`{"name":"term","report":"term.xlsx","schedule":"monthly","hour":8,"target":"webhook","destination":%q}`, hookURL))
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/admin/report-schedules/%d/run", s.ID), nil)
+	rr := httptest.NewRecorder()
+	handleReportSchedule(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted, got %v", rr.Code)
+	}
+	jobs.wait()
+
+	receiver.mu.Lock()
+	if len(receiver.requests) != 1 || !strings.Contains(receiver.requests[0].Header.Get("Content-Disposition"), "fall-2025-report.xlsx") {
+		t.Errorf("expected the term workbook delivered, got %d request(s)", len(receiver.requests))
+	}
+	receiver.mu.Unlock()
+
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/admin/report-schedules/%d/runs", s.ID), nil)
+	rr = httptest.NewRecorder()
+	handleReportSchedule(rr, req)
+
+	var runs []ReportRun
+	if err := json.Unmarshal(rr.Body.Bytes(), &runs); err != nil || len(runs) != 1 || runs[0].Status != "succeeded" {
+		t.Errorf("expected one successful run in the history, got %s", rr.Body.String())
+	}
+}
+
+func TestDeliverReport_Discord(t *testing.T) {
+	setupTest()
+
+	receiver, hookURL := startReportReceiver(t, http.StatusOK)
+	s := ReportSchedule{Name: "weekly", Target: "discord", Destination: hookURL}
+	if err := deliverReport(s, "summary.pdf", "application/pdf", []byte("%PDF-1.4")); err != nil {
+		t.Fatalf("deliverReport failed: %v", err)
+	}
+
+	receiver.mu.Lock()
+	defer receiver.mu.Unlock()
+	_, params, err := mime.ParseMediaType(receiver.requests[0].Header.Get("Content-Type"))
+	if err != nil {
+		t.Fatalf("expected a multipart request: %v", err)
+	}
+	form, err := multipart.NewReader(bytes.NewReader(receiver.bodies[0]), params["boundary"]).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatalf("failed to parse form: %v", err)
+	}
+	if !strings.Contains(form.Value["payload_json"][0], `Scheduled report \"weekly\"`) {
+		t.Errorf("unexpected payload_json %q", form.Value["payload_json"])
+	}
+	if files := form.File["files[0]"]; len(files) != 1 || files[0].Filename != "summary.pdf" {
+		t.Errorf("expected summary.pdf attached, got %+v", form.File)
+	}
+}
+
+func TestBuildReportEmail(t *testing.T) {
+	data := bytes.Repeat([]byte("report "), 40)
+	raw, err := buildReportEmail("reports@example.com", []string{"a@example.com", "b@example.com"}, "Weekly report", "Attached.",
+		"summary.pdf", "application/pdf", data)
+	if err != nil {
+		t.Fatalf("buildReportEmail failed: %v", err)
+	}
+
+	msg, err := mail.ReadMessage(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("not a valid message: %v", err)
+	}
+	if msg.Header.Get("To") != "a@example.com, b@example.com" || msg.Header.Get("Subject") != "Weekly report" {
+		t.Errorf("unexpected headers: %v", msg.Header)
+	}
+
+	_, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	if _, err := mr.NextPart(); err != nil {
+		t.Fatalf("missing text part: %v", err)
+	}
+	attachment, err := mr.NextPart()
+	if err != nil || attachment.FileName() != "summary.pdf" {
+		t.Fatalf("missing attachment: %v", err)
+	}
+	encoded, _ := io.ReadAll(attachment)
+	for _, line := range strings.Split(strings.TrimSpace(string(encoded)), "\r\n") {
+		if len(line) > 76 {
+			t.Errorf("base64 line longer than 76 characters: %d", len(line))
+		}
+	}
+	decoded, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(string(encoded), "\r\n", ""))
+	if err != nil || !bytes.Equal(decoded, data) {
+		t.Errorf("attachment does not decode to the report: %v", err)
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// --- Rendered Responses ---
+//
+// The door display, the kiosk and the website poll /count, /current and
+// /presence many times a minute and almost always get the same answer. Their
+// responses are encoded once and served from memory until what they show
+// changes: signing in or out and adding, editing or removing members bump the
+// generation of renderedResponses, as do opt-outs and settings changes.
+//
+// A rendered response is also kept at most until the end of the second it was
+// rendered in, so durations in /current stay current and changes made by other
+// instances sharing state (REDIS_URL, STATELESS) show within a second.
+
+// renderedResponse is an encoded response body
+type renderedResponse struct {
+	value   any    // What was encoded
+	body    []byte // JSON, with a trailing newline like json.Encoder
+	etag    string
+	gen     uint64 // Generation it was rendered at
+	expires time.Time
+}
+
+// responseCache keeps rendered responses by key until the generation changes
+type responseCache struct {
+	gen     atomic.Uint64
+	mu      sync.RWMutex
+	entries map[string]renderedResponse
+}
+
+// renderedResponses holds the responses of the polled endpoints
+var renderedResponses = &responseCache{entries: make(map[string]renderedResponse)}
+
+// jsonBuffers are reused to encode responses
+var jsonBuffers = sync.Pool{New: func() any { return new(bytes.Buffer) }}
+
+// invalidate drops every rendered response
+func (c *responseCache) invalidate() {
+	c.gen.Add(1)
+}
+
+// reset forgets all rendered responses
+func (c *responseCache) reset() {
+	c.mu.Lock()
+	c.entries = make(map[string]renderedResponse)
+	c.mu.Unlock()
+	c.invalidate()
+}
+
+// render returns the rendered response under key, building and encoding it
+// if there is none for the current generation and second
+func (c *responseCache) render(key string, now time.Time, build func() (any, error)) (renderedResponse, error) {
+	gen := c.gen.Load()
+	c.mu.RLock()
+	e, ok := c.entries[key]
+	c.mu.RUnlock()
+	if ok && e.gen == gen && now.Before(e.expires) {
+		return e, nil
+	}
+
+	// Built at gen, so a change while building is not hidden
+	value, err := build()
+	if err != nil {
+		return renderedResponse{}, err
+	}
+	buf := jsonBuffers.Get().(*bytes.Buffer)
+	buf.Reset()
+	defer jsonBuffers.Put(buf)
+	if err := json.NewEncoder(buf).Encode(value); err != nil {
+		return renderedResponse{}, err
+	}
+
+	body := bytes.Clone(buf.Bytes())
+	sum := sha256.Sum256(bytes.TrimSuffix(body, []byte("\n")))
+	e = renderedResponse{
+		value:   value,
+		body:    body,
+		etag:    `"` + hex.EncodeToString(sum[:8]) + `"`,
+		gen:     gen,
+		expires: now.Truncate(time.Second).Add(time.Second),
+	}
+	c.mu.Lock()
+	c.entries[key] = e
+	c.mu.Unlock()
+	return e, nil
+}
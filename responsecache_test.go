@@ -0,0 +1,134 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Rendered Response Tests
+// ============================================================================
+
+func TestResponseCache_RendersOncePerGeneration(t *testing.T) {
+	setupTest()
+
+	builds := 0
+	build := func() (any, error) {
+		builds++
+		return map[string]int{"count": builds}, nil
+	}
+
+	now := time.Now()
+	first, _ := renderedResponses.render("test", now, build)
+	second, _ := renderedResponses.render("test", now, build)
+	if builds != 1 || string(second.body) != string(first.body) || string(first.body) != "{\"count\":1}\n" {
+		t.Errorf("expected one build, got %d: %q", builds, second.body)
+	}
+
+	renderedResponses.invalidate()
+	if r, _ := renderedResponses.render("test", now, build); builds != 2 || string(r.body) != "{\"count\":2}\n" {
+		t.Errorf("expected a new build after invalidation, got %d: %q", builds, r.body)
+	}
+
+	// Responses are only kept for the second they were rendered in
+	renderedResponses.render("test", now.Truncate(time.Second).Add(time.Second), build)
+	if builds != 3 {
+		t.Errorf("expected a new build the next second, got %d", builds)
+	}
+}
+
+func TestHandleCount_InvalidatedBySignIn(t *testing.T) {
+	setupTest()
+
+	count := func() string {
+		rr := httptest.NewRecorder()
+		handleCount(rr, httptest.NewRequest("GET", "/count", nil))
+		return rr.Body.String()
+	}
+	if got := count(); got != "{\"count\":0}\n" {
+		t.Fatalf("expected nobody inside, got %q", got)
+	}
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+	if got := count(); got != "{\"count\":1}\n" {
+		t.Errorf("expected the sign-in to show at once, got %q", got)
+	}
+
+	currentAttendees.remove("TEST_UID_1")
+	if got := count(); got != "{\"count\":0}\n" {
+		t.Errorf("expected the sign-out to show at once, got %q", got)
+	}
+}
+
+func TestRenderedResponses_FewerAllocations(t *testing.T) {
+	setupTest()
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+	currentAttendees.signIn("TEST_UID_2", "", time.Now())
+
+	for _, c := range []struct {
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"/count?detailed=true", handleCount},
+		{"/current", handleCurrent},
+		{"/presence", handlePresence},
+	} {
+		req := httptest.NewRequest("GET", c.path, nil)
+		serve := func() { c.handler(httptest.NewRecorder(), req) }
+
+		// The second may end between runs, so take the lowest of a few
+		cached := testing.AllocsPerRun(20, serve)
+		for range 3 {
+			cached = min(cached, testing.AllocsPerRun(20, serve))
+		}
+		rendered := testing.AllocsPerRun(20, func() {
+			renderedResponses.invalidate()
+			serve()
+		})
+		if cached >= rendered {
+			t.Errorf("%s: expected fewer allocations when rendered, got %v cached and %v rendering", c.path, cached, rendered)
+		}
+	}
+}
+
+// benchmarkPolled serves a polled endpoint, rendering every time unless cached
+func benchmarkPolled(b *testing.B, path string, handler http.HandlerFunc, cached bool) {
+	setupTest()
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+	currentAttendees.signIn("TEST_UID_2", "", time.Now())
+	req := httptest.NewRequest("GET", path, nil)
+
+	b.ReportAllocs()
+	for b.Loop() {
+		if !cached {
+			renderedResponses.invalidate()
+		}
+		handler(httptest.NewRecorder(), req)
+	}
+}
+
+func BenchmarkHandleCount(b *testing.B) {
+	benchmarkPolled(b, "/count", handleCount, true)
+}
+
+func BenchmarkHandleCount_Rendering(b *testing.B) {
+	benchmarkPolled(b, "/count", handleCount, false)
+}
+
+func BenchmarkHandleCurrent(b *testing.B) {
+	benchmarkPolled(b, "/current", handleCurrent, true)
+}
+
+func BenchmarkHandleCurrent_Rendering(b *testing.B) {
+	benchmarkPolled(b, "/current", handleCurrent, false)
+}
+
+func BenchmarkHandlePresence(b *testing.B) {
+	benchmarkPolled(b, "/presence", handlePresence, true)
+}
+
+func BenchmarkHandlePresence_Rendering(b *testing.B) {
+	benchmarkPolled(b, "/presence", handlePresence, false)
+}
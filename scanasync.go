@@ -0,0 +1,262 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Asynchronous Scans ---
+//
+// POST /scan?async=true answers 202 Accepted with a token as soon as the
+// request is decoded, so the reader can beep right away even when sign-in
+// side effects are slow. The scan then goes through the usual pipeline on a
+// single background worker, in the order scans arrived, and its result is
+// kept for scanResultTTL:
+//   - GET /scan/result/{token} returns it, 202 with "state": "pending" until
+//     it is known (?wait= seconds to wait for it, at most 30)
+//
+// The result holds the status code and body /scan would have answered with,
+// always as JSON; the result itself may be fetched as MessagePack or CBOR.
+// Results are kept in memory like /announcements/next, so with shared state
+// the scanner must fetch them from the instance it posted to.
+
+const (
+	// scanResultTTL is how long a scan result can be fetched
+	scanResultTTL = 2 * time.Minute
+
+	// scanResultMaxWait caps how long /scan/result waits for a result
+	scanResultMaxWait = 30 * time.Second
+
+	// asyncScanQueueSize is how many scans may wait for the worker; past
+	// that, scans are processed before responding as without async
+	asyncScanQueueSize = 64
+
+	scanPending = "pending"
+	scanDone    = "done"
+)
+
+// ScanResult is the outcome of an asynchronous scan
+type ScanResult struct {
+	Token      string          `json:"token"`
+	State      string          `json:"state"` // pending or done
+	ReceivedAt time.Time       `json:"received_at"`
+	StatusCode int             `json:"status_code,omitempty"` // Status /scan would have answered with
+	Result     json.RawMessage `json:"result,omitempty"`      // Body /scan would have answered with on success
+	Error      string          `json:"error,omitempty"`       // Its error message otherwise
+}
+
+// scanResultEntry is a kept scan result
+type scanResultEntry struct {
+	result  ScanResult
+	done    chan struct{} // Closed once the result is known
+	expires time.Time
+}
+
+// scanResultStore keeps the results of asynchronous scans by token
+type scanResultStore struct {
+	mu      sync.Mutex
+	results map[string]*scanResultEntry
+}
+
+// Results of asynchronous scans for /scan/result
+var scanResults = &scanResultStore{results: make(map[string]*scanResultEntry)}
+
+// add keeps a pending result, dropping expired ones
+func (s *scanResultStore) add(token string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for t, e := range s.results {
+		if now.After(e.expires) {
+			delete(s.results, t)
+		}
+	}
+	s.results[token] = &scanResultEntry{
+		result:  ScanResult{Token: token, State: scanPending, ReceivedAt: now},
+		done:    make(chan struct{}),
+		expires: now.Add(scanResultTTL),
+	}
+}
+
+// complete records the response of a scan and wakes clients waiting for it
+func (s *scanResultStore) complete(token string, code int, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.results[token]
+	if !ok {
+		return
+	}
+	e.result.State, e.result.StatusCode = scanDone, code
+	if code == http.StatusOK {
+		e.result.Result = json.RawMessage(body)
+	} else {
+		e.result.Error = strings.TrimSpace(string(body))
+	}
+	e.expires = time.Now().Add(scanResultTTL)
+	close(e.done)
+}
+
+// get returns a result and a channel closed once it is known
+func (s *scanResultStore) get(token string, now time.Time) (ScanResult, <-chan struct{}, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.results[token]
+	if !ok || now.After(e.expires) {
+		return ScanResult{}, nil, false
+	}
+	return e.result, e.done, true
+}
+
+// reset forgets all results
+func (s *scanResultStore) reset() {
+	s.mu.Lock()
+	s.results = make(map[string]*scanResultEntry)
+	s.mu.Unlock()
+}
+
+// scanResponseRecorder captures the response of a scan processed in the background
+type scanResponseRecorder struct {
+	header http.Header
+	code   int
+	body   strings.Builder
+}
+
+func (r *scanResponseRecorder) Header() http.Header { return r.header }
+
+func (r *scanResponseRecorder) WriteHeader(code int) {
+	if r.code == 0 {
+		r.code = code
+	}
+}
+
+func (r *scanResponseRecorder) Write(b []byte) (int, error) {
+	r.WriteHeader(http.StatusOK)
+	return r.body.Write(b)
+}
+
+// asyncScan is a scan waiting for the background worker
+type asyncScan struct {
+	token string
+	sc    *ScanContext
+}
+
+var (
+	asyncScanQueue = make(chan asyncScan, asyncScanQueueSize)
+	asyncScanOnce  sync.Once
+)
+
+// processAsyncScan runs a queued scan through the pipeline and records its result
+func processAsyncScan(s asyncScan) {
+	rec := &scanResponseRecorder{header: make(http.Header)}
+	processScan(rec, s.sc)
+	if rec.code == 0 {
+		rec.code = http.StatusOK
+	}
+	scanResults.complete(s.token, rec.code, []byte(rec.body.String()))
+}
+
+// newScanToken returns a random token for an asynchronous scan
+func newScanToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "scan_" + hex.EncodeToString(b), nil
+}
+
+// acceptAsyncScan queues a scan and answers 202 with the token of its result
+func acceptAsyncScan(w http.ResponseWriter, sc *ScanContext) {
+	token, err := newScanToken()
+	if err != nil {
+		log.Printf("Error generating scan token: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	asyncScanOnce.Do(func() {
+		go func() {
+			for s := range asyncScanQueue {
+				processAsyncScan(s)
+			}
+		}()
+	})
+
+	// The scan outlives the request, but keeps its values (trace, device, org).
+	// Its result is recorded as JSON whatever the scanner accepts.
+	accepted := sc.Request
+	sc.Request = sc.Request.WithContext(context.WithoutCancel(sc.Request.Context()))
+	sc.Request.Header = sc.Request.Header.Clone()
+	sc.Request.Header.Del("Accept")
+	scanResults.add(token, sc.Time)
+	select {
+	case asyncScanQueue <- asyncScan{token: token, sc: sc}:
+	default:
+		// The worker is behind; better a slow beep than a lost scan
+		logHTTP.warnf("Warning: asynchronous scan queue is full, processing %s before responding", token)
+		processAsyncScan(asyncScan{token: token, sc: sc})
+	}
+
+	writeNegotiated(w, accepted, http.StatusAccepted, ScanResponse{Token: token, State: scanPending})
+}
+
+// handleScanResult returns the result of an asynchronous scan
+// Query parameters:
+//   - wait: seconds to wait for the result if it is not known yet (default 0, at most 30)
+//
+// Responds 202 Accepted while the scan is being processed and 404 Not Found
+// for unknown or expired tokens.
+func handleScanResult(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	token := strings.TrimPrefix(r.URL.Path, "/scan/result/")
+	var wait time.Duration
+	if s := r.URL.Query().Get("wait"); s != "" {
+		seconds, err := strconv.Atoi(s)
+		if err != nil || seconds < 0 || time.Duration(seconds)*time.Second > scanResultMaxWait {
+			http.Error(w, fmt.Sprintf("Invalid 'wait' parameter, expected 0 to %d seconds", int(scanResultMaxWait.Seconds())), http.StatusBadRequest)
+			return
+		}
+		wait = time.Duration(seconds) * time.Second
+	}
+
+	result, done, ok := scanResults.get(token, time.Now())
+	if !ok {
+		http.Error(w, "Scan result not found", http.StatusNotFound)
+		return
+	}
+	if result.State == scanPending && wait > 0 {
+		timeout := time.NewTimer(wait)
+		defer timeout.Stop()
+		select {
+		case <-done:
+			result, _, ok = scanResults.get(token, time.Now())
+			if !ok {
+				http.Error(w, "Scan result not found", http.StatusNotFound)
+				return
+			}
+		case <-timeout.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	code := http.StatusOK
+	if result.State == scanPending {
+		code = http.StatusAccepted
+	}
+	writeNegotiated(w, r, code, result)
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Asynchronous Scan Tests
+// ============================================================================
+
+// asyncScanToken posts an asynchronous scan and returns its token
+func asyncScanToken(t *testing.T, uid string) string {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/scan?async=true", bytes.NewBufferString(`{"uid":"`+uid+`"}`))
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp map[string]string
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp["state"] != scanPending || resp["token"] == "" {
+		t.Fatalf("expected a pending token, got %+v", resp)
+	}
+	return resp["token"]
+}
+
+// fetchScanResult calls /scan/result/{token}
+func fetchScanResult(token, query string) (*httptest.ResponseRecorder, ScanResult) {
+	req, _ := http.NewRequest("GET", "/scan/result/"+token+query, nil)
+	rr := httptest.NewRecorder()
+	handleScanResult(rr, req)
+
+	var result ScanResult
+	json.Unmarshal(rr.Body.Bytes(), &result)
+	return rr, result
+}
+
+func TestAsyncScan_Result(t *testing.T) {
+	setupTest()
+
+	token := asyncScanToken(t, "TEST_UID_1")
+	rr, result := fetchScanResult(token, "?wait=5")
+	if rr.Code != http.StatusOK || result.State != scanDone || result.StatusCode != http.StatusOK {
+		t.Fatalf("expected a finished scan, got %v %+v", rr.Code, result)
+	}
+
+	var resp map[string]string
+	json.Unmarshal(result.Result, &resp)
+	if resp["status"] != "in" || resp["announcement"] != "Welcome, Alice!" {
+		t.Errorf("expected the /scan response, got %s", result.Result)
+	}
+	if _, inside, _ := currentAttendees.get("TEST_UID_1"); !inside {
+		t.Error("expected Alice to be signed in")
+	}
+}
+
+func TestAsyncScan_InOrder(t *testing.T) {
+	setupTest()
+
+	first := asyncScanToken(t, "TEST_UID_1")
+	second := asyncScanToken(t, "TEST_UID_1")
+	fetchScanResult(first, "?wait=5")
+	_, result := fetchScanResult(second, "?wait=5")
+
+	var resp map[string]string
+	json.Unmarshal(result.Result, &resp)
+	if resp["status"] != "out" {
+		t.Errorf("expected the second scan to sign Alice out, got %+v", result)
+	}
+}
+
+func TestAsyncScan_Rejected(t *testing.T) {
+	setupTest()
+
+	token := asyncScanToken(t, "NO_SUCH_CARD")
+	_, result := fetchScanResult(token, "?wait=5")
+	if result.State != scanDone || result.StatusCode != http.StatusForbidden || result.Error != "Unknown UID" || result.Result != nil {
+		t.Errorf("expected the unknown card rejected, got %+v", result)
+	}
+}
+
+func TestScanResult_NotFoundOrPending(t *testing.T) {
+	setupTest()
+
+	if rr, _ := fetchScanResult("scan_nope", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown token, got %v", rr.Code)
+	}
+	if rr, _ := fetchScanResult("scan_nope", "?wait=31"); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a long wait, got %v", rr.Code)
+	}
+
+	now := time.Now()
+	scanResults.add("scan_pending", now)
+	if rr, result := fetchScanResult("scan_pending", ""); rr.Code != http.StatusAccepted || result.State != scanPending {
+		t.Errorf("expected 202 while pending, got %v %+v", rr.Code, result)
+	}
+
+	// Results expire
+	if _, _, ok := scanResults.get("scan_pending", now.Add(scanResultTTL+time.Second)); ok {
+		t.Error("expected the result to expire")
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// --- Protocol Buffers ---
+//
+// proto/scanner.proto is the schema of what scanners send and receive, shared
+// with the firmware so field names cannot drift between the repositories.
+// /scan and /devices/{id}/heartbeat accept bodies in that form with
+// Content-Type: application/x-protobuf, and answer in it with Accept:
+// application/x-protobuf. The messages are small, so they are encoded and
+// decoded here by hand rather than with generated code; the field numbers
+// below must match the .proto (TestScannerProtoSchema checks they do).
+
+const contentTypeProtobuf = "application/x-protobuf"
+
+// maxProtoBody is the largest protobuf body accepted from a device
+const maxProtoBody = 64 << 10
+
+// Field numbers of proto/scanner.proto
+const (
+	protoScanRequestUID  = 1
+	protoScanRequestRoom = 2
+	protoScanRequestTime = 3
+
+	protoScanResponseStatus       = 1
+	protoScanResponseMessage      = 2
+	protoScanResponseAnnouncement = 3
+	protoScanResponseToken        = 4
+	protoScanResponseState        = 5
+
+	protoHeartbeatTime = 1
+
+	protoHeartbeatResponseStatus     = 1
+	protoHeartbeatResponseServerTime = 2
+
+	// google.protobuf.Timestamp
+	protoTimestampSeconds = 1
+	protoTimestampNanos   = 2
+)
+
+// Protobuf wire types
+const (
+	wireVarint = 0
+	wireI64    = 1
+	wireLen    = 2
+	wireI32    = 5
+)
+
+// protoMessage is a response that can be written as protobuf
+type protoMessage interface {
+	marshalProto() []byte
+}
+
+// protoBody is a request body that can be read from protobuf
+type protoBody interface {
+	unmarshalProto(b []byte) error
+}
+
+// ScanResponse is the response of /scan, and of /scan?async=true
+type ScanResponse struct {
+	Announcement string `json:"announcement,omitempty"` // Speaker greeting, if any
+	Message      string `json:"message,omitempty"`
+	State        string `json:"state,omitempty"` // Asynchronous scans
+	Status       string `json:"status,omitempty"`
+	Token        string `json:"token,omitempty"` // Asynchronous scans
+}
+
+// HeartbeatResponse is the response of /devices/{id}/heartbeat
+type HeartbeatResponse struct {
+	Status     string    `json:"status"`
+	ServerTime time.Time `json:"server_time"`
+}
+
+// isProtobufBody reports whether a request's body is protobuf
+func isProtobufBody(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == contentTypeProtobuf
+}
+
+// decodeDeviceBody reads a device request as protobuf or JSON, by its
+// Content-Type. An empty body is io.EOF for JSON and an empty message for protobuf.
+func decodeDeviceBody(r *http.Request, v protoBody) error {
+	if !isProtobufBody(r) {
+		return json.NewDecoder(r.Body).Decode(v)
+	}
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxProtoBody+1))
+	if err != nil {
+		return err
+	}
+	if len(b) > maxProtoBody {
+		return fmt.Errorf("body larger than %d bytes", maxProtoBody)
+	}
+	return v.unmarshalProto(b)
+}
+
+// invalidBodyMessage is the error of an undecodable device request
+func invalidBodyMessage(r *http.Request) string {
+	if isProtobufBody(r) {
+		return "Invalid protobuf"
+	}
+	return "Invalid JSON"
+}
+
+// --- Encoding ---
+
+func appendProtoVarint(b []byte, field int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireVarint)
+	return binary.AppendUvarint(b, v)
+}
+
+func appendProtoBytes(b []byte, field int, v []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(field)<<3|wireLen)
+	b = binary.AppendUvarint(b, uint64(len(v)))
+	return append(b, v...)
+}
+
+// appendProtoString appends a string field, left out when empty like proto3 does
+func appendProtoString(b []byte, field int, v string) []byte {
+	if v == "" {
+		return b
+	}
+	return appendProtoBytes(b, field, []byte(v))
+}
+
+// appendProtoTimestamp appends a google.protobuf.Timestamp field
+func appendProtoTimestamp(b []byte, field int, t time.Time) []byte {
+	var ts []byte
+	if s := t.Unix(); s != 0 {
+		ts = appendProtoVarint(ts, protoTimestampSeconds, uint64(s))
+	}
+	if n := t.Nanosecond(); n != 0 {
+		ts = appendProtoVarint(ts, protoTimestampNanos, uint64(n))
+	}
+	return appendProtoBytes(b, field, ts)
+}
+
+func (s ScanResponse) marshalProto() []byte {
+	var b []byte
+	b = appendProtoString(b, protoScanResponseStatus, s.Status)
+	b = appendProtoString(b, protoScanResponseMessage, s.Message)
+	b = appendProtoString(b, protoScanResponseAnnouncement, s.Announcement)
+	b = appendProtoString(b, protoScanResponseToken, s.Token)
+	return appendProtoString(b, protoScanResponseState, s.State)
+}
+
+func (h HeartbeatResponse) marshalProto() []byte {
+	b := appendProtoString(nil, protoHeartbeatResponseStatus, h.Status)
+	return appendProtoTimestamp(b, protoHeartbeatResponseServerTime, h.ServerTime)
+}
+
+// --- Decoding ---
+
+var errProtoTruncated = errors.New("truncated protobuf message")
+
+// rangeProtoFields calls fn with each field of a message: its number, wire
+// type, and value (varints) or contents (length-delimited). Fixed-width
+// fields are skipped.
+func rangeProtoFields(b []byte, fn func(field, wire int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		tag, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errProtoTruncated
+		}
+		b = b[n:]
+		field, wire := int(tag>>3), int(tag&7)
+		if field == 0 {
+			return errors.New("invalid protobuf field number 0")
+		}
+
+		var v uint64
+		var data []byte
+		switch wire {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errProtoTruncated
+			}
+			b = b[n:]
+		case wireLen:
+			length, n := binary.Uvarint(b)
+			if n <= 0 || uint64(len(b)-n) < length {
+				return errProtoTruncated
+			}
+			data, b = b[n:n+int(length)], b[n+int(length):]
+		case wireI64, wireI32:
+			size := 8
+			if wire == wireI32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errProtoTruncated
+			}
+			b = b[size:]
+			continue
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", wire)
+		}
+		if err := fn(field, wire, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protoWireError is the error of a known field sent with the wrong wire type
+func protoWireError(message string, field int) error {
+	return fmt.Errorf("%s field %d has the wrong wire type", message, field)
+}
+
+// decodeProtoTimestamp reads a google.protobuf.Timestamp
+func decodeProtoTimestamp(b []byte) (time.Time, error) {
+	var seconds, nanos int64
+	err := rangeProtoFields(b, func(field, wire int, v uint64, _ []byte) error {
+		switch field {
+		case protoTimestampSeconds, protoTimestampNanos:
+			if wire != wireVarint {
+				return protoWireError("Timestamp", field)
+			}
+			if field == protoTimestampSeconds {
+				seconds = int64(v)
+			} else {
+				nanos = int64(int32(v))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	if nanos < 0 || nanos >= int64(time.Second) {
+		return time.Time{}, fmt.Errorf("timestamp nanos %d out of range", nanos)
+	}
+	return time.Unix(seconds, nanos).UTC(), nil
+}
+
+func (req *ScanRequest) unmarshalProto(b []byte) error {
+	return rangeProtoFields(b, func(field, wire int, _ uint64, data []byte) error {
+		switch field {
+		case protoScanRequestUID, protoScanRequestRoom, protoScanRequestTime:
+			if wire != wireLen {
+				return protoWireError("ScanRequest", field)
+			}
+		}
+		switch field {
+		case protoScanRequestUID:
+			req.UID = string(data)
+		case protoScanRequestRoom:
+			req.Room = string(data)
+		case protoScanRequestTime:
+			t, err := decodeProtoTimestamp(data)
+			if err != nil {
+				return err
+			}
+			req.Time = &t
+		}
+		return nil
+	})
+}
+
+func (req *HeartbeatRequest) unmarshalProto(b []byte) error {
+	return rangeProtoFields(b, func(field, wire int, _ uint64, data []byte) error {
+		if field != protoHeartbeatTime {
+			return nil
+		}
+		if wire != wireLen {
+			return protoWireError("Heartbeat", field)
+		}
+		t, err := decodeProtoTimestamp(data)
+		if err != nil {
+			return err
+		}
+		req.Time = &t
+		return nil
+	})
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Protocol Buffers Tests
+// ============================================================================
+
+func TestScannerProtoSchema(t *testing.T) {
+	data, err := os.ReadFile("proto/scanner.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// message Name { ... type field = N; ... }
+	schema := make(map[string]int)
+	message := ""
+	messageRe := regexp.MustCompile(`^message (\w+) \{`)
+	fieldRe := regexp.MustCompile(`^[\w.]+ (\w+) = (\d+);`)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		line = bytes.TrimSpace(line)
+		if m := messageRe.FindSubmatch(line); m != nil {
+			message = string(m[1])
+		} else if m := fieldRe.FindSubmatch(line); m != nil && message != "" {
+			n, _ := strconv.Atoi(string(m[2]))
+			schema[message+"."+string(m[1])] = n
+		}
+	}
+
+	codec := map[string]int{
+		"ScanRequest.uid":               protoScanRequestUID,
+		"ScanRequest.room":              protoScanRequestRoom,
+		"ScanRequest.time":              protoScanRequestTime,
+		"ScanResponse.status":           protoScanResponseStatus,
+		"ScanResponse.message":          protoScanResponseMessage,
+		"ScanResponse.announcement":     protoScanResponseAnnouncement,
+		"ScanResponse.token":            protoScanResponseToken,
+		"ScanResponse.state":            protoScanResponseState,
+		"Heartbeat.time":                protoHeartbeatTime,
+		"HeartbeatResponse.status":      protoHeartbeatResponseStatus,
+		"HeartbeatResponse.server_time": protoHeartbeatResponseServerTime,
+	}
+	if len(schema) != len(codec) {
+		t.Errorf("expected %d fields in the schema, got %v", len(codec), schema)
+	}
+	for field, n := range codec {
+		if schema[field] != n {
+			t.Errorf("%s: the codec uses field %d, the schema %d", field, n, schema[field])
+		}
+	}
+}
+
+// protoStrings returns the string fields of a message by number
+func protoStrings(t *testing.T, b []byte) map[int]string {
+	t.Helper()
+	fields := make(map[int]string)
+	err := rangeProtoFields(b, func(field, wire int, _ uint64, data []byte) error {
+		if wire == wireLen {
+			fields[field] = string(data)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("invalid protobuf %x: %v", b, err)
+	}
+	return fields
+}
+
+func TestHandleScan_Protobuf(t *testing.T) {
+	setupTest()
+
+	body := appendProtoString(nil, protoScanRequestUID, "TEST_UID_1")
+	body = appendProtoTimestamp(body, protoScanRequestTime, time.Now())
+	// Unknown fields, as from a newer firmware, are skipped
+	body = append(body, 0x49, 1, 2, 3, 4, 5, 6, 7, 8) // field 9, fixed64
+	body = appendProtoVarint(body, 10, 300)
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	req.Header.Set("Accept", contentTypeProtobuf)
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+
+	if rr.Code != http.StatusOK || rr.Header().Get("Content-Type") != contentTypeProtobuf {
+		t.Fatalf("expected a protobuf response, got %v %v; body=%q", rr.Code, rr.Header(), rr.Body.String())
+	}
+	resp := protoStrings(t, rr.Body.Bytes())
+	if resp[protoScanResponseStatus] != "in" || resp[protoScanResponseAnnouncement] != "Welcome, Alice!" {
+		t.Errorf("expected Alice signed in, got %q", resp)
+	}
+}
+
+func TestHandleScan_InvalidProtobuf(t *testing.T) {
+	setupTest()
+
+	// A string field whose length runs past the end of the body
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewReader([]byte{0x0a, 0x10, 'A'}))
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+	if rr.Code != http.StatusBadRequest || rr.Body.String() != "Invalid protobuf\n" {
+		t.Errorf("expected 400 Invalid protobuf, got %v %q", rr.Code, rr.Body.String())
+	}
+}
+
+func TestHandleDeviceHeartbeat_Protobuf(t *testing.T) {
+	setupTest()
+	device := createTestDevice(t, "front-door")
+
+	body := appendProtoTimestamp(nil, protoHeartbeatTime, time.Now().Add(20*time.Minute))
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/devices/%d/heartbeat", device.ID), bytes.NewReader(body))
+	req.Header.Set("Content-Type", contentTypeProtobuf)
+	req.Header.Set("Accept", contentTypeProtobuf)
+	rr := httptest.NewRecorder()
+	handleDevice(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	if updated, _ := loadDevice(device.ID); updated.ClockSkewSeconds == nil || *updated.ClockSkewSeconds < 1190 {
+		t.Errorf("expected the device clock read from the body, got %v", updated.ClockSkewSeconds)
+	}
+
+	resp := protoStrings(t, rr.Body.Bytes())
+	serverTime, err := decodeProtoTimestamp([]byte(resp[protoHeartbeatResponseServerTime]))
+	if resp[protoHeartbeatResponseStatus] != "ok" || err != nil || time.Since(serverTime) > time.Minute {
+		t.Errorf("expected ok and the server time, got %q (%v)", resp, err)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- Scan Pipeline ---
+//
+// handleScan only decodes the request, resolves the member and signs them in
+// or out. Everything else is a hook registered at one of these stages:
+//   - pre-validate: before the card is resolved to a member; hooks may rewrite
+//     the UID (card formats) or reject the scan (e.g. debounce)
+//   - validate: once the member and direction are known, before any state
+//     changes; hooks may reject the scan (e.g. capacity checks)
+//   - post-sign-in / post-sign-out: after the change is persisted, for side
+//     effects such as notifications; errors are logged, not returned
+//
+// Hooks run in registration order. A hook rejects a scan by returning a
+// scanRejection; any other error fails the scan with a 500.
+
+// scanStage is a point in scan processing where hooks run
+type scanStage int
+
+const (
+	scanStagePreValidate scanStage = iota
+	scanStageValidate
+	scanStagePostSignIn
+	scanStagePostSignOut
+)
+
+// String returns the stage name used in logs
+func (s scanStage) String() string {
+	switch s {
+	case scanStagePreValidate:
+		return "pre-validate"
+	case scanStageValidate:
+		return "validate"
+	case scanStagePostSignIn:
+		return "post-sign-in"
+	case scanStagePostSignOut:
+		return "post-sign-out"
+	}
+	return fmt.Sprintf("stage(%d)", int(s))
+}
+
+// ScanContext carries a scan through the pipeline
+type ScanContext struct {
+	Request   *http.Request
+	UID       string     // Scanned UID, canonical after pre-validate
+	Room      string     // Requested room, empty for defaultRoom
+	Time      time.Time  // Server time the scan was received
+	Device    *Device    // Scanning device, if identified
+	ClockTime *time.Time // Scanner clock reading, if sent
+	NFCKeyID  string     // Phone key used instead of a card, if any (see nfc.go)
+
+	// Set once the member is resolved
+	Member     Member
+	SigningIn  bool
+	SignInTime time.Time // Start of the session being closed when signing out
+
+	// Set once the member was signed in or out
+	Message      string
+	Announcement string // Greeting for a speaker, see announcements.go
+}
+
+// scanHook is a function run at a stage of the scan pipeline
+type scanHook func(sc *ScanContext) error
+
+// scanRejection rejects a scan with an HTTP status and message
+type scanRejection struct {
+	Status  int
+	Message string
+}
+
+func (e *scanRejection) Error() string {
+	return e.Message
+}
+
+// rejectScan returns a scanRejection for hooks to return
+func rejectScan(status int, format string, args ...interface{}) error {
+	return &scanRejection{Status: status, Message: fmt.Sprintf(format, args...)}
+}
+
+var (
+	scanHooksMu sync.RWMutex
+
+	// Registered hooks of every stage, in the order they run
+	scanHooks = map[scanStage][]scanHook{
+		scanStagePreValidate: {resolveScanDevice, recordScanContact, canonicalizeScanUID},
+		scanStageValidate:    {checkMemberStatus},
+		scanStagePostSignIn:  {announceScan, confirmRemoteSignInByScan, unlockDoor},
+		scanStagePostSignOut: {announceScan, unlockDoor},
+	}
+)
+
+// registerScanHook adds a hook to run at the given stage after those already registered
+func registerScanHook(stage scanStage, hook scanHook) {
+	scanHooksMu.Lock()
+	defer scanHooksMu.Unlock()
+	scanHooks[stage] = append(scanHooks[stage], hook)
+}
+
+// runScanHooks runs the hooks of a stage, stopping at the first error
+func runScanHooks(stage scanStage, sc *ScanContext) error {
+	scanHooksMu.RLock()
+	hooks := scanHooks[stage]
+	scanHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(sc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPostScanHooks runs post-sign-in or post-sign-out hooks, logging any errors
+func runPostScanHooks(stage scanStage, sc *ScanContext) {
+	scanHooksMu.RLock()
+	hooks := scanHooks[stage]
+	scanHooksMu.RUnlock()
+
+	for _, hook := range hooks {
+		if err := hook(sc); err != nil {
+			log.Printf("Warning: %s hook failed for %s: %v", stage, sc.Member.Name, err)
+		}
+	}
+}
+
+// writeScanError responds to a scan that failed in a pre-validate or validate hook
+func writeScanError(w http.ResponseWriter, stage scanStage, err error) {
+	var rejection *scanRejection
+	if errors.As(err, &rejection) {
+		http.Error(w, rejection.Message, rejection.Status)
+		return
+	}
+	log.Printf("Error in %s scan hook: %v", stage, err)
+	http.Error(w, "Internal server error", http.StatusInternalServerError)
+}
+
+// --- Device Identification ---
+
+// deviceIDHeader lets API key authenticated scanners name their device
+const deviceIDHeader = "X-Device-ID"
+
+// errUnknownDevice is returned by deviceFromRequest for an unregistered X-Device-ID
+var errUnknownDevice = errors.New("unknown device")
+
+// deviceFromRequest returns the scanner device making the request, identified
+// by its mTLS certificate or the X-Device-ID header
+func deviceFromRequest(r *http.Request) (Device, bool, error) {
+	if device, ok := deviceFromContext(r.Context()); ok {
+		return device, true, nil
+	}
+
+	idStr := r.Header.Get(deviceIDHeader)
+	if idStr == "" {
+		return Device{}, false, nil
+	}
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil || id < 1 {
+		return Device{}, false, errUnknownDevice
+	}
+
+	device, err := loadDevice(id)
+	if err == sql.ErrNoRows {
+		return Device{}, false, errUnknownDevice
+	} else if err != nil {
+		return Device{}, false, err
+	}
+	return device, true, nil
+}
+
+// resolveScanDevice is a pre-validate hook identifying the scanning device
+func resolveScanDevice(sc *ScanContext) error {
+	device, found, err := deviceFromRequest(sc.Request)
+	if err == errUnknownDevice || (found && device.OrgID != requestOrg(sc.Request)) {
+		return rejectScan(http.StatusBadRequest, "Unknown device")
+	} else if err != nil {
+		return err
+	}
+	if found {
+		sc.Device = &device
+	}
+	return nil
+}
+
+// scanFromRequest builds the pipeline context of a decoded scan request
+func scanFromRequest(r *http.Request, req ScanRequest) *ScanContext {
+	return &ScanContext{
+		Request:   r,
+		UID:       req.UID,
+		Room:      strings.TrimSpace(req.Room),
+		Time:      time.Now(),
+		ClockTime: req.Time,
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// Scan Pipeline Tests
+// ============================================================================
+
+// withScanHook registers a hook for the duration of a test
+func withScanHook(t *testing.T, stage scanStage, hook scanHook) {
+	t.Helper()
+
+	scanHooksMu.RLock()
+	saved := append([]scanHook(nil), scanHooks[stage]...)
+	scanHooksMu.RUnlock()
+	t.Cleanup(func() {
+		scanHooksMu.Lock()
+		scanHooks[stage] = saved
+		scanHooksMu.Unlock()
+	})
+
+	registerScanHook(stage, hook)
+}
+
+func scan(t *testing.T, uid string) *httptest.ResponseRecorder {
+	t.Helper()
+
+	req, _ := http.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid":"`+uid+`"}`))
+	rr := httptest.NewRecorder()
+	handleScan(rr, req)
+	return rr
+}
+
+func TestScanPipeline_HookOrder(t *testing.T) {
+	setupTest()
+
+	var calls []string
+	record := func(name string) scanHook {
+		return func(sc *ScanContext) error {
+			calls = append(calls, name)
+			return nil
+		}
+	}
+	withScanHook(t, scanStagePreValidate, record("pre-validate"))
+	withScanHook(t, scanStageValidate, record("validate"))
+	withScanHook(t, scanStagePostSignIn, record("post-sign-in"))
+	withScanHook(t, scanStagePostSignOut, record("post-sign-out"))
+
+	scan(t, "TEST_UID_1")
+	scan(t, "TEST_UID_1")
+
+	want := []string{"pre-validate", "validate", "post-sign-in", "pre-validate", "validate", "post-sign-out"}
+	if len(calls) != len(want) {
+		t.Fatalf("expected %v, got %v", want, calls)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, calls)
+		}
+	}
+}
+
+func TestScanPipeline_PreValidateRewritesUID(t *testing.T) {
+	setupTest()
+
+	withScanHook(t, scanStagePreValidate, func(sc *ScanContext) error {
+		if sc.UID == "ALIAS" {
+			sc.UID = "TEST_UID_2"
+		}
+		return nil
+	})
+
+	if rr := scan(t, "ALIAS"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if _, ok, _ := currentAttendees.get("TEST_UID_2"); !ok {
+		t.Error("expected Bob to be signed in through the rewritten UID")
+	}
+}
+
+func TestScanPipeline_ValidateRejects(t *testing.T) {
+	setupTest()
+
+	var seen ScanContext
+	withScanHook(t, scanStageValidate, func(sc *ScanContext) error {
+		seen = *sc
+		if sc.SigningIn {
+			return rejectScan(http.StatusConflict, "Office is full")
+		}
+		return nil
+	})
+
+	rr := scan(t, "TEST_UID_1")
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 Conflict, got %v", rr.Code)
+	}
+	if seen.Member.Name != "Alice" || !seen.SigningIn {
+		t.Errorf("expected the hook to see Alice signing in, got %+v", seen)
+	}
+	if currentAttendees.count() != 0 {
+		t.Errorf("expected nobody to be signed in, got %v", currentAttendees.snapshot())
+	}
+}
+
+func TestScanPipeline_HookError(t *testing.T) {
+	setupTest()
+
+	withScanHook(t, scanStagePreValidate, func(sc *ScanContext) error {
+		return errors.New("boom")
+	})
+
+	if rr := scan(t, "TEST_UID_1"); rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected 500, got %v", rr.Code)
+	}
+}
+
+func TestScanPipeline_PostHookErrorsDoNotFailScan(t *testing.T) {
+	setupTest()
+
+	var message string
+	withScanHook(t, scanStagePostSignIn, func(sc *ScanContext) error {
+		message = sc.Message
+		return errors.New("notification failed")
+	})
+
+	if rr := scan(t, "TEST_UID_1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if message != "Welcome, Alice!" {
+		t.Errorf("expected the hook to see the sign-in message, got %q", message)
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Search ---
+//
+// /search looks members (name, card UID, Discord ID) and audit entries
+// (action, actor, detail) up in SQLite FTS5 indexes. The indexes use the
+// trigram tokenizer, so any part of a word matches ("lic" finds Alice), and
+// are kept in sync with their tables by triggers. Terms shorter than three
+// characters cannot be matched by trigrams and are rejected.
+
+// searchMinTermLength is the shortest search term the trigram index can match
+const searchMinTermLength = 3
+
+// searchDefaultLimit is the number of results per type returned by default
+const searchDefaultLimit = 20
+
+// searchIndexes lists the indexed tables, their FTS table and indexed columns
+var searchIndexes = []struct {
+	table, fts, columns string
+}{
+	{"members", "members_fts", "name, uid, discord_id"},
+	{"audit_log", "audit_log_fts", "action, actor, detail"},
+}
+
+// SearchResult is one match returned by /search
+type SearchResult struct {
+	Type    string      `json:"type"`    // member or audit
+	ID      int64       `json:"id"`      // Member or audit entry ID
+	Snippet string      `json:"snippet"` // Matching text, matches wrapped in [ ]
+	Member  *Member     `json:"member,omitempty"`
+	Audit   *AuditEntry `json:"audit,omitempty"`
+}
+
+// createSearchIndex creates the full-text indexes, filling them from existing
+// rows the first time
+func createSearchIndex() error {
+	for _, idx := range searchIndexes {
+		var exists int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = ?`, idx.fts).Scan(&exists); err != nil {
+			return err
+		}
+
+		newColumns := "new." + strings.ReplaceAll(idx.columns, ", ", ", new.")
+		oldColumns := "old." + strings.ReplaceAll(idx.columns, ", ", ", old.")
+		statements := []string{
+			fmt.Sprintf(`CREATE VIRTUAL TABLE IF NOT EXISTS %s USING fts5(%s, content='%s', content_rowid='id', tokenize='trigram')`,
+				idx.fts, idx.columns, idx.table),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ai AFTER INSERT ON %[2]s BEGIN
+				INSERT INTO %[1]s (rowid, %[3]s) VALUES (new.id, %[4]s);
+			END`, idx.fts, idx.table, idx.columns, newColumns),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_ad AFTER DELETE ON %[2]s BEGIN
+				INSERT INTO %[1]s (%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+			END`, idx.fts, idx.table, idx.columns, oldColumns),
+			fmt.Sprintf(`CREATE TRIGGER IF NOT EXISTS %[1]s_au AFTER UPDATE ON %[2]s BEGIN
+				INSERT INTO %[1]s (%[1]s, rowid, %[3]s) VALUES ('delete', old.id, %[4]s);
+				INSERT INTO %[1]s (rowid, %[3]s) VALUES (new.id, %[5]s);
+			END`, idx.fts, idx.table, idx.columns, oldColumns, newColumns),
+		}
+		if exists == 0 {
+			statements = append(statements, fmt.Sprintf(`INSERT INTO %[1]s (%[1]s) VALUES ('rebuild')`, idx.fts))
+		}
+
+		for _, stmt := range statements {
+			if _, err := db.Exec(stmt); err != nil {
+				return fmt.Errorf("%s: %w", idx.fts, err)
+			}
+		}
+	}
+	return nil
+}
+
+// searchQuery turns user input into an FTS5 query matching every term
+// literally, or returns an error if a term is too short
+func searchQuery(q string) (string, error) {
+	terms := strings.Fields(q)
+	if len(terms) == 0 {
+		return "", fmt.Errorf("'q' parameter is required")
+	}
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		if len([]rune(term)) < searchMinTermLength {
+			return "", fmt.Errorf("search terms must be at least %d characters", searchMinTermLength)
+		}
+		quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+	}
+	return strings.Join(quoted, " "), nil
+}
+
+// searchMembers returns the members (not deleted) matching an FTS5 query, best first
+func searchMembers(query string, limit int) ([]SearchResult, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.name, m.uid, m.discord_id, m.role,
+			snippet(members_fts, -1, '[', ']', '...', 8)
+		FROM members_fts
+		JOIN members m ON m.id = members_fts.rowid
+		WHERE members_fts MATCH ? AND m.deleted_at IS NULL
+		ORDER BY rank LIMIT ?`, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var m Member
+		var snippet string
+		if err := rows.Scan(&m.ID, &m.Name, &m.UID, decrypted{&m.DiscordID}, &m.Role, &snippet); err != nil {
+			return nil, err
+		}
+		results = append(results, SearchResult{Type: "member", ID: m.ID, Snippet: snippet, Member: &m})
+	}
+	return results, rows.Err()
+}
+
+// searchAudit returns the audit entries matching an FTS5 query, newest first
+func searchAudit(query string, limit int) ([]SearchResult, error) {
+	rows, err := db.Query(`
+		SELECT a.id, a.created_at, a.action, a.actor, a.detail,
+			snippet(audit_log_fts, -1, '[', ']', '...', 8)
+		FROM audit_log_fts
+		JOIN audit_log a ON a.id = audit_log_fts.rowid
+		WHERE audit_log_fts MATCH ?
+		ORDER BY a.id DESC LIMIT ?`, query, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		var e AuditEntry
+		var createdAt, snippet string
+		if err := rows.Scan(&e.ID, &createdAt, &e.Action, &e.Actor, &e.Detail, &snippet); err != nil {
+			return nil, err
+		}
+		if e.Time, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return nil, err
+		}
+		results = append(results, SearchResult{Type: "audit", ID: e.ID, Snippet: snippet, Audit: &e})
+	}
+	return results, rows.Err()
+}
+
+// handleSearch searches members and audit entries
+// Query parameters:
+//   - q: search terms, all of which must match (each at least 3 characters)
+//   - type: member or audit (default both)
+//   - limit: maximum number of results per type (default 20)
+func handleSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	queryParams := r.URL.Query()
+	query, err := searchQuery(queryParams.Get("q"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	resultType := queryParams.Get("type")
+	if resultType != "" && resultType != "member" && resultType != "audit" {
+		http.Error(w, "Invalid 'type' parameter, expected member or audit", http.StatusBadRequest)
+		return
+	}
+
+	limit := searchDefaultLimit
+	if limitStr := queryParams.Get("limit"); limitStr != "" {
+		if n, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || n != 1 || limit < 1 {
+			http.Error(w, "Invalid 'limit' parameter, expected positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	results := []SearchResult{}
+	if resultType != "audit" {
+		members, err := searchMembers(query, limit)
+		if err != nil {
+			log.Printf("Error searching members: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		results = append(results, members...)
+	}
+	if resultType != "member" {
+		entries, err := searchAudit(query, limit)
+		if err != nil {
+			log.Printf("Error searching audit log: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		results = append(results, entries...)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(results)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ============================================================================
+// /search Endpoint Tests
+// ============================================================================
+
+// search calls /search and decodes the results
+func search(t *testing.T, query string) []SearchResult {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/search?"+query, nil)
+	rr := httptest.NewRecorder()
+	handleSearch(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var results []SearchResult
+	if err := json.Unmarshal(rr.Body.Bytes(), &results); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return results
+}
+
+func TestHandleSearch_Members(t *testing.T) {
+	setupTest()
+
+	// Members seeded before the index was created are found by substring
+	results := search(t, "q=lic")
+	if len(results) != 1 || results[0].Type != "member" || results[0].ID != 1 || results[0].Member == nil || results[0].Member.Name != "Alice" {
+		t.Fatalf("expected Alice, got %+v", results)
+	}
+	if results[0].Snippet != "A[lic]e" {
+		t.Errorf("unexpected snippet %q", results[0].Snippet)
+	}
+
+	// Discord IDs are indexed
+	results = search(t, "q=222222")
+	if len(results) != 1 || results[0].ID != 2 {
+		t.Fatalf("expected Bob by Discord ID, got %+v", results)
+	}
+}
+
+func TestHandleSearch_FollowsMemberChanges(t *testing.T) {
+	setupTest()
+
+	if _, err := db.Exec(`UPDATE members SET name = 'Alicia' WHERE id = 1`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`INSERT INTO members (id, name, uid, discord_id) VALUES (3, 'Carol', 'TEST_UID_3', '333333333')`); err != nil {
+		t.Fatal(err)
+	}
+
+	if results := search(t, "q=Alicia&type=member"); len(results) != 1 || results[0].ID != 1 {
+		t.Errorf("expected renamed member, got %+v", results)
+	}
+	if results := search(t, "q=Carol&type=member"); len(results) != 1 || results[0].ID != 3 {
+		t.Errorf("expected new member, got %+v", results)
+	}
+
+	// Soft-deleted members are left out
+	if _, err := db.Exec(`UPDATE members SET deleted_at = '2026-01-01T00:00:00Z' WHERE id = 3`); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "q=Carol&type=member"); len(results) != 0 {
+		t.Errorf("expected deleted member to be hidden, got %+v", results)
+	}
+
+	// Hard-deleted members leave the index
+	if _, err := db.Exec(`DELETE FROM members WHERE id = 2`); err != nil {
+		t.Fatal(err)
+	}
+	if results := search(t, "q=Bob&type=member"); len(results) != 0 {
+		t.Errorf("expected removed member to be gone, got %+v", results)
+	}
+}
+
+func TestHandleSearch_Audit(t *testing.T) {
+	setupTest()
+
+	recordAudit("member.deleted", "admin", "id=1 name=Alice")
+	recordAudit("network.rejected", "10.0.0.1", "POST /scan")
+	recordAudit("member.updated", "admin", "id=1 name=Alice")
+
+	// Newest first, all terms must match
+	results := search(t, "q=member+alice&type=audit")
+	if len(results) != 2 || results[0].Audit == nil || results[0].Audit.Action != "member.updated" || results[1].Audit.Action != "member.deleted" {
+		t.Fatalf("expected both member entries newest first, got %+v", results)
+	}
+	if results := search(t, "q=10.0.0&type=audit"); len(results) != 1 || results[0].Audit.Actor != "10.0.0.1" {
+		t.Errorf("expected entry by actor, got %+v", results)
+	}
+}
+
+func TestHandleSearch_Mixed(t *testing.T) {
+	setupTest()
+
+	recordAudit("member.updated", "admin", "name=Alice")
+
+	results := search(t, "q=Alice")
+	if len(results) != 2 || results[0].Type != "member" || results[1].Type != "audit" {
+		t.Fatalf("expected a member then an audit entry, got %+v", results)
+	}
+	if results := search(t, "q=Alice&limit=1&type=audit"); len(results) != 1 {
+		t.Errorf("expected limit to apply, got %+v", results)
+	}
+
+	// FTS syntax in the input is matched literally
+	if results := search(t, `q=Alice"+AND+"Bob`); len(results) != 0 {
+		t.Errorf("expected no results for literal query, got %+v", results)
+	}
+}
+
+func TestHandleSearch_InvalidParams(t *testing.T) {
+	setupTest()
+
+	for _, query := range []string{"", "q=", "q=al", "q=alice+b", "q=alice&type=visit", "q=alice&limit=0", "q=alice&limit=x"} {
+		req, _ := http.NewRequest("GET", "/search?"+query, nil)
+		rr := httptest.NewRecorder()
+		handleSearch(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400 Bad Request, got %v", query, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// --- Secrets from Files ---
+//
+// Every secret in secretSettings may be given as NAME_FILE, the path of a
+// file holding it, instead of NAME, so Docker and Compose secrets (mounted
+// under /run/secrets) keep tokens out of the environment shown by docker
+// inspect. At startup each NAME_FILE is read, the trailing newline trimmed,
+// and the value set as NAME for the rest of the server. Files readable by
+// everyone are refused, and so is a secret given both ways.
+
+// secretSettings lists the environment variables that hold secrets
+var secretSettings = []string{
+	"API_KEYS",
+	"SCANNER_API_KEY",
+	"DISCORD_BOT_API_KEY",
+	"DISCORD_BOT_TOKEN",
+	"SMTP_PASSWORD",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+	"ANONYMIZATION_KEY",
+	"SESSION_LEDGER_KEY",
+	"FIELD_ENCRYPTION_KEYS",
+	"REDIS_URL",
+	"SENTRY_DSN",
+	"OTEL_EXPORTER_OTLP_HEADERS",
+	"DOOR_RELAY_TOKEN",
+	// MQTT relay URLs may embed the broker's user and password
+	"DOOR_RELAY_URL",
+	// Webhook URLs embed the token that lets anyone post to the channel
+	"ALERT_WEBHOOK_URL",
+	"NOTIFY_WEBHOOK_URL",
+	"OFFICE_WEBHOOK_URL",
+	"AFTER_HOURS_WEBHOOK_URL",
+	"ERROR_WEBHOOK_URL",
+}
+
+// readSecretFile reads a secret from a file that only its owner and group may read
+func readSecretFile(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", err
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if mode := info.Mode().Perm(); mode&0o004 != 0 {
+		return "", fmt.Errorf("%s is readable by everyone (mode %04o), restrict it with chmod 600", path, mode)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(data), "\r\n"), nil
+}
+
+// loadSecretFiles sets each secret given as NAME_FILE from its file. NAME_FILE
+// is unset once read, so loading again only reads the secrets that failed.
+func loadSecretFiles() error {
+	for _, name := range secretSettings {
+		path := os.Getenv(name + "_FILE")
+		if path == "" {
+			continue
+		}
+		if os.Getenv(name) != "" {
+			return fmt.Errorf("set %s or %s_FILE, not both", name, name)
+		}
+
+		value, err := readSecretFile(path)
+		if err != nil {
+			return fmt.Errorf("%s_FILE: %w", name, err)
+		}
+		os.Setenv(name, value)
+		os.Unsetenv(name + "_FILE")
+	}
+	return nil
+}
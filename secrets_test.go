@@ -0,0 +1,86 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// Secret File Tests
+// ============================================================================
+
+// writeSecretFile writes a secret file with the given mode and returns its path
+func writeSecretFile(t *testing.T, content string, mode os.FileMode) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write secret: %v", err)
+	}
+	// Chmod after writing, so the umask does not change the mode
+	if err := os.Chmod(path, mode); err != nil {
+		t.Fatalf("failed to chmod secret: %v", err)
+	}
+	return path
+}
+
+func TestLoadSecretFiles(t *testing.T) {
+	t.Setenv("SMTP_PASSWORD", "")
+	t.Setenv("SMTP_PASSWORD_FILE", writeSecretFile(t, "hunter2\n", 0o600))
+	t.Setenv("DISCORD_BOT_TOKEN", "")
+	t.Setenv("DISCORD_BOT_TOKEN_FILE", writeSecretFile(t, "bot-token", 0o440))
+
+	if err := loadSecretFiles(); err != nil {
+		t.Fatalf("loadSecretFiles failed: %v", err)
+	}
+	if got := os.Getenv("SMTP_PASSWORD"); got != "hunter2" {
+		t.Errorf("expected the password without its newline, got %q", got)
+	}
+	if got := os.Getenv("DISCORD_BOT_TOKEN"); got != "bot-token" {
+		t.Errorf("expected the bot token, got %q", got)
+	}
+	if os.Getenv("SMTP_PASSWORD_FILE") != "" {
+		t.Error("expected SMTP_PASSWORD_FILE unset once read")
+	}
+
+	// Loading again is a no-op
+	if err := loadSecretFiles(); err != nil {
+		t.Errorf("expected loading again to succeed, got %v", err)
+	}
+}
+
+func TestLoadSecretFiles_Invalid(t *testing.T) {
+	cases := []struct {
+		name  string
+		value string
+		file  string
+		want  string
+	}{
+		{"world-readable", "", writeSecretFile(t, "key", 0o644), "readable by everyone"},
+		{"both", "key", writeSecretFile(t, "key", 0o600), "not both"},
+		{"missing", "", filepath.Join(t.TempDir(), "missing"), "no such file"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			t.Setenv("API_KEYS", c.value)
+			t.Setenv("API_KEYS_FILE", c.file)
+			err := loadSecretFiles()
+			if err == nil || !strings.Contains(err.Error(), c.want) {
+				t.Errorf("expected an error containing %q, got %v", c.want, err)
+			}
+		})
+	}
+}
+
+func TestLoadSecretFiles_FieldEncryptionKeys(t *testing.T) {
+	t.Setenv("FIELD_ENCRYPTION_KEYS", "")
+	t.Setenv("FIELD_ENCRYPTION_KEYS_FILE", writeSecretFile(t, testFieldKey(1)+"\n", 0o400))
+
+	if err := loadSecretFiles(); err != nil {
+		t.Fatalf("loadSecretFiles failed: %v", err)
+	}
+	if c, err := loadFieldEncryption(); err != nil || c == nil || len(c.keys) != 1 {
+		t.Errorf("expected one key from the file, got %v (%v)", c, err)
+	}
+}
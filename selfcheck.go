@@ -0,0 +1,319 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+// --- Self-Check ---
+//
+// --check validates what the server needs before it starts, prints a report
+// and exits, with status 1 if any check failed, for use as a container init
+// check or before a deploy:
+//   - configuration: every environment variable read at startup is parsed
+//     as the server would, and the mTLS listener's certificate is loaded
+//   - data folder: it exists, or can be created, and is writable
+//   - database: it opens, its schema migrations apply and it passes the
+//     integrity check
+//   - integrations: Redis answers a PING, and the hosts of the webhooks,
+//     SMTP, Sentry and the OTLP collector accept a TCP connection. Nothing
+//     is posted, so no notification is sent.
+//
+// Missing API keys are reported as a warning, which does not fail the check.
+
+const (
+	// How long an integration has to accept a connection
+	selfCheckTimeout = 5 * time.Second
+
+	checkOK      = "ok"
+	checkWarning = "warn"
+	checkFailed  = "FAIL"
+)
+
+// selfCheckResult is one line of the --check report
+type selfCheckResult struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// selfCheck collects the results of --check
+type selfCheck struct {
+	results []selfCheckResult
+}
+
+// record adds a check, failed if err is set
+func (c *selfCheck) record(name string, err error, detail string) {
+	if err != nil {
+		c.results = append(c.results, selfCheckResult{name, checkFailed, err.Error()})
+		return
+	}
+	c.results = append(c.results, selfCheckResult{name, checkOK, detail})
+}
+
+// warn adds a check that passed with a warning
+func (c *selfCheck) warn(name, detail string) {
+	c.results = append(c.results, selfCheckResult{name, checkWarning, detail})
+}
+
+// failed counts the failed checks
+func (c *selfCheck) failed() int {
+	n := 0
+	for _, r := range c.results {
+		if r.Status == checkFailed {
+			n++
+		}
+	}
+	return n
+}
+
+// write prints the report
+func (c *selfCheck) write(w io.Writer) {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, r := range c.results {
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Status, r.Name, r.Detail)
+	}
+	tw.Flush()
+
+	if n := c.failed(); n > 0 {
+		fmt.Fprintf(w, "\nSelf-check failed: %d of %d check(s) failed\n", n, len(c.results))
+	} else {
+		fmt.Fprintf(w, "\nSelf-check passed (%d checks)\n", len(c.results))
+	}
+}
+
+// configChecks parse the environment as main does
+var configChecks = []struct {
+	name string
+	load func() error
+}{
+	{"*_FILE secrets", loadSecretFiles},
+	{"DB_*", func() (err error) { dbConfig, err = loadDBConfig(); return err }},
+	{"HEAVY_READ_*", func() error { _, err := loadHeavyReadLimiter(dbConfig); return err }},
+	{"STATELESS", configureStatelessMode},
+	{"API_KEYS", func() error {
+		if _, err := loadAPIKeyScopes(); err != nil {
+			return err
+		}
+		_, err := loadAPIKeyOrgs()
+		return err
+	}},
+	{"NETWORK_POLICY", func() error { _, err := loadNetworkPolicies(); return err }},
+	{"office network", func() error { _, err := loadOfficeNetworkPolicy(); return err }},
+	{"OFFICE_HOURS", func() error { _, err := loadOfficeHours(); return err }},
+	{"BUDDY_RULE_AFTER", func() error { _, err := loadBuddyRuleAfter(); return err }},
+	{"FIELD_ENCRYPTION_KEYS", func() error { _, err := loadFieldEncryption(); return err }},
+	{"CORS", func() error { _, err := loadCORSConfig(); return err }},
+	{"DEVICE_OFFLINE_AFTER", func() error { _, err := loadDeviceOfflineAfter(); return err }},
+	{"INTEGRITY_CHECK_INTERVAL", func() error { _, err := loadIntegrityCheckInterval(); return err }},
+	{"MAINTENANCE_INTERVAL", func() error {
+		_, err := loadMaintenanceDuration("MAINTENANCE_INTERVAL", defaultMaintenanceInterval)
+		return err
+	}},
+	{"VACUUM_INTERVAL", func() error { _, err := loadMaintenanceDuration("VACUUM_INTERVAL", defaultVacuumInterval); return err }},
+	{"REMOTE_SIGNIN_APPROVAL", func() error { _, err := loadRemoteSignInApproval(); return err }},
+	{"TWO_PERSON_APPROVAL", func() error { _, err := loadTwoPersonApproval(); return err }},
+	{"SESSION_LEDGER_KEY", func() error { _, err := loadSessionLedgerKey(); return err }},
+	{"CONSENT_VERSION", func() error { _, err := loadConsentVersion(); return err }},
+	{"CLOCK_SKEW_THRESHOLD", func() error { _, err := loadClockSkewThreshold(); return err }},
+	{"DOOR_*", func() error { _, err := loadDoorRelay(); return err }},
+	{"LOG_*", func() error {
+		_, err := loadLogLevel(os.Getenv("LOG_LEVEL"), os.Getenv("LOG_COMPONENT_LEVELS"), os.Getenv("LOG_DEBUG_ROUTES"))
+		return err
+	}},
+	{"OTEL_*", func() error { _, err := loadTracer(); return err }},
+	{"SENTRY_DSN/ERROR_WEBHOOK_URL", func() error { _, err := loadErrorReporter(); return err }},
+	{"LISTEN_ADDR", func() error { _, err := loadListenAddrs(); return err }},
+	{"TRUSTED_PROXIES", func() error { _, err := loadTrustedProxies(); return err }},
+	{"BASE_PATH", func() error { _, err := loadBasePath(); return err }},
+	{"PHOTO_S3_*", func() error { _, err := loadPhotoStorage(); return err }},
+	{"MTLS_*", checkMTLSConfig},
+}
+
+// checkMTLSConfig loads the client CA and, if the mTLS listener is on, its
+// certificate and key
+func checkMTLSConfig() error {
+	if err := loadMTLSConfig(); err != nil {
+		return err
+	}
+	if os.Getenv("MTLS_LISTEN_ADDR") == "" {
+		return nil
+	}
+	certFile, keyFile := os.Getenv("MTLS_CERT_FILE"), os.Getenv("MTLS_KEY_FILE")
+	if certFile == "" || keyFile == "" || os.Getenv("MTLS_CLIENT_CA_FILE") == "" {
+		return fmt.Errorf("MTLS_LISTEN_ADDR requires MTLS_CERT_FILE, MTLS_KEY_FILE and MTLS_CLIENT_CA_FILE")
+	}
+	if _, err := tls.LoadX509KeyPair(certFile, keyFile); err != nil {
+		return fmt.Errorf("invalid server certificate: %w", err)
+	}
+	return nil
+}
+
+// checkConfiguration runs the configuration checks, one line per failure
+func checkConfiguration(c *selfCheck) {
+	failed := false
+	for _, check := range configChecks {
+		if err := check.load(); err != nil {
+			c.record("configuration", fmt.Errorf("%s: %w", check.name, err), "")
+			failed = true
+		}
+	}
+	if !failed {
+		c.record("configuration", nil, fmt.Sprintf("%d groups of settings valid", len(configChecks)))
+	}
+	if len(loadAPIKeys()) == 0 {
+		c.warn("api keys", "no API keys configured, all endpoints are public")
+	}
+}
+
+// checkDataFolder creates the data folder if needed and writes a file to it
+func checkDataFolder(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	f, err := os.CreateTemp(dir, ".check-*")
+	if err != nil {
+		return "", fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("ok"); err != nil {
+		f.Close()
+		return "", fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	if err := f.Close(); err != nil {
+		return "", fmt.Errorf("%s is not writable: %w", dir, err)
+	}
+	return dir + " is writable", nil
+}
+
+// checkDatabaseFile opens the database and applies its migrations, as
+// startup does, then runs the integrity check without alerting
+func checkDatabaseFile(c *selfCheck) {
+	if err := initDB(); err != nil {
+		c.record("database", fmt.Errorf("%s: %w", databaseFilePath, err), "")
+		return
+	}
+	var tables int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE type = 'table'`).Scan(&tables); err != nil {
+		c.record("database", err, "")
+		return
+	}
+	c.record("database", nil, fmt.Sprintf("%s opened, schema up to date (%d tables)", databaseFilePath, tables))
+
+	report, err := checkDatabase(db, time.Now())
+	if err == nil && report.corrupt() {
+		err = fmt.Errorf("%s", report.summary())
+	}
+	c.record("database integrity", err, "integrity check passed")
+}
+
+// checkReachable dials a host:port
+func checkReachable(addr string) (string, error) {
+	conn, err := net.DialTimeout("tcp", addr, selfCheckTimeout)
+	if err != nil {
+		return "", fmt.Errorf("%s is unreachable: %w", addr, err)
+	}
+	conn.Close()
+	return addr + " is reachable", nil
+}
+
+// urlAddress returns the host:port of an http(s) URL
+func urlAddress(raw string) (string, error) {
+	u, err := url.Parse(raw)
+	if err != nil || u.Hostname() == "" {
+		return "", fmt.Errorf("invalid URL %q", raw)
+	}
+	port := u.Port()
+	if port == "" {
+		port = "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+	}
+	return net.JoinHostPort(u.Hostname(), port), nil
+}
+
+// checkURLReachable checks that the host of a configured URL accepts connections
+func checkURLReachable(c *selfCheck, name, raw string) {
+	addr, err := urlAddress(raw)
+	detail := ""
+	if err == nil {
+		detail, err = checkReachable(addr)
+	}
+	c.record(name, err, detail)
+}
+
+// checkIntegrations checks the configured integrations
+func checkIntegrations(c *selfCheck) {
+	if os.Getenv("REDIS_URL") != "" {
+		err := configureSharedState()
+		detail := ""
+		if err == nil {
+			detail = sharedStateClient.addr + " answered PING"
+		}
+		c.record("redis", err, detail)
+	}
+
+	checked := make(map[string]bool)
+	for _, integration := range notificationIntegrations {
+		if raw := integration.url(); raw != "" && !checked[raw] {
+			checked[raw] = true
+			checkURLReachable(c, "webhook "+integration.name, raw)
+		}
+	}
+	if raw := os.Getenv("ERROR_WEBHOOK_URL"); raw != "" {
+		checkURLReachable(c, "webhook errors", raw)
+	}
+	if dsn := os.Getenv("SENTRY_DSN"); dsn != "" {
+		if endpoint, _, err := parseSentryDSN(dsn); err == nil {
+			checkURLReachable(c, "sentry", endpoint)
+		}
+	}
+	if t, err := loadTracer(); err == nil && t != nil {
+		checkURLReachable(c, "otlp collector", t.endpoint)
+	}
+	if discordBotToken() != "" {
+		checkURLReachable(c, "discord", discordAPIURL)
+	}
+	if relay, err := loadDoorRelay(); err == nil && relay != nil {
+		if relay.url.Scheme == "http" || relay.url.Scheme == "https" {
+			checkURLReachable(c, "door relay", relay.url.String())
+		} else {
+			detail, err := checkReachable(relay.mqttAddr())
+			c.record("door relay", err, detail)
+		}
+	}
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		if _, _, err := net.SplitHostPort(host); err != nil {
+			c.record("smtp", fmt.Errorf("SMTP_HOST %q must be host:port", host), "")
+		} else {
+			detail, err := checkReachable(host)
+			c.record("smtp", err, detail)
+		}
+	}
+}
+
+// runSelfCheck runs --check, writes the report and returns the exit status
+func runSelfCheck(w io.Writer) int {
+	c := &selfCheck{}
+	checkConfiguration(c)
+
+	detail, err := checkDataFolder(dataFolder)
+	c.record("data folder", err, detail)
+	if err == nil {
+		checkDatabaseFile(c)
+	}
+	checkIntegrations(c)
+
+	c.write(w)
+	if c.failed() > 0 {
+		return 1
+	}
+	return 0
+}
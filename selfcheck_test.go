@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// ============================================================================
+// Self-Check Tests
+// ============================================================================
+
+// clearIntegrations unsets the integrations the self-check reaches for
+func clearIntegrations(t *testing.T) {
+	t.Helper()
+	for _, name := range []string{"REDIS_URL", "ALERT_WEBHOOK_URL", "NOTIFY_WEBHOOK_URL", "OFFICE_WEBHOOK_URL", "ERROR_WEBHOOK_URL", "SENTRY_DSN",
+		"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "SMTP_HOST", "DISCORD_BOT_TOKEN", "MTLS_LISTEN_ADDR", "MTLS_CLIENT_CA_FILE"} {
+		t.Setenv(name, "")
+	}
+}
+
+// keepTestDB restores the test database after a check opened the real one
+func keepTestDB(t *testing.T) {
+	saved := db
+	t.Cleanup(func() {
+		db.Close()
+		db = saved
+	})
+}
+
+func TestCheckDataFolder(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	if _, err := checkDataFolder(dir); err != nil {
+		t.Fatalf("expected a missing folder to be created, got %v", err)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("expected the test file removed, got %v", entries)
+	}
+
+	file := filepath.Join(t.TempDir(), "file")
+	os.WriteFile(file, nil, 0o644)
+	if _, err := checkDataFolder(filepath.Join(file, "data")); err == nil {
+		t.Error("expected an error for a folder that cannot be created")
+	}
+}
+
+func TestCheckIntegrations(t *testing.T) {
+	clearIntegrations(t)
+	webhook := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("expected nothing posted, got %s %s", r.Method, r.URL)
+	}))
+	defer webhook.Close()
+
+	// A port nothing listens on
+	closed, _ := net.Listen("tcp", "127.0.0.1:0")
+	closedAddr := closed.Addr().String()
+	closed.Close()
+
+	t.Setenv("ALERT_WEBHOOK_URL", webhook.URL+"/alerts")
+	t.Setenv("NOTIFY_WEBHOOK_URL", "http://"+closedAddr+"/goals")
+	t.Setenv("SMTP_HOST", "smtp.example.org")
+
+	c := &selfCheck{}
+	checkIntegrations(c)
+
+	status := make(map[string]string)
+	for _, r := range c.results {
+		status[r.Name] = r.Status
+	}
+	// The office integration falls back to the goals webhook, checked once
+	want := map[string]string{"webhook alerts": checkOK, "webhook goals": checkFailed, "smtp": checkFailed}
+	if len(c.results) != len(want) {
+		t.Errorf("expected %d checks, got %+v", len(want), c.results)
+	}
+	for name, s := range want {
+		if status[name] != s {
+			t.Errorf("expected %s to be %s, got %+v", name, s, c.results)
+		}
+	}
+}
+
+func TestRunSelfCheck(t *testing.T) {
+	setupTest()
+	clearIntegrations(t)
+	keepTestDB(t)
+	t.Setenv("SCANNER_API_KEY", "scanner-secret")
+
+	var out bytes.Buffer
+	if code := runSelfCheck(&out); code != 0 {
+		t.Fatalf("expected the check to pass, got %d:\n%s", code, out.String())
+	}
+	for _, want := range []string{"configuration", "data folder", "schema up to date", "integrity check passed", "Self-check passed (4 checks)"} {
+		if !strings.Contains(out.String(), want) {
+			t.Errorf("expected %q in the report, got:\n%s", want, out.String())
+		}
+	}
+}
+
+func TestRunSelfCheck_InvalidConfiguration(t *testing.T) {
+	setupTest()
+	clearIntegrations(t)
+	keepTestDB(t)
+	t.Setenv("SCANNER_API_KEY", "")
+	t.Setenv("DISCORD_BOT_API_KEY", "")
+	t.Setenv("API_KEYS", "")
+	t.Setenv("DEVICE_OFFLINE_AFTER", "soon")
+	t.Setenv("LOG_COMPONENT_LEVELS", "db=debug")
+
+	var out bytes.Buffer
+	if code := runSelfCheck(&out); code != 1 {
+		t.Errorf("expected exit status 1, got %d", code)
+	}
+	report := out.String()
+	for _, want := range []string{"DEVICE_OFFLINE_AFTER: invalid duration", "LOG_*: unknown component", "warn  api keys", "Self-check failed: 2 of"} {
+		if !strings.Contains(report, want) {
+			t.Errorf("expected %q in the report, got:\n%s", want, report)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Session Amendments ---
+//
+// Completed sessions are append-only: once a visit is saved its times are
+// never changed (a trigger refuses it). A correction, such as a forgotten
+// sign-out closed at the cleanup hour, is recorded as an amendment linked to
+// the visit, with the corrected times, the reason and the API key that made
+// it. The latest amendment holds the session's corrected times; earlier ones
+// stay as its history. Amendments cannot be changed either: a mistaken one is
+// corrected by another.
+//
+// Reports that read visits through reportedVisits use the corrected times, or
+// the times as recorded with ?times=raw: /visits (and its CSV), /me/sessions,
+// /me/stats and /history/aggregate. So do the reports built from presence
+// intervals (see loadPresenceIntervals): /attendance/at, /stats/summary,
+// /stats/overlap, /stats/heatmap, /stats/mentorship, /members/{id}/stats,
+// /reports/term.xlsx, /reports/summary.pdf and /admin/export/anonymized.
+// Project time, goal completions, live statistics and scheduled reports use
+// the corrected times.
+//   - GET /sessions/{id}/amendments shows a session with its amendments
+//   - POST /sessions/{id}/amendments records one
+
+const (
+	sessionTimesCorrected = "corrected"
+	sessionTimesRaw       = "raw"
+)
+
+// latestAmendmentJoin joins the latest amendment of each visit v, as a
+const latestAmendmentJoin = `LEFT JOIN visit_amendments a ON a.id = (SELECT MAX(id) FROM visit_amendments WHERE visit_id = v.id)`
+
+// correctedVisits is visits with their corrected times, as a table source
+const correctedVisits = `(SELECT v.id, v.member_id, COALESCE(a.signin_time, v.signin_time) AS signin_time, COALESCE(a.signout_time, v.signout_time) AS signout_time
+		FROM visits v ` + latestAmendmentJoin + `)`
+
+// sessionsWithTimes is visits with their corrected times (sessionTimesCorrected)
+// or as recorded (sessionTimesRaw), as a table source
+func sessionsWithTimes(times string) string {
+	if times == sessionTimesRaw {
+		return `visits`
+	}
+	return correctedVisits
+}
+
+// SessionTimes are the sign-in and sign-out times of a session
+type SessionTimes struct {
+	SignInTime  time.Time `json:"signin_time"`
+	SignOutTime time.Time `json:"signout_time"`
+}
+
+// SessionAmendment is a correction of a session's times
+type SessionAmendment struct {
+	ID        int64 `json:"id"`
+	SessionID int64 `json:"session_id"`
+	SessionTimes
+	Reason    string    `json:"reason"`
+	AmendedBy string    `json:"amended_by"` // API key ID
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// SessionHistory is a session as recorded, as corrected and its amendments, oldest first
+type SessionHistory struct {
+	SessionID  int64              `json:"session_id"`
+	MemberID   int64              `json:"member_id"`
+	Recorded   SessionTimes       `json:"recorded"`
+	Corrected  SessionTimes       `json:"corrected"`
+	Amendments []SessionAmendment `json:"amendments"`
+}
+
+// AmendSessionRequest is the payload of POST /sessions/{id}/amendments
+type AmendSessionRequest struct {
+	SignInTime  *time.Time `json:"signin_time,omitempty"`  // Defaults to the corrected sign-in time
+	SignOutTime *time.Time `json:"signout_time,omitempty"` // Defaults to the corrected sign-out time
+	Reason      string     `json:"reason"`
+}
+
+// parseSessionTimes reads the times parameter of a report, writing an error
+// response if it is invalid
+func parseSessionTimes(w http.ResponseWriter, r *http.Request) (string, bool) {
+	switch times := r.URL.Query().Get("times"); times {
+	case "", sessionTimesCorrected:
+		return sessionTimesCorrected, true
+	case sessionTimesRaw:
+		return sessionTimesRaw, true
+	default:
+		http.Error(w, "Invalid 'times' parameter, expected corrected or raw", http.StatusBadRequest)
+		return "", false
+	}
+}
+
+// loadSessionHistory fetches a session with its amendments
+func loadSessionHistory(visitID int64) (SessionHistory, error) {
+	h := SessionHistory{Amendments: []SessionAmendment{}}
+	var signin, signout string
+	err := db.QueryRow(`SELECT id, member_id, signin_time, signout_time FROM visits WHERE id = ?`, visitID).
+		Scan(&h.SessionID, &h.MemberID, &signin, &signout)
+	if err != nil {
+		return SessionHistory{}, err
+	}
+	if h.Recorded.SignInTime, err = time.Parse(time.RFC3339, signin); err != nil {
+		return SessionHistory{}, err
+	}
+	if h.Recorded.SignOutTime, err = time.Parse(time.RFC3339, signout); err != nil {
+		return SessionHistory{}, err
+	}
+
+	rows, err := db.Query(`SELECT id, signin_time, signout_time, reason, amended_by, created_at
+		FROM visit_amendments WHERE visit_id = ? ORDER BY id`, visitID)
+	if err != nil {
+		return SessionHistory{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a := SessionAmendment{SessionID: visitID}
+		var createdAt string
+		if err := rows.Scan(&a.ID, &signin, &signout, &a.Reason, &a.AmendedBy, &createdAt); err != nil {
+			return SessionHistory{}, err
+		}
+		if a.SignInTime, err = time.Parse(time.RFC3339, signin); err != nil {
+			return SessionHistory{}, err
+		}
+		if a.SignOutTime, err = time.Parse(time.RFC3339, signout); err != nil {
+			return SessionHistory{}, err
+		}
+		if a.CreatedAt, err = time.Parse(time.RFC3339, createdAt); err != nil {
+			return SessionHistory{}, err
+		}
+		h.Amendments = append(h.Amendments, a)
+	}
+	if err := rows.Err(); err != nil {
+		return SessionHistory{}, err
+	}
+
+	h.Corrected = h.Recorded
+	if n := len(h.Amendments); n > 0 {
+		h.Corrected = h.Amendments[n-1].SessionTimes
+	}
+	return h, nil
+}
+
+// saveAmendmentSegments stores the per-day segments of an amendment's times,
+// used by the reports when SPLIT_SESSIONS_AT_MIDNIGHT is on
+func saveAmendmentSegments(e segmentExecer, amendmentID int64, signin, signout time.Time) error {
+	for _, s := range splitAtMidnight(signin, signout) {
+		if _, err := e.Exec(`INSERT INTO visit_amendment_segments (amendment_id, start_time, end_time) VALUES (?, ?, ?)`,
+			amendmentID, s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// amendSession records corrected times for a session
+func amendSession(visitID int64, times SessionTimes, reason, by string, now time.Time) (SessionAmendment, error) {
+	// Stored like the visits, whose times are compared as text
+	signin := times.SignInTime.Local().Truncate(time.Second)
+	signout := times.SignOutTime.Local().Truncate(time.Second)
+
+	tx, err := db.Begin()
+	if err != nil {
+		return SessionAmendment{}, err
+	}
+	defer tx.Rollback()
+
+	createdAt := now.UTC().Format(time.RFC3339)
+	res, err := tx.Exec(`INSERT INTO visit_amendments (visit_id, signin_time, signout_time, reason, amended_by, created_at) VALUES (?, ?, ?, ?, ?, ?)`,
+		visitID, signin.Format(time.RFC3339), signout.Format(time.RFC3339), reason, by, createdAt)
+	if err != nil {
+		return SessionAmendment{}, err
+	}
+	id, _ := res.LastInsertId()
+	if err := appendLedgerEntries(tx, "amendment.saved", "id = ?", id); err != nil {
+		return SessionAmendment{}, err
+	}
+	if err := saveAmendmentSegments(tx, id, signin, signout); err != nil {
+		return SessionAmendment{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return SessionAmendment{}, err
+	}
+
+	created, _ := time.Parse(time.RFC3339, createdAt)
+	return SessionAmendment{
+		ID:           id,
+		SessionID:    visitID,
+		SessionTimes: SessionTimes{SignInTime: signin, SignOutTime: signout},
+		Reason:       reason,
+		AmendedBy:    by,
+		CreatedAt:    created,
+	}, nil
+}
+
+// handleSessionAmendments handles /sessions/{id}/amendments: GET shows the
+// session with its amendments and POST amends it. Members cannot amend
+// sessions, so X-Discord-ID is refused.
+func handleSessionAmendments(w http.ResponseWriter, r *http.Request, visitID int64) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+		return
+	}
+	if r.Method == http.MethodPost && r.Header.Get(discordIDHeader) != "" {
+		http.Error(w, "Sessions can only be amended by admins", http.StatusForbidden)
+		return
+	}
+
+	history, err := loadSessionHistory(visitID)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Session not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying session amendments: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if r.Method == http.MethodGet {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(history)
+		return
+	}
+
+	var req AmendSessionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return
+	}
+	if req.SignInTime == nil && req.SignOutTime == nil {
+		http.Error(w, "signin_time or signout_time is required", http.StatusBadRequest)
+		return
+	}
+
+	times := history.Corrected
+	if req.SignInTime != nil {
+		times.SignInTime = *req.SignInTime
+	}
+	if req.SignOutTime != nil {
+		times.SignOutTime = *req.SignOutTime
+	}
+	now := time.Now()
+	if !times.SignInTime.Before(times.SignOutTime) {
+		http.Error(w, "signin_time must be before signout_time", http.StatusBadRequest)
+		return
+	}
+	if times.SignOutTime.After(now) {
+		http.Error(w, "signout_time cannot be in the future", http.StatusBadRequest)
+		return
+	}
+	if times.SignInTime.Equal(history.Corrected.SignInTime) && times.SignOutTime.Equal(history.Corrected.SignOutTime) {
+		http.Error(w, "Amendment does not change the session's times", http.StatusBadRequest)
+		return
+	}
+
+	session, err := loadSessionAllocations(visitID)
+	if err != nil {
+		log.Printf("Error querying session allocations: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if allocated := session.Seconds - session.Unallocated; allocated > int64(times.SignOutTime.Sub(times.SignInTime).Seconds()) {
+		http.Error(w, fmt.Sprintf("Session has %d seconds allocated to projects, more than the amended session; reduce its allocations first", allocated), http.StatusConflict)
+		return
+	}
+
+	amendment, err := amendSession(visitID, times, req.Reason, apiKeyID(r.Header.Get("X-API-Key")), now)
+	if err != nil {
+		log.Printf("Error amending session: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	logHTTP.infof("Amended session %d: %s to %s (%s)", visitID,
+		amendment.SignInTime.Format(time.RFC3339), amendment.SignOutTime.Format(time.RFC3339), amendment.Reason)
+	recordAudit("session.amended", clientIP(r), fmt.Sprintf("session=%d amendment=%d signin=%s signout=%s reason=%q",
+		visitID, amendment.ID, amendment.SignInTime.Format(time.RFC3339), amendment.SignOutTime.Format(time.RFC3339), amendment.Reason))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(amendment)
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Session Amendment Tests
+// ============================================================================
+
+// amendRequest calls /sessions/{id}/amendments
+func amendRequest(method string, visitID int64, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, fmt.Sprintf("/sessions/%d/amendments", visitID), bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleSession(rr, req)
+	return rr
+}
+
+func TestSessionAmendments(t *testing.T) {
+	setupTest()
+
+	// Forgot to sign out; the session ran to 11 PM
+	day := time.Now().AddDate(0, 0, -1)
+	signin := time.Date(day.Year(), day.Month(), day.Day(), 14, 0, 0, 0, time.Local)
+	visitID, err := saveVisit(1, signin, signin.Add(9*time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.Exec(`UPDATE visits SET signout_time = ? WHERE id = ?`, signin.Add(time.Hour).Format(time.RFC3339), visitID); err == nil {
+		t.Fatal("expected the visit's times to be append-only")
+	}
+
+	body := fmt.Sprintf(`{"signout_time": %q, "reason": "forgot to sign out"}`, signin.Add(3*time.Hour).Format(time.RFC3339))
+	if rr := amendRequest("POST", visitID, body); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	body = fmt.Sprintf(`{"signout_time": %q, "reason": "left at 4 PM after all"}`, signin.Add(2*time.Hour).Format(time.RFC3339))
+	if rr := amendRequest("POST", visitID, body); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	rr := amendRequest("GET", visitID, "")
+	var history SessionHistory
+	json.Unmarshal(rr.Body.Bytes(), &history)
+	if len(history.Amendments) != 2 || history.Amendments[0].Reason != "forgot to sign out" {
+		t.Fatalf("expected both amendments kept, got %+v", history)
+	}
+	if !history.Recorded.SignOutTime.Equal(signin.Add(9*time.Hour)) || !history.Corrected.SignOutTime.Equal(signin.Add(2*time.Hour)) {
+		t.Errorf("expected the latest amendment as corrected times, got %+v", history)
+	}
+
+	for times, want := range map[string]time.Duration{sessionTimesCorrected: 2 * time.Hour, sessionTimesRaw: 9 * time.Hour} {
+		visits, err := loadVisitsFromDB(defaultOrg, "", "", 1, 0, times)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(visits) != 1 || visits[0].SignOutTime.Sub(visits[0].SignInTime) != want {
+			t.Errorf("expected a %s session with %s times, got %+v", want, times, visits)
+		}
+	}
+
+	// The corrected session is split at midnight like any other
+	t.Setenv("SPLIT_SESSIONS_AT_MIDNIGHT", "true")
+	totals, err := loadMemberTotals(time.Time{}, time.Time{}, "", sessionTimesCorrected)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(totals) != 1 || totals[0].TotalSeconds != 2*3600 {
+		t.Errorf("expected 2 corrected hours, got %+v", totals)
+	}
+
+	if entries, _ := loadAuditEntries("session.amended", 10); len(entries) != 2 {
+		t.Errorf("expected both amendments audited, got %+v", entries)
+	}
+}
+
+func TestSessionAmendments_Rejected(t *testing.T) {
+	setupTest()
+
+	signin := time.Now().Add(-5 * time.Hour).Truncate(time.Second)
+	visitID, _ := saveVisit(1, signin, signin.Add(4*time.Hour))
+	db.Exec(`INSERT INTO projects (name, created_at) VALUES ('Robot', ?)`, signin.Format(time.RFC3339))
+	db.Exec(`INSERT INTO session_allocations (visit_id, project_id, seconds) VALUES (?, 1, 7200)`, visitID)
+
+	shorter := fmt.Sprintf(`{"signout_time": %q, "reason": "left early"}`, signin.Add(time.Hour).Format(time.RFC3339))
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"no reason", fmt.Sprintf(`{"signout_time": %q}`, signin.Add(time.Hour).Format(time.RFC3339)), http.StatusBadRequest},
+		{"no times", `{"reason": "typo"}`, http.StatusBadRequest},
+		{"sign-out before sign-in", fmt.Sprintf(`{"signout_time": %q, "reason": "typo"}`, signin.Add(-time.Hour).Format(time.RFC3339)), http.StatusBadRequest},
+		{"sign-out in the future", fmt.Sprintf(`{"signout_time": %q, "reason": "typo"}`, time.Now().Add(time.Hour).Format(time.RFC3339)), http.StatusBadRequest},
+		{"shorter than its allocations", shorter, http.StatusConflict},
+	}
+	for _, tt := range tests {
+		if rr := amendRequest("POST", visitID, tt.body); rr.Code != tt.want {
+			t.Errorf("%s: expected %v, got %v; body=%s", tt.name, tt.want, rr.Code, rr.Body.String())
+		}
+	}
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/sessions/%d/amendments", visitID), bytes.NewBufferString(shorter))
+	req.Header.Set(discordIDHeader, "111111111")
+	rr := httptest.NewRecorder()
+	handleSession(rr, req)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected members refused, got %v", rr.Code)
+	}
+
+	if rr := amendRequest("POST", 999, shorter); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown session, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", "/visits?times=fixed", nil)
+	rr = httptest.NewRecorder()
+	handleVisits(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown times view, got %v", rr.Code)
+	}
+}
@@ -0,0 +1,414 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// --- Session Ledger ---
+//
+// With SESSION_LEDGER_KEY set, every change the server makes to the session
+// records (visits saved, reassigned by a merge or deleted, and amendments
+// saved or deleted) is appended to session_ledger in the same transaction,
+// with appendLedgerEntries. Each entry is chained as it is appended: its hash
+// is an HMAC-SHA256, keyed with SESSION_LEDGER_KEY, of the previous entry's
+// hash and the entry itself. Only the server holds the key, which is kept out
+// of the database, so nobody else can change a session or append an entry
+// and rebuild the chain to match. Appends are serialized by the database's
+// write lock (transactions begin IMMEDIATE, see dbconfig.go).
+//
+// GET /admin/verify-ledger recomputes the chain, then replays it and compares
+// the result with the sessions in the database: a session changed, removed or
+// added other than through the server is reported. /visits and
+// /history/aggregate send the chain's head hash as X-Session-Ledger-Head, so
+// an exported volunteer-hour report can later be attested with
+// /admin/verify-ledger?hash=<head>.
+//
+// Turning the ledger on records the existing sessions as its first entries.
+// While it is turned off nothing is recorded, so changes made meanwhile are
+// reported once it is back on.
+
+const (
+	// ledgerHeadHeader carries the ledger head in report responses
+	ledgerHeadHeader = "X-Session-Ledger-Head"
+
+	// ledgerMaxDiscrepancies caps the discrepancies listed by a verification
+	ledgerMaxDiscrepancies = 100
+)
+
+// sessionLedgerKey keys the ledger's hashes; nil when the ledger is off
+var sessionLedgerKey []byte
+
+// Payloads of ledger entries, as JSON built by SQLite from a row of visits
+// or visit_amendments (%[1]s is the table alias)
+const (
+	ledgerVisitPayload     = `json_object('member_id', %[1]s.member_id, 'signin_time', %[1]s.signin_time, 'signout_time', %[1]s.signout_time)`
+	ledgerAmendmentPayload = `json_object('visit_id', %[1]s.visit_id, 'signin_time', %[1]s.signin_time, 'signout_time', %[1]s.signout_time, 'reason', %[1]s.reason, 'amended_by', %[1]s.amended_by, 'created_at', %[1]s.created_at)`
+	ledgerDeletedPayload   = `json_object('id', %[1]s.id)`
+)
+
+// ledgerTables are the tables of the records the ledger covers, by record
+var ledgerTables = map[string]struct{ table, alias, payload string }{
+	"visit":     {"visits", "v", ledgerVisitPayload},
+	"amendment": {"visit_amendments", "a", ledgerAmendmentPayload},
+}
+
+// legacyLedgerTriggers appended entries in earlier versions. Anyone who could
+// edit the database could make them log an edit as a normal change, so they
+// are dropped.
+var legacyLedgerTriggers = []string{
+	"session_ledger_visit_saved",
+	"session_ledger_visit_updated",
+	"session_ledger_visit_deleted",
+	"session_ledger_amendment_saved",
+	"session_ledger_amendment_deleted",
+}
+
+// LedgerDiscrepancy is a session record that does not match the ledger
+type LedgerDiscrepancy struct {
+	Record  string `json:"record"` // visit or amendment
+	ID      int64  `json:"id"`
+	Problem string `json:"problem"` // modified, missing or unrecorded
+}
+
+// LedgerVerification is the result of /admin/verify-ledger
+type LedgerVerification struct {
+	Valid         bool                `json:"valid"`
+	Entries       int                 `json:"entries"`
+	Head          string              `json:"head,omitempty"`      // Hash of the last entry
+	BrokenAt      *int64              `json:"broken_at,omitempty"` // First entry whose hash does not match
+	HashSeq       *int64              `json:"hash_seq,omitempty"`  // Entry of the ?hash= looked for
+	Discrepancies []LedgerDiscrepancy `json:"discrepancies"`
+	Total         int                 `json:"total_discrepancies"`
+	VerifiedAt    time.Time           `json:"verified_at"`
+}
+
+// loadSessionLedgerKey reads SESSION_LEDGER_KEY, nil when the ledger is off
+func loadSessionLedgerKey() ([]byte, error) {
+	key := os.Getenv("SESSION_LEDGER_KEY")
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) < 16 {
+		return nil, fmt.Errorf("must be at least 16 characters")
+	}
+	return []byte(key), nil
+}
+
+// setupSessionLedger drops the triggers of earlier versions and, when the
+// ledger is on and empty, records the existing sessions
+func setupSessionLedger() error {
+	for _, name := range legacyLedgerTriggers {
+		if _, err := db.Exec(`DROP TRIGGER IF EXISTS ` + name); err != nil {
+			return err
+		}
+	}
+	if sessionLedgerKey == nil {
+		return nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var entries int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM session_ledger`).Scan(&entries); err != nil {
+		return err
+	}
+	if entries == 0 {
+		if err := appendLedgerEntries(tx, "visit.saved", "1 = 1"); err != nil {
+			return err
+		}
+		if err := appendLedgerEntries(tx, "amendment.saved", "1 = 1"); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// ledgerHash chains an entry to the hash of the one before it
+func ledgerHash(key []byte, prev string, seq int64, kind string, recordID int64, payload, createdAt string) string {
+	mac := hmac.New(sha256.New, key)
+	fmt.Fprintf(mac, "%s\n%d\n%s\n%d\n%s\n%s", prev, seq, kind, recordID, payload, createdAt)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// appendLedgerEntries appends an entry of kind (e.g. visit.saved) for every
+// record its where clause selects, as the record is in tx, and chains it.
+// Deletions are appended before the records are deleted. Nothing is appended
+// while the ledger is off.
+func appendLedgerEntries(tx *sql.Tx, kind, where string, args ...interface{}) error {
+	if sessionLedgerKey == nil {
+		return nil
+	}
+	record, change := ledgerRecord(kind)
+	t, ok := ledgerTables[record]
+	if !ok {
+		return fmt.Errorf("unknown ledger record %q", record)
+	}
+	payload := t.payload
+	if change == "deleted" {
+		payload = ledgerDeletedPayload
+	}
+
+	type pending struct {
+		id      int64
+		payload string
+	}
+	rows, err := tx.Query(fmt.Sprintf(`SELECT %[1]s.id, %[2]s FROM %[3]s %[1]s WHERE %[4]s ORDER BY %[1]s.id`,
+		t.alias, fmt.Sprintf(payload, t.alias), t.table, where), args...)
+	if err != nil {
+		return err
+	}
+	var entries []pending
+	for rows.Next() {
+		var e pending
+		if err := rows.Scan(&e.id, &e.payload); err != nil {
+			rows.Close()
+			return err
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	// An entry appended without the key has no hash; chaining after it
+	// leaves the chain broken there
+	var head sql.NullString
+	err = tx.QueryRow(`SELECT hash FROM session_ledger ORDER BY seq DESC LIMIT 1`).Scan(&head)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	prev := head.String
+	createdAt := time.Now().UTC().Format(time.RFC3339)
+	for _, e := range entries {
+		res, err := tx.Exec(`INSERT INTO session_ledger (kind, record_id, payload, created_at) VALUES (?, ?, ?, ?)`,
+			kind, e.id, e.payload, createdAt)
+		if err != nil {
+			return err
+		}
+		seq, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		prev = ledgerHash(sessionLedgerKey, prev, seq, kind, e.id, e.payload, createdAt)
+		if _, err := tx.Exec(`UPDATE session_ledger SET hash = ? WHERE seq = ?`, prev, seq); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// appendVisitDeletions appends the deletion of the visits selected by where,
+// and of their amendments which the deletion cascades to
+func appendVisitDeletions(tx *sql.Tx, where string, args ...interface{}) error {
+	if err := appendLedgerEntries(tx, "amendment.deleted", `visit_id IN (SELECT id FROM visits WHERE `+where+`)`, args...); err != nil {
+		return err
+	}
+	return appendLedgerEntries(tx, "visit.deleted", where, args...)
+}
+
+// sessionLedgerHead returns the hash of the last ledger entry ("" while the
+// ledger is empty)
+func sessionLedgerHead() (string, error) {
+	var head sql.NullString
+	err := db.QueryRow(`SELECT hash FROM session_ledger ORDER BY seq DESC LIMIT 1`).Scan(&head)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return head.String, err
+}
+
+// setSessionLedgerHead sends the ledger's head with a report, when the
+// ledger is on. A report is never failed for it.
+func setSessionLedgerHead(w http.ResponseWriter) {
+	if sessionLedgerKey == nil {
+		return
+	}
+	head, err := sessionLedgerHead()
+	if err != nil {
+		logStore.warnf("Warning: reading the session ledger head failed: %v", err)
+		return
+	}
+	if head != "" {
+		w.Header().Set(ledgerHeadHeader, head)
+	}
+}
+
+// ledgerRecord splits an entry kind such as visit.saved into its record and change
+func ledgerRecord(kind string) (string, string) {
+	record, change, _ := strings.Cut(kind, ".")
+	return record, change
+}
+
+// loadLedgerRecords returns the payloads of the session records in the
+// database, by record and ID
+func loadLedgerRecords() (map[string]map[int64]string, error) {
+	records := map[string]map[int64]string{}
+	for record, query := range map[string]string{
+		"visit":     `SELECT v.id, ` + fmt.Sprintf(ledgerVisitPayload, "v") + ` FROM visits v`,
+		"amendment": `SELECT a.id, ` + fmt.Sprintf(ledgerAmendmentPayload, "a") + ` FROM visit_amendments a`,
+	} {
+		rows, err := db.Query(query)
+		if err != nil {
+			return nil, err
+		}
+		records[record] = map[int64]string{}
+		for rows.Next() {
+			var id int64
+			var payload string
+			if err := rows.Scan(&id, &payload); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			records[record][id] = payload
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return records, nil
+}
+
+// verifySessionLedger checks the chain and compares the sessions it records
+// with those in the database. hash, if not empty, must be in the chain.
+func verifySessionLedger(hash string, now time.Time) (LedgerVerification, error) {
+	v := LedgerVerification{Discrepancies: []LedgerDiscrepancy{}, VerifiedAt: now}
+
+	// Replay the chain into the records it vouches for
+	replayed := map[string]map[int64]string{"visit": {}, "amendment": {}}
+	rows, err := db.Query(`SELECT seq, kind, record_id, payload, created_at, hash FROM session_ledger ORDER BY seq`)
+	if err != nil {
+		return v, err
+	}
+	var head string
+	for rows.Next() {
+		var seq, recordID int64
+		var kind, payload, createdAt string
+		var stored sql.NullString // Null for an entry not appended by the server
+		if err := rows.Scan(&seq, &kind, &recordID, &payload, &createdAt, &stored); err != nil {
+			rows.Close()
+			return v, err
+		}
+		v.Entries++
+		if v.BrokenAt != nil {
+			continue
+		}
+		head = ledgerHash(sessionLedgerKey, head, seq, kind, recordID, payload, createdAt)
+		if !stored.Valid || !hmac.Equal([]byte(head), []byte(stored.String)) {
+			v.BrokenAt = &seq
+			continue
+		}
+		if hash != "" && stored.String == hash {
+			v.HashSeq = &seq
+		}
+
+		record, change := ledgerRecord(kind)
+		if replayed[record] == nil {
+			continue
+		}
+		if change == "deleted" {
+			delete(replayed[record], recordID)
+		} else {
+			replayed[record][recordID] = payload
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return v, err
+	}
+	if v.BrokenAt != nil {
+		// Nothing after the break can be trusted to compare with
+		return v, nil
+	}
+	v.Head = head
+
+	current, err := loadLedgerRecords()
+	if err != nil {
+		return v, err
+	}
+	add := func(record string, id int64, problem string) {
+		v.Total++
+		if len(v.Discrepancies) < ledgerMaxDiscrepancies {
+			v.Discrepancies = append(v.Discrepancies, LedgerDiscrepancy{Record: record, ID: id, Problem: problem})
+		}
+	}
+	for _, record := range []string{"visit", "amendment"} {
+		for _, id := range sortedRecordIDs(replayed[record]) {
+			payload, ok := current[record][id]
+			switch {
+			case !ok:
+				add(record, id, "missing")
+			case payload != replayed[record][id]:
+				add(record, id, "modified")
+			}
+		}
+		for _, id := range sortedRecordIDs(current[record]) {
+			if _, ok := replayed[record][id]; !ok {
+				add(record, id, "unrecorded")
+			}
+		}
+	}
+
+	v.Valid = v.Total == 0 && (hash == "" || v.HashSeq != nil)
+	return v, nil
+}
+
+// sortedRecordIDs returns the IDs of a map of records in order
+func sortedRecordIDs(m map[int64]string) []int64 {
+	ids := make([]int64, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
+
+// handleVerifyLedger verifies the session ledger (GET)
+// Query parameters:
+//   - hash: a head from X-Session-Ledger-Head, which must be in the chain
+func handleVerifyLedger(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if sessionLedgerKey == nil {
+		http.Error(w, "Session ledger is not enabled (set SESSION_LEDGER_KEY)", http.StatusNotFound)
+		return
+	}
+
+	hash := strings.TrimSpace(r.URL.Query().Get("hash"))
+	v, err := verifySessionLedger(hash, time.Now())
+	if err != nil {
+		log.Printf("Error verifying the session ledger: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if v.BrokenAt != nil {
+		logStore.warnf("Session ledger verification failed: chain broken at entry %d", *v.BrokenAt)
+	} else if v.Total > 0 {
+		logStore.warnf("Session ledger verification failed: %d session record(s) do not match", v.Total)
+	}
+	recordAudit("ledger.verified", clientIP(r), fmt.Sprintf("valid=%t entries=%d discrepancies=%d", v.Valid, v.Entries, v.Total))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
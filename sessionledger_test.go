@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Session Ledger Tests
+// ============================================================================
+
+// enableSessionLedger turns the ledger on as main does
+func enableSessionLedger(t *testing.T) {
+	t.Helper()
+	sessionLedgerKey = []byte("test-ledger-key-0123456789")
+	if err := setupSessionLedger(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// verifyLedger calls /admin/verify-ledger
+func verifyLedger(t *testing.T, query string) LedgerVerification {
+	t.Helper()
+	req, _ := http.NewRequest("GET", "/admin/verify-ledger"+query, nil)
+	rr := httptest.NewRecorder()
+	handleVerifyLedger(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var v LedgerVerification
+	json.Unmarshal(rr.Body.Bytes(), &v)
+	return v
+}
+
+func TestSessionLedger_RecordsChanges(t *testing.T) {
+	setupTest()
+
+	signin := time.Now().Add(-5 * time.Hour).Truncate(time.Second)
+	saveVisit(1, signin, signin.Add(time.Hour))
+	enableSessionLedger(t)
+
+	visitID, _ := saveVisit(2, signin, signin.Add(3*time.Hour))
+	if _, err := amendSession(visitID, SessionTimes{signin, signin.Add(2 * time.Hour)}, "left early", "test", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	req, _ := http.NewRequest("DELETE", "/visits?member_id=1", nil)
+	handleVisits(httptest.NewRecorder(), req)
+
+	// Existing visit, new visit, amendment, deletion
+	v := verifyLedger(t, "")
+	if !v.Valid || v.Entries != 4 || v.Head == "" {
+		t.Fatalf("expected a valid ledger of 4 entries, got %+v", v)
+	}
+
+	// A report carries the head, which later attests it
+	req, _ = http.NewRequest("GET", "/visits", nil)
+	rr := httptest.NewRecorder()
+	handleVisits(rr, req)
+	head := rr.Header().Get(ledgerHeadHeader)
+	if head != v.Head {
+		t.Fatalf("expected the report to carry head %s, got %q", v.Head, head)
+	}
+	saveVisit(1, signin, signin.Add(time.Hour))
+	if v := verifyLedger(t, "?hash="+head); !v.Valid || v.HashSeq == nil || *v.HashSeq != 4 {
+		t.Errorf("expected the report's head found at entry 4, got %+v", v)
+	}
+	if v := verifyLedger(t, "?hash=forged"); v.Valid {
+		t.Error("expected an unknown head to fail")
+	}
+}
+
+func TestSessionLedger_DetectsTampering(t *testing.T) {
+	setupTest()
+	enableSessionLedger(t)
+
+	signin := time.Now().Add(-5 * time.Hour).Truncate(time.Second)
+	first, _ := saveVisit(1, signin, signin.Add(time.Hour))
+	saveVisit(2, signin, signin.Add(time.Hour))
+
+	// Someone with the database edits a session and adds a visit and an
+	// amendment, bypassing the server
+	if _, err := db.Exec(`DROP TRIGGER visits_append_only`); err != nil {
+		t.Fatal(err)
+	}
+	db.Exec(`UPDATE visits SET signout_time = ? WHERE id = ?`, signin.Add(4*time.Hour).Format(time.RFC3339), first)
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (2, ?, ?)`,
+		signin.Format(time.RFC3339), signin.Add(8*time.Hour).Format(time.RFC3339))
+	db.Exec(`INSERT INTO visit_amendments (visit_id, signin_time, signout_time, reason, amended_by, created_at) VALUES (?, ?, ?, 'forgot to scan', 'admin', ?)`,
+		first, signin.Format(time.RFC3339), signin.Add(6*time.Hour).Format(time.RFC3339), time.Now().UTC().Format(time.RFC3339))
+
+	v := verifyLedger(t, "")
+	if v.Valid || v.Total != 3 || v.Discrepancies[0].ID != first || v.Discrepancies[0].Problem != "modified" ||
+		v.Discrepancies[1].Problem != "unrecorded" || v.Discrepancies[2].Record != "amendment" || v.Discrepancies[2].Problem != "unrecorded" {
+		t.Fatalf("expected the edit, the added visit and the added amendment reported, got %+v", v)
+	}
+
+	// Rewriting the ledger to match breaks the chain
+	db.Exec(`DROP TRIGGER session_ledger_append_only`)
+	db.Exec(`UPDATE session_ledger SET payload = (SELECT `+fmt.Sprintf(ledgerVisitPayload, "v")+` FROM visits v WHERE v.id = ?) WHERE seq = 1`, first)
+	v = verifyLedger(t, "")
+	if v.Valid || v.BrokenAt == nil || *v.BrokenAt != 1 {
+		t.Errorf("expected the chain broken at entry 1, got %+v", v)
+	}
+}
+
+func TestSessionLedger_RecordsTrashAndMerges(t *testing.T) {
+	setupTest()
+	enableSessionLedger(t)
+
+	signin := time.Now().Add(-5 * time.Hour).Truncate(time.Second)
+	visitID, _ := saveVisit(1, signin, signin.Add(3*time.Hour))
+	saveVisit(2, signin, signin.Add(time.Hour))
+	if _, err := amendSession(visitID, SessionTimes{signin, signin.Add(2 * time.Hour)}, "left early", "test", time.Now()); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name string
+		run  func() error
+	}{
+		{"trash", func() error { _, err := trashMember(1, false, time.Now()); return err }},
+		{"restore", func() error { _, _, err := restoreMember(1); return err }},
+		{"merge", func() error { _, err := mergeMembers(2, 1); return err }},
+		{"trash keeping sessions", func() error { _, err := trashMember(1, true, time.Now()); return err }},
+		{"purge", func() error { return purgeMember(1) }},
+	}
+	for _, step := range steps {
+		if err := step.run(); err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if v := verifyLedger(t, ""); !v.Valid {
+			t.Fatalf("%s: expected the ledger to verify, got %+v", step.name, v)
+		}
+	}
+}
+
+func TestSessionLedger_ForgedEntryBreaksChain(t *testing.T) {
+	setupTest()
+	enableSessionLedger(t)
+
+	signin := time.Now().Add(-5 * time.Hour).Truncate(time.Second)
+	first, _ := saveVisit(1, signin, signin.Add(time.Hour))
+
+	// An entry appended without the key is never sealed into the chain
+	db.Exec(`INSERT INTO session_ledger (kind, record_id, payload, created_at) VALUES ('visit.deleted', ?, '{}', ?)`,
+		first, time.Now().UTC().Format(time.RFC3339))
+	db.Exec(`DELETE FROM visits WHERE id = ?`, first)
+	saveVisit(2, signin, signin.Add(time.Hour))
+
+	if v := verifyLedger(t, ""); v.Valid || v.BrokenAt == nil || *v.BrokenAt != 2 {
+		t.Errorf("expected the chain broken at the forged entry 2, got %+v", v)
+	}
+}
+
+func TestHandleVerifyLedger_Disabled(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/admin/verify-ledger", nil)
+	rr := httptest.NewRecorder()
+	handleVerifyLedger(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 without SESSION_LEDGER_KEY, got %v", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	setSessionLedgerHead(rr)
+	if rr.Header().Get(ledgerHeadHeader) != "" {
+		t.Error("expected no head without the ledger")
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"time"
+)
+
+// --- Stateless Mode ---
+//
+// With STATELESS=true nothing about members or open sessions is kept in
+// process memory or local files: member lookups query the members table and
+// open sessions live in the open_sessions table. Any number of replicas can
+// then share one database, and an instance can be replaced at any time
+// without losing who is inside. Sign-in and sign-out stay atomic across
+// replicas (INSERT OR IGNORE and DELETE ... RETURNING on the UID key), and so
+// does the capacity check, made in the sign-in's transaction.
+//
+// Scan history, lockouts and metrics remain per instance; they are
+// diagnostics, not records.
+
+// statelessMode reports whether STATELESS=true was set at startup
+var statelessMode bool
+
+// memberLookup resolves members. The in-memory memberStore is the default;
+// dbMemberStore reads the database on every lookup.
+type memberLookup interface {
+	get(uid string) (Member, bool)
+	findByID(id int64) (Member, bool)
+	findByDiscordID(discordID, org string) (Member, bool)
+	count() int
+	put(m Member)
+	removeID(id int64)
+	merge(duplicateID int64, target Member)
+	replace(byUID map[string]Member)
+}
+
+// configureStatelessMode switches member lookups and open sessions to the
+// database when STATELESS=true
+func configureStatelessMode() error {
+	switch os.Getenv("STATELESS") {
+	case "", "false":
+		return nil
+	case "true":
+	default:
+		return fmt.Errorf("invalid value %q, expected true or false", os.Getenv("STATELESS"))
+	}
+	if os.Getenv("REDIS_URL") != "" {
+		return fmt.Errorf("REDIS_URL cannot be combined with STATELESS, open sessions are already shared through the database")
+	}
+
+	statelessMode = true
+	memberCache = dbMemberStore{}
+	currentAttendees = dbAttendeeStore{}
+	return nil
+}
+
+// --- Database Member Lookups ---
+
+// dbMemberStore looks members up in the database. Cards of members merged
+// into another member resolve to the surviving member, as in the cache.
+type dbMemberStore struct{}
+
+// warn logs a failed lookup
+func (dbMemberStore) warn(op string, err error) {
+	logStore.warnf("Warning: member %s lookup failed: %v", op, err)
+}
+
+// one runs a query returning at most one member
+func (s dbMemberStore) one(op, query string, args ...interface{}) (Member, bool) {
+	var m Member
+	err := queryRowStmt(query, args...).Scan(&m.ID, &m.Name, &m.UID, decrypted{&m.DiscordID}, &m.Role, &m.Status, &m.OrgID)
+	if err == sql.ErrNoRows {
+		return Member{}, false
+	} else if err != nil {
+		s.warn(op, err)
+		return Member{}, false
+	}
+	return m, true
+}
+
+func (s dbMemberStore) get(uid string) (Member, bool) {
+	return s.one("UID", queryMemberByUID, uid)
+}
+
+func (s dbMemberStore) findByID(id int64) (Member, bool) {
+	return s.one("ID", queryMemberByID, id)
+}
+
+func (s dbMemberStore) findByDiscordID(discordID, org string) (Member, bool) {
+	return s.one("Discord ID", queryMemberByDiscordID, encryptField(discordID), org)
+}
+
+func (s dbMemberStore) count() int {
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM members WHERE deleted_at IS NULL OR merged_into IS NOT NULL`).Scan(&n); err != nil {
+		s.warn("count", err)
+	}
+	return n
+}
+
+// The database is already up to date when these are called; only rendered
+// responses need dropping
+func (dbMemberStore) put(Member)                { renderedResponses.invalidate() }
+func (dbMemberStore) removeID(int64)            { renderedResponses.invalidate() }
+func (dbMemberStore) merge(int64, Member)       { renderedResponses.invalidate() }
+func (dbMemberStore) replace(map[string]Member) { renderedResponses.invalidate() }
+
+// --- Database Open Sessions ---
+
+// dbAttendeeStore keeps open sessions in the open_sessions table. Database
+// errors are logged; reads then behave as if nobody was inside, while get,
+// sign-ins and sign-outs return them.
+type dbAttendeeStore struct{}
+
+// warn logs a failed open session query
+func (dbAttendeeStore) warn(op string, err error) {
+	logStore.warnf("Warning: open sessions %s failed: %v", op, err)
+}
+
+// parseTime parses a stored sign-in time
+func (dbAttendeeStore) parseTime(value string) time.Time {
+	t, _ := time.Parse(time.RFC3339Nano, value)
+	return t
+}
+
+func (s dbAttendeeStore) get(uid string) (time.Time, bool, error) {
+	var since string
+	err := queryRowStmt(queryOpenSessionTime, uid).Scan(&since)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	} else if err != nil {
+		s.warn("get", err)
+		return time.Time{}, false, err
+	}
+	return s.parseTime(since), true, nil
+}
+
+func (s dbAttendeeStore) room(uid string) (string, bool) {
+	var room string
+	err := queryRowStmt(queryOpenSessionRoom, uid).Scan(&room)
+	if err == sql.ErrNoRows {
+		return "", false
+	} else if err != nil {
+		s.warn("room", err)
+		return "", false
+	}
+	return room, true
+}
+
+func (s dbAttendeeStore) count() int {
+	var n int
+	if err := queryRowStmt(queryOpenSessionCount).Scan(&n); err != nil {
+		s.warn("count", err)
+	}
+	return n
+}
+
+func (s dbAttendeeStore) signIn(uid, room string, t time.Time) {
+	defer renderedResponses.invalidate()
+	if _, err := execStmt(queryReplaceOpenSession,
+		uid, room, t.Format(time.RFC3339Nano)); err != nil {
+		s.warn("sign-in", err)
+	}
+}
+
+func (s dbAttendeeStore) signInIfAbsent(uid, room string, t time.Time) (bool, error) {
+	defer renderedResponses.invalidate()
+	res, err := execStmt(queryInsertOpenSession,
+		uid, room, t.Format(time.RFC3339Nano))
+	if err != nil {
+		s.warn("sign-in", err)
+		return false, err
+	}
+	inserted, _ := res.RowsAffected()
+	return inserted == 1, nil
+}
+
+func (s dbAttendeeStore) signInWithin(uid, room string, t time.Time, org string, capacity int) (signInResult, bool, error) {
+	defer renderedResponses.invalidate()
+	result, empty, err := s.admit(uid, room, t, org, capacity)
+	if err != nil {
+		s.warn("sign-in", err)
+	}
+	return result, empty, err
+}
+
+// admit counts who is inside and inserts the open session in one transaction.
+// Transactions take the write lock when they begin, so replicas sharing the
+// database check and insert one at a time.
+func (dbAttendeeStore) admit(uid, room string, t time.Time, org string, capacity int) (signInResult, bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var total, self, present int
+	if err := tx.QueryRow(queryOpenSessionAdmission, uid, org).Scan(&total, &self, &present); err != nil {
+		return 0, false, err
+	}
+	switch {
+	case self > 0:
+		return signInAlreadyInside, false, nil
+	case capacity > 0 && present >= capacity:
+		return signInAtCapacity, total == 0, nil
+	}
+	if _, err := tx.Exec(queryInsertOpenSession, uid, room, t.Format(time.RFC3339Nano)); err != nil {
+		return 0, false, err
+	}
+	return signInAccepted, total == 0, tx.Commit()
+}
+
+func (s dbAttendeeStore) signOutIfPresent(uid string) (time.Time, bool, error) {
+	defer renderedResponses.invalidate()
+	var since string
+	err := queryRowStmt(queryCloseOpenSession, uid).Scan(&since)
+	if err == sql.ErrNoRows {
+		return time.Time{}, false, nil
+	} else if err != nil {
+		s.warn("sign-out", err)
+		return time.Time{}, false, err
+	}
+	return s.parseTime(since), true, nil
+}
+
+func (s dbAttendeeStore) remove(uid string) {
+	defer renderedResponses.invalidate()
+	if _, err := execStmt(queryDeleteOpenSession, uid); err != nil {
+		s.warn("remove", err)
+	}
+}
+
+// query returns the attendees selected or deleted by a statement returning uid, room and signin_time
+func (s dbAttendeeStore) query(op, query string) []attendee {
+	rows, err := db.Query(query)
+	if err != nil {
+		s.warn(op, err)
+		return nil
+	}
+	defer rows.Close()
+
+	var list []attendee
+	for rows.Next() {
+		var a attendee
+		var since string
+		if err := rows.Scan(&a.UID, &a.Room, &since); err != nil {
+			s.warn(op, err)
+			return list
+		}
+		a.SignInTime = s.parseTime(since)
+		list = append(list, a)
+	}
+	if err := rows.Err(); err != nil {
+		s.warn(op, err)
+	}
+	return list
+}
+
+func (s dbAttendeeStore) list() []attendee {
+	return s.query("list", `SELECT uid, room, signin_time FROM open_sessions`)
+}
+
+func (s dbAttendeeStore) snapshot() map[string]time.Time {
+	since := make(map[string]time.Time)
+	for _, a := range s.list() {
+		since[a.UID] = a.SignInTime
+	}
+	return since
+}
+
+func (s dbAttendeeStore) clear() map[string]time.Time {
+	defer renderedResponses.invalidate()
+	since := make(map[string]time.Time)
+	for _, a := range s.query("clear", `DELETE FROM open_sessions RETURNING uid, room, signin_time`) {
+		since[a.UID] = a.SignInTime
+	}
+	return since
+}
+
+func (s dbAttendeeStore) replace(since map[string]time.Time) {
+	defer renderedResponses.invalidate()
+	tx, err := db.Begin()
+	if err != nil {
+		s.warn("replace", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`DELETE FROM open_sessions`); err != nil {
+		s.warn("replace", err)
+		return
+	}
+	for uid, t := range since {
+		if _, err := tx.Exec(`INSERT INTO open_sessions (uid, room, signin_time) VALUES (?, '', ?)`, uid, t.Format(time.RFC3339Nano)); err != nil {
+			s.warn("replace", err)
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		s.warn("replace", err)
+	}
+}
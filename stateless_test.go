@@ -0,0 +1,133 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Stateless Mode Tests
+// ============================================================================
+
+// useStatelessMode switches the test to database-backed members and open sessions
+func useStatelessMode(t *testing.T) {
+	t.Helper()
+
+	t.Setenv("STATELESS", "true")
+	t.Cleanup(func() {
+		jobs.wait()
+		events.wait()
+		statelessMode = false
+		memberCache = newMemberStore()
+		currentAttendees = newAttendeeStore()
+	})
+	if err := configureStatelessMode(); err != nil {
+		t.Fatalf("configureStatelessMode failed: %v", err)
+	}
+}
+
+func TestConfigureStatelessMode_Invalid(t *testing.T) {
+	setupTest()
+
+	t.Setenv("STATELESS", "yes")
+	if err := configureStatelessMode(); err == nil {
+		t.Error("expected an error for an invalid STATELESS value")
+	}
+
+	t.Setenv("STATELESS", "true")
+	t.Setenv("REDIS_URL", "redis://localhost")
+	if err := configureStatelessMode(); err == nil {
+		t.Error("expected an error when combined with REDIS_URL")
+	}
+	if statelessMode || !attendeesInFile() {
+		t.Error("expected the in-memory stores to stay in use after an error")
+	}
+}
+
+func TestStatelessMode_ScanInAndOut(t *testing.T) {
+	setupTest()
+	useStatelessMode(t)
+
+	// A member added behind the API's back is found without a cache refresh
+	if _, err := db.Exec(`INSERT INTO members (id, name, uid, discord_id) VALUES (3, 'Carol', 'TEST_UID_3', '333333333')`); err != nil {
+		t.Fatalf("failed to insert member: %v", err)
+	}
+
+	if rr := scan(t, "TEST_UID_3"); !strings.Contains(rr.Body.String(), `"status":"in"`) {
+		t.Fatalf("expected sign-in, got %d %s", rr.Code, rr.Body.String())
+	}
+	var open int
+	db.QueryRow(`SELECT COUNT(*) FROM open_sessions WHERE uid = 'TEST_UID_3'`).Scan(&open)
+	if open != 1 {
+		t.Fatalf("expected an open session row, got %d", open)
+	}
+
+	if rr := scan(t, "TEST_UID_3"); !strings.Contains(rr.Body.String(), `"status":"out"`) {
+		t.Fatalf("expected sign-out, got %d %s", rr.Code, rr.Body.String())
+	}
+	var visits int
+	db.QueryRow(`SELECT COUNT(*) FROM visits WHERE member_id = 3`).Scan(&visits)
+	if visits != 1 || currentAttendees.count() != 0 {
+		t.Errorf("expected one visit and no open sessions, got %d visits and %d open", visits, currentAttendees.count())
+	}
+}
+
+func TestStatelessMode_MemberLookups(t *testing.T) {
+	setupTest()
+	useStatelessMode(t)
+
+	// Bob's old card was merged into Alice
+	if _, err := db.Exec(`UPDATE members SET deleted_at = ?, merged_into = 1 WHERE id = 2`, time.Now().Format(time.RFC3339)); err != nil {
+		t.Fatalf("failed to merge member: %v", err)
+	}
+
+	if m, ok := memberCache.get("TEST_UID_2"); !ok || m.ID != 1 {
+		t.Errorf("expected the merged card to resolve to Alice, got %+v", m)
+	}
+	if _, ok := memberCache.findByID(2); ok {
+		t.Error("expected the merged member to be hidden")
+	}
+	if m, ok := findMemberByDiscordID("111111111", defaultOrg); !ok || m.Name != "Alice" {
+		t.Errorf("expected Alice by Discord ID, got %+v", m)
+	}
+	if _, ok := memberCache.get("UNKNOWN_UID"); ok {
+		t.Error("expected an unknown card to be missing")
+	}
+}
+
+func TestStatelessMode_SignInWithin(t *testing.T) {
+	setupTest()
+	useStatelessMode(t)
+	checkSignInWithin(t, currentAttendees)
+}
+
+func TestStatelessMode_SignOutAll(t *testing.T) {
+	setupTest()
+	useStatelessMode(t)
+
+	now := time.Now()
+	if ok, err := currentAttendees.signInIfAbsent("TEST_UID_1", "lab", now.Add(-time.Hour)); err != nil || !ok {
+		t.Fatal("expected the first sign-in to succeed")
+	}
+	if ok, _ := currentAttendees.signInIfAbsent("TEST_UID_1", "", now); ok {
+		t.Error("expected a second sign-in to be refused")
+	}
+	if room, _ := currentAttendees.room("TEST_UID_1"); room != "lab" {
+		t.Errorf("expected room lab, got %q", room)
+	}
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-2*time.Hour))
+
+	if cnt := signOutAll("the nightly cleanup"); cnt != 2 {
+		t.Errorf("expected 2 people signed out, got %d", cnt)
+	}
+	if currentAttendees.count() != 0 {
+		t.Errorf("expected no open sessions, got %d", currentAttendees.count())
+	}
+
+	var visits int
+	db.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visits)
+	if visits != 2 {
+		t.Errorf("expected 2 visits, got %d", visits)
+	}
+}
@@ -0,0 +1,595 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// --- Attendance Statistics ---
+//
+// Reports computed from presence intervals (see loadPresenceIntervals).
+// Days and hours are those of ?tz=, an IANA time zone, or else of the
+// organization's configured time zone (see orgsettings.go) or the server's.
+
+// OverlapResponse is the /stats/overlap response
+type OverlapResponse struct {
+	MemberA        Member     `json:"member_a"`
+	MemberB        Member     `json:"member_b"`
+	From           *time.Time `json:"from,omitempty"`
+	To             *time.Time `json:"to,omitempty"`
+	OverlapSeconds int64      `json:"overlap_seconds"`
+	OverlapHours   float64    `json:"overlap_hours"`
+	SharedVisits   int        `json:"shared_visits"` // Number of distinct stretches spent together
+}
+
+// PeriodSummary aggregates attendance over one day or week
+type PeriodSummary struct {
+	PeriodStart            time.Time          `json:"period_start"`
+	PeriodEnd              time.Time          `json:"period_end"`
+	UniqueVisitors         int                `json:"unique_visitors"`
+	PersonHours            float64            `json:"person_hours"`
+	BusiestHour            *time.Time         `json:"busiest_hour,omitempty"` // Start of the clock hour with the most person-time
+	BusiestHourPersonHours float64            `json:"busiest_hour_person_hours"`
+	PersonHoursByRole      map[string]float64 `json:"person_hours_by_role"`
+	AfterHoursPersonHours  float64            `json:"after_hours_person_hours"` // Person-hours outside OFFICE_HOURS
+	FirstActivity          *time.Time         `json:"first_activity,omitempty"`
+	LastActivity           *time.Time         `json:"last_activity,omitempty"`
+}
+
+// SummaryResponse is the /stats/summary response
+type SummaryResponse struct {
+	Granularity string          `json:"granularity"`
+	Timezone    string          `json:"timezone"`
+	Role        string          `json:"role,omitempty"`
+	Periods     []PeriodSummary `json:"periods"`
+}
+
+// HeatmapResponse is the /stats/heatmap response. Occupancy is indexed
+// [day][hour] with days starting on Monday and hours in the report time zone.
+type HeatmapResponse struct {
+	From      time.Time      `json:"from"`
+	To        time.Time      `json:"to"`
+	Timezone  string         `json:"timezone"`
+	Role      string         `json:"role,omitempty"`
+	Days      []string       `json:"days"`
+	Occupancy [7][24]float64 `json:"occupancy"` // Average number of people present
+}
+
+// heatmapDefaultRange is the period covered when no from is given
+const heatmapDefaultRange = 28 * 24 * time.Hour
+
+// parseTimeRange reads the optional RFC3339 from/to query parameters, or the
+// bounds of the term named by ?term= (which excludes from/to).
+// It writes an error response and returns false if either is invalid.
+func parseTimeRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, bool) {
+	var from, to time.Time
+	queryParams := r.URL.Query()
+
+	term, found, ok := termFromParam(w, r)
+	if !ok {
+		return time.Time{}, time.Time{}, false
+	}
+	if found {
+		if queryParams.Get("from") != "" || queryParams.Get("to") != "" {
+			http.Error(w, "'term' cannot be combined with 'from' or 'to'", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		return term.Start, term.End, true
+	}
+
+	if fromStr := queryParams.Get("from"); fromStr != "" {
+		t, err := time.Parse(time.RFC3339, fromStr)
+		if err != nil {
+			http.Error(w, "Invalid 'from' date format, expected RFC3339", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		from = t
+	}
+	if toStr := queryParams.Get("to"); toStr != "" {
+		t, err := time.Parse(time.RFC3339, toStr)
+		if err != nil {
+			http.Error(w, "Invalid 'to' date format, expected RFC3339", http.StatusBadRequest)
+			return time.Time{}, time.Time{}, false
+		}
+		to = t
+	}
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		http.Error(w, "'to' must not be before 'from'", http.StatusBadRequest)
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// memberFromParam resolves a member from a numeric ID query parameter.
+// It writes an error response and returns false if the ID is missing, invalid or unknown.
+func memberFromParam(w http.ResponseWriter, r *http.Request, name string) (Member, bool) {
+	idStr := r.URL.Query().Get(name)
+	if idStr == "" {
+		http.Error(w, fmt.Sprintf("'%s' parameter is required", name), http.StatusBadRequest)
+		return Member{}, false
+	}
+
+	var id int64
+	if n, err := fmt.Sscanf(idStr, "%d", &id); err != nil || n != 1 || id < 1 {
+		http.Error(w, fmt.Sprintf("Invalid '%s' parameter, expected positive integer", name), http.StatusBadRequest)
+		return Member{}, false
+	}
+
+	member, found := findMemberByID(id)
+	if !found || !inRequestOrg(r, member) {
+		http.Error(w, fmt.Sprintf("Member %d not found", id), http.StatusNotFound)
+		return Member{}, false
+	}
+	return member, true
+}
+
+// roleFromParam reads the optional ?role= filter ("" for all roles).
+// It writes an error response and returns false if the role is unknown.
+func roleFromParam(w http.ResponseWriter, r *http.Request) (string, bool) {
+	param := r.URL.Query().Get("role")
+	if param == "" {
+		return "", true
+	}
+	role, ok := normalizeRole(param)
+	if !ok {
+		http.Error(w, "Invalid 'role' parameter, expected member, exec, officer or guest", http.StatusBadRequest)
+		return "", false
+	}
+	return role, true
+}
+
+// locationFromParam reads the optional ?tz= time zone, defaulting to the
+// report time zone of the request's organization.
+// It writes an error response and returns false if the time zone is unknown.
+func locationFromParam(w http.ResponseWriter, r *http.Request) (*time.Location, bool) {
+	param := r.URL.Query().Get("tz")
+	if param == "" {
+		return reportLocation(requestOrg(r)), true
+	}
+	loc, err := time.LoadLocation(param)
+	if err != nil || param == "Local" {
+		http.Error(w, "Invalid 'tz' parameter, expected an IANA time zone such as America/Toronto", http.StatusBadRequest)
+		return nil, false
+	}
+	return loc, true
+}
+
+// filterRole keeps the intervals of members with a role ("" keeps all)
+func filterRole(intervals []presenceInterval, role string) []presenceInterval {
+	if role == "" {
+		return intervals
+	}
+	var kept []presenceInterval
+	for _, p := range intervals {
+		if p.Role == role {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// clipInterval restricts an interval to [from, to] (zero bounds are open) and
+// reports whether anything of it remains
+func clipInterval(p presenceInterval, from, to time.Time) (presenceInterval, bool) {
+	if !from.IsZero() && p.Start.Before(from) {
+		p.Start = from
+	}
+	if !to.IsZero() && p.End.After(to) {
+		p.End = to
+	}
+	return p, p.End.After(p.Start)
+}
+
+// memberIntervals returns a member's clipped intervals, sorted and with
+// overlapping sessions merged so no time is counted twice
+func memberIntervals(intervals []presenceInterval, memberID int64, from, to time.Time) []presenceInterval {
+	var own []presenceInterval
+	for _, p := range intervals {
+		if p.MemberID != memberID {
+			continue
+		}
+		if clipped, ok := clipInterval(p, from, to); ok {
+			own = append(own, clipped)
+		}
+	}
+
+	return mergeIntervals(own)
+}
+
+// mergeIntervals sorts intervals and merges the overlapping ones, a merged
+// interval being open if any of its intervals is
+func mergeIntervals(intervals []presenceInterval) []presenceInterval {
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i].Start.Before(intervals[j].Start) })
+
+	var merged []presenceInterval
+	for _, p := range intervals {
+		if n := len(merged); n > 0 && !p.Start.After(merged[n-1].End) {
+			if p.End.After(merged[n-1].End) {
+				merged[n-1].End = p.End
+			}
+			merged[n-1].Open = merged[n-1].Open || p.Open
+			continue
+		}
+		merged = append(merged, p)
+	}
+	return merged
+}
+
+// coPresence returns the stretches two members spent together, given the
+// sorted, merged intervals of each (see memberIntervals). A stretch is open
+// if both members are still signed in.
+func coPresence(a, b []presenceInterval) []presenceInterval {
+	var shared []presenceInterval
+
+	// Sweep both sorted lists, keeping pairwise intersections
+	for i, j := 0, 0; i < len(a) && j < len(b); {
+		start, end := a[i].Start, a[i].End
+		if b[j].Start.After(start) {
+			start = b[j].Start
+		}
+		if b[j].End.Before(end) {
+			end = b[j].End
+		}
+		if end.After(start) {
+			shared = append(shared, presenceInterval{Start: start, End: end, Open: a[i].Open && b[j].Open})
+		}
+
+		if a[i].End.Before(b[j].End) {
+			i++
+		} else {
+			j++
+		}
+	}
+	return shared
+}
+
+// handleStatsOverlap reports how long two members were in the office together
+// Query parameters:
+//   - member_a, member_b: member IDs (required)
+//   - from: RFC3339 formatted start of the period
+//   - to: RFC3339 formatted end of the period
+//   - times: corrected (default) or raw
+func handleStatsOverlap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	memberA, ok := memberFromParam(w, r, "member_a")
+	if !ok {
+		return
+	}
+	memberB, ok := memberFromParam(w, r, "member_b")
+	if !ok {
+		return
+	}
+	if memberA.ID == memberB.ID {
+		http.Error(w, "'member_a' and 'member_b' must be different members", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	intervals, err := loadPresenceIntervals(from, to, time.Now(), times)
+	if err != nil {
+		log.Printf("Error loading attendance intervals: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var overlap time.Duration
+	shared := coPresence(memberIntervals(intervals, memberA.ID, from, to), memberIntervals(intervals, memberB.ID, from, to))
+	for _, p := range shared {
+		overlap += p.End.Sub(p.Start)
+	}
+
+	resp := OverlapResponse{
+		MemberA:        memberA,
+		MemberB:        memberB,
+		OverlapSeconds: int64(overlap.Seconds()),
+		OverlapHours:   overlap.Hours(),
+		SharedVisits:   len(shared),
+	}
+	if !from.IsZero() {
+		resp.From = &from
+	}
+	if !to.IsZero() {
+		resp.To = &to
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// truncateToHour returns the start of the clock hour containing t, in its location
+func truncateToHour(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, t.Location())
+}
+
+// periodStart returns the start of the day or week (Monday) containing t, in its location
+func periodStart(t time.Time, granularity string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	if granularity == "week" {
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+	return day
+}
+
+// forEachHour splits an interval at clock-hour boundaries and calls fn with
+// the start of each hour and the time spent in it
+func forEachHour(p presenceInterval, fn func(hour time.Time, d time.Duration)) {
+	start := p.Start
+	for start.Before(p.End) {
+		hour := truncateToHour(start)
+		next := truncateToHour(hour.Add(90 * time.Minute))
+		end := p.End
+		if next.Before(end) {
+			end = next
+		}
+		fn(hour, end.Sub(start))
+		start = end
+	}
+}
+
+// summarizePeriods aggregates intervals clipped to [from, to] into per-day or
+// per-week summaries of a time zone, oldest first. Periods without activity
+// are omitted.
+func summarizePeriods(intervals []presenceInterval, from, to time.Time, granularity string, loc *time.Location) []PeriodSummary {
+	type periodTotals struct {
+		summary  PeriodSummary
+		visitors map[int64]bool
+		person   time.Duration
+		after    time.Duration
+		roles    map[string]time.Duration
+		hours    map[time.Time]time.Duration
+	}
+	periods := make(map[time.Time]*periodTotals)
+	officeLoc := reportLocation(defaultOrg)
+
+	for _, p := range intervals {
+		p, ok := clipInterval(p, from, to)
+		if !ok {
+			continue
+		}
+		// Bucket by the days and hours of the time zone
+		p.Start, p.End = p.Start.In(loc), p.End.In(loc)
+
+		forEachHour(p, func(hour time.Time, d time.Duration) {
+			key := periodStart(hour, granularity)
+			pt, exists := periods[key]
+			if !exists {
+				end := key.AddDate(0, 0, 1)
+				if granularity == "week" {
+					end = key.AddDate(0, 0, 7)
+				}
+				pt = &periodTotals{
+					summary:  PeriodSummary{PeriodStart: key, PeriodEnd: end},
+					visitors: make(map[int64]bool),
+					roles:    make(map[string]time.Duration),
+					hours:    make(map[time.Time]time.Duration),
+				}
+				periods[key] = pt
+			}
+
+			// Activity bounds within this period
+			sliceStart, sliceEnd := p.Start, p.End
+			if sliceStart.Before(key) {
+				sliceStart = key
+			}
+			if sliceEnd.After(pt.summary.PeriodEnd) {
+				sliceEnd = pt.summary.PeriodEnd
+			}
+			if pt.summary.FirstActivity == nil || sliceStart.Before(*pt.summary.FirstActivity) {
+				first := sliceStart
+				pt.summary.FirstActivity = &first
+			}
+			if pt.summary.LastActivity == nil || sliceEnd.After(*pt.summary.LastActivity) {
+				last := sliceEnd
+				pt.summary.LastActivity = &last
+			}
+
+			pt.visitors[p.MemberID] = true
+			pt.person += d
+			hourStart := maxTime(hour, p.Start)
+			pt.after += officeHours.outside(hourStart, hourStart.Add(d), officeLoc)
+			pt.roles[p.Role] += d
+			pt.hours[hour] += d
+		})
+	}
+
+	summaries := []PeriodSummary{}
+	for _, pt := range periods {
+		pt.summary.UniqueVisitors = len(pt.visitors)
+		pt.summary.PersonHours = pt.person.Hours()
+		pt.summary.AfterHoursPersonHours = pt.after.Hours()
+		pt.summary.PersonHoursByRole = make(map[string]float64, len(pt.roles))
+		for role, d := range pt.roles {
+			pt.summary.PersonHoursByRole[role] = d.Hours()
+		}
+
+		var busiest time.Duration
+		for hour, d := range pt.hours {
+			// Ties go to the earliest hour
+			if d > busiest || (d == busiest && hour.Before(*pt.summary.BusiestHour)) {
+				h := hour
+				busiest = d
+				pt.summary.BusiestHour = &h
+			}
+		}
+		pt.summary.BusiestHourPersonHours = busiest.Hours()
+
+		summaries = append(summaries, pt.summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		return summaries[i].PeriodStart.Before(summaries[j].PeriodStart)
+	})
+	return summaries
+}
+
+// handleStatsSummary returns per-day or per-week attendance summaries
+// Query parameters:
+//   - granularity: day (default) or week
+//   - from: RFC3339 formatted start of the period
+//   - to: RFC3339 formatted end of the period
+//   - role: only count members with this role
+//   - tz: IANA time zone of the days and weeks
+//   - times: corrected (default) or raw
+func handleStatsSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = "day"
+	}
+	if granularity != "day" && granularity != "week" {
+		http.Error(w, "Invalid 'granularity' parameter, expected day or week", http.StatusBadRequest)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	role, ok := roleFromParam(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := locationFromParam(w, r)
+	if !ok {
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	intervals, err := loadPresenceIntervals(from, to, time.Now(), times)
+	if err != nil {
+		log.Printf("Error loading attendance intervals: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	intervals = filterOrg(intervals, requestOrg(r))
+
+	resp := SummaryResponse{
+		Granularity: granularity,
+		Timezone:    loc.String(),
+		Role:        role,
+		Periods:     summarizePeriods(filterRole(intervals, role), from, to, granularity, loc),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// weekdayIndex maps a weekday to a Monday-first index
+func weekdayIndex(d time.Weekday) int {
+	return (int(d) + 6) % 7
+}
+
+// handleStatsHeatmap returns average occupancy per weekday and hour
+// Query parameters:
+//   - from: RFC3339 formatted start (defaults to four weeks before to)
+//   - to: RFC3339 formatted end (defaults to now)
+//   - role: only count members with this role
+//   - tz: IANA time zone of the weekdays and hours
+//   - times: corrected (default) or raw
+func handleStatsHeatmap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return
+	}
+	role, ok := roleFromParam(w, r)
+	if !ok {
+		return
+	}
+	loc, ok := locationFromParam(w, r)
+	if !ok {
+		return
+	}
+	times, ok := parseSessionTimes(w, r)
+	if !ok {
+		return
+	}
+
+	now := time.Now()
+	if to.IsZero() || to.After(now) {
+		to = now
+	}
+	if from.IsZero() {
+		from = to.Add(-heatmapDefaultRange)
+	}
+	from, to = from.In(loc), to.In(loc)
+	if !to.After(from) {
+		http.Error(w, "'from' must be before 'to' and not in the future", http.StatusBadRequest)
+		return
+	}
+
+	intervals, err := loadPresenceIntervals(from, to, now, times)
+	if err != nil {
+		log.Printf("Error loading attendance intervals: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	intervals = filterOrg(intervals, requestOrg(r))
+	intervals = filterRole(intervals, role)
+
+	// Person-time spent in each weekday/hour cell
+	var presence [7][24]time.Duration
+	for _, p := range intervals {
+		p, ok := clipInterval(p, from, to)
+		if !ok {
+			continue
+		}
+		p.Start, p.End = p.Start.In(loc), p.End.In(loc)
+
+		forEachHour(p, func(hour time.Time, d time.Duration) {
+			presence[weekdayIndex(hour.Weekday())][hour.Hour()] += d
+		})
+	}
+
+	// Time each cell was observed within the range, so partial hours at the
+	// edges are weighted correctly
+	var observed [7][24]time.Duration
+	forEachHour(presenceInterval{Start: from, End: to}, func(hour time.Time, d time.Duration) {
+		observed[weekdayIndex(hour.Weekday())][hour.Hour()] += d
+	})
+
+	resp := HeatmapResponse{
+		From:     from,
+		To:       to,
+		Timezone: loc.String(),
+		Role:     role,
+		Days:     []string{"Monday", "Tuesday", "Wednesday", "Thursday", "Friday", "Saturday", "Sunday"},
+	}
+	for day := range resp.Occupancy {
+		for hour := range resp.Occupancy[day] {
+			if observed[day][hour] > 0 {
+				resp.Occupancy[day][hour] = float64(presence[day][hour]) / float64(observed[day][hour])
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,503 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /stats/overlap Endpoint Tests
+// ============================================================================
+
+func TestHandleStatsOverlap(t *testing.T) {
+	setupTest()
+
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	// Alice 10:00-13:00, Bob 12:00-14:00 and 12:30-13:30 (duplicate-ish session)
+	saveVisitToDB(1, base, base.Add(3*time.Hour))
+	saveVisitToDB(2, base.Add(2*time.Hour), base.Add(4*time.Hour))
+	saveVisitToDB(2, base.Add(150*time.Minute), base.Add(210*time.Minute))
+	// Next day: Alice 10:00-11:00, Bob 10:30-12:00
+	saveVisitToDB(1, base.Add(24*time.Hour), base.Add(25*time.Hour))
+	saveVisitToDB(2, base.Add(24*time.Hour+30*time.Minute), base.Add(26*time.Hour))
+
+	req, _ := http.NewRequest("GET", "/stats/overlap?member_a=1&member_b=2", nil)
+	rr := httptest.NewRecorder()
+
+	handleStatsOverlap(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp OverlapResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if resp.OverlapSeconds != int64((90 * time.Minute).Seconds()) {
+		t.Errorf("expected 5400 seconds of overlap, got %d", resp.OverlapSeconds)
+	}
+	if resp.SharedVisits != 2 {
+		t.Errorf("expected 2 shared visits, got %d", resp.SharedVisits)
+	}
+	if resp.MemberA.Name != "Alice" || resp.MemberB.Name != "Bob" {
+		t.Errorf("unexpected members: %+v, %+v", resp.MemberA, resp.MemberB)
+	}
+
+	// Restricting the range to the first day clips the second overlap
+	to := url.QueryEscape(base.Add(12 * time.Hour).Format(time.RFC3339))
+	req, _ = http.NewRequest("GET", "/stats/overlap?member_a=1&member_b=2&to="+to, nil)
+	rr = httptest.NewRecorder()
+	handleStatsOverlap(rr, req)
+
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.OverlapSeconds != 3600 || resp.SharedVisits != 1 {
+		t.Errorf("expected 3600 seconds in 1 visit, got %d in %d", resp.OverlapSeconds, resp.SharedVisits)
+	}
+}
+
+func TestHandleStatsOverlap_OpenSession(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-2*time.Hour))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-time.Hour))
+
+	req, _ := http.NewRequest("GET", "/stats/overlap?member_a=1&member_b=2", nil)
+	rr := httptest.NewRecorder()
+
+	handleStatsOverlap(rr, req)
+
+	var resp OverlapResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.OverlapSeconds < 3590 || resp.OverlapSeconds > 3610 {
+		t.Errorf("expected about 3600 seconds of overlap, got %d", resp.OverlapSeconds)
+	}
+}
+
+func TestHandleStatsOverlap_InvalidParams(t *testing.T) {
+	setupTest()
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"", http.StatusBadRequest},
+		{"?member_a=1", http.StatusBadRequest},
+		{"?member_a=abc&member_b=2", http.StatusBadRequest},
+		{"?member_a=1&member_b=1", http.StatusBadRequest},
+		{"?member_a=1&member_b=99", http.StatusNotFound},
+		{"?member_a=1&member_b=2&from=yesterday", http.StatusBadRequest},
+		{"?member_a=1&member_b=2&from=2025-02-01T00:00:00Z&to=2025-01-01T00:00:00Z", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/stats/overlap"+tt.query, nil)
+		rr := httptest.NewRecorder()
+
+		handleStatsOverlap(rr, req)
+
+		if rr.Code != tt.code {
+			t.Errorf("%q: expected %d, got %v", tt.query, tt.code, rr.Code)
+		}
+	}
+}
+
+// ============================================================================
+// /stats/summary Endpoint Tests
+// ============================================================================
+
+func statsSummary(t *testing.T, query string) SummaryResponse {
+	t.Helper()
+
+	req, _ := http.NewRequest("GET", "/stats/summary"+query, nil)
+	rr := httptest.NewRecorder()
+
+	handleStatsSummary(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp SummaryResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	return resp
+}
+
+func TestHandleStatsSummary_Daily(t *testing.T) {
+	setupTest()
+
+	// A Wednesday, well in the past
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, day.Add(10*time.Hour), day.Add(12*time.Hour))
+	saveVisitToDB(2, day.Add(11*time.Hour), day.Add(11*time.Hour+30*time.Minute))
+	saveVisitToDB(1, day.Add(14*time.Hour), day.Add(15*time.Hour))
+	// Next day, crossing midnight from the day before
+	saveVisitToDB(2, day.Add(23*time.Hour), day.Add(25*time.Hour))
+
+	resp := statsSummary(t, "")
+	if resp.Granularity != "day" {
+		t.Errorf("expected default granularity day, got %q", resp.Granularity)
+	}
+	if len(resp.Periods) != 2 {
+		t.Fatalf("expected 2 periods, got %d", len(resp.Periods))
+	}
+
+	first := resp.Periods[0]
+	if !first.PeriodStart.Equal(day) || !first.PeriodEnd.Equal(day.AddDate(0, 0, 1)) {
+		t.Errorf("unexpected period bounds: %v - %v", first.PeriodStart, first.PeriodEnd)
+	}
+	if first.UniqueVisitors != 2 {
+		t.Errorf("expected 2 unique visitors, got %d", first.UniqueVisitors)
+	}
+	if first.PersonHours != 4.5 {
+		t.Errorf("expected 4.5 person-hours, got %v", first.PersonHours)
+	}
+	if first.BusiestHour == nil || !first.BusiestHour.Equal(day.Add(11*time.Hour)) || first.BusiestHourPersonHours != 1.5 {
+		t.Errorf("expected busiest hour 11:00 with 1.5 person-hours, got %v (%v)", first.BusiestHour, first.BusiestHourPersonHours)
+	}
+	if first.FirstActivity == nil || !first.FirstActivity.Equal(day.Add(10*time.Hour)) {
+		t.Errorf("expected first activity at 10:00, got %v", first.FirstActivity)
+	}
+	if first.LastActivity == nil || !first.LastActivity.Equal(day.AddDate(0, 0, 1)) {
+		t.Errorf("expected last activity at midnight, got %v", first.LastActivity)
+	}
+
+	second := resp.Periods[1]
+	if second.UniqueVisitors != 1 || second.PersonHours != 1 {
+		t.Errorf("expected 1 visitor and 1 person-hour on the second day, got %+v", second)
+	}
+}
+
+func TestHandleStatsSummary_Weekly(t *testing.T) {
+	setupTest()
+
+	monday := time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, monday.Add(10*time.Hour), monday.Add(12*time.Hour))
+	saveVisitToDB(1, monday.AddDate(0, 0, 3).Add(10*time.Hour), monday.AddDate(0, 0, 3).Add(11*time.Hour))
+	saveVisitToDB(2, monday.AddDate(0, 0, 7).Add(10*time.Hour), monday.AddDate(0, 0, 7).Add(11*time.Hour))
+
+	resp := statsSummary(t, "?granularity=week")
+	if len(resp.Periods) != 2 {
+		t.Fatalf("expected 2 weeks, got %d", len(resp.Periods))
+	}
+	if !resp.Periods[0].PeriodStart.Equal(monday) {
+		t.Errorf("expected week starting %v, got %v", monday, resp.Periods[0].PeriodStart)
+	}
+	if resp.Periods[0].UniqueVisitors != 1 || resp.Periods[0].PersonHours != 3 {
+		t.Errorf("unexpected first week: %+v", resp.Periods[0])
+	}
+}
+
+func TestHandleStatsSummary_Range(t *testing.T) {
+	setupTest()
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, day.Add(10*time.Hour), day.Add(12*time.Hour))
+	saveVisitToDB(1, day.AddDate(0, 0, 1).Add(10*time.Hour), day.AddDate(0, 0, 1).Add(12*time.Hour))
+
+	from := url.QueryEscape(day.Add(11 * time.Hour).Format(time.RFC3339))
+	to := url.QueryEscape(day.Add(20 * time.Hour).Format(time.RFC3339))
+	resp := statsSummary(t, "?from="+from+"&to="+to)
+	if len(resp.Periods) != 1 || resp.Periods[0].PersonHours != 1 {
+		t.Errorf("expected one clipped period with 1 person-hour, got %+v", resp.Periods)
+	}
+}
+
+func TestHandleStatsSummary_ByRole(t *testing.T) {
+	setupTest()
+	db.Exec(`UPDATE members SET role = 'exec' WHERE id = 1`)
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, day.Add(10*time.Hour), day.Add(12*time.Hour))
+	saveVisitToDB(2, day.Add(11*time.Hour), day.Add(12*time.Hour))
+
+	resp := statsSummary(t, "")
+	if len(resp.Periods) != 1 {
+		t.Fatalf("expected 1 period, got %+v", resp.Periods)
+	}
+	byRole := resp.Periods[0].PersonHoursByRole
+	if len(byRole) != 2 || byRole[roleExec] != 2 || byRole[roleMember] != 1 {
+		t.Errorf("expected 2 exec and 1 member person-hours, got %v", byRole)
+	}
+
+	// Exec hours only
+	resp = statsSummary(t, "?role=exec")
+	if resp.Role != roleExec || len(resp.Periods) != 1 || resp.Periods[0].UniqueVisitors != 1 || resp.Periods[0].PersonHours != 2 {
+		t.Errorf("expected only Alice's exec hours, got %+v", resp)
+	}
+	if resp = statsSummary(t, "?role=officer"); len(resp.Periods) != 0 {
+		t.Errorf("expected no officer activity, got %+v", resp.Periods)
+	}
+
+	req, _ := http.NewRequest("GET", "/stats/summary?role=president", nil)
+	rr := httptest.NewRecorder()
+	handleStatsSummary(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an unknown role, got %v", rr.Code)
+	}
+}
+
+func TestHandleStatsSummary_InvalidGranularity(t *testing.T) {
+	setupTest()
+
+	req, _ := http.NewRequest("GET", "/stats/summary?granularity=month", nil)
+	rr := httptest.NewRecorder()
+
+	handleStatsSummary(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestHandleStatsSummary_Timezone(t *testing.T) {
+	setupTest()
+
+	// 10 PM to 11 PM in Ottawa on a winter evening is 3 AM to 4 AM UTC the next day
+	start := time.Date(2025, 1, 15, 3, 0, 0, 0, time.UTC)
+	saveVisitToDB(1, start, start.Add(time.Hour))
+
+	resp := statsSummary(t, "?tz=America/Toronto")
+	if resp.Timezone != "America/Toronto" || len(resp.Periods) != 1 {
+		t.Fatalf("expected one Toronto day, got %+v", resp)
+	}
+	if got := resp.Periods[0].PeriodStart.Format(time.RFC3339); got != "2025-01-14T00:00:00-05:00" {
+		t.Errorf("expected the day starting at Toronto midnight, got %s", got)
+	}
+
+	resp = statsSummary(t, "?tz=UTC")
+	if got := resp.Periods[0].PeriodStart.Format(time.RFC3339); got != "2025-01-15T00:00:00Z" {
+		t.Errorf("expected the UTC day, got %s", got)
+	}
+
+	// The organization's time zone is the default
+	if rr := putOrgSettings(defaultOrg, defaultOrg, `{"timezone":"America/Toronto"}`); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	resp = statsSummary(t, "")
+	if resp.Timezone != "America/Toronto" || resp.Periods[0].PeriodStart.Day() != 14 {
+		t.Errorf("expected the organization's time zone, got %+v", resp)
+	}
+
+	req, _ := http.NewRequest("GET", "/stats/summary?tz=Nowhere/Special", nil)
+	rr := httptest.NewRecorder()
+	handleStatsSummary(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request for an unknown time zone, got %v", rr.Code)
+	}
+}
+
+// ============================================================================
+// /stats/heatmap Endpoint Tests
+// ============================================================================
+
+func TestHandleStatsHeatmap(t *testing.T) {
+	setupTest()
+
+	// Two weeks starting on a Monday; Alice is in 10:00-11:30 both Mondays,
+	// Bob joins 10:00-11:00 the first Monday only
+	monday := time.Date(2025, 1, 13, 0, 0, 0, 0, time.Local)
+	saveVisitToDB(1, monday.Add(10*time.Hour), monday.Add(11*time.Hour+30*time.Minute))
+	saveVisitToDB(2, monday.Add(10*time.Hour), monday.Add(11*time.Hour))
+	saveVisitToDB(1, monday.AddDate(0, 0, 7).Add(10*time.Hour), monday.AddDate(0, 0, 7).Add(11*time.Hour+30*time.Minute))
+
+	from := url.QueryEscape(monday.Format(time.RFC3339))
+	to := url.QueryEscape(monday.AddDate(0, 0, 14).Format(time.RFC3339))
+	req, _ := http.NewRequest("GET", "/stats/heatmap?from="+from+"&to="+to, nil)
+	rr := httptest.NewRecorder()
+
+	handleStatsHeatmap(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp HeatmapResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+
+	if len(resp.Days) != 7 || resp.Days[0] != "Monday" {
+		t.Errorf("expected Monday-first days, got %v", resp.Days)
+	}
+	// Monday 10:00: 3 person-hours over 2 observed hours
+	if got := resp.Occupancy[0][10]; got != 1.5 {
+		t.Errorf("expected Monday 10:00 occupancy 1.5, got %v", got)
+	}
+	// Monday 11:00: 1 person-hour over 2 observed hours
+	if got := resp.Occupancy[0][11]; got != 0.5 {
+		t.Errorf("expected Monday 11:00 occupancy 0.5, got %v", got)
+	}
+	if got := resp.Occupancy[1][10]; got != 0 {
+		t.Errorf("expected Tuesday 10:00 occupancy 0, got %v", got)
+	}
+}
+
+func TestHandleStatsHeatmap_Timezone(t *testing.T) {
+	setupTest()
+
+	// Monday 10 PM in Ottawa is Tuesday 3 AM UTC
+	start := time.Date(2025, 1, 14, 3, 0, 0, 0, time.UTC)
+	saveVisitToDB(1, start, start.Add(time.Hour))
+
+	from := url.QueryEscape(start.AddDate(0, 0, -7).Format(time.RFC3339))
+	to := url.QueryEscape(start.AddDate(0, 0, 7).Format(time.RFC3339))
+	req, _ := http.NewRequest("GET", "/stats/heatmap?tz=America/Toronto&from="+from+"&to="+to, nil)
+	rr := httptest.NewRecorder()
+	handleStatsHeatmap(rr, req)
+
+	var resp HeatmapResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.Timezone != "America/Toronto" || resp.Occupancy[0][22] != 0.5 || resp.Occupancy[1][3] != 0 {
+		t.Errorf("expected Monday 22:00 to be occupied, got %+v", resp)
+	}
+}
+
+func TestHandleStatsHeatmap_DefaultRange(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now().Add(-3*time.Hour))
+
+	req, _ := http.NewRequest("GET", "/stats/heatmap", nil)
+	rr := httptest.NewRecorder()
+
+	handleStatsHeatmap(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	var resp HeatmapResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if d := resp.To.Sub(resp.From); d != heatmapDefaultRange {
+		t.Errorf("expected default range of %v, got %v", heatmapDefaultRange, d)
+	}
+
+	var total float64
+	for _, day := range resp.Occupancy {
+		for _, v := range day {
+			total += v
+		}
+	}
+	if total == 0 {
+		t.Error("expected the open session to contribute to occupancy")
+	}
+}
+
+func TestHandleStatsHeatmap_PublicScopeAllowed(t *testing.T) {
+	setupTest()
+
+	req := scopedRequest("GET", "/stats/heatmap", scopePublic)
+	if !scopeAllowsRequest(scopePublic, req) {
+		t.Error("expected public keys to be allowed to read the heatmap")
+	}
+}
+
+// ============================================================================
+// Mentorship Hours Tests
+// ============================================================================
+
+func TestHandleStatsMentorship(t *testing.T) {
+	setupTest()
+
+	base := time.Now().Add(-72 * time.Hour).Truncate(time.Second)
+	// Together 90 minutes, then 10 minutes the next day
+	saveVisitToDB(1, base, base.Add(3*time.Hour))
+	saveVisitToDB(2, base.Add(90*time.Minute), base.Add(4*time.Hour))
+	saveVisitToDB(1, base.Add(24*time.Hour), base.Add(25*time.Hour))
+	saveVisitToDB(2, base.Add(24*time.Hour+50*time.Minute), base.Add(26*time.Hour))
+	// Both still in the office
+	now := time.Now()
+	currentAttendees.signIn("TEST_UID_1", "", now.Add(-time.Hour))
+	currentAttendees.signIn("TEST_UID_2", "", now.Add(-time.Hour))
+
+	req, _ := http.NewRequest("GET", "/stats/mentorship?mentor=1&mentee=2", nil)
+	rr := httptest.NewRecorder()
+	handleStatsMentorship(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var resp MentorshipResponse
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if resp.VerifiedSeconds != 5400 || len(resp.Sessions) != 1 || resp.TooShort != 1 {
+		t.Errorf("expected one 90 minute stretch and one too short, got %+v", resp)
+	}
+	if resp.MinOverlapSeconds != 900 || resp.Mentor.Name != "Alice" || resp.Mentee.Name != "Bob" {
+		t.Errorf("unexpected response: %+v", resp)
+	}
+
+	// A lower threshold counts the short stretch too
+	req, _ = http.NewRequest("GET", "/stats/mentorship?mentor=1&mentee=2&min_overlap=5m", nil)
+	rr = httptest.NewRecorder()
+	handleStatsMentorship(rr, req)
+	json.Unmarshal(rr.Body.Bytes(), &resp)
+	if resp.VerifiedSeconds != 6000 || len(resp.Sessions) != 2 {
+		t.Errorf("expected 100 minutes over 2 stretches, got %+v", resp)
+	}
+}
+
+func TestHandleStatsMentorship_CSV(t *testing.T) {
+	setupTest()
+
+	base := time.Now().Add(-48 * time.Hour).Truncate(time.Second)
+	saveVisitToDB(1, base, base.Add(2*time.Hour))
+	saveVisitToDB(2, base.Add(time.Hour), base.Add(3*time.Hour))
+
+	req, _ := http.NewRequest("GET", "/stats/mentorship?mentor=1&mentee=2&format=csv", nil)
+	rr := httptest.NewRecorder()
+	handleStatsMentorship(rr, req)
+
+	if ct := rr.Header().Get("Content-Type"); ct != "text/csv" {
+		t.Fatalf("expected text/csv, got %q", ct)
+	}
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("failed to parse CSV: %v", err)
+	}
+	if len(records) != 2 || records[1][0] != "Alice" || records[1][1] != "Bob" || records[1][4] != "1h0m0s" {
+		t.Errorf("unexpected CSV: %v", records)
+	}
+}
+
+func TestHandleStatsMentorship_InvalidParams(t *testing.T) {
+	setupTest()
+
+	tests := []struct {
+		query    string
+		expected int
+	}{
+		{"mentor=1", http.StatusBadRequest},
+		{"mentor=1&mentee=1", http.StatusBadRequest},
+		{"mentor=1&mentee=99", http.StatusNotFound},
+		{"mentor=1&mentee=2&min_overlap=soon", http.StatusBadRequest},
+		{"mentor=1&mentee=2&format=xml", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/stats/mentorship?"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		handleStatsMentorship(rr, req)
+		if rr.Code != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.query, tt.expected, rr.Code)
+		}
+	}
+}
@@ -0,0 +1,418 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// --- In-Memory Stores ---
+//
+// Each piece of in-memory state is owned by a store with its own lock. The
+// maps are never exposed; accessors return copies, so no caller can read or
+// write shared state without holding the right lock. Stores never call each
+// other while holding their lock.
+
+// scanHistorySize is the number of scan events kept by scanHistoryStore
+const scanHistorySize = 10
+
+// Changes to the member and attendee stores invalidate renderedResponses.
+
+// memberStore caches members by card UID (loaded from the database)
+type memberStore struct {
+	mu    sync.RWMutex
+	byUID map[string]Member
+}
+
+// newMemberStore returns an empty member cache
+func newMemberStore() *memberStore {
+	return &memberStore{byUID: make(map[string]Member)}
+}
+
+// get returns the member a card UID belongs to
+func (s *memberStore) get(uid string) (Member, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	m, ok := s.byUID[uid]
+	return m, ok
+}
+
+// findByID returns the member with the given database ID
+func (s *memberStore) findByID(id int64) (Member, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range s.byUID {
+		if m.ID == id {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// findByDiscordID returns the member of an organization linked to a Discord account
+func (s *memberStore) findByDiscordID(discordID, org string) (Member, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, m := range s.byUID {
+		if m.DiscordID == discordID && memberOrg(m) == org {
+			return m, true
+		}
+	}
+	return Member{}, false
+}
+
+// count returns the number of cached UIDs
+func (s *memberStore) count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.byUID)
+}
+
+// put adds or updates a member. Cards of members merged into it follow the
+// update, and its previous UID is dropped if the UID changed.
+func (s *memberStore) put(m Member) {
+	defer renderedResponses.invalidate()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uid, existing := range s.byUID {
+		if existing.ID != m.ID {
+			continue
+		}
+		if uid == existing.UID {
+			delete(s.byUID, uid)
+		} else {
+			s.byUID[uid] = m
+		}
+	}
+	s.byUID[m.UID] = m
+}
+
+// removeID drops a member and the cards of members merged into it
+func (s *memberStore) removeID(id int64) {
+	defer renderedResponses.invalidate()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uid, existing := range s.byUID {
+		if existing.ID == id {
+			delete(s.byUID, uid)
+		}
+	}
+}
+
+// merge makes every card of the duplicate member resolve to target
+func (s *memberStore) merge(duplicateID int64, target Member) {
+	defer renderedResponses.invalidate()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for uid, existing := range s.byUID {
+		if existing.ID == duplicateID {
+			s.byUID[uid] = target
+		}
+	}
+}
+
+// replace swaps the whole cache for byUID, which the store takes ownership of
+func (s *memberStore) replace(byUID map[string]Member) {
+	s.mu.Lock()
+	s.byUID = byUID
+	s.mu.Unlock()
+	renderedResponses.invalidate()
+}
+
+// attendee is a member currently signed in
+type attendee struct {
+	UID        string
+	SignInTime time.Time
+	Room       string
+}
+
+// signInResult is the outcome of attendeeState.signInWithin
+type signInResult int
+
+const (
+	signInAccepted signInResult = iota
+	signInAlreadyInside
+	signInAtCapacity
+)
+
+// admitSignIn decides a sign-in from the UIDs inside: refused if the UID is
+// already inside, or if capacity (0 for none) members of org are
+func admitSignIn(uid string, inside []string, org string, capacity int) signInResult {
+	present := 0
+	for _, u := range inside {
+		if u == uid {
+			return signInAlreadyInside
+		}
+		if member, _ := memberCache.get(u); memberOrg(member) == org {
+			present++
+		}
+	}
+	if capacity > 0 && present >= capacity {
+		return signInAtCapacity
+	}
+	return signInAccepted
+}
+
+// attendeeState tracks who is currently signed in and in which room. The
+// in-memory attendeeStore is the default; redisAttendeeStore shares the state
+// between instances.
+type attendeeState interface {
+	get(uid string) (time.Time, bool, error)
+	room(uid string) (string, bool)
+	count() int
+	signIn(uid, room string, t time.Time)
+	signInIfAbsent(uid, room string, t time.Time) (bool, error)
+	signInWithin(uid, room string, t time.Time, org string, capacity int) (signInResult, bool, error)
+	signOutIfPresent(uid string) (time.Time, bool, error)
+	remove(uid string)
+	list() []attendee
+	snapshot() map[string]time.Time
+	clear() map[string]time.Time
+	replace(since map[string]time.Time)
+}
+
+// attendeeStore keeps current attendees in process memory
+type attendeeStore struct {
+	mu    sync.RWMutex
+	since map[string]time.Time // UID -> sign-in time
+	rooms map[string]string    // UID -> room, not persisted
+}
+
+// attendeesInFile reports whether current attendees are kept in memory and
+// persisted to currentAttendeesFilePath, rather than in shared storage
+func attendeesInFile() bool {
+	_, local := currentAttendees.(*attendeeStore)
+	return local
+}
+
+// attendeeStoreKind names where open sessions are kept, for traces
+func attendeeStoreKind() string {
+	switch currentAttendees.(type) {
+	case *attendeeStore:
+		return "file"
+	case dbAttendeeStore:
+		return "database"
+	case *redisAttendeeStore:
+		return "redis"
+	}
+	return "unknown"
+}
+
+// newAttendeeStore returns an empty attendee store
+func newAttendeeStore() *attendeeStore {
+	return &attendeeStore{since: make(map[string]time.Time), rooms: make(map[string]string)}
+}
+
+// get returns when a UID signed in, if it is signed in; shared stores fail if
+// they can't be reached
+func (s *attendeeStore) get(uid string) (time.Time, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.since[uid]
+	return t, ok, nil
+}
+
+// room returns the room a signed-in UID is in
+func (s *attendeeStore) room(uid string) (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	room, ok := s.rooms[uid]
+	return room, ok
+}
+
+// count returns the number of people signed in
+func (s *attendeeStore) count() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.since)
+}
+
+// signIn records a UID as signed in at a room since t
+func (s *attendeeStore) signIn(uid, room string, t time.Time) {
+	s.mu.Lock()
+	s.since[uid] = t
+	s.rooms[uid] = room
+	s.mu.Unlock()
+	renderedResponses.invalidate()
+}
+
+// signInIfAbsent signs a UID in unless it is already signed in, checking and
+// updating under one lock. It reports whether the UID was signed in; shared
+// stores fail if they can't be reached.
+func (s *attendeeStore) signInIfAbsent(uid, room string, t time.Time) (bool, error) {
+	s.mu.Lock()
+	if _, inside := s.since[uid]; inside {
+		s.mu.Unlock()
+		return false, nil
+	}
+	s.since[uid] = t
+	s.rooms[uid] = room
+	s.mu.Unlock()
+	renderedResponses.invalidate()
+	return true, nil
+}
+
+// signInWithin signs a UID in unless it is already inside or its organization
+// is at capacity (see admitSignIn), checking and updating under one lock. It
+// also reports whether the office was empty, so the sign-in opened it.
+func (s *attendeeStore) signInWithin(uid, room string, t time.Time, org string, capacity int) (signInResult, bool, error) {
+	s.mu.Lock()
+	inside := make([]string, 0, len(s.since))
+	for u := range s.since {
+		inside = append(inside, u)
+	}
+	result := admitSignIn(uid, inside, org, capacity)
+	if result == signInAccepted {
+		s.since[uid] = t
+		s.rooms[uid] = room
+	}
+	s.mu.Unlock()
+	if result == signInAccepted {
+		renderedResponses.invalidate()
+	}
+	return result, len(inside) == 0, nil
+}
+
+// signOutIfPresent signs a UID out if it is signed in, checking and updating
+// under one lock. It returns when the closed session started.
+func (s *attendeeStore) signOutIfPresent(uid string) (time.Time, bool, error) {
+	s.mu.Lock()
+	t, inside := s.since[uid]
+	if !inside {
+		s.mu.Unlock()
+		return time.Time{}, false, nil
+	}
+	delete(s.since, uid)
+	delete(s.rooms, uid)
+	s.mu.Unlock()
+	renderedResponses.invalidate()
+	return t, true, nil
+}
+
+// remove signs a UID out
+func (s *attendeeStore) remove(uid string) {
+	s.mu.Lock()
+	delete(s.since, uid)
+	delete(s.rooms, uid)
+	s.mu.Unlock()
+	renderedResponses.invalidate()
+}
+
+// list returns everyone signed in, in no particular order
+func (s *attendeeStore) list() []attendee {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]attendee, 0, len(s.since))
+	for uid, t := range s.since {
+		list = append(list, attendee{UID: uid, SignInTime: t, Room: s.rooms[uid]})
+	}
+	return list
+}
+
+// snapshot returns a copy of the UID -> sign-in time map
+func (s *attendeeStore) snapshot() map[string]time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	copyMap := make(map[string]time.Time, len(s.since))
+	for uid, t := range s.since {
+		copyMap[uid] = t
+	}
+	return copyMap
+}
+
+// clear signs everyone out and returns who was signed in
+func (s *attendeeStore) clear() map[string]time.Time {
+	defer renderedResponses.invalidate()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	previous := s.since
+	s.since = make(map[string]time.Time)
+	s.rooms = make(map[string]string)
+	return previous
+}
+
+// replace sets who is signed in (rooms are not persisted and reset)
+func (s *attendeeStore) replace(since map[string]time.Time) {
+	if since == nil {
+		since = make(map[string]time.Time)
+	}
+	s.mu.Lock()
+	s.since = since
+	s.rooms = make(map[string]string)
+	s.mu.Unlock()
+	renderedResponses.invalidate()
+}
+
+// scanHistoryStore is a ring buffer of the most recent scan events
+type scanHistoryStore struct {
+	mu     sync.RWMutex
+	events []ScanEvent
+}
+
+// record appends a scan while keeping only the last scanHistorySize entries
+func (s *scanHistoryStore) record(uid string, t time.Time) {
+	s.mu.Lock()
+	s.events = append(s.events, ScanEvent{UID: uid, Time: t})
+	if len(s.events) > scanHistorySize {
+		s.events = s.events[len(s.events)-scanHistorySize:]
+	}
+	s.mu.Unlock()
+}
+
+// list returns the recorded scans, oldest first
+func (s *scanHistoryStore) list() []ScanEvent {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	history := make([]ScanEvent, len(s.events))
+	copy(history, s.events)
+	return history
+}
+
+// reset forgets all recorded scans
+func (s *scanHistoryStore) reset() {
+	s.mu.Lock()
+	s.events = nil
+	s.mu.Unlock()
+}
+
+var (
+	// Members by card UID, loaded from the database
+	// (or read from it on every lookup, see configureStatelessMode)
+	memberCache memberLookup = newMemberStore()
+
+	// Who is currently inside, persisted to currentAttendeesFilePath
+	// (or shared through Redis or the database, see configureSharedState
+	// and configureStatelessMode)
+	currentAttendees attendeeState = newAttendeeStore()
+
+	// Last scanHistorySize scans, served by /scan-history
+	scanHistory = &scanHistoryStore{}
+)
+
+// --- Cache Refresh ---
+
+// handleCacheRefresh reloads the member cache from the database. Member changes
+// made through the API update the cache in place; this resyncs it after the
+// database was edited directly.
+func handleCacheRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	if err := loadMembersIntoCache(); err != nil {
+		log.Printf("Error refreshing members cache: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	msg := fmt.Sprintf("Reloaded %d member card(s) into cache", memberCache.count())
+	log.Println(msg)
+	recordAudit("cache.refreshed", clientIP(r), msg)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": msg})
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// In-Memory Store Tests
+// ============================================================================
+
+func TestAttendeeStore_SignInAndRemove(t *testing.T) {
+	s := newAttendeeStore()
+	since := time.Now().Add(-time.Hour)
+
+	s.signIn("A", "lab", since)
+	if got, ok, _ := s.get("A"); !ok || !got.Equal(since) {
+		t.Fatalf("expected A signed in since %v, got %v (%v)", since, got, ok)
+	}
+	if room, _ := s.room("A"); room != "lab" {
+		t.Errorf("expected room lab, got %q", room)
+	}
+
+	s.remove("A")
+	if _, ok, _ := s.get("A"); ok {
+		t.Error("expected A to be signed out")
+	}
+	if _, ok := s.room("A"); ok {
+		t.Error("expected the room of A to be cleared")
+	}
+}
+
+func TestAttendeeStore_SignInIfAbsent(t *testing.T) {
+	s := newAttendeeStore()
+	first := time.Now().Add(-time.Hour)
+
+	if ok, err := s.signInIfAbsent("A", "lab", first); err != nil || !ok {
+		t.Fatal("expected the first sign-in to succeed")
+	}
+	if ok, _ := s.signInIfAbsent("A", "", time.Now()); ok {
+		t.Error("expected a second sign-in to be refused")
+	}
+	if got, _, _ := s.get("A"); !got.Equal(first) {
+		t.Errorf("expected the original sign-in time to be kept, got %v", got)
+	}
+
+	if got, ok, _ := s.signOutIfPresent("A"); !ok || !got.Equal(first) {
+		t.Errorf("expected to sign out the session started at %v, got %v (%v)", first, got, ok)
+	}
+	if _, ok, _ := s.signOutIfPresent("A"); ok {
+		t.Error("expected a second sign-out to be refused")
+	}
+}
+
+// checkSignInWithin checks the capacity check of a store with Alice's and
+// Bob's cards, both of the host organization
+func checkSignInWithin(t *testing.T, s attendeeState) {
+	t.Helper()
+
+	if result, empty, err := s.signInWithin("TEST_UID_1", "", time.Now(), defaultOrg, 1); err != nil || result != signInAccepted || !empty {
+		t.Fatalf("expected Alice to open the office, got %v (empty %v, %v)", result, empty, err)
+	}
+	if result, _, _ := s.signInWithin("TEST_UID_2", "", time.Now(), defaultOrg, 1); result != signInAtCapacity {
+		t.Errorf("expected Bob refused at capacity, got %v", result)
+	}
+	if result, _, _ := s.signInWithin("TEST_UID_2", "", time.Now(), "ess", 1); result != signInAccepted {
+		t.Errorf("expected another organization's capacity not to count Alice, got %v", result)
+	}
+	if result, _, _ := s.signInWithin("TEST_UID_1", "", time.Now(), defaultOrg, 0); result != signInAlreadyInside {
+		t.Errorf("expected Alice already inside, got %v", result)
+	}
+	if s.count() != 2 {
+		t.Errorf("expected 2 inside, got %d", s.count())
+	}
+}
+
+func TestAttendeeStore_SignInWithin(t *testing.T) {
+	setupTest()
+	checkSignInWithin(t, newAttendeeStore())
+}
+
+func TestAttendeeStore_ConcurrentSignInOnlyOnce(t *testing.T) {
+	s := newAttendeeStore()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	signedIn, signedOut := 0, 0
+	for i := 0; i < 50; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if ok, _ := s.signInIfAbsent("A", "", time.Now()); ok {
+				mu.Lock()
+				signedIn++
+				mu.Unlock()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if _, ok, _ := s.signOutIfPresent("A"); ok {
+				mu.Lock()
+				signedOut++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Every sign-out closed exactly one sign-in
+	inside := s.count()
+	if signedIn != signedOut+inside {
+		t.Errorf("expected sign-ins (%d) = sign-outs (%d) + inside (%d)", signedIn, signedOut, inside)
+	}
+}
+
+func TestAttendeeStore_ClearReturnsPrevious(t *testing.T) {
+	s := newAttendeeStore()
+	s.signIn("A", "", time.Now())
+	s.signIn("B", "lab", time.Now())
+
+	previous := s.clear()
+	if len(previous) != 2 {
+		t.Errorf("expected 2 previous attendees, got %d", len(previous))
+	}
+	if s.count() != 0 || len(s.list()) != 0 {
+		t.Errorf("expected the store to be empty, got %v", s.snapshot())
+	}
+}
+
+func TestAttendeeStore_SnapshotIsACopy(t *testing.T) {
+	s := newAttendeeStore()
+	s.signIn("A", "", time.Now())
+
+	snapshot := s.snapshot()
+	delete(snapshot, "A")
+	if _, ok, _ := s.get("A"); !ok {
+		t.Error("modifying a snapshot must not change the store")
+	}
+}
+
+func TestScanHistoryStore_KeepsLastEntries(t *testing.T) {
+	s := &scanHistoryStore{}
+	for i := 0; i < scanHistorySize+5; i++ {
+		s.record(fmt.Sprintf("UID_%d", i), time.Now())
+	}
+
+	history := s.list()
+	if len(history) != scanHistorySize {
+		t.Fatalf("expected %d entries, got %d", scanHistorySize, len(history))
+	}
+	if history[0].UID != "UID_5" || history[len(history)-1].UID != fmt.Sprintf("UID_%d", scanHistorySize+4) {
+		t.Errorf("expected the most recent entries oldest first, got %+v", history)
+	}
+}
+
+func TestMemberStore_Lookups(t *testing.T) {
+	s := newMemberStore()
+	alice := Member{ID: 1, Name: "Alice", UID: "A", DiscordID: "111"}
+	s.replace(map[string]Member{"A": alice, "OLD_A": alice})
+
+	if m, ok := s.findByID(1); !ok || m.Name != "Alice" {
+		t.Errorf("expected Alice by ID, got %+v", m)
+	}
+	if m, ok := s.findByDiscordID("111", defaultOrg); !ok || m.UID != "A" {
+		t.Errorf("expected Alice by Discord ID, got %+v", m)
+	}
+	if _, ok := s.get("B"); ok {
+		t.Error("expected unknown UID to be missing")
+	}
+	if s.count() != 2 {
+		t.Errorf("expected 2 cached UIDs, got %d", s.count())
+	}
+}
+
+func TestMemberStore_TargetedUpdates(t *testing.T) {
+	s := newMemberStore()
+	alice := Member{ID: 1, Name: "Alice", UID: "A"}
+	bob := Member{ID: 2, Name: "Bob", UID: "B"}
+	s.replace(map[string]Member{"A": alice, "B": bob})
+
+	// Bob merged into Alice: both cards resolve to Alice
+	s.merge(bob.ID, alice)
+	if m, _ := s.get("B"); m.ID != alice.ID {
+		t.Fatalf("expected B to resolve to Alice after merge, got %+v", m)
+	}
+
+	// Renaming Alice and changing her card updates the merged card too
+	alice.Name, alice.UID = "Alice Updated", "A2"
+	s.put(alice)
+	if _, ok := s.get("A"); ok {
+		t.Error("expected the old UID A to be dropped")
+	}
+	for _, uid := range []string{"A2", "B"} {
+		if m, _ := s.get(uid); m.Name != "Alice Updated" {
+			t.Errorf("expected %s to resolve to the updated Alice, got %+v", uid, m)
+		}
+	}
+
+	s.removeID(alice.ID)
+	if s.count() != 0 {
+		t.Errorf("expected every card of Alice to be removed, %d left", s.count())
+	}
+}
+
+func TestHandleCacheRefresh(t *testing.T) {
+	setupTest()
+
+	// Edited behind the API's back: only a refresh picks it up
+	if _, err := db.Exec(`UPDATE members SET name = 'Alice Renamed' WHERE id = 1`); err != nil {
+		t.Fatalf("failed to update member: %v", err)
+	}
+
+	req, _ := http.NewRequest("POST", "/admin/cache/refresh", nil)
+	rr := httptest.NewRecorder()
+	handleCacheRefresh(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	if cachedMember("TEST_UID_1").Name != "Alice Renamed" {
+		t.Errorf("expected the cache to be reloaded, got %+v", cachedMember("TEST_UID_1"))
+	}
+	if entries, _ := loadAuditEntries("cache.refreshed", 10); len(entries) != 1 {
+		t.Errorf("expected one cache.refreshed audit entry, got %+v", entries)
+	}
+
+	req, _ = http.NewRequest("GET", "/admin/cache/refresh", nil)
+	rr = httptest.NewRecorder()
+	handleCacheRefresh(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 Method Not Allowed, got %v", rr.Code)
+	}
+}
+
+func TestStores_ConcurrentAccess(t *testing.T) {
+	attendees := newAttendeeStore()
+	members := newMemberStore()
+	history := &scanHistoryStore{}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			uid := fmt.Sprintf("UID_%d", i)
+			attendees.signIn(uid, "", time.Now())
+			history.record(uid, time.Now())
+			members.replace(map[string]Member{uid: {UID: uid}})
+			attendees.list()
+			members.get(uid)
+			attendees.remove(uid)
+		}(i)
+	}
+	wg.Wait()
+
+	if attendees.count() != 0 {
+		t.Errorf("expected everyone signed out, got %d", attendees.count())
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- systemd Integration ---
+//
+// Under systemd the server can be socket activated and tells systemd when it
+// is ready, so the first scan after a start waits in the socket's queue
+// instead of racing the database and cache loading:
+//   - socket activation: sockets passed by systemd (LISTEN_FDS) are served
+//     instead of opening LISTEN_ADDR. The socket named "mtls"
+//     (FileDescriptorName= in the .socket unit) serves the scanner mTLS
+//     listener, the one named "readonly" the read-only API (see
+//     listeners.go) and the others the whole API.
+//   - readiness: with Type=notify, READY=1 is sent to NOTIFY_SOCKET once the
+//     database, the member cache and current attendees are loaded and the
+//     listeners are open.
+//   - watchdog: with WatchdogSec=, WATCHDOG=1 is sent at half the interval
+//     while the database answers, so systemd restarts a server that hangs.
+//
+// All of it is off outside systemd, where none of these variables are set.
+
+const (
+	// First file descriptor passed by socket activation
+	sdListenFDsStart = 3
+
+	// Name of the activated socket of the scanner mTLS listener
+	sdMTLSSocketName = "mtls"
+)
+
+// activatedListener is a socket passed by systemd
+type activatedListener struct {
+	name     string // FileDescriptorName= of the socket, "http" if unnamed
+	listener net.Listener
+}
+
+// activatedListeners returns the sockets passed by systemd. pid, fds and
+// names are LISTEN_PID, LISTEN_FDS and LISTEN_FDNAMES, and firstFD the
+// descriptor of the first socket.
+func activatedListeners(pid, fds, names string, firstFD int) ([]activatedListener, error) {
+	if fds == "" {
+		return nil, nil
+	}
+	if p, err := strconv.Atoi(pid); err != nil || p != os.Getpid() {
+		// Meant for another process
+		return nil, nil
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("invalid LISTEN_FDS %q", fds)
+	}
+
+	fdNames := strings.Split(names, ":")
+	listeners := make([]activatedListener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "http"
+		if i < len(fdNames) && fdNames[i] != "" && fdNames[i] != "unknown" {
+			name = fdNames[i]
+		}
+		f := os.NewFile(uintptr(firstFD+i), name)
+		ln, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("activated socket %q is not a listening socket: %w", name, err)
+		}
+		listeners = append(listeners, activatedListener{name, ln})
+	}
+	return listeners, nil
+}
+
+// activatedMTLSListener returns the activated socket of the mTLS listener, if any
+func activatedMTLSListener(listeners []activatedListener) (net.Listener, error) {
+	var mtls net.Listener
+	for _, l := range listeners {
+		if l.name != sdMTLSSocketName {
+			continue
+		}
+		if mtls != nil {
+			return nil, fmt.Errorf("more than one activated socket named %q", sdMTLSSocketName)
+		}
+		mtls = l.listener
+	}
+	return mtls, nil
+}
+
+// systemdListeners returns the sockets passed to this process by systemd, if
+// any, and unsets the variables so child processes do not inherit them
+func systemdListeners() ([]activatedListener, error) {
+	listeners, err := activatedListeners(os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS"), os.Getenv("LISTEN_FDNAMES"), sdListenFDsStart)
+	for _, name := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+		os.Unsetenv(name)
+	}
+	return listeners, err
+}
+
+// sdNotify sends a state such as READY=1 to systemd, nothing outside systemd
+func sdNotify(state string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" {
+		return nil
+	}
+	// A leading @ is an abstract socket, which net handles
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(state))
+	return err
+}
+
+// watchdogInterval returns the interval of the systemd watchdog, 0 if it is off
+func watchdogInterval() (time.Duration, error) {
+	value := os.Getenv("WATCHDOG_USEC")
+	if value == "" {
+		return 0, nil
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, nil
+	}
+	usec, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, fmt.Errorf("invalid WATCHDOG_USEC %q", value)
+	}
+	return time.Duration(usec) * time.Microsecond, nil
+}
+
+// watchdogHealthy reports whether the server should keep the watchdog fed
+func watchdogHealthy(timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return db.PingContext(ctx)
+}
+
+// startWatchdog sends WATCHDOG=1 at half the interval while the server is healthy
+func startWatchdog(interval time.Duration) {
+	ticker := time.NewTicker(interval / 2)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		if err := watchdogHealthy(interval / 4); err != nil {
+			log.Printf("Warning: not notifying the systemd watchdog, the database is not answering: %v", err)
+			continue
+		}
+		if err := sdNotify("WATCHDOG=1"); err != nil {
+			log.Printf("Warning: notifying the systemd watchdog failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// systemd Integration Tests
+// ============================================================================
+
+// listenNotify stands in for systemd's notification socket
+func listenNotify(t *testing.T, name string) *net.UnixConn {
+	t.Helper()
+
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: name, Net: "unixgram"})
+	if err != nil {
+		t.Fatalf("listening on %s: %v", name, err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	t.Setenv("NOTIFY_SOCKET", name)
+	return conn
+}
+
+func TestSDNotify(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdNotify("READY=1"); err != nil {
+		t.Errorf("expected nothing sent outside systemd, got %v", err)
+	}
+
+	for _, name := range []string{filepath.Join(t.TempDir(), "notify"), "@ieee-office-test-" + strconv.Itoa(os.Getpid())} {
+		conn := listenNotify(t, name)
+		if err := sdNotify("READY=1"); err != nil {
+			t.Fatalf("unexpected error for %s: %v", name, err)
+		}
+		buf := make([]byte, 64)
+		conn.SetReadDeadline(time.Now().Add(time.Second))
+		n, err := conn.Read(buf)
+		if err != nil || string(buf[:n]) != "READY=1" {
+			t.Errorf("expected READY=1 on %s, got %q (err %v)", name, buf[:n], err)
+		}
+	}
+}
+
+func TestActivatedListeners(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	file, err := ln.(*net.TCPListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	// The socket is handed over as its own descriptor, like systemd does
+	fd, err := syscall.Dup(int(file.Fd()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid := strconv.Itoa(os.Getpid())
+	listeners, err := activatedListeners(pid, "1", "mtls", fd)
+	if err != nil || len(listeners) != 1 || listeners[0].name != sdMTLSSocketName {
+		t.Fatalf("expected the mtls socket, got %v (err %v)", listeners, err)
+	}
+	defer listeners[0].listener.Close()
+	if listeners[0].listener.Addr().String() != ln.Addr().String() {
+		t.Errorf("expected %s, got %s", ln.Addr(), listeners[0].listener.Addr())
+	}
+	if mtls, err := activatedMTLSListener(listeners); err != nil || mtls != listeners[0].listener {
+		t.Errorf("expected the mtls socket for the mTLS listener, got %v (err %v)", mtls, err)
+	}
+
+	// Unnamed sockets serve the API
+	fd, _ = syscall.Dup(int(file.Fd()))
+	listeners, err = activatedListeners(pid, "1", "", fd)
+	if err != nil || len(listeners) != 1 || listeners[0].name != "http" {
+		t.Fatalf("expected the http socket, got %v (err %v)", listeners, err)
+	}
+	listeners[0].listener.Close()
+
+	if listeners, err := activatedListeners("1", "1", "", fd); err != nil || listeners != nil {
+		t.Errorf("expected sockets of another process ignored, got %v (err %v)", listeners, err)
+	}
+	if listeners, err := activatedListeners("", "", "", fd); err != nil || listeners != nil {
+		t.Errorf("expected no sockets outside systemd, got %v (err %v)", listeners, err)
+	}
+	if _, err := activatedListeners(pid, "two", "", fd); err == nil {
+		t.Error("expected an error for an invalid LISTEN_FDS")
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	t.Setenv("WATCHDOG_USEC", "")
+	t.Setenv("WATCHDOG_PID", "")
+	if d, err := watchdogInterval(); err != nil || d != 0 {
+		t.Errorf("expected the watchdog off, got %s (err %v)", d, err)
+	}
+
+	t.Setenv("WATCHDOG_USEC", "30000000")
+	if d, err := watchdogInterval(); err != nil || d != 30*time.Second {
+		t.Errorf("expected 30s, got %s (err %v)", d, err)
+	}
+	t.Setenv("WATCHDOG_PID", "1")
+	if d, _ := watchdogInterval(); d != 0 {
+		t.Errorf("expected another process's watchdog ignored, got %s", d)
+	}
+
+	t.Setenv("WATCHDOG_PID", "")
+	t.Setenv("WATCHDOG_USEC", "-5")
+	if _, err := watchdogInterval(); err == nil {
+		t.Error("expected an error for an invalid WATCHDOG_USEC")
+	}
+}
+
+func TestWatchdogHealthy(t *testing.T) {
+	setupTest()
+	if err := watchdogHealthy(time.Second); err != nil {
+		t.Errorf("expected a healthy database, got %v", err)
+	}
+}
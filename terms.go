@@ -0,0 +1,284 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// --- Terms ---
+//
+// Terms (e.g. fall-2025) are named reporting periods. Stats endpoints accept
+// ?term=<name> in place of from/to, and member-hours reports default to the
+// term in progress when one is defined (?term=all reports over all time).
+
+// Term is a named reporting period [Start, End)
+type Term struct {
+	ID    int64     `json:"id"`
+	Name  string    `json:"name"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// termAll is the ?term= value requesting no term restriction
+const termAll = "all"
+
+// termColumns is the column list scanned by scanTerm
+const termColumns = `id, name, start_time, end_time`
+
+// scanTerm reads a term row selected with termColumns
+func scanTerm(row rowScanner) (Term, error) {
+	var t Term
+	var start, end string
+	if err := row.Scan(&t.ID, &t.Name, &start, &end); err != nil {
+		return Term{}, err
+	}
+
+	var err error
+	if t.Start, err = time.Parse(time.RFC3339, start); err != nil {
+		return Term{}, err
+	}
+	if t.End, err = time.Parse(time.RFC3339, end); err != nil {
+		return Term{}, err
+	}
+	return t, nil
+}
+
+// loadTerm fetches a single term by ID
+func loadTerm(id int64) (Term, error) {
+	return scanTerm(db.QueryRow(`SELECT `+termColumns+` FROM terms WHERE id = ?`, id))
+}
+
+// loadTermByName fetches a single term by name
+func loadTermByName(name string) (Term, error) {
+	return scanTerm(db.QueryRow(`SELECT `+termColumns+` FROM terms WHERE name = ?`, name))
+}
+
+// loadTerms returns all terms ordered by start
+func loadTerms() ([]Term, error) {
+	rows, err := db.Query(`SELECT ` + termColumns + ` FROM terms ORDER BY start_time`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := []Term{}
+	for rows.Next() {
+		t, err := scanTerm(rows)
+		if err != nil {
+			return nil, err
+		}
+		terms = append(terms, t)
+	}
+	return terms, rows.Err()
+}
+
+// currentTerm returns the term containing now, preferring the latest-starting
+// one if terms overlap
+func currentTerm(now time.Time) (Term, bool, error) {
+	terms, err := loadTerms()
+	if err != nil {
+		return Term{}, false, err
+	}
+
+	var current Term
+	found := false
+	for _, t := range terms {
+		if !now.Before(t.Start) && now.Before(t.End) && (!found || t.Start.After(current.Start)) {
+			current, found = t, true
+		}
+	}
+	return current, found, nil
+}
+
+// termFromParam resolves the ?term= parameter, normalized like term names (see
+// decodeTerm). It returns found=false if the parameter is empty or "all", and
+// writes an error response on failure.
+func termFromParam(w http.ResponseWriter, r *http.Request) (term Term, found bool, ok bool) {
+	name := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("term")))
+	if name == "" || name == termAll {
+		return Term{}, false, true
+	}
+
+	term, err := loadTermByName(name)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Term '"+name+"' not found", http.StatusNotFound)
+		return Term{}, false, false
+	} else if err != nil {
+		log.Printf("Error querying term: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return Term{}, false, false
+	}
+	return term, true, true
+}
+
+// parseReportRange is parseTimeRange for member-hours reports: without term,
+// from or to it covers the current term (if any). It also returns the name of
+// the term used, if any.
+func parseReportRange(w http.ResponseWriter, r *http.Request) (time.Time, time.Time, string, bool) {
+	queryParams := r.URL.Query()
+	if queryParams.Get("term") == "" && queryParams.Get("from") == "" && queryParams.Get("to") == "" {
+		term, found, err := currentTerm(time.Now())
+		if err != nil {
+			log.Printf("Error loading current term: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return time.Time{}, time.Time{}, "", false
+		}
+		if found {
+			return term.Start, term.End, term.Name, true
+		}
+		return time.Time{}, time.Time{}, "", true
+	}
+
+	from, to, ok := parseTimeRange(w, r)
+	if !ok {
+		return time.Time{}, time.Time{}, "", false
+	}
+	termName := queryParams.Get("term")
+	if termName == termAll {
+		termName = ""
+	}
+	return from, to, termName, true
+}
+
+// decodeTerm reads and validates a term payload
+func decodeTerm(w http.ResponseWriter, r *http.Request) (Term, bool) {
+	var req Term
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON, start and end must be RFC3339", http.StatusBadRequest)
+		return Term{}, false
+	}
+
+	req.Name = strings.ToLower(strings.TrimSpace(req.Name))
+	if req.Name == "" || req.Start.IsZero() || req.End.IsZero() {
+		http.Error(w, "name, start, and end are required", http.StatusBadRequest)
+		return Term{}, false
+	}
+	if req.Name == termAll {
+		http.Error(w, "'"+termAll+"' is reserved", http.StatusBadRequest)
+		return Term{}, false
+	}
+	if !req.End.After(req.Start) {
+		http.Error(w, "end must be after start", http.StatusBadRequest)
+		return Term{}, false
+	}
+	return req, true
+}
+
+// handleTerms supports GET to list terms and POST to create a term
+func handleTerms(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		terms, err := loadTerms()
+		if err != nil {
+			log.Printf("Error querying terms: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(terms)
+
+	case http.MethodPost:
+		req, ok := decodeTerm(w, r)
+		if !ok {
+			return
+		}
+
+		res, err := db.Exec(`INSERT INTO terms (name, start_time, end_time) VALUES (?, ?, ?)`,
+			req.Name, req.Start.Format(time.RFC3339), req.End.Format(time.RFC3339))
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Term name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error inserting term: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		req.ID, _ = res.LastInsertId()
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(req)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// handleTerm handles /terms/{id} (GET, PUT, DELETE)
+func handleTerm(w http.ResponseWriter, r *http.Request) {
+	id, sub, ok := parseIDPath(r.URL.Path, "/terms/")
+	if !ok {
+		http.Error(w, "Invalid term ID", http.StatusBadRequest)
+		return
+	}
+	if sub != "" {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		term, err := loadTerm(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Term not found", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying term: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(term)
+
+	case http.MethodPut:
+		req, ok := decodeTerm(w, r)
+		if !ok {
+			return
+		}
+
+		result, err := db.Exec(`UPDATE terms SET name = ?, start_time = ?, end_time = ? WHERE id = ?`,
+			req.Name, req.Start.Format(time.RFC3339), req.End.Format(time.RFC3339), id)
+		if err != nil {
+			if isUniqueViolation(err) {
+				http.Error(w, "Term name already exists", http.StatusConflict)
+				return
+			}
+			log.Printf("Error updating term: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Term not found", http.StatusNotFound)
+			return
+		}
+
+		req.ID = id
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(req)
+
+	case http.MethodDelete:
+		result, err := db.Exec(`DELETE FROM terms WHERE id = ?`, id)
+		if err != nil {
+			log.Printf("Error deleting term: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if rowsAffected, _ := result.RowsAffected(); rowsAffected == 0 {
+			http.Error(w, "Term not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": "Term deleted successfully"})
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// /terms Endpoint Tests
+// ============================================================================
+
+// createTestTerm creates a term and returns it
+func createTestTerm(t *testing.T, name string, start, end time.Time) Term {
+	t.Helper()
+
+	body := fmt.Sprintf(`{"name":%q,"start":%q,"end":%q}`, name, start.Format(time.RFC3339), end.Format(time.RFC3339))
+	req, _ := http.NewRequest("POST", "/terms", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handleTerms(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 Created, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	var term Term
+	if err := json.Unmarshal(rr.Body.Bytes(), &term); err != nil {
+		t.Fatalf("failed to parse term: %v", err)
+	}
+	return term
+}
+
+func TestHandleTerms_CreateAndList(t *testing.T) {
+	setupTest()
+
+	fall := createTestTerm(t, "Fall-2025", time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	if fall.ID == 0 || fall.Name != "fall-2025" {
+		t.Fatalf("unexpected term: %+v", fall)
+	}
+	createTestTerm(t, "winter-2025", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC))
+
+	req, _ := http.NewRequest("GET", "/terms", nil)
+	rr := httptest.NewRecorder()
+	handleTerms(rr, req)
+
+	var terms []Term
+	if err := json.Unmarshal(rr.Body.Bytes(), &terms); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(terms) != 2 || terms[0].Name != "winter-2025" {
+		t.Errorf("expected terms ordered by start, got %+v", terms)
+	}
+}
+
+func TestHandleTerms_CreateInvalid(t *testing.T) {
+	setupTest()
+
+	createTestTerm(t, "fall-2025", time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		body string
+		code int
+	}{
+		{`{"name":"","start":"2025-01-01T00:00:00Z","end":"2025-05-01T00:00:00Z"}`, http.StatusBadRequest},
+		{`{"name":"w","start":"2025-05-01T00:00:00Z","end":"2025-01-01T00:00:00Z"}`, http.StatusBadRequest},
+		{`{"name":"w","start":"2025-01-01","end":"2025-05-01"}`, http.StatusBadRequest},
+		{`{"name":"all","start":"2025-01-01T00:00:00Z","end":"2025-05-01T00:00:00Z"}`, http.StatusBadRequest},
+		{`{"name":"fall-2025","start":"2025-01-01T00:00:00Z","end":"2025-05-01T00:00:00Z"}`, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("POST", "/terms", bytes.NewBufferString(tt.body))
+		rr := httptest.NewRecorder()
+		handleTerms(rr, req)
+
+		if rr.Code != tt.code {
+			t.Errorf("%s: expected %d, got %v", tt.body, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestHandleTerm_GetUpdateDelete(t *testing.T) {
+	setupTest()
+
+	term := createTestTerm(t, "fall-2025", time.Date(2025, 9, 1, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC))
+	path := fmt.Sprintf("/terms/%d", term.ID)
+
+	req, _ := http.NewRequest("PUT", path, bytes.NewBufferString(`{"name":"fall-2025","start":"2025-09-02T00:00:00Z","end":"2025-12-24T00:00:00Z"}`))
+	rr := httptest.NewRecorder()
+	handleTerm(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	handleTerm(rr, req)
+
+	var got Term
+	if err := json.Unmarshal(rr.Body.Bytes(), &got); err != nil {
+		t.Fatalf("failed to parse term: %v", err)
+	}
+	if !got.End.Equal(time.Date(2025, 12, 24, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected updated end, got %v", got.End)
+	}
+
+	req, _ = http.NewRequest("DELETE", path, nil)
+	rr = httptest.NewRecorder()
+	handleTerm(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+
+	req, _ = http.NewRequest("GET", path, nil)
+	rr = httptest.NewRecorder()
+	handleTerm(rr, req)
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 after delete, got %v", rr.Code)
+	}
+}
+
+func TestCurrentTerm(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	if _, found, err := currentTerm(now); err != nil || found {
+		t.Fatalf("expected no current term, got found=%v err=%v", found, err)
+	}
+
+	createTestTerm(t, "past", now.AddDate(-1, 0, 0), now.AddDate(0, -6, 0))
+	createTestTerm(t, "year", now.AddDate(0, -3, 0), now.AddDate(0, 9, 0))
+	createTestTerm(t, "current", now.AddDate(0, -1, 0), now.AddDate(0, 2, 0))
+
+	term, found, err := currentTerm(now)
+	if err != nil || !found || term.Name != "current" {
+		t.Errorf("expected the latest-starting term containing now, got %+v (found=%v err=%v)", term, found, err)
+	}
+}
+
+// ============================================================================
+// ?term= on Stats Endpoints Tests
+// ============================================================================
+
+func TestStatsSummary_TermParam(t *testing.T) {
+	setupTest()
+
+	day := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	createTestTerm(t, "winter-2025", day, day.AddDate(0, 0, 1))
+	saveVisitToDB(1, day.Add(10*time.Hour), day.Add(12*time.Hour))
+	saveVisitToDB(1, day.AddDate(0, 0, 2).Add(10*time.Hour), day.AddDate(0, 0, 2).Add(12*time.Hour))
+
+	resp := statsSummary(t, "?term=winter-2025")
+	if len(resp.Periods) != 1 || !resp.Periods[0].PeriodStart.Equal(day) {
+		t.Errorf("expected only the term's day, got %+v", resp.Periods)
+	}
+
+	// Names are stored lowercased, so the parameter matches in any case
+	resp = statsSummary(t, "?term=Winter-2025")
+	if len(resp.Periods) != 1 || !resp.Periods[0].PeriodStart.Equal(day) {
+		t.Errorf("expected the term matched case-insensitively, got %+v", resp.Periods)
+	}
+}
+
+func TestStatsSummary_TermParamErrors(t *testing.T) {
+	setupTest()
+
+	createTestTerm(t, "winter-2025", time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 5, 1, 0, 0, 0, 0, time.UTC))
+
+	tests := []struct {
+		query string
+		code  int
+	}{
+		{"?term=fall-1999", http.StatusNotFound},
+		{"?term=winter-2025&from=2025-01-01T00:00:00Z", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req, _ := http.NewRequest("GET", "/stats/summary"+tt.query, nil)
+		rr := httptest.NewRecorder()
+		handleStatsSummary(rr, req)
+
+		if rr.Code != tt.code {
+			t.Errorf("%q: expected %d, got %v", tt.query, tt.code, rr.Code)
+		}
+	}
+}
+
+func TestHandleMeStats_DefaultsToCurrentTerm(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	createTestTerm(t, "current", now.AddDate(0, 0, -7), now.AddDate(0, 0, 7))
+	saveVisitToDB(1, now.AddDate(0, 0, -1), now.AddDate(0, 0, -1).Add(time.Hour))
+	saveVisitToDB(1, now.AddDate(0, 0, -30), now.AddDate(0, 0, -30).Add(time.Hour))
+
+	meStats := func(query string) MeStats {
+		req, _ := http.NewRequest("GET", "/me/stats"+query, nil)
+		req.Header.Set("X-Discord-ID", "111111111")
+		rr := httptest.NewRecorder()
+		handleMeStats(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+		}
+
+		var stats MeStats
+		if err := json.Unmarshal(rr.Body.Bytes(), &stats); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return stats
+	}
+
+	if stats := meStats(""); stats.VisitCount != 1 || stats.Term != "current" {
+		t.Errorf("expected 1 visit in the current term, got %+v", stats)
+	}
+	if stats := meStats("?term=all"); stats.VisitCount != 2 || stats.Term != "" {
+		t.Errorf("expected 2 visits over all time, got %+v", stats)
+	}
+}
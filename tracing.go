@@ -0,0 +1,470 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// --- Tracing ---
+//
+// Requests, the scan path (member lookup, open sessions, visit writes), event
+// handlers (notifications, integrations) and background jobs (webhooks, the
+// current_attendees.json write) are recorded as OpenTelemetry spans and sent
+// to an OTLP/HTTP collector as JSON, which tells where a slow scan spends its
+// time. Tracing is off unless OTEL_EXPORTER_OTLP_ENDPOINT (the collector,
+// /v1/traces is appended) or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT (the full
+// URL) is set. Also read:
+//   - OTEL_EXPORTER_OTLP_HEADERS: key=value pairs separated by commas, such
+//     as an authorization header for a hosted collector
+//   - OTEL_SERVICE_NAME: service.name of the spans (default ieee-office-backend)
+//   - OTEL_TRACES_SAMPLER_ARG: share of new traces recorded, 0 to 1 (default 1)
+//
+// A W3C traceparent header on a request continues the caller's trace, with
+// the caller's sampling decision. Events carry the trace of the request that
+// published them, so their handlers join it. Spans that do not fit in the
+// export queue are dropped and counted in traces_dropped_spans_total.
+
+const (
+	defaultServiceName = "ieee-office-backend"
+
+	traceQueueSize     = 2048
+	traceBatchSize     = 512
+	traceFlushInterval = 5 * time.Second
+)
+
+// spanKind is the OTLP span kind
+type spanKind int
+
+const (
+	spanKindInternal spanKind = 1
+	spanKindServer   spanKind = 2
+	spanKindClient   spanKind = 3
+)
+
+// spanContext identifies a span within its trace
+type spanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+	Sampled bool
+}
+
+// valid reports whether the span context identifies a span
+func (sc spanContext) valid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// traceparent formats the span context as a W3C traceparent header
+func (sc spanContext) traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + hex.EncodeToString(sc.TraceID[:]) + "-" + hex.EncodeToString(sc.SpanID[:]) + "-" + flags
+}
+
+// parseTraceparent parses a W3C traceparent header
+func parseTraceparent(header string) (spanContext, bool) {
+	var sc spanContext
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := strconv.ParseUint(parts[3], 16, 8)
+	if err != nil {
+		return sc, false
+	}
+	sc.Sampled = flags&1 == 1
+	return sc, sc.valid()
+}
+
+// span is one timed operation of a trace
+type span struct {
+	name       string
+	kind       spanKind
+	context    spanContext
+	parentID   [8]byte
+	start, end time.Time
+	attrs      map[string]interface{}
+	err        string
+}
+
+// setAttr records an attribute of the span (string, int, int64, float64 or bool)
+func (s *span) setAttr(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.attrs[key] = value
+}
+
+// finish ends the span, marking it failed if err is not nil, and queues it for export
+func (s *span) finish(err error) {
+	if s == nil {
+		return
+	}
+	s.end = time.Now()
+	if err != nil {
+		s.err = err.Error()
+	}
+	if t := activeTracer.Load(); t != nil && s.context.Sampled {
+		t.queueSpan(s)
+	}
+}
+
+// tracer records spans and exports them to the collector
+type tracer struct {
+	service  string
+	endpoint string
+	headers  map[string]string
+	ratio    float64
+	queue    chan *span
+	client   *http.Client
+}
+
+// activeTracer records spans; nil while tracing is off. It is atomic because
+// event bus and job goroutines finish spans while tests swap it.
+var activeTracer atomic.Pointer[tracer]
+
+type spanContextKey struct{}
+
+// spanContextFrom returns the span of a context, if any
+func spanContextFrom(ctx context.Context) spanContext {
+	sc, _ := ctx.Value(spanContextKey{}).(spanContext)
+	return sc
+}
+
+// withSpanContext makes sc the parent of the spans started from ctx
+func withSpanContext(ctx context.Context, sc spanContext) context.Context {
+	if !sc.valid() {
+		return ctx
+	}
+	return context.WithValue(ctx, spanContextKey{}, sc)
+}
+
+// startSpan starts a span, a child of the span of ctx if any. It returns nil,
+// which every span method accepts, while tracing is off.
+func startSpan(ctx context.Context, name string, kind spanKind) (context.Context, *span) {
+	t := activeTracer.Load()
+	if t == nil {
+		return ctx, nil
+	}
+
+	s := &span{name: name, kind: kind, start: time.Now(), attrs: make(map[string]interface{})}
+	parent := spanContextFrom(ctx)
+	if parent.valid() {
+		s.context.TraceID, s.context.Sampled, s.parentID = parent.TraceID, parent.Sampled, parent.SpanID
+	} else {
+		rand.Read(s.context.TraceID[:])
+		s.context.Sampled = t.sample(s.context.TraceID)
+	}
+	rand.Read(s.context.SpanID[:])
+	return withSpanContext(ctx, s.context), s
+}
+
+// sample decides whether a new trace is recorded, from its random trace ID
+func (t *tracer) sample(traceID [16]byte) bool {
+	if t.ratio >= 1 {
+		return true
+	}
+	var n uint64
+	for _, b := range traceID[8:] {
+		n = n<<8 | uint64(b)
+	}
+	return float64(n>>11)/float64(1<<53) < t.ratio
+}
+
+// queueSpan queues a finished span without blocking
+func (t *tracer) queueSpan(s *span) {
+	select {
+	case t.queue <- s:
+	default:
+		incCounter("traces_dropped_spans_total")
+	}
+}
+
+// loadTracer reads the OTEL_* settings and returns the tracer, or nil if
+// tracing is off
+func loadTracer() (*tracer, error) {
+	endpoint := os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")
+	if endpoint == "" {
+		if base := os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"); base != "" {
+			endpoint = strings.TrimRight(base, "/") + "/v1/traces"
+		}
+	}
+	if endpoint == "" {
+		return nil, nil
+	}
+	if u, err := url.Parse(endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid OTLP endpoint %q, expected an http(s) URL", endpoint)
+	}
+
+	t := &tracer{
+		service:  defaultServiceName,
+		endpoint: endpoint,
+		headers:  make(map[string]string),
+		ratio:    1,
+		queue:    make(chan *span, traceQueueSize),
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+	if name := os.Getenv("OTEL_SERVICE_NAME"); name != "" {
+		t.service = name
+	}
+	if value := os.Getenv("OTEL_TRACES_SAMPLER_ARG"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 || ratio > 1 || math.IsNaN(ratio) {
+			return nil, fmt.Errorf("OTEL_TRACES_SAMPLER_ARG must be between 0 and 1, got %q", value)
+		}
+		t.ratio = ratio
+	}
+	for _, pair := range strings.Split(os.Getenv("OTEL_EXPORTER_OTLP_HEADERS"), ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid OTEL_EXPORTER_OTLP_HEADERS entry %q, expected key=value", pair)
+		}
+		if unescaped, err := url.QueryUnescape(strings.TrimSpace(value)); err == nil {
+			value = unescaped
+		}
+		t.headers[strings.TrimSpace(key)] = value
+	}
+	return t, nil
+}
+
+// startTraceExporter sends queued spans to the collector in batches
+func (t *tracer) startTraceExporter() {
+	ticker := time.NewTicker(traceFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*span, 0, traceBatchSize)
+	for {
+		select {
+		case s := <-t.queue:
+			if batch = append(batch, s); len(batch) < traceBatchSize {
+				continue
+			}
+		case <-ticker.C:
+			if len(batch) == 0 {
+				continue
+			}
+		}
+		if err := t.export(batch); err != nil {
+			incCounter("traces_export_errors_total")
+			log.Printf("Warning: exporting %d span(s) failed: %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+}
+
+// OTLP/HTTP JSON encoding of spans
+type (
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+	}
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              spanKind        `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpResourceSpans struct {
+		Resource struct {
+			Attributes []otlpAttribute `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+)
+
+// otlpAttributeOf encodes an attribute, formatting unknown types as strings
+func otlpAttributeOf(key string, value interface{}) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		a.Value.StringValue = &v
+	case int:
+		s := strconv.Itoa(v)
+		a.Value.IntValue = &s
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		a.Value.IntValue = &s
+	case float64:
+		a.Value.DoubleValue = &v
+	case bool:
+		a.Value.BoolValue = &v
+	default:
+		s := fmt.Sprint(v)
+		a.Value.StringValue = &s
+	}
+	return a
+}
+
+// encodeSpans builds the OTLP export request of a batch of spans
+func (t *tracer) encodeSpans(batch []*span) otlpTraces {
+	scope := otlpScopeSpans{Spans: make([]otlpSpan, 0, len(batch))}
+	scope.Scope.Name = defaultServiceName
+	for _, s := range batch {
+		out := otlpSpan{
+			TraceID:           hex.EncodeToString(s.context.TraceID[:]),
+			SpanID:            hex.EncodeToString(s.context.SpanID[:]),
+			Name:              s.name,
+			Kind:              s.kind,
+			StartTimeUnixNano: strconv.FormatInt(s.start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.end.UnixNano(), 10),
+			Status:            otlpStatus{Code: 1},
+		}
+		if s.parentID != [8]byte{} {
+			out.ParentSpanID = hex.EncodeToString(s.parentID[:])
+		}
+		if s.err != "" {
+			out.Status = otlpStatus{Code: 2, Message: s.err}
+		}
+		for key, value := range s.attrs {
+			out.Attributes = append(out.Attributes, otlpAttributeOf(key, value))
+		}
+		scope.Spans = append(scope.Spans, out)
+	}
+
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = []otlpAttribute{otlpAttributeOf("service.name", t.service)}
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{resource}}
+}
+
+// export posts a batch of spans to the collector
+func (t *tracer) export(batch []*span) error {
+	body, err := json.Marshal(t.encodeSpans(batch))
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequest(http.MethodPost, t.endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range t.headers {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("collector returned status %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// statusRecorder remembers the status code written by a handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(p []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(p)
+}
+
+// Flush keeps streaming responses (the event stream, JSONL exports) working
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
+
+// traceMiddleware records a server span for each request, continuing the
+// caller's trace if the request has a traceparent header
+func traceMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if activeTracer.Load() == nil {
+			next(w, r)
+			return
+		}
+
+		ctx := r.Context()
+		if parent, ok := parseTraceparent(r.Header.Get("traceparent")); ok {
+			ctx = withSpanContext(ctx, parent)
+		}
+		route := r.Pattern
+		if route == "" {
+			route = r.URL.Path
+		}
+		ctx, span := startSpan(ctx, r.Method+" "+route, spanKindServer)
+		span.setAttr("http.request.method", r.Method)
+		span.setAttr("http.route", route)
+		span.setAttr("url.path", r.URL.Path)
+		span.setAttr("client.address", clientIP(r))
+
+		rec := &statusRecorder{ResponseWriter: w}
+		next(rec, r.WithContext(ctx))
+
+		if rec.status == 0 {
+			rec.status = http.StatusOK
+		}
+		span.setAttr("http.response.status_code", rec.status)
+		var err error
+		if rec.status >= 500 {
+			err = fmt.Errorf("%d %s", rec.status, http.StatusText(rec.status))
+		}
+		span.finish(err)
+	}
+}
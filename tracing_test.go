@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Tracing Tests
+// ============================================================================
+
+// recordSpans turns tracing on with a queue the test reads instead of a collector
+func recordSpans(t *testing.T, ratio float64) *tracer {
+	t.Helper()
+
+	tr := &tracer{service: defaultServiceName, ratio: ratio, queue: make(chan *span, traceQueueSize)}
+	activeTracer.Store(tr)
+	t.Cleanup(func() { activeTracer.Store(nil) })
+	return tr
+}
+
+// recordedSpans returns the spans finished so far, by name
+func recordedSpans(tr *tracer) map[string]*span {
+	events.wait()
+	jobs.wait()
+
+	spans := make(map[string]*span)
+	for {
+		select {
+		case s := <-tr.queue:
+			spans[s.name] = s
+		default:
+			return spans
+		}
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := parseTraceparent(header)
+	if !ok || !sc.Sampled || sc.traceparent() != header {
+		t.Errorf("expected %s to round trip, got %+v (ok %v)", header, sc, ok)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",    // No flags
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // Zero trace ID
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", // Invalid version
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01", // Not hex
+	} {
+		if _, ok := parseTraceparent(invalid); ok {
+			t.Errorf("expected %q to be rejected", invalid)
+		}
+	}
+}
+
+func TestLoadTracer(t *testing.T) {
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "OTEL_EXPORTER_OTLP_HEADERS", "OTEL_SERVICE_NAME", "OTEL_TRACES_SAMPLER_ARG"} {
+		t.Setenv(name, "")
+	}
+	if tr, err := loadTracer(); err != nil || tr != nil {
+		t.Errorf("expected tracing off without an endpoint, got %+v (err %v)", tr, err)
+	}
+
+	t.Setenv("OTEL_EXPORTER_OTLP_ENDPOINT", "http://collector:4318/")
+	t.Setenv("OTEL_EXPORTER_OTLP_HEADERS", "Authorization=Bearer%20secret, X-Tenant=ieee")
+	t.Setenv("OTEL_TRACES_SAMPLER_ARG", "0.25")
+	tr, err := loadTracer()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if tr.endpoint != "http://collector:4318/v1/traces" || tr.ratio != 0.25 ||
+		tr.headers["Authorization"] != "Bearer secret" || tr.headers["X-Tenant"] != "ieee" {
+		t.Errorf("unexpected tracer %+v", tr)
+	}
+
+	for name, value := range map[string]string{
+		"OTEL_TRACES_SAMPLER_ARG":            "2",
+		"OTEL_EXPORTER_OTLP_HEADERS":         "no-value",
+		"OTEL_EXPORTER_OTLP_TRACES_ENDPOINT": "collector:4318",
+	} {
+		t.Run(name, func(t *testing.T) {
+			t.Setenv(name, value)
+			if _, err := loadTracer(); err == nil {
+				t.Errorf("expected an error for %s=%s", name, value)
+			}
+		})
+	}
+}
+
+func TestTracing_ScanJoinsCallerTrace(t *testing.T) {
+	setupTest()
+	tr := recordSpans(t, 1)
+
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid": "TEST_UID_1"}`))
+	req.Header.Set("traceparent", parent)
+	rr := httptest.NewRecorder()
+	traceMiddleware(handleScan)(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %v", rr.Code)
+	}
+
+	spans := recordedSpans(tr)
+	server := spans["POST /scan"]
+	if server == nil || server.kind != spanKindServer || server.attrs["http.response.status_code"] != http.StatusOK {
+		t.Fatalf("expected a server span, got %+v", spans)
+	}
+	if server.context.traceparent()[:36] != parent[:36] {
+		t.Errorf("expected the caller's trace, got %s", server.context.traceparent())
+	}
+
+	// The sign-in, and the event handlers running after the response, are children
+	for _, name := range []string{"members.lookup", "attendees.sign_in", "event sign_in metrics", "event office_opened office"} {
+		s := spans[name]
+		if s == nil {
+			t.Errorf("expected a %s span, got %v", name, spans)
+			continue
+		}
+		if s.context.TraceID != server.context.TraceID {
+			t.Errorf("expected %s in the request's trace", name)
+		}
+	}
+	if s := spans["attendees.sign_in"]; s != nil && (s.parentID != server.context.SpanID || s.attrs["attendees.store"] != "file") {
+		t.Errorf("unexpected sign-in span %+v", s)
+	}
+}
+
+func TestTracing_SignOutRecordsVisitWrite(t *testing.T) {
+	setupTest()
+	scanCard("TEST_UID_1")
+	tr := recordSpans(t, 1)
+
+	scanCard("TEST_UID_1")
+	spans := recordedSpans(tr)
+	if s := spans["db.save_visit"]; s == nil || s.kind != spanKindClient || s.err != "" {
+		t.Errorf("expected a successful db.save_visit span, got %+v", s)
+	}
+}
+
+func TestTracing_NotSampled(t *testing.T) {
+	setupTest()
+	tr := recordSpans(t, 0)
+
+	scanCard("TEST_UID_1")
+	if spans := recordedSpans(tr); len(spans) != 0 {
+		t.Errorf("expected no spans with a ratio of 0, got %v", spans)
+	}
+
+	// The caller's sampling decision wins
+	req := httptest.NewRequest("POST", "/scan", bytes.NewBufferString(`{"uid": "TEST_UID_2"}`))
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	traceMiddleware(handleScan)(httptest.NewRecorder(), req)
+	if spans := recordedSpans(tr); spans["POST /scan"] == nil {
+		t.Error("expected a sampled caller's trace to be recorded")
+	}
+}
+
+func TestTracerExport(t *testing.T) {
+	var body []byte
+	var auth string
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ = io.ReadAll(r.Body)
+		auth = r.Header.Get("Authorization")
+	}))
+	defer collector.Close()
+
+	tr := &tracer{service: "office-test", endpoint: collector.URL + "/v1/traces",
+		headers: map[string]string{"Authorization": "Bearer secret"}, client: collector.Client()}
+	sc, _ := parseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	s := &span{name: "db.save_visit", kind: spanKindClient, context: sc, start: time.Now(), end: time.Now(),
+		attrs: map[string]interface{}{"member.id": int64(1)}, err: "database is locked"}
+
+	if err := tr.export([]*span{s}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if auth != "Bearer secret" {
+		t.Errorf("expected the configured headers, got %q", auth)
+	}
+
+	var traces otlpTraces
+	if err := json.Unmarshal(body, &traces); err != nil || len(traces.ResourceSpans) != 1 {
+		t.Fatalf("invalid export %s: %v", body, err)
+	}
+	rs := traces.ResourceSpans[0]
+	if *rs.Resource.Attributes[0].Value.StringValue != "office-test" {
+		t.Errorf("expected the service name, got %s", body)
+	}
+	out := rs.ScopeSpans[0].Spans[0]
+	if out.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || out.Status.Code != 2 || *out.Attributes[0].Value.IntValue != "1" {
+		t.Errorf("unexpected span %s", body)
+	}
+	if !strings.Contains(string(body), `"kind":3`) {
+		t.Errorf("expected a client span, got %s", body)
+	}
+}
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// --- Member Trash ---
+//
+// DELETE /members/{id} does not delete a member outright. It moves them to
+// the trash: the member is marked deleted (deleted_at, like merged
+// duplicates but without merged_into), leaves the member lists and their
+// card stops working. Their visits move to trashed_visits with their project
+// allocations and amendments, so they leave every report as before; with
+// ?keep_sessions=true the visits stay in the reports until the member is
+// purged.
+//
+// For trashRetention (30 days) the member can be restored with their
+// visits from /admin/trash. After that the purge job, run every
+// trashPurgeInterval, deletes them for good, along with everything that
+// referenced them; DELETE /admin/trash/{id} purges one at once.
+//   - GET /admin/trash lists the trashed members
+//   - POST /admin/trash/{id}/restore brings one back
+//   - DELETE /admin/trash/{id} purges one now
+
+const (
+	trashRetention     = 30 * 24 * time.Hour
+	trashPurgeInterval = time.Hour
+)
+
+// TrashedMember is a deleted member that can still be restored
+type TrashedMember struct {
+	ID              int64     `json:"id"`
+	Name            string    `json:"name"`
+	UID             string    `json:"uid"`
+	Role            string    `json:"role"`
+	OrgID           string    `json:"org_id"`
+	DeletedAt       time.Time `json:"deleted_at"`
+	PurgeAt         time.Time `json:"purge_at"`
+	TrashedSessions int       `json:"trashed_sessions"` // Visits moved to the trash with them
+	KeptSessions    int       `json:"kept_sessions"`    // Visits left in the reports (?keep_sessions=true)
+}
+
+// trashedMemberQuery selects the trashed members for scanTrashedMember
+const trashedMemberQuery = `SELECT m.id, m.name, m.uid, m.role, m.org_id, m.deleted_at,
+	(SELECT COUNT(*) FROM trashed_visits t WHERE t.member_id = m.id),
+	(SELECT COUNT(*) FROM visits v WHERE v.member_id = m.id)
+	FROM members m WHERE m.deleted_at IS NOT NULL AND m.merged_into IS NULL`
+
+// scanTrashedMember reads a row selected by trashedMemberQuery
+func scanTrashedMember(row rowScanner) (TrashedMember, error) {
+	var m TrashedMember
+	var deletedAt string
+	if err := row.Scan(&m.ID, &m.Name, &m.UID, &m.Role, &m.OrgID, &deletedAt, &m.TrashedSessions, &m.KeptSessions); err != nil {
+		return TrashedMember{}, err
+	}
+	var err error
+	if m.DeletedAt, err = time.Parse(time.RFC3339, deletedAt); err != nil {
+		return TrashedMember{}, err
+	}
+	m.PurgeAt = m.DeletedAt.Add(trashRetention)
+	return m, nil
+}
+
+// loadTrashedMember fetches a trashed member by ID
+func loadTrashedMember(id int64) (TrashedMember, error) {
+	return scanTrashedMember(db.QueryRow(trashedMemberQuery+` AND m.id = ?`, id))
+}
+
+// writeUIDConflict responds 409 to a card already registered to another
+// member. A trashed member keeps their UID until purged, so if the card is
+// theirs (and in the caller's organization) the response names them and says
+// how to free it.
+func writeUIDConflict(w http.ResponseWriter, r *http.Request, uid string) {
+	m, err := scanTrashedMember(db.QueryRow(trashedMemberQuery+` AND m.uid = ?`, uid))
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error looking up trashed member with UID %s: %v", uid, err)
+		}
+		http.Error(w, "UID already exists", http.StatusConflict)
+		return
+	}
+	if m.OrgID != requestOrg(r) {
+		http.Error(w, "UID already exists", http.StatusConflict)
+		return
+	}
+	http.Error(w, fmt.Sprintf("UID belongs to %s (%d), who is in the trash until %s: restore them with POST /admin/trash/%d/restore or purge them with DELETE /admin/trash/%d",
+		m.Name, m.ID, m.PurgeAt.Format("2006-01-02"), m.ID, m.ID), http.StatusConflict)
+}
+
+// loadTrashedMembers returns the trashed members, most recently deleted first
+func loadTrashedMembers() ([]TrashedMember, error) {
+	rows, err := db.Query(trashedMemberQuery + ` ORDER BY m.deleted_at DESC, m.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	trashed := []TrashedMember{}
+	for rows.Next() {
+		m, err := scanTrashedMember(rows)
+		if err != nil {
+			return nil, err
+		}
+		trashed = append(trashed, m)
+	}
+	return trashed, rows.Err()
+}
+
+// trashMember moves a member to the trash with their visits, unless
+// keepSessions, failing with sql.ErrNoRows if there is no such member
+func trashMember(id int64, keepSessions bool, now time.Time) (TrashedMember, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return TrashedMember{}, err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`UPDATE members SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL`, now.UTC().Format(time.RFC3339), id)
+	if err != nil {
+		return TrashedMember{}, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return TrashedMember{}, sql.ErrNoRows
+	}
+
+	if !keepSessions {
+		if err := appendVisitDeletions(tx, "member_id = ?", id); err != nil {
+			return TrashedMember{}, err
+		}
+		for _, stmt := range []string{
+			`INSERT INTO trashed_visits (id, member_id, signin_time, signout_time)
+				SELECT id, member_id, signin_time, signout_time FROM visits WHERE member_id = ?`,
+			`INSERT INTO trashed_session_allocations (visit_id, project_id, seconds)
+				SELECT a.visit_id, a.project_id, a.seconds FROM session_allocations a JOIN visits v ON v.id = a.visit_id WHERE v.member_id = ?`,
+			`INSERT INTO trashed_visit_amendments (id, visit_id, signin_time, signout_time, reason, amended_by, created_at)
+				SELECT a.id, a.visit_id, a.signin_time, a.signout_time, a.reason, a.amended_by, a.created_at
+				FROM visit_amendments a JOIN visits v ON v.id = a.visit_id WHERE v.member_id = ?`,
+			`DELETE FROM visits WHERE member_id = ?`, // Segments, allocations and amendments follow
+		} {
+			if _, err := tx.Exec(stmt, id); err != nil {
+				return TrashedMember{}, err
+			}
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return TrashedMember{}, err
+	}
+	return loadTrashedMember(id)
+}
+
+// restoreMember takes a member out of the trash with their visits, failing
+// with sql.ErrNoRows if they are not in it
+func restoreMember(id int64) (Member, int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return Member{}, 0, err
+	}
+	defer tx.Rollback()
+
+	var member Member
+	err = tx.QueryRow(`UPDATE members SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL AND merged_into IS NULL
+		RETURNING id, name, uid, discord_id, role, status, org_id`, id).
+		Scan(&member.ID, &member.Name, &member.UID, decrypted{&member.DiscordID}, &member.Role, &member.Status, &member.OrgID)
+	if err != nil {
+		return Member{}, 0, err
+	}
+
+	type trashedVisit struct {
+		id              int64
+		signin, signout string
+	}
+	rows, err := tx.Query(`SELECT id, signin_time, signout_time FROM trashed_visits WHERE member_id = ?`, id)
+	if err != nil {
+		return Member{}, 0, err
+	}
+	var visits []trashedVisit
+	for rows.Next() {
+		var v trashedVisit
+		if err := rows.Scan(&v.id, &v.signin, &v.signout); err != nil {
+			rows.Close()
+			return Member{}, 0, err
+		}
+		visits = append(visits, v)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return Member{}, 0, err
+	}
+
+	// Visits keep their IDs, which AUTOINCREMENT never hands out again
+	for _, v := range visits {
+		if _, err := tx.Exec(`INSERT INTO visits (id, member_id, signin_time, signout_time) VALUES (?, ?, ?, ?)`,
+			v.id, id, v.signin, v.signout); err != nil {
+			return Member{}, 0, err
+		}
+		if !splitSessionsAtMidnight() {
+			continue
+		}
+		signin, err := time.Parse(time.RFC3339, v.signin)
+		if err != nil {
+			return Member{}, 0, err
+		}
+		signout, err := time.Parse(time.RFC3339, v.signout)
+		if err != nil {
+			return Member{}, 0, err
+		}
+		if _, err := saveVisitSegments(tx, v.id, signin, signout); err != nil {
+			return Member{}, 0, err
+		}
+	}
+	// Allocations to projects deleted meanwhile are dropped
+	if _, err := tx.Exec(`INSERT INTO session_allocations (visit_id, project_id, seconds)
+		SELECT t.visit_id, t.project_id, t.seconds FROM trashed_session_allocations t JOIN trashed_visits v ON v.id = t.visit_id
+		WHERE v.member_id = ? AND t.project_id IN (SELECT id FROM projects)`, id); err != nil {
+		return Member{}, 0, err
+	}
+	if err := restoreAmendments(tx, id); err != nil {
+		return Member{}, 0, err
+	}
+	restored := `IN (SELECT id FROM trashed_visits WHERE member_id = ?)`
+	if err := appendLedgerEntries(tx, "visit.saved", "id "+restored, id); err != nil {
+		return Member{}, 0, err
+	}
+	if err := appendLedgerEntries(tx, "amendment.saved", "visit_id "+restored, id); err != nil {
+		return Member{}, 0, err
+	}
+	if _, err := tx.Exec(`DELETE FROM trashed_visits WHERE member_id = ?`, id); err != nil {
+		return Member{}, 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Member{}, 0, err
+	}
+	memberCache.put(member)
+	return member, len(visits), nil
+}
+
+// restoreAmendments moves the amendments of a member's trashed visits back,
+// with their IDs and segments, once the visits are restored
+func restoreAmendments(tx *sql.Tx, memberID int64) error {
+	rows, err := tx.Query(`INSERT INTO visit_amendments (id, visit_id, signin_time, signout_time, reason, amended_by, created_at)
+		SELECT a.id, a.visit_id, a.signin_time, a.signout_time, a.reason, a.amended_by, a.created_at
+		FROM trashed_visit_amendments a JOIN trashed_visits v ON v.id = a.visit_id WHERE v.member_id = ?
+		RETURNING id, signin_time, signout_time`, memberID)
+	if err != nil {
+		return err
+	}
+	type restored struct {
+		id              int64
+		signin, signout time.Time
+	}
+	var amendments []restored
+	for rows.Next() {
+		var a restored
+		var signin, signout string
+		if err := rows.Scan(&a.id, &signin, &signout); err != nil {
+			rows.Close()
+			return err
+		}
+		if a.signin, err = time.Parse(time.RFC3339, signin); err != nil {
+			rows.Close()
+			return err
+		}
+		if a.signout, err = time.Parse(time.RFC3339, signout); err != nil {
+			rows.Close()
+			return err
+		}
+		amendments = append(amendments, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, a := range amendments {
+		if err := saveAmendmentSegments(tx, a.id, a.signin, a.signout); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// purgeMember deletes a trashed member for good with everything referencing
+// them, failing with sql.ErrNoRows if they are not in the trash
+func purgeMember(id int64) error {
+	if _, err := loadTrashedMember(id); err != nil {
+		return err
+	}
+	if _, err := removeMemberPhoto(id); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// CASCADE deletes their visits, trashed visits and the rest; visits kept
+	// in the reports leave the session ledger
+	if err := appendVisitDeletions(tx, "member_id = ?", id); err != nil {
+		return err
+	}
+	res, err := tx.Exec(`DELETE FROM members WHERE id = ? AND deleted_at IS NOT NULL AND merged_into IS NULL`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// purgeExpiredTrash purges the members trashed more than trashRetention ago
+func purgeExpiredTrash(now time.Time) error {
+	trashed, err := loadTrashedMembers()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range trashed {
+		if now.Before(m.PurgeAt) {
+			continue
+		}
+		// Another instance may have purged or restored it meanwhile
+		if err := purgeMember(m.ID); err == sql.ErrNoRows {
+			continue
+		} else if err != nil {
+			return err
+		}
+		logStore.infof("Purged member %s (%d) from the trash", m.Name, m.ID)
+		recordAudit("member.purged", "system", fmt.Sprintf("member=%d name=%q deleted_at=%s", m.ID, m.Name, m.DeletedAt.Format(time.RFC3339)))
+	}
+	return nil
+}
+
+// startTrashPurger periodically purges members kept in the trash long enough
+func startTrashPurger() {
+	ticker := time.NewTicker(trashPurgeInterval)
+	defer ticker.Stop()
+
+	for now := range ticker.C {
+		if err := purgeExpiredTrash(now); err != nil {
+			log.Printf("Error purging the trash: %v", err)
+		}
+	}
+}
+
+// handleTrash lists the trashed members
+func handleTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	trashed, err := loadTrashedMembers()
+	if err != nil {
+		log.Printf("Error querying trashed members: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(trashed)
+}
+
+// handleTrashedMember handles GET and DELETE (purge) /admin/trash/{id} and
+// POST /admin/trash/{id}/restore
+func handleTrashedMember(w http.ResponseWriter, r *http.Request) {
+	id, action, ok := parseIDPath(r.URL.Path, "/admin/trash/")
+	if !ok {
+		http.Error(w, "Invalid member ID", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case action == "" && r.Method == http.MethodGet:
+		m, err := loadTrashedMember(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Member not in the trash", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error querying trashed member: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(m)
+
+	case action == "" && r.Method == http.MethodDelete:
+		m, err := loadTrashedMember(id)
+		if err == nil {
+			err = purgeMember(id)
+		}
+		if err == sql.ErrNoRows {
+			http.Error(w, "Member not in the trash", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error purging member: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("member.purged", clientIP(r), fmt.Sprintf("member=%d name=%q deleted_at=%s", m.ID, m.Name, m.DeletedAt.Format(time.RFC3339)))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"message": fmt.Sprintf("%s purged", m.Name)})
+
+	case action == "":
+		methodNotAllowed(w, http.MethodGet, http.MethodDelete)
+
+	case action == "restore" && r.Method == http.MethodPost:
+		member, visits, err := restoreMember(id)
+		if err == sql.ErrNoRows {
+			http.Error(w, "Member not in the trash", http.StatusNotFound)
+			return
+		} else if err != nil {
+			log.Printf("Error restoring member: %v", err)
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		recordAudit("member.restored", clientIP(r), fmt.Sprintf("member=%d name=%q visits=%d", member.ID, member.Name, visits))
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(withPhotoURL(member))
+
+	case action == "restore":
+		methodNotAllowed(w, http.MethodPost)
+
+	default:
+		http.NotFound(w, r)
+	}
+}
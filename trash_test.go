@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Member Trash Tests
+// ============================================================================
+
+// deleteMember calls DELETE /members/{path}
+func deleteMember(t *testing.T, path string) {
+	t.Helper()
+	req, _ := http.NewRequest("DELETE", "/members/"+path, nil)
+	rr := httptest.NewRecorder()
+	handleMember(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+}
+
+// trashRequest calls /admin/trash/{path}
+func trashRequest(method, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, "/admin/trash/"+path, nil)
+	rr := httptest.NewRecorder()
+	handleTrashedMember(rr, req)
+	return rr
+}
+
+// countRows counts the rows of a query
+func countRows(t *testing.T, query string, args ...interface{}) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(query, args...).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestMemberTrash_RestoreWithVisits(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	res, _ := db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (1, ?, ?)`,
+		now.Add(-3*time.Hour).Format(time.RFC3339), now.Add(-time.Hour).Format(time.RFC3339))
+	visitID, _ := res.LastInsertId()
+	db.Exec(`INSERT INTO projects (name, created_at) VALUES ('Robot', ?)`, now.Format(time.RFC3339))
+	db.Exec(`INSERT INTO session_allocations (visit_id, project_id, seconds) VALUES (?, 1, 3600)`, visitID)
+	if _, err := amendSession(visitID, SessionTimes{now.Add(-3 * time.Hour), now.Add(-90 * time.Minute)}, "left early", "test", now); err != nil {
+		t.Fatal(err)
+	}
+
+	deleteMember(t, "1")
+	if _, found := findMemberByID(1); found {
+		t.Error("expected Alice gone from the members")
+	}
+	if rr := scanCard("TEST_UID_1"); rr.Code != http.StatusForbidden {
+		t.Errorf("expected her card refused, got %v", rr.Code)
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM visits WHERE member_id = 1`); n != 0 {
+		t.Errorf("expected her visits out of the reports, got %d", n)
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/trash", nil)
+	rr := httptest.NewRecorder()
+	handleTrash(rr, req)
+	var trashed []TrashedMember
+	json.Unmarshal(rr.Body.Bytes(), &trashed)
+	if len(trashed) != 1 || trashed[0].Name != "Alice" || trashed[0].TrashedSessions != 1 || trashed[0].PurgeAt.Sub(trashed[0].DeletedAt) != trashRetention {
+		t.Fatalf("expected Alice in the trash with her visit, got %+v", trashed)
+	}
+
+	if rr := trashRequest("POST", "1/restore"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if _, found := memberCache.get("TEST_UID_1"); !found {
+		t.Error("expected Alice back in the cache")
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM visits WHERE id = ? AND member_id = 1`, visitID); n != 1 {
+		t.Error("expected her visit restored with its ID")
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM session_allocations WHERE visit_id = ?`, visitID); n != 1 {
+		t.Error("expected her project time restored")
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM visit_amendments WHERE visit_id = ?`, visitID); n != 1 {
+		t.Error("expected her amendment restored")
+	}
+	if rr := trashRequest("POST", "1/restore"); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 restoring twice, got %v", rr.Code)
+	}
+
+	for _, action := range []string{"member.trashed", "member.restored"} {
+		if entries, _ := loadAuditEntries(action, 10); len(entries) != 1 {
+			t.Errorf("expected %s audited, got %+v", action, entries)
+		}
+	}
+}
+
+func TestMemberTrash_KeepSessionsAndPurge(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (2, ?, ?)`,
+		now.Add(-3*time.Hour).Format(time.RFC3339), now.Add(-time.Hour).Format(time.RFC3339))
+
+	deleteMember(t, "1")
+	deleteMember(t, "2?keep_sessions=true")
+	if n := countRows(t, `SELECT COUNT(*) FROM visits WHERE member_id = 2`); n != 1 {
+		t.Errorf("expected Bob's visit kept in the reports, got %d", n)
+	}
+
+	// Nothing is purged before the 30 days are up
+	if err := purgeExpiredTrash(now.Add(trashRetention - time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM members WHERE id IN (1, 2)`); n != 2 {
+		t.Fatalf("expected both kept, got %d", n)
+	}
+
+	if rr := trashRequest("DELETE", "1"); rr.Code != http.StatusOK {
+		t.Errorf("expected 200 OK purging, got %v", rr.Code)
+	}
+	if err := purgeExpiredTrash(now.Add(trashRetention + time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM members WHERE id IN (1, 2)`); n != 0 {
+		t.Errorf("expected both purged, got %d", n)
+	}
+	if n := countRows(t, `SELECT COUNT(*) FROM visits WHERE member_id = 2`); n != 0 {
+		t.Errorf("expected Bob's visit purged with them, got %d", n)
+	}
+	if entries, _ := loadAuditEntries("member.purged", 10); len(entries) != 2 {
+		t.Errorf("expected both purges audited, got %+v", entries)
+	}
+}
+
+func TestMemberTrash_ReregisterCard(t *testing.T) {
+	setupTest()
+	deleteMember(t, "1")
+
+	// The front desk registers Alice's card to a new member
+	req, _ := http.NewRequest("POST", "/members", bytes.NewBufferString(`{"name":"Carol","uid":"TEST_UID_1","discord_id":"333333333"}`))
+	rr := httptest.NewRecorder()
+	handleMembers(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("expected 409 Conflict, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	if body := rr.Body.String(); !strings.Contains(body, "Alice (1)") || !strings.Contains(body, "/admin/trash/1/restore") {
+		t.Errorf("expected the trashed member and how to restore them, got %q", body)
+	}
+
+	rr = importCSV("dry_run=true&mapping="+url.QueryEscape(membershipMapping), "First Last,Card Number,Discord ID\nCarol Chen,TEST_UID_1,333333333\n")
+	report := decodeImportReport(t, rr)
+	if row := report.Rows[0]; row.Status != "invalid" || !strings.Contains(row.Errors[0], "member 1 in the trash") {
+		t.Errorf("expected the import row to name the trashed member, got %+v", row)
+	}
+
+	// A live member's card gets the usual answer
+	req, _ = http.NewRequest("POST", "/members", bytes.NewBufferString(`{"name":"Carol","uid":"TEST_UID_2","discord_id":"333333333"}`))
+	rr = httptest.NewRecorder()
+	handleMembers(rr, req)
+	if rr.Code != http.StatusConflict || strings.TrimSpace(rr.Body.String()) != "UID already exists" {
+		t.Errorf("expected a plain conflict, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+
+	// Once Alice is purged the card is free
+	if rr := trashRequest("DELETE", "1"); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK purging, got %v", rr.Code)
+	}
+	req, _ = http.NewRequest("POST", "/members", bytes.NewBufferString(`{"name":"Carol","uid":"TEST_UID_1","discord_id":"333333333"}`))
+	rr = httptest.NewRecorder()
+	handleMembers(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected 201 Created once purged, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// --- Key Scopes and Redacted Views ---
+//
+// Every API key has a scope: admin (default), member or public. Keys listed in
+// API_KEYS may carry a scope suffix, e.g. API_KEYS=kiosk-key:public,dash:member;
+// the server refuses to start on an unknown one.
+// The scope caps which view of personal data a client may request through
+// ?view=public|member|admin on read endpoints:
+//   - admin: full names and identifiers
+//   - member: initials only, masked card UIDs
+//   - public: counts only, no identities
+//
+// Non-admin keys are read-only and limited to the endpoints in scopedReadRoutes.
+
+const (
+	scopePublic = "public"
+	scopeMember = "member"
+	scopeAdmin  = "admin"
+)
+
+var (
+	// Scope per API key; keys without an entry have admin scope
+	apiKeyScopes map[string]string
+
+	// Endpoints non-admin keys may read (those listing people honour ?view=)
+	scopedReadRoutes = map[string]bool{
+		"/current":            true,
+		"/visits":             true,
+		"/count":              true,
+		"/stats/heatmap":      true,
+		"/stats/live":         true,
+		"/status/today":       true,
+		"/status/stream":      true,
+		"/display/summary":    true,
+		"/announcements/next": true,
+		"/events/poll":        true,
+	}
+)
+
+// scopeContextKey is the request context key holding the caller's scope
+type scopeContextKey struct{}
+
+// scopeLevel orders scopes from least to most privileged (0 means unknown)
+func scopeLevel(scope string) int {
+	switch scope {
+	case scopePublic:
+		return 1
+	case scopeMember:
+		return 2
+	case scopeAdmin:
+		return 3
+	}
+	return 0
+}
+
+// parseAPIKeyEntry splits an API_KEYS entry of the form key[:scope], ignoring
+// any @org suffix (see loadAPIKeyOrgs). Keys without a scope are admin keys;
+// an unknown scope is an error rather than admin, so a typo can't grant it.
+func parseAPIKeyEntry(entry string) (string, string, error) {
+	entry, _ = splitAPIKeyOrg(entry)
+	key, scope, found := strings.Cut(strings.TrimSpace(entry), ":")
+	key = strings.TrimSpace(key)
+	if !found {
+		return key, scopeAdmin, nil
+	}
+	scope = strings.ToLower(strings.TrimSpace(scope))
+	if scopeLevel(scope) == 0 {
+		return "", "", fmt.Errorf("unknown scope %q, expected public, member or admin", scope)
+	}
+	return key, scope, nil
+}
+
+// loadAPIKeyScopes returns the scope of every scoped key listed in API_KEYS,
+// failing on unknown scopes
+func loadAPIKeyScopes() (map[string]string, error) {
+	scopes := make(map[string]string)
+	for i, entry := range strings.Split(os.Getenv("API_KEYS"), ",") {
+		key, scope, err := parseAPIKeyEntry(entry)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i+1, err)
+		}
+		if key != "" && scope != scopeAdmin {
+			scopes[key] = scope
+		}
+	}
+	return scopes, nil
+}
+
+// withScope returns a context carrying the caller's scope
+func withScope(ctx context.Context, scope string) context.Context {
+	return context.WithValue(ctx, scopeContextKey{}, scope)
+}
+
+// requestScope returns the caller's scope (admin when unauthenticated mode is in use)
+func requestScope(r *http.Request) string {
+	if scope, ok := r.Context().Value(scopeContextKey{}).(string); ok {
+		return scope
+	}
+	return scopeAdmin
+}
+
+// scopeAllowsRequest reports whether a key with the given scope may make this request
+func scopeAllowsRequest(scope string, r *http.Request) bool {
+	if scope == scopeAdmin {
+		return true
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+	return scopedReadRoutes[r.URL.Path]
+}
+
+// resolveView determines the view for a read request from ?view= and the caller's scope.
+// It writes an error response and returns false if the view is invalid or not permitted.
+func resolveView(w http.ResponseWriter, r *http.Request) (string, bool) {
+	scope := requestScope(r)
+	view := r.URL.Query().Get("view")
+	if view == "" {
+		return scope, true
+	}
+
+	if scopeLevel(view) == 0 {
+		http.Error(w, "Invalid 'view' parameter, expected public, member or admin", http.StatusBadRequest)
+		return "", false
+	}
+	if scopeLevel(view) > scopeLevel(scope) {
+		http.Error(w, "API key scope does not allow the '"+view+"' view", http.StatusForbidden)
+		return "", false
+	}
+	return view, true
+}
+
+// initials reduces a name to its initials, e.g. "Alice Lee" becomes "A.L."
+func initials(name string) string {
+	var b strings.Builder
+	for _, word := range strings.Fields(name) {
+		for _, r := range word {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) {
+				b.WriteRune(unicode.ToUpper(r))
+				b.WriteByte('.')
+				break
+			}
+		}
+	}
+	return b.String()
+}
+
+// redactName returns the name as it should appear in the given view
+func redactName(name, view string) string {
+	if view == scopeAdmin {
+		return name
+	}
+	return initials(name)
+}
+
+// maskUID hides all but the last 4 characters of a card UID, e.g. "****D7A1"
+func maskUID(uid string) string {
+	if len(uid) <= 4 {
+		return strings.Repeat("*", len(uid))
+	}
+	return strings.Repeat("*", len(uid)-4) + uid[len(uid)-4:]
+}
+
+// writeCountOnly responds with just a count, used by the public view
+func writeCountOnly(w http.ResponseWriter, count int) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"count": count})
+}
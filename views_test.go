@@ -0,0 +1,258 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Key Scope & Redacted View Tests
+// ============================================================================
+
+// scopedRequest builds a request carrying the given key scope
+func scopedRequest(method, url, scope string) *http.Request {
+	req, _ := http.NewRequest(method, url, nil)
+	return req.WithContext(withScope(req.Context(), scope))
+}
+
+func TestInitials(t *testing.T) {
+	cases := map[string]string{
+		"Alice":             "A.",
+		"alice lee":         "A.L.",
+		"  Bob   van Dyke ": "B.V.D.",
+		"(Charlie) Brown":   "C.B.",
+		"":                  "",
+	}
+	for name, want := range cases {
+		if got := initials(name); got != want {
+			t.Errorf("initials(%q) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestLoadAPIKeyScopes(t *testing.T) {
+	original := os.Getenv("API_KEYS")
+	defer os.Setenv("API_KEYS", original)
+
+	os.Setenv("API_KEYS", "admin-key, kiosk-key:public ,dash-key:member")
+
+	scopes, err := loadAPIKeyScopes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if scopes["kiosk-key"] != scopePublic || scopes["dash-key"] != scopeMember {
+		t.Errorf("unexpected scopes: %v", scopes)
+	}
+	if _, ok := scopes["admin-key"]; ok {
+		t.Error("unscoped keys should default to admin and not be listed")
+	}
+
+	keys := loadAPIKeys()
+	if !keys["kiosk-key"] || keys["kiosk-key:public"] {
+		t.Errorf("expected scope suffix to be stripped from keys, got %v", keys)
+	}
+}
+
+func TestLoadAPIKeyScopes_UnknownScope(t *testing.T) {
+	// A misspelt scope must not leave the key with admin rights
+	for _, entries := range []string{"admin-key,dash-key:memebr", "dash-key:", "ess-tv:pubic@ess"} {
+		t.Setenv("API_KEYS", entries)
+		if scopes, err := loadAPIKeyScopes(); err == nil {
+			t.Errorf("%s: expected an error, got %v", entries, scopes)
+		}
+		var c selfCheck
+		if checkConfiguration(&c); c.failed() != 1 {
+			t.Errorf("%s: expected --check to fail on API_KEYS, got %+v", entries, c.results)
+		}
+	}
+}
+
+func TestHandleCurrent_PublicViewCountOnly(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+	currentAttendees.signIn("TEST_UID_2", "", time.Now())
+
+	rr := httptest.NewRecorder()
+	handleCurrent(rr, scopedRequest("GET", "/current", scopePublic))
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 OK, got %v", rr.Code)
+	}
+	var resp map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("expected count object, got %s", rr.Body.String())
+	}
+	if resp["count"] != 2 {
+		t.Errorf("expected count 2, got %v", resp["count"])
+	}
+}
+
+func TestHandleCurrent_MemberViewInitials(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+
+	rr := httptest.NewRecorder()
+	handleCurrent(rr, scopedRequest("GET", "/current", scopeMember))
+
+	var attendees []ActiveAttendee
+	if err := json.Unmarshal(rr.Body.Bytes(), &attendees); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(attendees) != 1 || attendees[0].Name != "A." {
+		t.Errorf("expected initials only, got %+v", attendees)
+	}
+}
+
+func TestHandleCurrent_IdentifiersByView(t *testing.T) {
+	setupTest()
+
+	alice := cachedMember("TEST_UID_1")
+	currentAttendees.signIn(alice.UID, "", time.Now().Add(-90*time.Second))
+
+	get := func(scope string) ActiveAttendee {
+		rr := httptest.NewRecorder()
+		handleCurrent(rr, scopedRequest("GET", "/current", scope))
+		var attendees []ActiveAttendee
+		if err := json.Unmarshal(rr.Body.Bytes(), &attendees); err != nil || len(attendees) != 1 {
+			t.Fatalf("expected one attendee, got %s", rr.Body.String())
+		}
+		return attendees[0]
+	}
+
+	admin := get(scopeAdmin)
+	if admin.MemberID != alice.ID || admin.UID != alice.UID || admin.DiscordID != alice.DiscordID {
+		t.Errorf("expected full identifiers in the admin view, got %+v", admin)
+	}
+	if admin.DurationSeconds < 90 || admin.DurationSeconds > 95 {
+		t.Errorf("expected about 90 seconds inside, got %d", admin.DurationSeconds)
+	}
+	if !admin.AutoSignOutAt.After(time.Now()) || admin.AutoSignOutAt.Hour() != nightlyCleanupHour {
+		t.Errorf("expected the next nightly cleanup as will_auto_signout_at, got %v", admin.AutoSignOutAt)
+	}
+
+	member := get(scopeMember)
+	if member.MemberID != alice.ID || member.UID != maskUID(alice.UID) || member.DiscordID != "" {
+		t.Errorf("expected a masked UID and no Discord ID in the member view, got %+v", member)
+	}
+}
+
+func TestMaskUID(t *testing.T) {
+	tests := map[string]string{
+		"04A3B2C1D7": "******C1D7",
+		"ABCD":       "****",
+		"AB":         "**",
+		"":           "",
+	}
+	for uid, want := range tests {
+		if got := maskUID(uid); got != want {
+			t.Errorf("maskUID(%q) = %q, want %q", uid, got, want)
+		}
+	}
+}
+
+func TestHandleCurrent_AdminCanDowngradeView(t *testing.T) {
+	setupTest()
+
+	currentAttendees.signIn("TEST_UID_1", "", time.Now())
+
+	rr := httptest.NewRecorder()
+	handleCurrent(rr, scopedRequest("GET", "/current?view=public", scopeAdmin))
+
+	var resp map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp["count"] != 1 {
+		t.Errorf("expected public count view, got %s", rr.Body.String())
+	}
+}
+
+func TestHandleCurrent_ViewAboveScopeForbidden(t *testing.T) {
+	setupTest()
+
+	rr := httptest.NewRecorder()
+	handleCurrent(rr, scopedRequest("GET", "/current?view=admin", scopePublic))
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 Forbidden, got %v", rr.Code)
+	}
+}
+
+func TestHandleCurrent_InvalidView(t *testing.T) {
+	setupTest()
+
+	rr := httptest.NewRecorder()
+	handleCurrent(rr, scopedRequest("GET", "/current?view=everything", scopeAdmin))
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 Bad Request, got %v", rr.Code)
+	}
+}
+
+func TestHandleVisits_RedactedViews(t *testing.T) {
+	setupTest()
+
+	now := time.Now()
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`, 1, now.Add(-2*time.Hour).Format(time.RFC3339), now.Add(-1*time.Hour).Format(time.RFC3339))
+	db.Exec(`INSERT INTO visits (member_id, signin_time, signout_time) VALUES (?, ?, ?)`, 2, now.Add(-2*time.Hour).Format(time.RFC3339), now.Add(-1*time.Hour).Format(time.RFC3339))
+
+	rr := httptest.NewRecorder()
+	handleVisits(rr, scopedRequest("GET", "/visits", scopeMember))
+
+	var visits []Visit
+	if err := json.Unmarshal(rr.Body.Bytes(), &visits); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	for _, v := range visits {
+		if v.Name != "A." && v.Name != "B." {
+			t.Errorf("expected initials in member view, got %q", v.Name)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	handleVisits(rr, scopedRequest("GET", "/visits?format=csv", scopePublic))
+
+	var resp map[string]int
+	if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil || resp["count"] != 2 {
+		t.Errorf("expected public view to return only a count, got %s", rr.Body.String())
+	}
+}
+
+func TestAPIKeyMiddleware_ScopedKeyRestrictions(t *testing.T) {
+	setupTest()
+
+	validAPIKeys = map[string]bool{"kiosk-key": true}
+	apiKeyScopes = map[string]string{"kiosk-key": scopePublic}
+
+	var seenScope string
+	handler := apiKeyMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		seenScope = requestScope(r)
+		w.WriteHeader(http.StatusOK)
+	})
+
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/current", http.StatusOK},
+		{"GET", "/count", http.StatusOK},
+		{"GET", "/members", http.StatusForbidden},
+		{"POST", "/sign-out-all", http.StatusForbidden},
+		{"DELETE", "/visits", http.StatusForbidden},
+	}
+	for _, c := range cases {
+		req, _ := http.NewRequest(c.method, c.path, nil)
+		req.Header.Set("X-API-Key", "kiosk-key")
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		if rr.Code != c.want {
+			t.Errorf("%s %s: expected %v, got %v", c.method, c.path, c.want, rr.Code)
+		}
+	}
+	if seenScope != scopePublic {
+		t.Errorf("expected public scope in request context, got %q", seenScope)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+)
+
+// --- Splitting Sessions at Midnight ---
+//
+// A session from 10 PM to 2 AM belongs to two days. With
+// SPLIT_SESSIONS_AT_MIDNIGHT=true, each saved visit is also stored as per-day
+// segments (split at local midnight) in visit_segments, and reports that
+// attribute sessions to days by their sign-in time use the segments instead:
+// /visits (and its CSV), /me/sessions, /me/stats and /history/aggregate.
+// Visits themselves are kept as they were, so the option can be turned off
+// again; deleting a visit deletes its segments. Amendments (see
+// sessionamendments.go) are always stored with their segments.
+//
+// Visits saved before the option was turned on count as a single segment
+// until POST /admin/visit-segments/backfill splits them. /stats/summary, the
+// heatmap and the term reports split sessions by hour already.
+
+// visitSegment is the part of a visit within one local day
+type visitSegment struct {
+	Start time.Time
+	End   time.Time
+}
+
+// BackfillReport is the response of /admin/visit-segments/backfill
+type BackfillReport struct {
+	Visits   int `json:"visits"`   // Visits split
+	Segments int `json:"segments"` // Segments written
+}
+
+// splitSessionsAtMidnight reports whether reports use per-day segments of visits
+func splitSessionsAtMidnight() bool {
+	return os.Getenv("SPLIT_SESSIONS_AT_MIDNIGHT") == "true"
+}
+
+// splitAtMidnight splits [start, end) at every local midnight it crosses
+func splitAtMidnight(start, end time.Time) []visitSegment {
+	start, end = start.Local(), end.Local()
+	var segments []visitSegment
+	for {
+		midnight := time.Date(start.Year(), start.Month(), start.Day()+1, 0, 0, 0, 0, start.Location())
+		if !midnight.Before(end) {
+			return append(segments, visitSegment{start, end})
+		}
+		segments = append(segments, visitSegment{start, midnight})
+		start = midnight
+	}
+}
+
+// segmentExecer runs statements on the database or in a transaction
+type segmentExecer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// saveVisitSegments stores the per-day segments of a visit, replacing any it had
+func saveVisitSegments(e segmentExecer, visitID int64, signin, signout time.Time) (int, error) {
+	if _, err := e.Exec(`DELETE FROM visit_segments WHERE visit_id = ?`, visitID); err != nil {
+		return 0, err
+	}
+	segments := splitAtMidnight(signin, signout)
+	for _, s := range segments {
+		if _, err := e.Exec(`INSERT INTO visit_segments (visit_id, start_time, end_time) VALUES (?, ?, ?)`,
+			visitID, s.Start.Format(time.RFC3339), s.End.Format(time.RFC3339)); err != nil {
+			return 0, err
+		}
+	}
+	return len(segments), nil
+}
+
+// reportedVisits is the source of visit rows for reports: the visits with
+// their corrected times (sessionTimesCorrected) or as recorded
+// (sessionTimesRaw), or with SPLIT_SESSIONS_AT_MIDNIGHT their segments
+// (visits without segments as they are). Rows have the columns of visits.
+func reportedVisits(times string) string {
+	switch {
+	case !splitSessionsAtMidnight() && times == sessionTimesRaw:
+		return `visits`
+	case !splitSessionsAtMidnight():
+		return correctedVisits
+	case times == sessionTimesRaw:
+		return `(SELECT v.id, v.member_id, COALESCE(s.start_time, v.signin_time) AS signin_time, COALESCE(s.end_time, v.signout_time) AS signout_time
+		FROM visits v LEFT JOIN visit_segments s ON s.visit_id = v.id)`
+	}
+	// Amended visits take the segments of their latest amendment
+	return `(SELECT v.id, v.member_id,
+			COALESCE(t.start_time, s.start_time, a.signin_time, v.signin_time) AS signin_time,
+			COALESCE(t.end_time, s.end_time, a.signout_time, v.signout_time) AS signout_time
+		FROM visits v ` + latestAmendmentJoin + `
+		LEFT JOIN visit_segments s ON a.id IS NULL AND s.visit_id = v.id
+		LEFT JOIN visit_amendment_segments t ON t.amendment_id = a.id)`
+}
+
+// backfillVisitSegments splits the visits that have no segments yet
+func backfillVisitSegments() (BackfillReport, error) {
+	var report BackfillReport
+	tx, err := db.Begin()
+	if err != nil {
+		return report, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT id, signin_time, signout_time FROM visits
+		WHERE NOT EXISTS (SELECT 1 FROM visit_segments s WHERE s.visit_id = visits.id)`)
+	if err != nil {
+		return report, err
+	}
+	type pending struct {
+		id              int64
+		signin, signout time.Time
+	}
+	var visits []pending
+	for rows.Next() {
+		var p pending
+		var signin, signout string
+		if err := rows.Scan(&p.id, &signin, &signout); err != nil {
+			rows.Close()
+			return report, err
+		}
+		if p.signin, err = time.Parse(time.RFC3339, signin); err != nil {
+			rows.Close()
+			return report, err
+		}
+		if p.signout, err = time.Parse(time.RFC3339, signout); err != nil {
+			rows.Close()
+			return report, err
+		}
+		visits = append(visits, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return report, err
+	}
+
+	for _, p := range visits {
+		n, err := saveVisitSegments(tx, p.id, p.signin, p.signout)
+		if err != nil {
+			return report, fmt.Errorf("splitting visit %d: %w", p.id, err)
+		}
+		report.Visits++
+		report.Segments += n
+	}
+	return report, tx.Commit()
+}
+
+// handleVisitSegmentsBackfill splits the visits saved before
+// SPLIT_SESSIONS_AT_MIDNIGHT was turned on (POST)
+func handleVisitSegmentsBackfill(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	report, err := backfillVisitSegments()
+	if err != nil {
+		log.Printf("Error splitting visits at midnight: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	recordAudit("visits.segments_backfilled", clientIP(r), fmt.Sprintf("%d visits, %d segments", report.Visits, report.Segments))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
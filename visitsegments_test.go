@@ -0,0 +1,187 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Midnight Splitting Tests
+// ============================================================================
+
+// lateVisit returns a 10 PM to 2 AM visit from three days ago
+func lateVisit() (time.Time, time.Time) {
+	day := time.Now().AddDate(0, 0, -3)
+	start := time.Date(day.Year(), day.Month(), day.Day(), 22, 0, 0, 0, time.Local)
+	return start, start.Add(4 * time.Hour)
+}
+
+// countVisitSegments returns the number of stored segments
+func countVisitSegments(t *testing.T) int {
+	t.Helper()
+	var n int
+	if err := db.QueryRow(`SELECT COUNT(*) FROM visit_segments`).Scan(&n); err != nil {
+		t.Fatalf("failed counting segments: %v", err)
+	}
+	return n
+}
+
+func TestSplitAtMidnight(t *testing.T) {
+	start, end := lateVisit()
+	segments := splitAtMidnight(start, end)
+	if len(segments) != 2 {
+		t.Fatalf("expected 2 segments, got %+v", segments)
+	}
+	midnight := start.Add(2 * time.Hour)
+	if !segments[0].Start.Equal(start) || !segments[0].End.Equal(midnight) ||
+		!segments[1].Start.Equal(midnight) || !segments[1].End.Equal(end) {
+		t.Errorf("unexpected segments: %+v", segments)
+	}
+
+	// Within one day, and ending exactly at midnight
+	if got := splitAtMidnight(start, midnight); len(got) != 1 {
+		t.Errorf("expected 1 segment ending at midnight, got %+v", got)
+	}
+	if got := splitAtMidnight(start, start.Add(51*time.Hour)); len(got) != 4 {
+		t.Errorf("expected 4 segments over three midnights, got %+v", got)
+	}
+}
+
+func TestSaveVisit_SplitsWhenEnabled(t *testing.T) {
+	setupTest()
+	start, end := lateVisit()
+
+	saveVisitToDB(1, start, end)
+	if n := countVisitSegments(t); n != 0 {
+		t.Fatalf("expected no segments with the option off, got %d", n)
+	}
+
+	t.Setenv("SPLIT_SESSIONS_AT_MIDNIGHT", "true")
+	saveVisitToDB(2, start, end)
+	if n := countVisitSegments(t); n != 2 {
+		t.Fatalf("expected 2 segments, got %d", n)
+	}
+
+	// The original record is kept
+	var visits int
+	db.QueryRow(`SELECT COUNT(*) FROM visits`).Scan(&visits)
+	if visits != 2 {
+		t.Errorf("expected 2 visits, got %d", visits)
+	}
+}
+
+func TestHandleVisits_SplitAtMidnight(t *testing.T) {
+	setupTest()
+	t.Setenv("SPLIT_SESSIONS_AT_MIDNIGHT", "true")
+	start, end := lateVisit()
+	saveVisitToDB(1, start, end)
+
+	req, _ := http.NewRequest("GET", "/visits", nil)
+	rr := httptest.NewRecorder()
+	handleVisits(rr, req)
+
+	var visits []Visit
+	if err := json.Unmarshal(rr.Body.Bytes(), &visits); err != nil {
+		t.Fatalf("failed to parse response: %v", err)
+	}
+	if len(visits) != 2 {
+		t.Fatalf("expected 2 segments, got %+v", visits)
+	}
+	// Newest first, both of the same visit
+	if visits[0].ID != visits[1].ID || !visits[0].SignInTime.Equal(start.Add(2*time.Hour)) || !visits[1].SignOutTime.Equal(start.Add(2*time.Hour)) {
+		t.Errorf("unexpected segments: %+v", visits)
+	}
+}
+
+func TestHandleHistoryAggregate_SplitAtMidnight(t *testing.T) {
+	setupTest()
+	start, end := lateVisit()
+	saveVisitToDB(1, start, end)
+	from := url.QueryEscape(start.Add(2 * time.Hour).Format(time.RFC3339))
+
+	aggregate := func() []MemberTotals {
+		req, _ := http.NewRequest("GET", "/history/aggregate?from="+from, nil)
+		rr := httptest.NewRecorder()
+		handleHistoryAggregate(rr, req)
+		var resp AggregateResponse
+		if err := json.Unmarshal(rr.Body.Bytes(), &resp); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return resp.Groups
+	}
+
+	// Without the option the whole session belongs to the first day
+	if groups := aggregate(); len(groups) != 0 {
+		t.Fatalf("expected no totals from midnight, got %+v", groups)
+	}
+
+	// Turning it on counts the old visit once backfilled
+	t.Setenv("SPLIT_SESSIONS_AT_MIDNIGHT", "true")
+	if _, err := backfillVisitSegments(); err != nil {
+		t.Fatalf("backfill failed: %v", err)
+	}
+	groups := aggregate()
+	if len(groups) != 1 || groups[0].Sessions != 1 || groups[0].TotalSeconds != 2*3600 {
+		t.Errorf("expected 2 hours after midnight, got %+v", groups)
+	}
+}
+
+func TestHandleVisitSegmentsBackfill(t *testing.T) {
+	setupTest()
+	start, end := lateVisit()
+	saveVisitToDB(1, start, end)
+	saveVisitToDB(2, start.Add(-3*time.Hour), start.Add(-time.Hour))
+
+	backfill := func() BackfillReport {
+		req, _ := http.NewRequest("POST", "/admin/visit-segments/backfill", nil)
+		rr := httptest.NewRecorder()
+		handleVisitSegmentsBackfill(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 OK, got %v; body=%s", rr.Code, rr.Body.String())
+		}
+		var report BackfillReport
+		if err := json.Unmarshal(rr.Body.Bytes(), &report); err != nil {
+			t.Fatalf("failed to parse response: %v", err)
+		}
+		return report
+	}
+
+	if report := backfill(); report.Visits != 2 || report.Segments != 3 {
+		t.Errorf("unexpected report: %+v", report)
+	}
+	// Visits already split are left alone
+	if report := backfill(); report.Visits != 0 || report.Segments != 0 {
+		t.Errorf("expected nothing left to split, got %+v", report)
+	}
+	if n := countVisitSegments(t); n != 3 {
+		t.Errorf("expected 3 segments, got %d", n)
+	}
+	if entries, _ := loadAuditEntries("visits.segments_backfilled", 10); len(entries) != 2 {
+		t.Errorf("expected 2 audit entries, got %d", len(entries))
+	}
+
+	req, _ := http.NewRequest("GET", "/admin/visit-segments/backfill", nil)
+	rr := httptest.NewRecorder()
+	handleVisitSegmentsBackfill(rr, req)
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405, got %v", rr.Code)
+	}
+}
+
+func TestDeleteVisit_RemovesSegments(t *testing.T) {
+	setupTest()
+	t.Setenv("SPLIT_SESSIONS_AT_MIDNIGHT", "true")
+	start, end := lateVisit()
+	saveVisitToDB(1, start, end)
+
+	if _, err := db.Exec(`DELETE FROM visits`); err != nil {
+		t.Fatalf("failed deleting visits: %v", err)
+	}
+	if n := countVisitSegments(t); n != 0 {
+		t.Errorf("expected segments deleted with their visit, got %d", n)
+	}
+}
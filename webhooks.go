@@ -0,0 +1,366 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// --- Webhook Delivery Log ---
+//
+// Every notification posted to an integration's webhook (see notifications.go)
+// is stored as a delivery with each attempt's response code or error, so an
+// integration that was down can be caught up on the messages it missed:
+//   - GET /webhooks/{integration}/deliveries lists them, newest first
+//     (?status= pending, retrying, failed or delivered; ?limit=, default 50)
+//   - POST /webhooks/{integration}/deliveries/{n}/retry posts delivery n
+//     again, with the usual retries, to the webhook it was first sent to
+//
+// Webhook URLs are secrets, so a delivery only stores which webhook it went
+// to (see webhookURL) and the URL is looked up again for a retry. Deliveries
+// logged before that stored the URL itself; it is dropped at startup (see
+// dropWebhookDeliveryURLs).
+//
+// Notifications dropped in quiet hours were never sent and are not logged.
+// Deliveries older than webhookDeliveryRetention are deleted by the database
+// maintenance run (see maintenance.go).
+
+const (
+	webhookDeliveryRetention = 30 * 24 * time.Hour
+	webhookTimeout           = 10 * time.Second
+
+	deliveryPending   = "pending"  // Queued, not attempted yet
+	deliveryRetrying  = "retrying" // The last attempt failed, another is scheduled
+	deliveryFailed    = "failed"   // Every attempt failed
+	deliveryDelivered = "delivered"
+)
+
+// WebhookAttempt is one post of a delivery
+type WebhookAttempt struct {
+	AttemptedAt  time.Time `json:"attempted_at"`
+	ResponseCode int       `json:"response_code,omitempty"` // 0 if the webhook was unreachable
+	Error        string    `json:"error,omitempty"`
+}
+
+// WebhookDelivery is a notification posted to an integration's webhook
+type WebhookDelivery struct {
+	ID          int64            `json:"id"`
+	Integration string           `json:"integration"`
+	Org         string           `json:"org"`
+	Message     string           `json:"message"`
+	Status      string           `json:"status"`
+	CreatedAt   time.Time        `json:"created_at"`
+	Attempts    []WebhookAttempt `json:"attempts"`
+
+	webhook string // webhookOfIntegration or webhookOfOrg, not shown
+}
+
+// webhookPayload returns a Discord/Slack compatible message body
+func webhookPayload(message string) []byte {
+	payload, _ := json.Marshal(map[string]string{
+		"content": message, // Discord
+		"text":    message, // Slack
+	})
+	return payload
+}
+
+// sendWebhook posts a payload to a webhook and returns the response code
+func sendWebhook(url string, payload []byte) (int, error) {
+	client := &http.Client{Timeout: webhookTimeout}
+	resp, err := client.Post(url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook returned status %d", resp.StatusCode)
+	}
+	logIntegrations.debugf("Webhook delivered (status %d)", resp.StatusCode)
+	return resp.StatusCode, nil
+}
+
+// submitWebhook posts a message on the background worker pool, calling
+// attempted, if set, after every attempt with its number
+func submitWebhook(url, message string, attempted func(attempt, code int, err error)) {
+	payload := webhookPayload(message)
+	attempt := 0
+	jobs.submit("webhook", func() error {
+		attempt++
+		code, err := sendWebhook(url, payload)
+		if attempted != nil {
+			attempted(attempt, code, err)
+		}
+		return err
+	})
+}
+
+// deliverWebhook posts a notification of an integration to a webhook (see
+// webhookURL), logging the delivery
+func deliverWebhook(org, integration, webhook, url, message string) {
+	res, err := db.Exec(`INSERT INTO webhook_deliveries (integration, org, webhook, message, status, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, integration, org, webhook, message, deliveryPending, time.Now().UTC().Format(time.RFC3339))
+	if err != nil {
+		// Still worth sending without a log entry
+		log.Printf("Error saving webhook delivery: %v", err)
+		submitWebhook(url, message, nil)
+		return
+	}
+	id, _ := res.LastInsertId()
+	submitWebhook(url, message, func(attempt, code int, err error) {
+		recordWebhookAttempt(id, attempt, code, err, time.Now())
+	})
+}
+
+// recordWebhookAttempt saves an attempt of a delivery and updates its status
+func recordWebhookAttempt(id int64, attempt, code int, sendErr error, now time.Time) {
+	status, errText := deliveryDelivered, ""
+	if sendErr != nil {
+		errText = sendErr.Error()
+		status = deliveryRetrying
+		if attempt >= maxJobAttempts {
+			status = deliveryFailed
+		}
+	}
+
+	tx, err := db.Begin()
+	if err == nil {
+		defer tx.Rollback()
+		_, err = tx.Exec(`INSERT INTO webhook_delivery_attempts (delivery_id, attempted_at, response_code, error)
+			VALUES (?, ?, ?, ?)`, id, now.UTC().Format(time.RFC3339Nano), code, errText)
+	}
+	if err == nil {
+		_, err = tx.Exec(`UPDATE webhook_deliveries SET status = ? WHERE id = ?`, status, id)
+	}
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		log.Printf("Error saving attempt of webhook delivery %d: %v", id, err)
+	}
+}
+
+// loadWebhookDeliveries returns the deliveries of an integration, newest
+// first, with their attempts. status filters them if set.
+func loadWebhookDeliveries(integration, status string, limit int) ([]WebhookDelivery, error) {
+	query := `SELECT id, integration, org, webhook, message, status, created_at FROM webhook_deliveries WHERE integration = ?`
+	args := []any{integration}
+	if status != "" {
+		query += ` AND status = ?`
+		args = append(args, status)
+	}
+	query += ` ORDER BY id DESC LIMIT ?`
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		d, err := scanWebhookDelivery(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// Once the rows, which hold a connection, are closed
+	for i := range deliveries {
+		if deliveries[i].Attempts, err = loadWebhookAttempts(deliveries[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return deliveries, nil
+}
+
+// loadWebhookDelivery returns a delivery of an integration with its attempts
+func loadWebhookDelivery(integration string, id int64) (WebhookDelivery, error) {
+	row := db.QueryRow(`SELECT id, integration, org, webhook, message, status, created_at FROM webhook_deliveries
+		WHERE integration = ? AND id = ?`, integration, id)
+	d, err := scanWebhookDelivery(row)
+	if err != nil {
+		return d, err
+	}
+	d.Attempts, err = loadWebhookAttempts(id)
+	return d, err
+}
+
+// scanWebhookDelivery scans a row of webhook_deliveries
+func scanWebhookDelivery(row interface{ Scan(...any) error }) (WebhookDelivery, error) {
+	var d WebhookDelivery
+	var createdAt string
+	if err := row.Scan(&d.ID, &d.Integration, &d.Org, &d.webhook, &d.Message, &d.Status, &createdAt); err != nil {
+		return d, err
+	}
+	var err error
+	d.CreatedAt, err = time.Parse(time.RFC3339, createdAt)
+	return d, err
+}
+
+// loadWebhookAttempts returns the attempts of a delivery, oldest first
+func loadWebhookAttempts(id int64) ([]WebhookAttempt, error) {
+	rows, err := db.Query(`SELECT attempted_at, response_code, error FROM webhook_delivery_attempts
+		WHERE delivery_id = ? ORDER BY id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	attempts := []WebhookAttempt{}
+	for rows.Next() {
+		var a WebhookAttempt
+		var attemptedAt string
+		if err := rows.Scan(&attemptedAt, &a.ResponseCode, &a.Error); err != nil {
+			return nil, err
+		}
+		if a.AttemptedAt, err = time.Parse(time.RFC3339Nano, attemptedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, rows.Err()
+}
+
+// dropWebhookDeliveryURLs removes the url column of deliveries logged before
+// only the webhook was stored. They are taken to have gone to the integration's
+// URL for the host and to the organization's otherwise, as notifyOrg does
+// unless the host has its own webhook_url.
+func dropWebhookDeliveryURLs() error {
+	found, err := hasColumn("webhook_deliveries", "url")
+	if err != nil || !found {
+		return err
+	}
+	if err := ensureColumn("webhook_deliveries", "webhook", `TEXT NOT NULL DEFAULT '`+webhookOfIntegration+`'`); err != nil {
+		return err
+	}
+	if _, err := db.Exec(`UPDATE webhook_deliveries SET webhook = ? WHERE org != ?`, webhookOfOrg, defaultOrg); err != nil {
+		return err
+	}
+	_, err = db.Exec(`ALTER TABLE webhook_deliveries DROP COLUMN url`)
+	return err
+}
+
+// pruneWebhookDeliveries deletes deliveries older than the retention, with their attempts
+func pruneWebhookDeliveries(now time.Time) (int64, error) {
+	res, err := db.Exec(`DELETE FROM webhook_deliveries WHERE created_at < ?`,
+		now.Add(-webhookDeliveryRetention).UTC().Format(time.RFC3339))
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// handleWebhooks serves /webhooks/{integration}/deliveries and
+// /webhooks/{integration}/deliveries/{n}/retry
+func handleWebhooks(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/webhooks/"), "/")
+	if len(parts) < 2 || parts[1] != "deliveries" {
+		http.NotFound(w, r)
+		return
+	}
+	integration := parts[0]
+	if !knownIntegration(integration) {
+		http.Error(w, "Unknown integration", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case len(parts) == 2:
+		handleWebhookDeliveries(w, r, integration)
+	case len(parts) == 4 && parts[3] == "retry":
+		id, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil || id < 1 {
+			http.Error(w, "Invalid delivery ID", http.StatusBadRequest)
+			return
+		}
+		handleWebhookRetry(w, r, integration, id)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// handleWebhookDeliveries lists the deliveries of an integration (GET)
+func handleWebhookDeliveries(w http.ResponseWriter, r *http.Request, integration string) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+
+	status := r.URL.Query().Get("status")
+	switch status {
+	case "", deliveryPending, deliveryRetrying, deliveryFailed, deliveryDelivered:
+	default:
+		http.Error(w, "Invalid 'status' parameter, expected pending, retrying, failed or delivered", http.StatusBadRequest)
+		return
+	}
+	limit := 50
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		if n, err := fmt.Sscanf(limitStr, "%d", &limit); err != nil || n != 1 || limit < 0 {
+			http.Error(w, "Invalid 'limit' parameter, expected positive integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	deliveries, err := loadWebhookDeliveries(integration, status, limit)
+	if err != nil {
+		log.Printf("Error querying webhook deliveries: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// handleWebhookRetry posts a delivery again (POST)
+func handleWebhookRetry(w http.ResponseWriter, r *http.Request, integration string, id int64) {
+	if r.Method != http.MethodPost {
+		methodNotAllowed(w, http.MethodPost)
+		return
+	}
+
+	d, err := loadWebhookDelivery(integration, id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("Error querying webhook delivery: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if d.Status == deliveryPending || d.Status == deliveryRetrying {
+		http.Error(w, "Delivery is still being sent", http.StatusConflict)
+		return
+	}
+	url := webhookURL(d.Org, d.Integration, d.webhook)
+	if url == "" {
+		http.Error(w, "The delivery's webhook is no longer configured", http.StatusConflict)
+		return
+	}
+
+	if _, err := db.Exec(`UPDATE webhook_deliveries SET status = ? WHERE id = ?`, deliveryPending, id); err != nil {
+		log.Printf("Error updating webhook delivery: %v", err)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	submitWebhook(url, d.Message, func(attempt, code int, err error) {
+		recordWebhookAttempt(id, attempt, code, err, time.Now())
+	})
+	recordAudit("webhook.retried", clientIP(r), fmt.Sprintf("integration=%s delivery=%d", integration, id))
+
+	d.Status = deliveryPending
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(d)
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// Webhook Delivery Log Tests
+// ============================================================================
+
+// flakyWebhook starts a webhook answering 503 until up is set, and points key at it
+func flakyWebhook(t *testing.T, key string) (up *atomic.Bool, calls *atomic.Int32) {
+	t.Helper()
+	up, calls = &atomic.Bool{}, &atomic.Int32{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		if !up.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	t.Cleanup(server.Close)
+	t.Setenv(key, server.URL)
+	return up, calls
+}
+
+// webhookRequest sends a request to /webhooks/...
+func webhookRequest(method, path string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest(method, path, nil)
+	rr := httptest.NewRecorder()
+	handleWebhooks(rr, req)
+	return rr
+}
+
+// listDeliveries fetches the deliveries at path
+func listDeliveries(t *testing.T, path string) []WebhookDelivery {
+	t.Helper()
+	rr := webhookRequest("GET", path)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	var deliveries []WebhookDelivery
+	json.NewDecoder(rr.Body).Decode(&deliveries)
+	return deliveries
+}
+
+func TestWebhookDeliveries_FailedThenRetried(t *testing.T) {
+	setupTest()
+	fastRetries(t)
+	up, calls := flakyWebhook(t, "ALERT_WEBHOOK_URL")
+
+	sendAlert("scanner offline")
+	jobs.wait()
+
+	deliveries := listDeliveries(t, "/webhooks/alerts/deliveries")
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 delivery, got %+v", deliveries)
+	}
+	d := deliveries[0]
+	if d.Status != deliveryFailed || d.Message != "scanner offline" || d.Org != defaultOrg || len(d.Attempts) != maxJobAttempts {
+		t.Fatalf("expected a failed delivery with every attempt, got %+v", d)
+	}
+	if a := d.Attempts[0]; a.ResponseCode != http.StatusServiceUnavailable || a.Error == "" {
+		t.Errorf("expected the attempt's response code and error, got %+v", a)
+	}
+
+	// Once the webhook is back, the delivery is sent again
+	up.Store(true)
+	rr := webhookRequest("POST", "/webhooks/alerts/deliveries/"+strconv.FormatInt(d.ID, 10)+"/retry")
+	if rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	jobs.wait()
+
+	if n := calls.Load(); n != maxJobAttempts+1 {
+		t.Errorf("expected one more post, got %d in total", n)
+	}
+	delivered := listDeliveries(t, "/webhooks/alerts/deliveries?status=delivered")
+	if len(delivered) != 1 || len(delivered[0].Attempts) != maxJobAttempts+1 || delivered[0].Attempts[maxJobAttempts].ResponseCode != http.StatusNoContent {
+		t.Errorf("expected the delivery delivered on its last attempt, got %+v", delivered)
+	}
+	if entries, _ := loadAuditEntries("webhook.retried", 10); len(entries) != 1 {
+		t.Errorf("expected the retry audited, got %+v", entries)
+	}
+}
+
+func TestWebhookDeliveries_RetryUsesCurrentURL(t *testing.T) {
+	setupTest()
+	fastRetries(t)
+	flakyWebhook(t, "ALERT_WEBHOOK_URL")
+
+	sendAlert("scanner offline")
+	jobs.wait()
+
+	deliveries := listDeliveries(t, "/webhooks/alerts/deliveries?status=failed")
+	if len(deliveries) != 1 {
+		t.Fatalf("expected 1 failed delivery, got %+v", deliveries)
+	}
+	if found, err := hasColumn("webhook_deliveries", "url"); err != nil || found {
+		t.Errorf("expected webhook URLs not stored, got %v (%v)", found, err)
+	}
+	retry := "/webhooks/alerts/deliveries/" + strconv.FormatInt(deliveries[0].ID, 10) + "/retry"
+
+	// The webhook moved; the retry goes to its new URL
+	up, calls := flakyWebhook(t, "ALERT_WEBHOOK_URL")
+	up.Store(true)
+	if rr := webhookRequest("POST", retry); rr.Code != http.StatusAccepted {
+		t.Fatalf("expected 202 Accepted, got %v; body=%s", rr.Code, rr.Body.String())
+	}
+	jobs.wait()
+	if n := calls.Load(); n != 1 {
+		t.Errorf("expected the retry posted to the new URL, got %d posts", n)
+	}
+
+	// Without a webhook there is nowhere to send it
+	t.Setenv("ALERT_WEBHOOK_URL", "")
+	if rr := webhookRequest("POST", retry); rr.Code != http.StatusConflict {
+		t.Errorf("expected 409 Conflict without a webhook, got %v", rr.Code)
+	}
+}
+
+func TestDropWebhookDeliveryURLs(t *testing.T) {
+	setupTest()
+
+	// Deliveries logged when the URL was stored
+	if _, err := db.Exec(`DROP TABLE webhook_deliveries`); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec(`CREATE TABLE webhook_deliveries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		integration TEXT NOT NULL,
+		org TEXT NOT NULL,
+		url TEXT NOT NULL,
+		message TEXT NOT NULL,
+		status TEXT NOT NULL,
+		created_at TEXT NOT NULL
+	)`); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, org := range []string{defaultOrg, "ess"} {
+		if _, err := db.Exec(`INSERT INTO webhook_deliveries (integration, org, url, message, status, created_at)
+			VALUES (?, ?, 'https://discord.com/api/webhooks/1/secret', 'hi', ?, ?)`, integrationOffice, org, deliveryDelivered, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := dropWebhookDeliveryURLs(); err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	if found, _ := hasColumn("webhook_deliveries", "url"); found {
+		t.Error("expected the url column dropped")
+	}
+	deliveries, err := loadWebhookDeliveries(integrationOffice, "", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	webhooks := map[string]string{}
+	for _, d := range deliveries {
+		webhooks[d.Org] = d.webhook
+	}
+	if webhooks[defaultOrg] != webhookOfIntegration || webhooks["ess"] != webhookOfOrg {
+		t.Errorf("expected host deliveries on the integration's webhook and others on the org's, got %v", webhooks)
+	}
+
+	// Running it again does nothing
+	if err := dropWebhookDeliveryURLs(); err != nil {
+		t.Errorf("expected the migration to be idempotent, got %v", err)
+	}
+}
+
+func TestWebhookDeliveries_Filters(t *testing.T) {
+	setupTest()
+	up, _ := flakyWebhook(t, "NOTIFY_WEBHOOK_URL")
+	up.Store(true)
+
+	notify(integrationGoals, "first")
+	notify(integrationGoals, "second")
+	jobs.wait()
+
+	deliveries := listDeliveries(t, "/webhooks/goals/deliveries?limit=1")
+	if len(deliveries) != 1 || deliveries[0].Message != "second" || deliveries[0].Status != deliveryDelivered {
+		t.Errorf("expected the newest delivery, got %+v", deliveries)
+	}
+	if got := listDeliveries(t, "/webhooks/goals/deliveries?status=failed"); len(got) != 0 {
+		t.Errorf("expected no failed deliveries, got %+v", got)
+	}
+	if got := listDeliveries(t, "/webhooks/alerts/deliveries"); len(got) != 0 {
+		t.Errorf("expected no alerts deliveries, got %+v", got)
+	}
+}
+
+func TestWebhookDeliveries_Invalid(t *testing.T) {
+	setupTest()
+
+	cases := []struct {
+		method, path string
+		want         int
+	}{
+		{"GET", "/webhooks/nope/deliveries", http.StatusNotFound},
+		{"GET", "/webhooks/alerts/deliveries?status=lost", http.StatusBadRequest},
+		{"POST", "/webhooks/alerts/deliveries", http.StatusMethodNotAllowed},
+		{"POST", "/webhooks/alerts/deliveries/abc/retry", http.StatusBadRequest},
+		{"POST", "/webhooks/alerts/deliveries/99/retry", http.StatusNotFound},
+		{"GET", "/webhooks/alerts/deliveries/99/retry", http.StatusMethodNotAllowed},
+	}
+	for _, c := range cases {
+		if rr := webhookRequest(c.method, c.path); rr.Code != c.want {
+			t.Errorf("%s %s: expected %v, got %v", c.method, c.path, c.want, rr.Code)
+		}
+	}
+}
+
+func TestPruneWebhookDeliveries(t *testing.T) {
+	setupTest()
+	up, _ := flakyWebhook(t, "ALERT_WEBHOOK_URL")
+	up.Store(true)
+
+	sendAlert("old news")
+	jobs.wait()
+
+	if n, err := pruneWebhookDeliveries(time.Now()); err != nil || n != 0 {
+		t.Errorf("expected a recent delivery kept, got %d (%v)", n, err)
+	}
+	if n, err := pruneWebhookDeliveries(time.Now().Add(webhookDeliveryRetention + time.Hour)); err != nil || n != 1 {
+		t.Errorf("expected the expired delivery deleted, got %d (%v)", n, err)
+	}
+	var attempts int
+	db.QueryRow(`SELECT COUNT(*) FROM webhook_delivery_attempts`).Scan(&attempts)
+	if attempts != 0 {
+		t.Errorf("expected its attempts deleted with it, got %d", attempts)
+	}
+}
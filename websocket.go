@@ -0,0 +1,232 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// --- WebSocket ---
+//
+// The server side of RFC 6455, just enough for the device command channel
+// (see devicecommands.go): the opening handshake, text messages, ping, pong
+// and close. Messages may be fragmented but are limited to
+// websocketMaxMessage; extensions and subprotocols are not supported.
+
+const (
+	websocketGUID       = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	websocketMaxMessage = 64 << 10
+
+	wsContinuation = 0x0
+	wsText         = 0x1
+	wsBinary       = 0x2
+	wsClose        = 0x8
+	wsPing         = 0x9
+	wsPong         = 0xa
+
+	wsCloseNormal   = 1000
+	wsCloseProtocol = 1002
+	wsCloseTooBig   = 1009
+)
+
+var (
+	errWebSocketClosed = errors.New("websocket closed")
+	errWebSocketTooBig = errors.New("websocket message too big")
+)
+
+// wsConn is an upgraded WebSocket connection
+type wsConn struct {
+	conn    net.Conn
+	br      *bufio.Reader
+	writeMu sync.Mutex // Writes come from the reader (pongs) and the writer
+}
+
+// headerHasToken reports whether a comma-separated header contains a token
+func headerHasToken(h http.Header, name, token string) bool {
+	for _, value := range h.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// websocketAccept returns the Sec-WebSocket-Accept of a Sec-WebSocket-Key
+func websocketAccept(key string) string {
+	sum := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// upgradeWebSocket completes the opening handshake and takes over the
+// connection. On failure it has already written the error response.
+func upgradeWebSocket(w http.ResponseWriter, r *http.Request) (*wsConn, error) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return nil, errors.New("not a GET request")
+	}
+	if !headerHasToken(r.Header, "Connection", "upgrade") || !headerHasToken(r.Header, "Upgrade", "websocket") {
+		w.Header().Set("Upgrade", "websocket")
+		http.Error(w, "Expected a WebSocket upgrade", http.StatusUpgradeRequired)
+		return nil, errors.New("not a websocket upgrade")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "Unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, errors.New("unsupported websocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if decoded, err := base64.StdEncoding.DecodeString(key); err != nil || len(decoded) != 16 {
+		http.Error(w, "Invalid Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, errors.New("invalid websocket key")
+	}
+
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "WebSocket not supported", http.StatusInternalServerError)
+		return nil, err
+	}
+	conn.SetDeadline(time.Time{})
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\nConnection: Upgrade\r\nSec-WebSocket-Accept: %s\r\n\r\n", websocketAccept(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &wsConn{conn: conn, br: rw.Reader}, nil
+}
+
+// writeFrame writes one unfragmented, unmasked frame
+func (c *wsConn) writeFrame(opcode byte, payload []byte) error {
+	header := []byte{0x80 | opcode}
+	switch n := len(payload); {
+	case n < 126:
+		header = append(header, byte(n))
+	case n <= 0xffff:
+		header = append(header, 126)
+		header = binary.BigEndian.AppendUint16(header, uint16(n))
+	default:
+		header = append(header, 127)
+		header = binary.BigEndian.AppendUint64(header, uint64(n))
+	}
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+	if _, err := c.conn.Write(append(header, payload...)); err != nil {
+		return err
+	}
+	return nil
+}
+
+// writeText sends a text message
+func (c *wsConn) writeText(payload []byte) error {
+	return c.writeFrame(wsText, payload)
+}
+
+// close sends a close frame and closes the connection
+func (c *wsConn) close(code uint16, reason string) {
+	c.writeFrame(wsClose, append(binary.BigEndian.AppendUint16(nil, code), reason...))
+	c.conn.Close()
+}
+
+// readFrame reads one frame from the client, whose frames must be masked
+func (c *wsConn) readFrame() (fin bool, opcode byte, payload []byte, err error) {
+	var head [2]byte
+	if _, err = io.ReadFull(c.br, head[:]); err != nil {
+		return
+	}
+	fin, opcode = head[0]&0x80 != 0, head[0]&0x0f
+	if head[0]&0x70 != 0 || head[1]&0x80 == 0 {
+		return fin, opcode, nil, errors.New("unexpected reserved bits or unmasked frame")
+	}
+
+	length := uint64(head[1] & 0x7f)
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(c.br, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > websocketMaxMessage {
+		return fin, opcode, nil, errWebSocketTooBig
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(c.br, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(c.br, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, opcode, payload, nil
+}
+
+// readMessage returns the next text or binary message, answering pings on
+// the way. It returns errWebSocketClosed once the client closes the connection.
+func (c *wsConn) readMessage() (byte, []byte, error) {
+	var opcode byte
+	var message []byte
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			code := uint16(wsCloseProtocol)
+			if err == errWebSocketTooBig {
+				code = wsCloseTooBig
+			}
+			if err != io.EOF && !errors.Is(err, net.ErrClosed) {
+				c.close(code, err.Error())
+			}
+			return 0, nil, err
+		}
+
+		switch op {
+		case wsPing:
+			c.writeFrame(wsPong, payload)
+		case wsPong:
+		case wsClose:
+			c.close(wsCloseNormal, "")
+			return 0, nil, errWebSocketClosed
+		case wsText, wsBinary, wsContinuation:
+			if (op == wsContinuation) != (message != nil) {
+				c.close(wsCloseProtocol, "unexpected continuation")
+				return 0, nil, errors.New("unexpected continuation frame")
+			}
+			if op != wsContinuation {
+				opcode, message = op, []byte{}
+			}
+			if len(message)+len(payload) > websocketMaxMessage {
+				c.close(wsCloseTooBig, "")
+				return 0, nil, errWebSocketTooBig
+			}
+			message = append(message, payload...)
+			if fin {
+				return opcode, message, nil
+			}
+		default:
+			c.close(wsCloseProtocol, "unknown opcode")
+			return 0, nil, fmt.Errorf("unknown websocket opcode %d", op)
+		}
+	}
+}
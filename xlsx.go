@@ -0,0 +1,223 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// --- XLSX Writer ---
+//
+// A minimal Office Open XML spreadsheet writer, enough for reports: several
+// sheets of typed cells with a bold, frozen header row. Cell values may be
+// string, int, int64, float64 (two decimals), time.Time (date and time),
+// xlsxDate (date only) or nil (empty).
+
+// xlsxContentType is the MIME type of .xlsx files
+const xlsxContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+
+// xlsxDate is a cell value shown as a date without a time
+type xlsxDate time.Time
+
+// xlsxSheet is one worksheet: a header row followed by data rows
+type xlsxSheet struct {
+	Name   string
+	Header []string
+	Rows   [][]interface{}
+}
+
+// xlsxPart is a file inside the workbook archive
+type xlsxPart struct {
+	name string
+	data []byte
+}
+
+// Cell styles, indexes into cellXfs in xlsxStyles
+const (
+	xlsxStyleDefault = iota
+	xlsxStyleHeader
+	xlsxStyleDateTime
+	xlsxStyleDate
+	xlsxStyleDecimal
+)
+
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<numFmts count="1"><numFmt numFmtId="164" formatCode="yyyy-mm-dd hh:mm"/></numFmts>
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="5">
+<xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/>
+<xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/>
+<xf numFmtId="164" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="14" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+<xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/>
+</cellXfs>
+</styleSheet>`
+
+// xlsxEpoch is day zero of Excel's date serial numbers
+var xlsxEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// xlsxSerial converts a time to an Excel serial number, keeping its wall clock
+func xlsxSerial(t time.Time) float64 {
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+	return wall.Sub(xlsxEpoch).Hours() / 24
+}
+
+// xlsxColumn returns the letters of a zero-based column index (0 -> A, 26 -> AA)
+func xlsxColumn(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+// xlsxEscape escapes text for XML content and attributes
+func xlsxEscape(s string) string {
+	var b bytes.Buffer
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// writeXLSXCell writes one cell and returns the width of its displayed value
+func writeXLSXCell(b *bytes.Buffer, ref string, value interface{}, header bool) int {
+	number := func(v string, style int) {
+		fmt.Fprintf(b, `<c r="%s" s="%d"><v>%s</v></c>`, ref, style, v)
+	}
+	text := func(s string) int {
+		style := xlsxStyleDefault
+		if header {
+			style = xlsxStyleHeader
+		}
+		fmt.Fprintf(b, `<c r="%s" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, ref, style, xlsxEscape(s))
+		return utf8.RuneCountInString(s)
+	}
+
+	switch v := value.(type) {
+	case nil:
+		return 0
+	case string:
+		return text(v)
+	case int:
+		s := strconv.Itoa(v)
+		number(s, xlsxStyleDefault)
+		return len(s)
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		number(s, xlsxStyleDefault)
+		return len(s)
+	case float64:
+		number(strconv.FormatFloat(v, 'f', -1, 64), xlsxStyleDecimal)
+		return len(strconv.FormatFloat(v, 'f', 2, 64))
+	case time.Time:
+		number(strconv.FormatFloat(xlsxSerial(v), 'f', -1, 64), xlsxStyleDateTime)
+		return len("2006-01-02 15:04")
+	case xlsxDate:
+		number(strconv.FormatFloat(xlsxSerial(time.Time(v)), 'f', -1, 64), xlsxStyleDate)
+		return len("2006-01-02")
+	default:
+		return text(fmt.Sprint(v))
+	}
+}
+
+// xlsxWorksheet renders a sheet's XML
+func xlsxWorksheet(sheet xlsxSheet) []byte {
+	var data bytes.Buffer
+	widths := make([]int, len(sheet.Header))
+	writeRow := func(n int, values []interface{}, header bool) {
+		fmt.Fprintf(&data, `<row r="%d">`, n)
+		for i, value := range values {
+			w := writeXLSXCell(&data, xlsxColumn(i)+strconv.Itoa(n), value, header)
+			if i < len(widths) && w > widths[i] {
+				widths[i] = w
+			}
+		}
+		data.WriteString(`</row>`)
+	}
+
+	header := make([]interface{}, len(sheet.Header))
+	for i, h := range sheet.Header {
+		header[i] = h
+	}
+	writeRow(1, header, true)
+	for i, row := range sheet.Rows {
+		writeRow(i+2, row, false)
+	}
+
+	var b bytes.Buffer
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n")
+	b.WriteString(`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">`)
+	b.WriteString(`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>`)
+	if len(widths) > 0 {
+		b.WriteString(`<cols>`)
+		for i, w := range widths {
+			fmt.Fprintf(&b, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, i+1, i+1, min(max(w, 8), 60)+2)
+		}
+		b.WriteString(`</cols>`)
+	}
+	b.WriteString(`<sheetData>`)
+	b.Write(data.Bytes())
+	b.WriteString(`</sheetData></worksheet>`)
+	return b.Bytes()
+}
+
+// writeXLSX writes a workbook with the given sheets
+func writeXLSX(w io.Writer, sheets []xlsxSheet) error {
+	var contentTypes, workbook, rels bytes.Buffer
+	contentTypes.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+`)
+	workbook.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>`)
+	rels.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rIdStyles" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>
+`)
+	for i, sheet := range sheets {
+		n := i + 1
+		fmt.Fprintf(&contentTypes, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", n)
+		fmt.Fprintf(&workbook, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xlsxEscape(sheet.Name), n, n)
+		fmt.Fprintf(&rels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", n, n)
+	}
+	contentTypes.WriteString(`</Types>`)
+	workbook.WriteString(`</sheets></workbook>`)
+	rels.WriteString(`</Relationships>`)
+
+	files := []xlsxPart{
+		{"[Content_Types].xml", contentTypes.Bytes()},
+		{"_rels/.rels", []byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`)},
+		{"xl/workbook.xml", workbook.Bytes()},
+		{"xl/_rels/workbook.xml.rels", rels.Bytes()},
+		{"xl/styles.xml", []byte(xlsxStyles)},
+	}
+	for i, sheet := range sheets {
+		files = append(files, xlsxPart{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxWorksheet(sheet)})
+	}
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			return err
+		}
+		if _, err := fw.Write(f.data); err != nil {
+			return err
+		}
+	}
+	return zw.Close()
+}
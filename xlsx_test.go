@@ -0,0 +1,104 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+// ============================================================================
+// XLSX Writer Tests
+// ============================================================================
+
+// readXLSX unzips a workbook and returns its files by name, failing the test
+// if any XML part is not well formed
+func readXLSX(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatalf("not a zip archive: %v", err)
+	}
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatalf("failed to open %s: %v", f.Name, err)
+		}
+		content, _ := io.ReadAll(rc)
+		rc.Close()
+
+		dec := xml.NewDecoder(bytes.NewReader(content))
+		for {
+			if _, err := dec.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				t.Fatalf("%s is not well formed: %v", f.Name, err)
+			}
+		}
+		files[f.Name] = string(content)
+	}
+	return files
+}
+
+func TestXLSXColumn(t *testing.T) {
+	tests := map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"}
+	for i, want := range tests {
+		if got := xlsxColumn(i); got != want {
+			t.Errorf("xlsxColumn(%d) = %q, want %q", i, got, want)
+		}
+	}
+}
+
+func TestXLSXSerial(t *testing.T) {
+	if got := xlsxSerial(time.Date(1900, 3, 1, 0, 0, 0, 0, time.UTC)); got != 61 {
+		t.Errorf("expected 1900-03-01 to be day 61, got %v", got)
+	}
+	// The wall clock is kept whatever the zone
+	est := time.FixedZone("EST", -5*3600)
+	if got := xlsxSerial(time.Date(2025, 1, 1, 18, 0, 0, 0, est)); got != 45658.75 {
+		t.Errorf("expected 2025-01-01 18:00 to be 45658.75, got %v", got)
+	}
+}
+
+func TestWriteXLSX(t *testing.T) {
+	var buf bytes.Buffer
+	err := writeXLSX(&buf, []xlsxSheet{
+		{Name: "People & hours", Header: []string{"Name", "Hours"}, Rows: [][]interface{}{
+			{"Alice <admin>", 1.5},
+			{"Bob", nil},
+		}},
+		{Name: "Days", Header: []string{"Date", "Visitors"}, Rows: [][]interface{}{
+			{xlsxDate(time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)), 3},
+		}},
+	})
+	if err != nil {
+		t.Fatalf("writeXLSX failed: %v", err)
+	}
+
+	files := readXLSX(t, buf.Bytes())
+	for _, name := range []string{"[Content_Types].xml", "_rels/.rels", "xl/workbook.xml", "xl/_rels/workbook.xml.rels",
+		"xl/styles.xml", "xl/worksheets/sheet1.xml", "xl/worksheets/sheet2.xml"} {
+		if _, ok := files[name]; !ok {
+			t.Errorf("expected %s in the workbook", name)
+		}
+	}
+
+	if !strings.Contains(files["xl/workbook.xml"], `name="People &amp; hours"`) {
+		t.Errorf("expected escaped sheet name, got %s", files["xl/workbook.xml"])
+	}
+	sheet := files["xl/worksheets/sheet1.xml"]
+	if !strings.Contains(sheet, `<c r="A2" s="0" t="inlineStr"><is><t xml:space="preserve">Alice &lt;admin&gt;</t></is></c>`) {
+		t.Errorf("expected an escaped inline string in A2, got %s", sheet)
+	}
+	if !strings.Contains(sheet, `<c r="B2" s="4"><v>1.5</v></c>`) || strings.Contains(sheet, `r="B3"`) {
+		t.Errorf("expected a decimal in B2 and no B3 cell, got %s", sheet)
+	}
+	if !strings.Contains(files["xl/worksheets/sheet2.xml"], `<c r="A2" s="3"><v>45658</v></c>`) {
+		t.Errorf("expected a date serial in A2, got %s", files["xl/worksheets/sheet2.xml"])
+	}
+}